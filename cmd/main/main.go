@@ -2,23 +2,60 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"slices"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 
+	"www.github.com/Wanderer0074348/HybridLM/src/analytics"
+	"www.github.com/Wanderer0074348/HybridLM/src/annotations"
+	"www.github.com/Wanderer0074348/HybridLM/src/assistants"
+	"www.github.com/Wanderer0074348/HybridLM/src/auth"
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
 	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/canary"
 	"www.github.com/Wanderer0074348/HybridLM/src/chat"
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/degradation"
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/faq"
+	"www.github.com/Wanderer0074348/HybridLM/src/flags"
 	"www.github.com/Wanderer0074348/HybridLM/src/handlers"
+	"www.github.com/Wanderer0074348/HybridLM/src/health"
+	"www.github.com/Wanderer0074348/HybridLM/src/hooks"
 	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/jobs"
+	"www.github.com/Wanderer0074348/HybridLM/src/knowledge"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/moderation"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+	"www.github.com/Wanderer0074348/HybridLM/src/preferences"
+	"www.github.com/Wanderer0074348/HybridLM/src/privacy"
+	"www.github.com/Wanderer0074348/HybridLM/src/receipts"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
+	"www.github.com/Wanderer0074348/HybridLM/src/replication"
 	"www.github.com/Wanderer0074348/HybridLM/src/router"
+	"www.github.com/Wanderer0074348/HybridLM/src/storage"
+	"www.github.com/Wanderer0074348/HybridLM/src/streaming"
+	"www.github.com/Wanderer0074348/HybridLM/src/supervisor"
+	"www.github.com/Wanderer0074348/HybridLM/src/terms"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+	"www.github.com/Wanderer0074348/HybridLM/src/vcr"
+	"www.github.com/Wanderer0074348/HybridLM/src/warehouse"
 )
 
 func init() {
@@ -32,15 +69,8 @@ func init() {
 
 func main() {
 
-	if os.Getenv("LLM_API_KEY") == "" {
-		log.Fatal("❌ LLM_API_KEY not set in environment or .env file")
-	}
-	if os.Getenv("GROQ_API_KEY") == "" {
-		log.Fatal("❌ GROQ_API_KEY not set in environment or .env file")
-	}
-
-	log.Println("✅ Environment variables loaded successfully")
-
+	// Secrets are checked by the subsystems that need them, so disabled
+	// subsystems don't require theirs
 	cfg, err := config.LoadConfig()
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
@@ -48,87 +78,1122 @@ func main() {
 
 	log.Printf("✓ Config loaded successfully")
 
+	// Set before any engine is created, including the async job runner's
+	gin.SetMode(gin.ReleaseMode)
+
+	var tracingMiddleware gin.HandlerFunc
+	shutdownTracing := func(context.Context) error { return nil }
+	if cfg.Tracing.Enabled {
+		shutdownTracing, err = tracing.Setup(context.Background(), cfg.Tracing)
+		if err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+		}
+		tracingMiddleware = otelgin.Middleware(cfg.Tracing.ServiceName)
+		log.Printf("✓ Exporting traces as %s (sampling %.0f%%)", cfg.Tracing.ServiceName, cfg.Tracing.SampleRatio*100)
+	}
+
 	redisCache, err := cache.NewRedisCache(&cfg.Redis)
 	if err != nil {
 		log.Fatalf("Failed to initialize Redis: %v", err)
 	}
 	defer redisCache.Close()
-	log.Printf("✓ Redis connected")
+	if degraded, _ := redisCache.Failover().Degraded(); !degraded {
+		log.Printf("✓ Redis connected")
+	}
 
-	slmEngine, err := inference.NewSLMEngine(&cfg.SLM)
+	switch cfg.Redis.AuthReads {
+	case "", "primary", "replica":
+	default:
+		log.Fatalf("Unknown redis.auth_reads %q, expected \"primary\" or \"replica\"", cfg.Redis.AuthReads)
+	}
+	replicaReader, err := cache.NewReplicaReader(&cfg.Redis, redisCache.Failover())
 	if err != nil {
-		log.Fatalf("Failed to initialize SLM engine: %v", err)
+		log.Fatalf("Failed to initialize Redis read replicas: %v", err)
+	}
+	if replicaReader != nil {
+		defer replicaReader.Close()
+		redisCache.SetReader(replicaReader)
+		log.Printf("✓ Serving cache and session reads from %d Redis read replica(s)", len(cfg.Redis.ReadReplicas))
+	}
+
+	healthRegistry := health.NewRegistry()
+	healthRegistry.Set("redis", health.StatusReady, "")
+
+	// Background workers are restarted after a panic instead of crashing the server
+	workers := supervisor.New(cfg.Supervisor)
+	workers.SetHealthRegistry(healthRegistry)
+	if cfg.Supervisor.AlertWebhook != "" {
+		workers.OnPanic(supervisor.WebhookAlert(cfg.Supervisor.AlertWebhook))
+	}
+
+	if failover := redisCache.Failover(); failover != nil {
+		setRedisHealth := func(degraded bool, err error) {
+			if degraded {
+				healthRegistry.Set("redis", health.StatusDegraded, fmt.Sprintf("serving from memory until Redis is back: %v", err))
+			} else {
+				healthRegistry.Set("redis", health.StatusReady, "")
+			}
+		}
+		failover.OnChange(setRedisHealth)
+		if degraded, _ := failover.Degraded(); degraded {
+			setRedisHealth(true, failover.PingPrimary(context.Background()))
+		}
+
+		reconnectCtx, stopReconnecting := context.WithCancel(context.Background())
+		defer stopReconnecting()
+		workers.Go(reconnectCtx, "redis_failover", failover.Run)
+		log.Printf("✓ Falling back to in-memory Redis while Redis is unreachable")
+	}
+
+	if cfg.VCR.Mode != "" {
+		recorder, err := vcr.New(cfg.VCR.Mode, cfg.VCR.Dir)
+		if err != nil {
+			log.Fatalf("Failed to initialize provider recorder: %v", err)
+		}
+		recorder.SetRealtime(cfg.VCR.Realtime)
+		inference.SetHTTPTransport(recorder)
+		log.Printf("📼 Provider calls: %s (cassettes in %s)", cfg.VCR.Mode, cfg.VCR.Dir)
+	}
+
+	var correlationHasher *correlation.Hasher
+	if cfg.Tracing.ProviderCorrelation.Enabled {
+		correlationHasher = correlation.NewHasher(cfg.Tracing.ProviderCorrelation.Secret)
+		inference.SetProviderCorrelation(correlationHasher)
+		log.Printf("✓ Provider calls tagged with hashed request and user IDs")
+	}
+
+	if cfg.MockProviders {
+		log.Println("🧪 MOCK_PROVIDERS enabled: LLM, SLM and embedding calls are served by local stubs")
+	}
+
+	var slmEngine models.SLMInferencer
+	if cfg.MockProviders {
+		slmEngine = mockSLM(cfg.SLM.Models[0].Name)
+	} else {
+		slmEngine, err = inference.NewSLMEngine(&cfg.SLM)
+		if err != nil {
+			log.Fatalf("Failed to initialize SLM engine: %v", err)
+		}
 	}
 	defer slmEngine.Close()
+	healthRegistry.Set("slm", health.StatusReady, "")
 	log.Printf("✓ SLM engine ready with %d models (%s strategy)", len(cfg.SLM.Models), cfg.SLM.Strategy)
 	for _, model := range cfg.SLM.Models {
 		log.Printf("  - %s (weight: %.1f)", model.Name, model.Weight)
 	}
 
-	llmClient, err := inference.NewLLMClient(&cfg.LLM)
+	privacyGuard, err := privacy.NewGuard(cfg.Privacy)
 	if err != nil {
-		log.Fatalf("Failed to initialize LLM client: %v", err)
+		log.Fatalf("Failed to initialize privacy guard: %v", err)
+	}
+	// What handlers, titles, analytics, moderation and expiry estimates call;
+	// slmEngine itself is kept for configuring the engine
+	slm := privacyGuard.WrapSLM(slmEngine)
+	if privacyGuard != nil && cfg.Privacy.SLM {
+		log.Printf("✓ Personal data screened before SLM calls (mode: %s)", privacyGuard.Mode())
+	}
+
+	// Left nil when the LLM tier is disabled; handlers then route everything to the SLM tier
+	var llm models.LLMInferencer
+	llmProvider := "" // Provider whose key LLM calls use, for spend caps
+	var llmPing func(context.Context) error
+	if cfg.LLM.Enabled && cfg.MockProviders {
+		llm = mockLLM(cfg.LLM.Model)
+		llmProvider = cfg.LLM.Provider
+		if llmProvider == "" {
+			llmProvider = "openai"
+		}
+		healthRegistry.Set("llm", health.StatusReady, "mock")
+		log.Printf("✓ LLM client ready: %s (mock)", cfg.LLM.Model)
+	} else if cfg.LLM.Enabled {
+		llmClient, err := inference.NewLLMClient(&cfg.LLM)
+		if err != nil {
+			log.Fatalf("Failed to initialize LLM client: %v", err)
+		}
+		llm = llmClient
+		llmProvider = llmClient.Provider()
+		llmPing = llmClient.Ping
+		healthRegistry.Set("llm", health.StatusReady, "")
+		log.Printf("✓ LLM client ready: %s (%s)", cfg.LLM.Model, llmClient.Provider())
+	} else {
+		healthRegistry.Set("llm", health.StatusDisabled, "")
+		log.Println("ℹ️  LLM tier disabled, all queries go to the SLM tier")
+	}
+	if llm != nil && privacyGuard != nil {
+		llm = privacyGuard.WrapLLM(llm)
+		log.Printf("✓ Personal data screened before cloud LLM calls (mode: %s)", privacyGuard.Mode())
 	}
-	log.Printf("✓ LLM client ready: %s", cfg.LLM.Model)
 
 	queryRouter := router.NewQueryRouter(&cfg.Router)
 	log.Printf("✓ Query router initialized")
+	var learnedStrategy *router.LearnedRoutingStrategy
+	if cfg.Router.Strategy == router.StrategyLearned {
+		learnedStrategy = router.NewLearnedRoutingStrategy(&cfg.Router, redisCache.GetClient())
+		if err := learnedStrategy.Load(context.Background()); err != nil {
+			log.Printf("⚠️  %v", err)
+		}
+		queryRouter.SetStrategy(learnedStrategy)
 
-	gin.SetMode(gin.ReleaseMode)
-	r := gin.Default()
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+		workers.Go(watchCtx, "learned_routing_model", func(ctx context.Context) {
+			learnedStrategy.Watch(ctx, cfg.Router.LearnedRefresh)
+		})
+		if learnedStrategy.Model() == nil {
+			log.Println("ℹ️  Learned routing enabled, using heuristic routing until a model is imported")
+		}
+	}
+
+	var policyEngine *router.PolicyEngine
+	if cfg.Router.PoliciesFile != "" {
+		policyEngine, err = router.NewPolicyEngine(cfg.Router.PoliciesFile)
+		if err != nil {
+			log.Fatalf("Failed to load routing policies: %v", err)
+		}
+		queryRouter.SetPolicies(policyEngine)
+
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+		workers.Go(watchCtx, "routing_policies", func(ctx context.Context) {
+			policyEngine.Watch(ctx, cfg.Router.PoliciesReload)
+		})
+		log.Printf("✓ %d routing policies loaded from %s", policyEngine.Len(), cfg.Router.PoliciesFile)
+	}
+
+	modelRegistry := registry.NewModelRegistry(cfg.Models)
+	if _, ok := modelRegistry.Get(cfg.LLM.Model); cfg.LLM.Enabled && !ok {
+		log.Printf("⚠️  LLM model %s not in model registry, using default context window", cfg.LLM.Model)
+	}
+	for _, model := range cfg.SLM.Models {
+		if _, ok := modelRegistry.Get(model.Name); !ok {
+			log.Printf("⚠️  SLM model %s not in model registry, using default context window", model.Name)
+		}
+	}
+	log.Printf("✓ Model registry loaded with %d models", len(modelRegistry.List()))
+
+	// Token counts are estimated from text length until the encodings are loaded
+	var tokenizedModels []string
+	for _, info := range modelRegistry.List() {
+		if info.Encoding != "" {
+			utils.SetModelEncoding(info.Name, info.Encoding)
+		}
+		tokenizedModels = append(tokenizedModels, info.Name)
+	}
+	utils.OnEncodingsChange(func(status utils.EncodingStatus) {
+		switch {
+		case status.Err != nil:
+			healthRegistry.Set("tokenizer", health.StatusDegraded, fmt.Sprintf("estimating token counts until the encodings load: %v", status.Err))
+		case len(status.Pending) > 0:
+			healthRegistry.Set("tokenizer", health.StatusStarting, "loading "+strings.Join(status.Pending, ", "))
+		default:
+			healthRegistry.Set("tokenizer", health.StatusReady, "")
+		}
+	})
+	utils.LoadEncodings(tokenizedModels...)
+
+	pricing, err := utils.NewPricingTable(cfg.Pricing)
+	if err != nil {
+		log.Fatalf("Failed to load pricing: %v", err)
+	}
+	utils.SetPricing(pricing)
+	if configFile := config.File(); configFile != "" {
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+		workers.Go(watchCtx, "pricing", func(ctx context.Context) {
+			utils.WatchPricing(ctx, configFile, cfg.Pricing.Reload)
+		})
+	}
+	log.Printf("✓ Pricing loaded with %d configured models", len(cfg.Pricing.Models))
+
+	slmModelNames := make([]string, 0, len(cfg.SLM.Models))
+	for _, model := range cfg.SLM.Models {
+		slmModelNames = append(slmModelNames, model.Name)
+	}
+	queryRouter.SetModelPool(modelRegistry, cfg.LLM.Model, slmModelNames)
+	for _, target := range cfg.Router.Targets {
+		if target.Tier == "slm" && !slices.Contains(slmModelNames, target.Model) {
+			log.Printf("⚠️  Routing target %s is not an SLM model, the SLM strategy will be used instead", target.Model)
+		}
+	}
+	if len(cfg.Router.Targets) > 0 {
+		log.Printf("✓ Routing to %d model targets", len(cfg.Router.Targets))
+	}
 
-	r.Use(gin.Recovery())
-	r.Use(corsMiddleware())
+	// Data residency rules keep an org's requests on models in its regions
+	var residency *router.Residency
+	if len(cfg.Residency.Rules) > 0 || len(cfg.Residency.DefaultRegions) > 0 {
+		residency = router.NewResidency(cfg.Residency, modelRegistry)
+		queryRouter.SetResidency(residency)
+		if engine, ok := slmEngine.(*inference.SLMEngine); ok {
+			engine.SetResidency(residency.Allows)
+		}
+		log.Printf("✓ Data residency enforced (%d org rules, default regions %v)", len(cfg.Residency.Rules), cfg.Residency.DefaultRegions)
+	}
+
+	// Answers are embedded for consensus, so they're screened and kept in the
+	// user's regions like the semantic cache's queries
+	if engine, ok := slmEngine.(*inference.SLMEngine); ok && cfg.SLM.AggregationFn == "embedding_consensus" {
+		if embedder := newEmbedder(cfg); embedder != nil {
+			engine.SetEmbedder(residency.WrapEmbedder(privacyGuard.WrapEmbedder(embedder), cache.EmbeddingModel))
+		} else {
+			log.Println("⚠️  SEMANTIC_CACHE_API_KEY not set, embedding_consensus aggregation falls back to voting")
+		}
+	}
+
+	if cfg.Router.Strategy == router.StrategyLLMClassifier || cfg.Router.Strategy == router.StrategyHybrid {
+		var classifierLLM models.LLMInferencer = mockClassifier()
+		if !cfg.MockProviders {
+			classifierLLM, err = inference.NewLLMClient(&config.LLMConfig{
+				Enabled:   true,
+				Provider:  cfg.Router.Classifier.Provider,
+				Endpoint:  cfg.Router.Classifier.Endpoint,
+				APIKey:    cfg.Router.Classifier.APIKey,
+				Model:     cfg.Router.Classifier.Model,
+				MaxTokens: 8,
+				Timeout:   cfg.Router.Classifier.Timeout,
+			})
+			if err != nil {
+				log.Fatalf("Failed to initialize complexity classifier: %v", err)
+			}
+		}
+		// The classifier sees every query, so it's screened and kept in the
+		// user's regions like the tiers are; failed calls fall back to heuristics
+		classifierLLM = residency.WrapLLM(privacyGuard.WrapLLM(classifierLLM), cfg.Router.Classifier.Model)
+		queryRouter.SetClassifier(router.NewLLMClassifier(classifierLLM, redisCache.GetClient(), &cfg.Router.Classifier))
+		log.Printf("✓ Complexity classifier ready: %s", cfg.Router.Classifier.Model)
+	}
+
+	responseCache, err := cache.NewBackend(cfg, redisCache)
+	if err != nil {
+		log.Fatalf("Failed to initialize the response cache: %v", err)
+	}
+	if _, ok := responseCache.(*cache.RedisCache); !ok {
+		defer responseCache.Close()
+		log.Printf("✓ Responses cached in %s", cfg.Cache.Backend)
+	}
+	if cfg.MemoryCache.Enabled && cfg.Cache.Backend != cache.BackendMemory {
+		responseCache = cache.NewMemoryCache(responseCache, cfg.MemoryCache)
+		log.Printf("✓ In-memory response cache enabled (%d entries, ttl %s)", cfg.MemoryCache.MaxEntries, cfg.MemoryCache.TTL)
+	}
 
 	inferenceHandler := handlers.NewInferenceHandler(
 		queryRouter,
-		slmEngine,
-		llmClient,
-		redisCache,
+		slm,
+		llm,
+		responseCache,
 	)
 
 	// Set model names for cost calculation
 	inferenceHandler.SetModelNames(cfg.LLM.Model, cfg.SLM.Models[0].Name)
+	inferenceHandler.SetModelRegistry(modelRegistry)
+	inferenceHandler.SetContinuation(cfg.Continuation)
+	cacheHandler := handlers.NewCacheHandler()
+	var thresholdTuner *cache.ThresholdTuner
+	cacheHandler.AddCache("exact", responseCache)
 
 	if cfg.SemanticCache.Enabled {
-		if cfg.SemanticCache.APIKey == "" {
+		if cfg.MockProviders {
+			// Stub embeddings have their own size
+			cfg.SemanticCache.VectorDim = fakes.EmbeddingDimensions
+		}
+		if cfg.SemanticCache.APIKey == "" && !cfg.MockProviders {
+			healthRegistry.Set("semantic_cache", health.StatusDegraded, "SEMANTIC_CACHE_API_KEY not set")
 			log.Println("⚠️  Semantic cache enabled but SEMANTIC_CACHE_API_KEY not set, using standard cache only")
 		} else {
-			semanticCache, err := cache.NewSemanticCache(&cfg.Redis, &cfg.SemanticCache)
-			if err != nil {
-				log.Printf("⚠️  Failed to initialize semantic cache: %v, falling back to standard cache", err)
-			} else {
-				inferenceHandler.SetSemanticCache(semanticCache, cfg.SemanticCache.SimilarityThreshold)
-				log.Printf("✓ Semantic cache enabled (threshold: %.2f)", cfg.SemanticCache.SimilarityThreshold)
+			// Connects on first use so a slow vector index doesn't hold up startup
+			semanticCache := cache.NewLazySemanticCache(&cfg.Redis, &cfg.SemanticCache)
+			semanticCache.SetFailover(redisCache.Failover())
+			if cfg.MockProviders || privacyGuard != nil || residency != nil {
+				semanticCache.SetEmbedder(residency.WrapEmbedder(privacyGuard.WrapEmbedder(newEmbedder(cfg)), cache.EmbeddingModel))
+			}
+			semanticCache.OnStatus(func(err error) {
+				if err != nil {
+					healthRegistry.Set("semantic_cache", health.StatusDegraded, err.Error())
+					log.Printf("⚠️  Semantic cache unavailable: %v, falling back to standard cache", err)
+					return
+				}
+				healthRegistry.Set("semantic_cache", health.StatusReady, "")
+				log.Printf("✓ Semantic cache connected")
+			})
+			defer semanticCache.Close()
+			healthRegistry.Set("semantic_cache", health.StatusStarting, "connects on first use")
+			inferenceHandler.SetSemanticCache(semanticCache, cfg.SemanticCache.SimilarityThreshold)
+			cacheHandler.AddCache("semantic", semanticCache)
+			log.Printf("✓ Semantic cache enabled (threshold: %.2f)", cfg.SemanticCache.SimilarityThreshold)
+			if tuning := cfg.SemanticCache.AutoTune; tuning.Enabled {
+				thresholdTuner = cache.NewThresholdTuner(redisCache.GetClient(), tuning, cfg.SemanticCache.SimilarityThreshold)
+				inferenceHandler.SetThresholdTuner(thresholdTuner)
+				cacheHandler.SetThresholdTuner(thresholdTuner)
+				log.Printf("✓ Similarity threshold tuned from feedback (%.2f-%.2f)", tuning.Min, tuning.Max)
 			}
 		}
 	} else {
+		healthRegistry.Set("semantic_cache", health.StatusDisabled, "")
 		log.Println("ℹ️  Semantic cache disabled, using standard exact-match cache")
 	}
+	inferenceHandler.SetHealthRegistry(healthRegistry)
+
+	dependencies := health.NewChecker(cfg.Health.ProbeTTL, cfg.Health.ProbeTimeout)
+	critical := func(name string) bool { return slices.Contains(cfg.Health.Critical, name) }
+	dependencies.Add("redis", critical("redis"), func(ctx context.Context) error {
+		// The client answers from memory during an outage; probe the server itself
+		if failover := redisCache.Failover(); failover != nil {
+			return failover.PingPrimary(ctx)
+		}
+		return redisCache.GetClient().Ping(ctx).Err()
+	})
+
+	// Users, chat sessions and usage are kept in PostgreSQL when configured,
+	// with Redis caching them
+	var database *storage.Postgres
+	if cfg.Storage.Backend == "postgres" {
+		database, err = storage.NewPostgres(cfg.Storage.Postgres)
+		if err != nil {
+			log.Fatalf("Failed to initialize PostgreSQL storage: %v", err)
+		}
+		defer database.Close()
+		dependencies.Add("postgres", critical("postgres"), database.Ping)
+
+		pruneCtx, stopPruning := context.WithCancel(context.Background())
+		defer stopPruning()
+		workers.Go(pruneCtx, "session_pruning", func(ctx context.Context) {
+			database.PruneSessions(ctx, time.Hour)
+		})
+		log.Println("✓ Users, chat sessions and usage stored in PostgreSQL")
+	}
+	if cfg.Health.ProbeProviders {
+		if llmPing != nil {
+			dependencies.Add("llm", critical("llm"), llmPing)
+		}
+		if engine, ok := slmEngine.(*inference.SLMEngine); ok {
+			for _, model := range engine.Models() {
+				dependencies.Add("slm:"+model, critical("slm:"+model), func(ctx context.Context) error {
+					return engine.PingModel(ctx, model)
+				})
+			}
+		}
+	}
+	inferenceHandler.SetDependencyChecker(dependencies)
 
 	// Initialize chat components
 	sessionStore := chat.NewSessionStore(redisCache.GetClient())
+	sessionStore.SetTTL(cfg.Chat.SessionTTL)
+	if replicaReader != nil {
+		sessionStore.SetReader(replicaReader)
+	}
+	if database != nil {
+		sessionStore.SetDatabase(database)
+	}
 	chatHandler := handlers.NewChatHandler(
 		queryRouter,
-		slmEngine,
-		llmClient,
-		redisCache,
+		slm,
+		llm,
+		responseCache,
 		sessionStore,
 	)
 	chatHandler.SetModelNames(cfg.LLM.Model, cfg.SLM.Models[0].Name)
+	chatHandler.SetImportLimits(cfg.Chat.Import)
+	chatHandler.SetModelRegistry(modelRegistry)
+	chatHandler.SetContinuation(cfg.Continuation)
+	// Privacy settings can only be set by signed-in users; without auth the
+	// nil store lets everyone take part in everything
+	var prefsStore *preferences.Store
+	if cfg.Auth.Enabled {
+		prefsStore = preferences.NewStore(redisCache.GetClient())
+	}
+
+	chatHandler.SetSystemPrompt(cfg.Chat.SystemPrompt)
+	if cfg.Chat.GenerateTitles {
+		chatHandler.SetTitler(chat.NewTitler(slm))
+	}
+	if cfg.Chat.Analytics.Enabled {
+		analyzer := chat.NewAnalyzer(redisCache.GetClient(), sessionStore, slm, cfg.Chat.Analytics.Interval)
+		analyzer.SetConsent(prefsStore.AnalyticsAllowed)
+		// Transcripts have to fit whichever SLM labels them
+		contextWindow := 0
+		for _, model := range cfg.SLM.Models {
+			if window := modelRegistry.ContextWindow(model.Name); contextWindow == 0 || window < contextWindow {
+				contextWindow = window
+			}
+		}
+		analyzer.SetContextWindow(contextWindow)
+		chatHandler.SetAnalyzer(analyzer)
+
+		analyticsCtx, stopAnalytics := context.WithCancel(context.Background())
+		defer stopAnalytics()
+		workers.Go(analyticsCtx, "session_analytics", analyzer.Run)
+		log.Printf("✓ Session analytics every %s", cfg.Chat.Analytics.Interval)
+	}
+	chatHandler.SetTurnDeduplicator(chat.NewTurnDeduplicator(redisCache.GetClient()))
+	if llm != nil {
+		summarizer := chat.NewSummarizer(residency.WrapLLM(llm, cfg.LLM.Model))
+		summarizer.SetModel(cfg.LLM.Model)
+		chatHandler.SetSummarizer(summarizer)
+	}
 	log.Printf("✓ Chat system initialized with session management")
 
-	v1 := r.Group("/api/v1")
+	if cfg.Coalescing.Enabled {
+		coalescer := inference.NewCoalescer(cfg.Coalescing.NegativeTTL)
+		inferenceHandler.SetCoalescer(coalescer)
+		chatHandler.SetCoalescer(coalescer)
+		log.Printf("✓ Request coalescing enabled (negative cache TTL: %s)", cfg.Coalescing.NegativeTTL)
+	}
+
+	var llmBreaker, slmBreaker *inference.CircuitBreaker
+	if cfg.Failover.Enabled {
+		llmBreaker = inference.NewCircuitBreaker("cloud-llm", cfg.Failover)
+		slmBreaker = inference.NewCircuitBreaker("edge-slm", cfg.Failover)
+		inferenceHandler.SetFailover(llmBreaker, slmBreaker)
+		chatHandler.SetFailover(llmBreaker, slmBreaker)
+		log.Printf("✓ LLM↔SLM failover enabled (circuit opens after %d failures)", cfg.Failover.FailureThreshold)
+	}
+
+	// Orgs' own provider keys, looked up by the signed-in user's org
+	var credentialStore *credentials.Store
+	if cfg.BYOK.Enabled {
+		if !cfg.Auth.Enabled {
+			log.Fatal("byok.enabled needs auth.enabled to tell which org a request comes from")
+		}
+		credentialStore, err = credentials.NewStore(redisCache.GetClient(), cfg.BYOK)
+		if err != nil {
+			log.Fatalf("Failed to set up org provider keys: %v", err)
+		}
+		inferenceHandler.SetCredentials(credentialStore)
+		chatHandler.SetCredentials(credentialStore)
+		log.Printf("✓ Orgs may bring their own provider keys (platform fallback by default: %v)", cfg.BYOK.PlatformFallback)
+	}
+
+	// Monthly spend caps on the platform's and orgs' provider keys
+	var spendCaps *usage.SpendCaps
+	if len(cfg.SpendCaps.Caps) > 0 {
+		spendCaps = usage.NewSpendCaps(redisCache.GetClient(), cfg.SpendCaps, llmProvider, inference.SLMProvider)
+		queryRouter.SetSpendCaps(spendCaps)
+		inferenceHandler.SetSpendCaps(spendCaps)
+		chatHandler.SetSpendCaps(spendCaps)
+		log.Printf("✓ %d provider key spend caps enforced (%s once reached)", len(cfg.SpendCaps.Caps), spendCaps.Action())
+	}
+
+	// Degradation ladder: full hybrid, SLM-only, cached-only, maintenance answer
+	if cfg.Degradation.Enabled {
+		ladder := degradation.NewLadder(cfg.Degradation)
+		ladder.SetBreakers(llmBreaker, slmBreaker)
+		ladder.SetSpendCaps(spendCaps)
+		inferenceHandler.SetDegradation(ladder)
+		chatHandler.SetDegradation(ladder)
+		ladderCtx, stopLadder := context.WithCancel(context.Background())
+		defer stopLadder()
+		workers.Go(ladderCtx, "degradation", ladder.Run)
+		log.Printf("✓ Degradation ladder enabled (spend threshold: %.0f%%)", cfg.Degradation.SpendThreshold*100)
+	}
+
+	// Bandit sharing SLM traffic by the models' quality and latency
+	var slmBandit *bandit.Bandit
+	if engine, ok := slmEngine.(*inference.SLMEngine); ok && cfg.SLM.Strategy == inference.StrategyBandit {
+		slmBandit = bandit.New(redisCache.GetClient(), cfg.SLM.Bandit, cfg.SLM.Models)
+		engine.SetBandit(slmBandit)
+		inferenceHandler.SetBandit(slmBandit)
+		chatHandler.SetBandit(slmBandit)
+		log.Printf("✓ SLM bandit sharing traffic across %d models (judge sample rate: %.0f%%)", len(cfg.SLM.Models), cfg.SLM.Bandit.JudgeSampleRate*100)
+	}
+
+	// Signed receipts for every answer
+	var receiptSigner *receipts.Signer
+	if cfg.Receipts.Enabled {
+		receiptSigner, err = receipts.NewSigner(cfg.Receipts)
+		if err != nil {
+			log.Fatalf("Failed to set up receipts: %v", err)
+		}
+		inferenceHandler.SetReceipts(receiptSigner)
+		chatHandler.SetReceipts(receiptSigner)
+		log.Printf("✓ Answers carry signed receipts")
+	}
+
+	// Terms acceptance is tracked per signed-in user
+	var termsStore *terms.Store
+	var termsGate []gin.HandlerFunc
+	if cfg.Terms.Version != "" {
+		if cfg.Auth.Enabled {
+			termsStore = terms.NewStore(redisCache.GetClient())
+			if cfg.Terms.Required {
+				termsGate = append(termsGate, middleware.RequireTerms(termsStore, cfg.Terms.Version))
+			}
+			log.Printf("✓ Terms acceptance tracked (version %s, required: %v)", cfg.Terms.Version, cfg.Terms.Required)
+		} else {
+			log.Println("⚠️  terms.version set but auth is disabled, terms acceptance isn't tracked")
+		}
+	}
+
+	flagStore := flags.NewStore(redisCache.GetClient(), cfg.FeatureFlags.RefreshInterval)
+	flagStore.SetRolloutConsent(prefsStore.ShadowEvaluationAllowed)
+	inferenceHandler.SetFeatureFlags(flagStore)
+	chatHandler.SetFeatureFlags(flagStore)
+
+	if len(cfg.Hooks.Plugins) > 0 || len(cfg.Hooks.Webhooks) > 0 {
+		hookManager := hooks.NewManager()
+		for _, path := range cfg.Hooks.Plugins {
+			if err := hooks.LoadPlugin(path, hookManager); err != nil {
+				log.Fatalf("Failed to load hook plugin: %v", err)
+			}
+		}
+		for i := range cfg.Hooks.Webhooks {
+			webhookCfg := &cfg.Hooks.Webhooks[i]
+			webhook := hooks.NewWebhookHook(webhookCfg)
+			for _, stage := range webhookCfg.Stages {
+				if err := hookManager.Register(hooks.Stage(stage), webhook); err != nil {
+					log.Fatalf("Invalid stages for webhook hook %s: %v", webhookCfg.Name, err)
+				}
+			}
+		}
+		inferenceHandler.SetHooks(hookManager)
+		chatHandler.SetHooks(hookManager)
+		log.Printf("✓ %d extension hooks registered (%d plugins, %d webhooks)", hookManager.Len(), len(cfg.Hooks.Plugins), len(cfg.Hooks.Webhooks))
+	}
+
+	moderator, err := moderation.New(cfg.Moderation)
+	if err != nil {
+		log.Fatalf("Failed to set up content moderation: %v", err)
+	}
+	if moderator != nil {
+		moderator.SetSLM(slm)
+		inferenceHandler.SetModerator(moderator)
+		chatHandler.SetModerator(moderator)
+		log.Printf("✓ Content moderation enabled (provider: %s, action: %s)", moderator.Provider(), cfg.Moderation.Action)
+	}
+
+	usageStore := usage.NewStore(redisCache.GetClient())
+	if database != nil {
+		usageStore.SetDatabase(database)
+	}
+	if cfg.Replication.Enabled {
+		replicator, err := replication.NewReplicator(redisCache.GetClient(), cfg.Redis.DB, cfg.Replication)
+		if err != nil {
+			log.Fatalf("Failed to configure replication: %v", err)
+		}
+		defer replicator.Close()
+		if err := replicator.EnableNotifications(context.Background()); err != nil {
+			log.Printf("⚠️  %v; set notify-keyspace-events to include \"Kg$h\" for replication to work", err)
+		}
+		usageStore.SetReplicaRegions(replicator.Regions())
+
+		replicationCtx, stopReplication := context.WithCancel(context.Background())
+		defer stopReplication()
+		workers.Go(replicationCtx, "replication", replicator.Run)
+		log.Printf("✓ Replicating region %s to %s", cfg.Replication.Region, strings.Join(replicator.Regions(), ", "))
+	}
+	var eventOutbox *outbox.Outbox
+	var outboxDispatchers []*outbox.Dispatcher
+	if cfg.Outbox.Enabled {
+		eventOutbox = outbox.NewOutbox(redisCache.GetClient(), cfg.Outbox)
+		usageStore.SetOutbox(eventOutbox)
+
+		outboxCtx, stopOutbox := context.WithCancel(context.Background())
+		defer stopOutbox()
+		names := make(map[string]bool)
+		for _, sinkCfg := range cfg.Outbox.Sinks {
+			if sinkCfg.Name == "" || names[sinkCfg.Name] {
+				log.Fatalf("Outbox sinks need unique names, got %q", sinkCfg.Name)
+			}
+			names[sinkCfg.Name] = true
+
+			sink, err := outbox.NewSink(sinkCfg)
+			if err != nil {
+				log.Fatalf("Failed to configure outbox: %v", err)
+			}
+			dispatcher := outbox.NewDispatcher(redisCache.GetClient(), cfg.Outbox, sinkCfg, sink)
+			outboxDispatchers = append(outboxDispatchers, dispatcher)
+			workers.Go(outboxCtx, "outbox_"+sinkCfg.Name, dispatcher.Run)
+		}
+		if credentialStore != nil {
+			credentialStore.OnAlert(func(alert models.KeyAlert) {
+				if err := eventOutbox.Publish(context.Background(), outbox.TypeAlert, "credentials.key_health", "", alert); err != nil {
+					log.Printf("Failed to publish key alert for org %s: %v", alert.Org, err)
+				}
+			})
+		}
+		if spendCaps != nil {
+			spendCaps.OnAlert(func(alert models.SpendAlert) {
+				if err := eventOutbox.Publish(context.Background(), outbox.TypeAlert, "spend."+alert.Level, "", alert); err != nil {
+					log.Printf("Failed to publish %s spend alert: %v", alert.Provider, err)
+				}
+			})
+		}
+		log.Printf("✓ Event outbox enabled (%d sinks)", len(outboxDispatchers))
+	}
+	if cfg.Warehouse.Enabled {
+		if eventOutbox == nil || !slices.Contains(cfg.Middleware.API, "events") {
+			log.Fatalf("Warehouse export reads request events, enable the outbox and the events middleware")
+		}
+		if cfg.Warehouse.Salt == "" {
+			log.Fatalf("Warehouse export needs WAREHOUSE_SALT to anonymize user IDs")
+		}
+		store, err := warehouse.NewObjectStore(cfg.Warehouse)
+		if err != nil {
+			log.Fatalf("Failed to configure warehouse export: %v", err)
+		}
+		exporter := warehouse.NewExporter(redisCache.GetClient(), eventOutbox, store, cfg.Warehouse)
+		exporter.SetConsent(prefsStore.TrainingExportAllowed)
+
+		exportCtx, stopExport := context.WithCancel(context.Background())
+		defer stopExport()
+		workers.Go(exportCtx, "warehouse_export", exporter.Run)
+		log.Printf("✓ Warehouse export to %s every %s", cfg.Warehouse.Destination, cfg.Warehouse.Interval)
+	}
+
+	var annotationStore *annotations.Store
+	if cfg.Annotations.Enabled {
+		usageStore.SetRequestRetention(cfg.Annotations.Window)
+		annotationStore = annotations.NewStore(redisCache.GetClient(), usageStore, cfg.Annotations)
+		annotationStore.SetOutbox(eventOutbox)
+		log.Printf("✓ Response annotations enabled")
+	}
+
+	var canaryMonitor *canary.Monitor
+	if cfg.Canary.Enabled {
+		canaryMonitor = canary.NewMonitor(redisCache.GetClient(), cfg.Canary, handlers.NewCanaryRunner(inferenceHandler, cfg.Canary.UserID), newEmbedder(cfg))
+		if eventOutbox != nil {
+			canaryMonitor.OnAlert(func(alert models.CanaryAlert) {
+				if err := eventOutbox.Publish(context.Background(), outbox.TypeAlert, "canary."+alert.Level, "", alert); err != nil {
+					log.Printf("Failed to publish canary alert for %s: %v", alert.Result.Name, err)
+				}
+			})
+		}
+
+		canaryCtx, stopCanaries := context.WithCancel(context.Background())
+		defer stopCanaries()
+		workers.Go(canaryCtx, "canary", canaryMonitor.Run)
+		log.Printf("✓ %d canary prompts checked every %s", len(cfg.Canary.Prompts), cfg.Canary.Interval)
+	}
+	inferenceHandler.SetUsageStore(usageStore)
+	chatHandler.SetUsageStore(usageStore)
+	usageHandler := handlers.NewUsageHandler(usageStore)
+
+	var queryStats *analytics.QueryStats
+	if cfg.QueryStats.Enabled {
+		queryStats = analytics.NewQueryStats(redisCache.GetClient(), cfg.QueryStats)
+		queryStats.SetConsent(prefsStore.AnalyticsAllowed)
+		inferenceHandler.SetQueryStats(queryStats)
+		chatHandler.SetQueryStats(queryStats)
+		log.Printf("✓ Query frequency analytics enabled (%d days retained)", queryStats.RetentionDays())
+	}
+	var requestStats *analytics.RequestStats
+	if cfg.RequestStats.Enabled {
+		requestStats = analytics.NewRequestStats(redisCache.GetClient(), cfg.RequestStats)
+		log.Printf("✓ Request statistics enabled (%d days retained)", cfg.RequestStats.RetentionDays)
+	}
+
+	var faqStore *faq.Store
+	if cfg.FAQ.Enabled {
+		faqStore = faq.NewStore(redisCache.GetClient())
+		inferenceHandler.SetFAQ(faqStore)
+		chatHandler.SetFAQ(faqStore)
+		log.Printf("✓ Pinned FAQ answers enabled")
+	}
+
+	var knowledgeBase *knowledge.Base
+	if cfg.KnowledgeBase.File != "" {
+		embedder := residency.WrapEmbedder(privacyGuard.WrapEmbedder(newEmbedder(cfg)), cache.EmbeddingModel)
+		if embedder == nil {
+			log.Println("⚠️  SEMANTIC_CACHE_API_KEY not set, knowledge base answers only match exactly")
+		}
+
+		knowledgeBase, err = knowledge.NewBase(context.Background(), cfg.KnowledgeBase.File, embedder, cfg.KnowledgeBase.SimilarityThreshold)
+		if err != nil {
+			log.Fatalf("Failed to load knowledge base: %v", err)
+		}
+		inferenceHandler.SetKnowledgeBase(knowledgeBase)
+		chatHandler.SetKnowledgeBase(knowledgeBase)
+
+		watchCtx, stopWatching := context.WithCancel(context.Background())
+		defer stopWatching()
+		workers.Go(watchCtx, "knowledge_base", func(ctx context.Context) {
+			knowledgeBase.Watch(ctx, cfg.KnowledgeBase.Reload)
+		})
+		log.Printf("✓ %d knowledge base entries loaded from %s", knowledgeBase.Len(), cfg.KnowledgeBase.File)
+	}
+
+	expiryEstimator, err := cache.NewExpiryEstimator(cfg.CacheExpiry, cfg.Redis.CacheTTL)
+	if err != nil {
+		log.Fatalf("Failed to configure cache expiry: %v", err)
+	}
+	if expiryEstimator != nil {
+		if cfg.CacheExpiry.Mode == cache.ExpiryModeSLM {
+			expiryEstimator.SetSLM(slm)
+		}
+		inferenceHandler.SetExpiryEstimator(expiryEstimator)
+		chatHandler.SetExpiryEstimator(expiryEstimator)
+		log.Printf("✓ Per-answer cache expiry enabled (%s)", cfg.CacheExpiry.Mode)
+	}
+
+	consistency, err := cache.NewConsistency(cfg.Consistency, cfg.Redis.CacheTTL)
+	if err != nil {
+		log.Fatalf("Failed to configure consistency profiles: %v", err)
+	}
+	if consistency != nil {
+		inferenceHandler.SetConsistency(consistency, workers.NewPool("revalidate", cfg.Consistency.MaxRevalidations))
+		chatHandler.SetConsistency(consistency)
+		log.Printf("✓ Consistency profiles enabled (%d org rules, default %q)", len(cfg.Consistency.Rules), cfg.Consistency.Default)
+	}
+
+	inferenceHandler.SetStreamPacing(cfg.Streaming.MaxTokensPerSecond, cfg.Streaming.PaceBurst)
+	chatHandler.SetStreamPacing(cfg.Streaming.MaxTokensPerSecond, cfg.Streaming.PaceBurst)
+	if cfg.Streaming.MaxTokensPerSecond > 0 {
+		log.Printf("✓ Streams paced at %.0f tokens/s", cfg.Streaming.MaxTokensPerSecond)
+	}
+
+	var streamHandler *handlers.StreamHandler
+	if cfg.Streaming.Resumable {
+		streamBuffer := streaming.NewBuffer(redisCache.GetClient(), cfg.Streaming.BufferTTL)
+		inferenceHandler.SetStreamBuffer(streamBuffer)
+		chatHandler.SetStreamBuffer(streamBuffer)
+		streamHandler = handlers.NewStreamHandler(streamBuffer)
+		log.Printf("✓ Resumable SSE streams enabled")
+	}
+
+	var jobsHandler *handlers.JobsHandler
+	var jobQueue *jobs.Queue
+	if cfg.Jobs.Enabled {
+		jobQueue = jobs.NewQueue(redisCache.GetClient(), cfg.Jobs)
+		jobsHandler = handlers.NewJobsHandler(jobQueue, inferenceHandler)
+		jobsHandler.SetChatHandler(chatHandler)
+		jobsHandler.SetSessionStore(sessionStore)
+
+		jobsCtx, stopJobs := context.WithCancel(context.Background())
+		defer stopJobs()
+		for i := range cfg.Jobs.Workers {
+			workers.Go(jobsCtx, fmt.Sprintf("jobs_%d", i+1), func(ctx context.Context) {
+				jobQueue.Work(ctx, jobsHandler.Run)
+			})
+		}
+		log.Printf("✓ Async inference jobs enabled (%d workers, %s timeout)", cfg.Jobs.Workers, cfg.Jobs.Timeout)
+	}
+
+	var assistantsHandler *handlers.AssistantsHandler
+	if cfg.Assistants.Enabled {
+		assistantsHandler = handlers.NewAssistantsHandler(chatHandler, sessionStore, assistants.NewStore(redisCache.GetClient(), cfg.Assistants.TTL))
+		if jobQueue != nil {
+			assistantsHandler.SetJobQueue(jobQueue)
+			log.Printf("✓ OpenAI-compatible threads, runs and responses enabled")
+		} else {
+			log.Printf("✓ OpenAI-compatible responses enabled (threads and runs need jobs.enabled)")
+		}
+	}
+
+	modelsHandler := handlers.NewModelsHandler(modelRegistry)
+
+	// Initialize authentication
+	var authMiddleware gin.HandlerFunc
+	var authHandler *handlers.AuthHandler
+	var apiKeyHandler *handlers.APIKeyHandler
+	var usersHandler *handlers.UsersHandler
+	if cfg.Auth.Enabled {
+		userStore := auth.NewUserStore(redisCache.GetClient())
+		userStore.SetAdminEmails(cfg.Admin.Users)
+		if database != nil {
+			userStore.SetDatabase(database)
+		}
+		usersHandler = handlers.NewUsersHandler(userStore)
+		usersHandler.SetOutbox(eventOutbox)
+		flagStore.SetOrgResolver(userStore.OrgOf)
+		if policyEngine != nil {
+			policyEngine.SetOrgResolver(userStore.OrgOf)
+		}
+		if residency != nil {
+			residency.SetOrgResolver(userStore.OrgOf)
+		}
+		if credentialStore != nil {
+			credentialStore.SetOrgResolver(userStore.OrgOf)
+		}
+		if consistency != nil {
+			consistency.SetOrgResolver(userStore.OrgOf)
+		}
+		sessionManager := auth.NewSessionManager(redisCache.GetClient(), cfg.Auth.SessionTTL)
+		if replicaReader != nil && cfg.Redis.AuthReads == "replica" {
+			sessionManager.SetReader(replicaReader)
+		}
+		authHandler = handlers.NewAuthHandler(auth.NewGoogleOAuth(&cfg.Auth), userStore, sessionManager, &cfg.Auth)
+		authHandler.SetOutbox(eventOutbox)
+		apiKeyStore := auth.NewAPIKeyStore(redisCache.GetClient())
+		apiKeyHandler = handlers.NewAPIKeyHandler(apiKeyStore)
+		apiKeyHandler.SetOutbox(eventOutbox)
+		var tokenIssuer *auth.TokenIssuer
+		if cfg.Auth.JWTSecret != "" {
+			tokenIssuer = auth.NewTokenIssuer(redisCache.GetClient(), &cfg.Auth)
+			authHandler.SetTokenIssuer(tokenIssuer)
+			log.Printf("✓ JWT bearer tokens enabled (access tokens valid %v)", cfg.Auth.AccessTokenTTL)
+		}
+		authMiddleware = middleware.AuthMiddleware(sessionManager, apiKeyStore, tokenIssuer, userStore.RoleOf)
+		healthRegistry.Set("auth", health.StatusReady, "")
+		log.Printf("✓ Google OAuth and API key authentication enabled")
+	} else {
+		authMiddleware = middleware.AnonymousMiddleware()
+		healthRegistry.Set("auth", health.StatusDisabled, "")
+		log.Println("ℹ️  Authentication disabled, all requests share the anonymous user")
+	}
+
+	var rateLimitMiddleware gin.HandlerFunc
+	if cfg.RateLimit.Enabled {
+		rateLimiter := middleware.NewRateLimiter(redisCache.GetClient(), &cfg.RateLimit)
+		rateLimitMiddleware = rateLimiter.Middleware()
+		inferenceHandler.SetRateLimiter(rateLimiter)
+		chatHandler.SetRateLimiter(rateLimiter)
+		if apiKeyHandler != nil {
+			apiKeyHandler.SetMaxRequestsPerMinute(rateLimiter.MaxKeyRate())
+		}
+		log.Printf("✓ Rate limiting enabled (%d req/min, %d tokens/day)", cfg.RateLimit.RequestsPerMinute, cfg.RateLimit.TokensPerDay)
+	}
+
+	// Middleware stacks per route group come from config
+	chain := middleware.NewChain()
+	chain.Register("tracing", tracingMiddleware)
+	chain.Register("request_id", middleware.RequestID(correlationHasher))
+	chain.Register("logging", gin.LoggerWithFormatter(middleware.LogFormatter))
+	chain.Register("recovery", gin.Recovery())
+	chain.Register("cors", corsMiddleware())
+	chain.Register("maintenance", middleware.MaintenanceMode(flagStore))
+	var requestEvents gin.HandlerFunc
+	if eventOutbox != nil {
+		requestEvents = middleware.RequestEvents(eventOutbox)
+	}
+	chain.Register("events", requestEvents)
+	var requestStatsMiddleware gin.HandlerFunc
+	if requestStats != nil {
+		requestStatsMiddleware = middleware.RequestStats(requestStats)
+	}
+	chain.Register("stats", requestStatsMiddleware)
+	chain.Register("auth", authMiddleware)
+	chain.Register("rate_limit", rateLimitMiddleware)
+
+	globalMiddleware := buildMiddleware(chain, "global", cfg.Middleware.Global)
+	apiMiddleware := buildMiddleware(chain, "api", cfg.Middleware.API)
+	protectedMiddleware := buildMiddleware(chain, "protected", cfg.Middleware.Protected)
+	if !slices.Contains(cfg.Middleware.Protected, "auth") {
+		log.Println("⚠️  auth middleware not in middleware.protected, user-scoped routes have no user")
+	}
+
+	r := gin.New()
+	r.Use(globalMiddleware...)
+
+	if authHandler != nil {
+		authRoutes := r.Group("/auth")
+		{
+			authRoutes.GET("/google/login", authHandler.Login)
+			authRoutes.GET("/google/callback", authHandler.Callback)
+			authRoutes.POST("/logout", authHandler.Logout)
+			if cfg.Auth.JWTSecret != "" {
+				authRoutes.POST("/refresh", authHandler.Refresh)
+			}
+		}
+	}
+
+	if cfg.Admin.Token != "" {
+		flagsHandler := handlers.NewFlagsHandler(flagStore)
+		admin := r.Group("/admin", middleware.AdminMiddleware(cfg.Admin.Token))
+		{
+			admin.GET("/flags", flagsHandler.ListFlags)
+			admin.PUT("/flags/:flag", flagsHandler.SetFlag)
+			admin.GET("/workers", handlers.NewWorkersHandler(workers).ListWorkers)
+			if spendCaps != nil {
+				admin.GET("/spend", handlers.NewSpendHandler(spendCaps).GetSpend)
+			}
+			if queryStats != nil {
+				admin.GET("/queries/top", handlers.NewQueryStatsHandler(queryStats).TopQueries)
+			}
+			if slmBandit != nil {
+				admin.GET("/slm/bandit", handlers.NewBanditHandler(slmBandit).Stats)
+			}
+			if faqStore != nil {
+				faqHandler := handlers.NewFAQHandler(faqStore, queryStats, cfg.FAQ)
+				admin.GET("/faq/candidates", faqHandler.Candidates)
+				admin.GET("/faq", faqHandler.ListAnswers)
+				admin.POST("/faq", faqHandler.CreateAnswer)
+				admin.GET("/faq/:id", faqHandler.GetAnswer)
+				admin.PUT("/faq/:id", faqHandler.UpdateAnswer)
+				admin.DELETE("/faq/:id", faqHandler.DeleteAnswer)
+				admin.POST("/faq/:id/approve", faqHandler.ApproveAnswer)
+				admin.POST("/faq/:id/reject", faqHandler.RejectAnswer)
+			}
+			if knowledgeBase != nil {
+				knowledgeHandler := handlers.NewKnowledgeHandler(knowledgeBase)
+				admin.GET("/knowledge", knowledgeHandler.ListEntries)
+				admin.POST("/knowledge/reload", knowledgeHandler.Reload)
+			}
+			routingHandler := handlers.NewRoutingHandler(eventOutbox, learnedStrategy)
+			routingHandler.SetConsent(prefsStore.TrainingExportAllowed)
+			if annotationStore != nil {
+				routingHandler.SetAnnotations(annotationStore)
+			}
+			admin.GET("/routing/examples", routingHandler.ExportExamples)
+			admin.GET("/routing/model", routingHandler.GetModel)
+			admin.PUT("/routing/model", routingHandler.ImportModel)
+			if credentialStore != nil {
+				credentialsHandler := handlers.NewCredentialsHandler(credentialStore, append(inference.LLMProviders(), inference.SLMProvider))
+				credentialsHandler.SetOutbox(eventOutbox)
+				admin.GET("/orgs/:org/credentials", credentialsHandler.GetCredentials)
+				admin.PATCH("/orgs/:org/credentials", credentialsHandler.UpdateCredentials)
+				admin.PUT("/orgs/:org/credentials/:provider", credentialsHandler.SetKey)
+				admin.DELETE("/orgs/:org/credentials/:provider", credentialsHandler.DeleteKey)
+				admin.PUT("/orgs/:org/credentials/:provider/secondary", credentialsHandler.SetSecondaryKey)
+				admin.DELETE("/orgs/:org/credentials/:provider/secondary", credentialsHandler.DeleteSecondaryKey)
+				admin.POST("/orgs/:org/credentials/:provider/promote", credentialsHandler.PromoteKey)
+			}
+			if canaryMonitor != nil {
+				canaryHandler := handlers.NewCanaryHandler(canaryMonitor)
+				admin.GET("/canaries", canaryHandler.ListResults)
+				admin.POST("/canaries/check", canaryHandler.Check)
+			}
+			if eventOutbox != nil {
+				outboxHandler := handlers.NewOutboxHandler(outboxDispatchers)
+				admin.GET("/outbox", outboxHandler.Status)
+				admin.POST("/outbox/:sink/replay", outboxHandler.Replay)
+			}
+		}
+		log.Printf("✓ Admin API enabled")
+	} else {
+		log.Println("ℹ️  ADMIN_TOKEN not set, admin API disabled")
+	}
+
+	probesHandler := handlers.NewProbesHandler(dependencies)
+	r.GET("/livez", probesHandler.Live)
+	r.GET("/readyz", probesHandler.Ready)
+
+	v1 := r.Group("/api/v1", apiMiddleware...)
 	{
-		// Original inference endpoint (stateless)
-		v1.POST("/inference", inferenceHandler.HandleInference)
 		v1.GET("/health", inferenceHandler.HealthCheck)
 
-		// New chat endpoints (stateful, conversational)
-		v1.POST("/chat", chatHandler.HandleChat)
-		v1.GET("/chat/sessions", chatHandler.ListSessions)
-		v1.GET("/chat/sessions/:session_id", chatHandler.GetSession)
-		v1.DELETE("/chat/sessions/:session_id", chatHandler.DeleteSession)
+		// Model registry (context windows and capabilities)
+		v1.GET("/models", modelsHandler.ListModels)
+		v1.GET("/models/:model", modelsHandler.GetModel)
+
+		if cfg.Terms.Version != "" {
+			v1.GET("/terms", handlers.NewTermsHandler(termsStore, cfg.Terms).GetTerms)
+		}
+
+		protected := v1.Group("", protectedMiddleware...)
+		// Routes that run inference, refused until the current terms are accepted when required
+		generate := protected.Group("", termsGate...)
+
+		// Original inference endpoint (stateless)
+		generate.POST("/inference", inferenceHandler.HandleInference)
+		if jobsHandler != nil {
+			generate.POST("/inference/async", jobsHandler.Enqueue)
+			protected.GET("/jobs/:job_id", jobsHandler.GetJob)
+		}
+
+		// New chat endpoints (stateful, conversational, scoped to the user)
+		generate.POST("/chat", chatHandler.HandleChat)
+		protected.GET("/chat/sessions", chatHandler.ListSessions)
+		generate.POST("/chat/import", chatHandler.ImportSessions)
+		protected.POST("/chat/sessions", chatHandler.CreateSession)
+		protected.GET("/chat/sessions/:session_id", chatHandler.GetSession)
+		protected.GET("/chat/sessions/:session_id/export", chatHandler.ExportSession)
+		protected.GET("/chat/sessions/:session_id/analytics", chatHandler.GetSessionAnalytics)
+		protected.PATCH("/chat/sessions/:session_id", chatHandler.RenameSession)
+		protected.PATCH("/chat/sessions/:session_id/pin", chatHandler.PinSession)
+		generate.POST("/chat/sessions/:session_id/messages/:index/regenerate", chatHandler.RegenerateMessage)
+		generate.PATCH("/chat/sessions/:session_id/messages/:index", chatHandler.EditMessage)
+		protected.DELETE("/chat/sessions/:session_id", chatHandler.DeleteSession)
+		if jobsHandler != nil {
+			protected.POST("/chat/sessions/bulk", jobsHandler.EnqueueBulk)
+		}
+
+		// OpenAI-compatible assistants endpoints (base URL /api/v1/openai)
+		if assistantsHandler != nil {
+			openai := protected.Group("/openai")
+			openaiGenerate := generate.Group("/openai")
+			openaiGenerate.POST("/responses", assistantsHandler.CreateResponse)
+			openai.GET("/responses/:response_id", assistantsHandler.GetResponse)
+			openai.DELETE("/responses/:response_id", assistantsHandler.DeleteResponse)
+			if jobQueue != nil {
+				openai.POST("/threads", assistantsHandler.CreateThread)
+				openai.GET("/threads/:thread_id", assistantsHandler.GetThread)
+				openai.DELETE("/threads/:thread_id", assistantsHandler.DeleteThread)
+				openai.POST("/threads/:thread_id/messages", assistantsHandler.CreateMessage)
+				openai.GET("/threads/:thread_id/messages", assistantsHandler.ListMessages)
+				openaiGenerate.POST("/threads/:thread_id/runs", assistantsHandler.CreateRun)
+				openai.GET("/threads/:thread_id/runs/:run_id", assistantsHandler.GetRun)
+			}
+		}
+
+		if receiptSigner != nil {
+			protected.POST("/receipts/verify", handlers.NewReceiptsHandler(receiptSigner).VerifyReceipt)
+		}
+
+		// Per-user usage and spend
+		protected.GET("/usage", usageHandler.GetUsage)
+		protected.GET("/usage/history", usageHandler.GetUsageHistory)
+
+		// User management and aggregate statistics for signed-in admins
+		if usersHandler != nil && len(cfg.Admin.Users) > 0 {
+			admin := protected.Group("/admin", middleware.RequireRole(models.RoleAdmin))
+			admin.GET("/users", usersHandler.ListUsers)
+			admin.POST("/users/:user_id/deactivate", usersHandler.DeactivateUser)
+			admin.POST("/users/:user_id/reactivate", usersHandler.ReactivateUser)
+			if requestStats != nil {
+				requestStatsHandler := handlers.NewRequestStatsHandler(requestStats)
+				admin.GET("/stats", requestStatsHandler.GetStats)
+				admin.GET("/stats/users", requestStatsHandler.TopUsers)
+			}
+		}
+
+		// Replay a resumable SSE stream after a dropped connection, or stop it
+		if streamHandler != nil {
+			protected.GET("/streams/:stream_id", streamHandler.ResumeStream)
+			protected.DELETE("/streams/:stream_id", streamHandler.CancelStream)
+		}
+
+		if authHandler != nil {
+			protected.GET("/me", authHandler.Me)
+		}
+
+		// Privacy settings, enforced where requests are counted and exported
+		if prefsStore != nil {
+			preferencesHandler := handlers.NewPreferencesHandler(prefsStore)
+			preferencesHandler.SetOutbox(eventOutbox)
+			protected.GET("/me/preferences", preferencesHandler.GetPreferences)
+			protected.PATCH("/me/preferences", preferencesHandler.UpdatePreferences)
+		}
+
+		if termsStore != nil {
+			termsHandler := handlers.NewTermsHandler(termsStore, cfg.Terms)
+			termsHandler.SetOutbox(eventOutbox)
+			protected.GET("/me/terms", termsHandler.GetMyTerms)
+			protected.POST("/me/terms", termsHandler.AcceptTerms)
+		}
+
+		// API keys for machine-to-machine callers
+		if apiKeyHandler != nil {
+			protected.POST("/keys", apiKeyHandler.CreateKey)
+			protected.GET("/keys", apiKeyHandler.ListKeys)
+			protected.DELETE("/keys/:key_id", apiKeyHandler.RevokeKey)
+		}
+
+		// Ratings of reused semantic cache answers
+		if thresholdTuner != nil {
+			protected.POST("/cache/feedback", cacheHandler.Feedback)
+		}
+
+		// Ratings of answers from the model the SLM bandit picked
+		if slmBandit != nil {
+			protected.POST("/slm/feedback", handlers.NewBanditHandler(slmBandit).Feedback)
+		}
+
+		// Reviewers' labels on past responses, by user and request ID
+		if annotationStore != nil {
+			annotationsHandler := handlers.NewAnnotationsHandler(annotationStore)
+			reviewers := protected.Group("/annotations", annotationsHandler.RequireReviewer)
+			reviewers.GET("", annotationsHandler.ExportAnnotations)
+			reviewers.GET("/:user_id/:request_id", annotationsHandler.GetAnnotations)
+			reviewers.PUT("/:user_id/:request_id", annotationsHandler.Annotate)
+			reviewers.DELETE("/:user_id/:request_id", annotationsHandler.DeleteAnnotation)
+		}
+
+		// Cache administration, behind the admin token
+		if cfg.Admin.Token != "" {
+			cacheAdmin := v1.Group("/cache", middleware.AdminMiddleware(cfg.Admin.Token))
+			cacheAdmin.DELETE("", cacheHandler.Flush)
+			cacheAdmin.GET("/stats", cacheHandler.Stats)
+			cacheAdmin.DELETE("/:key", cacheHandler.DeleteKey)
+		}
 	}
 
 	srv := &http.Server{
@@ -159,10 +1224,71 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatal("Server forced to shutdown:", err)
 	}
+	if err := shutdownTracing(ctx); err != nil {
+		log.Printf("Failed to flush traces: %v", err)
+	}
 
 	log.Println("Server exited")
 }
 
+// mockClassifier scores every query as medium complexity
+func mockClassifier() *fakes.LLM {
+	classifier := fakes.NewLLM("0.5")
+	classifier.ForgetCalls()
+	return classifier
+}
+
+// mockLLM answers every query by echoing it, so responses show which tier and
+// model served them
+func mockLLM(model string) *fakes.LLM {
+	llm := fakes.NewLLM("")
+	llm.ForgetCalls()
+	llm.SetResponder(func(req *models.InferenceRequest) string {
+		return fmt.Sprintf("[mock %s] You asked: %s", modelOrName(req.TargetModel, model), req.Query)
+	})
+	return llm
+}
+
+// mockSLM is the SLM tier counterpart of mockLLM
+func mockSLM(model string) *fakes.SLM {
+	slm := fakes.NewSLM(model, "")
+	slm.ForgetCalls()
+	slm.SetResponder(func(req *models.InferenceRequest) string {
+		return fmt.Sprintf("[mock %s] You asked: %s", modelOrName(req.TargetModel, model), req.Query)
+	})
+	return slm
+}
+
+// newEmbedder returns the embedder for semantic matching outside the
+// semantic cache, or nil without an embeddings API key
+func newEmbedder(cfg *config.Config) models.Embedder {
+	switch {
+	case cfg.MockProviders:
+		return fakes.NewEmbedder()
+	case cfg.SemanticCache.APIKey != "":
+		return cache.NewOpenAIEmbedder(cfg.SemanticCache.APIKey)
+	default:
+		return nil
+	}
+}
+
+func modelOrName(target string, model string) string {
+	if target != "" {
+		return target
+	}
+	return model
+}
+
+// buildMiddleware resolves a route group's configured middleware, exiting on unknown names
+func buildMiddleware(chain *middleware.Chain, group string, names []string) []gin.HandlerFunc {
+	handlers, err := chain.Build(names)
+	if err != nil {
+		log.Fatalf("Invalid middleware.%s config: %v", group, err)
+	}
+	log.Printf("✓ %s middleware: %s", group, strings.Join(names, " → "))
+	return handlers
+}
+
 func corsMiddleware() gin.HandlerFunc {
 	// Get allowed origins from environment variable
 	// Default to localhost for development if not set
@@ -209,8 +1335,9 @@ func corsMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Last-Event-ID, X-API-Key, X-HybridLM-No-Cache, X-HybridLM-Stream-Rate, X-Request-ID")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Stream-ID, Location, X-Degradation-Level, Retry-After, X-Request-ID")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
 
 		if c.Request.Method == "OPTIONS" {
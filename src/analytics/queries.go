@@ -0,0 +1,164 @@
+// Package analytics keeps aggregate statistics about the traffic the gateway
+// serves, for admins and for background jobs that act on it.
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+const (
+	queryStatsKeyPrefix = "query_stats:"
+	dayLayout           = "2006-01-02"
+
+	defaultRetentionDays = 30
+	defaultMaxTracked    = 10000
+	maxQueryLength       = 500 // Longer queries are counted by their prefix
+)
+
+// QueryStats counts how often each normalized query is asked, per UTC day.
+// Counts live in a sorted set per day that is trimmed to the most frequent
+// MaxTracked queries, so rare queries are dropped and counts near the cut-off
+// are approximate. Distinct queries are estimated with a HyperLogLog.
+type QueryStats struct {
+	client        *redis.Client
+	retentionDays int
+	maxTracked    int
+	clock         clock.Clock
+	consent       func(ctx context.Context, userID string) bool // Optional, see SetConsent
+}
+
+func NewQueryStats(client *redis.Client, cfg config.QueryStatsConfig) *QueryStats {
+	retentionDays := cfg.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = defaultRetentionDays
+	}
+	maxTracked := cfg.MaxTracked
+	if maxTracked <= 0 {
+		maxTracked = defaultMaxTracked
+	}
+
+	return &QueryStats{
+		client:        client,
+		retentionDays: retentionDays,
+		maxTracked:    maxTracked,
+		clock:         clock.Real(),
+	}
+}
+
+// SetClock sets the clock that decides which day a query is counted in
+func (s *QueryStats) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetConsent leaves the queries of users for whom allowed returns false
+// out of the statistics
+func (s *QueryStats) SetConsent(allowed func(ctx context.Context, userID string) bool) {
+	s.consent = allowed
+}
+
+// RetentionDays is how many days of counts are kept, and so the longest
+// period Top can report on
+func (s *QueryStats) RetentionDays() int {
+	return s.retentionDays
+}
+
+// Record counts one occurrence of the user's query
+func (s *QueryStats) Record(ctx context.Context, userID string, query string) error {
+	query = normalize(query)
+	if query == "" {
+		return nil
+	}
+	if s.consent != nil && !s.consent(ctx, userID) {
+		return nil
+	}
+
+	day := s.clock.Now().UTC()
+	ttl := time.Duration(s.retentionDays+1) * 24 * time.Hour
+	countsKey, distinctKey, totalKey := dayKeys(day)
+
+	pipe := s.client.TxPipeline()
+	pipe.ZIncrBy(ctx, countsKey, 1, query)
+	// Keep only the most frequent queries
+	pipe.ZRemRangeByRank(ctx, countsKey, 0, int64(-s.maxTracked-1))
+	pipe.PFAdd(ctx, distinctKey, query)
+	pipe.Incr(ctx, totalKey)
+	for _, key := range []string{countsKey, distinctKey, totalKey} {
+		pipe.Expire(ctx, key, ttl)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record query: %w", err)
+	}
+	return nil
+}
+
+// Top returns the limit most frequent queries over the last days days
+// (today included), most frequent first
+func (s *QueryStats) Top(ctx context.Context, days int, limit int) (*models.QueryReport, error) {
+	if days > s.retentionDays {
+		days = s.retentionDays
+	}
+
+	now := s.clock.Now().UTC()
+	countsKeys := make([]string, days)
+	distinctKeys := make([]string, days)
+	totalKeys := make([]string, days)
+	for i := 0; i < days; i++ {
+		countsKeys[i], distinctKeys[i], totalKeys[i] = dayKeys(now.AddDate(0, 0, -i))
+	}
+
+	pipe := s.client.Pipeline()
+	counts := pipe.ZUnionWithScores(ctx, redis.ZStore{Keys: countsKeys})
+	distinct := pipe.PFCount(ctx, distinctKeys...)
+	totals := pipe.MGet(ctx, totalKeys...)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get query stats: %w", err)
+	}
+
+	report := &models.QueryReport{
+		Days:            days,
+		DistinctQueries: distinct.Val(),
+		TopQueries:      []models.QueryCount{},
+	}
+	for _, total := range totals.Val() {
+		if total, ok := total.(string); ok {
+			n, _ := strconv.ParseInt(total, 10, 64)
+			report.TotalQueries += n
+		}
+	}
+
+	// ZUNION returns members in ascending score order
+	members := counts.Val()
+	for i := len(members) - 1; i >= 0 && len(report.TopQueries) < limit; i-- {
+		report.TopQueries = append(report.TopQueries, models.QueryCount{
+			Query: members[i].Member.(string),
+			Count: int64(members[i].Score),
+		})
+	}
+	return report, nil
+}
+
+// normalize maps queries that would share a cached answer to the same member
+func normalize(query string) string {
+	query = router.NormalizeQuery(query)
+	if len(query) > maxQueryLength {
+		query = strings.ToValidUTF8(query[:maxQueryLength], "")
+	}
+	return query
+}
+
+func dayKeys(day time.Time) (counts string, distinct string, total string) {
+	prefix := queryStatsKeyPrefix + day.Format(dayLayout)
+	return prefix + ":counts", prefix + ":distinct", prefix + ":total"
+}
@@ -0,0 +1,95 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupStats(t *testing.T, fakeClock *clock.Fake, cfg config.QueryStatsConfig) *QueryStats {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	stats := NewQueryStats(client, cfg)
+	stats.SetClock(fakeClock)
+	return stats
+}
+
+func TestQueryStats_TopAcrossDays(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	stats := setupStats(t, fakeClock, config.QueryStatsConfig{})
+	ctx := context.Background()
+
+	for _, query := range []string{"What is Go?", "what is go", "Who wrote Dune?"} {
+		require.NoError(t, stats.Record(ctx, "alice", query))
+	}
+	fakeClock.Advance(24 * time.Hour)
+	for _, query := range []string{"  WHAT is Go!", "Who wrote Dune?", "Who wrote Dune?", "Who wrote Dune?", ""} {
+		require.NoError(t, stats.Record(ctx, "alice", query))
+	}
+
+	report, err := stats.Top(ctx, 7, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 7, report.Days)
+	assert.Equal(t, int64(7), report.TotalQueries, "empty queries aren't counted")
+	assert.Equal(t, []models.QueryCount{
+		{Query: "who wrote dune", Count: 4},
+		{Query: "what is go", Count: 3},
+	}, report.TopQueries)
+
+	today, err := stats.Top(ctx, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), today.TotalQueries)
+	assert.Equal(t, int64(2), today.DistinctQueries)
+	assert.Equal(t, []models.QueryCount{{Query: "who wrote dune", Count: 3}}, today.TopQueries)
+}
+
+func TestQueryStats_DropsRareQueries(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	stats := setupStats(t, fakeClock, config.QueryStatsConfig{MaxTracked: 2})
+	ctx := context.Background()
+
+	for _, query := range []string{"a", "a", "a", "b", "b", "c"} {
+		require.NoError(t, stats.Record(ctx, "alice", query))
+	}
+
+	report, err := stats.Top(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), report.TotalQueries)
+	assert.Equal(t, []models.QueryCount{{Query: "a", Count: 3}, {Query: "b", Count: 2}}, report.TopQueries)
+}
+
+func TestQueryStats_SkipsUsersWithoutConsent(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	stats := setupStats(t, fakeClock, config.QueryStatsConfig{})
+	stats.SetConsent(func(ctx context.Context, userID string) bool { return userID != "bob" })
+	ctx := context.Background()
+
+	require.NoError(t, stats.Record(ctx, "alice", "What is Go?"))
+	require.NoError(t, stats.Record(ctx, "bob", "Who wrote Dune?"))
+
+	report, err := stats.Top(ctx, 1, 10)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.TotalQueries)
+	assert.Equal(t, []models.QueryCount{{Query: "what is go", Count: 1}}, report.TopQueries)
+}
+
+func TestQueryStats_EmptyReport(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	stats := setupStats(t, fakeClock, config.QueryStatsConfig{RetentionDays: 3})
+
+	report, err := stats.Top(context.Background(), 30, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, report.Days, "capped at the retention period")
+	assert.Zero(t, report.TotalQueries)
+	assert.Empty(t, report.TopQueries)
+}
@@ -0,0 +1,271 @@
+package analytics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	requestStatsKeyPrefix = "request_stats:"
+	hourLayout            = "2006-01-02T15"
+
+	defaultMaxUsers = 1000
+
+	// Hash fields of per-model counters, followed by the model's name
+	modelRequestsField = "model_requests:"
+	modelErrorsField   = "model_errors:"
+	modelLatencyField  = "model_latency_ms:"
+
+	// Hash fields of per-experiment counters, followed by the experiment's name
+	experimentRequestsField  = "experiment_requests:"
+	experimentLLMField       = "experiment_llm:"
+	experimentCacheHitsField = "experiment_cache_hits:"
+	experimentErrorsField    = "experiment_errors:"
+	experimentLatencyField   = "experiment_latency_ms:"
+	experimentCostField      = "experiment_cost:"
+)
+
+// RequestStats counts requests per UTC hour: volume, tiers, cache hits,
+// errors, latency and cost, overall, per model and per experiment, and each
+// user's cost.
+// Windows are reported in whole hours.
+type RequestStats struct {
+	client        *redis.Client
+	retentionDays int
+	maxUsers      int
+	clock         clock.Clock
+}
+
+func NewRequestStats(client *redis.Client, cfg config.RequestStatsConfig) *RequestStats {
+	retentionDays := cfg.RetentionDays
+	if retentionDays <= 0 {
+		retentionDays = defaultRetentionDays
+	}
+	maxUsers := cfg.MaxUsers
+	if maxUsers <= 0 {
+		maxUsers = defaultMaxUsers
+	}
+
+	return &RequestStats{
+		client:        client,
+		retentionDays: retentionDays,
+		maxUsers:      maxUsers,
+		clock:         clock.Real(),
+	}
+}
+
+// SetClock sets the clock that decides which hour a request is counted in
+func (s *RequestStats) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// MaxWindow is the longest window counters are kept for
+func (s *RequestStats) MaxWindow() time.Duration {
+	return time.Duration(s.retentionDays) * 24 * time.Hour
+}
+
+// RecordRequest counts a finished request
+func (s *RequestStats) RecordRequest(ctx context.Context, userID string, event middleware.RequestEvent) error {
+	hour := s.clock.Now().UTC()
+	countsKey, usersKey := hourKeys(hour)
+	failed := event.Status >= 400
+
+	pipe := s.client.TxPipeline()
+	pipe.HIncrBy(ctx, countsKey, "requests", 1)
+	pipe.HIncrByFloat(ctx, countsKey, "latency_ms", event.LatencyMs)
+	switch {
+	case event.Status >= 500:
+		pipe.HIncrBy(ctx, countsKey, "server_errors", 1)
+	case failed:
+		pipe.HIncrBy(ctx, countsKey, "client_errors", 1)
+	}
+	switch {
+	case event.CacheHit:
+		pipe.HIncrBy(ctx, countsKey, "cache_hits", 1)
+	case event.Tier == "cloud-llm":
+		pipe.HIncrBy(ctx, countsKey, "llm", 1)
+	case event.Tier == "edge-slm":
+		pipe.HIncrBy(ctx, countsKey, "slm", 1)
+	}
+	if event.Model != "" && !event.CacheHit {
+		pipe.HIncrBy(ctx, countsKey, modelRequestsField+event.Model, 1)
+		pipe.HIncrByFloat(ctx, countsKey, modelLatencyField+event.Model, event.LatencyMs)
+		if failed {
+			pipe.HIncrBy(ctx, countsKey, modelErrorsField+event.Model, 1)
+		}
+	}
+	if experiment := event.Experiment; experiment != "" {
+		pipe.HIncrBy(ctx, countsKey, experimentRequestsField+experiment, 1)
+		pipe.HIncrByFloat(ctx, countsKey, experimentLatencyField+experiment, event.LatencyMs)
+		switch {
+		case event.CacheHit:
+			pipe.HIncrBy(ctx, countsKey, experimentCacheHitsField+experiment, 1)
+		case event.Tier == "cloud-llm":
+			pipe.HIncrBy(ctx, countsKey, experimentLLMField+experiment, 1)
+		}
+		if failed {
+			pipe.HIncrBy(ctx, countsKey, experimentErrorsField+experiment, 1)
+		}
+		if event.Cost > 0 {
+			pipe.HIncrByFloat(ctx, countsKey, experimentCostField+experiment, event.Cost)
+		}
+	}
+	if event.Cost > 0 {
+		pipe.HIncrByFloat(ctx, countsKey, "cost", event.Cost)
+		if userID != "" {
+			pipe.ZIncrBy(ctx, usersKey, event.Cost, userID)
+			// Keep only the most expensive users
+			pipe.ZRemRangeByRank(ctx, usersKey, 0, int64(-s.maxUsers-1))
+		}
+	}
+	ttl := s.MaxWindow() + time.Hour
+	pipe.Expire(ctx, countsKey, ttl)
+	pipe.Expire(ctx, usersKey, ttl)
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record request: %w", err)
+	}
+	return nil
+}
+
+// Summary aggregates the requests of the last window, rounded up to whole
+// hours and counting the current one
+func (s *RequestStats) Summary(ctx context.Context, window time.Duration) (*models.RequestStatsReport, error) {
+	now := s.clock.Now().UTC()
+	countsKeys, _ := s.windowKeys(now, window)
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(countsKeys))
+	for i, key := range countsKeys {
+		cmds[i] = pipe.HGetAll(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get request stats: %w", err)
+	}
+
+	totals := make(map[string]float64)
+	for _, cmd := range cmds {
+		for field, value := range cmd.Val() {
+			n, _ := strconv.ParseFloat(value, 64)
+			totals[field] += n
+		}
+	}
+
+	hours := len(countsKeys)
+	report := &models.RequestStatsReport{
+		Window:       fmt.Sprintf("%dh", hours),
+		Since:        now.Truncate(time.Hour).Add(-time.Duration(hours-1) * time.Hour),
+		Requests:     int64(totals["requests"]),
+		LLMRequests:  int64(totals["llm"]),
+		SLMRequests:  int64(totals["slm"]),
+		CacheHits:    int64(totals["cache_hits"]),
+		ClientErrors: int64(totals["client_errors"]),
+		ServerErrors: int64(totals["server_errors"]),
+		CostUSD:      totals["cost"],
+		Models:       []models.ModelStats{},
+		Experiments:  []models.ExperimentStats{},
+	}
+	report.LLMShare = ratio(report.LLMRequests, report.LLMRequests+report.SLMRequests)
+	report.CacheHitRate = ratio(report.CacheHits, report.LLMRequests+report.SLMRequests+report.CacheHits)
+	report.ClientErrorRate = ratio(report.ClientErrors, report.Requests)
+	report.ServerErrorRate = ratio(report.ServerErrors, report.Requests)
+	if report.Requests > 0 {
+		report.AvgLatencyMs = totals["latency_ms"] / float64(report.Requests)
+	}
+
+	for field, requests := range totals {
+		model, ok := strings.CutPrefix(field, modelRequestsField)
+		if !ok || requests == 0 {
+			continue
+		}
+		report.Models = append(report.Models, models.ModelStats{
+			Model:        model,
+			Requests:     int64(requests),
+			Errors:       int64(totals[modelErrorsField+model]),
+			AvgLatencyMs: totals[modelLatencyField+model] / requests,
+		})
+	}
+	sort.Slice(report.Models, func(i, j int) bool {
+		if report.Models[i].Requests != report.Models[j].Requests {
+			return report.Models[i].Requests > report.Models[j].Requests
+		}
+		return report.Models[i].Model < report.Models[j].Model
+	})
+
+	for field, requests := range totals {
+		experiment, ok := strings.CutPrefix(field, experimentRequestsField)
+		if !ok || requests == 0 {
+			continue
+		}
+		report.Experiments = append(report.Experiments, models.ExperimentStats{
+			Experiment:   experiment,
+			Requests:     int64(requests),
+			LLMRequests:  int64(totals[experimentLLMField+experiment]),
+			CacheHits:    int64(totals[experimentCacheHitsField+experiment]),
+			Errors:       int64(totals[experimentErrorsField+experiment]),
+			AvgLatencyMs: totals[experimentLatencyField+experiment] / requests,
+			CostUSD:      totals[experimentCostField+experiment],
+		})
+	}
+	sort.Slice(report.Experiments, func(i, j int) bool {
+		return report.Experiments[i].Experiment < report.Experiments[j].Experiment
+	})
+	return report, nil
+}
+
+// TopUsers returns the limit users whose requests cost the most over the last
+// window, most expensive first
+func (s *RequestStats) TopUsers(ctx context.Context, window time.Duration, limit int) ([]models.UserCost, error) {
+	_, usersKeys := s.windowKeys(s.clock.Now().UTC(), window)
+
+	members, err := s.client.ZUnionWithScores(ctx, redis.ZStore{Keys: usersKeys}).Result()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get top users: %w", err)
+	}
+
+	// ZUNION returns members in ascending score order
+	users := []models.UserCost{}
+	for i := len(members) - 1; i >= 0 && len(users) < limit; i-- {
+		users = append(users, models.UserCost{
+			UserID:  members[i].Member.(string),
+			CostUSD: members[i].Score,
+		})
+	}
+	return users, nil
+}
+
+// windowKeys returns the keys of the hours a window covers, newest first
+func (s *RequestStats) windowKeys(now time.Time, window time.Duration) (countsKeys []string, usersKeys []string) {
+	window = min(max(window, time.Hour), s.MaxWindow())
+	hours := int((window + time.Hour - 1) / time.Hour)
+
+	countsKeys = make([]string, hours)
+	usersKeys = make([]string, hours)
+	for i := 0; i < hours; i++ {
+		countsKeys[i], usersKeys[i] = hourKeys(now.Add(-time.Duration(i) * time.Hour))
+	}
+	return countsKeys, usersKeys
+}
+
+func ratio(n int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func hourKeys(hour time.Time) (counts string, users string) {
+	prefix := requestStatsKeyPrefix + hour.Format(hourLayout)
+	return prefix + ":counts", prefix + ":users"
+}
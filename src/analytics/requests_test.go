@@ -0,0 +1,88 @@
+package analytics
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+)
+
+func TestRequestStats_SummaryOverWindow(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 10, 30, 0, 0, time.UTC))
+	mr := miniredis.RunT(t)
+	stats := NewRequestStats(redis.NewClient(&redis.Options{Addr: mr.Addr()}), config.RequestStatsConfig{})
+	stats.SetClock(fakeClock)
+	ctx := context.Background()
+
+	require.NoError(t, stats.RecordRequest(ctx, "alice", middleware.RequestEvent{Status: 200, LatencyMs: 900, Tier: "cloud-llm", Model: "gpt-4o", Cost: 0.03}))
+	fakeClock.Advance(2 * time.Hour)
+	for _, event := range []middleware.RequestEvent{
+		{Status: 200, LatencyMs: 100, Tier: "edge-slm", Model: "llama", Cost: 0.001},
+		{Status: 200, LatencyMs: 300, Tier: "edge-slm", Model: "llama", Cost: 0.001},
+		{Status: 200, LatencyMs: 5, Tier: "edge-slm", Model: "llama", CacheHit: true},
+		{Status: 502, LatencyMs: 200, Tier: "cloud-llm", Model: "gpt-4o"},
+		{Status: 429, LatencyMs: 1},
+	} {
+		require.NoError(t, stats.RecordRequest(ctx, "bob", event))
+	}
+
+	report, err := stats.Summary(ctx, time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), report.Requests)
+	assert.Equal(t, int64(1), report.LLMRequests)
+	assert.Equal(t, int64(2), report.SLMRequests)
+	assert.InDelta(t, 0.25, report.CacheHitRate, 1e-9)
+	assert.InDelta(t, 0.2, report.ServerErrorRate, 1e-9)
+	assert.InDelta(t, 0.2, report.ClientErrorRate, 1e-9)
+	require.Len(t, report.Models, 2)
+	assert.Equal(t, "llama", report.Models[0].Model)
+	assert.InDelta(t, 200, report.Models[0].AvgLatencyMs, 1e-9, "cache hits don't count towards a model's latency")
+	assert.Equal(t, int64(1), report.Models[1].Errors)
+
+	report, err = stats.Summary(ctx, 3*time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), report.Requests)
+	assert.InDelta(t, 0.032, report.CostUSD, 1e-9)
+
+	users, err := stats.TopUsers(ctx, 24*time.Hour, 10)
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "alice", users[0].UserID)
+	assert.InDelta(t, 0.002, users[1].CostUSD, 1e-9)
+}
+
+func TestRequestStats_Experiments(t *testing.T) {
+	mr := miniredis.RunT(t)
+	stats := NewRequestStats(redis.NewClient(&redis.Options{Addr: mr.Addr()}), config.RequestStatsConfig{})
+	ctx := context.Background()
+
+	for _, event := range []middleware.RequestEvent{
+		{Status: 200, LatencyMs: 100, Tier: "cloud-llm", Model: "gpt-4o", Cost: 0.02, Experiment: "long-prompts"},
+		{Status: 200, LatencyMs: 5, Tier: "cloud-llm", CacheHit: true, Experiment: "long-prompts"},
+		{Status: 500, LatencyMs: 300, Experiment: "long-prompts"},
+		{Status: 200, LatencyMs: 50, Tier: "edge-slm", Model: "llama", Experiment: "baseline"},
+		{Status: 200, LatencyMs: 50, Tier: "edge-slm", Model: "llama"},
+	} {
+		require.NoError(t, stats.RecordRequest(ctx, "alice", event))
+	}
+
+	report, err := stats.Summary(ctx, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, report.Experiments, 2)
+	assert.Equal(t, "baseline", report.Experiments[0].Experiment)
+	experiment := report.Experiments[1]
+	assert.Equal(t, int64(3), experiment.Requests)
+	assert.Equal(t, int64(1), experiment.LLMRequests)
+	assert.Equal(t, int64(1), experiment.CacheHits)
+	assert.Equal(t, int64(1), experiment.Errors)
+	assert.InDelta(t, 135, experiment.AvgLatencyMs, 1e-9)
+	assert.InDelta(t, 0.02, experiment.CostUSD, 1e-9)
+}
@@ -0,0 +1,289 @@
+// Package annotations keeps reviewers' verdicts on past responses: whether
+// an answer was correct, a category and notes. A response is identified by
+// the user who sent the request and the request's ID, which usage and
+// request events carry too, so the annotations label those records for eval
+// suites and routing training. Only requests the usage ledger recorded may be
+// annotated, and annotations are deleted once unchanged for the retention.
+package annotations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+const (
+	annotationKeyPrefix = "annotation:"       // Response -> hash of Annotation JSON by reviewer
+	indexKey            = "annotations:index" // Responses by when they were last annotated, in Unix ms
+	maxAttempts         = 3                   // Tries at a change before giving up to concurrent ones
+)
+
+var (
+	// ErrNotFound is returned when the reviewer hasn't annotated the response
+	ErrNotFound = errors.New("annotation not found")
+	// ErrUnknownResponse is returned for requests the usage ledger hasn't
+	// recorded, or not within the annotation window
+	ErrUnknownResponse = errors.New("unknown response")
+	// ErrUnknownCategory is returned for categories not in annotations.categories
+	ErrUnknownCategory = errors.New("unknown annotation category")
+)
+
+// Response identifies a past response: request IDs come from clients, so
+// they are only unique per user
+type Response struct {
+	UserID    string
+	RequestID string
+}
+
+// member is the response's index entry and key suffix. Request IDs have no
+// spaces, so the last one separates them.
+func (r Response) member() string {
+	return r.UserID + " " + r.RequestID
+}
+
+func parseMember(member string) Response {
+	i := strings.LastIndex(member, " ")
+	if i < 0 {
+		return Response{RequestID: member}
+	}
+	return Response{UserID: member[:i], RequestID: member[i+1:]}
+}
+
+// Requests tells which requests were served
+type Requests interface {
+	// Served reports whether the user's request with the ID was recorded
+	// within the annotation window
+	Served(ctx context.Context, userID string, requestID string) (bool, error)
+}
+
+// Store keeps annotations in Redis, one per reviewer and response
+type Store struct {
+	client     *redis.Client
+	requests   Requests
+	categories []string      // Allowed categories; any when empty
+	retention  time.Duration // How long annotations are kept after their last change; forever when 0
+	clock      clock.Clock
+	outbox     *outbox.Outbox // Receives an annotation event per change, optional
+}
+
+func NewStore(client *redis.Client, requests Requests, cfg config.AnnotationsConfig) *Store {
+	return &Store{
+		client:     client,
+		requests:   requests,
+		categories: cfg.Categories,
+		retention:  cfg.Retention,
+		clock:      clock.Real(),
+	}
+}
+
+// SetClock sets the clock annotations are dated with
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetOutbox records every change as an annotation event, in the same
+// transaction as the change
+func (s *Store) SetOutbox(o *outbox.Outbox) {
+	s.outbox = o
+}
+
+// Annotate creates or replaces the reviewer's annotation of a response
+func (s *Store) Annotate(ctx context.Context, reviewer string, response Response, req models.AnnotationRequest) (*models.Annotation, error) {
+	if req.Category != "" && len(s.categories) > 0 && !slices.Contains(s.categories, req.Category) {
+		return nil, ErrUnknownCategory
+	}
+	served, err := s.requests.Served(ctx, response.UserID, response.RequestID)
+	if err != nil {
+		return nil, err
+	}
+	if !served {
+		return nil, ErrUnknownResponse
+	}
+
+	key := annotationKeyPrefix + response.member()
+	var annotation *models.Annotation
+	err = s.update(ctx, key, func(tx *redis.Tx) error {
+		now := s.clock.Now().UTC()
+		annotation = &models.Annotation{
+			UserID:    response.UserID,
+			RequestID: response.RequestID,
+			Reviewer:  reviewer,
+			Label:     req.Label,
+			Category:  req.Category,
+			Notes:     req.Notes,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if previous, err := get(ctx, tx, key, reviewer); err == nil {
+			annotation.CreatedAt = previous.CreatedAt
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		data, err := json.Marshal(annotation)
+		if err != nil {
+			return fmt.Errorf("failed to encode annotation: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, reviewer, data)
+			pipe.ZAdd(ctx, indexKey, redis.Z{Score: float64(now.UnixMilli()), Member: response.member()})
+			if s.retention > 0 {
+				pipe.Expire(ctx, key, s.retention)
+				expired := strconv.FormatInt(now.Add(-s.retention).UnixMilli(), 10)
+				pipe.ZRemRangeByScore(ctx, indexKey, "-inf", "("+expired)
+			}
+			return s.outbox.Append(ctx, pipe, outbox.TypeAnnotation, "annotated", reviewer, annotation)
+		})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return annotation, nil
+}
+
+// Get returns every reviewer's annotation of a response, oldest first
+func (s *Store) Get(ctx context.Context, response Response) ([]models.Annotation, error) {
+	annotations, err := s.ForResponses(ctx, []Response{response})
+	if err != nil {
+		return nil, err
+	}
+	return annotations[response], nil
+}
+
+// ForResponses returns the annotations of each response that has any, oldest first
+func (s *Store) ForResponses(ctx context.Context, responses []Response) (map[Response][]models.Annotation, error) {
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(responses))
+	for i, response := range responses {
+		cmds[i] = pipe.HGetAll(ctx, annotationKeyPrefix+response.member())
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get annotations: %w", err)
+	}
+
+	byResponse := make(map[Response][]models.Annotation)
+	for i, cmd := range cmds {
+		for _, data := range cmd.Val() {
+			var annotation models.Annotation
+			if err := json.Unmarshal([]byte(data), &annotation); err != nil {
+				continue
+			}
+			byResponse[responses[i]] = append(byResponse[responses[i]], annotation)
+		}
+	}
+	for _, annotations := range byResponse {
+		sort.Slice(annotations, func(i, j int) bool {
+			return annotations[i].CreatedAt.Before(annotations[j].CreatedAt)
+		})
+	}
+	return byResponse, nil
+}
+
+// Delete removes the reviewer's annotation of a response
+func (s *Store) Delete(ctx context.Context, reviewer string, response Response) error {
+	key := annotationKeyPrefix + response.member()
+	return s.update(ctx, key, func(tx *redis.Tx) error {
+		annotation, err := get(ctx, tx, key, reviewer)
+		if err != nil {
+			return err
+		}
+		reviewers, err := tx.HLen(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("failed to delete annotation: %w", err)
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HDel(ctx, key, reviewer)
+			if reviewers == 1 {
+				pipe.ZRem(ctx, indexKey, response.member())
+			}
+			return s.outbox.Append(ctx, pipe, outbox.TypeAnnotation, "deleted", reviewer, annotation)
+		})
+		return err
+	})
+}
+
+// Range calls fn with pages of the annotations of responses last annotated
+// between since and until (zero for now), in that order. Responses annotated
+// again during the call may be skipped or repeated.
+func (s *Store) Range(ctx context.Context, since time.Time, until time.Time, count int64, fn func([]models.Annotation) error) error {
+	maxScore := "+inf"
+	if !until.IsZero() {
+		maxScore = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+	for offset := int64(0); ; offset += count {
+		members, err := s.client.ZRangeByScore(ctx, indexKey, &redis.ZRangeBy{
+			Min:    strconv.FormatInt(since.UnixMilli(), 10),
+			Max:    maxScore,
+			Offset: offset,
+			Count:  count,
+		}).Result()
+		if err != nil {
+			return fmt.Errorf("failed to list annotations: %w", err)
+		}
+		if len(members) == 0 {
+			return nil
+		}
+
+		responses := make([]Response, len(members))
+		for i, member := range members {
+			responses[i] = parseMember(member)
+		}
+		byResponse, err := s.ForResponses(ctx, responses)
+		if err != nil {
+			return err
+		}
+		var page []models.Annotation
+		for _, response := range responses {
+			page = append(page, byResponse[response]...)
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		if int64(len(members)) < count {
+			return nil
+		}
+	}
+}
+
+// update runs fn in a transaction watching key, trying again when another
+// change to the key gets in first
+func (s *Store) update(ctx context.Context, key string, fn func(tx *redis.Tx) error) error {
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		err := s.client.Watch(ctx, fn, key)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to save annotation: %w", redis.TxFailedErr)
+}
+
+func get(ctx context.Context, client redis.Cmdable, key string, reviewer string) (*models.Annotation, error) {
+	data, err := client.HGet(ctx, key, reviewer).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get annotation: %w", err)
+	}
+
+	var annotation models.Annotation
+	if err := json.Unmarshal(data, &annotation); err != nil {
+		return nil, fmt.Errorf("failed to decode annotation: %w", err)
+	}
+	return &annotation, nil
+}
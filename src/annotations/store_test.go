@@ -0,0 +1,160 @@
+package annotations
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+// servedRequests is a usage ledger that served the responses in it
+type servedRequests map[Response]bool
+
+func (s servedRequests) Served(ctx context.Context, userID string, requestID string) (bool, error) {
+	return s[Response{UserID: userID, RequestID: requestID}], nil
+}
+
+var (
+	carolReq1 = Response{UserID: "carol", RequestID: "req-1"}
+	carolReq2 = Response{UserID: "carol", RequestID: "req-2"}
+	carolReq3 = Response{UserID: "carol", RequestID: "req-3"}
+	daveReq1  = Response{UserID: "dave", RequestID: "req-1"}
+)
+
+func setupStore(t *testing.T) (*Store, *clock.Fake, *redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	served := servedRequests{carolReq1: true, carolReq2: true, carolReq3: true, daveReq1: true}
+	store := NewStore(client, served, config.AnnotationsConfig{Categories: []string{"factual", "formatting"}, Retention: 24 * time.Hour})
+	store.SetClock(fakeClock)
+	store.SetOutbox(outbox.NewOutbox(client, config.OutboxConfig{Stream: "events"}))
+	return store, fakeClock, client, mr
+}
+
+func TestStore_Annotate(t *testing.T) {
+	store, fakeClock, client, _ := setupStore(t)
+	ctx := context.Background()
+
+	created, err := store.Annotate(ctx, "alice", carolReq1, models.AnnotationRequest{Label: "incorrect", Category: "factual", Notes: "Wrong year"})
+	require.NoError(t, err)
+	assert.Equal(t, "carol", created.UserID)
+	fakeClock.Advance(time.Minute)
+	_, err = store.Annotate(ctx, "bob", carolReq1, models.AnnotationRequest{Label: "correct"})
+	require.NoError(t, err)
+
+	// Annotating again replaces the reviewer's annotation
+	fakeClock.Advance(time.Minute)
+	updated, err := store.Annotate(ctx, "alice", carolReq1, models.AnnotationRequest{Label: "correct", Category: "formatting"})
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.True(t, updated.UpdatedAt.After(created.UpdatedAt))
+
+	annotated, err := store.Get(ctx, carolReq1)
+	require.NoError(t, err)
+	require.Len(t, annotated, 2)
+	assert.Equal(t, "alice", annotated[0].Reviewer)
+	assert.Equal(t, "formatting", annotated[0].Category)
+	assert.Equal(t, "bob", annotated[1].Reviewer)
+
+	// Another user's request with the same ID is another response
+	annotated, err = store.Get(ctx, daveReq1)
+	require.NoError(t, err)
+	assert.Empty(t, annotated)
+
+	_, err = store.Annotate(ctx, "alice", carolReq2, models.AnnotationRequest{Label: "correct", Category: "vibes"})
+	assert.ErrorIs(t, err, ErrUnknownCategory)
+	_, err = store.Annotate(ctx, "alice", Response{UserID: "dave", RequestID: "req-2"}, models.AnnotationRequest{Label: "correct"})
+	assert.ErrorIs(t, err, ErrUnknownResponse, "dave never sent req-2")
+
+	events, err := client.XLen(ctx, "events").Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), events, "every change is an annotation event")
+}
+
+func TestStore_Delete(t *testing.T) {
+	store, _, client, _ := setupStore(t)
+	ctx := context.Background()
+
+	for _, reviewer := range []string{"alice", "bob"} {
+		_, err := store.Annotate(ctx, reviewer, carolReq1, models.AnnotationRequest{Label: "correct"})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, store.Delete(ctx, "bob", carolReq1))
+	assert.ErrorIs(t, store.Delete(ctx, "bob", carolReq1), ErrNotFound)
+	annotated, err := store.Get(ctx, carolReq1)
+	require.NoError(t, err)
+	assert.Len(t, annotated, 1)
+	indexed, err := client.ZCard(ctx, indexKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), indexed, "alice's annotation keeps the response indexed")
+
+	require.NoError(t, store.Delete(ctx, "alice", carolReq1))
+	indexed, err = client.ZCard(ctx, indexKey).Result()
+	require.NoError(t, err)
+	assert.Zero(t, indexed)
+}
+
+func TestStore_Retention(t *testing.T) {
+	store, fakeClock, client, mr := setupStore(t)
+	ctx := context.Background()
+
+	_, err := store.Annotate(ctx, "alice", carolReq1, models.AnnotationRequest{Label: "correct"})
+	require.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, mr.TTL(annotationKeyPrefix+carolReq1.member()))
+
+	// The next annotation drops the expired response from the index
+	fakeClock.Advance(25 * time.Hour)
+	mr.FastForward(25 * time.Hour)
+	_, err = store.Annotate(ctx, "alice", carolReq2, models.AnnotationRequest{Label: "correct"})
+	require.NoError(t, err)
+	members, err := client.ZRange(ctx, indexKey, 0, -1).Result()
+	require.NoError(t, err)
+	assert.Equal(t, []string{carolReq2.member()}, members)
+}
+
+func TestStore_Range(t *testing.T) {
+	store, fakeClock, _, _ := setupStore(t)
+	ctx := context.Background()
+
+	start := fakeClock.Now()
+	for _, response := range []Response{carolReq1, daveReq1, carolReq2} {
+		_, err := store.Annotate(ctx, "alice", response, models.AnnotationRequest{Label: "correct"})
+		require.NoError(t, err)
+		fakeClock.Advance(time.Hour)
+	}
+	require.NoError(t, store.Delete(ctx, "alice", carolReq2))
+
+	var responses []Response
+	var pages int
+	err := store.Range(ctx, start, time.Time{}, 1, func(page []models.Annotation) error {
+		pages++
+		for _, annotation := range page {
+			responses = append(responses, Response{UserID: annotation.UserID, RequestID: annotation.RequestID})
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Response{carolReq1, daveReq1}, responses)
+	assert.Equal(t, 2, pages)
+
+	responses = nil
+	err = store.Range(ctx, start.Add(30*time.Minute), start.Add(90*time.Minute), 10, func(page []models.Annotation) error {
+		for _, annotation := range page {
+			responses = append(responses, Response{UserID: annotation.UserID, RequestID: annotation.RequestID})
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Response{daveReq1}, responses)
+}
@@ -0,0 +1,157 @@
+// Package assistants keeps the state the OpenAI-compatible threads, runs and
+// responses endpoints need beyond the chat sessions they map onto: messages
+// added to a thread but not yet run, and which session and job each response
+// belongs to.
+package assistants
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	pendingKeyPrefix  = "thread_pending:"
+	responseKeyPrefix = "response:"
+	defaultTTL        = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrResponseNotFound is returned when a response doesn't exist or has expired
+	ErrResponseNotFound = errors.New("response not found")
+	// ErrResponseForbidden is returned when a response belongs to another user
+	ErrResponseForbidden = errors.New("response belongs to another user")
+)
+
+// Response is what's kept of a response: the session it continued, and the
+// job producing it or the chat turn it was answered with
+type Response struct {
+	ID                 string               `json:"id"`
+	UserID             string               `json:"user_id"`
+	SessionID          string               `json:"session_id"`
+	PreviousResponseID string               `json:"previous_response_id,omitempty"`
+	Model              string               `json:"model,omitempty"`
+	JobID              string               `json:"job_id,omitempty"` // Set for background responses
+	Status             string               `json:"status"`
+	Result             *models.ChatResponse `json:"result,omitempty"`
+	Error              string               `json:"error,omitempty"`
+	CreatedAt          time.Time            `json:"created_at"`
+}
+
+type Store struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewStore(client *redis.Client, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Store{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// AddPending adds messages to a thread, to be answered by its next run
+func (s *Store) AddPending(ctx context.Context, threadID string, messages ...models.ChatMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	values := make([]interface{}, len(messages))
+	for i, message := range messages {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return fmt.Errorf("failed to encode message: %w", err)
+		}
+		values[i] = data
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.RPush(ctx, pendingKeyPrefix+threadID, values...)
+	pipe.Expire(ctx, pendingKeyPrefix+threadID, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to add messages: %w", err)
+	}
+	return nil
+}
+
+// Pending returns the messages added to a thread since its last run
+func (s *Store) Pending(ctx context.Context, threadID string) ([]models.ChatMessage, error) {
+	values, err := s.client.LRange(ctx, pendingKeyPrefix+threadID, 0, -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
+	}
+	return decodeMessages(values), nil
+}
+
+// TakePending removes and returns the messages added to a thread since its
+// last run, so concurrent runs don't answer the same messages
+func (s *Store) TakePending(ctx context.Context, threadID string) ([]models.ChatMessage, error) {
+	pipe := s.client.TxPipeline()
+	values := pipe.LRange(ctx, pendingKeyPrefix+threadID, 0, -1)
+	pipe.Del(ctx, pendingKeyPrefix+threadID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to take messages: %w", err)
+	}
+	return decodeMessages(values.Val()), nil
+}
+
+// DeletePending forgets a thread's unanswered messages
+func (s *Store) DeletePending(ctx context.Context, threadID string) error {
+	return s.client.Del(ctx, pendingKeyPrefix+threadID).Err()
+}
+
+// SaveResponse stores a response
+func (s *Store) SaveResponse(ctx context.Context, response *Response) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to encode response: %w", err)
+	}
+	if err := s.client.Set(ctx, responseKeyPrefix+response.ID, data, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save response: %w", err)
+	}
+	return nil
+}
+
+// GetResponse returns a response, checking that it belongs to the user
+func (s *Store) GetResponse(ctx context.Context, id string, userID string) (*Response, error) {
+	data, err := s.client.Get(ctx, responseKeyPrefix+id).Bytes()
+	if err == redis.Nil {
+		return nil, ErrResponseNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get response: %w", err)
+	}
+
+	var response Response
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if response.UserID != userID {
+		return nil, ErrResponseForbidden
+	}
+	return &response, nil
+}
+
+// DeleteResponse deletes a response; the conversation it was part of is kept
+func (s *Store) DeleteResponse(ctx context.Context, id string) error {
+	return s.client.Del(ctx, responseKeyPrefix+id).Err()
+}
+
+func decodeMessages(values []string) []models.ChatMessage {
+	messages := make([]models.ChatMessage, 0, len(values))
+	for _, value := range values {
+		var message models.ChatMessage
+		if err := json.Unmarshal([]byte(value), &message); err == nil {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
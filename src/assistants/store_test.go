@@ -0,0 +1,68 @@
+package assistants
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupTestStore(t *testing.T) *Store {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewStore(client, 0)
+}
+
+func TestStore_TakePendingEmptiesThread(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+
+	require.NoError(t, store.AddPending(ctx, "thread_1",
+		models.ChatMessage{Role: "user", Content: "Hello"},
+		models.ChatMessage{Role: "user", Content: "Are you there?"},
+	))
+
+	pending, err := store.Pending(ctx, "thread_1")
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	taken, err := store.TakePending(ctx, "thread_1")
+	require.NoError(t, err)
+	require.Len(t, taken, 2)
+	assert.Equal(t, "Hello", taken[0].Content)
+
+	// A second run has nothing left to answer
+	taken, err = store.TakePending(ctx, "thread_1")
+	require.NoError(t, err)
+	assert.Empty(t, taken)
+}
+
+func TestStore_ResponseBelongsToItsUser(t *testing.T) {
+	store := setupTestStore(t)
+	ctx := context.Background()
+
+	require.NoError(t, store.SaveResponse(ctx, &Response{
+		ID:        "resp_1",
+		UserID:    "user_1",
+		SessionID: "sess_1",
+		Status:    "completed",
+	}))
+
+	response, err := store.GetResponse(ctx, "resp_1", "user_1")
+	require.NoError(t, err)
+	assert.Equal(t, "sess_1", response.SessionID)
+
+	_, err = store.GetResponse(ctx, "resp_1", "user_2")
+	assert.ErrorIs(t, err, ErrResponseForbidden)
+
+	require.NoError(t, store.DeleteResponse(ctx, "resp_1"))
+	_, err = store.GetResponse(ctx, "resp_1", "user_1")
+	assert.ErrorIs(t, err, ErrResponseNotFound)
+}
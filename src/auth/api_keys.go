@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	apiKeyPrefix        = "hlm_"
+	apiKeyKeyPrefix     = "api_key:"      // Key ID -> APIKey JSON
+	apiKeyHashKeyPrefix = "api_key_hash:" // SHA-256 of the secret -> key ID
+	userAPIKeysPrefix   = "user_api_keys:"
+
+	apiKeyDisplayLength = 12
+)
+
+var (
+	// ErrInvalidAPIKey is returned for unknown or revoked API keys
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyNotFound is returned when revoking a key the user doesn't own
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// storedAPIKey is the Redis record, which also keeps the secret's hash so a
+// revoked key's lookup entry can be deleted
+type storedAPIKey struct {
+	models.APIKey
+	Hash string `json:"hash"`
+}
+
+// APIKeyStore issues and validates API keys in Redis. Secrets are never
+// stored: keys are looked up by the SHA-256 of the secret.
+type APIKeyStore struct {
+	client *redis.Client
+	clock  clock.Clock
+}
+
+func NewAPIKeyStore(client *redis.Client) *APIKeyStore {
+	return &APIKeyStore{
+		client: client,
+		clock:  clock.Real(),
+	}
+}
+
+// SetClock sets the clock used for key creation times
+func (s *APIKeyStore) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Create issues a new key for the user with the given scopes and returns it
+// with its secret
+func (s *APIKeyStore) Create(ctx context.Context, userID string, name string, requestsPerMinute int, scopes ...string) (*models.APIKey, string, error) {
+	id, err := randomToken(8)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+	secret := apiKeyPrefix + token
+
+	stored := storedAPIKey{
+		APIKey: models.APIKey{
+			ID:                "key_" + id,
+			UserID:            userID,
+			Name:              name,
+			Prefix:            secret[:apiKeyDisplayLength],
+			RequestsPerMinute: requestsPerMinute,
+			Scopes:            scopes,
+			CreatedAt:         s.clock.Now(),
+		},
+		Hash: hashAPIKey(secret),
+	}
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal API key: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, apiKeyKeyPrefix+stored.ID, data, 0)
+	pipe.Set(ctx, apiKeyHashKeyPrefix+stored.Hash, stored.ID, 0)
+	pipe.SAdd(ctx, userAPIKeysPrefix+userID, stored.ID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return &stored.APIKey, secret, nil
+}
+
+// IsAPIKey reports whether secret has the form of an API key, to tell them
+// from other bearer tokens
+func IsAPIKey(secret string) bool {
+	return strings.HasPrefix(secret, apiKeyPrefix)
+}
+
+// Authenticate resolves a secret to its key
+func (s *APIKeyStore) Authenticate(ctx context.Context, secret string) (*models.APIKey, error) {
+	if !IsAPIKey(secret) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	id, err := s.client.Get(ctx, apiKeyHashKeyPrefix+hashAPIKey(secret)).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up API key: %w", err)
+	}
+
+	stored, err := s.get(ctx, id)
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return nil, ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stored.APIKey, nil
+}
+
+// List returns the user's keys, oldest first
+func (s *APIKeyStore) List(ctx context.Context, userID string) ([]models.APIKey, error) {
+	ids, err := s.client.SMembers(ctx, userAPIKeysPrefix+userID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	keys := make([]models.APIKey, 0, len(ids))
+	for _, id := range ids {
+		stored, err := s.get(ctx, id)
+		if errors.Is(err, ErrAPIKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, stored.APIKey)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+	return keys, nil
+}
+
+// Revoke deletes one of the user's keys; it stops working immediately
+func (s *APIKeyStore) Revoke(ctx context.Context, userID string, id string) error {
+	stored, err := s.get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if stored.UserID != userID {
+		return ErrAPIKeyNotFound
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, apiKeyKeyPrefix+id)
+	pipe.Del(ctx, apiKeyHashKeyPrefix+stored.Hash)
+	pipe.SRem(ctx, userAPIKeysPrefix+userID, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	return nil
+}
+
+func (s *APIKeyStore) get(ctx context.Context, id string) (*storedAPIKey, error) {
+	data, err := s.client.Get(ctx, apiKeyKeyPrefix+id).Result()
+	if err == redis.Nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+
+	var stored storedAPIKey
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API key: %w", err)
+	}
+	return &stored, nil
+}
+
+func hashAPIKey(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewAPIKeyStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	key, secret, err := store.Create(ctx, "alice", "nightly batch", 30)
+	require.NoError(t, err)
+	assert.Equal(t, secret[:len(key.Prefix)], key.Prefix)
+
+	// Only the hash of the secret is stored
+	for _, k := range mr.Keys() {
+		value, _ := mr.Get(k)
+		assert.NotContains(t, value, secret)
+		assert.NotContains(t, k, secret)
+	}
+
+	authenticated, err := store.Authenticate(ctx, secret)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", authenticated.UserID)
+	assert.Equal(t, 30, authenticated.RequestsPerMinute)
+
+	keys, err := store.List(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, key.ID, keys[0].ID)
+
+	assert.ErrorIs(t, store.Revoke(ctx, "bob", key.ID), ErrAPIKeyNotFound, "only the owner can revoke")
+
+	require.NoError(t, store.Revoke(ctx, "alice", key.ID))
+	_, err = store.Authenticate(ctx, secret)
+	assert.ErrorIs(t, err, ErrInvalidAPIKey)
+
+	keys, err = store.List(ctx, "alice")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const googleUserInfoURL = "https://www.googleapis.com/oauth2/v2/userinfo"
+
+// GoogleUserInfo is the profile returned by Google's userinfo endpoint
+type GoogleUserInfo struct {
+	ID            string `json:"id"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+}
+
+// GoogleOAuth wraps the OAuth2 authorization code flow for Google sign-in
+type GoogleOAuth struct {
+	config *oauth2.Config
+}
+
+func NewGoogleOAuth(cfg *config.AuthConfig) *GoogleOAuth {
+	return &GoogleOAuth{
+		config: &oauth2.Config{
+			ClientID:     cfg.GoogleClientID,
+			ClientSecret: cfg.GoogleClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       []string{"openid", "email", "profile"},
+			Endpoint:     google.Endpoint,
+		},
+	}
+}
+
+// AuthCodeURL returns the Google consent page URL for the given state
+func (g *GoogleOAuth) AuthCodeURL(state string) string {
+	return g.config.AuthCodeURL(state)
+}
+
+// Exchange trades an authorization code for the user's Google profile
+func (g *GoogleOAuth) Exchange(ctx context.Context, code string) (*GoogleUserInfo, error) {
+	token, err := g.config.Exchange(ctx, code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+
+	resp, err := g.config.Client(ctx, token).Get(googleUserInfoURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch user info: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("user info request failed with status %d", resp.StatusCode)
+	}
+
+	var info GoogleUserInfo
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("failed to decode user info: %w", err)
+	}
+	if !info.VerifiedEmail {
+		return nil, fmt.Errorf("google account email is not verified")
+	}
+
+	return &info, nil
+}
+
+// NewState returns a random OAuth state value for CSRF protection
+func NewState() (string, error) {
+	return randomToken(16)
+}
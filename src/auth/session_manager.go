@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const authSessionKeyPrefix = "auth_session:"
+
+// ErrInvalidSession is returned for unknown or expired session tokens
+var ErrInvalidSession = errors.New("invalid or expired session")
+
+// SessionManager issues and validates opaque login session tokens stored in Redis
+type SessionManager struct {
+	client *redis.Client
+	reader redis.Cmdable // Read replica tried first by GetUserID, if set
+	ttl    time.Duration
+}
+
+func NewSessionManager(client *redis.Client, ttl time.Duration) *SessionManager {
+	return &SessionManager{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// TTL returns how long a login session stays valid
+func (m *SessionManager) TTL() time.Duration {
+	return m.ttl
+}
+
+// SetReader validates tokens against a read replica first. Tokens the
+// replica doesn't have yet, like those of a login moments ago, are looked up
+// on the primary.
+func (m *SessionManager) SetReader(reader redis.Cmdable) {
+	m.reader = reader
+}
+
+// CreateSession creates a login session for the user and returns its token
+func (m *SessionManager) CreateSession(ctx context.Context, userID string) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	if err := m.client.Set(ctx, authSessionKeyPrefix+token, userID, m.ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to create login session: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetUserID resolves a session token to the user ID it was issued for
+func (m *SessionManager) GetUserID(ctx context.Context, token string) (string, error) {
+	if token == "" {
+		return "", ErrInvalidSession
+	}
+
+	key := authSessionKeyPrefix + token
+	if m.reader != nil {
+		if userID, err := m.reader.Get(ctx, key).Result(); err == nil {
+			return userID, nil
+		}
+	}
+
+	userID, err := m.client.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return "", ErrInvalidSession
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get login session: %w", err)
+	}
+
+	return userID, nil
+}
+
+// DeleteSession invalidates a session token (logout)
+func (m *SessionManager) DeleteSession(ctx context.Context, token string) error {
+	return m.client.Del(ctx, authSessionKeyPrefix+token).Err()
+}
+
+// randomToken returns n random bytes hex-encoded
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionManager_ReplicaReads(t *testing.T) {
+	primary, replica := miniredis.RunT(t), miniredis.RunT(t)
+	manager := NewSessionManager(redis.NewClient(&redis.Options{Addr: primary.Addr()}), time.Hour)
+	manager.SetReader(redis.NewClient(&redis.Options{Addr: replica.Addr()}))
+	ctx := context.Background()
+
+	// A fresh login isn't on the replica yet and is found on the primary
+	token, err := manager.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	userID, err := manager.GetUserID(ctx, token)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+
+	require.NoError(t, replica.Set(authSessionKeyPrefix+"replicated", "bob"))
+	userID, err = manager.GetUserID(ctx, "replicated")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", userID)
+
+	_, err = manager.GetUserID(ctx, "unknown")
+	assert.ErrorIs(t, err, ErrInvalidSession)
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	refreshTokenKeyPrefix = "refresh_token:"
+	tokenIssuer           = "hybridlm"
+)
+
+// ErrInvalidToken is returned for access or refresh tokens that are malformed,
+// badly signed, expired or revoked
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// TokenIssuer issues short-lived JWT access tokens and opaque refresh tokens
+// for clients that can't use the session cookie. Refresh tokens are stored in
+// Redis so they can be rotated and revoked; access tokens are validated from
+// their signature alone.
+type TokenIssuer struct {
+	client     *redis.Client
+	secret     []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	clock      clock.Clock
+}
+
+func NewTokenIssuer(client *redis.Client, cfg *config.AuthConfig) *TokenIssuer {
+	return &TokenIssuer{
+		client:     client,
+		secret:     []byte(cfg.JWTSecret),
+		accessTTL:  cfg.AccessTokenTTL,
+		refreshTTL: cfg.RefreshTokenTTL,
+		clock:      clock.Real(),
+	}
+}
+
+// SetClock sets the clock used to issue and check token expiry
+func (i *TokenIssuer) SetClock(c clock.Clock) {
+	i.clock = c
+}
+
+// Issue creates an access token and a refresh token for the user
+func (i *TokenIssuer) Issue(ctx context.Context, userID string) (*models.TokenPair, error) {
+	now := i.clock.Now()
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Subject:   userID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(i.accessTTL)),
+	}).SignedString(i.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	refresh, err := randomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.client.Set(ctx, refreshTokenKeyPrefix+refresh, userID, i.refreshTTL).Err(); err != nil {
+		return nil, fmt.Errorf("failed to store refresh token: %w", err)
+	}
+
+	return &models.TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(i.accessTTL.Seconds()),
+	}, nil
+}
+
+// ValidateAccessToken returns the user ID an access token was issued for
+func (i *TokenIssuer) ValidateAccessToken(token string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return i.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(i.clock.Now),
+	)
+	if err != nil || claims.Subject == "" {
+		return "", ErrInvalidToken
+	}
+
+	return claims.Subject, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. The refresh token
+// is single use: it is revoked whether or not issuing the new pair succeeds.
+func (i *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (*models.TokenPair, error) {
+	if refreshToken == "" {
+		return nil, ErrInvalidToken
+	}
+
+	userID, err := i.client.GetDel(ctx, refreshTokenKeyPrefix+refreshToken).Result()
+	if err == redis.Nil {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return i.Issue(ctx, userID)
+}
+
+// RevokeRefreshToken invalidates a refresh token (logout)
+func (i *TokenIssuer) RevokeRefreshToken(ctx context.Context, refreshToken string) error {
+	return i.client.Del(ctx, refreshTokenKeyPrefix+refreshToken).Err()
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+func newTestTokenIssuer(t *testing.T, secret string) *TokenIssuer {
+	mr := miniredis.RunT(t)
+	return NewTokenIssuer(redis.NewClient(&redis.Options{Addr: mr.Addr()}), &config.AuthConfig{
+		JWTSecret:       secret,
+		AccessTokenTTL:  15 * time.Minute,
+		RefreshTokenTTL: time.Hour,
+	})
+}
+
+func TestTokenIssuer_AccessTokens(t *testing.T) {
+	issuer := newTestTokenIssuer(t, "secret")
+
+	pair, err := issuer.Issue(context.Background(), "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, 900, pair.ExpiresIn)
+
+	userID, err := issuer.ValidateAccessToken(pair.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+
+	_, err = issuer.ValidateAccessToken(pair.AccessToken + "x")
+	assert.ErrorIs(t, err, ErrInvalidToken, "tampered signature")
+
+	_, err = newTestTokenIssuer(t, "other").ValidateAccessToken(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "signed with another secret")
+
+	fakeClock := clock.NewFake(time.Now())
+	issuer.SetClock(fakeClock)
+	fakeClock.Advance(16 * time.Minute)
+	_, err = issuer.ValidateAccessToken(pair.AccessToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "expired")
+}
+
+func TestTokenIssuer_Refresh(t *testing.T) {
+	issuer := newTestTokenIssuer(t, "secret")
+	ctx := context.Background()
+
+	pair, err := issuer.Issue(ctx, "alice")
+	require.NoError(t, err)
+
+	refreshed, err := issuer.Refresh(ctx, pair.RefreshToken)
+	require.NoError(t, err)
+	assert.NotEqual(t, pair.RefreshToken, refreshed.RefreshToken)
+
+	userID, err := issuer.ValidateAccessToken(refreshed.AccessToken)
+	require.NoError(t, err)
+	assert.Equal(t, "alice", userID)
+
+	_, err = issuer.Refresh(ctx, pair.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken, "refresh tokens are single use")
+
+	require.NoError(t, issuer.RevokeRefreshToken(ctx, refreshed.RefreshToken))
+	_, err = issuer.Refresh(ctx, refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidToken)
+}
@@ -0,0 +1,266 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	userKeyPrefix      = "user:"
+	userEmailKeyPrefix = "user_email:"
+)
+
+var (
+	// ErrUserNotFound is returned when no user exists for the given ID
+	ErrUserNotFound = errors.New("user not found")
+	// ErrUserDeactivated is returned for users an admin has deactivated
+	ErrUserDeactivated = errors.New("user deactivated")
+)
+
+// UserDatabase keeps users durably behind Redis, which then caches them
+type UserDatabase interface {
+	// LoadUser returns nil if there's no user with the ID
+	LoadUser(ctx context.Context, userID string) (*models.User, error)
+	SaveUser(ctx context.Context, user *models.User) error
+	ListUsers(ctx context.Context) ([]models.User, error)
+}
+
+// UserStore persists users in Redis
+type UserStore struct {
+	client      *redis.Client
+	clock       clock.Clock
+	adminEmails []string
+	database    UserDatabase // Durable copy of every user, optional
+}
+
+func NewUserStore(client *redis.Client) *UserStore {
+	return &UserStore{
+		client: client,
+		clock:  clock.Real(),
+	}
+}
+
+// SetClock sets the clock used for signup and login times
+func (s *UserStore) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetDatabase saves every user to the database as well, reading users
+// Redis lost back from it, and lists users from it
+func (s *UserStore) SetDatabase(database UserDatabase) {
+	s.database = database
+}
+
+// SetAdminEmails sets the emails of the users with the admin role; everyone
+// else has the user role
+func (s *UserStore) SetAdminEmails(emails []string) {
+	s.adminEmails = emails
+}
+
+// GetUser retrieves a user by ID
+func (s *UserStore) GetUser(ctx context.Context, userID string) (*models.User, error) {
+	data, err := s.client.Get(ctx, userKeyPrefix+userID).Result()
+	if err == redis.Nil {
+		return s.loadUser(ctx, userID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var user models.User
+	if err := json.Unmarshal([]byte(data), &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	// The allow-list decides, so config changes apply without a new login
+	user.Role = s.roleFor(user.Email)
+
+	return &user, nil
+}
+
+// loadUser reads a user missing from Redis from the database and caches it again
+func (s *UserStore) loadUser(ctx context.Context, userID string) (*models.User, error) {
+	if s.database == nil {
+		return nil, ErrUserNotFound
+	}
+	user, err := s.database.LoadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	if err := s.cacheUser(ctx, user); err != nil {
+		return nil, err
+	}
+	user.Role = s.roleFor(user.Email)
+	return user, nil
+}
+
+// RoleOf returns a user's role, or ErrUserDeactivated for deactivated users.
+// Users without a profile, like the owners of API keys created before
+// sign-in was required, have the user role.
+func (s *UserStore) RoleOf(ctx context.Context, userID string) (string, error) {
+	user, err := s.GetUser(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		return models.RoleUser, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if user.Deactivated {
+		return "", ErrUserDeactivated
+	}
+	return user.Role, nil
+}
+
+// ListUsers returns every user, most recently signed in first
+func (s *UserStore) ListUsers(ctx context.Context) ([]models.User, error) {
+	if s.database != nil {
+		users, err := s.database.ListUsers(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for i := range users {
+			users[i].Role = s.roleFor(users[i].Email)
+		}
+		return users, nil
+	}
+
+	// The email index has one key per user, unlike user:, which other data
+	// is also kept under
+	var userIDs []string
+	iter := s.client.Scan(ctx, 0, userEmailKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		userID, err := s.client.Get(ctx, iter.Val()).Result()
+		if err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	users := []models.User{}
+	for _, userID := range userIDs {
+		user, err := s.GetUser(ctx, userID)
+		if errors.Is(err, ErrUserNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].LastLoginAt.After(users[j].LastLoginAt)
+	})
+	return users, nil
+}
+
+// SetDeactivated deactivates a user, or reactivates them
+func (s *UserStore) SetDeactivated(ctx context.Context, userID string, deactivated bool) (*models.User, error) {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Deactivated = deactivated
+	user.DeactivatedAt = time.Time{}
+	if deactivated {
+		user.DeactivatedAt = s.clock.Now()
+	}
+	if err := s.SaveUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// OrgOf returns the user's org, the domain of their email address, or "" if
+// the user can't be loaded
+func (s *UserStore) OrgOf(ctx context.Context, userID string) string {
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return ""
+	}
+	_, domain, found := strings.Cut(user.Email, "@")
+	if !found {
+		return ""
+	}
+	return strings.ToLower(domain)
+}
+
+// SaveUser saves or updates a user and its email index
+func (s *UserStore) SaveUser(ctx context.Context, user *models.User) error {
+	if s.database != nil {
+		if err := s.database.SaveUser(ctx, user); err != nil {
+			return err
+		}
+	}
+	return s.cacheUser(ctx, user)
+}
+
+func (s *UserStore) cacheUser(ctx context.Context, user *models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, userKeyPrefix+user.ID, data, 0)
+	pipe.Set(ctx, userEmailKeyPrefix+strings.ToLower(user.Email), user.ID, 0)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+
+	return nil
+}
+
+// UpsertGoogleUser creates the user on first login or refreshes the profile on later logins
+func (s *UserStore) UpsertGoogleUser(ctx context.Context, info *GoogleUserInfo) (*models.User, error) {
+	userID := "usr_google_" + info.ID
+
+	user, err := s.GetUser(ctx, userID)
+	if errors.Is(err, ErrUserNotFound) {
+		user = &models.User{
+			ID:        userID,
+			CreatedAt: s.clock.Now(),
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	if user.Deactivated {
+		return nil, ErrUserDeactivated
+	}
+
+	user.Email = info.Email
+	user.Role = s.roleFor(info.Email)
+	user.Name = info.Name
+	user.Picture = info.Picture
+	user.LastLoginAt = s.clock.Now()
+
+	if err := s.SaveUser(ctx, user); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) roleFor(email string) string {
+	if email != "" && slices.ContainsFunc(s.adminEmails, func(admin string) bool {
+		return strings.EqualFold(admin, email)
+	}) {
+		return models.RoleAdmin
+	}
+	return models.RoleUser
+}
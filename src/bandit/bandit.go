@@ -0,0 +1,263 @@
+// Package bandit shares the SLM tier's traffic across its models by what
+// they've shown: answers rated good or scored well by the judge, and speed.
+// Traffic starts out following the configured weights and shifts toward the
+// best scoring models as observations come in, while pinned models keep
+// their weight as a fixed share.
+package bandit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	statsPrefix  = "slm_bandit:"        // Hash of a model's observations, by model
+	answerPrefix = "slm_bandit_answer:" // Answers awaiting a rating, by ID
+)
+
+// ErrAnswerNotFound is returned when rating an answer that doesn't exist,
+// has expired, was already rated or belongs to another user
+var ErrAnswerNotFound = errors.New("answer not found")
+
+type arm struct {
+	model  string
+	weight float64
+	pinned bool
+}
+
+// observations are a model's counts as kept in Redis
+type observations struct {
+	qualitySum   float64
+	ratings      int64
+	latencySumMs float64
+	answers      int64
+}
+
+// Bandit picks the SLM model that answers each query. Observations are kept
+// in Redis, so every instance shares traffic the same way.
+type Bandit struct {
+	client *redis.Client
+	cfg    config.SLMBanditConfig
+	arms   []arm
+	random func() float64
+}
+
+func New(client *redis.Client, cfg config.SLMBanditConfig, slmModels []config.SLMModelConfig) *Bandit {
+	arms := make([]arm, len(slmModels))
+	for i, model := range slmModels {
+		weight := model.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		arms[i] = arm{model: model.Name, weight: weight, pinned: model.Pinned}
+	}
+	return &Bandit{client: client, cfg: cfg, arms: arms, random: rand.Float64}
+}
+
+// Select picks the model to answer a query, following the configured
+// weights when the observations can't be read
+func (b *Bandit) Select(ctx context.Context) string {
+	stats, err := b.load(ctx)
+	if err != nil {
+		stats = make([]observations, len(b.arms))
+	}
+	shares := b.shares(stats)
+
+	pick := b.random()
+	for i, share := range shares {
+		pick -= share
+		if pick < 0 {
+			return b.arms[i].model
+		}
+	}
+	return b.arms[len(b.arms)-1].model
+}
+
+// ShouldJudge reports whether an answer should be scored by the judge
+func (b *Bandit) ShouldJudge() bool {
+	return b.random() < b.cfg.JudgeSampleRate
+}
+
+// ObserveAnswer counts an answer from model and how long it took
+func (b *Bandit) ObserveAnswer(ctx context.Context, model string, latency time.Duration) error {
+	pipe := b.client.TxPipeline()
+	pipe.HIncrByFloat(ctx, statsPrefix+model, "latency_sum_ms", float64(latency.Milliseconds()))
+	pipe.HIncrBy(ctx, statsPrefix+model, "answers", 1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record %s's answer: %w", model, err)
+	}
+	return nil
+}
+
+// ObserveQuality counts a quality score between 0 and 1 for model: a rating,
+// a judge's score, or 0 for a failed call
+func (b *Bandit) ObserveQuality(ctx context.Context, model string, score float64) error {
+	pipe := b.client.TxPipeline()
+	pipe.HIncrByFloat(ctx, statsPrefix+model, "quality_sum", math.Min(1, math.Max(0, score)))
+	pipe.HIncrBy(ctx, statsPrefix+model, "ratings", 1)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record %s's quality: %w", model, err)
+	}
+	return nil
+}
+
+// RecordAnswer keeps an answer from model served to userID for rating and
+// returns its ID
+func (b *Bandit) RecordAnswer(ctx context.Context, userID string, model string) (string, error) {
+	answerID := "ans_" + uuid.New().String()
+	if err := b.client.Set(ctx, answerPrefix+answerID, userID+"\n"+model, b.cfg.FeedbackWindow).Err(); err != nil {
+		return "", fmt.Errorf("failed to record answer for feedback: %w", err)
+	}
+	return answerID, nil
+}
+
+// Rate counts userID's rating of an answer they were served and returns the
+// model that gave it. Each answer is rated once.
+func (b *Bandit) Rate(ctx context.Context, userID string, answerID string, good bool) (string, error) {
+	value, err := b.client.Get(ctx, answerPrefix+answerID).Result()
+	if err == redis.Nil {
+		return "", ErrAnswerNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to look up answer: %w", err)
+	}
+	owner, model, _ := strings.Cut(value, "\n")
+	if owner != userID {
+		return "", ErrAnswerNotFound
+	}
+	// Only the first of concurrent ratings counts
+	deleted, err := b.client.Del(ctx, answerPrefix+answerID).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to look up answer: %w", err)
+	}
+	if deleted == 0 {
+		return "", ErrAnswerNotFound
+	}
+
+	score := 0.0
+	if good {
+		score = 1
+	}
+	return model, b.ObserveQuality(ctx, model, score)
+}
+
+// Stats reports every model's share of traffic and what it's based on
+func (b *Bandit) Stats(ctx context.Context) ([]models.BanditArm, error) {
+	stats, err := b.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shares := b.shares(stats)
+
+	arms := make([]models.BanditArm, len(b.arms))
+	for i, a := range b.arms {
+		arms[i] = models.BanditArm{
+			Model:   a.model,
+			Pinned:  a.pinned,
+			Share:   shares[i],
+			Score:   b.score(stats[i]),
+			Quality: b.quality(stats[i]),
+			Ratings: stats[i].ratings,
+			Answers: stats[i].answers,
+		}
+		if stats[i].answers > 0 {
+			arms[i].LatencyMs = stats[i].latencySumMs / float64(stats[i].answers)
+		}
+	}
+	return arms, nil
+}
+
+func (b *Bandit) load(ctx context.Context) ([]observations, error) {
+	pipe := b.client.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(b.arms))
+	for i, a := range b.arms {
+		cmds[i] = pipe.HGetAll(ctx, statsPrefix+a.model)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get bandit observations: %w", err)
+	}
+
+	stats := make([]observations, len(b.arms))
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		stats[i].qualitySum, _ = strconv.ParseFloat(fields["quality_sum"], 64)
+		stats[i].ratings, _ = strconv.ParseInt(fields["ratings"], 10, 64)
+		stats[i].latencySumMs, _ = strconv.ParseFloat(fields["latency_sum_ms"], 64)
+		stats[i].answers, _ = strconv.ParseInt(fields["answers"], 10, 64)
+	}
+	return stats, nil
+}
+
+// shares splits traffic: pinned models get their share of the total weight,
+// and the rest goes to the others by their weights at first, handing over to
+// a softmax of their scores as answers come in
+func (b *Bandit) shares(stats []observations) []float64 {
+	shares := make([]float64, len(b.arms))
+	var totalWeight, freeWeight float64
+	for _, a := range b.arms {
+		totalWeight += a.weight
+		if !a.pinned {
+			freeWeight += a.weight
+		}
+	}
+	if freeWeight == 0 {
+		for i, a := range b.arms {
+			shares[i] = a.weight / totalWeight
+		}
+		return shares
+	}
+
+	exps := make([]float64, len(b.arms))
+	var expSum, answers float64
+	for i, a := range b.arms {
+		if !a.pinned {
+			exps[i] = math.Exp(b.score(stats[i]) / b.cfg.Temperature)
+			expSum += exps[i]
+			answers += float64(stats[i].answers)
+		}
+	}
+	// The weights count as prior_strength answers
+	static := b.cfg.PriorStrength / (b.cfg.PriorStrength + answers)
+	free := freeWeight / totalWeight
+	for i, a := range b.arms {
+		if a.pinned {
+			shares[i] = a.weight / totalWeight
+		} else {
+			shares[i] = free * (static*a.weight/freeWeight + (1-static)*exps[i]/expSum)
+		}
+	}
+	return shares
+}
+
+// quality estimates a model's answers' quality, starting from a neutral 0.5
+// that counts as prior_strength ratings
+func (b *Bandit) quality(stats observations) float64 {
+	return (stats.qualitySum + b.cfg.PriorStrength*0.5) / (float64(stats.ratings) + b.cfg.PriorStrength)
+}
+
+// latencyScore is target/(target+mean latency): 0.5 at the target, and
+// before the first answer
+func (b *Bandit) latencyScore(stats observations) float64 {
+	if stats.answers == 0 {
+		return 0.5
+	}
+	target := float64(b.cfg.LatencyTarget.Milliseconds())
+	return target / (target + stats.latencySumMs/float64(stats.answers))
+}
+
+// score combines a model's quality and latency, between 0 and 1
+func (b *Bandit) score(stats observations) float64 {
+	return (1-b.cfg.LatencyWeight)*b.quality(stats) + b.cfg.LatencyWeight*b.latencyScore(stats)
+}
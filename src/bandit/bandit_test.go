@@ -0,0 +1,102 @@
+package bandit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+func newTestBandit(t *testing.T, slmModels []config.SLMModelConfig) *Bandit {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return New(client, config.SLMBanditConfig{
+		LatencyWeight:  0.3,
+		LatencyTarget:  2 * time.Second,
+		Temperature:    0.1,
+		PriorStrength:  20,
+		FeedbackWindow: time.Hour,
+	}, slmModels)
+}
+
+func shareOf(t *testing.T, b *Bandit, model string) float64 {
+	arms, err := b.Stats(context.Background())
+	require.NoError(t, err)
+	for _, arm := range arms {
+		if arm.Model == model {
+			return arm.Share
+		}
+	}
+	t.Fatalf("no arm for %s", model)
+	return 0
+}
+
+func TestBandit_SharesFollowObservations(t *testing.T) {
+	b := newTestBandit(t, []config.SLMModelConfig{
+		{Name: "fast", Weight: 1},
+		{Name: "good", Weight: 3},
+	})
+	ctx := context.Background()
+
+	// Weights until there are answers
+	assert.InDelta(t, 0.25, shareOf(t, b, "fast"), 0.001)
+	assert.InDelta(t, 0.75, shareOf(t, b, "good"), 0.001)
+
+	for range 50 {
+		require.NoError(t, b.ObserveAnswer(ctx, "fast", 500*time.Millisecond))
+		require.NoError(t, b.ObserveQuality(ctx, "fast", 1))
+		require.NoError(t, b.ObserveAnswer(ctx, "good", 4*time.Second))
+		require.NoError(t, b.ObserveQuality(ctx, "good", 0.2))
+	}
+	assert.Greater(t, shareOf(t, b, "fast"), 0.8)
+
+	b.random = func() float64 { return 0.5 }
+	assert.Equal(t, "fast", b.Select(ctx))
+}
+
+func TestBandit_PinnedShare(t *testing.T) {
+	b := newTestBandit(t, []config.SLMModelConfig{
+		{Name: "pinned", Weight: 1, Pinned: true},
+		{Name: "a", Weight: 1},
+		{Name: "b", Weight: 2},
+	})
+	ctx := context.Background()
+	for range 100 {
+		require.NoError(t, b.ObserveAnswer(ctx, "a", time.Second))
+		require.NoError(t, b.ObserveQuality(ctx, "a", 0))
+		require.NoError(t, b.ObserveQuality(ctx, "pinned", 0))
+	}
+
+	assert.InDelta(t, 0.25, shareOf(t, b, "pinned"), 0.001)
+	assert.InDelta(t, 0.75, shareOf(t, b, "a")+shareOf(t, b, "b"), 0.001)
+	assert.Greater(t, shareOf(t, b, "b"), shareOf(t, b, "a"))
+}
+
+func TestBandit_Rate(t *testing.T) {
+	b := newTestBandit(t, []config.SLMModelConfig{{Name: "only", Weight: 1}})
+	ctx := context.Background()
+
+	answerID, err := b.RecordAnswer(ctx, "alice", "only")
+	require.NoError(t, err)
+
+	_, err = b.Rate(ctx, "mallory", answerID, false)
+	assert.ErrorIs(t, err, ErrAnswerNotFound)
+
+	model, err := b.Rate(ctx, "alice", answerID, true)
+	require.NoError(t, err)
+	assert.Equal(t, "only", model)
+
+	_, err = b.Rate(ctx, "alice", answerID, true)
+	assert.ErrorIs(t, err, ErrAnswerNotFound, "answers are rated once")
+
+	arms, err := b.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), arms[0].Ratings)
+	assert.InDelta(t, 11.0/21, arms[0].Quality, 0.001)
+}
@@ -0,0 +1,97 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const scanBatchSize = 500
+
+// hitCounter counts cache lookups made by this instance
+type hitCounter struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (h *hitCounter) record(hit bool) {
+	if hit {
+		h.hits.Add(1)
+	} else {
+		h.misses.Add(1)
+	}
+}
+
+// fill copies the counts and hit ratio into stats
+func (h *hitCounter) fill(stats *models.CacheStats) {
+	stats.Hits = h.hits.Load()
+	stats.Misses = h.misses.Load()
+	if total := stats.Hits + stats.Misses; total > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(total)
+	}
+}
+
+// scanKeys walks the keys matching pattern with SCAN, calling fn with each batch
+func scanKeys(ctx context.Context, client *redis.Client, pattern string, fn func(keys []string) error) error {
+	iter := client.Scan(ctx, 0, pattern, scanBatchSize).Iterator()
+	batch := make([]string, 0, scanBatchSize)
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == scanBatchSize {
+			if err := fn(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return fmt.Errorf("failed to scan %s: %w", pattern, err)
+	}
+	if len(batch) > 0 {
+		return fn(batch)
+	}
+	return nil
+}
+
+// purgeKeys deletes every key matching the patterns
+func purgeKeys(ctx context.Context, client *redis.Client, patterns ...string) (int64, error) {
+	var purged int64
+	for _, pattern := range patterns {
+		err := scanKeys(ctx, client, pattern, func(keys []string) error {
+			n, err := client.Unlink(ctx, keys...).Result()
+			if err != nil {
+				return fmt.Errorf("failed to delete cache entries: %w", err)
+			}
+			purged += n
+			return nil
+		})
+		if err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// keyStats counts the keys matching pattern and sums their memory usage
+func keyStats(ctx context.Context, client *redis.Client, pattern string) (entries int64, memory int64, err error) {
+	err = scanKeys(ctx, client, pattern, func(keys []string) error {
+		entries += int64(len(keys))
+
+		pipe := client.Pipeline()
+		usage := make([]*redis.IntCmd, len(keys))
+		for i, key := range keys {
+			usage[i] = pipe.MemoryUsage(ctx, key)
+		}
+		// Keys can expire between SCAN and MEMORY USAGE; count what is left
+		_, _ = pipe.Exec(ctx)
+		for _, cmd := range usage {
+			memory += cmd.Val()
+		}
+		return nil
+	})
+	return entries, memory, err
+}
@@ -0,0 +1,36 @@
+package cache
+
+import (
+	"fmt"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Response cache backends, selected with cache.backend
+const (
+	BackendRedis     = "redis"
+	BackendMemory    = "memory"
+	BackendMemcached = "memcached"
+	BackendDynamoDB  = "dynamodb"
+)
+
+// NewBackend returns the response cache cache.backend selects: Redis unless
+// set otherwise. Responses are kept for redis.cache_ttl, or their own TTL.
+func NewBackend(cfg *config.Config, redisCache *RedisCache) (models.ManagedCacheStore, error) {
+	switch cfg.Cache.Backend {
+	case "", BackendRedis:
+		return redisCache, nil
+	case BackendMemory:
+		return NewMemoryCache(nil, config.MemoryCacheConfig{
+			MaxEntries: cfg.MemoryCache.MaxEntries,
+			TTL:        cfg.Redis.CacheTTL,
+		}), nil
+	case BackendMemcached:
+		return NewMemcachedCache(cfg.Cache.Memcached, cfg.Redis.CacheTTL)
+	case BackendDynamoDB:
+		return NewDynamoDBCache(cfg.Cache.DynamoDB, cfg.Redis.CacheTTL)
+	default:
+		return nil, fmt.Errorf("unknown cache.backend %q, expected \"redis\", \"memory\", \"memcached\" or \"dynamodb\"", cfg.Cache.Backend)
+	}
+}
@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Built-in consistency profiles
+const (
+	ProfileCostSaver      = "cost-saver"      // Keeps answers 4x longer, matches looser and serves them stale for a day
+	ProfileBalanced       = "balanced"        // The global settings, serving answers stale for 5 minutes
+	ProfileFreshnessFirst = "freshness-first" // Keeps answers a quarter as long, matches strictly, never serves them stale
+)
+
+var builtinProfiles = map[string]config.ConsistencyProfileConfig{
+	ProfileCostSaver:      {TTLScale: 4, SimilarityThreshold: 0.8, StaleWhileRevalidate: 24 * time.Hour},
+	ProfileBalanced:       {TTLScale: 1, StaleWhileRevalidate: 5 * time.Minute},
+	ProfileFreshnessFirst: {TTLScale: 0.25, SimilarityThreshold: 0.95},
+}
+
+// Freshness of a cached answer for a profile
+type Freshness int
+
+const (
+	Fresh   Freshness = iota
+	Stale             // Servable while a new answer is generated
+	Expired           // A miss
+)
+
+// ConsistencyProfile adjusts how long cached answers are served, and how
+// similar semantic matches must be, for the users it applies to
+type ConsistencyProfile struct {
+	Name string
+	config.ConsistencyProfileConfig
+	defaultTTL time.Duration
+}
+
+// Freshness tells whether the cached response is fresh, stale or expired at now
+func (p *ConsistencyProfile) Freshness(response *models.InferenceResponse, now time.Time) Freshness {
+	if p == nil {
+		return Fresh
+	}
+	ttl := response.FreshTTL(p.defaultTTL)
+	if ttl <= 0 || response.Timestamp.IsZero() {
+		return Fresh
+	}
+
+	age := now.Sub(response.Timestamp)
+	fresh := time.Duration(float64(ttl) * p.TTLScale)
+	switch {
+	case age < fresh:
+		return Fresh
+	case age < fresh+p.StaleWhileRevalidate:
+		return Stale
+	default:
+		return Expired
+	}
+}
+
+// Threshold returns the profile's semantic cache threshold, or
+// threshold if it keeps the global one
+func (p *ConsistencyProfile) Threshold(threshold float64) float64 {
+	if p == nil || p.SimilarityThreshold <= 0 {
+		return threshold
+	}
+	return p.SimilarityThreshold
+}
+
+// Consistency picks each user's consistency profile from their org
+type Consistency struct {
+	profiles       map[string]*ConsistencyProfile
+	orgs           map[string]*ConsistencyProfile
+	defaultProfile *ConsistencyProfile // Users of no listed org; the global settings when unset
+	resolveOrg     func(ctx context.Context, userID string) string
+}
+
+// NewConsistency returns the consistency profiles of cfg, or nil if no org
+// has one. Cached answers stay fresh for defaultTTL unless they set their own.
+func NewConsistency(cfg config.ConsistencyConfig, defaultTTL time.Duration) (*Consistency, error) {
+	if cfg.Default == "" && len(cfg.Rules) == 0 {
+		return nil, nil
+	}
+
+	c := &Consistency{
+		profiles: make(map[string]*ConsistencyProfile),
+		orgs:     make(map[string]*ConsistencyProfile),
+		// Everyone else keeps answers for the TTL, but no longer
+		defaultProfile: &ConsistencyProfile{
+			ConsistencyProfileConfig: config.ConsistencyProfileConfig{TTLScale: 1},
+			defaultTTL:               defaultTTL,
+		},
+	}
+	for name, profile := range builtinProfiles {
+		c.profiles[name] = &ConsistencyProfile{Name: name, ConsistencyProfileConfig: profile, defaultTTL: defaultTTL}
+	}
+	for name, profile := range cfg.Profiles {
+		if profile.TTLScale < 0 || profile.StaleWhileRevalidate < 0 || profile.SimilarityThreshold > 1 {
+			return nil, fmt.Errorf("invalid consistency profile %q", name)
+		}
+		if profile.TTLScale == 0 {
+			profile.TTLScale = 1
+		}
+		c.profiles[name] = &ConsistencyProfile{Name: name, ConsistencyProfileConfig: profile, defaultTTL: defaultTTL}
+	}
+
+	if cfg.Default != "" {
+		profile, ok := c.profiles[cfg.Default]
+		if !ok {
+			return nil, fmt.Errorf("unknown consistency profile %q", cfg.Default)
+		}
+		c.defaultProfile = profile
+	}
+	for _, rule := range cfg.Rules {
+		profile, ok := c.profiles[rule.Profile]
+		if !ok {
+			return nil, fmt.Errorf("unknown consistency profile %q", rule.Profile)
+		}
+		for _, org := range rule.Orgs {
+			// The first rule listing an org applies
+			if _, ok := c.orgs[org]; !ok {
+				c.orgs[org] = profile
+			}
+		}
+	}
+	return c, nil
+}
+
+// SetOrgResolver enables the per-org rules; without it every user gets the
+// default profile
+func (c *Consistency) SetOrgResolver(resolver func(ctx context.Context, userID string) string) {
+	c.resolveOrg = resolver
+}
+
+// Profile returns the user's profile. A nil Consistency returns nil, which
+// treats every cached answer as fresh.
+func (c *Consistency) Profile(ctx context.Context, userID string) *ConsistencyProfile {
+	if c == nil {
+		return nil
+	}
+	if c.resolveOrg != nil && userID != "" {
+		if profile, ok := c.orgs[c.resolveOrg(ctx, userID)]; ok {
+			return profile
+		}
+	}
+	return c.defaultProfile
+}
+
+// Retention is how long caches must keep the response past its TTL for
+// every profile in use to serve it as long as it allows
+func (c *Consistency) Retention(response *models.InferenceResponse) time.Duration {
+	if c == nil {
+		return 0
+	}
+	var retention time.Duration
+	for _, profile := range c.inUse() {
+		ttl := response.FreshTTL(profile.defaultTTL)
+		if ttl <= 0 {
+			return 0
+		}
+		kept := time.Duration(float64(ttl)*profile.TTLScale) + profile.StaleWhileRevalidate - ttl
+		retention = max(retention, kept)
+	}
+	return retention
+}
+
+func (c *Consistency) inUse() []*ConsistencyProfile {
+	profiles := []*ConsistencyProfile{c.defaultProfile}
+	for _, profile := range c.orgs {
+		profiles = append(profiles, profile)
+	}
+	return profiles
+}
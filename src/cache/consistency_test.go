@@ -0,0 +1,66 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestConsistency(t *testing.T) {
+	consistency, err := NewConsistency(config.ConsistencyConfig{}, time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, consistency, "no profiles without rules or a default")
+	assert.Nil(t, consistency.Profile(context.Background(), "alice"))
+	assert.Zero(t, consistency.Retention(&models.InferenceResponse{}))
+
+	_, err = NewConsistency(config.ConsistencyConfig{Default: "thrifty"}, time.Hour)
+	assert.ErrorContains(t, err, "unknown consistency profile")
+
+	consistency, err = NewConsistency(config.ConsistencyConfig{
+		Rules: []config.ConsistencyRuleConfig{
+			{Orgs: []string{"thrifty.com"}, Profile: ProfileCostSaver},
+			{Orgs: []string{"news.com"}, Profile: ProfileFreshnessFirst},
+		},
+	}, time.Hour)
+	require.NoError(t, err)
+	orgs := map[string]string{"alice": "thrifty.com", "bob": "news.com"}
+	consistency.SetOrgResolver(func(ctx context.Context, userID string) string { return orgs[userID] })
+	ctx := context.Background()
+
+	now := time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC)
+	answer := func(age time.Duration) *models.InferenceResponse {
+		return &models.InferenceResponse{Timestamp: now.Add(-age)}
+	}
+
+	saver := consistency.Profile(ctx, "alice")
+	assert.Equal(t, ProfileCostSaver, saver.Name)
+	assert.Equal(t, Fresh, saver.Freshness(answer(3*time.Hour), now))
+	assert.Equal(t, Stale, saver.Freshness(answer(5*time.Hour), now))
+	assert.Equal(t, Expired, saver.Freshness(answer(29*time.Hour), now))
+	assert.Equal(t, 0.8, saver.Threshold(0.85))
+
+	fresh := consistency.Profile(ctx, "bob")
+	assert.Equal(t, Fresh, fresh.Freshness(answer(10*time.Minute), now))
+	assert.Equal(t, Expired, fresh.Freshness(answer(20*time.Minute), now))
+	assert.Equal(t, 0.95, fresh.Threshold(0.85))
+
+	// Everyone else gets the global settings, even with answers kept longer
+	global := consistency.Profile(ctx, "carol")
+	assert.Equal(t, Fresh, global.Freshness(answer(59*time.Minute), now))
+	assert.Equal(t, Expired, global.Freshness(answer(61*time.Minute), now))
+	assert.Equal(t, 0.85, global.Threshold(0.85))
+
+	// Answers are kept for the cost savers: 4h fresh then 24h stale
+	assert.Equal(t, 27*time.Hour, consistency.Retention(answer(0)))
+	short := answer(0)
+	short.Expiry = &models.ExpiryHint{Class: models.ExpiryVolatile, TTL: 10 * time.Minute}
+	assert.Equal(t, 24*time.Hour+30*time.Minute, consistency.Retention(short))
+	short.Retention = consistency.Retention(short)
+	assert.Equal(t, 24*time.Hour+40*time.Minute, short.CacheTTL(time.Hour))
+}
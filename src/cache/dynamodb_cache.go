@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/awssig"
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
+)
+
+const (
+	defaultDynamoDBRegion = "us-east-1"
+	dynamoDBTimeout       = 10 * time.Second
+	dynamoDBBatchSize     = 25 // Most deletes per BatchWriteItem
+	dynamoDBRetries       = 5  // Attempts at deletes DynamoDB left unprocessed
+)
+
+// DynamoDBCache caches responses in a DynamoDB table, one item per response
+// keyed by "key". Items carry their expiry in "expires_at" for DynamoDB's TTL
+// to delete them; until it does, which can take a while, expired items are
+// treated as missing.
+type DynamoDBCache struct {
+	table    string
+	endpoint string
+	signer   awssig.Signer
+	ttl      time.Duration
+	client   *http.Client
+	clock    clock.Clock
+	stats    hitCounter
+}
+
+// dynamoDBItem is a response as stored, in DynamoDB's attribute value format
+type dynamoDBItem struct {
+	Key       dynamoDBString  `json:"key"`
+	Response  *dynamoDBString `json:"response,omitempty"`
+	ExpiresAt *dynamoDBNumber `json:"expires_at,omitempty"`
+}
+
+type dynamoDBString struct {
+	S string `json:"S"`
+}
+
+type dynamoDBNumber struct {
+	N string `json:"N"`
+}
+
+func NewDynamoDBCache(cfg config.DynamoDBConfig, ttl time.Duration) (*DynamoDBCache, error) {
+	if cfg.Table == "" {
+		return nil, errors.New("cache.dynamodb.table is empty")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = defaultDynamoDBRegion
+	}
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://dynamodb." + region + ".amazonaws.com"
+	}
+
+	c := &DynamoDBCache{
+		table:    cfg.Table,
+		endpoint: endpoint,
+		signer: awssig.Signer{
+			AccessKey: cfg.AccessKeyID,
+			SecretKey: cfg.SecretAccessKey,
+			Region:    region,
+			Service:   "dynamodb",
+		},
+		ttl:    ttl,
+		client: &http.Client{Timeout: dynamoDBTimeout},
+		clock:  clock.Real(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := c.Stats(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// SetClock sets the clock items expire by
+func (c *DynamoDBCache) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+func (c *DynamoDBCache) Get(ctx context.Context, key string) (response *models.InferenceResponse, err error) {
+	ctx, span := startSpan(ctx, "cache.Get", "dynamodb")
+	defer func() { endSpan(span, response != nil, err) }()
+
+	var out struct {
+		Item *dynamoDBItem `json:"Item"`
+	}
+	err = c.call(ctx, "GetItem", map[string]any{
+		"TableName": c.table,
+		"Key":       dynamoDBItem{Key: dynamoDBString{key}},
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	if out.Item == nil || out.Item.Response == nil || c.expired(out.Item) {
+		c.stats.record(false)
+		return nil, nil
+	}
+	c.stats.record(true)
+
+	if err := json.Unmarshal([]byte(out.Item.Response.S), &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *DynamoDBCache) Set(ctx context.Context, key string, response *models.InferenceResponse) (err error) {
+	ctx, span := startSpan(ctx, "cache.Set", "dynamodb")
+	defer func() { tracing.End(span, err) }()
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := c.clock.Now().Add(response.CacheTTL(c.ttl)).Unix()
+	return c.call(ctx, "PutItem", map[string]any{
+		"TableName": c.table,
+		"Item": dynamoDBItem{
+			Key:       dynamoDBString{key},
+			Response:  &dynamoDBString{string(data)},
+			ExpiresAt: &dynamoDBNumber{strconv.FormatInt(expiresAt, 10)},
+		},
+	}, nil)
+}
+
+func (c *DynamoDBCache) Delete(ctx context.Context, key string) error {
+	return c.call(ctx, "DeleteItem", map[string]any{
+		"TableName": c.table,
+		"Key":       dynamoDBItem{Key: dynamoDBString{key}},
+	}, nil)
+}
+
+// Purge deletes every item of the table, a page of keys at a time
+func (c *DynamoDBCache) Purge(ctx context.Context) (int64, error) {
+	var purged int64
+	var startKey *dynamoDBItem
+	for {
+		request := map[string]any{
+			"TableName":                c.table,
+			"ProjectionExpression":     "#k",
+			"ExpressionAttributeNames": map[string]string{"#k": "key"},
+		}
+		if startKey != nil {
+			request["ExclusiveStartKey"] = startKey
+		}
+		var page struct {
+			Items            []dynamoDBItem `json:"Items"`
+			LastEvaluatedKey *dynamoDBItem  `json:"LastEvaluatedKey"`
+		}
+		if err := c.call(ctx, "Scan", request, &page); err != nil {
+			return purged, err
+		}
+
+		for start := 0; start < len(page.Items); start += dynamoDBBatchSize {
+			batch := page.Items[start:min(start+dynamoDBBatchSize, len(page.Items))]
+			if err := c.deleteBatch(ctx, batch); err != nil {
+				return purged, err
+			}
+			purged += int64(len(batch))
+		}
+
+		if page.LastEvaluatedKey == nil {
+			return purged, nil
+		}
+		startKey = page.LastEvaluatedKey
+	}
+}
+
+// deleteBatch deletes up to 25 items, retrying those DynamoDB left
+// unprocessed under load
+func (c *DynamoDBCache) deleteBatch(ctx context.Context, items []dynamoDBItem) error {
+	requests := make([]any, len(items))
+	for i, item := range items {
+		requests[i] = map[string]any{"DeleteRequest": map[string]any{"Key": dynamoDBItem{Key: item.Key}}}
+	}
+
+	pending := map[string][]any{c.table: requests}
+	for attempt := 1; len(pending[c.table]) > 0; attempt++ {
+		if attempt > dynamoDBRetries {
+			return fmt.Errorf("failed to delete cache entries: %d left unprocessed", len(pending[c.table]))
+		}
+		if attempt > 1 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			}
+		}
+
+		var out struct {
+			UnprocessedItems map[string][]any `json:"UnprocessedItems"`
+		}
+		if err := c.call(ctx, "BatchWriteItem", map[string]any{"RequestItems": pending}, &out); err != nil {
+			return err
+		}
+		pending = out.UnprocessedItems
+	}
+	return nil
+}
+
+// Stats reports the table's items and size, which DynamoDB updates about
+// every six hours, and the hit ratio of this instance's lookups
+func (c *DynamoDBCache) Stats(ctx context.Context) (*models.CacheStats, error) {
+	var out struct {
+		Table struct {
+			ItemCount      int64 `json:"ItemCount"`
+			TableSizeBytes int64 `json:"TableSizeBytes"`
+		} `json:"Table"`
+	}
+	if err := c.call(ctx, "DescribeTable", map[string]any{"TableName": c.table}, &out); err != nil {
+		return nil, err
+	}
+
+	stats := &models.CacheStats{Entries: out.Table.ItemCount, MemoryBytes: out.Table.TableSizeBytes}
+	c.stats.fill(stats)
+	return stats, nil
+}
+
+func (c *DynamoDBCache) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+func (c *DynamoDBCache) expired(item *dynamoDBItem) bool {
+	if item.ExpiresAt == nil {
+		return false
+	}
+	expiresAt, err := strconv.ParseInt(item.ExpiresAt.N, 10, 64)
+	return err == nil && expiresAt <= c.clock.Now().Unix()
+}
+
+// call sends a DynamoDB API request and decodes its answer into out, unless nil
+func (c *DynamoDBCache) call(ctx context.Context, operation string, request any, out any) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create DynamoDB request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "DynamoDB_20120810."+operation)
+	c.signer.Sign(req, body, c.clock.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("DynamoDB %s failed: %w", operation, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("DynamoDB %s failed: %w", operation, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(data, &apiErr)
+		// Types look like "com.amazonaws.dynamodb.v20120810#ResourceNotFoundException"
+		errType := apiErr.Type[strings.LastIndex(apiErr.Type, "#")+1:]
+		return fmt.Errorf("DynamoDB %s failed with %d %s: %s", operation, resp.StatusCode, errType, apiErr.Message)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to decode DynamoDB %s response: %w", operation, err)
+	}
+	return nil
+}
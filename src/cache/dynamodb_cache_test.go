@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// fakeDynamoDB answers the DynamoDB operations DynamoDBCache sends, for one table
+func fakeDynamoDB(t *testing.T, table string) *httptest.Server {
+	var mu sync.Mutex
+	items := make(map[string]json.RawMessage)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/dynamodb/aws4_request")
+
+		var req struct {
+			TableName    string                                  `json:"TableName"`
+			Key          dynamoDBItem                            `json:"Key"`
+			Item         json.RawMessage                         `json:"Item"`
+			RequestItems map[string][]map[string]json.RawMessage `json:"RequestItems"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		if req.TableName != "" && req.TableName != table {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"__type":"com.amazonaws.dynamodb.v20120810#ResourceNotFoundException","message":"Requested resource not found"}`))
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		var out any = map[string]any{}
+		switch strings.TrimPrefix(r.Header.Get("X-Amz-Target"), "DynamoDB_20120810.") {
+		case "GetItem":
+			if item, ok := items[req.Key.Key.S]; ok {
+				out = map[string]any{"Item": item}
+			}
+		case "PutItem":
+			var item dynamoDBItem
+			require.NoError(t, json.Unmarshal(req.Item, &item))
+			items[item.Key.S] = req.Item
+		case "DeleteItem":
+			delete(items, req.Key.Key.S)
+		case "Scan":
+			var keys []dynamoDBItem
+			for key := range items {
+				keys = append(keys, dynamoDBItem{Key: dynamoDBString{key}})
+			}
+			out = map[string]any{"Items": keys}
+		case "BatchWriteItem":
+			for _, request := range req.RequestItems[table] {
+				var deletion struct {
+					Key dynamoDBItem `json:"Key"`
+				}
+				require.NoError(t, json.Unmarshal(request["DeleteRequest"], &deletion))
+				delete(items, deletion.Key.Key.S)
+			}
+		case "DescribeTable":
+			out = map[string]any{"Table": map[string]any{"ItemCount": len(items), "TableSizeBytes": 100 * len(items)}}
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestDynamoDBCache(t *testing.T) {
+	server := fakeDynamoDB(t, "cache")
+	cfg := config.DynamoDBConfig{Table: "cache", Endpoint: server.URL, AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	c, err := NewDynamoDBCache(cfg, time.Hour)
+	require.NoError(t, err)
+	defer c.Close()
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC))
+	c.SetClock(fakeClock)
+	ctx := context.Background()
+
+	cached, err := c.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	require.NoError(t, c.Set(ctx, "inference:a", &models.InferenceResponse{Response: "a"}))
+	require.NoError(t, c.Set(ctx, "inference:b", &models.InferenceResponse{Response: "b"}))
+	cached, err = c.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	require.NotNil(t, cached)
+	assert.Equal(t, "a", cached.Response)
+
+	require.NoError(t, c.Delete(ctx, "inference:a"))
+	cached, err = c.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	// Expired items are missing before DynamoDB's TTL deletes them
+	fakeClock.Advance(time.Hour)
+	cached, err = c.Get(ctx, "inference:b")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	stats, err := c.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), stats.Entries)
+	assert.Equal(t, int64(1), stats.Hits)
+	assert.Equal(t, int64(3), stats.Misses)
+
+	purged, err := c.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	cfg.Table = "missing"
+	_, err = NewDynamoDBCache(cfg, time.Hour)
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
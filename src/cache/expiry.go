@@ -0,0 +1,127 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	ExpiryModeOff       = "off"
+	ExpiryModeHeuristic = "heuristic"
+	ExpiryModeSLM       = "slm"
+
+	expiryInstructions = "Classify how long the answer to the user's question stays correct. Reply with one word: " +
+		"evergreen if it never changes (definitions, history, math, how-tos), " +
+		"volatile if it depends on the current time (news, prices, weather, scores, schedules), " +
+		"or standard otherwise."
+)
+
+var (
+	// Words asking about the present, whose answers go stale quickly
+	volatilePattern = regexp.MustCompile(`\b(today|tonight|tomorrow|yesterday|now|currently|current|latest|recent|recently|news|headlines|price|prices|stock|stocks|weather|forecast|score|scores|schedule|this (week|month|year)|exchange rate)\b`)
+	// Questions about concepts, whose answers don't change
+	evergreenPattern = regexp.MustCompile(`^(what is|what are|what does|define|definition of|explain|how do i|how does|how to|why does|why do|who wrote|who invented|translate|convert)\b`)
+	// Arithmetic like "12 * 7"
+	mathPattern = regexp.MustCompile(`\d\s*[-+*/^]\s*\d`)
+)
+
+// ExpiryEstimator picks how long an answer can be cached from how long it
+// stays valid: evergreen answers are kept longer than the default TTL and
+// volatile ones shorter
+type ExpiryEstimator struct {
+	mode         string
+	slm          models.SLMInferencer // Used in slm mode
+	evergreenTTL time.Duration
+	standardTTL  time.Duration
+	volatileTTL  time.Duration
+}
+
+// NewExpiryEstimator returns an estimator, or nil when cfg.Mode is off.
+// Standard answers keep defaultTTL.
+func NewExpiryEstimator(cfg config.CacheExpiryConfig, defaultTTL time.Duration) (*ExpiryEstimator, error) {
+	switch cfg.Mode {
+	case "", ExpiryModeOff:
+		return nil, nil
+	case ExpiryModeHeuristic, ExpiryModeSLM:
+	default:
+		return nil, fmt.Errorf("unknown cache expiry mode %q", cfg.Mode)
+	}
+
+	return &ExpiryEstimator{
+		mode:         cfg.Mode,
+		evergreenTTL: cfg.EvergreenTTL,
+		standardTTL:  defaultTTL,
+		volatileTTL:  cfg.VolatileTTL,
+	}, nil
+}
+
+// SetSLM sets the model asked for the expiry class in slm mode. Without one,
+// or when it fails, the heuristic is used.
+func (e *ExpiryEstimator) SetSLM(slm models.SLMInferencer) {
+	e.slm = slm
+}
+
+// Estimate returns the expiry hint for the answer to query. A nil estimator
+// returns nil, leaving the cache's default TTL.
+func (e *ExpiryEstimator) Estimate(ctx context.Context, query string, answer string) *models.ExpiryHint {
+	if e == nil {
+		return nil
+	}
+
+	if e.mode == ExpiryModeSLM && e.slm != nil {
+		if class, ok := e.classify(ctx, query, answer); ok {
+			return e.hint(class, ExpiryModeSLM)
+		}
+	}
+	return e.hint(heuristicClass(query), ExpiryModeHeuristic)
+}
+
+// classify asks the SLM for the expiry class
+func (e *ExpiryEstimator) classify(ctx context.Context, query string, answer string) (string, bool) {
+	messages := []models.ChatMessage{
+		{Role: "system", Content: expiryInstructions},
+		{Role: "user", Content: fmt.Sprintf("Question: %s\nAnswer: %s", query, answer)},
+	}
+	result, err := e.slm.InferChat(ctx, messages, models.ChatOptions{MaxTokens: 5})
+	if err != nil {
+		return "", false
+	}
+
+	reply := strings.ToLower(result.Response)
+	for _, class := range []string{models.ExpiryEvergreen, models.ExpiryVolatile, models.ExpiryStandard} {
+		if strings.Contains(reply, class) {
+			return class, true
+		}
+	}
+	return "", false
+}
+
+func (e *ExpiryEstimator) hint(class string, source string) *models.ExpiryHint {
+	ttl := e.standardTTL
+	switch class {
+	case models.ExpiryEvergreen:
+		ttl = e.evergreenTTL
+	case models.ExpiryVolatile:
+		ttl = e.volatileTTL
+	}
+	return &models.ExpiryHint{Class: class, TTL: ttl, Source: source}
+}
+
+// heuristicClass guesses the expiry class from the wording of the query
+func heuristicClass(query string) string {
+	query = strings.ToLower(strings.TrimSpace(query))
+	switch {
+	case volatilePattern.MatchString(query):
+		return models.ExpiryVolatile
+	case evergreenPattern.MatchString(query), mathPattern.MatchString(query):
+		return models.ExpiryEvergreen
+	default:
+		return models.ExpiryStandard
+	}
+}
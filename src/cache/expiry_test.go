@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func newTestEstimator(t *testing.T, mode string) *ExpiryEstimator {
+	estimator, err := NewExpiryEstimator(config.CacheExpiryConfig{
+		Mode:         mode,
+		EvergreenTTL: 168 * time.Hour,
+		VolatileTTL:  10 * time.Minute,
+	}, time.Hour)
+	require.NoError(t, err)
+	require.NotNil(t, estimator)
+	return estimator
+}
+
+func TestExpiryEstimator_Heuristic(t *testing.T) {
+	estimator := newTestEstimator(t, ExpiryModeHeuristic)
+	ctx := context.Background()
+
+	tests := []struct {
+		query string
+		class string
+		ttl   time.Duration
+	}{
+		{"What is a goroutine?", models.ExpiryEvergreen, 168 * time.Hour},
+		{"12 * 7", models.ExpiryEvergreen, 168 * time.Hour},
+		{"What is the weather in Paris today?", models.ExpiryVolatile, 10 * time.Minute},
+		{"Latest news about Go", models.ExpiryVolatile, 10 * time.Minute},
+		{"Write a haiku about autumn", models.ExpiryStandard, time.Hour},
+	}
+	for _, tt := range tests {
+		hint := estimator.Estimate(ctx, tt.query, "answer")
+		require.NotNil(t, hint, tt.query)
+		assert.Equal(t, tt.class, hint.Class, tt.query)
+		assert.Equal(t, tt.ttl, hint.TTL, tt.query)
+		assert.Equal(t, ExpiryModeHeuristic, hint.Source, tt.query)
+	}
+}
+
+func TestExpiryEstimator_SLM(t *testing.T) {
+	estimator := newTestEstimator(t, ExpiryModeSLM)
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetResponder(func(req *models.InferenceRequest) string {
+		return "Volatile."
+	})
+	estimator.SetSLM(slm)
+
+	hint := estimator.Estimate(context.Background(), "Who won the match?", "Team A won 2-1.")
+	require.NotNil(t, hint)
+	assert.Equal(t, models.ExpiryVolatile, hint.Class)
+	assert.Equal(t, 10*time.Minute, hint.TTL)
+	assert.Equal(t, ExpiryModeSLM, hint.Source)
+
+	calls := slm.Calls()
+	require.Len(t, calls, 1)
+	assert.Equal(t, "system", calls[0].Messages[0].Role)
+	assert.Contains(t, calls[0].Query, "Team A won 2-1.")
+}
+
+func TestExpiryEstimator_SLMFallsBackToHeuristic(t *testing.T) {
+	estimator := newTestEstimator(t, ExpiryModeSLM)
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetError(errors.New("slm down"))
+	estimator.SetSLM(slm)
+
+	hint := estimator.Estimate(context.Background(), "What is a goroutine?", "A lightweight thread.")
+	require.NotNil(t, hint)
+	assert.Equal(t, models.ExpiryEvergreen, hint.Class)
+	assert.Equal(t, ExpiryModeHeuristic, hint.Source)
+
+	slm.SetError(nil)
+	slm.SetResponder(func(req *models.InferenceRequest) string {
+		return "I'm not sure"
+	})
+	hint = estimator.Estimate(context.Background(), "What is a goroutine?", "A lightweight thread.")
+	require.NotNil(t, hint)
+	assert.Equal(t, ExpiryModeHeuristic, hint.Source)
+}
+
+func TestExpiryEstimator_Off(t *testing.T) {
+	estimator, err := NewExpiryEstimator(config.CacheExpiryConfig{Mode: ExpiryModeOff}, time.Hour)
+	require.NoError(t, err)
+	assert.Nil(t, estimator)
+	assert.Nil(t, estimator.Estimate(context.Background(), "What is a goroutine?", "answer"))
+
+	_, err = NewExpiryEstimator(config.CacheExpiryConfig{Mode: "forever"}, time.Hour)
+	assert.Error(t, err)
+}
+
+func TestRedisCache_SetUsesExpiryHint(t *testing.T) {
+	cache, mr := setupTestRedis(t)
+	defer mr.Close()
+	defer cache.Close()
+
+	ctx := context.Background()
+	require.NoError(t, cache.Set(ctx, "test:default", &models.InferenceResponse{Response: "default"}))
+	require.NoError(t, cache.Set(ctx, "test:volatile", &models.InferenceResponse{
+		Response: "volatile",
+		Expiry:   &models.ExpiryHint{Class: models.ExpiryVolatile, TTL: 10 * time.Minute},
+	}))
+
+	assert.Equal(t, time.Hour, mr.TTL("test:default"))
+	assert.Equal(t, 10*time.Minute, mr.TTL("test:volatile"))
+}
@@ -0,0 +1,407 @@
+package cache
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const defaultReconnectInterval = 5 * time.Second
+
+// reconcileBatch is how many keys are copied back to the server per round trip
+const reconcileBatch = 100
+
+// connKind is what a connection made through the failover goes to
+type connKind int
+
+const (
+	memoryConn  connKind = iota // The in-memory Redis
+	replicaConn                 // A read replica
+)
+
+// Failover keeps Redis clients working while their server is unreachable by
+// connecting them to an in-memory Redis instead, so the cache, sessions and
+// everything else stored in Redis keep working on this instance. It checks
+// for the server every interval and switches back once it answers, copying
+// what was written in the meantime back to it (see reconcile).
+type Failover struct {
+	primary  *redis.Client // Talks to the server directly, for reconnection checks
+	memory   *miniredis.Miniredis
+	db       int // Database the clients use
+	interval time.Duration
+	maxKeys  int // 0 for no limit
+
+	mu        sync.Mutex
+	degraded  bool
+	since     time.Time // When the current outage started
+	conns     map[net.Conn]connKind
+	listeners []func(degraded bool, err error)
+}
+
+// NewFailover starts the in-memory Redis for a server's clients
+func NewFailover(cfg *config.RedisConfig) (*Failover, error) {
+	memory := miniredis.NewMiniRedis()
+	if cfg.Password != "" {
+		memory.RequireAuth(cfg.Password)
+	}
+	if err := memory.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start in-memory Redis: %w", err)
+	}
+
+	interval := cfg.Fallback.ReconnectInterval
+	if interval <= 0 {
+		interval = defaultReconnectInterval
+	}
+	return &Failover{
+		primary: redis.NewClient(&redis.Options{
+			Addr:       cfg.Address,
+			Password:   cfg.Password,
+			DB:         cfg.DB,
+			MaxRetries: -1,
+		}),
+		memory:   memory,
+		db:       cfg.DB,
+		interval: interval,
+		maxKeys:  cfg.Fallback.MaxKeys,
+		conns:    make(map[net.Conn]connKind),
+	}, nil
+}
+
+// Attach makes the client fall back to the in-memory Redis
+func (f *Failover) Attach(client *redis.Client) {
+	client.AddHook(f)
+}
+
+// AttachReader makes a read replica's client read from the in-memory Redis
+// while the server is unreachable, where writes then go, instead of from a
+// replica that doesn't have them. A replica that is down itself isn't
+// failed over.
+func (f *Failover) AttachReader(client *redis.Client) {
+	client.AddHook(readerHook{f})
+}
+
+// OnChange registers a handler, called when the server becomes unreachable,
+// with the error, and when it's back, with nil
+func (f *Failover) OnChange(fn func(degraded bool, err error)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.listeners = append(f.listeners, fn)
+}
+
+// Degraded reports whether clients are using the in-memory Redis, and since when
+func (f *Failover) Degraded() (bool, time.Time) {
+	if f == nil {
+		return false, time.Time{}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.degraded, f.since
+}
+
+// PingPrimary checks that the server itself answers
+func (f *Failover) PingPrimary(ctx context.Context) error {
+	return f.primary.Ping(ctx).Err()
+}
+
+// Run checks for the server every interval while it's unreachable, and
+// expires and evicts the in-memory Redis' keys, until ctx is done
+func (f *Failover) Run(ctx context.Context) {
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(f.interval):
+		}
+
+		// The in-memory Redis only expires keys when told time has passed
+		now := time.Now()
+		f.memory.FastForward(now.Sub(last))
+		last = now
+
+		if evicted := f.trim(); evicted > 0 {
+			log.Printf("⚠️  In-memory Redis is over redis.fallback.max_keys, evicted %d keys", evicted)
+		}
+
+		if degraded, _ := f.Degraded(); degraded && f.PingPrimary(ctx) == nil {
+			f.recover(ctx)
+		}
+	}
+}
+
+// Close stops the in-memory Redis
+func (f *Failover) Close() error {
+	f.memory.Close()
+	return f.primary.Close()
+}
+
+// DialHook connects to the in-memory Redis while the server is unreachable
+func (f *Failover) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		if degraded, _ := f.Degraded(); !degraded {
+			conn, err := next(ctx, network, addr)
+			if err == nil {
+				return conn, nil
+			}
+			f.fail(err)
+		}
+
+		return f.dialMemory(ctx, next)
+	}
+}
+
+func (f *Failover) dialMemory(ctx context.Context, next redis.DialHook) (net.Conn, error) {
+	conn, err := next(ctx, "tcp", f.memory.Addr())
+	if err != nil {
+		return nil, err
+	}
+	return f.track(conn, memoryConn), nil
+}
+
+func (f *Failover) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (f *Failover) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// fail switches clients to the in-memory Redis, closing the connections of
+// readers to replicas so they reconnect to it too
+func (f *Failover) fail(err error) {
+	f.mu.Lock()
+	if f.degraded {
+		f.mu.Unlock()
+		return
+	}
+	f.degraded, f.since = true, time.Now()
+	replicas := f.untrack(replicaConn)
+	listeners := f.listeners
+	f.mu.Unlock()
+
+	for _, conn := range replicas {
+		conn.Close()
+	}
+
+	log.Printf("⚠️  Redis unreachable, serving from memory until it's back: %v", err)
+	for _, fn := range listeners {
+		fn(true, err)
+	}
+}
+
+// recover switches clients back to the server, closing their connections to
+// the in-memory Redis so they reconnect, and copies what was written there
+// back to the server
+func (f *Failover) recover(ctx context.Context) {
+	f.mu.Lock()
+	since := f.since
+	f.degraded = false
+	conns := f.untrack(memoryConn)
+	listeners := f.listeners
+	f.mu.Unlock()
+
+	for _, conn := range conns {
+		conn.Close()
+	}
+	copied, err := f.reconcile(ctx)
+	if err != nil {
+		log.Printf("⚠️  Failed to copy writes made during the Redis outage back to Redis: %v", err)
+	}
+	f.memory.FlushAll()
+
+	log.Printf("✓ Redis is back after %s, copied %d keys written meanwhile", time.Since(since).Round(time.Second), copied)
+	for _, fn := range listeners {
+		fn(false, nil)
+	}
+}
+
+// reconcile copies the keys in the in-memory Redis, which were all written
+// during the outage, to the server with their TTLs. This instance wrote them
+// last, so strings and hash fields overwrite the server's values; sets and
+// sorted sets are added to the server's, and list items and stream entries
+// appended (stream entries get new IDs). A write made to the server by this
+// instance between switching back and the copy may be overwritten.
+func (f *Failover) reconcile(ctx context.Context) (int, error) {
+	db := f.memory.DB(f.db)
+	keys := db.Keys()
+
+	copied := 0
+	for batch := range slices.Chunk(keys, reconcileBatch) {
+		pipe := f.primary.Pipeline()
+		for _, key := range batch {
+			if !copyKey(ctx, pipe, db, key) {
+				continue
+			}
+			if ttl := db.TTL(key); ttl > 0 {
+				pipe.PExpire(ctx, key, ttl)
+			}
+			copied++
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return copied, err
+		}
+	}
+	return copied, nil
+}
+
+// copyKey queues the commands copying key from db to the server. It returns
+// false for keys that are gone or of a type that isn't copied.
+func copyKey(ctx context.Context, pipe redis.Pipeliner, db *miniredis.RedisDB, key string) bool {
+	switch db.Type(key) {
+	case "string":
+		value, err := db.Get(key)
+		if err != nil {
+			return false
+		}
+		pipe.Set(ctx, key, value, 0)
+	case "hash":
+		fields, err := db.HKeys(key)
+		if err != nil || len(fields) == 0 {
+			return false
+		}
+		values := make([]string, 0, 2*len(fields))
+		for _, field := range fields {
+			values = append(values, field, db.HGet(key, field))
+		}
+		pipe.HSet(ctx, key, values)
+	case "set":
+		members, err := db.Members(key)
+		if err != nil || len(members) == 0 {
+			return false
+		}
+		pipe.SAdd(ctx, key, members)
+	case "zset":
+		scores, err := db.SortedSet(key)
+		if err != nil || len(scores) == 0 {
+			return false
+		}
+		members := make([]redis.Z, 0, len(scores))
+		for member, score := range scores {
+			members = append(members, redis.Z{Score: score, Member: member})
+		}
+		pipe.ZAdd(ctx, key, members...)
+	case "list":
+		items, err := db.List(key)
+		if err != nil || len(items) == 0 {
+			return false
+		}
+		pipe.RPush(ctx, key, items)
+	case "stream":
+		entries, err := db.Stream(key)
+		if err != nil || len(entries) == 0 {
+			return false
+		}
+		for _, entry := range entries {
+			pipe.XAdd(ctx, &redis.XAddArgs{Stream: key, Values: entry.Values})
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// trim evicts keys from the in-memory Redis beyond maxKeys: those expiring
+// soonest first, those without a TTL last. It returns how many it evicted.
+func (f *Failover) trim() int {
+	if f.maxKeys <= 0 {
+		return 0
+	}
+	db := f.memory.DB(f.db)
+	keys := db.Keys()
+	excess := len(keys) - f.maxKeys
+	if excess <= 0 {
+		return 0
+	}
+
+	ttls := make(map[string]time.Duration, len(keys))
+	for _, key := range keys {
+		ttls[key] = db.TTL(key)
+	}
+	slices.SortStableFunc(keys, func(a, b string) int {
+		switch ta, tb := ttls[a], ttls[b]; {
+		case ta == tb:
+			return 0
+		case ta == 0:
+			return 1
+		case tb == 0:
+			return -1
+		default:
+			return cmp.Compare(ta, tb)
+		}
+	})
+	for _, key := range keys[:excess] {
+		db.Del(key)
+	}
+	return excess
+}
+
+func (f *Failover) track(conn net.Conn, kind connKind) net.Conn {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.conns[conn] = kind
+	return &trackedConn{Conn: conn, failover: f}
+}
+
+// untrack forgets the connections of kind and returns them; f.mu must be held
+func (f *Failover) untrack(kind connKind) []net.Conn {
+	var conns []net.Conn
+	for conn, k := range f.conns {
+		if k == kind {
+			conns = append(conns, conn)
+			delete(f.conns, conn)
+		}
+	}
+	return conns
+}
+
+// readerHook connects a read replica's client through the failover
+type readerHook struct {
+	failover *Failover
+}
+
+func (h readerHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		if degraded, _ := h.failover.Degraded(); degraded {
+			return h.failover.dialMemory(ctx, next)
+		}
+		conn, err := next(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		return h.failover.track(conn, replicaConn), nil
+	}
+}
+
+func (h readerHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return next
+}
+
+func (h readerHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+// trackedConn forgets itself when closed
+type trackedConn struct {
+	net.Conn
+	failover *Failover
+}
+
+func (c *trackedConn) Close() error {
+	c.failover.mu.Lock()
+	delete(c.failover.conns, c.Conn)
+	c.failover.mu.Unlock()
+	return c.Conn.Close()
+}
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+func fallbackConfig(addr string) *config.RedisConfig {
+	return &config.RedisConfig{
+		Address:  addr,
+		CacheTTL: time.Hour,
+		Fallback: config.RedisFallbackConfig{Enabled: true, ReconnectInterval: 10 * time.Millisecond},
+	}
+}
+
+func TestFailover_ServesFromMemoryUntilRedisIsBack(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	defer mr.Close()
+
+	redisCache, err := NewRedisCache(fallbackConfig(mr.Addr()))
+	require.NoError(t, err)
+	defer redisCache.Close()
+	client, failover := redisCache.GetClient(), redisCache.Failover()
+
+	changes := make(chan bool, 2)
+	failover.OnChange(func(degraded bool, err error) { changes <- degraded })
+
+	ctx := context.Background()
+	require.NoError(t, client.Set(ctx, "key", "before", 0).Err())
+	require.NoError(t, client.HSet(ctx, "hash", "a", "1", "b", "1").Err())
+	mr.Close()
+
+	// Commands keep working, on the in-memory Redis
+	require.NoError(t, client.Set(ctx, "key", "during", 0).Err())
+	require.NoError(t, client.HSet(ctx, "hash", "b", "2").Err())
+	require.NoError(t, client.Set(ctx, "expiring", "x", time.Hour).Err())
+	require.NoError(t, client.XAdd(ctx, &redis.XAddArgs{Stream: "events", Values: []string{"type", "usage"}}).Err())
+	assert.Equal(t, "during", client.Get(ctx, "key").Val())
+	degraded, _ := failover.Degraded()
+	assert.True(t, degraded)
+	assert.Error(t, failover.PingPrimary(ctx))
+
+	require.NoError(t, mr.Restart())
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go failover.Run(runCtx)
+	assert.True(t, <-changes)
+	select {
+	case degraded := <-changes:
+		assert.False(t, degraded)
+	case <-time.After(time.Second):
+		t.Fatal("failover didn't notice Redis is back")
+	}
+
+	// What was written during the outage is copied back
+	value, err := mr.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "during", value)
+	assert.Equal(t, "1", mr.HGet("hash", "a"), "fields written before the outage are kept")
+	assert.Equal(t, "2", mr.HGet("hash", "b"))
+	assert.InDelta(t, time.Hour, mr.TTL("expiring"), float64(time.Second), "the TTL left is kept")
+	entries, err := mr.Stream("events")
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []string{"type", "usage"}, entries[0].Values)
+	assert.Equal(t, "during", client.Get(ctx, "key").Val())
+}
+
+func TestFailover_ReadersFollowTheFailover(t *testing.T) {
+	mr := miniredis.RunT(t)
+	replica := miniredis.RunT(t)
+	require.NoError(t, replica.Set("key", "replica"))
+
+	cfg := fallbackConfig(mr.Addr())
+	cfg.ReadReplicas = []string{replica.Addr()}
+	redisCache, err := NewRedisCache(cfg)
+	require.NoError(t, err)
+	defer redisCache.Close()
+	reader, err := NewReplicaReader(cfg, redisCache.Failover())
+	require.NoError(t, err)
+	defer reader.Close()
+
+	ctx := context.Background()
+	assert.Equal(t, "replica", reader.Get(ctx, "key").Val())
+
+	// Once the primary is down, reads see what's written meanwhile
+	mr.Close()
+	require.NoError(t, redisCache.GetClient().Set(ctx, "key", "during", 0).Err())
+	assert.Equal(t, "during", reader.Get(ctx, "key").Val())
+}
+
+func TestFailover_EvictsBeyondMaxKeys(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	addr := mr.Addr()
+	mr.Close()
+
+	cfg := fallbackConfig(addr)
+	cfg.Fallback.MaxKeys = 2
+	redisCache, err := NewRedisCache(cfg)
+	require.NoError(t, err)
+	defer redisCache.Close()
+	client, failover := redisCache.GetClient(), redisCache.Failover()
+
+	ctx := context.Background()
+	require.NoError(t, client.Set(ctx, "session", "s", 0).Err())
+	require.NoError(t, client.Set(ctx, "soon", "x", time.Minute).Err())
+	require.NoError(t, client.Set(ctx, "later", "y", time.Hour).Err())
+
+	assert.Equal(t, 1, failover.trim())
+	assert.Equal(t, []string{"later", "session"}, client.Keys(ctx, "*").Val())
+	assert.Zero(t, failover.trim())
+}
+
+func TestFailover_StartsWhileRedisIsDown(t *testing.T) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	addr := mr.Addr()
+	mr.Close()
+
+	_, err = NewRedisCache(&config.RedisConfig{Address: addr})
+	assert.Error(t, err, "without the fallback, Redis must be reachable")
+
+	redisCache, err := NewRedisCache(fallbackConfig(addr))
+	require.NoError(t, err)
+	defer redisCache.Close()
+
+	degraded, since := redisCache.Failover().Degraded()
+	assert.True(t, degraded)
+	assert.False(t, since.IsZero())
+
+	ctx := context.Background()
+	require.NoError(t, redisCache.GetClient().Set(ctx, "key", "value", 0).Err())
+	assert.Equal(t, "value", redisCache.GetClient().Get(ctx, "key").Val())
+}
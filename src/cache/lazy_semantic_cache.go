@@ -0,0 +1,196 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const semanticCacheRetryInterval = 30 * time.Second
+
+// ErrSemanticCacheUnavailable is returned while the semantic cache can't be initialized
+var ErrSemanticCacheUnavailable = errors.New("semantic cache unavailable")
+
+// LazySemanticCache connects the semantic cache on first use instead of at
+// startup, so a slow or missing dependency doesn't hold up the server. While
+// it is unavailable every call fails fast (callers treat that as a cache miss)
+// and initialization is retried at most once per retry interval.
+type LazySemanticCache struct {
+	connect       func() (models.SemanticCacheStore, error)
+	embedder      models.Embedder
+	failover      *Failover
+	onStatus      func(err error)
+	retryInterval time.Duration
+
+	mu          sync.Mutex
+	cache       models.SemanticCacheStore
+	connecting  bool
+	lastAttempt time.Time
+	lastErr     error
+	clock       clock.Clock
+}
+
+func NewLazySemanticCache(redisCfg *config.RedisConfig, semanticCfg *config.SemanticCacheConfig) *LazySemanticCache {
+	l := &LazySemanticCache{
+		retryInterval: semanticCacheRetryInterval,
+		clock:         clock.Real(),
+	}
+	l.connect = func() (models.SemanticCacheStore, error) {
+		sc, err := NewSemanticCache(redisCfg, semanticCfg, l.failover)
+		if err != nil {
+			return nil, err
+		}
+		if l.embedder != nil {
+			sc.SetEmbedder(l.embedder)
+		}
+		return sc, nil
+	}
+	return l
+}
+
+// SetEmbedder replaces the embeddings used once the cache connects
+func (l *LazySemanticCache) SetEmbedder(embedder models.Embedder) {
+	l.embedder = embedder
+}
+
+// SetFailover makes the cache, once it connects, fall back to the in-memory
+// Redis of failover while Redis is unreachable
+func (l *LazySemanticCache) SetFailover(failover *Failover) {
+	l.failover = failover
+}
+
+// SetClock sets the clock that paces reconnection attempts
+func (l *LazySemanticCache) SetClock(c clock.Clock) {
+	l.clock = c
+}
+
+// OnStatus registers a callback run after every initialization attempt, with
+// nil on success
+func (l *LazySemanticCache) OnStatus(fn func(err error)) {
+	l.onStatus = fn
+}
+
+func (l *LazySemanticCache) get() (models.SemanticCacheStore, error) {
+	l.mu.Lock()
+	if l.cache != nil {
+		defer l.mu.Unlock()
+		return l.cache, nil
+	}
+	// Someone else is connecting, or the last attempt failed recently
+	if l.connecting || (!l.lastAttempt.IsZero() && l.clock.Now().Sub(l.lastAttempt) < l.retryInterval) {
+		err := l.lastErr
+		l.mu.Unlock()
+		if err == nil {
+			return nil, ErrSemanticCacheUnavailable
+		}
+		return nil, fmt.Errorf("%w: %v", ErrSemanticCacheUnavailable, err)
+	}
+	l.connecting = true
+	l.mu.Unlock()
+
+	cache, err := l.connect()
+
+	l.mu.Lock()
+	l.connecting = false
+	l.lastAttempt = l.clock.Now()
+	l.lastErr = err
+	if err == nil {
+		l.cache = cache
+	}
+	l.mu.Unlock()
+
+	if l.onStatus != nil {
+		l.onStatus(err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrSemanticCacheUnavailable, err)
+	}
+	return cache, nil
+}
+
+func (l *LazySemanticCache) Get(ctx context.Context, key string) (*models.InferenceResponse, error) {
+	cache, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return cache.Get(ctx, key)
+}
+
+func (l *LazySemanticCache) Set(ctx context.Context, key string, response *models.InferenceResponse) error {
+	cache, err := l.get()
+	if err != nil {
+		return err
+	}
+	return cache.Set(ctx, key, response)
+}
+
+func (l *LazySemanticCache) Delete(ctx context.Context, key string) error {
+	cache, err := l.get()
+	if err != nil {
+		return err
+	}
+	return cache.Delete(ctx, key)
+}
+
+// Purge deletes every entry of the underlying cache
+func (l *LazySemanticCache) Purge(ctx context.Context) (int64, error) {
+	cache, err := l.managed()
+	if err != nil {
+		return 0, err
+	}
+	return cache.Purge(ctx)
+}
+
+// Stats reports on the underlying cache
+func (l *LazySemanticCache) Stats(ctx context.Context) (*models.CacheStats, error) {
+	cache, err := l.managed()
+	if err != nil {
+		return nil, err
+	}
+	return cache.Stats(ctx)
+}
+
+func (l *LazySemanticCache) managed() (models.ManagedCacheStore, error) {
+	cache, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	managed, ok := cache.(models.ManagedCacheStore)
+	if !ok {
+		return nil, fmt.Errorf("semantic cache does not support administration")
+	}
+	return managed, nil
+}
+
+// Close closes the underlying cache if it was ever connected
+func (l *LazySemanticCache) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.cache == nil {
+		return nil
+	}
+	return l.cache.Close()
+}
+
+func (l *LazySemanticCache) GetSimilar(ctx context.Context, query string, threshold float64) (*models.SemanticCacheResult, error) {
+	cache, err := l.get()
+	if err != nil {
+		return nil, err
+	}
+	return cache.GetSimilar(ctx, query, threshold)
+}
+
+func (l *LazySemanticCache) SetWithEmbedding(ctx context.Context, key string, query string, response *models.InferenceResponse) error {
+	cache, err := l.get()
+	if err != nil {
+		return err
+	}
+	return cache.SetWithEmbedding(ctx, key, query, response)
+}
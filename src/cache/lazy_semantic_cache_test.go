@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestLazySemanticCache_ConnectsOnFirstUseAndRetries(t *testing.T) {
+	mr := miniredis.RunT(t)
+	redisCfg := &config.RedisConfig{Address: mr.Addr(), CacheTTL: time.Hour}
+	semanticCfg := &config.SemanticCacheConfig{Enabled: true, APIKey: "test-key", Backend: "scan"}
+
+	fakeClock := clock.NewFake(time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC))
+	lazy := NewLazySemanticCache(redisCfg, semanticCfg)
+	lazy.SetClock(fakeClock)
+
+	attempts := 0
+	connect := lazy.connect
+	lazy.connect = func() (models.SemanticCacheStore, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, errors.New("redis not ready")
+		}
+		return connect()
+	}
+
+	var statuses []error
+	lazy.OnStatus(func(err error) { statuses = append(statuses, err) })
+	assert.Equal(t, 0, attempts, "nothing connects at construction")
+
+	ctx := context.Background()
+	_, err := lazy.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrSemanticCacheUnavailable)
+
+	// Within the retry interval calls fail fast without reconnecting
+	_, err = lazy.Get(ctx, "key")
+	assert.ErrorIs(t, err, ErrSemanticCacheUnavailable)
+	assert.Equal(t, 1, attempts)
+
+	fakeClock.Advance(semanticCacheRetryInterval)
+	require.NoError(t, lazy.Set(ctx, "key", &models.InferenceResponse{Response: "cached"}))
+	cached, err := lazy.Get(ctx, "key")
+	require.NoError(t, err)
+	assert.Equal(t, "cached", cached.Response)
+	assert.Equal(t, 2, attempts)
+
+	require.Len(t, statuses, 2)
+	assert.Error(t, statuses[0])
+	assert.NoError(t, statuses[1])
+	assert.NoError(t, lazy.Close())
+}
@@ -0,0 +1,357 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
+)
+
+const (
+	defaultMemcachedTimeout = time.Second
+	memcachedIdleConns      = 16                  // Idle connections kept per server
+	memcachedMaxKey         = 250                 // Longest key Memcached accepts
+	memcachedRelativeTTL    = 30 * 24 * time.Hour // Longer expirations must be sent as Unix times
+)
+
+// MemcachedCache caches responses in Memcached, spreading keys across the
+// servers by hash. It speaks the text protocol, which every Memcached
+// version and most compatible servers support.
+//
+// Memcached can't list keys, so Purge flushes the servers and Stats counts
+// everything they hold: give the cache servers of its own.
+type MemcachedCache struct {
+	servers []*memcachedServer
+	ttl     time.Duration
+	stats   hitCounter
+}
+
+func NewMemcachedCache(cfg config.MemcachedConfig, ttl time.Duration) (*MemcachedCache, error) {
+	if len(cfg.Servers) == 0 {
+		return nil, errors.New("cache.memcached.servers is empty")
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultMemcachedTimeout
+	}
+
+	c := &MemcachedCache{ttl: ttl}
+	for _, addr := range cfg.Servers {
+		c.servers = append(c.servers, &memcachedServer{
+			addr:    addr,
+			timeout: timeout,
+			idle:    make(chan *memcachedConn, memcachedIdleConns),
+		})
+	}
+
+	// Check every server answers before serving from them
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, server := range c.servers {
+		if _, err := server.stats(ctx); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (c *MemcachedCache) Get(ctx context.Context, key string) (response *models.InferenceResponse, err error) {
+	ctx, span := startSpan(ctx, "cache.Get", "memcached")
+	defer func() { endSpan(span, response != nil, err) }()
+
+	key = memcachedKey(key)
+	data, err := c.server(key).get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		c.stats.record(false)
+		return nil, nil
+	}
+	c.stats.record(true)
+
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func (c *MemcachedCache) Set(ctx context.Context, key string, response *models.InferenceResponse) (err error) {
+	ctx, span := startSpan(ctx, "cache.Set", "memcached")
+	defer func() { tracing.End(span, err) }()
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+
+	key = memcachedKey(key)
+	return c.server(key).set(ctx, key, data, expiration(response.CacheTTL(c.ttl), time.Now()))
+}
+
+func (c *MemcachedCache) Delete(ctx context.Context, key string) error {
+	key = memcachedKey(key)
+	return c.server(key).delete(ctx, key)
+}
+
+// Purge flushes every server, returning how many items they held
+func (c *MemcachedCache) Purge(ctx context.Context) (int64, error) {
+	var purged int64
+	for _, server := range c.servers {
+		stats, err := server.stats(ctx)
+		if err != nil {
+			return purged, err
+		}
+		if err := server.flush(ctx); err != nil {
+			return purged, err
+		}
+		purged += stats["curr_items"]
+	}
+	return purged, nil
+}
+
+// Stats reports the items and bytes the servers hold and the hit ratio of
+// this instance's lookups
+func (c *MemcachedCache) Stats(ctx context.Context) (*models.CacheStats, error) {
+	stats := &models.CacheStats{}
+	for _, server := range c.servers {
+		serverStats, err := server.stats(ctx)
+		if err != nil {
+			return nil, err
+		}
+		stats.Entries += serverStats["curr_items"]
+		stats.MemoryBytes += serverStats["bytes"]
+	}
+	c.stats.fill(stats)
+	return stats, nil
+}
+
+func (c *MemcachedCache) Close() error {
+	for _, server := range c.servers {
+		server.close()
+	}
+	return nil
+}
+
+func (c *MemcachedCache) server(key string) *memcachedServer {
+	return c.servers[crc32.ChecksumIEEE([]byte(key))%uint32(len(c.servers))]
+}
+
+// memcachedKey returns key if Memcached accepts it, and a hash of it otherwise
+func memcachedKey(key string) string {
+	if len(key) <= memcachedMaxKey && !strings.ContainsFunc(key, func(r rune) bool { return r <= ' ' || r == 0x7f }) {
+		return key
+	}
+	sum := sha256.Sum256([]byte(key))
+	return "inference:sha256:" + hex.EncodeToString(sum[:])
+}
+
+// expiration is the exptime Memcached expects for ttl: seconds up to 30
+// days, a Unix time beyond
+func expiration(ttl time.Duration, now time.Time) int64 {
+	if ttl <= 0 {
+		return 0
+	}
+	seconds := int64((ttl + time.Second - 1) / time.Second)
+	if ttl > memcachedRelativeTTL {
+		return now.Unix() + seconds
+	}
+	return seconds
+}
+
+// memcachedServer is one server and a pool of idle connections to it
+type memcachedServer struct {
+	addr    string
+	timeout time.Duration
+	idle    chan *memcachedConn
+}
+
+type memcachedConn struct {
+	net.Conn
+	rw *bufio.ReadWriter
+}
+
+var errMemcachedReply = errors.New("unexpected memcached reply")
+
+func (s *memcachedServer) get(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := s.do(ctx, func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "get %s\r\n", key)
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readLine(rw)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// VALUE <key> <flags> <bytes>
+			fields := strings.Fields(line)
+			if len(fields) < 4 || fields[0] != "VALUE" {
+				return fmt.Errorf("%w: %q", errMemcachedReply, line)
+			}
+			size, err := strconv.Atoi(fields[3])
+			if err != nil {
+				return fmt.Errorf("%w: %q", errMemcachedReply, line)
+			}
+			data = make([]byte, size+2)
+			if _, err := io.ReadFull(rw, data); err != nil {
+				return err
+			}
+			data = data[:size]
+		}
+	})
+	return data, err
+}
+
+func (s *memcachedServer) set(ctx context.Context, key string, data []byte, exptime int64) error {
+	return s.do(ctx, func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "set %s 0 %d %d\r\n", key, exptime, len(data))
+		rw.Write(data)
+		rw.WriteString("\r\n")
+		return expectReply(rw, "STORED")
+	})
+}
+
+func (s *memcachedServer) delete(ctx context.Context, key string) error {
+	return s.do(ctx, func(rw *bufio.ReadWriter) error {
+		fmt.Fprintf(rw, "delete %s\r\n", key)
+		return expectReply(rw, "DELETED", "NOT_FOUND")
+	})
+}
+
+func (s *memcachedServer) flush(ctx context.Context) error {
+	return s.do(ctx, func(rw *bufio.ReadWriter) error {
+		rw.WriteString("flush_all\r\n")
+		return expectReply(rw, "OK")
+	})
+}
+
+// stats returns the server's numeric stats
+func (s *memcachedServer) stats(ctx context.Context) (map[string]int64, error) {
+	stats := make(map[string]int64)
+	err := s.do(ctx, func(rw *bufio.ReadWriter) error {
+		rw.WriteString("stats\r\n")
+		if err := rw.Flush(); err != nil {
+			return err
+		}
+		for {
+			line, err := readLine(rw)
+			if err != nil {
+				return err
+			}
+			if line == "END" {
+				return nil
+			}
+			// STAT <name> <value>
+			fields := strings.Fields(line)
+			if len(fields) < 3 || fields[0] != "STAT" {
+				return fmt.Errorf("%w: %q", errMemcachedReply, line)
+			}
+			if value, err := strconv.ParseInt(fields[2], 10, 64); err == nil {
+				stats[fields[1]] = value
+			}
+		}
+	})
+	return stats, err
+}
+
+// do runs a command on an idle connection, or a new one. Connections are
+// only reused after commands that succeeded, as others may have left a
+// reply unread.
+func (s *memcachedServer) do(ctx context.Context, command func(rw *bufio.ReadWriter) error) error {
+	conn, err := s.conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(s.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	conn.SetDeadline(deadline)
+
+	if err := command(conn.rw); err != nil {
+		conn.Close()
+		return fmt.Errorf("memcached %s: %w", s.addr, err)
+	}
+
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+	return nil
+}
+
+func (s *memcachedServer) conn(ctx context.Context) (*memcachedConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to memcached %s: %w", s.addr, err)
+	}
+	return &memcachedConn{
+		Conn: conn,
+		rw:   bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)),
+	}, nil
+}
+
+func (s *memcachedServer) close() {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func readLine(rw *bufio.ReadWriter) (string, error) {
+	line, err := rw.ReadSlice('\n')
+	if err != nil {
+		return "", err
+	}
+	return string(bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))), nil
+}
+
+// expectReply sends the buffered command and checks its reply is one of replies
+func expectReply(rw *bufio.ReadWriter, replies ...string) error {
+	if err := rw.Flush(); err != nil {
+		return err
+	}
+	line, err := readLine(rw)
+	if err != nil {
+		return err
+	}
+	for _, reply := range replies {
+		if line == reply {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", errMemcachedReply, line)
+}
@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// fakeMemcached answers the text protocol commands MemcachedCache sends
+type fakeMemcached struct {
+	listener net.Listener
+	mu       sync.Mutex
+	items    map[string]string
+}
+
+func startFakeMemcached(t *testing.T) *fakeMemcached {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := &fakeMemcached{listener: listener, items: make(map[string]string)}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (s *fakeMemcached) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+func (s *fakeMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+
+		s.mu.Lock()
+		switch fields[0] {
+		case "get":
+			if value, ok := s.items[fields[1]]; ok {
+				fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\n", fields[1], len(value), value)
+			}
+			fmt.Fprint(conn, "END\r\n")
+		case "set":
+			size, _ := strconv.Atoi(fields[4])
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			s.items[fields[1]] = string(data[:size])
+			fmt.Fprint(conn, "STORED\r\n")
+		case "delete":
+			if _, ok := s.items[fields[1]]; ok {
+				delete(s.items, fields[1])
+				fmt.Fprint(conn, "DELETED\r\n")
+			} else {
+				fmt.Fprint(conn, "NOT_FOUND\r\n")
+			}
+		case "flush_all":
+			s.items = make(map[string]string)
+			fmt.Fprint(conn, "OK\r\n")
+		case "stats":
+			bytes := 0
+			for _, value := range s.items {
+				bytes += len(value)
+			}
+			fmt.Fprintf(conn, "STAT version 1.6.21\r\nSTAT curr_items %d\r\nSTAT bytes %d\r\nEND\r\n", len(s.items), bytes)
+		default:
+			fmt.Fprint(conn, "ERROR\r\n")
+		}
+		s.mu.Unlock()
+	}
+}
+
+func TestMemcachedCache(t *testing.T) {
+	servers := []*fakeMemcached{startFakeMemcached(t), startFakeMemcached(t)}
+	c, err := NewMemcachedCache(config.MemcachedConfig{
+		Servers: []string{servers[0].listener.Addr().String(), servers[1].listener.Addr().String()},
+	}, time.Hour)
+	require.NoError(t, err)
+	defer c.Close()
+	ctx := context.Background()
+
+	cached, err := c.Get(ctx, "inference:missing")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	for i := range 10 {
+		key := fmt.Sprintf("inference:%d", i)
+		require.NoError(t, c.Set(ctx, key, &models.InferenceResponse{Response: key}))
+	}
+	assert.Positive(t, servers[0].len(), "keys are spread across servers")
+	assert.Positive(t, servers[1].len(), "keys are spread across servers")
+
+	cached, err = c.Get(ctx, "inference:3")
+	require.NoError(t, err)
+	require.NotNil(t, cached)
+	assert.Equal(t, "inference:3", cached.Response)
+
+	// Keys Memcached would refuse are hashed
+	require.NoError(t, c.Set(ctx, "inference:with spaces", &models.InferenceResponse{Response: "spaces"}))
+	cached, err = c.Get(ctx, "inference:with spaces")
+	require.NoError(t, err)
+	assert.Equal(t, "spaces", cached.Response)
+
+	require.NoError(t, c.Delete(ctx, "inference:3"))
+	require.NoError(t, c.Delete(ctx, "inference:3"), "deleting a missing key isn't an error")
+	cached, err = c.Get(ctx, "inference:3")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	stats, err := c.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), stats.Entries)
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(2), stats.Misses)
+
+	purged, err := c.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), purged)
+	stats, err = c.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Entries)
+}
+
+func TestExpiration(t *testing.T) {
+	now := time.Unix(1_800_000_000, 0)
+	assert.Equal(t, int64(0), expiration(0, now))
+	assert.Equal(t, int64(2), expiration(1500*time.Millisecond, now))
+	assert.Equal(t, int64(3600), expiration(time.Hour, now))
+	assert.Equal(t, now.Unix()+60*24*3600, expiration(60*24*time.Hour, now), "beyond 30 days, a Unix time")
+}
@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	defaultMemoryCacheEntries = 10000
+	defaultMemoryCacheTTL     = time.Minute
+)
+
+// MemoryCache keeps the most recently used responses of a shared cache in
+// process memory, answering hot queries without a round-trip and through
+// short outages of the shared cache. Writes go through to the shared cache.
+// Entries are only invalidated on this instance, so others may serve a
+// deleted response for up to the TTL.
+//
+// Without a shared cache (a nil backend) it is the whole cache, for
+// cache.backend "memory": responses then aren't shared between instances and
+// are lost on restart.
+type MemoryCache struct {
+	backend    models.ManagedCacheStore
+	maxEntries int
+	ttl        time.Duration
+	clock      clock.Clock
+	stats      hitCounter
+
+	mu      sync.Mutex
+	order   *list.List // Most recently used first
+	entries map[string]*list.Element
+	bytes   int64
+}
+
+type memoryEntry struct {
+	key       string
+	data      []byte // Encoded, so callers can't change cached responses
+	expiresAt time.Time
+}
+
+func NewMemoryCache(backend models.ManagedCacheStore, cfg config.MemoryCacheConfig) *MemoryCache {
+	maxEntries := cfg.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMemoryCacheEntries
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultMemoryCacheTTL
+	}
+	return &MemoryCache{
+		backend:    backend,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		clock:      clock.Real(),
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// SetClock sets the clock entries expire by
+func (c *MemoryCache) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Get answers from memory, or else from the shared cache, remembering its answer
+func (c *MemoryCache) Get(ctx context.Context, key string) (*models.InferenceResponse, error) {
+	if data := c.lookup(key); data != nil {
+		var response models.InferenceResponse
+		if err := json.Unmarshal(data, &response); err == nil {
+			c.stats.record(true)
+			return &response, nil
+		}
+	}
+	c.stats.record(false)
+	if c.backend == nil {
+		return nil, nil
+	}
+
+	response, err := c.backend.Get(ctx, key)
+	if err != nil || response == nil {
+		return response, err
+	}
+	c.store(key, response)
+	return response, nil
+}
+
+// Set writes to the shared cache and memory. The response is kept in memory
+// even if the shared cache fails.
+func (c *MemoryCache) Set(ctx context.Context, key string, response *models.InferenceResponse) error {
+	c.store(key, response)
+	if c.backend == nil {
+		return nil
+	}
+	return c.backend.Set(ctx, key, response)
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.mu.Unlock()
+
+	if c.backend == nil {
+		return nil
+	}
+	return c.backend.Delete(ctx, key)
+}
+
+// Purge empties memory and the shared cache
+func (c *MemoryCache) Purge(ctx context.Context) (int64, error) {
+	c.mu.Lock()
+	purged := int64(len(c.entries))
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.bytes = 0
+	c.mu.Unlock()
+
+	if c.backend == nil {
+		return purged, nil
+	}
+	return c.backend.Purge(ctx)
+}
+
+// Stats reports the shared cache's stats, with this instance's memory tier
+func (c *MemoryCache) Stats(ctx context.Context) (*models.CacheStats, error) {
+	c.mu.Lock()
+	memory := &models.CacheStats{Entries: int64(len(c.entries)), MemoryBytes: c.bytes}
+	c.mu.Unlock()
+	c.stats.fill(memory)
+	if c.backend == nil {
+		return memory, nil
+	}
+
+	stats, err := c.backend.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Memory = memory
+	return stats, nil
+}
+
+func (c *MemoryCache) Close() error {
+	if c.backend == nil {
+		return nil
+	}
+	return c.backend.Close()
+}
+
+// lookup returns a fresh entry's data, marking it as recently used
+func (c *MemoryCache) lookup(key string) []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if !c.clock.Now().Before(entry.expiresAt) {
+		c.remove(element)
+		return nil
+	}
+	c.order.MoveToFront(element)
+	return entry.data
+}
+
+// store remembers a response for the TTL, or less if it expires sooner,
+// evicting the least recently used entries beyond the limit
+func (c *MemoryCache) store(key string, response *models.InferenceResponse) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+	entry := &memoryEntry{
+		key:       key,
+		data:      data,
+		expiresAt: c.clock.Now().Add(min(c.ttl, response.CacheTTL(c.ttl))),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.entries[key] = c.order.PushFront(entry)
+	c.bytes += int64(len(data))
+	for len(c.entries) > c.maxEntries {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *MemoryCache) remove(element *list.Element) {
+	entry := c.order.Remove(element).(*memoryEntry)
+	delete(c.entries, entry.key)
+	c.bytes -= int64(len(entry.data))
+}
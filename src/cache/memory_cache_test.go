@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestMemoryCache_ServesFromMemory(t *testing.T) {
+	redisCache, mr := setupTestRedis(t)
+	defer mr.Close()
+	defer redisCache.Close()
+
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 10, 0, 0, 0, time.UTC))
+	memory := NewMemoryCache(redisCache, config.MemoryCacheConfig{MaxEntries: 2, TTL: time.Minute})
+	memory.SetClock(fakeClock)
+	ctx := context.Background()
+
+	require.NoError(t, memory.Set(ctx, "inference:a", &models.InferenceResponse{Response: "a"}))
+	assert.True(t, mr.Exists("inference:a"), "writes go through to Redis")
+
+	// Hits don't reach Redis, even while it's down
+	mr.SetError("connection reset")
+	cached, err := memory.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", cached.Response)
+
+	// Callers changing a cached response don't change the cache
+	cached.CacheHit = true
+	cached, err = memory.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.False(t, cached.CacheHit)
+
+	// Misses are remembered from Redis
+	mr.SetError("")
+	require.NoError(t, redisCache.Set(ctx, "inference:b", &models.InferenceResponse{Response: "b"}))
+	cached, err = memory.Get(ctx, "inference:b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", cached.Response)
+
+	// Expired entries are read from Redis again
+	require.NoError(t, redisCache.Set(ctx, "inference:b", &models.InferenceResponse{Response: "b2"}))
+	fakeClock.Advance(time.Minute)
+	cached, err = memory.Get(ctx, "inference:b")
+	require.NoError(t, err)
+	assert.Equal(t, "b2", cached.Response)
+
+	stats, err := memory.Stats(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, stats.Memory)
+	assert.Equal(t, int64(2), stats.Memory.Entries)
+	assert.Equal(t, int64(2), stats.Memory.Hits)
+	assert.Equal(t, int64(2), stats.Memory.Misses)
+}
+
+func TestMemoryCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	redisCache, mr := setupTestRedis(t)
+	defer mr.Close()
+	defer redisCache.Close()
+
+	memory := NewMemoryCache(redisCache, config.MemoryCacheConfig{MaxEntries: 2, TTL: time.Minute})
+	ctx := context.Background()
+
+	for _, key := range []string{"inference:a", "inference:b"} {
+		require.NoError(t, memory.Set(ctx, key, &models.InferenceResponse{Response: key}))
+	}
+	_, err := memory.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	require.NoError(t, memory.Set(ctx, "inference:c", &models.InferenceResponse{Response: "c"}))
+
+	assert.NotNil(t, memory.lookup("inference:a"))
+	assert.Nil(t, memory.lookup("inference:b"))
+	assert.NotNil(t, memory.lookup("inference:c"))
+
+	// Deletes invalidate memory and Redis
+	require.NoError(t, memory.Delete(ctx, "inference:a"))
+	cached, err := memory.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	purged, err := memory.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	assert.Nil(t, memory.lookup("inference:c"))
+}
+
+func TestMemoryCache_WithoutBackend(t *testing.T) {
+	memory := NewMemoryCache(nil, config.MemoryCacheConfig{MaxEntries: 10, TTL: time.Hour})
+	ctx := context.Background()
+
+	cached, err := memory.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	require.NoError(t, memory.Set(ctx, "inference:a", &models.InferenceResponse{Response: "a"}))
+	require.NoError(t, memory.Set(ctx, "inference:b", &models.InferenceResponse{Response: "b"}))
+	cached, err = memory.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Equal(t, "a", cached.Response)
+
+	stats, err := memory.Stats(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, stats.Memory)
+	assert.Equal(t, int64(2), stats.Entries)
+	assert.Equal(t, int64(1), stats.Hits)
+
+	purged, err := memory.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), purged)
+	require.NoError(t, memory.Close())
+}
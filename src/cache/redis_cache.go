@@ -6,13 +6,23 @@ import (
 	"time"
 
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
 )
 
+// responseKeyPattern matches the response cache keys made by the router
+const responseKeyPattern = "inference:*"
+
 type RedisCache struct {
 	client *redis.Client
+	reader redis.Cmdable // Serves lookups; the client unless replicas are set
 	ttl    time.Duration
+	stats  hitCounter
+
+	failover *Failover // Set when redis.fallback is enabled
 }
 
 func NewRedisCache(cfg *config.RedisConfig) (*RedisCache, error) {
@@ -22,50 +32,104 @@ func NewRedisCache(cfg *config.RedisConfig) (*RedisCache, error) {
 		DB:       cfg.DB,
 	})
 
+	// With the fallback, an unreachable server doesn't stop the start: the
+	// ping below connects to the in-memory Redis instead
+	var failover *Failover
+	if cfg.Fallback.Enabled {
+		var err error
+		if failover, err = NewFailover(cfg); err != nil {
+			return nil, err
+		}
+		failover.Attach(client)
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := client.Ping(ctx).Err(); err != nil {
+		if failover != nil {
+			failover.Close()
+		}
 		return nil, err
 	}
 
 	return &RedisCache{
-		client: client,
-		ttl:    cfg.CacheTTL,
+		client:   client,
+		reader:   client,
+		ttl:      cfg.CacheTTL,
+		failover: failover,
 	}, nil
 }
 
-func (c *RedisCache) Get(ctx context.Context, key string) (*models.InferenceResponse, error) {
-	val, err := c.client.Get(ctx, key).Result()
+// Failover returns the fallback to the in-memory Redis, or nil when
+// redis.fallback is disabled
+func (c *RedisCache) Failover() *Failover {
+	return c.failover
+}
+
+// SetReader sends cache lookups to read replicas; writes stay on the primary
+func (c *RedisCache) SetReader(reader redis.Cmdable) {
+	c.reader = reader
+}
+
+func (c *RedisCache) Get(ctx context.Context, key string) (response *models.InferenceResponse, err error) {
+	ctx, span := startSpan(ctx, "cache.Get", "redis")
+	defer func() { endSpan(span, response != nil, err) }()
+
+	val, err := c.reader.Get(ctx, key).Result()
 	if err == redis.Nil {
+		c.stats.record(false)
 		return nil, nil
 	}
 	if err != nil {
 		return nil, err
 	}
+	c.stats.record(true)
 
-	var response models.InferenceResponse
 	if err := json.Unmarshal([]byte(val), &response); err != nil {
 		return nil, err
 	}
 
-	return &response, nil
+	return response, nil
 }
 
-func (c *RedisCache) Set(ctx context.Context, key string, response *models.InferenceResponse) error {
+func (c *RedisCache) Set(ctx context.Context, key string, response *models.InferenceResponse) (err error) {
+	ctx, span := startSpan(ctx, "cache.Set", "redis")
+	defer func() { tracing.End(span, err) }()
+
 	data, err := json.Marshal(response)
 	if err != nil {
 		return err
 	}
 
-	return c.client.Set(ctx, key, data, c.ttl).Err()
+	return c.client.Set(ctx, key, data, response.CacheTTL(c.ttl)).Err()
 }
 
 func (c *RedisCache) Delete(ctx context.Context, key string) error {
 	return c.client.Del(ctx, key).Err()
 }
 
+// Purge deletes every cached response
+func (c *RedisCache) Purge(ctx context.Context) (int64, error) {
+	return purgeKeys(ctx, c.client, responseKeyPattern)
+}
+
+// Stats reports the cached responses and the hit ratio of exact lookups
+func (c *RedisCache) Stats(ctx context.Context) (*models.CacheStats, error) {
+	entries, memory, err := keyStats(ctx, c.client, responseKeyPattern)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.CacheStats{Entries: entries, MemoryBytes: memory}
+	c.stats.fill(stats)
+	return stats, nil
+}
+
 func (c *RedisCache) Close() error {
+	if c.failover != nil {
+		c.failover.Close()
+	}
 	return c.client.Close()
 }
 
@@ -73,3 +137,14 @@ func (c *RedisCache) Close() error {
 func (c *RedisCache) GetClient() *redis.Client {
 	return c.client
 }
+
+// startSpan starts the span of a cache lookup in backend
+func startSpan(ctx context.Context, name string, backend string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, name, attribute.String("hybridlm.cache", backend))
+}
+
+// endSpan ends the span of a cache lookup, recording whether it hit
+func endSpan(span trace.Span, hit bool, err error) {
+	span.SetAttributes(attribute.Bool("hybridlm.cache_hit", hit))
+	tracing.End(span, err)
+}
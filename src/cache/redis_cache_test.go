@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"fmt"
 	"testing"
 	"time"
 
@@ -136,3 +137,70 @@ func BenchmarkRedisCache_Set(b *testing.B) {
 		cache.Set(ctx, "bench:key", response)
 	}
 }
+
+func TestRedisCache_PurgeAndStats(t *testing.T) {
+	cache, mr := setupTestRedis(t)
+	defer mr.Close()
+	defer cache.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, cache.Set(ctx, fmt.Sprintf("inference:%d", i), &models.InferenceResponse{Response: "cached"}))
+	}
+	require.NoError(t, mr.Set("session:unrelated", "keep"))
+
+	cache.Get(ctx, "inference:0")
+	cache.Get(ctx, "inference:1")
+	cache.Get(ctx, "inference:missing")
+
+	stats, err := cache.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Entries)
+	assert.Positive(t, stats.MemoryBytes)
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Equal(t, int64(1), stats.Misses)
+	assert.InDelta(t, 2.0/3.0, stats.HitRatio, 0.001)
+
+	purged, err := cache.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+	assert.True(t, mr.Exists("session:unrelated"), "Purge should only delete cache entries")
+
+	stats, err = cache.Stats(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, stats.Entries)
+}
+
+func TestRedisCache_ReadsFromReplicas(t *testing.T) {
+	cache, mr := setupTestRedis(t)
+	defer mr.Close()
+	defer cache.Close()
+
+	none, err := NewReplicaReader(&config.RedisConfig{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, none)
+
+	replica := miniredis.RunT(t)
+	reader, err := NewReplicaReader(&config.RedisConfig{ReadReplicas: []string{replica.Addr()}}, nil)
+	require.NoError(t, err)
+	defer reader.Close()
+	cache.SetReader(reader)
+
+	// Writes go to the primary, lookups to the replica
+	ctx := context.Background()
+	require.NoError(t, cache.Set(ctx, "inference:a", &models.InferenceResponse{Response: "primary"}))
+	assert.True(t, mr.Exists("inference:a"))
+	assert.False(t, replica.Exists("inference:a"))
+
+	cached, err := cache.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Nil(t, cached, "not replicated yet")
+
+	require.NoError(t, replica.Set("inference:a", `{"response":"replica"}`))
+	cached, err = cache.Get(ctx, "inference:a")
+	require.NoError(t, err)
+	assert.Equal(t, "replica", cached.Response)
+
+	_, err = NewReplicaReader(&config.RedisConfig{ReadReplicas: []string{"127.0.0.1:1"}}, nil)
+	assert.ErrorContains(t, err, "read replicas")
+}
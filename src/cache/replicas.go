@@ -0,0 +1,59 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+// NewReplicaReader connects to the read replicas of cfg, or returns nil when
+// there are none. Reads are spread over several replicas by key. With a
+// failover, which may be nil, reads go to its in-memory Redis while the
+// primary is unreachable.
+func NewReplicaReader(cfg *config.RedisConfig, failover *Failover) (redis.UniversalClient, error) {
+	if len(cfg.ReadReplicas) == 0 {
+		return nil, nil
+	}
+
+	newClient := func(opt *redis.Options) *redis.Client {
+		client := redis.NewClient(opt)
+		if failover != nil {
+			failover.AttachReader(client)
+		}
+		return client
+	}
+
+	var reader redis.UniversalClient
+	if len(cfg.ReadReplicas) == 1 {
+		reader = newClient(&redis.Options{
+			Addr:     cfg.ReadReplicas[0],
+			Password: cfg.Password,
+			DB:       cfg.DB,
+		})
+	} else {
+		// Every replica holds every key, so a ring simply balances reads
+		addrs := make(map[string]string, len(cfg.ReadReplicas))
+		for i, addr := range cfg.ReadReplicas {
+			addrs[fmt.Sprintf("replica-%d", i)] = addr
+		}
+		reader = redis.NewRing(&redis.RingOptions{
+			Addrs:     addrs,
+			Password:  cfg.Password,
+			DB:        cfg.DB,
+			NewClient: newClient,
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := reader.Ping(ctx).Err(); err != nil {
+		reader.Close()
+		return nil, fmt.Errorf("failed to connect to Redis read replicas: %w", err)
+	}
+	return reader, nil
+}
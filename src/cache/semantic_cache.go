@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"math"
 	"time"
 
@@ -12,14 +13,17 @@ import (
 	"github.com/sashabaranov/go-openai"
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
 )
 
 const (
 	embeddingPrefix = "embedding:"
 	queryPrefix     = "query:"
-	embeddingModel  = "text-embedding-ada-002"
 )
 
+// EmbeddingModel is the model NewOpenAIEmbedder embeds with
+const EmbeddingModel = string(openai.AdaEmbeddingV2)
+
 // CachedEntry represents a cached query with its embedding
 type CachedEntry struct {
 	Query     string                    `json:"query"`
@@ -30,20 +34,30 @@ type CachedEntry struct {
 
 // SemanticCache implements semantic similarity-based caching
 type SemanticCache struct {
-	client         *redis.Client
-	openaiClient   *openai.Client
-	ttl            time.Duration
+	client              *redis.Client
+	reader              redis.UniversalClient // Read replicas for entry lookups, nil without any
+	embedder            models.Embedder
+	ttl                 time.Duration
 	similarityThreshold float64
+	vectorIndex         *vectorIndex // nil when RediSearch is unavailable; falls back to scanning
+	stats               hitCounter
 }
 
-// NewSemanticCache creates a new semantic cache instance
-func NewSemanticCache(redisCfg *config.RedisConfig, semanticCfg *config.SemanticCacheConfig) (*SemanticCache, error) {
+// NewSemanticCache creates a new semantic cache instance. With a failover,
+// which may be nil, it keeps working from the in-memory Redis while Redis is
+// unreachable, by scanning entries there.
+func NewSemanticCache(redisCfg *config.RedisConfig, semanticCfg *config.SemanticCacheConfig, failover *Failover) (*SemanticCache, error) {
 	// Initialize Redis client
+	// RESP2 because go-redis only parses FT.SEARCH replies reliably over RESP2
 	client := redis.NewClient(&redis.Options{
 		Addr:     redisCfg.Address,
 		Password: redisCfg.Password,
 		DB:       redisCfg.DB,
+		Protocol: 2,
 	})
+	if failover != nil {
+		failover.Attach(client)
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -52,20 +66,62 @@ func NewSemanticCache(redisCfg *config.RedisConfig, semanticCfg *config.Semantic
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	// Initialize OpenAI client for embeddings
-	openaiClient := openai.NewClient(semanticCfg.APIKey)
+	reader, err := NewReplicaReader(redisCfg, failover)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
 
-	return &SemanticCache{
+	semanticCache := &SemanticCache{
 		client:              client,
-		openaiClient:        openaiClient,
+		reader:              reader,
+		embedder:            NewOpenAIEmbedder(semanticCfg.APIKey),
 		ttl:                 redisCfg.CacheTTL,
 		similarityThreshold: semanticCfg.SimilarityThreshold,
-	}, nil
+	}
+
+	// Use a RediSearch vector index when available, otherwise brute-force scan
+	if semanticCfg.Backend != "scan" {
+		index, err := newVectorIndex(ctx, client, semanticCfg.IndexType, semanticCfg.VectorDim)
+		if err != nil {
+			if semanticCfg.Backend == "vector" {
+				return nil, err
+			}
+			log.Printf("⚠️  Redis vector search unavailable (%v), semantic cache will scan entries", err)
+		} else {
+			semanticCache.vectorIndex = index
+		}
+	}
+
+	return semanticCache, nil
+}
+
+// SetEmbedder replaces the OpenAI embeddings, e.g. with a local stub. Its
+// vectors must match semantic_cache.vector_dim when a vector index is used.
+func (c *SemanticCache) SetEmbedder(embedder models.Embedder) {
+	c.embedder = embedder
+}
+
+// UsesVectorIndex reports whether similarity lookups go through RediSearch
+func (c *SemanticCache) UsesVectorIndex() bool {
+	return c.vectorIndex != nil
+}
+
+// readClient is the connection entry lookups go to: a read replica if any
+// are configured, otherwise the primary
+func (c *SemanticCache) readClient() redis.Cmdable {
+	if c.reader != nil {
+		return c.reader
+	}
+	return c.client
 }
 
 // Get retrieves a cached response by exact key match
-func (c *SemanticCache) Get(ctx context.Context, key string) (*models.InferenceResponse, error) {
-	val, err := c.client.Get(ctx, queryPrefix+key).Result()
+func (c *SemanticCache) Get(ctx context.Context, key string) (response *models.InferenceResponse, err error) {
+	ctx, span := startSpan(ctx, "cache.Get", "semantic")
+	defer func() { endSpan(span, response != nil, err) }()
+
+	val, err := c.readClient().Get(ctx, queryPrefix+key).Result()
 	if err == redis.Nil {
 		return nil, nil
 	}
@@ -82,7 +138,10 @@ func (c *SemanticCache) Get(ctx context.Context, key string) (*models.InferenceR
 }
 
 // Set stores a response with exact key (backward compatibility)
-func (c *SemanticCache) Set(ctx context.Context, key string, response *models.InferenceResponse) error {
+func (c *SemanticCache) Set(ctx context.Context, key string, response *models.InferenceResponse) (err error) {
+	ctx, span := startSpan(ctx, "cache.Set", "semantic")
+	defer func() { tracing.End(span, err) }()
+
 	entry := CachedEntry{
 		Query:     key,
 		Embedding: nil, // No embedding for basic set
@@ -95,7 +154,7 @@ func (c *SemanticCache) Set(ctx context.Context, key string, response *models.In
 		return fmt.Errorf("failed to marshal cache entry: %w", err)
 	}
 
-	return c.client.Set(ctx, queryPrefix+key, data, c.ttl).Err()
+	return c.client.Set(ctx, queryPrefix+key, data, response.CacheTTL(c.ttl)).Err()
 }
 
 // Delete removes a cached entry
@@ -107,21 +166,91 @@ func (c *SemanticCache) Delete(ctx context.Context, key string) error {
 	return err
 }
 
-// Close closes the Redis connection
+// Purge deletes every cached entry and its embedding
+func (c *SemanticCache) Purge(ctx context.Context) (int64, error) {
+	return purgeKeys(ctx, c.client, queryPrefix+"*", embeddingPrefix+"*")
+}
+
+// Stats reports the cached entries, including embeddings in the memory
+// total, and the hit ratio of similarity lookups
+func (c *SemanticCache) Stats(ctx context.Context) (*models.CacheStats, error) {
+	entries, memory, err := keyStats(ctx, c.client, queryPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	_, embeddingMemory, err := keyStats(ctx, c.client, embeddingPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.CacheStats{Entries: entries, MemoryBytes: memory + embeddingMemory}
+	c.stats.fill(stats)
+	return stats, nil
+}
+
+// Close closes the Redis connections
 func (c *SemanticCache) Close() error {
+	if c.reader != nil {
+		c.reader.Close()
+	}
 	return c.client.Close()
 }
 
 // GetSimilar finds semantically similar cached queries
-func (c *SemanticCache) GetSimilar(ctx context.Context, query string, threshold float64) (*models.SemanticCacheResult, error) {
+func (c *SemanticCache) GetSimilar(ctx context.Context, query string, threshold float64) (result *models.SemanticCacheResult, err error) {
+	ctx, span := startSpan(ctx, "cache.GetSimilar", "semantic")
+	defer func() { endSpan(span, result != nil, err) }()
+
 	// Generate embedding for the query
 	queryEmbedding, err := c.generateEmbedding(ctx, query)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
 	}
 
+	if c.vectorIndex != nil {
+		result, err := c.getSimilarIndexed(ctx, queryEmbedding, threshold)
+		if err == nil {
+			c.stats.record(result != nil)
+			return result, nil
+		}
+		log.Printf("Vector search failed, falling back to scan: %v", err)
+	}
+
+	result, err = c.getSimilarScan(ctx, queryEmbedding, threshold)
+	if err == nil {
+		c.stats.record(result != nil)
+	}
+	return result, err
+}
+
+// getSimilarIndexed finds the nearest cached query with a single FT.SEARCH KNN query
+func (c *SemanticCache) getSimilarIndexed(ctx context.Context, queryEmbedding []float32, threshold float64) (*models.SemanticCacheResult, error) {
+	cacheKey, similarity, err := c.vectorIndex.Nearest(ctx, queryEmbedding)
+	if err != nil {
+		return nil, err
+	}
+	if cacheKey == "" || similarity <= threshold {
+		return nil, nil
+	}
+
+	response, err := c.Get(ctx, cacheKey)
+	if err != nil || response == nil {
+		// The entry expired between the index lookup and the fetch
+		return nil, err
+	}
+
+	return &models.SemanticCacheResult{
+		Response:   response,
+		Similarity: similarity,
+		CacheKey:   cacheKey,
+	}, nil
+}
+
+// getSimilarScan compares the query against every cached embedding (used when RediSearch is unavailable)
+func (c *SemanticCache) getSimilarScan(ctx context.Context, queryEmbedding []float32, threshold float64) (*models.SemanticCacheResult, error) {
 	// Get all cached embeddings
-	keys, err := c.client.Keys(ctx, queryPrefix+"*").Result()
+	reader := c.readClient()
+	keys, err := reader.Keys(ctx, queryPrefix+"*").Result()
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve cache keys: %w", err)
 	}
@@ -131,7 +260,7 @@ func (c *SemanticCache) GetSimilar(ctx context.Context, query string, threshold
 
 	// Compare with each cached entry
 	for _, key := range keys {
-		val, err := c.client.Get(ctx, key).Result()
+		val, err := reader.Get(ctx, key).Result()
 		if err != nil {
 			continue
 		}
@@ -147,7 +276,7 @@ func (c *SemanticCache) GetSimilar(ctx context.Context, query string, threshold
 		}
 
 		// Calculate cosine similarity
-		similarity := cosineSimilarity(queryEmbedding, entry.Embedding)
+		similarity := CosineSimilarity(queryEmbedding, entry.Embedding)
 
 		if similarity > maxSimilarity {
 			maxSimilarity = similarity
@@ -164,7 +293,10 @@ func (c *SemanticCache) GetSimilar(ctx context.Context, query string, threshold
 }
 
 // SetWithEmbedding stores a response with its query embedding
-func (c *SemanticCache) SetWithEmbedding(ctx context.Context, key string, query string, response *models.InferenceResponse) error {
+func (c *SemanticCache) SetWithEmbedding(ctx context.Context, key string, query string, response *models.InferenceResponse) (err error) {
+	ctx, span := startSpan(ctx, "cache.Set", "semantic")
+	defer func() { tracing.End(span, err) }()
+
 	// Generate embedding for the query
 	embedding, err := c.generateEmbedding(ctx, query)
 	if err != nil {
@@ -184,20 +316,43 @@ func (c *SemanticCache) SetWithEmbedding(ctx context.Context, key string, query
 	}
 
 	// Store the entry with TTL
-	if err := c.client.Set(ctx, queryPrefix+key, data, c.ttl).Err(); err != nil {
+	ttl := response.CacheTTL(c.ttl)
+	if err := c.client.Set(ctx, queryPrefix+key, data, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to set cache entry: %w", err)
 	}
 
+	if c.vectorIndex != nil {
+		if err := c.vectorIndex.Add(ctx, key, embedding, ttl); err != nil {
+			return fmt.Errorf("failed to index embedding: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // generateEmbedding generates an embedding vector for the given text
-func (c *SemanticCache) generateEmbedding(ctx context.Context, text string) ([]float32, error) {
+func (c *SemanticCache) generateEmbedding(ctx context.Context, text string) (embedding []float32, err error) {
 	if text == "" {
 		return nil, errors.New("text cannot be empty")
 	}
 
-	resp, err := c.openaiClient.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+	ctx, span := tracing.Start(ctx, "embedding.Generate")
+	defer func() { tracing.End(span, err) }()
+	return c.embedder.Embed(ctx, text)
+}
+
+// openAIEmbedder embeds text with OpenAI's embeddings API
+type openAIEmbedder struct {
+	client *openai.Client
+}
+
+// NewOpenAIEmbedder returns an embedder using OpenAI's embeddings API
+func NewOpenAIEmbedder(apiKey string) models.Embedder {
+	return &openAIEmbedder{client: openai.NewClient(apiKey)}
+}
+
+func (e *openAIEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
 		Input: []string{text},
 		Model: openai.AdaEmbeddingV2,
 	})
@@ -212,8 +367,8 @@ func (c *SemanticCache) generateEmbedding(ctx context.Context, text string) ([]f
 	return resp.Data[0].Embedding, nil
 }
 
-// cosineSimilarity calculates the cosine similarity between two vectors
-func cosineSimilarity(a, b []float32) float64 {
+// CosineSimilarity calculates the cosine similarity between two vectors
+func CosineSimilarity(a, b []float32) float64 {
 	if len(a) != len(b) {
 		return 0.0
 	}
@@ -0,0 +1,105 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupTestSemanticCache(t *testing.T, backend string) (*SemanticCache, *miniredis.Miniredis, error) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+
+	redisCfg := &config.RedisConfig{Address: mr.Addr(), CacheTTL: time.Hour}
+	semanticCfg := &config.SemanticCacheConfig{
+		Enabled:             true,
+		SimilarityThreshold: 0.85,
+		APIKey:              "test-key",
+		Backend:             backend,
+	}
+
+	sc, err := NewSemanticCache(redisCfg, semanticCfg, nil)
+	return sc, mr, err
+}
+
+func TestSemanticCache_FallsBackToScanWithoutRediSearch(t *testing.T) {
+	sc, mr, err := setupTestSemanticCache(t, "auto")
+	require.NoError(t, err)
+	defer mr.Close()
+	defer sc.Close()
+
+	assert.False(t, sc.UsesVectorIndex())
+}
+
+func TestSemanticCache_VectorBackendRequiresRediSearch(t *testing.T) {
+	_, mr, err := setupTestSemanticCache(t, "vector")
+	defer mr.Close()
+
+	assert.Error(t, err)
+}
+
+func TestSemanticCache_ScanFindsSimilarEntry(t *testing.T) {
+	sc, mr, err := setupTestSemanticCache(t, "scan")
+	require.NoError(t, err)
+	defer mr.Close()
+	defer sc.Close()
+
+	ctx := context.Background()
+	entry := CachedEntry{
+		Query:     "what is redis",
+		Embedding: []float32{1, 0, 0},
+		Response:  &models.InferenceResponse{Response: "An in-memory store"},
+		CachedAt:  time.Now(),
+	}
+	data, _ := json.Marshal(entry)
+	require.NoError(t, sc.client.Set(ctx, queryPrefix+"abc", data, time.Hour).Err())
+
+	result, err := sc.getSimilarScan(ctx, []float32{0.99, 0.1, 0}, 0.9)
+	require.NoError(t, err)
+	require.NotNil(t, result)
+	assert.Equal(t, "abc", result.CacheKey)
+	assert.Equal(t, "An in-memory store", result.Response.Response)
+
+	result, err = sc.getSimilarScan(ctx, []float32{0, 1, 0}, 0.9)
+	assert.NoError(t, err)
+	assert.Nil(t, result)
+}
+
+func TestEncodeVector(t *testing.T) {
+	encoded := encodeVector([]float32{1, -2.5})
+
+	assert.Len(t, encoded, 8)
+	assert.Equal(t, []byte{0x00, 0x00, 0x80, 0x3f}, encoded[:4])
+}
+
+func TestSemanticCache_PurgeRemovesEntriesAndEmbeddings(t *testing.T) {
+	sc, mr, err := setupTestSemanticCache(t, "scan")
+	require.NoError(t, err)
+	defer mr.Close()
+	defer sc.Close()
+
+	ctx := context.Background()
+	require.NoError(t, mr.Set(queryPrefix+"a", "{}"))
+	require.NoError(t, mr.Set(queryPrefix+"b", "{}"))
+	mr.HSet(embeddingPrefix+"a", "query", "what is redis")
+	require.NoError(t, mr.Set("inference:exact", "{}"))
+
+	stats, err := sc.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Entries)
+	assert.Zero(t, stats.HitRatio)
+
+	purged, err := sc.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), purged)
+	assert.False(t, mr.Exists(embeddingPrefix+"a"))
+	assert.True(t, mr.Exists("inference:exact"))
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	thresholdTuningKey = "semantic_threshold" // Hash of the tuned threshold and the ratings since it last moved
+	semanticHitPrefix  = "semantic_hit:"      // Hits awaiting a rating, by ID
+)
+
+// ErrHitNotFound is returned when rating a hit that doesn't exist, has
+// expired, was already rated or belongs to another user
+var ErrHitNotFound = errors.New("semantic cache hit not found")
+
+// rateHitScript counts a rating and, once enough are in, moves the threshold
+// a step toward the target share of bad ones and starts counting again.
+// Returns the threshold.
+var rateHitScript = redis.NewScript(`
+local field = "bad"
+if ARGV[1] == "1" then
+  field = "good"
+end
+redis.call("HINCRBY", KEYS[1], field, 1)
+
+local state = redis.call("HMGET", KEYS[1], "threshold", "good", "bad")
+local threshold = tonumber(state[1]) or tonumber(ARGV[2])
+local good = tonumber(state[2]) or 0
+local bad = tonumber(state[3]) or 0
+local min, max, step = tonumber(ARGV[3]), tonumber(ARGV[4]), tonumber(ARGV[5])
+local target = tonumber(ARGV[7])
+
+if good + bad >= tonumber(ARGV[6]) then
+  local rate = bad / (good + bad)
+  if rate > target then
+    threshold = threshold + step
+  elseif rate < target / 2 then
+    threshold = threshold - step
+  end
+  threshold = math.floor(math.min(max, math.max(min, threshold)) * 10000 + 0.5) / 10000
+  redis.call("HSET", KEYS[1], "threshold", tostring(threshold), "good", 0, "bad", 0)
+end
+return tostring(threshold)
+`)
+
+// ThresholdTuner nudges the semantic cache's similarity threshold within
+// bounds: up when users rate too many reused answers bad, down when they
+// rarely do. State is kept in Redis, so every instance uses the same value.
+type ThresholdTuner struct {
+	client     *redis.Client
+	cfg        config.ThresholdTuningConfig
+	configured float64
+}
+
+// NewThresholdTuner tunes the threshold starting from configured
+func NewThresholdTuner(client *redis.Client, cfg config.ThresholdTuningConfig, configured float64) *ThresholdTuner {
+	return &ThresholdTuner{client: client, cfg: cfg, configured: configured}
+}
+
+// Threshold returns the tuned threshold, or the configured one until it has
+// been tuned or when Redis fails
+func (t *ThresholdTuner) Threshold(ctx context.Context) float64 {
+	value, err := t.client.HGet(ctx, thresholdTuningKey, "threshold").Float64()
+	if err != nil {
+		return t.configured
+	}
+	// The bounds may have changed since it was tuned
+	return math.Min(t.cfg.Max, math.Max(t.cfg.Min, value))
+}
+
+// RecordHit keeps a hit served to userID for rating and returns its ID
+func (t *ThresholdTuner) RecordHit(ctx context.Context, userID string) (string, error) {
+	hitID := "hit_" + uuid.New().String()
+	if err := t.client.Set(ctx, semanticHitPrefix+hitID, userID, t.cfg.FeedbackWindow).Err(); err != nil {
+		return "", fmt.Errorf("failed to record semantic cache hit: %w", err)
+	}
+	return hitID, nil
+}
+
+// Rate counts userID's rating of a hit they were served and returns the
+// threshold. Each hit is rated once.
+func (t *ThresholdTuner) Rate(ctx context.Context, userID string, hitID string, good bool) (float64, error) {
+	owner, err := t.client.Get(ctx, semanticHitPrefix+hitID).Result()
+	if err == redis.Nil || (err == nil && owner != userID) {
+		return 0, ErrHitNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up semantic cache hit: %w", err)
+	}
+	// Only the first of concurrent ratings counts
+	deleted, err := t.client.Del(ctx, semanticHitPrefix+hitID).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up semantic cache hit: %w", err)
+	}
+	if deleted == 0 {
+		return 0, ErrHitNotFound
+	}
+
+	rating := "0"
+	if good {
+		rating = "1"
+	}
+	threshold, err := rateHitScript.Run(ctx, t.client, []string{thresholdTuningKey},
+		rating, t.configured, t.cfg.Min, t.cfg.Max, t.cfg.Step, t.cfg.MinFeedback, t.cfg.TargetBadRate).Text()
+	if err != nil {
+		return 0, fmt.Errorf("failed to record rating: %w", err)
+	}
+	return strconv.ParseFloat(threshold, 64)
+}
+
+// Stats reports the threshold and the ratings toward its next adjustment
+func (t *ThresholdTuner) Stats(ctx context.Context) (*models.ThresholdStats, error) {
+	state, err := t.client.HMGet(ctx, thresholdTuningKey, "good", "bad").Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get threshold tuning state: %w", err)
+	}
+	count := func(value interface{}) int64 {
+		s, _ := value.(string)
+		n, _ := strconv.ParseInt(s, 10, 64)
+		return n
+	}
+	return &models.ThresholdStats{
+		Configured: t.configured,
+		Effective:  t.Threshold(ctx),
+		Min:        t.cfg.Min,
+		Max:        t.cfg.Max,
+		Good:       count(state[0]),
+		Bad:        count(state[1]),
+	}, nil
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+func TestThresholdTuner(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	tuner := NewThresholdTuner(client, config.ThresholdTuningConfig{
+		Enabled:        true,
+		Min:            0.8,
+		Max:            0.9,
+		Step:           0.05,
+		MinFeedback:    4,
+		TargetBadRate:  0.25,
+		FeedbackWindow: time.Hour,
+	}, 0.85)
+	ctx := context.Background()
+	assert.Equal(t, 0.85, tuner.Threshold(ctx))
+
+	rate := func(ratings ...bool) float64 {
+		var threshold float64
+		for _, good := range ratings {
+			hitID, err := tuner.RecordHit(ctx, "alice")
+			require.NoError(t, err)
+			threshold, err = tuner.Rate(ctx, "alice", hitID, good)
+			require.NoError(t, err)
+		}
+		return threshold
+	}
+
+	// Half the hits rated bad: stricter, up to the bound
+	assert.Equal(t, 0.85, rate(true, false, true))
+	stats, err := tuner.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stats.Good)
+	assert.Equal(t, int64(1), stats.Bad)
+	assert.Equal(t, 0.9, rate(false))
+	assert.Equal(t, 0.9, rate(true, false, true, false))
+	assert.Equal(t, 0.9, tuner.Threshold(ctx))
+
+	// None bad: looser
+	assert.Equal(t, 0.85, rate(true, true, true, true))
+	stats, err = tuner.Stats(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0.85, stats.Effective)
+	assert.Equal(t, 0.85, stats.Configured)
+	assert.Zero(t, stats.Good)
+
+	// Hits are rated once, by whoever was served them
+	hitID, err := tuner.RecordHit(ctx, "alice")
+	require.NoError(t, err)
+	_, err = tuner.Rate(ctx, "bob", hitID, false)
+	assert.ErrorIs(t, err, ErrHitNotFound)
+	_, err = tuner.Rate(ctx, "alice", hitID, true)
+	require.NoError(t, err)
+	_, err = tuner.Rate(ctx, "alice", hitID, true)
+	assert.ErrorIs(t, err, ErrHitNotFound)
+
+	hitID, err = tuner.RecordHit(ctx, "alice")
+	require.NoError(t, err)
+	mr.FastForward(2 * time.Hour)
+	_, err = tuner.Rate(ctx, "alice", hitID, true)
+	assert.ErrorIs(t, err, ErrHitNotFound)
+}
@@ -0,0 +1,123 @@
+package cache
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	vectorIndexName   = "idx:semantic_cache"
+	vectorField       = "embedding"
+	vectorKeyField    = "cache_key"
+	vectorScoreField  = "distance"
+	defaultVectorDim  = 1536
+	defaultIndexType  = "HNSW"
+	vectorDistanceCos = "COSINE"
+)
+
+// vectorIndex is a RediSearch (Redis Stack) vector index over the cached query
+// embeddings. Embeddings are stored as hashes under embeddingPrefix so the
+// index picks them up automatically; lookups are a single FT.SEARCH KNN query.
+type vectorIndex struct {
+	client    *redis.Client
+	indexType string
+	dim       int
+}
+
+// newVectorIndex creates the index if it doesn't exist yet. It returns an
+// error when the Redis server doesn't have the search module loaded.
+func newVectorIndex(ctx context.Context, client *redis.Client, indexType string, dim int) (*vectorIndex, error) {
+	if dim <= 0 {
+		dim = defaultVectorDim
+	}
+	indexType = strings.ToUpper(indexType)
+	if indexType != "FLAT" {
+		indexType = defaultIndexType
+	}
+
+	vectorArgs := &redis.FTVectorArgs{}
+	if indexType == "FLAT" {
+		vectorArgs.FlatOptions = &redis.FTFlatOptions{Type: "FLOAT32", Dim: dim, DistanceMetric: vectorDistanceCos}
+	} else {
+		vectorArgs.HNSWOptions = &redis.FTHNSWOptions{Type: "FLOAT32", Dim: dim, DistanceMetric: vectorDistanceCos}
+	}
+
+	err := client.FTCreate(ctx, vectorIndexName,
+		&redis.FTCreateOptions{
+			OnHash: true,
+			Prefix: []interface{}{embeddingPrefix},
+		},
+		&redis.FieldSchema{FieldName: vectorKeyField, FieldType: redis.SearchFieldTypeTag},
+		&redis.FieldSchema{FieldName: vectorField, FieldType: redis.SearchFieldTypeVector, VectorArgs: vectorArgs},
+	).Err()
+	if err != nil && !strings.Contains(strings.ToLower(err.Error()), "index already exists") {
+		return nil, fmt.Errorf("failed to create vector index: %w", err)
+	}
+
+	return &vectorIndex{
+		client:    client,
+		indexType: indexType,
+		dim:       dim,
+	}, nil
+}
+
+// Add stores the embedding for a cache key so it becomes searchable
+func (v *vectorIndex) Add(ctx context.Context, key string, embedding []float32, ttl time.Duration) error {
+	if len(embedding) != v.dim {
+		return fmt.Errorf("embedding has %d dimensions, index expects %d", len(embedding), v.dim)
+	}
+
+	pipe := v.client.TxPipeline()
+	pipe.HSet(ctx, embeddingPrefix+key, vectorKeyField, key, vectorField, encodeVector(embedding))
+	if ttl > 0 {
+		pipe.Expire(ctx, embeddingPrefix+key, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Nearest returns the cache key of the closest embedding and its cosine similarity.
+// An empty key means the index holds no entries.
+func (v *vectorIndex) Nearest(ctx context.Context, embedding []float32) (string, float64, error) {
+	query := fmt.Sprintf("*=>[KNN 1 @%s $vec AS %s]", vectorField, vectorScoreField)
+
+	result, err := v.client.FTSearchWithArgs(ctx, vectorIndexName, query, &redis.FTSearchOptions{
+		Params:         map[string]interface{}{"vec": encodeVector(embedding)},
+		Return:         []redis.FTSearchReturn{{FieldName: vectorKeyField}, {FieldName: vectorScoreField}},
+		SortBy:         []redis.FTSearchSortBy{{FieldName: vectorScoreField, Asc: true}},
+		Limit:          1,
+		DialectVersion: 2,
+	}).Result()
+	if err != nil {
+		return "", 0, fmt.Errorf("vector search failed: %w", err)
+	}
+
+	if len(result.Docs) == 0 {
+		return "", 0, nil
+	}
+
+	doc := result.Docs[0]
+	distance, err := strconv.ParseFloat(doc.Fields[vectorScoreField], 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid vector distance %q: %w", doc.Fields[vectorScoreField], err)
+	}
+
+	// RediSearch reports cosine distance (1 - similarity)
+	return doc.Fields[vectorKeyField], 1 - distance, nil
+}
+
+// encodeVector serializes a float32 vector as little-endian bytes, the format RediSearch expects
+func encodeVector(vector []float32) []byte {
+	buf := make([]byte, 4*len(vector))
+	for i, f := range vector {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(f))
+	}
+	return buf
+}
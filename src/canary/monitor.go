@@ -0,0 +1,263 @@
+// Package canary sends known prompts through the inference pipeline on a
+// schedule and alerts when the answers drift from what's expected, catching
+// provider and prompt regressions that don't show up as errors.
+package canary
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	resultsKey       = "canary:results" // Hash of each canary's latest result by name
+	lockKey          = "canary:lock"
+	defaultInterval  = 15 * time.Minute
+	defaultThreshold = 0.8
+
+	MethodEmbedding   = "embedding"
+	MethodWordOverlap = "word_overlap"
+)
+
+// unlockScript releases the lock only if the check holding it is the one
+// releasing it, not another instance's that took it over
+var unlockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// Runner answers a request like POST /api/v1/inference, without cached answers
+type Runner func(ctx context.Context, req models.InferenceRequest) (*models.InferenceResponse, error)
+
+// Monitor runs the configured canary prompts. One instance runs them at a
+// time; results are kept in Redis so every instance reports the same ones.
+type Monitor struct {
+	client   *redis.Client
+	run      Runner
+	embedder models.Embedder // Optional; without it answers are compared by word overlap
+	prompts  []config.CanaryPromptConfig
+	interval time.Duration
+	minScore float64
+	clock    clock.Clock
+	alerts   []func(models.CanaryAlert)
+}
+
+func NewMonitor(client *redis.Client, cfg config.CanaryConfig, run Runner, embedder models.Embedder) *Monitor {
+	m := &Monitor{
+		client:   client,
+		run:      run,
+		embedder: embedder,
+		prompts:  cfg.Prompts,
+		interval: cfg.Interval,
+		minScore: cfg.Threshold,
+		clock:    clock.Real(),
+	}
+	if m.interval <= 0 {
+		m.interval = defaultInterval
+	}
+	if m.minScore <= 0 {
+		m.minScore = defaultThreshold
+	}
+	return m
+}
+
+// SetClock sets the clock results are timestamped with
+func (m *Monitor) SetClock(c clock.Clock) {
+	m.clock = c
+}
+
+// OnAlert registers a handler, called when a canary starts failing and when
+// it passes again
+func (m *Monitor) OnAlert(fn func(models.CanaryAlert)) {
+	m.alerts = append(m.alerts, fn)
+}
+
+// Run checks the canaries every interval until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	for {
+		if _, err := m.Check(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Canary check failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.interval):
+		}
+	}
+}
+
+// Check sends every canary prompt and returns the results. It returns none
+// while another instance is checking. A check is cut off after an interval,
+// before its lock can expire and let another one start.
+func (m *Monitor) Check(ctx context.Context) ([]models.CanaryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, m.interval)
+	defer cancel()
+
+	token := uuid.NewString()
+	locked, err := m.client.SetNX(ctx, lockKey, token, m.interval).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock canaries: %w", err)
+	}
+	if !locked {
+		return nil, nil
+	}
+	defer func() {
+		// Released even when ctx has timed out
+		if err := unlockScript.Run(context.WithoutCancel(ctx), m.client, []string{lockKey}, token).Err(); err != nil {
+			log.Printf("Failed to unlock canaries: %v", err)
+		}
+	}()
+
+	previous, err := m.Results(ctx)
+	if err != nil {
+		return nil, err
+	}
+	passed := make(map[string]bool, len(previous))
+	for _, result := range previous {
+		passed[result.Name] = result.Passed
+	}
+
+	results := make([]models.CanaryResult, 0, len(m.prompts))
+	for _, prompt := range m.prompts {
+		result := m.check(ctx, prompt)
+		if ctx.Err() != nil {
+			return results, ctx.Err()
+		}
+		results = append(results, result)
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			return results, fmt.Errorf("failed to encode canary result: %w", err)
+		}
+		if err := m.client.HSet(ctx, resultsKey, result.Name, data).Err(); err != nil {
+			return results, fmt.Errorf("failed to save canary result: %w", err)
+		}
+
+		wasPassing, seen := passed[result.Name]
+		switch {
+		case !result.Passed && (wasPassing || !seen):
+			m.alert(models.CanaryAlert{Level: models.CanaryFailing, Result: result})
+		case result.Passed && seen && !wasPassing:
+			m.alert(models.CanaryAlert{Level: models.CanaryRecovered, Result: result})
+		}
+	}
+	return results, nil
+}
+
+// Results returns the latest result of every canary, by name
+func (m *Monitor) Results(ctx context.Context) ([]models.CanaryResult, error) {
+	values, err := m.client.HGetAll(ctx, resultsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get canary results: %w", err)
+	}
+
+	results := make([]models.CanaryResult, 0, len(values))
+	for _, value := range values {
+		var result models.CanaryResult
+		if err := json.Unmarshal([]byte(value), &result); err == nil {
+			results = append(results, result)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results, nil
+}
+
+// check sends one canary prompt and compares the answer with the expected one
+func (m *Monitor) check(ctx context.Context, prompt config.CanaryPromptConfig) models.CanaryResult {
+	result := models.CanaryResult{Name: prompt.Name, Similarity: 1}
+
+	start := m.clock.Now()
+	response, err := m.run(ctx, models.InferenceRequest{Query: prompt.Query, ModelPreference: prompt.ModelPreference})
+	result.CheckedAt = m.clock.Now()
+	result.LatencyMs = float64(result.CheckedAt.Sub(start).Microseconds()) / 1000
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Response = response.Response
+	result.Model = response.ModelUsed
+	result.Tier = response.Tier
+
+	answer := strings.ToLower(response.Response)
+	for _, phrase := range prompt.Contains {
+		if !strings.Contains(answer, strings.ToLower(phrase)) {
+			result.MissingPhrases = append(result.MissingPhrases, phrase)
+		}
+	}
+	if prompt.Expected != "" {
+		result.Similarity, result.Method = m.similarity(ctx, prompt.Expected, response.Response)
+	}
+	result.Passed = len(result.MissingPhrases) == 0 && result.Similarity >= m.minScore
+	return result
+}
+
+// similarity compares two answers by their embeddings, or by their words when
+// they can't be embedded
+func (m *Monitor) similarity(ctx context.Context, expected string, answer string) (float64, string) {
+	if m.embedder != nil {
+		want, err := m.embedder.Embed(ctx, expected)
+		if err == nil {
+			var got []float32
+			if got, err = m.embedder.Embed(ctx, answer); err == nil {
+				return cache.CosineSimilarity(want, got), MethodEmbedding
+			}
+		}
+		log.Printf("Failed to embed canary answer, comparing words instead: %v", err)
+	}
+	return wordOverlap(expected, answer), MethodWordOverlap
+}
+
+func (m *Monitor) alert(alert models.CanaryAlert) {
+	if alert.Level == models.CanaryFailing {
+		reason := alert.Result.Error
+		if reason == "" {
+			reason = fmt.Sprintf("similarity %.2f, missing %v", alert.Result.Similarity, alert.Result.MissingPhrases)
+		}
+		log.Printf("🐤 Canary %s failing: %s", alert.Result.Name, reason)
+	} else {
+		log.Printf("🐤 Canary %s recovered", alert.Result.Name)
+	}
+	for _, fn := range m.alerts {
+		fn(alert)
+	}
+}
+
+// wordOverlap is the Jaccard similarity of two texts' words
+func wordOverlap(a string, b string) float64 {
+	wordsA, wordsB := words(a), words(b)
+	if len(wordsA) == 0 && len(wordsB) == 0 {
+		return 1
+	}
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wordsA)+len(wordsB)-shared)
+}
+
+func words(text string) map[string]bool {
+	set := make(map[string]bool)
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		if word = strings.Trim(word, ".,;:!?\"'()"); word != "" {
+			set[word] = true
+		}
+	}
+	return set
+}
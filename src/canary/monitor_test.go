@@ -0,0 +1,114 @@
+package canary
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func newTestMonitor(t *testing.T, answer *string, failure *error) *Monitor {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+	t.Cleanup(mr.Close)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	run := func(ctx context.Context, req models.InferenceRequest) (*models.InferenceResponse, error) {
+		if *failure != nil {
+			return nil, *failure
+		}
+		return &models.InferenceResponse{Response: *answer, ModelUsed: "llama-3.1-8b-instant", Tier: "edge-slm"}, nil
+	}
+	return NewMonitor(client, config.CanaryConfig{
+		Threshold: 0.5,
+		Prompts: []config.CanaryPromptConfig{{
+			Name:     "capital",
+			Query:    "What is the capital of France?",
+			Expected: "The capital of France is Paris.",
+			Contains: []string{"paris"},
+		}},
+	}, run, nil)
+}
+
+func TestMonitor_AlertsOnDriftAndRecovery(t *testing.T) {
+	answer := "The capital of France is Paris."
+	var failure error
+	monitor := newTestMonitor(t, &answer, &failure)
+	var alerts []models.CanaryAlert
+	monitor.OnAlert(func(alert models.CanaryAlert) { alerts = append(alerts, alert) })
+	ctx := context.Background()
+
+	results, err := monitor.Check(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Passed)
+	assert.Equal(t, 1.0, results[0].Similarity)
+	assert.Equal(t, MethodWordOverlap, results[0].Method)
+	assert.Empty(t, alerts)
+
+	answer = "I think it might be Lyon."
+	results, err = monitor.Check(ctx)
+	require.NoError(t, err)
+	assert.False(t, results[0].Passed)
+	assert.Equal(t, []string{"paris"}, results[0].MissingPhrases)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, models.CanaryFailing, alerts[0].Level)
+
+	failure = errors.New("status 502: provider down")
+	_, err = monitor.Check(ctx)
+	require.NoError(t, err)
+	assert.Len(t, alerts, 1, "no repeated alert while still failing")
+
+	failure = nil
+	answer = "Paris is the capital of France."
+	_, err = monitor.Check(ctx)
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	assert.Equal(t, models.CanaryRecovered, alerts[1].Level)
+
+	stored, err := monitor.Results(ctx)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.True(t, stored[0].Passed)
+	assert.Equal(t, "llama-3.1-8b-instant", stored[0].Model)
+}
+
+func TestMonitor_SkipsWhileAnotherInstanceChecks(t *testing.T) {
+	answer := "Paris"
+	var failure error
+	monitor := newTestMonitor(t, &answer, &failure)
+	require.NoError(t, monitor.client.Set(context.Background(), lockKey, "1", 0).Err())
+
+	results, err := monitor.Check(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, results)
+}
+
+func TestMonitor_ReleasesOnlyItsOwnLock(t *testing.T) {
+	answer := "Paris"
+	var failure error
+	monitor := newTestMonitor(t, &answer, &failure)
+	ctx := context.Background()
+
+	results, err := monitor.Check(ctx)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+	exists, err := monitor.client.Exists(ctx, lockKey).Result()
+	require.NoError(t, err)
+	assert.Zero(t, exists, "released after the check")
+
+	// Another instance's lock survives a release
+	require.NoError(t, monitor.client.Set(ctx, lockKey, "other", 0).Err())
+	require.NoError(t, unlockScript.Run(ctx, monitor.client, []string{lockKey}, "mine").Err())
+	owner, err := monitor.client.Get(ctx, lockKey).Result()
+	require.NoError(t, err)
+	assert.Equal(t, "other", owner)
+}
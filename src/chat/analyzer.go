@@ -0,0 +1,385 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+const (
+	analyticsKeyPrefix      = "session_analytics:"
+	analyticsPendingKey     = "session_analytics:pending" // Sorted set of sessions to analyze scored by when they changed (Unix ms)
+	defaultAnalyticsEvery   = time.Minute
+	analyticsBatchSize      = 50
+	maxTopics               = 3
+	maxTopicLength          = 40 // Characters
+	sentimentTrendThreshold = 0.2
+	topicsReservedTokens    = 256  // Of a context window, for the instructions and the labels
+	defaultTranscriptTokens = 7936 // The default context window less topicsReservedTokens
+
+	topicInstructions = "List at most three short topic labels, of one to three words each, for the conversation the user shares. Reply with the labels only, separated by commas."
+)
+
+var (
+	positiveWords = wordSet("thanks", "thank", "great", "perfect", "awesome", "helpful", "excellent", "love", "good", "nice", "works", "worked", "solved", "amazing", "appreciate", "glad", "happy", "clear")
+	negativeWords = wordSet("bad", "wrong", "useless", "terrible", "awful", "hate", "annoying", "frustrated", "frustrating", "broken", "worse", "worst", "confusing", "angry", "disappointed", "ridiculous", "stupid", "fails", "failed", "doesn't")
+
+	escalationPhrases = []string{
+		"speak to a human", "talk to a human", "real person", "human agent", "live agent",
+		"speak to someone", "talk to someone", "customer service", "customer support",
+		"your manager", "a manager", "supervisor", "file a complaint", "this is ridiculous",
+		"not helpful", "useless",
+	}
+	inabilityPhrases = []string{
+		"i don't know", "i do not know", "i'm not sure", "i am not sure", "i can't", "i cannot",
+		"i'm unable", "i am unable", "i don't have access", "i don't have information",
+		"unable to help", "not able to help",
+	}
+)
+
+// Analyzer computes per-session analytics in the background: topic labels
+// from the SLM, and sentiment, escalations and unresolved questions from the
+// messages themselves. Sessions are queued with MarkDirty after they change.
+type Analyzer struct {
+	client   *redis.Client
+	sessions *SessionStore
+	slm      models.SLMInferencer // Optional; without it sessions have no topics
+	consent  func(ctx context.Context, userID string) bool
+	clock    clock.Clock
+	interval time.Duration
+	ttl      time.Duration
+
+	transcriptTokens int // Most tokens of a conversation sent to label it
+}
+
+func NewAnalyzer(client *redis.Client, sessions *SessionStore, slm models.SLMInferencer, interval time.Duration) *Analyzer {
+	if interval <= 0 {
+		interval = defaultAnalyticsEvery
+	}
+	return &Analyzer{
+		client:   client,
+		sessions: sessions,
+		slm:      slm,
+		clock:    clock.Real(),
+		interval: interval,
+		ttl:      sessions.ttl,
+
+		transcriptTokens: defaultTranscriptTokens,
+	}
+}
+
+// SetConsent skips the sessions of users who opted out of analytics, and
+// drops what was computed for them before
+func (a *Analyzer) SetConsent(allowed func(ctx context.Context, userID string) bool) {
+	a.consent = allowed
+}
+
+// SetContextWindow fits the transcripts sent to label conversations into a
+// context window of tokens, keeping their latest messages
+func (a *Analyzer) SetContextWindow(tokens int) {
+	if tokens > topicsReservedTokens {
+		a.transcriptTokens = tokens - topicsReservedTokens
+	}
+}
+
+// Allowed reports whether the user's sessions may be analyzed
+func (a *Analyzer) Allowed(ctx context.Context, userID string) bool {
+	return a.consent == nil || a.consent(ctx, userID)
+}
+
+// SetClock sets the clock analytics are timestamped with
+func (a *Analyzer) SetClock(c clock.Clock) {
+	a.clock = c
+}
+
+// MarkDirty queues a session to be analyzed on the next run
+func (a *Analyzer) MarkDirty(ctx context.Context, sessionID string) error {
+	if a == nil {
+		return nil
+	}
+	score := float64(a.clock.Now().UnixMilli())
+	return a.client.ZAdd(ctx, analyticsPendingKey, redis.Z{Score: score, Member: sessionID}).Err()
+}
+
+// Run analyzes the queued sessions every interval until ctx is done
+func (a *Analyzer) Run(ctx context.Context) {
+	for {
+		if analyzed, err := a.AnalyzePending(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Session analytics failed after %d sessions: %v", analyzed, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(a.interval):
+		}
+	}
+}
+
+// AnalyzePending analyzes the queued sessions and returns how many were
+// analyzed. Each session is claimed before it's analyzed, so instances
+// running side by side don't analyze the same one.
+func (a *Analyzer) AnalyzePending(ctx context.Context) (int, error) {
+	analyzed := 0
+	for {
+		ids, err := a.client.ZRange(ctx, analyticsPendingKey, 0, analyticsBatchSize-1).Result()
+		if err != nil {
+			return analyzed, fmt.Errorf("failed to list pending sessions: %w", err)
+		}
+		if len(ids) == 0 {
+			return analyzed, nil
+		}
+
+		for _, id := range ids {
+			claimed, err := a.client.ZRem(ctx, analyticsPendingKey, id).Result()
+			if err != nil {
+				return analyzed, fmt.Errorf("failed to claim session: %w", err)
+			}
+			if claimed == 0 {
+				continue
+			}
+
+			session, err := a.sessions.GetSession(ctx, id)
+			if errors.Is(err, ErrSessionNotFound) {
+				a.client.Del(ctx, analyticsKeyPrefix+id)
+				continue
+			}
+			if err != nil {
+				return analyzed, err
+			}
+			if !a.Allowed(ctx, session.UserID) {
+				a.client.Del(ctx, analyticsKeyPrefix+id)
+				continue
+			}
+			if err := a.save(ctx, a.Analyze(ctx, session)); err != nil {
+				return analyzed, err
+			}
+			analyzed++
+		}
+	}
+}
+
+// Get returns the stored analytics of a session, or nil if it hasn't been
+// analyzed yet
+func (a *Analyzer) Get(ctx context.Context, sessionID string) (*models.SessionAnalytics, error) {
+	data, err := a.client.Get(ctx, analyticsKeyPrefix+sessionID).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get session analytics: %w", err)
+	}
+
+	var analytics models.SessionAnalytics
+	if err := json.Unmarshal(data, &analytics); err != nil {
+		return nil, fmt.Errorf("failed to decode session analytics: %w", err)
+	}
+	return &analytics, nil
+}
+
+// Analyze computes the analytics of a session
+func (a *Analyzer) Analyze(ctx context.Context, session *models.ChatSession) *models.SessionAnalytics {
+	analytics := &models.SessionAnalytics{
+		SessionID:           session.SessionID,
+		Topics:              a.topics(ctx, session.Messages),
+		Sentiment:           []float64{},
+		UnresolvedQuestions: []string{},
+		MessageCount:        session.MessageCount,
+		ComputedAt:          a.clock.Now(),
+	}
+
+	for i, message := range session.Messages {
+		if message.Role != "user" {
+			continue
+		}
+		analytics.Sentiment = append(analytics.Sentiment, sentiment(message.Content))
+		if isEscalation(message.Content) {
+			analytics.Escalations++
+		}
+		if isQuestion(message.Content) && !answered(session.Messages[i+1:]) {
+			analytics.UnresolvedQuestions = append(analytics.UnresolvedQuestions, message.Content)
+		}
+	}
+	analytics.SentimentTrend = sentimentTrend(analytics.Sentiment)
+	return analytics
+}
+
+func (a *Analyzer) save(ctx context.Context, analytics *models.SessionAnalytics) error {
+	data, err := json.Marshal(analytics)
+	if err != nil {
+		return fmt.Errorf("failed to encode session analytics: %w", err)
+	}
+	if err := a.client.Set(ctx, analyticsKeyPrefix+analytics.SessionID, data, a.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save session analytics: %w", err)
+	}
+	return nil
+}
+
+// topics asks the SLM to label a conversation; it returns none if the SLM
+// fails
+func (a *Analyzer) topics(ctx context.Context, messages []models.ChatMessage) []string {
+	topics := []string{}
+	if a.slm == nil {
+		return topics
+	}
+
+	transcript := recentTranscript(messages, a.transcriptTokens)
+	if transcript == "" {
+		return topics
+	}
+
+	result, err := a.slm.InferChat(ctx, []models.ChatMessage{
+		{Role: "system", Content: topicInstructions},
+		{Role: "user", Content: transcript},
+	}, models.ChatOptions{MaxTokens: 30, Temperature: 0.2})
+	if err != nil {
+		return topics
+	}
+
+	line, _, _ := strings.Cut(strings.TrimSpace(result.Response), "\n")
+	line = strings.TrimPrefix(line, "Topics:")
+	for _, label := range strings.Split(line, ",") {
+		label = strings.Trim(strings.Join(strings.Fields(label), " "), " \"'`*.")
+		if label == "" || len([]rune(label)) > maxTopicLength {
+			continue
+		}
+		topics = append(topics, strings.ToLower(label))
+		if len(topics) == maxTopics {
+			break
+		}
+	}
+	return topics
+}
+
+// recentTranscript writes out the latest user and assistant messages that fit
+// in budget tokens, oldest first. The last message is cut if it doesn't fit
+// on its own.
+func recentTranscript(messages []models.ChatMessage, budget int) string {
+	var lines []string
+	used := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		message := messages[i]
+		if message.Role != "user" && message.Role != "assistant" {
+			continue
+		}
+		line := fmt.Sprintf("%s: %s\n", strings.ToUpper(message.Role[:1])+message.Role[1:], message.Content)
+		tokens := utils.CountTokens(line, "")
+		if used+tokens > budget {
+			if len(lines) == 0 {
+				lines = append(lines, cutToTokens(line, budget))
+			}
+			break
+		}
+		used += tokens
+		lines = append(lines, line)
+	}
+	slices.Reverse(lines)
+	return strings.Join(lines, "")
+}
+
+// cutToTokens shortens text to at most budget tokens
+func cutToTokens(text string, budget int) string {
+	for tokens := utils.CountTokens(text, ""); tokens > budget; tokens = utils.CountTokens(text, "") {
+		text = strings.ToValidUTF8(text[:len(text)*budget/tokens], "")
+	}
+	return text
+}
+
+// sentiment scores text from -1 to 1 by its positive and negative words
+func sentiment(text string) float64 {
+	positive, negative := 0, 0
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		switch {
+		case positiveWords[word]:
+			positive++
+		case negativeWords[word]:
+			negative++
+		}
+	}
+	if positive+negative == 0 {
+		return 0
+	}
+	// Two decimals are plenty for a heuristic
+	return math.Round(float64(positive-negative)/float64(positive+negative)*100) / 100
+}
+
+// sentimentTrend compares the average sentiment of the second half of a
+// conversation with the first
+func sentimentTrend(scores []float64) string {
+	if len(scores) < 2 {
+		return models.SentimentStable
+	}
+	half := len(scores) / 2
+	change := average(scores[len(scores)-half:]) - average(scores[:half])
+	switch {
+	case change >= sentimentTrendThreshold:
+		return models.SentimentImproving
+	case change <= -sentimentTrendThreshold:
+		return models.SentimentDeclining
+	default:
+		return models.SentimentStable
+	}
+}
+
+func isEscalation(text string) bool {
+	return containsAny(strings.ToLower(text), escalationPhrases)
+}
+
+func isQuestion(text string) bool {
+	return strings.Contains(text, "?")
+}
+
+// answered reports whether the assistant answered what comes before the
+// messages following it: the next assistant message, before the user's next
+// one, exists and doesn't say it can't answer
+func answered(following []models.ChatMessage) bool {
+	for _, message := range following {
+		switch message.Role {
+		case "assistant":
+			return !containsAny(strings.ToLower(message.Content), inabilityPhrases)
+		case "user":
+			return false
+		}
+	}
+	return false
+}
+
+func containsAny(text string, phrases []string) bool {
+	for _, phrase := range phrases {
+		if strings.Contains(text, phrase) {
+			return true
+		}
+	}
+	return false
+}
+
+func average(values []float64) float64 {
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func wordSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}
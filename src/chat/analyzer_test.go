@@ -0,0 +1,113 @@
+package chat
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+func TestAnalyzer_AnalyzesDirtySessions(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetResponder(func(req *models.InferenceRequest) string {
+		return "Billing, Refunds, \"Account access\"\nThese are the topics."
+	})
+	analyzer := NewAnalyzer(store.client, store, slm, 0)
+
+	session, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	turns := []struct{ role, content string }{
+		{"user", "Thanks, how do I get a refund?"},
+		{"assistant", "Open the billing page and pick the charge."},
+		{"user", "Why was I charged twice?"},
+		{"assistant", "I'm not sure, I don't have access to your payments."},
+		{"user", "This is useless and wrong, let me speak to a human"},
+	}
+	for _, turn := range turns {
+		require.NoError(t, store.AddMessage(ctx, session.SessionID, turn.role, turn.content, 10))
+	}
+
+	analytics, err := analyzer.Get(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.Nil(t, analytics, "not analyzed until marked dirty")
+
+	require.NoError(t, analyzer.MarkDirty(ctx, session.SessionID))
+	require.NoError(t, analyzer.MarkDirty(ctx, "expired"))
+	analyzed, err := analyzer.AnalyzePending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, analyzed)
+
+	analytics, err = analyzer.Get(ctx, session.SessionID)
+	require.NoError(t, err)
+	require.NotNil(t, analytics)
+	assert.Equal(t, []string{"billing", "refunds", "account access"}, analytics.Topics)
+	assert.Equal(t, []float64{1, 0, -1}, analytics.Sentiment)
+	assert.Equal(t, models.SentimentDeclining, analytics.SentimentTrend)
+	assert.Equal(t, 1, analytics.Escalations)
+	assert.Equal(t, []string{"Why was I charged twice?"}, analytics.UnresolvedQuestions)
+	assert.Equal(t, 5, analytics.MessageCount)
+
+	analyzed, err = analyzer.AnalyzePending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, analyzed, "the queue was drained")
+}
+
+func TestAnalyzer_NoTopicsWithoutSLM(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	analytics := NewAnalyzer(store.client, store, nil, 0).Analyze(context.Background(), &models.ChatSession{
+		SessionID: "s1",
+		Messages:  []models.ChatMessage{{Role: "user", Content: "Can you help?"}},
+	})
+	assert.Empty(t, analytics.Topics)
+	assert.Equal(t, models.SentimentStable, analytics.SentimentTrend)
+	assert.Equal(t, []string{"Can you help?"}, analytics.UnresolvedQuestions, "nothing answered it")
+}
+
+func TestAnalyzer_SkipsUsersWhoOptedOut(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	analyzer := NewAnalyzer(store.client, store, nil, 0)
+	session, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	require.NoError(t, store.AddMessage(ctx, session.SessionID, "user", "Hi", 1))
+	require.NoError(t, analyzer.MarkDirty(ctx, session.SessionID))
+	_, err = analyzer.AnalyzePending(ctx)
+	require.NoError(t, err)
+
+	// Opting out drops the analytics computed before
+	analyzer.SetConsent(func(ctx context.Context, userID string) bool { return userID != "alice" })
+	require.NoError(t, analyzer.MarkDirty(ctx, session.SessionID))
+	analyzed, err := analyzer.AnalyzePending(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, analyzed)
+	analytics, err := analyzer.Get(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.Nil(t, analytics)
+}
+
+func TestRecentTranscript(t *testing.T) {
+	messages := []models.ChatMessage{
+		{Role: "user", Content: strings.Repeat("old ", 100)},
+		{Role: "assistant", Content: "Short answer"},
+		{Role: "system", Content: "Summary of earlier messages"},
+		{Role: "user", Content: "Latest question"},
+	}
+
+	transcript := recentTranscript(messages, 20)
+	assert.Equal(t, "Assistant: Short answer\nUser: Latest question\n", transcript, "the latest messages that fit, oldest first")
+	assert.LessOrEqual(t, utils.CountTokens(recentTranscript(messages[:1], 10), ""), 10, "a message too long on its own is cut")
+}
@@ -0,0 +1,200 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	bulkBatchSize     = 200
+	progressBatchSize = 50 // Sessions processed between progress reports
+)
+
+var (
+	// ErrInvalidFilter is returned for session filters that can't be applied
+	ErrInvalidFilter = errors.New("invalid session filter")
+	// ErrEmptyFilter is returned for bulk operations on every session; at
+	// least one filter field must be set
+	ErrEmptyFilter = errors.New("session filter must set at least one field")
+)
+
+// ValidateBulk checks a bulk session request before it is queued
+func ValidateBulk(req models.BulkSessionRequest) error {
+	filter := req.Filter
+	if filter.OlderThan == "" && filter.Tag == "" && filter.Project == "" && filter.Archived == nil {
+		return ErrEmptyFilter
+	}
+	if _, err := idleFor(filter); err != nil {
+		return err
+	}
+	if req.Action == models.BulkActionTag && len(req.Tags) == 0 {
+		return fmt.Errorf("%w: tags are required to tag sessions", ErrInvalidFilter)
+	}
+	return nil
+}
+
+func idleFor(filter models.SessionFilter) (time.Duration, error) {
+	if filter.OlderThan == "" {
+		return 0, nil
+	}
+	idle, err := time.ParseDuration(filter.OlderThan)
+	if err != nil || idle <= 0 {
+		return 0, fmt.Errorf("%w: older_than must be a positive duration like \"720h\"", ErrInvalidFilter)
+	}
+	return idle, nil
+}
+
+// MatchSessions returns the IDs of the user's sessions, active or archived,
+// that the filter selects
+func (s *SessionStore) MatchSessions(ctx context.Context, userID string, filter models.SessionFilter) ([]string, error) {
+	idle, err := idleFor(filter)
+	if err != nil {
+		return nil, err
+	}
+	now := s.clock.Now()
+	if err := s.restoreIndexes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// Unpinned sessions idle for longer than the TTL have expired
+	minScore := strconv.FormatInt(now.Add(-s.ttl).UnixMilli(), 10)
+	var ids []string
+	for _, index := range []struct{ key, min string }{
+		{pinnedSessionsKeyPrefix + userID, "-inf"},
+		{userSessionsKeyPrefix + userID, minScore},
+		{archivedSessionsKeyPrefix + userID, "-inf"},
+	} {
+		members, err := s.client.ZRangeByScore(ctx, index.key, &redis.ZRangeBy{Min: index.min, Max: "+inf"}).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to match sessions: %w", err)
+		}
+		ids = append(ids, members...)
+	}
+
+	var matched []string
+	for batch := range slices.Chunk(ids, bulkBatchSize) {
+		keys := make([]string, len(batch))
+		for i, id := range batch {
+			keys[i] = sessionKeyPrefix + id
+		}
+		values, err := s.client.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to match sessions: %w", err)
+		}
+		for i, value := range values {
+			session, err := s.decodeOrLoad(ctx, value, batch[i])
+			if err != nil {
+				return nil, fmt.Errorf("failed to match sessions: %w", err)
+			}
+			if session == nil || session.UserID != userID {
+				continue
+			}
+			switch {
+			case idle > 0 && session.LastInteraction.After(now.Add(-idle)):
+			case filter.Tag != "" && !slices.Contains(session.Tags, filter.Tag):
+			case filter.Project != "" && session.Project != filter.Project:
+			case filter.Archived != nil && session.Archived != *filter.Archived:
+			default:
+				matched = append(matched, session.SessionID)
+			}
+		}
+	}
+	return matched, nil
+}
+
+// BulkUpdate applies a bulk action to the user's sessions the request's
+// filter selects. progress is called as sessions are processed, and once
+// they all are.
+func (s *SessionStore) BulkUpdate(ctx context.Context, userID string, req models.BulkSessionRequest, progress func(result models.BulkSessionResult)) (*models.BulkSessionResult, error) {
+	ids, err := s.MatchSessions(ctx, userID, req.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.BulkSessionResult{Action: req.Action, Matched: len(ids)}
+	progress(*result)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		switch req.Action {
+		case models.BulkActionDelete:
+			err = s.DeleteSession(ctx, id)
+		case models.BulkActionArchive:
+			_, err = s.ArchiveSession(ctx, id, true)
+		case models.BulkActionUnarchive:
+			_, err = s.ArchiveSession(ctx, id, false)
+		case models.BulkActionTag:
+			_, err = s.TagSession(ctx, id, req.Tags)
+		default:
+			return result, fmt.Errorf("unknown bulk action %q", req.Action)
+		}
+		// Sessions deleted meanwhile are skipped
+		if err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return result, err
+		}
+
+		result.Processed++
+		if result.Processed%progressBatchSize == 0 {
+			progress(*result)
+		}
+	}
+	progress(*result)
+	return result, nil
+}
+
+// ArchiveSession archives or restores the session. Archived sessions are
+// unpinned, listed apart and kept until deleted; restoring one counts as an
+// interaction, so the inactivity TTL starts over.
+func (s *SessionStore) ArchiveSession(ctx context.Context, sessionID string, archived bool) (*models.ChatSession, error) {
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Archived == archived {
+		return session, nil
+	}
+
+	session.Archived = archived
+	if archived {
+		session.Pinned = false
+	} else {
+		session.LastInteraction = s.clock.Now()
+	}
+	if err := s.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// TagSession adds tags the session doesn't have yet
+func (s *SessionStore) TagSession(ctx context.Context, sessionID string, tags []string) (*models.ChatSession, error) {
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := false
+	for _, tag := range tags {
+		if !slices.Contains(session.Tags, tag) {
+			session.Tags = append(session.Tags, tag)
+			changed = true
+		}
+	}
+	if !changed {
+		return session, nil
+	}
+	if err := s.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestSessionStore_BulkUpdate(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	fakeClock := clock.NewFake(time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC))
+	store.SetClock(fakeClock)
+	store.SetTTL(30 * 24 * time.Hour)
+	ctx := context.Background()
+
+	old, err := store.CreateProjectSession(ctx, "alice", "", "work")
+	require.NoError(t, err)
+	pinned, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	_, err = store.PinSession(ctx, pinned.SessionID, true)
+	require.NoError(t, err)
+	other, err := store.CreateSession(ctx, "bob")
+	require.NoError(t, err)
+	_, err = store.PinSession(ctx, other.SessionID, true)
+	require.NoError(t, err)
+	fakeClock.Advance(48 * time.Hour)
+	recent, err := store.CreateProjectSession(ctx, "alice", "", "work")
+	require.NoError(t, err)
+
+	var reports []models.BulkSessionResult
+	progress := func(result models.BulkSessionResult) { reports = append(reports, result) }
+	result, err := store.BulkUpdate(ctx, "alice", models.BulkSessionRequest{
+		Action: models.BulkActionArchive,
+		Filter: models.SessionFilter{OlderThan: "24h"},
+	}, progress)
+	require.NoError(t, err)
+	assert.Equal(t, models.BulkSessionResult{Action: models.BulkActionArchive, Matched: 2, Processed: 2}, *result)
+	assert.Equal(t, 0, reports[0].Processed)
+	assert.Equal(t, *result, reports[len(reports)-1])
+
+	page, err := store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, recent.SessionID, page.Sessions[0].SessionID)
+	archived, err := store.ListArchivedSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, archived.Sessions, 2)
+	assert.False(t, archived.Sessions[0].Pinned, "archiving unpins")
+
+	// Archived sessions don't expire
+	fakeClock.Advance(60 * 24 * time.Hour)
+	mr.FastForward(60 * 24 * time.Hour)
+	_, err = store.GetSession(ctx, old.SessionID)
+	require.NoError(t, err)
+
+	isArchived := true
+	_, err = store.BulkUpdate(ctx, "alice", models.BulkSessionRequest{
+		Action: models.BulkActionTag,
+		Filter: models.SessionFilter{Project: "work", Archived: &isArchived},
+		Tags:   []string{"q2", "q2"},
+	}, progress)
+	require.NoError(t, err)
+	tagged, err := store.GetSession(ctx, old.SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"q2"}, tagged.Tags)
+
+	result, err = store.BulkUpdate(ctx, "alice", models.BulkSessionRequest{
+		Action: models.BulkActionDelete,
+		Filter: models.SessionFilter{Tag: "q2"},
+	}, progress)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Processed)
+	_, err = store.GetSession(ctx, old.SessionID)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	_, err = store.GetSession(ctx, other.SessionID)
+	assert.NoError(t, err, "other users' sessions are left alone")
+
+	_, err = store.MatchSessions(ctx, "alice", models.SessionFilter{OlderThan: "soon"})
+	assert.ErrorIs(t, err, ErrInvalidFilter)
+}
+
+func TestValidateBulk(t *testing.T) {
+	assert.ErrorIs(t, ValidateBulk(models.BulkSessionRequest{Action: models.BulkActionDelete}), ErrEmptyFilter)
+	assert.ErrorIs(t, ValidateBulk(models.BulkSessionRequest{
+		Action: models.BulkActionDelete,
+		Filter: models.SessionFilter{OlderThan: "-1h"},
+	}), ErrInvalidFilter)
+	assert.ErrorIs(t, ValidateBulk(models.BulkSessionRequest{
+		Action: models.BulkActionTag,
+		Filter: models.SessionFilter{Project: "work"},
+	}), ErrInvalidFilter)
+	assert.NoError(t, ValidateBulk(models.BulkSessionRequest{
+		Action: models.BulkActionArchive,
+		Filter: models.SessionFilter{OlderThan: "720h"},
+	}))
+}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	turnClaimKeyPrefix  = "chat_turn:"
+	turnResultKeyPrefix = "chat_turn_result:"
+
+	dedupWindow      = 10 * time.Second // Identical turns within this window are collapsed
+	maxTurnDuration  = 2 * time.Minute  // Upper bound on a generation, so a crashed claim can't block forever
+	turnPollInterval = 100 * time.Millisecond
+)
+
+// ErrTurnFailed is returned to a duplicate turn when the original request failed
+var ErrTurnFailed = errors.New("original request for this message failed")
+
+// TurnDeduplicator collapses identical chat turns sent to the same session in
+// quick succession (e.g. a double-click) into a single generation. The first
+// request claims the turn; duplicates wait for and share its response.
+type TurnDeduplicator struct {
+	client *redis.Client
+}
+
+func NewTurnDeduplicator(client *redis.Client) *TurnDeduplicator {
+	return &TurnDeduplicator{
+		client: client,
+	}
+}
+
+// Claim returns true if this is the first request with this message in the
+// session within the dedup window
+func (d *TurnDeduplicator) Claim(ctx context.Context, sessionID string, message string) (bool, error) {
+	claimed, err := d.client.SetNX(ctx, turnKey(turnClaimKeyPrefix, sessionID, message), "pending", maxTurnDuration).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim chat turn: %w", err)
+	}
+	return claimed, nil
+}
+
+// Complete publishes the response to waiting duplicates and keeps the claim
+// for the dedup window so later double-submits get the same answer
+func (d *TurnDeduplicator) Complete(ctx context.Context, sessionID string, message string, response *models.ChatResponse) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return fmt.Errorf("failed to marshal chat turn: %w", err)
+	}
+
+	pipe := d.client.TxPipeline()
+	pipe.Set(ctx, turnKey(turnResultKeyPrefix, sessionID, message), data, dedupWindow)
+	pipe.Expire(ctx, turnKey(turnClaimKeyPrefix, sessionID, message), dedupWindow)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to complete chat turn: %w", err)
+	}
+	return nil
+}
+
+// Release drops the claim after a failed generation so the user can retry
+func (d *TurnDeduplicator) Release(ctx context.Context, sessionID string, message string) error {
+	return d.client.Del(ctx, turnKey(turnClaimKeyPrefix, sessionID, message)).Err()
+}
+
+// Wait blocks until the original request completes and returns its response
+func (d *TurnDeduplicator) Wait(ctx context.Context, sessionID string, message string) (*models.ChatResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, maxTurnDuration)
+	defer cancel()
+
+	resultKey := turnKey(turnResultKeyPrefix, sessionID, message)
+	claimKey := turnKey(turnClaimKeyPrefix, sessionID, message)
+
+	ticker := time.NewTicker(turnPollInterval)
+	defer ticker.Stop()
+
+	for {
+		data, err := d.client.Get(ctx, resultKey).Bytes()
+		if err == nil {
+			var response models.ChatResponse
+			if err := json.Unmarshal(data, &response); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal chat turn: %w", err)
+			}
+			return &response, nil
+		}
+		if err != redis.Nil {
+			return nil, fmt.Errorf("failed to get chat turn: %w", err)
+		}
+
+		// No result and no claim: the original request gave up
+		exists, err := d.client.Exists(ctx, claimKey).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get chat turn: %w", err)
+		}
+		if exists == 0 {
+			return nil, ErrTurnFailed
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func turnKey(prefix string, sessionID string, message string) string {
+	sum := sha256.Sum256([]byte(message))
+	return prefix + sessionID + ":" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupTestDeduplicator(t *testing.T) (*TurnDeduplicator, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewTurnDeduplicator(client), mr
+}
+
+func TestTurnDeduplicator_DuplicateWaitsForOriginal(t *testing.T) {
+	dedup, _ := setupTestDeduplicator(t)
+	ctx := context.Background()
+
+	claimed, err := dedup.Claim(ctx, "sess_1", "hello")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	claimed, err = dedup.Claim(ctx, "sess_1", "hello")
+	require.NoError(t, err)
+	assert.False(t, claimed)
+
+	// A different message or session is not a duplicate
+	claimed, err = dedup.Claim(ctx, "sess_1", "hello again")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+	claimed, err = dedup.Claim(ctx, "sess_2", "hello")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = dedup.Complete(ctx, "sess_1", "hello", &models.ChatResponse{SessionID: "sess_1", Response: "Hi!"})
+	}()
+
+	response, err := dedup.Wait(ctx, "sess_1", "hello")
+	require.NoError(t, err)
+	assert.Equal(t, "Hi!", response.Response)
+}
+
+func TestTurnDeduplicator_ReleasedClaim(t *testing.T) {
+	dedup, mr := setupTestDeduplicator(t)
+	ctx := context.Background()
+
+	_, err := dedup.Claim(ctx, "sess_1", "hello")
+	require.NoError(t, err)
+	require.NoError(t, dedup.Release(ctx, "sess_1", "hello"))
+
+	_, err = dedup.Wait(ctx, "sess_1", "hello")
+	assert.ErrorIs(t, err, ErrTurnFailed)
+
+	// After a completed turn the window expires and the message can be sent again
+	_, err = dedup.Claim(ctx, "sess_1", "hello")
+	require.NoError(t, err)
+	require.NoError(t, dedup.Complete(ctx, "sess_1", "hello", &models.ChatResponse{Response: "Hi!"}))
+	mr.FastForward(dedupWindow + time.Second)
+
+	claimed, err := dedup.Claim(ctx, "sess_1", "hello")
+	require.NoError(t, err)
+	assert.True(t, claimed)
+}
@@ -0,0 +1,118 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	ExportFormatMarkdown = "markdown"
+	ExportFormatJSON     = "json"
+)
+
+// NewExport snapshots the session for sharing or archiving. Each message
+// carries the session's running cost up to and including it.
+func NewExport(session *models.ChatSession, exportedAt time.Time) *models.SessionExport {
+	export := &models.SessionExport{
+		SessionID:       session.SessionID,
+		Title:           session.Title,
+		SystemPrompt:    session.SystemPrompt,
+		CreatedAt:       session.CreatedAt,
+		LastInteraction: session.LastInteraction,
+		ExportedAt:      exportedAt,
+		MessageCount:    session.MessageCount,
+		TotalTokens:     session.TotalTokens,
+		TotalCost:       session.TotalCost,
+		Messages:        make([]models.ExportedMessage, len(session.Messages)),
+	}
+	// Summaries are system messages and aren't counted as messages
+	stored := 0
+	for _, message := range session.Messages {
+		if message.Role != "system" {
+			stored++
+		}
+	}
+	if omitted := session.MessageCount - stored; omitted > 0 {
+		export.OmittedMessages = omitted
+	}
+
+	// Older messages may have been trimmed or summarized away, so the running
+	// cost is worked back from the session total
+	cumulative := session.TotalCost
+	for i := len(session.Messages) - 1; i >= 0; i-- {
+		message := session.Messages[i]
+		export.Messages[i] = models.ExportedMessage{ChatMessage: message, CumulativeCost: cumulative}
+		cumulative -= message.Cost
+	}
+
+	seen := make(map[string]bool)
+	for _, message := range session.Messages {
+		if message.Model != "" && !seen[message.Model] {
+			seen[message.Model] = true
+			export.Models = append(export.Models, message.Model)
+		}
+	}
+	return export
+}
+
+// RenderMarkdown renders the export as a Markdown transcript
+func RenderMarkdown(export *models.SessionExport) string {
+	var b strings.Builder
+
+	title := export.Title
+	if title == "" {
+		title = "Chat session " + export.SessionID
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "- Session: `%s`\n", export.SessionID)
+	fmt.Fprintf(&b, "- Started: %s\n", formatExportTime(export.CreatedAt))
+	fmt.Fprintf(&b, "- Last message: %s\n", formatExportTime(export.LastInteraction))
+	fmt.Fprintf(&b, "- Exported: %s\n", formatExportTime(export.ExportedAt))
+	fmt.Fprintf(&b, "- Messages: %d\n", export.MessageCount)
+	if len(export.Models) > 0 {
+		fmt.Fprintf(&b, "- Models: %s\n", strings.Join(export.Models, ", "))
+	}
+	fmt.Fprintf(&b, "- Tokens: %d\n", export.TotalTokens)
+	fmt.Fprintf(&b, "- Total cost: %s\n", formatExportCost(export.TotalCost))
+
+	if export.SystemPrompt != "" {
+		fmt.Fprintf(&b, "\n## System prompt\n\n%s\n", export.SystemPrompt)
+	}
+	if export.OmittedMessages > 0 {
+		fmt.Fprintf(&b, "\n_%d earlier messages are no longer stored and are not included._\n", export.OmittedMessages)
+	}
+
+	for _, message := range export.Messages {
+		fmt.Fprintf(&b, "\n## %s · %s\n\n", exportRole(message.Role), formatExportTime(message.Timestamp))
+		if message.Model != "" {
+			fmt.Fprintf(&b, "_%s · %s · %s so far_\n\n", message.Model, formatExportCost(message.Cost), formatExportCost(message.CumulativeCost))
+		}
+		b.WriteString(strings.TrimSpace(message.Content))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func exportRole(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	case "system":
+		return "System"
+	default:
+		return role
+	}
+}
+
+func formatExportTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+func formatExportCost(cost float64) string {
+	return fmt.Sprintf("$%.6f", cost)
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+)
+
+func TestExport(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	started := time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(started)
+	store.SetClock(fakeClock)
+	ctx := context.Background()
+
+	session, err := store.CreateSessionWithPrompt(ctx, "alice", "Be brief.")
+	require.NoError(t, err)
+	_, err = store.RenameSession(ctx, session.SessionID, "Go questions")
+	require.NoError(t, err)
+
+	fakeClock.Advance(time.Minute)
+	require.NoError(t, store.AddMessage(ctx, session.SessionID, "user", "What is Go?", 3))
+	require.NoError(t, store.AddAnswer(ctx, session.SessionID, "A programming language.", 4, "llama-3.1-8b-instant", 0.0001))
+	fakeClock.Advance(time.Minute)
+	require.NoError(t, store.AddMessage(ctx, session.SessionID, "user", "Who made it?", 3))
+	require.NoError(t, store.AddAnswer(ctx, session.SessionID, "Google.", 2, "gpt-4o", 0.002))
+
+	session, err = store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.InDelta(t, 0.0021, session.TotalCost, 1e-9)
+
+	export := NewExport(session, started.Add(time.Hour))
+	assert.Equal(t, "Go questions", export.Title)
+	assert.Equal(t, 4, export.MessageCount)
+	assert.Zero(t, export.OmittedMessages)
+	assert.Equal(t, []string{"llama-3.1-8b-instant", "gpt-4o"}, export.Models)
+	require.Len(t, export.Messages, 4)
+	assert.InDelta(t, 0.0001, export.Messages[1].CumulativeCost, 1e-9)
+	assert.InDelta(t, 0.0021, export.Messages[3].CumulativeCost, 1e-9)
+
+	markdown := RenderMarkdown(export)
+	assert.Contains(t, markdown, "# Go questions\n")
+	assert.Contains(t, markdown, "- Models: llama-3.1-8b-instant, gpt-4o\n")
+	assert.Contains(t, markdown, "## System prompt\n\nBe brief.\n")
+	assert.Contains(t, markdown, "## User · 2026-07-01 10:01:00 UTC\n\nWhat is Go?\n")
+	assert.Contains(t, markdown, "_gpt-4o · $0.002000 · $0.002100 so far_\n\nGoogle.\n")
+	assert.NotContains(t, markdown, "no longer stored")
+}
+
+func TestExport_OmittedMessages(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	session, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	for i := 0; i < maxContextWindow/2+1; i++ {
+		require.NoError(t, store.AddMessage(ctx, session.SessionID, "user", "Hi", 1))
+		require.NoError(t, store.AddAnswer(ctx, session.SessionID, "Hello!", 1, "gpt-4o", 0.001))
+	}
+
+	session, err = store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+
+	export := NewExport(session, time.Now())
+	assert.Equal(t, 2, export.OmittedMessages)
+	assert.InDelta(t, 0.001, export.Messages[0].CumulativeCost, 1e-9, "running cost includes the trimmed answer")
+	assert.InDelta(t, 0.011, export.Messages[len(export.Messages)-1].CumulativeCost, 1e-9)
+	assert.Contains(t, RenderMarkdown(export), "_2 earlier messages are no longer stored and are not included._")
+}
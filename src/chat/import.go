@@ -0,0 +1,251 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+// Conversation export formats accepted by POST /chat/import
+const (
+	ImportFormatChatGPT = "chatgpt" // conversations.json of a ChatGPT data export
+	ImportFormatClaude  = "claude"  // conversations.json of a Claude data export
+)
+
+// ErrUnknownImportFormat is returned for exports in neither supported format
+var ErrUnknownImportFormat = errors.New("unrecognized conversation export")
+
+// Conversation is a conversation read from another assistant's export
+type Conversation struct {
+	Title     string
+	CreatedAt time.Time
+	Messages  []models.ChatMessage
+}
+
+// ParseExport reads the conversations of a ChatGPT or Claude export: an
+// array of conversations or a single one. An empty format detects it.
+func ParseExport(data []byte, format string) ([]Conversation, error) {
+	data = bytes.TrimSpace(data)
+	var raw []json.RawMessage
+	if len(data) > 0 && data[0] == '{' {
+		raw = []json.RawMessage{data}
+	} else if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnknownImportFormat, err)
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	if format == "" {
+		format = detectFormat(raw[0])
+	}
+	parse := parseChatGPT
+	switch format {
+	case ImportFormatChatGPT:
+	case ImportFormatClaude:
+		parse = parseClaude
+	default:
+		return nil, ErrUnknownImportFormat
+	}
+
+	conversations := make([]Conversation, 0, len(raw))
+	for i, item := range raw {
+		conversation, err := parse(item)
+		if err != nil {
+			return nil, fmt.Errorf("%w: conversation %d: %v", ErrUnknownImportFormat, i, err)
+		}
+		conversations = append(conversations, conversation)
+	}
+	return conversations, nil
+}
+
+func detectFormat(item json.RawMessage) string {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(item, &fields) != nil {
+		return ""
+	}
+	if _, ok := fields["mapping"]; ok {
+		return ImportFormatChatGPT
+	}
+	if _, ok := fields["chat_messages"]; ok {
+		return ImportFormatClaude
+	}
+	return ""
+}
+
+// chatGPTConversation is a conversation of a ChatGPT export: a tree of
+// messages, branching where answers were regenerated or prompts edited
+type chatGPTConversation struct {
+	Title       string                 `json:"title"`
+	CreateTime  float64                `json:"create_time"`
+	CurrentNode string                 `json:"current_node"`
+	Mapping     map[string]chatGPTNode `json:"mapping"`
+}
+
+type chatGPTNode struct {
+	Parent  string `json:"parent"`
+	Message *struct {
+		Author struct {
+			Role string `json:"role"`
+		} `json:"author"`
+		CreateTime float64 `json:"create_time"`
+		Content    struct {
+			Parts []json.RawMessage `json:"parts"`
+		} `json:"content"`
+		Metadata struct {
+			ModelSlug string `json:"model_slug"`
+			Hidden    bool   `json:"is_visually_hidden_from_conversation"`
+		} `json:"metadata"`
+	} `json:"message"`
+}
+
+// parseChatGPT follows the branch that was shown last, from its end up
+func parseChatGPT(data json.RawMessage) (Conversation, error) {
+	var export chatGPTConversation
+	if err := json.Unmarshal(data, &export); err != nil {
+		return Conversation{}, err
+	}
+	conversation := Conversation{Title: export.Title, CreatedAt: unixSeconds(export.CreateTime)}
+
+	seen := make(map[string]bool)
+	for id := export.CurrentNode; id != "" && !seen[id]; id = export.Mapping[id].Parent {
+		seen[id] = true
+		message := export.Mapping[id].Message
+		if message == nil || message.Metadata.Hidden {
+			continue
+		}
+		role := message.Author.Role
+		if role != "user" && role != "assistant" {
+			continue
+		}
+
+		// Parts other than text, like images, are left out
+		var texts []string
+		for _, part := range message.Content.Parts {
+			var text string
+			if json.Unmarshal(part, &text) == nil && strings.TrimSpace(text) != "" {
+				texts = append(texts, text)
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		chatMessage := models.ChatMessage{
+			Role:      role,
+			Content:   strings.Join(texts, "\n"),
+			Timestamp: unixSeconds(message.CreateTime),
+		}
+		if role == "assistant" {
+			chatMessage.Model = message.Metadata.ModelSlug
+		}
+		conversation.Messages = append(conversation.Messages, chatMessage)
+	}
+	slices.Reverse(conversation.Messages)
+	return conversation, nil
+}
+
+// claudeConversation is a conversation of a Claude export
+type claudeConversation struct {
+	Name         string    `json:"name"`
+	CreatedAt    time.Time `json:"created_at"`
+	ChatMessages []struct {
+		Sender    string    `json:"sender"` // "human" or "assistant"
+		Text      string    `json:"text"`
+		CreatedAt time.Time `json:"created_at"`
+		Content   []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"chat_messages"`
+}
+
+func parseClaude(data json.RawMessage) (Conversation, error) {
+	var export claudeConversation
+	if err := json.Unmarshal(data, &export); err != nil {
+		return Conversation{}, err
+	}
+	conversation := Conversation{Title: export.Name, CreatedAt: export.CreatedAt}
+
+	for _, message := range export.ChatMessages {
+		role := "user"
+		if message.Sender == "assistant" {
+			role = "assistant"
+		}
+		text := message.Text
+		if strings.TrimSpace(text) == "" {
+			var texts []string
+			for _, block := range message.Content {
+				if block.Type == "text" && strings.TrimSpace(block.Text) != "" {
+					texts = append(texts, block.Text)
+				}
+			}
+			text = strings.Join(texts, "\n")
+		}
+		if strings.TrimSpace(text) == "" {
+			continue
+		}
+		conversation.Messages = append(conversation.Messages, models.ChatMessage{
+			Role:      role,
+			Content:   text,
+			Timestamp: message.CreatedAt,
+		})
+	}
+	return conversation, nil
+}
+
+// NewImportedSession turns a conversation into a session of the user, last
+// used now so it doesn't expire right away. It isn't saved yet, nor trimmed
+// to the context window, so it can be summarized first.
+func NewImportedSession(userID string, conversation Conversation, now time.Time) *models.ChatSession {
+	createdAt := conversation.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+	session := &models.ChatSession{
+		SessionID:       "sess_" + uuid.New().String(),
+		UserID:          userID,
+		Messages:        make([]models.ChatMessage, 0, len(conversation.Messages)),
+		CreatedAt:       createdAt,
+		LastInteraction: now,
+		ModelPreference: "auto",
+		Title:           cleanTitle(conversation.Title),
+	}
+	for _, message := range conversation.Messages {
+		message.ID = "msg_" + uuid.New().String()
+		if message.Timestamp.IsZero() {
+			message.Timestamp = createdAt
+		}
+		session.Messages = append(session.Messages, message)
+		session.TotalTokens += utils.CountTokens(message.Content, message.Model)
+	}
+	session.MessageCount = len(session.Messages)
+	return session
+}
+
+// ImportSession saves an imported session, keeping only the most recent
+// messages of the context window
+func (s *SessionStore) ImportSession(ctx context.Context, session *models.ChatSession) error {
+	if len(session.Messages) > maxContextWindow {
+		session.Messages = session.Messages[len(session.Messages)-maxContextWindow:]
+	}
+	return s.SaveSession(ctx, session)
+}
+
+func unixSeconds(seconds float64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+	whole, fraction := math.Modf(seconds)
+	return time.Unix(int64(whole), int64(fraction*1e9)).UTC()
+}
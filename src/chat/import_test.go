@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const chatGPTExport = `[{
+	"title": "Sourdough tips",
+	"create_time": 1714557600.5,
+	"current_node": "c",
+	"mapping": {
+		"root": {"parent": null, "message": null},
+		"sys": {"parent": "root", "message": {"author": {"role": "system"}, "content": {"parts": [""]}}},
+		"a": {"parent": "sys", "message": {"author": {"role": "user"}, "create_time": 1714557601, "content": {"parts": ["Why is my bread dense?"]}}},
+		"b-old": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"parts": ["Regenerated away"]}}},
+		"b": {"parent": "a", "message": {"author": {"role": "assistant"}, "content": {"parts": ["Let it proof longer.", {"asset_pointer": "file-1"}]}, "metadata": {"model_slug": "gpt-4o"}}},
+		"c": {"parent": "b", "message": {"author": {"role": "tool"}, "content": {"parts": ["search results"]}}}
+	}
+}]`
+
+const claudeExport = `[{
+	"uuid": "1",
+	"name": "Trip planning",
+	"created_at": "2024-05-01T10:00:00.000000Z",
+	"chat_messages": [
+		{"sender": "human", "text": "Plan a day in Lisbon", "created_at": "2024-05-01T10:00:01Z"},
+		{"sender": "assistant", "text": "", "content": [{"type": "text", "text": "Start in Alfama."}], "created_at": "2024-05-01T10:00:05Z"}
+	]
+}]`
+
+func TestParseExport(t *testing.T) {
+	conversations, err := ParseExport([]byte(chatGPTExport), "")
+	require.NoError(t, err)
+	require.Len(t, conversations, 1)
+	conversation := conversations[0]
+	assert.Equal(t, "Sourdough tips", conversation.Title)
+	assert.Equal(t, time.Date(2024, 5, 1, 10, 0, 0, 5e8, time.UTC), conversation.CreatedAt)
+	require.Len(t, conversation.Messages, 2, "only the branch shown last, without system and tool messages")
+	assert.Equal(t, "Why is my bread dense?", conversation.Messages[0].Content)
+	assert.Equal(t, "Let it proof longer.", conversation.Messages[1].Content)
+	assert.Equal(t, "gpt-4o", conversation.Messages[1].Model)
+
+	conversations, err = ParseExport([]byte(claudeExport), "")
+	require.NoError(t, err)
+	require.Len(t, conversations, 1)
+	conversation = conversations[0]
+	assert.Equal(t, "Trip planning", conversation.Title)
+	require.Len(t, conversation.Messages, 2)
+	assert.Equal(t, "user", conversation.Messages[0].Role)
+	assert.Equal(t, "assistant", conversation.Messages[1].Role)
+	assert.Equal(t, "Start in Alfama.", conversation.Messages[1].Content)
+
+	// A single conversation is accepted too
+	conversations, err = ParseExport([]byte(strings.Trim(claudeExport, "[]")), ImportFormatClaude)
+	require.NoError(t, err)
+	assert.Len(t, conversations, 1)
+
+	_, err = ParseExport([]byte(`[{"messages": []}]`), "")
+	assert.ErrorIs(t, err, ErrUnknownImportFormat)
+	_, err = ParseExport([]byte(`not json`), "")
+	assert.ErrorIs(t, err, ErrUnknownImportFormat)
+}
+
+func TestSessionStore_ImportSession(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+	ctx := context.Background()
+
+	conversation := Conversation{Title: "Long chat", CreatedAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for i := range maxContextWindow + 5 {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		conversation.Messages = append(conversation.Messages, models.ChatMessage{Role: role, Content: fmt.Sprintf("message %d", i)})
+	}
+
+	now := time.Now()
+	session := NewImportedSession("alice", conversation, now)
+	assert.Equal(t, conversation.CreatedAt, session.CreatedAt)
+	assert.Equal(t, now, session.LastInteraction, "imported sessions don't expire right away")
+	assert.Equal(t, maxContextWindow+5, session.MessageCount)
+	assert.Positive(t, session.TotalTokens)
+	require.NoError(t, store.ImportSession(ctx, session))
+
+	saved, err := store.GetSessionForUser(ctx, session.SessionID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "Long chat", saved.Title)
+	require.Len(t, saved.Messages, maxContextWindow)
+	assert.Equal(t, "message 5", saved.Messages[0].Content)
+	assert.NotEmpty(t, saved.Messages[0].ID)
+
+	page, err := store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	assert.Len(t, page.Sessions, 1)
+}
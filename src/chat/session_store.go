@@ -2,44 +2,132 @@ package chat
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
 )
 
 const (
-	sessionKeyPrefix = "chat_session:"
-	sessionTTL       = 24 * time.Hour // Sessions expire after 24 hours of inactivity
-	maxContextWindow = 20             // Keep last 20 messages for context
+	sessionKeyPrefix          = "chat_session:"
+	userSessionsKeyPrefix     = "chat_sessions:"          // Sorted set of a user's session IDs scored by last interaction (Unix ms)
+	pinnedSessionsKeyPrefix   = "chat_sessions_pinned:"   // Like userSessionsKeyPrefix, for pinned sessions; never expires
+	archivedSessionsKeyPrefix = "chat_sessions_archived:" // Like pinnedSessionsKeyPrefix, for archived sessions
+	defaultSessionTTL         = 24 * time.Hour            // Sessions expire after 24 hours of inactivity
+	maxContextWindow          = 20                        // Keep last 20 messages for context
 )
 
+var (
+	// ErrSessionNotFound is returned when a session doesn't exist or has expired
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSessionForbidden is returned when a session belongs to another user
+	ErrSessionForbidden = errors.New("session belongs to another user")
+	// ErrInvalidCursor is returned when a session list cursor can't be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrMessageNotFound is returned when a message is no longer in the session
+	ErrMessageNotFound = errors.New("message not found")
+)
+
+// SessionDatabase keeps sessions durably behind Redis, which then caches them
+type SessionDatabase interface {
+	// LoadSession returns nil if the session doesn't exist or has expired
+	LoadSession(ctx context.Context, sessionID string) (*models.ChatSession, error)
+	// SaveSession keeps the session until expiresAt, or until it's deleted if zero
+	SaveSession(ctx context.Context, session *models.ChatSession, expiresAt time.Time) error
+	DeleteSession(ctx context.Context, sessionID string) error
+	// ListUserSessions returns the user's sessions that haven't expired
+	ListUserSessions(ctx context.Context, userID string) ([]*models.ChatSession, error)
+}
+
 type SessionStore struct {
-	client *redis.Client
+	client   *redis.Client
+	reader   redis.Cmdable // Serves views and lists; the client unless replicas are set
+	clock    clock.Clock
+	ttl      time.Duration   // Inactivity after which unpinned sessions expire
+	database SessionDatabase // Durable copy of every session, optional
 }
 
 func NewSessionStore(client *redis.Client) *SessionStore {
 	return &SessionStore{
 		client: client,
+		reader: client,
+		clock:  clock.Real(),
+		ttl:    defaultSessionTTL,
+	}
+}
+
+// SetTTL sets how long unpinned sessions are kept after their last
+// interaction; 0 or less keeps the default of 24 hours
+func (s *SessionStore) SetTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultSessionTTL
+	}
+	s.ttl = ttl
+}
+
+// keyTTL is the expiry of the session's key: none when it's pinned or archived
+func (s *SessionStore) keyTTL(session *models.ChatSession) time.Duration {
+	if session.Pinned || session.Archived {
+		return 0
 	}
+	return s.ttl
+}
+
+// SetReader sends session views and lists to read replicas. Updates read
+// the session from the primary so they never build on a lagging copy.
+func (s *SessionStore) SetReader(reader redis.Cmdable) {
+	s.reader = reader
 }
 
-// CreateSession creates a new chat session
-func (s *SessionStore) CreateSession(ctx context.Context) (*models.ChatSession, error) {
+// SetClock sets the clock used to timestamp sessions and messages
+func (s *SessionStore) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetDatabase saves every session to the database as well, and reads
+// sessions and session lists Redis lost back from it
+func (s *SessionStore) SetDatabase(database SessionDatabase) {
+	s.database = database
+}
+
+// CreateSession creates a new chat session owned by the given user
+func (s *SessionStore) CreateSession(ctx context.Context, userID string) (*models.ChatSession, error) {
+	return s.CreateSessionWithPrompt(ctx, userID, "")
+}
+
+// CreateSessionWithPrompt creates a new chat session whose inferences start
+// with the system prompt
+func (s *SessionStore) CreateSessionWithPrompt(ctx context.Context, userID string, systemPrompt string) (*models.ChatSession, error) {
+	return s.CreateProjectSession(ctx, userID, systemPrompt, "")
+}
+
+// CreateProjectSession creates a new chat session in a project, whose
+// inferences start with the system prompt
+func (s *SessionStore) CreateProjectSession(ctx context.Context, userID string, systemPrompt string, project string) (*models.ChatSession, error) {
 	sessionID := "sess_" + uuid.New().String()
+	now := s.clock.Now()
 
 	session := &models.ChatSession{
 		SessionID:       sessionID,
+		UserID:          userID,
 		Messages:        []models.ChatMessage{},
-		CreatedAt:       time.Now(),
-		LastInteraction: time.Now(),
+		CreatedAt:       now,
+		LastInteraction: now,
 		TotalTokens:     0,
 		MessageCount:    0,
 		ModelPreference: "auto",
+		SystemPrompt:    systemPrompt,
+		Project:         project,
 	}
 
 	if err := s.SaveSession(ctx, session); err != nil {
@@ -51,11 +139,30 @@ func (s *SessionStore) CreateSession(ctx context.Context) (*models.ChatSession,
 
 // GetSession retrieves a session by ID
 func (s *SessionStore) GetSession(ctx context.Context, sessionID string) (*models.ChatSession, error) {
+	return s.getSession(ctx, s.client, sessionID)
+}
+
+// ViewSession retrieves a session for display, checking that it belongs to
+// the user. It may be served by a read replica and lag recent writes slightly.
+func (s *SessionStore) ViewSession(ctx context.Context, sessionID string, userID string) (*models.ChatSession, error) {
+	session, err := s.getSession(ctx, s.reader, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.UserID != userID {
+		return nil, ErrSessionForbidden
+	}
+
+	return session, nil
+}
+
+func (s *SessionStore) getSession(ctx context.Context, client redis.Cmdable, sessionID string) (*models.ChatSession, error) {
 	key := sessionKeyPrefix + sessionID
 
-	data, err := s.client.Get(ctx, key).Result()
+	data, err := client.Get(ctx, key).Result()
 	if err == redis.Nil {
-		return nil, fmt.Errorf("session not found")
+		return s.loadSession(ctx, sessionID)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get session: %w", err)
@@ -69,8 +176,65 @@ func (s *SessionStore) GetSession(ctx context.Context, sessionID string) (*model
 	return &session, nil
 }
 
+// loadSession reads a session missing from Redis from the database and
+// caches it again
+func (s *SessionStore) loadSession(ctx context.Context, sessionID string) (*models.ChatSession, error) {
+	if s.database == nil {
+		return nil, ErrSessionNotFound
+	}
+	session, err := s.database.LoadSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil || s.expired(session) {
+		return nil, ErrSessionNotFound
+	}
+	if err := s.cacheSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// expired reports whether an unpinned session has been idle for longer than the TTL
+func (s *SessionStore) expired(session *models.ChatSession) bool {
+	return s.keyTTL(session) > 0 && !s.clock.Now().Before(session.LastInteraction.Add(s.ttl))
+}
+
+// GetSessionForUser retrieves a session and checks that it belongs to the user
+func (s *SessionStore) GetSessionForUser(ctx context.Context, sessionID string, userID string) (*models.ChatSession, error) {
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if session.UserID != userID {
+		return nil, ErrSessionForbidden
+	}
+
+	return session, nil
+}
+
 // SaveSession saves or updates a session
 func (s *SessionStore) SaveSession(ctx context.Context, session *models.ChatSession) error {
+	if err := s.saveToDatabase(ctx, session); err != nil {
+		return err
+	}
+	return s.cacheSession(ctx, session)
+}
+
+func (s *SessionStore) saveToDatabase(ctx context.Context, session *models.ChatSession) error {
+	if s.database == nil {
+		return nil
+	}
+	var expiresAt time.Time
+	if s.keyTTL(session) > 0 {
+		expiresAt = session.LastInteraction.Add(s.ttl)
+	}
+	return s.database.SaveSession(ctx, session, expiresAt)
+}
+
+// cacheSession writes a session and its owner's indexes to Redis
+func (s *SessionStore) cacheSession(ctx context.Context, session *models.ChatSession) error {
 	key := sessionKeyPrefix + session.SessionID
 
 	data, err := json.Marshal(session)
@@ -78,7 +242,32 @@ func (s *SessionStore) SaveSession(ctx context.Context, session *models.ChatSess
 		return fmt.Errorf("failed to marshal session: %w", err)
 	}
 
-	if err := s.client.Set(ctx, key, data, sessionTTL).Err(); err != nil {
+	// The owner's index of unpinned sessions expires with their most recently
+	// used one; pinned and archived sessions are indexed separately and kept
+	indexKey := userSessionsKeyPrefix + session.UserID
+	pinnedKey := pinnedSessionsKeyPrefix + session.UserID
+	archivedKey := archivedSessionsKeyPrefix + session.UserID
+	entry := redis.Z{Score: float64(session.LastInteraction.UnixMilli()), Member: session.SessionID}
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, key, data, s.keyTTL(session))
+		switch {
+		case session.Archived:
+			pipe.ZAdd(ctx, archivedKey, entry)
+			pipe.ZRem(ctx, indexKey, session.SessionID)
+			pipe.ZRem(ctx, pinnedKey, session.SessionID)
+		case session.Pinned:
+			pipe.ZAdd(ctx, pinnedKey, entry)
+			pipe.ZRem(ctx, indexKey, session.SessionID)
+			pipe.ZRem(ctx, archivedKey, session.SessionID)
+		default:
+			pipe.ZAdd(ctx, indexKey, entry)
+			pipe.Expire(ctx, indexKey, s.ttl)
+			pipe.ZRem(ctx, pinnedKey, session.SessionID)
+			pipe.ZRem(ctx, archivedKey, session.SessionID)
+		}
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to save session: %w", err)
 	}
 
@@ -87,70 +276,465 @@ func (s *SessionStore) SaveSession(ctx context.Context, session *models.ChatSess
 
 // AddMessage adds a message to the session and updates it
 func (s *SessionStore) AddMessage(ctx context.Context, sessionID string, role string, content string, tokens int) error {
+	return s.addMessage(ctx, sessionID, models.ChatMessage{Role: role, Content: content}, tokens)
+}
+
+// AddAnswer adds an assistant message along with the model that wrote it and
+// what it cost
+func (s *SessionStore) AddAnswer(ctx context.Context, sessionID string, content string, tokens int, model string, cost float64) error {
+	return s.addMessage(ctx, sessionID, models.ChatMessage{Role: "assistant", Content: content, Model: model, Cost: cost}, tokens)
+}
+
+func (s *SessionStore) addMessage(ctx context.Context, sessionID string, message models.ChatMessage, tokens int) error {
 	session, err := s.GetSession(ctx, sessionID)
 	if err != nil {
 		return err
 	}
 
-	message := models.ChatMessage{
-		Role:      role,
-		Content:   content,
-		Timestamp: time.Now(),
-	}
+	s.appendMessage(session, message, tokens)
+	return s.SaveSession(ctx, session)
+}
+
+// appendMessage adds message to the session, giving it an ID
+func (s *SessionStore) appendMessage(session *models.ChatSession, message models.ChatMessage, tokens int) {
+	message.ID = "msg_" + uuid.New().String()
+	message.Timestamp = s.clock.Now()
 
 	session.Messages = append(session.Messages, message)
-	session.LastInteraction = time.Now()
+	session.LastInteraction = s.clock.Now()
 	session.MessageCount++
 	session.TotalTokens += tokens
+	session.TotalCost += message.Cost
 
 	// Trim old messages if exceeding context window
 	if len(session.Messages) > maxContextWindow {
 		// Keep the most recent messages
 		session.Messages = session.Messages[len(session.Messages)-maxContextWindow:]
 	}
+}
 
-	return s.SaveSession(ctx, session)
+// Turn is a question and the answer to it, as added to a session
+type Turn struct {
+	Question       string
+	QuestionTokens int
+	Answer         string
+	AnswerTokens   int
+	Model          string  // Model that wrote the answer
+	Cost           float64 // What the answer cost
+}
+
+// RetakeTurn replaces the message at index and every message after it with
+// turn, in a single save once the new answer exists. messageID must be that
+// message's ID (empty for messages stored before messages had IDs), so a
+// session that changed since it was read isn't cut in the wrong place.
+// Tokens and cost already spent stay in the session's totals.
+func (s *SessionStore) RetakeTurn(ctx context.Context, sessionID string, index int, messageID string, turn Turn) (*models.ChatSession, error) {
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if index < 0 || index >= len(session.Messages) || session.Messages[index].ID != messageID {
+		return nil, ErrMessageNotFound
+	}
+
+	for _, message := range session.Messages[index:] {
+		if message.Role != "system" {
+			session.MessageCount--
+		}
+	}
+	session.Messages = session.Messages[:index]
+	s.appendMessage(session, models.ChatMessage{Role: "user", Content: turn.Question}, turn.QuestionTokens)
+	s.appendMessage(session, models.ChatMessage{Role: "assistant", Content: turn.Answer, Model: turn.Model, Cost: turn.Cost}, turn.AnswerTokens)
+
+	if err := s.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
 }
 
-// DeleteSession deletes a session
+// DeleteSession deletes a session and removes it from its owner's list
 func (s *SessionStore) DeleteSession(ctx context.Context, sessionID string) error {
 	key := sessionKeyPrefix + sessionID
 
-	if err := s.client.Del(ctx, key).Err(); err != nil {
+	session, err := s.GetSession(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if s.database != nil {
+		if err := s.database.DeleteSession(ctx, sessionID); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.ZRem(ctx, userSessionsKeyPrefix+session.UserID, sessionID)
+		pipe.ZRem(ctx, pinnedSessionsKeyPrefix+session.UserID, sessionID)
+		pipe.ZRem(ctx, archivedSessionsKeyPrefix+session.UserID, sessionID)
+		return nil
+	})
+	if err != nil {
 		return fmt.Errorf("failed to delete session: %w", err)
 	}
 
 	return nil
 }
 
-// GetRecentSessions returns all active session IDs (for admin/debugging)
-func (s *SessionStore) GetRecentSessions(ctx context.Context) ([]string, error) {
-	pattern := sessionKeyPrefix + "*"
+// ListSessions returns a page of at most limit active (not archived)
+// sessions owned by the user: pinned sessions first, then the others, each
+// most recently used first. An empty cursor starts at the top; the page's NextCursor continues
+// after its last session.
+func (s *SessionStore) ListSessions(ctx context.Context, userID string, limit int, cursor string) (*models.SessionPage, error) {
+	after := &cursorPosition{pinned: true}
+	if cursor != "" {
+		position, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = position
+	} else if err := s.restoreIndexes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	// Unpinned sessions idle for longer than the TTL have expired
+	indexKey := userSessionsKeyPrefix + userID
+	minScore := strconv.FormatInt(s.clock.Now().Add(-s.ttl).UnixMilli(), 10)
+	if err := s.client.ZRemRangeByScore(ctx, indexKey, "-inf", "("+minScore).Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	// Fetch one more than the page to know whether another page follows
+	var summaries []models.SessionSummary
+	var positions []cursorPosition
+	if after.pinned {
+		var err error
+		summaries, positions, err = s.scanIndex(ctx, pinnedSessionsKeyPrefix+userID, userID, "-inf", after, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		after = &cursorPosition{}
+	}
+	if len(summaries) <= limit {
+		more, morePositions, err := s.scanIndex(ctx, indexKey, userID, minScore, after, limit+1-len(summaries))
+		if err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, more...)
+		positions = append(positions, morePositions...)
+	}
+
+	page := &models.SessionPage{Sessions: summaries}
+	if page.Sessions == nil {
+		page.Sessions = []models.SessionSummary{}
+	}
+	if len(summaries) > limit {
+		page.Sessions = summaries[:limit]
+		page.NextCursor = encodeCursor(positions[limit-1])
+	}
+	return page, nil
+}
+
+// ListArchivedSessions returns a page of at most limit archived sessions
+// owned by the user, most recently used first, paged like ListSessions
+func (s *SessionStore) ListArchivedSessions(ctx context.Context, userID string, limit int, cursor string) (*models.SessionPage, error) {
+	after := &cursorPosition{}
+	if cursor != "" {
+		position, err := decodeCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		if position.pinned {
+			return nil, ErrInvalidCursor
+		}
+		after = position
+	} else if err := s.restoreIndexes(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	summaries, positions, err := s.scanIndex(ctx, archivedSessionsKeyPrefix+userID, userID, "-inf", after, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &models.SessionPage{Sessions: summaries}
+	if len(summaries) > limit {
+		page.Sessions = summaries[:limit]
+		page.NextCursor = encodeCursor(positions[limit-1])
+	}
+	return page, nil
+}
+
+// scanIndex returns up to count sessions of a session index, most recent
+// first, starting after the given position (an unset position starts at the
+// top). Sessions deleted or expired since they were indexed are skipped and
+// dropped from the index.
+func (s *SessionStore) scanIndex(ctx context.Context, indexKey string, userID string, minScore string, after *cursorPosition, count int) ([]models.SessionSummary, []cursorPosition, error) {
+	maxScore := "+inf"
+	if after.sessionID != "" {
+		maxScore = strconv.FormatInt(after.score, 10)
+	}
+
+	summaries := make([]models.SessionSummary, 0, count)
+	positions := make([]cursorPosition, 0, count)
+	var stale []interface{}
+	for offset := int64(0); len(summaries) < count; {
+		entries, err := s.reader.ZRevRangeByScoreWithScores(ctx, indexKey, &redis.ZRangeBy{
+			Min:    minScore,
+			Max:    maxScore,
+			Offset: offset,
+			Count:  int64(count),
+		}).Result()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		if len(entries) == 0 {
+			break
+		}
+		offset += int64(len(entries))
+
+		candidates := make([]cursorPosition, 0, len(entries))
+		keys := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			position := cursorPosition{pinned: after.pinned, score: int64(entry.Score), sessionID: entry.Member.(string)}
+			// Sessions with the same score are listed in reverse ID order
+			if after.sessionID != "" && position.score == after.score && position.sessionID >= after.sessionID {
+				continue
+			}
+			candidates = append(candidates, position)
+			keys = append(keys, sessionKeyPrefix+position.sessionID)
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		values, err := s.reader.MGet(ctx, keys...).Result()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		for i, value := range values {
+			session, err := s.decodeOrLoad(ctx, value, candidates[i].sessionID)
+			if err != nil {
+				return nil, nil, err
+			}
+			if session == nil || session.UserID != userID {
+				stale = append(stale, candidates[i].sessionID)
+				continue
+			}
+			if len(summaries) < count {
+				positions = append(positions, candidates[i])
+				summaries = append(summaries, summarize(session))
+			}
+		}
+	}
+	// Removed only now so the offsets above stay valid
+	if len(stale) > 0 {
+		if err := s.client.ZRem(ctx, indexKey, stale...).Err(); err != nil {
+			return nil, nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+	}
+	return summaries, positions, nil
+}
+
+// decodeOrLoad parses a session read with MGET, reading it from the database
+// if it's missing from Redis. Sessions that can't be found are nil.
+func (s *SessionStore) decodeOrLoad(ctx context.Context, value interface{}, sessionID string) (*models.ChatSession, error) {
+	if session, ok := decodeSession(value); ok {
+		return session, nil
+	}
+	session, err := s.loadSession(ctx, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return nil, nil
+	}
+	return session, err
+}
+
+// restoreIndexes rebuilds the user's session indexes from the database when
+// Redis has none of them, such as after they were evicted
+func (s *SessionStore) restoreIndexes(ctx context.Context, userID string) error {
+	if s.database == nil {
+		return nil
+	}
+	cached, err := s.client.Exists(ctx, userSessionsKeyPrefix+userID, pinnedSessionsKeyPrefix+userID, archivedSessionsKeyPrefix+userID).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list sessions: %w", err)
+	}
+	if cached > 0 {
+		return nil
+	}
+
+	sessions, err := s.database.ListUserSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if s.expired(session) {
+			continue
+		}
+		if err := s.cacheSession(ctx, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenameSession sets the session's title
+func (s *SessionStore) RenameSession(ctx context.Context, sessionID string, title string) (*models.ChatSession, error) {
+	session, err := s.GetSession(ctx, sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	session.Title = title
+	if err := s.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
 
-	keys, err := s.client.Keys(ctx, pattern).Result()
+// PinSession pins or unpins the session. Pinned sessions never expire and are
+// listed first; unpinning counts as an interaction, so the inactivity TTL
+// starts over. Pinning an archived session restores it.
+func (s *SessionStore) PinSession(ctx context.Context, sessionID string, pinned bool) (*models.ChatSession, error) {
+	session, err := s.GetSession(ctx, sessionID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get sessions: %w", err)
+		return nil, err
 	}
 
-	// Strip prefix from keys
-	sessionIDs := make([]string, len(keys))
-	for i, key := range keys {
-		sessionIDs[i] = key[len(sessionKeyPrefix):]
+	if session.Pinned && !pinned {
+		session.LastInteraction = s.clock.Now()
+	}
+	session.Pinned = pinned
+	if pinned {
+		session.Archived = false
+	}
+	if err := s.SaveSession(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// SetDefaultTitle sets the session's title unless it already has one, so a
+// generated title never replaces a rename. The session is watched so a
+// message added meanwhile isn't overwritten.
+func (s *SessionStore) SetDefaultTitle(ctx context.Context, sessionID string, title string) error {
+	key := sessionKeyPrefix + sessionID
+	if s.database != nil {
+		// Brings the session back into Redis if it was lost there
+		if _, err := s.GetSession(ctx, sessionID); err != nil {
+			return err
+		}
 	}
 
-	return sessionIDs, nil
+	var titled *models.ChatSession
+	setTitle := func(tx *redis.Tx) error {
+		data, err := tx.Get(ctx, key).Result()
+		if err == redis.Nil {
+			return ErrSessionNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get session: %w", err)
+		}
+
+		var session models.ChatSession
+		if err := json.Unmarshal([]byte(data), &session); err != nil {
+			return fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		if session.Title != "" {
+			return nil
+		}
+
+		session.Title = title
+		updated, err := json.Marshal(&session)
+		if err != nil {
+			return fmt.Errorf("failed to marshal session: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, updated, s.keyTTL(&session))
+			return nil
+		})
+		titled = &session
+		return err
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		err := s.client.Watch(ctx, setTitle, key)
+		if err == nil && titled != nil {
+			return s.saveToDatabase(ctx, titled)
+		}
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+	return fmt.Errorf("failed to set session title: %w", redis.TxFailedErr)
+}
+
+// ConversationMessages returns the session history to send along with the
+// next message, keeping each message's role
+func (s *SessionStore) ConversationMessages(session *models.ChatSession) []models.ChatMessage {
+	return slices.Clone(session.Messages)
+}
+
+// cursorPosition is the last session of a page in its owner's indexes
+type cursorPosition struct {
+	pinned    bool  // In the pinned sessions index
+	score     int64 // Last interaction, Unix ms
+	sessionID string
+}
+
+// encodeCursor makes an opaque cursor continuing after position
+func encodeCursor(position cursorPosition) string {
+	index := "r"
+	if position.pinned {
+		index = "p"
+	}
+	raw := index + ":" + strconv.FormatInt(position.score, 10) + ":" + position.sessionID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
 }
 
-// BuildConversationContext builds a conversation history string for the LLM
-func (s *SessionStore) BuildConversationContext(session *models.ChatSession) string {
-	if len(session.Messages) == 0 {
-		return ""
+func decodeCursor(cursor string) (*cursorPosition, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || (parts[0] != "p" && parts[0] != "r") || parts[2] == "" {
+		return nil, ErrInvalidCursor
+	}
+	score, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
 	}
+	return &cursorPosition{pinned: parts[0] == "p", score: score, sessionID: parts[2]}, nil
+}
 
-	context := "Previous conversation:\n"
-	for _, msg := range session.Messages {
-		context += fmt.Sprintf("%s: %s\n", msg.Role, msg.Content)
+// decodeSession parses a session read with MGET; missing and corrupt
+// sessions are not ok
+func decodeSession(value interface{}) (*models.ChatSession, bool) {
+	data, ok := value.(string)
+	if !ok {
+		return nil, false
 	}
 
-	return context
+	var session models.ChatSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, false
+	}
+	return &session, true
+}
+
+func summarize(session *models.ChatSession) models.SessionSummary {
+	return models.SessionSummary{
+		SessionID:       session.SessionID,
+		Title:           session.Title,
+		CreatedAt:       session.CreatedAt,
+		LastInteraction: session.LastInteraction,
+		MessageCount:    session.MessageCount,
+		Pinned:          session.Pinned,
+		Archived:        session.Archived,
+		Project:         session.Project,
+		Tags:            session.Tags,
+	}
 }
@@ -0,0 +1,390 @@
+package chat
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupTestStore(t *testing.T) (*SessionStore, *miniredis.Miniredis) {
+	mr, err := miniredis.Run()
+	require.NoError(t, err)
+
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+
+	return NewSessionStore(client), mr
+}
+
+func TestSessionStore_OwnerScoping(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	ctx := context.Background()
+
+	aliceSession, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	_, err = store.CreateSession(ctx, "bob")
+	require.NoError(t, err)
+
+	session, err := store.GetSessionForUser(ctx, aliceSession.SessionID, "alice")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", session.UserID)
+
+	_, err = store.GetSessionForUser(ctx, aliceSession.SessionID, "bob")
+	assert.ErrorIs(t, err, ErrSessionForbidden)
+
+	_, err = store.GetSessionForUser(ctx, "sess_missing", "alice")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+
+	page, err := store.ListSessions(ctx, "alice", 10, "")
+	assert.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, aliceSession.SessionID, page.Sessions[0].SessionID)
+}
+
+func TestSessionStore_Timestamps(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	created := time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(created)
+	store.SetClock(fakeClock)
+	ctx := context.Background()
+
+	session, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, created, session.CreatedAt)
+
+	fakeClock.Advance(time.Minute)
+	require.NoError(t, store.AddMessage(ctx, session.SessionID, "user", "Hi", 1))
+
+	session, err = store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.True(t, session.CreatedAt.Equal(created))
+	assert.True(t, session.LastInteraction.Equal(created.Add(time.Minute)))
+	assert.True(t, session.Messages[0].Timestamp.Equal(created.Add(time.Minute)))
+}
+
+func TestSessionStore_Titles(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	fakeClock := clock.NewFake(time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC))
+	store.SetClock(fakeClock)
+	ctx := context.Background()
+
+	older, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	fakeClock.Advance(time.Minute)
+	newer, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetDefaultTitle(ctx, older.SessionID, "Routing questions"))
+	_, err = store.RenameSession(ctx, newer.SessionID, "My notes")
+	require.NoError(t, err)
+	require.NoError(t, store.SetDefaultTitle(ctx, newer.SessionID, "Generated"), "renames aren't replaced")
+
+	page, err := store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	summaries := page.Sessions
+	require.Len(t, summaries, 2)
+	assert.Equal(t, newer.SessionID, summaries[0].SessionID, "most recent first")
+	assert.Equal(t, "My notes", summaries[0].Title)
+	assert.Equal(t, "Routing questions", summaries[1].Title)
+
+	assert.ErrorIs(t, store.SetDefaultTitle(ctx, "sess_missing", "Title"), ErrSessionNotFound)
+}
+
+func TestSessionStore_ListSessionsPages(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	fakeClock := clock.NewFake(time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC))
+	store.SetClock(fakeClock)
+	ctx := context.Background()
+
+	// Two sessions share a timestamp to check ties across pages
+	var created []string
+	for i := 0; i < 5; i++ {
+		if i != 3 {
+			fakeClock.Advance(time.Minute)
+		}
+		session, err := store.CreateSession(ctx, "alice")
+		require.NoError(t, err)
+		created = append(created, session.SessionID)
+	}
+	_, err := store.CreateSession(ctx, "bob")
+	require.NoError(t, err)
+	require.NoError(t, store.DeleteSession(ctx, created[4]))
+
+	var listed []string
+	cursor := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 4)
+		page, err := store.ListSessions(ctx, "alice", 2, cursor)
+		require.NoError(t, err)
+		assert.LessOrEqual(t, len(page.Sessions), 2)
+		for _, summary := range page.Sessions {
+			listed = append(listed, summary.SessionID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	require.Len(t, listed, 4)
+	assert.ElementsMatch(t, created[:4], listed)
+	assert.Equal(t, created[1], listed[2])
+	assert.Equal(t, created[0], listed[3])
+
+	_, err = store.ListSessions(ctx, "alice", 2, "not a cursor")
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestSessionStore_ListSessionsSkipsExpired(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	fakeClock := clock.NewFake(time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC))
+	store.SetClock(fakeClock)
+	ctx := context.Background()
+
+	expired, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	fakeClock.Advance(time.Hour)
+	active, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+
+	mr.Del(sessionKeyPrefix + expired.SessionID)
+
+	page, err := store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, active.SessionID, page.Sessions[0].SessionID)
+	assert.Empty(t, page.NextCursor)
+
+	members, err := mr.ZMembers(userSessionsKeyPrefix + "alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{active.SessionID}, members, "missing sessions are dropped from the index")
+}
+
+func TestSessionStore_TTLAndPinning(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	fakeClock := clock.NewFake(time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC))
+	store.SetClock(fakeClock)
+	store.SetTTL(time.Hour)
+	ctx := context.Background()
+
+	pinned, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	fakeClock.Advance(time.Minute)
+	recent, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, mr.TTL(sessionKeyPrefix+recent.SessionID))
+
+	session, err := store.PinSession(ctx, pinned.SessionID, true)
+	require.NoError(t, err)
+	assert.True(t, session.Pinned)
+	assert.Zero(t, mr.TTL(sessionKeyPrefix+pinned.SessionID), "pinned sessions don't expire")
+
+	// Pinned sessions come first even when older
+	page, err := store.ListSessions(ctx, "alice", 1, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, pinned.SessionID, page.Sessions[0].SessionID)
+	assert.True(t, page.Sessions[0].Pinned)
+	page, err = store.ListSessions(ctx, "alice", 1, page.NextCursor)
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, recent.SessionID, page.Sessions[0].SessionID)
+	assert.Empty(t, page.NextCursor)
+
+	// Messages keep a pinned session pinned
+	require.NoError(t, store.AddMessage(ctx, pinned.SessionID, "user", "Hi", 1))
+	assert.Zero(t, mr.TTL(sessionKeyPrefix+pinned.SessionID))
+
+	// Once the TTL passes only the pinned session is left
+	fakeClock.Advance(2 * time.Hour)
+	mr.FastForward(2 * time.Hour)
+	page, err = store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.Equal(t, pinned.SessionID, page.Sessions[0].SessionID)
+
+	_, err = store.PinSession(ctx, pinned.SessionID, false)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, mr.TTL(sessionKeyPrefix+pinned.SessionID))
+	page, err = store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+	assert.False(t, page.Sessions[0].Pinned)
+}
+
+func TestSessionStore_ReadsFromReplica(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	replica := miniredis.RunT(t)
+	reader := redis.NewClient(&redis.Options{Addr: replica.Addr()})
+	t.Cleanup(func() { reader.Close() })
+	store.SetReader(reader)
+	ctx := context.Background()
+
+	session, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+
+	// Updates read the primary; views and lists the lagging replica
+	require.NoError(t, store.AddMessage(ctx, session.SessionID, "user", "hello", 1))
+	_, err = store.ViewSession(ctx, session.SessionID, "alice")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	page, err := store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	assert.Empty(t, page.Sessions)
+
+	// Once replicated they see the session
+	value, err := mr.Get(sessionKeyPrefix + session.SessionID)
+	require.NoError(t, err)
+	require.NoError(t, replica.Set(sessionKeyPrefix+session.SessionID, value))
+	score, err := mr.ZScore(userSessionsKeyPrefix+"alice", session.SessionID)
+	require.NoError(t, err)
+	_, err = replica.ZAdd(userSessionsKeyPrefix+"alice", score, session.SessionID)
+	require.NoError(t, err)
+
+	viewed, err := store.ViewSession(ctx, session.SessionID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, viewed.MessageCount)
+	_, err = store.ViewSession(ctx, session.SessionID, "bob")
+	assert.ErrorIs(t, err, ErrSessionForbidden)
+	page, err = store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+}
+
+func TestSessionStore_RetakeTurn(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+
+	ctx := context.Background()
+	session, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	for _, content := range []string{"one", "two", "three", "four"} {
+		require.NoError(t, store.AddMessage(ctx, session.SessionID, "user", content, 1))
+	}
+	session, err = store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+	ids := make(map[string]bool)
+	for _, message := range session.Messages {
+		assert.NotEmpty(t, message.ID)
+		ids[message.ID] = true
+	}
+	assert.Len(t, ids, 4)
+
+	turn := Turn{Question: "three?", QuestionTokens: 1, Answer: "3", AnswerTokens: 1, Model: "llama-3.1-8b-instant", Cost: 0.01}
+	_, err = store.RetakeTurn(ctx, session.SessionID, 2, session.Messages[1].ID, turn)
+	assert.ErrorIs(t, err, ErrMessageNotFound, "ID of another message")
+	_, err = store.RetakeTurn(ctx, session.SessionID, 4, "", turn)
+	assert.ErrorIs(t, err, ErrMessageNotFound)
+	unchanged, err := store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+	assert.Len(t, unchanged.Messages, 4, "a failed retake leaves the session alone")
+
+	retaken, err := store.RetakeTurn(ctx, session.SessionID, 2, session.Messages[2].ID, turn)
+	require.NoError(t, err)
+	require.Len(t, retaken.Messages, 4)
+	assert.Equal(t, "two", retaken.Messages[1].Content)
+	assert.Equal(t, "three?", retaken.Messages[2].Content)
+	assert.Equal(t, "3", retaken.Messages[3].Content)
+	assert.Equal(t, "llama-3.1-8b-instant", retaken.Messages[3].Model)
+	assert.Equal(t, 4, retaken.MessageCount)
+	assert.Equal(t, 6, retaken.TotalTokens, "spent tokens are kept")
+}
+
+// memorySessionDatabase is a SessionDatabase in memory
+type memorySessionDatabase struct {
+	sessions map[string]models.ChatSession
+}
+
+func (d *memorySessionDatabase) LoadSession(ctx context.Context, sessionID string) (*models.ChatSession, error) {
+	session, ok := d.sessions[sessionID]
+	if !ok {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+func (d *memorySessionDatabase) SaveSession(ctx context.Context, session *models.ChatSession, expiresAt time.Time) error {
+	d.sessions[session.SessionID] = *session
+	return nil
+}
+
+func (d *memorySessionDatabase) DeleteSession(ctx context.Context, sessionID string) error {
+	delete(d.sessions, sessionID)
+	return nil
+}
+
+func (d *memorySessionDatabase) ListUserSessions(ctx context.Context, userID string) ([]*models.ChatSession, error) {
+	var sessions []*models.ChatSession
+	for _, session := range d.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, &session)
+		}
+	}
+	return sessions, nil
+}
+
+func TestSessionStore_Database(t *testing.T) {
+	store, mr := setupTestStore(t)
+	defer mr.Close()
+	database := &memorySessionDatabase{sessions: make(map[string]models.ChatSession)}
+	store.SetDatabase(database)
+	fakeClock := clock.NewFake(time.Date(2026, 7, 1, 10, 0, 0, 0, time.UTC))
+	store.SetClock(fakeClock)
+	ctx := context.Background()
+
+	kept, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	require.NoError(t, store.AddMessage(ctx, kept.SessionID, "user", "Hi", 1))
+	_, err = store.PinSession(ctx, kept.SessionID, true)
+	require.NoError(t, err)
+	idle, err := store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	assert.Len(t, database.sessions, 2)
+
+	// Redis loses everything; sessions and lists are read back
+	fakeClock.Advance(time.Hour)
+	mr.FlushAll()
+	session, err := store.GetSessionForUser(ctx, kept.SessionID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 1, session.MessageCount)
+	assert.True(t, mr.Exists(sessionKeyPrefix+kept.SessionID), "cached again")
+
+	mr.FlushAll()
+	page, err := store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 2)
+	assert.Equal(t, kept.SessionID, page.Sessions[0].SessionID)
+
+	// Sessions that expired meanwhile stay gone
+	fakeClock.Advance(24 * time.Hour)
+	mr.FlushAll()
+	_, err = store.GetSession(ctx, idle.SessionID)
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+	page, err = store.ListSessions(ctx, "alice", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Sessions, 1)
+
+	require.NoError(t, store.DeleteSession(ctx, kept.SessionID))
+	assert.NotContains(t, database.sessions, kept.SessionID)
+}
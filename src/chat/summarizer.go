@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
 )
 
 const (
@@ -13,19 +14,28 @@ const (
 
 	// Keep the most recent N messages without summarization
 	recentMessageWindow = 4
+
+	summarizationInstructions = "Provide a concise summary of the conversation the user shares. Focus on the key topics, questions asked, and important information exchanged. Keep it under 200 words."
 )
 
 // Summarizer handles conversation summarization to reduce token usage
 type Summarizer struct {
 	llmClient models.LLMInferencer
+	model     string // Priced when reporting the cost of a summary
 }
 
 func NewSummarizer(llmClient models.LLMInferencer) *Summarizer {
 	return &Summarizer{
 		llmClient: llmClient,
+		model:     "gpt-3.5-turbo",
 	}
 }
 
+// SetModel sets the LLM model the summaries are priced at
+func (s *Summarizer) SetModel(model string) {
+	s.model = model
+}
+
 // ShouldSummarize checks if the session should be summarized
 func (s *Summarizer) ShouldSummarize(session *models.ChatSession) bool {
 	return session.TotalTokens > summarizationThreshold && len(session.Messages) > recentMessageWindow
@@ -33,14 +43,21 @@ func (s *Summarizer) ShouldSummarize(session *models.ChatSession) bool {
 
 // SummarizeSession creates a summary of older messages and keeps recent ones
 func (s *Summarizer) SummarizeSession(ctx context.Context, session *models.ChatSession) (*models.ChatSession, error) {
+	summarized, _, err := s.Summarize(ctx, session)
+	return summarized, err
+}
+
+// Summarize is SummarizeSession that also reports the LLM usage and cost of
+// the summary. The usage is nil when the session didn't need summarizing.
+func (s *Summarizer) Summarize(ctx context.Context, session *models.ChatSession) (*models.ChatSession, *models.ModelUsage, error) {
 	if !s.ShouldSummarize(session) {
-		return session, nil
+		return session, nil, nil
 	}
 
 	// Split messages: older (to summarize) vs recent (to keep)
 	splitIndex := len(session.Messages) - recentMessageWindow
 	if splitIndex <= 0 {
-		return session, nil
+		return session, nil, nil
 	}
 
 	olderMessages := session.Messages[:splitIndex]
@@ -52,37 +69,33 @@ func (s *Summarizer) SummarizeSession(ctx context.Context, session *models.ChatS
 		conversationText += fmt.Sprintf("%s: %s\n", msg.Role, msg.Content)
 	}
 
-	// Create summarization prompt
-	summarizationPrompt := fmt.Sprintf(`Please provide a concise summary of the following conversation. Focus on the key topics, questions asked, and important information exchanged. Keep it under 200 words.
-
-Conversation:
-%s
-
-Summary:`, conversationText)
-
-	// Generate summary using LLM
-	summaryReq := &models.InferenceRequest{
-		Query:       summarizationPrompt,
+	// Ask for the summary with the instructions as the system message
+	messages := []models.ChatMessage{
+		{Role: "system", Content: summarizationInstructions},
+		{Role: "user", Content: "Conversation:\n" + conversationText},
+	}
+	summary, err := s.llmClient.InferChat(ctx, messages, models.ChatOptions{
 		MaxTokens:   300,
 		Temperature: 0.3, // Lower temperature for more focused summaries
-	}
-
-	summary, err := s.llmClient.Infer(ctx, summaryReq)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate summary: %w", err)
+		return nil, nil, fmt.Errorf("failed to generate summary: %w", err)
 	}
 
-	// Create a new session with summary + recent messages
-	summarizedSession := &models.ChatSession{
-		SessionID:       session.SessionID,
-		Messages:        []models.ChatMessage{},
-		CreatedAt:       session.CreatedAt,
-		LastInteraction: session.LastInteraction,
-		TotalTokens:     0, // Will be recalculated
-		MessageCount:    session.MessageCount,
-		ModelPreference: session.ModelPreference,
+	inputTokens := utils.CountTokens(summarizationInstructions+conversationText, s.model)
+	outputTokens := utils.CountTokens(summary, s.model)
+	usage := &models.ModelUsage{
+		Model:        s.model,
+		Calls:        1,
+		InputTokens:  inputTokens,
+		OutputTokens: outputTokens,
+		Cost:         utils.CalculateLLMCost(inputTokens, outputTokens, s.model),
 	}
 
+	// Create a new session with summary + recent messages, keeping everything else
+	summarizedSession := *session
+	summarizedSession.Messages = []models.ChatMessage{}
+
 	// Add summary as a system message
 	summarizedSession.Messages = append(summarizedSession.Messages, models.ChatMessage{
 		Role:      "system",
@@ -96,11 +109,11 @@ Summary:`, conversationText)
 	// Recalculate token count
 	totalTokens := 0
 	for _, msg := range summarizedSession.Messages {
-		totalTokens += len(msg.Content) / 4 // Rough token estimation
+		totalTokens += utils.CountTokens(msg.Content, s.model)
 	}
 	summarizedSession.TotalTokens = totalTokens
 
-	return summarizedSession, nil
+	return &summarizedSession, usage, nil
 }
 
 // BuildOptimizedContext builds context with automatic summarization if needed
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func longSession(messages int) *models.ChatSession {
+	session := &models.ChatSession{SessionID: "sess_long", UserID: "alice", PreferredModel: "gpt-4o"}
+	content := strings.Repeat("a long message about routing ", 100)
+	for i := 0; i < messages; i++ {
+		session.Messages = append(session.Messages, models.ChatMessage{Role: "user", Content: content})
+		session.TotalTokens += len(content) / 4
+	}
+	session.MessageCount = messages
+	return session
+}
+
+func TestSummarizer_ReportsUsage(t *testing.T) {
+	llm := fakes.NewLLM("They talked about routing.")
+	summarizer := NewSummarizer(llm)
+	summarizer.SetModel("gpt-4o")
+
+	summarized, usage, err := summarizer.Summarize(context.Background(), longSession(10))
+	require.NoError(t, err)
+	require.NotNil(t, usage)
+	assert.Equal(t, "gpt-4o", usage.Model)
+	assert.Greater(t, usage.InputTokens, 0)
+	assert.Greater(t, usage.Cost, 0.0)
+
+	require.Len(t, summarized.Messages, 5)
+	assert.Equal(t, "[Conversation Summary]: They talked about routing.", summarized.Messages[0].Content)
+	assert.Equal(t, "gpt-4o", summarized.PreferredModel, "the rest of the session is kept")
+	assert.Equal(t, 10, summarized.MessageCount)
+}
+
+func TestSummarizer_ShortSessionsAreUntouched(t *testing.T) {
+	llm := fakes.NewLLM("unused")
+	session := longSession(3)
+
+	summarized, usage, err := NewSummarizer(llm).Summarize(context.Background(), session)
+	require.NoError(t, err)
+	assert.Nil(t, usage)
+	assert.Same(t, session, summarized)
+	assert.Empty(t, llm.Calls())
+}
+
+func TestSummarizer_Failure(t *testing.T) {
+	llm := fakes.NewLLM("unused")
+	llm.SetError(errors.New("provider down"))
+
+	_, _, err := NewSummarizer(llm).Summarize(context.Background(), longSession(10))
+	assert.ErrorContains(t, err, "provider down")
+}
@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	maxTitleLength = 60 // Characters
+
+	titleInstructions = "Write a title of at most six words for the conversation the user shares. Reply with the title only, without quotes or punctuation at the end."
+)
+
+// Titler names sessions after their first exchange using the SLM
+type Titler struct {
+	slm models.SLMInferencer
+}
+
+func NewTitler(slm models.SLMInferencer) *Titler {
+	return &Titler{slm: slm}
+}
+
+// Title returns a short title for a conversation that starts with message and
+// answer. If the SLM fails or answers with nothing usable, the title is the
+// start of the message.
+func (t *Titler) Title(ctx context.Context, message string, answer string) string {
+	messages := []models.ChatMessage{
+		{Role: "system", Content: titleInstructions},
+		{Role: "user", Content: fmt.Sprintf("User: %s\nAssistant: %s", message, answer)},
+	}
+	result, err := t.slm.InferChat(ctx, messages, models.ChatOptions{MaxTokens: 20, Temperature: 0.3})
+	if err == nil {
+		if title := cleanTitle(result.Response); title != "" {
+			return title
+		}
+	}
+	return cleanTitle(message)
+}
+
+// cleanTitle keeps the first line of text, without surrounding quotes and
+// trailing punctuation, shortened to maxTitleLength at a word boundary
+func cleanTitle(text string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	title = strings.Join(strings.Fields(title), " ")
+	title = strings.TrimPrefix(title, "Title:")
+	title = strings.Trim(title, " \"'`*.")
+
+	runes := []rune(title)
+	if len(runes) <= maxTitleLength {
+		return title
+	}
+	title = string(runes[:maxTitleLength])
+	if i := strings.LastIndex(title, " "); i > 0 {
+		title = title[:i]
+	}
+	return strings.TrimRight(title, " ,;:-") + "…"
+}
@@ -0,0 +1,39 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestTitler_UsesSLM(t *testing.T) {
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetResponder(func(req *models.InferenceRequest) string {
+		return "\"Trip planning for Paris.\"\nSome extra explanation"
+	})
+
+	title := NewTitler(slm).Title(context.Background(), "I'm going to Paris, what should I see?", "The Louvre.")
+	assert.Equal(t, "Trip planning for Paris", title)
+
+	calls := slm.Calls()
+	assert.Len(t, calls, 1)
+	assert.Equal(t, "system", calls[0].Messages[0].Role)
+	assert.Contains(t, calls[0].Query, "I'm going to Paris")
+}
+
+func TestTitler_FallsBackToMessage(t *testing.T) {
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetError(errors.New("provider down"))
+
+	message := "How do I configure " + strings.Repeat("very ", 20) + "long routing rules?"
+	title := NewTitler(slm).Title(context.Background(), message, "Like this.")
+	assert.True(t, strings.HasPrefix(title, "How do I configure very"))
+	assert.True(t, strings.HasSuffix(title, "very…"), "cut at a word boundary: %q", title)
+	assert.LessOrEqual(t, len([]rune(title)), maxTitleLength+1)
+}
@@ -0,0 +1,78 @@
+// Package clock abstracts the current time so TTL, expiry and sliding-window
+// logic can be tested deterministically with a Fake clock
+package clock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// Real returns the system clock
+func Real() Clock {
+	return realClock{}
+}
+
+// Fake is a manually driven clock. It only moves when told to, so tests see
+// the same times on every run.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a fake clock stopped at seed
+func NewFake(seed time.Time) *Fake {
+	return &Fake{now: seed}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Advance moves the clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
+
+// Set moves the clock to t
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = t
+}
+
+// Sleep waits for d on c, returning early with ctx's error once it's done. A
+// Fake clock is advanced by d instead, so code that waits runs at once in tests.
+func Sleep(ctx context.Context, c Clock, d time.Duration) error {
+	if fake, ok := c.(*Fake); ok {
+		fake.Advance(d)
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
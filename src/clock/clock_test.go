@@ -0,0 +1,35 @@
+package clock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFake(t *testing.T) {
+	seed := time.Date(2026, 2, 1, 8, 30, 0, 0, time.UTC)
+	fake := NewFake(seed)
+
+	assert.Equal(t, seed, fake.Now())
+	assert.Equal(t, seed, fake.Now(), "stands still until moved")
+
+	fake.Advance(90 * time.Second)
+	assert.Equal(t, seed.Add(90*time.Second), fake.Now())
+
+	fake.Set(seed)
+	assert.Equal(t, seed, fake.Now())
+}
+
+func TestSleep(t *testing.T) {
+	seed := time.Date(2026, 2, 1, 8, 30, 0, 0, time.UTC)
+	fake := NewFake(seed)
+
+	assert.NoError(t, Sleep(context.Background(), fake, time.Hour))
+	assert.Equal(t, seed.Add(time.Hour), fake.Now(), "a fake clock is advanced instead of waited on")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, Sleep(ctx, Real(), time.Hour), context.Canceled)
+}
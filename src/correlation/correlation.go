@@ -0,0 +1,58 @@
+// Package correlation carries the IDs of the request and user a model call is
+// made for, so provider calls can be tagged with them and provider-side logs
+// matched against ours.
+package correlation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+type requestIDKey struct{}
+
+type userIDKey struct{}
+
+// WithRequestID returns a context for serving the request with the given ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+// RequestID returns the ID of the request ctx serves, or ""
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// WithUserID returns a context for serving a request of the given user
+func WithUserID(ctx context.Context, userID string) context.Context {
+	return context.WithValue(ctx, userIDKey{}, userID)
+}
+
+// UserID returns the ID of the user ctx serves a request for, or ""
+func UserID(ctx context.Context) string {
+	userID, _ := ctx.Value(userIDKey{}).(string)
+	return userID
+}
+
+// Hasher turns IDs into the opaque values sent to providers. With a secret,
+// they can't be traced back to a user by hashing guesses.
+type Hasher struct {
+	secret []byte
+}
+
+func NewHasher(secret string) *Hasher {
+	return &Hasher{secret: []byte(secret)}
+}
+
+// Hash returns the first 128 bits of the HMAC-SHA256 of id in hex, or "" for
+// an empty id or a nil Hasher
+func (h *Hasher) Hash(id string) string {
+	if h == nil || id == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(id))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -0,0 +1,234 @@
+package credentials
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	healthKeyPrefix = "org_key_health:"
+	alertTimeout    = 5 * time.Second
+)
+
+// Outcome is what the provider's HTTP response to a call showed about the key
+type Outcome struct {
+	Status    int     // HTTP status; 0 if the call got no response
+	Remaining float64 // Lowest fraction of the key's rate limits left, or -1 if not reported
+}
+
+// OnAlert registers a handler, called when one of an org's keys becomes
+// unhealthy or recovers
+func (s *Store) OnAlert(fn func(models.KeyAlert)) {
+	s.alerts = append(s.alerts, fn)
+}
+
+// classify turns a call's outcome into the key's health. ok is false when the
+// outcome says nothing about the key, e.g. a provider outage.
+func (s *Store) classify(outcome Outcome) (health models.KeyHealth, ok bool) {
+	switch {
+	case outcome.Status == http.StatusUnauthorized || outcome.Status == http.StatusForbidden:
+		return models.KeyHealth{Status: models.KeyAuthFailing, Detail: fmt.Sprintf("provider answered %d", outcome.Status)}, true
+	case outcome.Status == http.StatusTooManyRequests:
+		return models.KeyHealth{Status: models.KeyQuotaLow, Detail: "rate limited"}, true
+	case outcome.Status >= 200 && outcome.Status < 300:
+		if outcome.Remaining >= 0 && outcome.Remaining < s.quotaThreshold {
+			return models.KeyHealth{Status: models.KeyQuotaLow, Detail: fmt.Sprintf("%.0f%% of the rate limit left", outcome.Remaining*100)}, true
+		}
+		return models.KeyHealth{Status: models.KeyHealthy}, true
+	}
+	return models.KeyHealth{}, false
+}
+
+// failing reports whether the provider rejected the key in an org's slot
+func (s *Store) failing(org string, provider string, slot string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.health[org][healthField(provider, slot)].Status == models.KeyAuthFailing
+}
+
+// setHealth records a key's health. Changes are shared with the other
+// instances through Redis and alerted on by whichever instance notices first.
+func (s *Store) setHealth(ctx context.Context, keys *Keys, provider string, slot string, last4 string, health models.KeyHealth) {
+	field := healthField(provider, slot)
+
+	s.mu.Lock()
+	previous := s.health[keys.org][field]
+	if previous.Status == health.Status || (previous.Status == "" && health.Status == models.KeyHealthy) {
+		s.mu.Unlock()
+		return
+	}
+	health.Since = s.clock.Now()
+	if s.health[keys.org] == nil {
+		s.health[keys.org] = make(map[string]models.KeyHealth)
+	}
+	s.health[keys.org][field] = health
+	s.mu.Unlock()
+
+	changed, err := s.storeHealth(context.WithoutCancel(ctx), keys.org, field, health)
+	if err != nil {
+		log.Printf("Failed to record %s key health for org %s: %v", provider, keys.org, err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	log.Printf("🔑 %s %s key of org %s is %s %s", provider, slot, keys.org, health.Status, health.Detail)
+	s.alert(keys.alertWebhook, models.KeyAlert{
+		Org:      keys.org,
+		Provider: provider,
+		Slot:     slot,
+		Last4:    last4,
+		Status:   health.Status,
+		Detail:   health.Detail,
+		Time:     health.Since,
+	})
+}
+
+// storeHealth saves a key's health, returning false if another instance had
+// already recorded the same status
+func (s *Store) storeHealth(ctx context.Context, org string, field string, health models.KeyHealth) (bool, error) {
+	key := healthKeyPrefix + org
+	changed := false
+
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		var stored models.KeyHealth
+		data, err := tx.HGet(ctx, key, field).Bytes()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if err == nil && json.Unmarshal(data, &stored) == nil && stored.Status == health.Status {
+			return nil
+		}
+		if err == redis.Nil && health.Status == models.KeyHealthy {
+			return nil
+		}
+
+		data, err = json.Marshal(health)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.HSet(ctx, key, field, data)
+			return nil
+		})
+		changed = err == nil
+		return err
+	}, key)
+	return changed, err
+}
+
+// loadHealth reads the health of an org's keys and refreshes the local copy
+func (s *Store) loadHealth(ctx context.Context, org string) (map[string]models.KeyHealth, error) {
+	fields, err := s.client.HGetAll(ctx, healthKeyPrefix+org).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key health: %w", err)
+	}
+
+	health := make(map[string]models.KeyHealth, len(fields))
+	for field, data := range fields {
+		var h models.KeyHealth
+		if err := json.Unmarshal([]byte(data), &h); err == nil {
+			health[field] = h
+		}
+	}
+
+	s.mu.Lock()
+	s.health[org] = health
+	s.mu.Unlock()
+	return health, nil
+}
+
+// resetHealth forgets the health of replaced keys, and moves the health of
+// the keys moved between slots: moves maps new fields to old ones, "" for a
+// new key
+func (s *Store) resetHealth(ctx context.Context, org string, moves map[string]string) error {
+	health, err := s.loadHealth(ctx, org)
+	if err != nil {
+		return err
+	}
+
+	moved := make(map[string]models.KeyHealth, len(health))
+	for field, h := range health {
+		moved[field] = h
+	}
+	for to, from := range moves {
+		if h, ok := health[from]; ok && from != "" {
+			moved[to] = h
+		} else {
+			delete(moved, to)
+		}
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, healthKeyPrefix+org)
+		for field, h := range moved {
+			data, err := json.Marshal(h)
+			if err != nil {
+				return err
+			}
+			pipe.HSet(ctx, healthKeyPrefix+org, field, data)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reset key health: %w", err)
+	}
+
+	s.mu.Lock()
+	s.health[org] = moved
+	s.mu.Unlock()
+	return nil
+}
+
+// alert calls the alert handlers and the org's webhook, if it has one
+func (s *Store) alert(webhook string, alert models.KeyAlert) {
+	for _, fn := range s.alerts {
+		fn(alert)
+	}
+	if webhook != "" {
+		go s.postAlert(webhook, alert)
+	}
+}
+
+func (s *Store) postAlert(url string, alert models.KeyAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("Failed to encode key alert: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Failed to create key alert for org %s: %v", alert.Org, err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		log.Printf("Failed to send key alert to org %s: %v", alert.Org, err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Key alert webhook of org %s returned %d", alert.Org, resp.StatusCode)
+	}
+}
+
+func healthField(provider string, slot string) string {
+	return provider + "/" + slot
+}
@@ -0,0 +1,116 @@
+package credentials
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoKey is returned for a provider an org has no key for when it may not
+// fall back to the platform's key
+var ErrNoKey = errors.New("org has no key for this provider and may not use the platform's")
+
+// Key slots: each provider has a primary key and optionally a standby one
+const (
+	SlotPrimary   = "primary"
+	SlotSecondary = "secondary"
+)
+
+type keysKey struct{}
+
+// Keys are an org's decrypted provider keys, carried in the context of the
+// requests its users make. A nil *Keys means the platform's keys.
+type Keys struct {
+	org              string
+	keys             map[string]string
+	secondary        map[string]string
+	platformFallback bool
+	alertWebhook     string
+	store            *Store // Tracks key health; nil for keys built with NewKeys
+}
+
+// NewKeys returns an org's keys by provider
+func NewKeys(org string, keys map[string]string, platformFallback bool) *Keys {
+	return &Keys{
+		org:              org,
+		keys:             keys,
+		secondary:        make(map[string]string),
+		platformFallback: platformFallback,
+	}
+}
+
+// WithKeys returns a context whose model calls use keys
+func WithKeys(ctx context.Context, keys *Keys) context.Context {
+	if keys == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, keysKey{}, keys)
+}
+
+// FromContext returns the keys of the caller's org, or nil for platform keys
+func FromContext(ctx context.Context) *Keys {
+	keys, _ := ctx.Value(keysKey{}).(*Keys)
+	return keys
+}
+
+// Key returns the org's key for provider: the primary one, or the secondary
+// one while the provider rejects the primary. ok is false when the platform's
+// key should be used.
+func (k *Keys) Key(provider string) (key string, ok bool, err error) {
+	if k == nil {
+		return "", false, nil
+	}
+	if _, ok := k.keys[provider]; ok {
+		return k.keyIn(provider, k.active(provider)), true, nil
+	}
+	if !k.platformFallback {
+		return "", false, ErrNoKey
+	}
+	return "", false, nil
+}
+
+// Org returns the org the keys belong to, "" for platform keys
+func (k *Keys) Org() string {
+	if k == nil {
+		return ""
+	}
+	return k.org
+}
+
+// Report records what a model call made with key, as returned by Key, showed
+// about it. It returns true if the provider rejected the key and the call
+// should be retried with the org's other key.
+func (k *Keys) Report(ctx context.Context, provider string, key string, outcome Outcome) bool {
+	if k == nil || k.store == nil {
+		return false
+	}
+	health, ok := k.store.classify(outcome)
+	if !ok {
+		return false
+	}
+
+	slot := SlotPrimary
+	if key != k.keys[provider] && key == k.secondary[provider] {
+		slot = SlotSecondary
+	}
+	k.store.setHealth(ctx, k, provider, slot, last4(key), health)
+
+	return slot == SlotPrimary && k.active(provider) == SlotSecondary
+}
+
+// active returns the slot whose key calls to provider use
+func (k *Keys) active(provider string) string {
+	if _, ok := k.secondary[provider]; !ok || k.store == nil {
+		return SlotPrimary
+	}
+	if k.store.failing(k.org, provider, SlotPrimary) && !k.store.failing(k.org, provider, SlotSecondary) {
+		return SlotSecondary
+	}
+	return SlotPrimary
+}
+
+func (k *Keys) keyIn(provider string, slot string) string {
+	if slot == SlotSecondary {
+		return k.secondary[provider]
+	}
+	return k.keys[provider]
+}
@@ -0,0 +1,409 @@
+// Package credentials stores the provider keys orgs bring so their traffic is
+// billed to their own provider accounts. Keys are encrypted at rest.
+package credentials
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	credentialsKeyPrefix = "org_credentials:"
+	cacheTTL             = 30 * time.Second // How long another instance may take to see a change
+)
+
+// ErrKeyNotFound is returned when deleting a key the org doesn't have
+var ErrKeyNotFound = errors.New("provider key not found")
+
+// ErrNoSecondaryKey is returned when promoting or deleting a secondary key
+// the org doesn't have
+var ErrNoSecondaryKey = errors.New("no secondary key for this provider")
+
+// orgRecord is what is stored per org
+type orgRecord struct {
+	Keys             map[string]storedKey `json:"keys"`
+	PlatformFallback *bool                `json:"platform_fallback,omitempty"` // Unset follows byok.platform_fallback
+	AlertWebhook     string               `json:"alert_webhook,omitempty"`
+}
+
+type storedKey struct {
+	Ciphertext string     `json:"ciphertext"` // Nonce and sealed key, base64
+	Last4      string     `json:"last4"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Secondary  *storedKey `json:"secondary,omitempty"`
+}
+
+type cachedKeys struct {
+	keys     *Keys
+	loadedAt time.Time
+}
+
+// Store keeps org keys in Redis, with a short-lived local copy of the
+// decrypted keys because they are looked up on every request
+type Store struct {
+	client           *redis.Client
+	aead             cipher.AEAD
+	platformFallback bool
+	quotaThreshold   float64
+	resolveOrg       func(ctx context.Context, userID string) string
+	clock            clock.Clock
+	alerts           []func(models.KeyAlert)
+	httpClient       *http.Client
+
+	mu     sync.Mutex
+	cache  map[string]cachedKeys
+	health map[string]map[string]models.KeyHealth // Key health by org, then provider/slot
+}
+
+// NewStore creates a store encrypting keys with the configured AES-256 key
+func NewStore(client *redis.Client, cfg config.BYOKConfig) (*Store, error) {
+	secret, err := base64.StdEncoding.DecodeString(cfg.EncryptionKey)
+	if err != nil || len(secret) != 32 {
+		return nil, errors.New("byok.encryption_key must be 32 bytes, base64 encoded")
+	}
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return &Store{
+		client:           client,
+		aead:             aead,
+		platformFallback: cfg.PlatformFallback,
+		quotaThreshold:   cfg.QuotaAlertThreshold,
+		clock:            clock.Real(),
+		httpClient:       &http.Client{Timeout: alertTimeout},
+		cache:            make(map[string]cachedKeys),
+		health:           make(map[string]map[string]models.KeyHealth),
+	}, nil
+}
+
+// SetOrgResolver maps users to the org whose keys their requests use
+func (s *Store) SetOrgResolver(resolver func(ctx context.Context, userID string) string) {
+	s.resolveOrg = resolver
+}
+
+// SetClock sets the clock that timestamps keys and expires cached ones
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// ForUser returns the keys of the user's org, or nil if its requests use the
+// platform's keys
+func (s *Store) ForUser(ctx context.Context, userID string) (*Keys, error) {
+	if s == nil || s.resolveOrg == nil {
+		return nil, nil
+	}
+	org := s.resolveOrg(ctx, userID)
+	if org == "" {
+		return nil, nil
+	}
+
+	s.mu.Lock()
+	entry, ok := s.cache[org]
+	s.mu.Unlock()
+	if ok && s.clock.Now().Sub(entry.loadedAt) < cacheTTL {
+		return entry.keys, nil
+	}
+
+	record, err := s.load(ctx, s.client, org)
+	if err != nil {
+		return nil, err
+	}
+	var keys *Keys
+	if len(record.Keys) > 0 || record.PlatformFallback != nil {
+		if _, err := s.loadHealth(ctx, org); err != nil {
+			return nil, err
+		}
+		keys = NewKeys(org, make(map[string]string, len(record.Keys)), s.fallback(record))
+		keys.alertWebhook = record.AlertWebhook
+		keys.store = s
+		for provider, stored := range record.Keys {
+			if keys.keys[provider], err = s.decrypt(org, provider, stored.Ciphertext); err != nil {
+				return nil, err
+			}
+			if stored.Secondary != nil {
+				if keys.secondary[provider], err = s.decrypt(org, provider, stored.Secondary.Ciphertext); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.cache[org] = cachedKeys{keys: keys, loadedAt: s.clock.Now()}
+	s.mu.Unlock()
+	return keys, nil
+}
+
+// Get describes the org's keys
+func (s *Store) Get(ctx context.Context, org string) (*models.OrgCredentials, error) {
+	record, err := s.load(ctx, s.client, org)
+	if err != nil {
+		return nil, err
+	}
+	health, err := s.loadHealth(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return s.describe(org, record, health), nil
+}
+
+// SetKey stores or replaces the org's primary key for provider, keeping any
+// secondary key
+func (s *Store) SetKey(ctx context.Context, org string, provider string, apiKey string) (*models.OrgCredentials, error) {
+	ciphertext, err := s.encrypt(org, provider, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.modify(ctx, org, map[string]string{healthField(provider, SlotPrimary): ""}, func(record *orgRecord) error {
+		record.Keys[provider] = storedKey{
+			Ciphertext: ciphertext,
+			Last4:      last4(apiKey),
+			UpdatedAt:  s.clock.Now(),
+			Secondary:  record.Keys[provider].Secondary,
+		}
+		return nil
+	})
+}
+
+// DeleteKey removes the org's keys for provider
+func (s *Store) DeleteKey(ctx context.Context, org string, provider string) (*models.OrgCredentials, error) {
+	moves := map[string]string{healthField(provider, SlotPrimary): "", healthField(provider, SlotSecondary): ""}
+	return s.modify(ctx, org, moves, func(record *orgRecord) error {
+		if _, ok := record.Keys[provider]; !ok {
+			return ErrKeyNotFound
+		}
+		delete(record.Keys, provider)
+		return nil
+	})
+}
+
+// SetSecondaryKey stores or replaces the standby key used while the provider
+// rejects the org's primary key. The org needs a primary key for provider.
+func (s *Store) SetSecondaryKey(ctx context.Context, org string, provider string, apiKey string) (*models.OrgCredentials, error) {
+	ciphertext, err := s.encrypt(org, provider, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return s.modify(ctx, org, map[string]string{healthField(provider, SlotSecondary): ""}, func(record *orgRecord) error {
+		primary, ok := record.Keys[provider]
+		if !ok {
+			return ErrKeyNotFound
+		}
+		primary.Secondary = &storedKey{
+			Ciphertext: ciphertext,
+			Last4:      last4(apiKey),
+			UpdatedAt:  s.clock.Now(),
+		}
+		record.Keys[provider] = primary
+		return nil
+	})
+}
+
+// DeleteSecondaryKey removes the org's standby key for provider
+func (s *Store) DeleteSecondaryKey(ctx context.Context, org string, provider string) (*models.OrgCredentials, error) {
+	return s.modify(ctx, org, map[string]string{healthField(provider, SlotSecondary): ""}, func(record *orgRecord) error {
+		primary, ok := record.Keys[provider]
+		if !ok || primary.Secondary == nil {
+			return ErrNoSecondaryKey
+		}
+		primary.Secondary = nil
+		record.Keys[provider] = primary
+		return nil
+	})
+}
+
+// PromoteKey swaps the org's primary and secondary keys for provider. To
+// rotate a key without downtime, set the new key as secondary, promote it,
+// and delete the old one once nothing uses it.
+func (s *Store) PromoteKey(ctx context.Context, org string, provider string) (*models.OrgCredentials, error) {
+	primaryField, secondaryField := healthField(provider, SlotPrimary), healthField(provider, SlotSecondary)
+	moves := map[string]string{primaryField: secondaryField, secondaryField: primaryField}
+	return s.modify(ctx, org, moves, func(record *orgRecord) error {
+		primary, ok := record.Keys[provider]
+		if !ok || primary.Secondary == nil {
+			return ErrNoSecondaryKey
+		}
+		promoted := *primary.Secondary
+		primary.Secondary = nil
+		promoted.Secondary = &primary
+		record.Keys[provider] = promoted
+		return nil
+	})
+}
+
+// Update changes the org's settings set in update
+func (s *Store) Update(ctx context.Context, org string, update models.UpdateOrgCredentialsRequest) (*models.OrgCredentials, error) {
+	return s.modify(ctx, org, nil, func(record *orgRecord) error {
+		if update.PlatformFallback != nil {
+			record.PlatformFallback = update.PlatformFallback
+		}
+		if update.AlertWebhook != nil {
+			record.AlertWebhook = *update.AlertWebhook
+		}
+		return nil
+	})
+}
+
+// modify changes the org's record, then resets the health of the keys it
+// replaced (see resetHealth)
+func (s *Store) modify(ctx context.Context, org string, moves map[string]string, change func(*orgRecord) error) (*models.OrgCredentials, error) {
+	key := credentialsKeyPrefix + org
+	var record *orgRecord
+
+	// Optimistic locking keeps concurrent changes to different providers
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		var err error
+		if record, err = s.load(ctx, tx, org); err != nil {
+			return err
+		}
+		if err := change(record); err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode credentials: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	delete(s.cache, org)
+	s.mu.Unlock()
+
+	if len(moves) > 0 {
+		if err := s.resetHealth(ctx, org, moves); err != nil {
+			return nil, err
+		}
+	}
+	health, err := s.loadHealth(ctx, org)
+	if err != nil {
+		return nil, err
+	}
+	return s.describe(org, record, health), nil
+}
+
+func (s *Store) load(ctx context.Context, client redis.Cmdable, org string) (*orgRecord, error) {
+	record := &orgRecord{}
+	data, err := client.Get(ctx, credentialsKeyPrefix+org).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get credentials: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, record); err != nil {
+			return nil, fmt.Errorf("failed to decode credentials: %w", err)
+		}
+	}
+	if record.Keys == nil {
+		record.Keys = make(map[string]storedKey)
+	}
+	return record, nil
+}
+
+func (s *Store) describe(org string, record *orgRecord, health map[string]models.KeyHealth) *models.OrgCredentials {
+	credentials := &models.OrgCredentials{
+		Org:              org,
+		Keys:             make([]models.ProviderKey, 0, len(record.Keys)),
+		PlatformFallback: s.fallback(record),
+		AlertWebhook:     record.AlertWebhook,
+	}
+	for provider, stored := range record.Keys {
+		key := models.ProviderKey{
+			Provider:  provider,
+			Last4:     stored.Last4,
+			UpdatedAt: stored.UpdatedAt,
+			Health:    describeHealth(health[healthField(provider, SlotPrimary)]),
+			Active:    SlotPrimary,
+		}
+		if stored.Secondary != nil {
+			key.Secondary = &models.StoredKey{
+				Last4:     stored.Secondary.Last4,
+				UpdatedAt: stored.Secondary.UpdatedAt,
+				Health:    describeHealth(health[healthField(provider, SlotSecondary)]),
+			}
+			if key.Health.Status == models.KeyAuthFailing && key.Secondary.Health.Status != models.KeyAuthFailing {
+				key.Active = SlotSecondary
+			}
+		}
+		credentials.Keys = append(credentials.Keys, key)
+	}
+	sort.Slice(credentials.Keys, func(i, j int) bool {
+		return credentials.Keys[i].Provider < credentials.Keys[j].Provider
+	})
+	return credentials
+}
+
+// describeHealth reports keys nothing is known about yet as healthy
+func describeHealth(health models.KeyHealth) models.KeyHealth {
+	if health.Status == "" {
+		health.Status = models.KeyHealthy
+	}
+	return health
+}
+
+func (s *Store) fallback(record *orgRecord) bool {
+	if record.PlatformFallback != nil {
+		return *record.PlatformFallback
+	}
+	return s.platformFallback
+}
+
+// encrypt seals a key, binding it to the org and provider so a ciphertext
+// copied elsewhere doesn't decrypt
+func (s *Store) encrypt(org string, provider string, apiKey string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(apiKey), []byte(org+"\x00"+provider))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *Store) decrypt(org string, provider string, ciphertext string) (string, error) {
+	sealed, err := base64.StdEncoding.DecodeString(ciphertext)
+	if err != nil || len(sealed) < s.aead.NonceSize() {
+		return "", fmt.Errorf("malformed %s key for %s", provider, org)
+	}
+	nonce, sealed := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	key, err := s.aead.Open(nil, nonce, sealed, []byte(org+"\x00"+provider))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt %s key for %s: %w", provider, org, err)
+	}
+	return string(key), nil
+}
+
+func last4(key string) string {
+	if len(key) <= 4 {
+		return ""
+	}
+	return key[len(key)-4:]
+}
@@ -0,0 +1,164 @@
+package credentials
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const testEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" // 32 bytes
+
+func setupStore(t *testing.T) (*Store, *miniredis.Miniredis, *clock.Fake) {
+	mr := miniredis.RunT(t)
+	store, err := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), config.BYOKConfig{
+		EncryptionKey:       testEncryptionKey,
+		PlatformFallback:    true,
+		QuotaAlertThreshold: 0.1,
+	})
+	require.NoError(t, err)
+
+	fakeClock := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	store.SetClock(fakeClock)
+	store.SetOrgResolver(func(ctx context.Context, userID string) string {
+		return map[string]string{"alice": "acme.com", "bob": "other.com"}[userID]
+	})
+	return store, mr, fakeClock
+}
+
+func TestStore_KeysAreEncryptedAndScopedToOrg(t *testing.T) {
+	store, mr, fakeClock := setupStore(t)
+	ctx := context.Background()
+
+	described, err := store.SetKey(ctx, "acme.com", "openai", "sk-acme-secret-1234")
+	require.NoError(t, err)
+	require.Len(t, described.Keys, 1)
+	assert.Equal(t, "1234", described.Keys[0].Last4)
+
+	stored, err := mr.Get(credentialsKeyPrefix + "acme.com")
+	require.NoError(t, err)
+	assert.NotContains(t, stored, "sk-acme-secret", "keys are encrypted at rest")
+
+	keys, err := store.ForUser(ctx, "alice")
+	require.NoError(t, err)
+	key, ok, err := keys.Key("openai")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "sk-acme-secret-1234", key)
+
+	// Providers without a key fall back to the platform's
+	_, ok, err = keys.Key("groq")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	keys, err = store.ForUser(ctx, "bob")
+	require.NoError(t, err)
+	assert.Nil(t, keys, "orgs without keys use the platform's")
+
+	// A ciphertext moved to another org doesn't decrypt
+	require.NoError(t, mr.Set(credentialsKeyPrefix+"other.com", strings.ReplaceAll(stored, "acme", "other")))
+	fakeClock.Advance(cacheTTL)
+	_, err = store.ForUser(ctx, "bob")
+	assert.Error(t, err)
+}
+
+func TestStore_PlatformFallbackCanBeDisabled(t *testing.T) {
+	store, _, fakeClock := setupStore(t)
+	ctx := context.Background()
+
+	_, err := store.SetKey(ctx, "acme.com", "openai", "sk-acme-secret-1234")
+	require.NoError(t, err)
+
+	noFallback := false
+	described, err := store.Update(ctx, "acme.com", models.UpdateOrgCredentialsRequest{PlatformFallback: &noFallback})
+	require.NoError(t, err)
+	assert.False(t, described.PlatformFallback)
+
+	fakeClock.Advance(cacheTTL)
+	keys, err := store.ForUser(ctx, "alice")
+	require.NoError(t, err)
+	_, _, err = keys.Key("groq")
+	assert.ErrorIs(t, err, ErrNoKey)
+
+	_, err = store.DeleteKey(ctx, "acme.com", "groq")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestStore_SwitchesToSecondaryKeyWhenPrimaryIsRejected(t *testing.T) {
+	store, _, fakeClock := setupStore(t)
+	ctx := context.Background()
+	var alerts []models.KeyAlert
+	store.OnAlert(func(alert models.KeyAlert) { alerts = append(alerts, alert) })
+
+	_, err := store.SetKey(ctx, "acme.com", "openai", "sk-old-key-1111")
+	require.NoError(t, err)
+	_, err = store.SetSecondaryKey(ctx, "acme.com", "openai", "sk-new-key-2222")
+	require.NoError(t, err)
+
+	keys, err := store.ForUser(ctx, "alice")
+	require.NoError(t, err)
+	key, _, _ := keys.Key("openai")
+	assert.Equal(t, "sk-old-key-1111", key)
+
+	// Successful calls say nothing new about a key
+	assert.False(t, keys.Report(ctx, "openai", key, Outcome{Status: 200, Remaining: -1}))
+	assert.Empty(t, alerts)
+
+	// A rejected primary key switches calls to the secondary one and alerts
+	assert.True(t, keys.Report(ctx, "openai", key, Outcome{Status: 401, Remaining: -1}))
+	key, _, _ = keys.Key("openai")
+	assert.Equal(t, "sk-new-key-2222", key)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, models.KeyAlert{Org: "acme.com", Provider: "openai", Slot: SlotPrimary, Last4: "1111", Status: models.KeyAuthFailing, Detail: "provider answered 401", Time: fakeClock.Now()}, alerts[0])
+
+	// Running low on the rate limit alerts without switching
+	assert.False(t, keys.Report(ctx, "openai", key, Outcome{Status: 200, Remaining: 0.05}))
+	require.Len(t, alerts, 2)
+	assert.Equal(t, SlotSecondary, alerts[1].Slot)
+	assert.Equal(t, models.KeyQuotaLow, alerts[1].Status)
+
+	described, err := store.Get(ctx, "acme.com")
+	require.NoError(t, err)
+	assert.Equal(t, SlotSecondary, described.Keys[0].Active)
+	assert.Equal(t, models.KeyAuthFailing, described.Keys[0].Health.Status)
+
+	// Another instance sees the health through Redis and doesn't alert again
+	other, err := NewStore(store.client, config.BYOKConfig{EncryptionKey: testEncryptionKey, QuotaAlertThreshold: 0.1})
+	require.NoError(t, err)
+	other.SetOrgResolver(store.resolveOrg)
+	other.OnAlert(func(alert models.KeyAlert) { alerts = append(alerts, alert) })
+	otherKeys, err := other.ForUser(ctx, "alice")
+	require.NoError(t, err)
+	key, _, _ = otherKeys.Key("openai")
+	assert.Equal(t, "sk-new-key-2222", key)
+	otherKeys.Report(ctx, "openai", "sk-old-key-1111", Outcome{Status: 403, Remaining: -1})
+	assert.Len(t, alerts, 2)
+
+	// Promoting the secondary key rotates it in, with its health
+	described, err = store.PromoteKey(ctx, "acme.com", "openai")
+	require.NoError(t, err)
+	assert.Equal(t, "2222", described.Keys[0].Last4)
+	assert.Equal(t, models.KeyQuotaLow, described.Keys[0].Health.Status)
+	assert.Equal(t, "1111", described.Keys[0].Secondary.Last4)
+	assert.Equal(t, SlotPrimary, described.Keys[0].Active)
+
+	// Replacing a key forgets its health
+	described, err = store.SetKey(ctx, "acme.com", "openai", "sk-newer-key-3333")
+	require.NoError(t, err)
+	assert.Equal(t, models.KeyHealthy, described.Keys[0].Health.Status)
+	assert.Equal(t, models.KeyAuthFailing, described.Keys[0].Secondary.Health.Status)
+
+	_, err = store.DeleteSecondaryKey(ctx, "acme.com", "openai")
+	require.NoError(t, err)
+	_, err = store.PromoteKey(ctx, "acme.com", "openai")
+	assert.ErrorIs(t, err, ErrNoSecondaryKey)
+}
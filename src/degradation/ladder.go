@@ -0,0 +1,182 @@
+// Package degradation steps service down an ordered ladder, from full hybrid
+// through SLM-only and cached-only to a static maintenance answer, as spend,
+// provider outages or load demand.
+package degradation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+// Levels of the ladder, from full service down
+const (
+	LevelFull        = "full"        // Both tiers answer
+	LevelSLMOnly     = "slm_only"    // Every query is routed to the SLM
+	LevelCachedOnly  = "cached_only" // Only cached, pinned and canonical answers are served
+	LevelMaintenance = "maintenance" // Every query gets the maintenance answer
+)
+
+var levels = []string{LevelFull, LevelSLMOnly, LevelCachedOnly, LevelMaintenance}
+
+// Reaches reports whether level is at or below rung on the ladder
+func Reaches(level string, rung string) bool {
+	return slices.Index(levels, level) >= slices.Index(levels, rung)
+}
+
+// Ladder decides the level service runs at: the lowest rung any trigger
+// calls for
+type Ladder struct {
+	cfg        config.DegradationConfig
+	spendCaps  *usage.SpendCaps // Optional
+	llmBreaker *inference.CircuitBreaker
+	slmBreaker *inference.CircuitBreaker
+	inFlight   atomic.Int64
+
+	mu    sync.Mutex
+	spend models.DegradationStatus // Level spend calls for, as of the last check
+	level string                   // Last level reported, to log changes
+}
+
+func NewLadder(cfg config.DegradationConfig) *Ladder {
+	return &Ladder{
+		cfg:   cfg,
+		spend: models.DegradationStatus{Level: LevelFull},
+		level: LevelFull,
+	}
+}
+
+// SetSpendCaps drops a tier once its platform key has spent
+// spend_threshold of its monthly cap
+func (l *Ladder) SetSpendCaps(caps *usage.SpendCaps) {
+	l.spendCaps = caps
+}
+
+// SetBreakers goes SLM-only while the LLM's circuit is open, and cached-only
+// while both are
+func (l *Ladder) SetBreakers(llmBreaker, slmBreaker *inference.CircuitBreaker) {
+	l.llmBreaker = llmBreaker
+	l.slmBreaker = slmBreaker
+}
+
+// MaintenanceAnswer returns the answer given at the maintenance level
+func (l *Ladder) MaintenanceAnswer() string {
+	return l.cfg.MaintenanceAnswer
+}
+
+// Enter counts a request in progress toward the load triggers until the
+// returned func is called. A nil ladder counts nothing.
+func (l *Ladder) Enter() func() {
+	if l == nil {
+		return func() {}
+	}
+	l.inFlight.Add(1)
+	return func() { l.inFlight.Add(-1) }
+}
+
+// Status returns the current level and the reasons for it. A nil ladder is
+// always at full service.
+func (l *Ladder) Status() models.DegradationStatus {
+	if l == nil {
+		return models.DegradationStatus{Level: LevelFull}
+	}
+
+	l.mu.Lock()
+	status := models.DegradationStatus{Level: l.spend.Level, Reasons: slices.Clone(l.spend.Reasons)}
+	l.mu.Unlock()
+	lower := func(level string, reason string) {
+		status.Reasons = append(status.Reasons, reason)
+		if !Reaches(status.Level, level) {
+			status.Level = level
+		}
+	}
+
+	llmDown := l.llmBreaker != nil && l.llmBreaker.State() == inference.CircuitOpen
+	slmDown := l.slmBreaker != nil && l.slmBreaker.State() == inference.CircuitOpen
+	switch {
+	case llmDown && slmDown:
+		lower(LevelCachedOnly, "both tiers' circuits open")
+	case llmDown:
+		lower(LevelSLMOnly, l.llmBreaker.Name()+" circuit open")
+	}
+
+	inFlight := int(l.inFlight.Load())
+	for _, threshold := range []struct {
+		level string
+		load  int
+	}{
+		{LevelMaintenance, l.cfg.Load.Maintenance},
+		{LevelCachedOnly, l.cfg.Load.CachedOnly},
+		{LevelSLMOnly, l.cfg.Load.SLMOnly},
+	} {
+		if threshold.load > 0 && inFlight >= threshold.load {
+			lower(threshold.level, fmt.Sprintf("%d requests in progress", inFlight))
+			break
+		}
+	}
+
+	l.mu.Lock()
+	if status.Level != l.level {
+		log.Printf("🪜 Service level changed from %s to %s %v", l.level, status.Level, status.Reasons)
+		l.level = status.Level
+	}
+	l.mu.Unlock()
+	return status
+}
+
+// Refresh checks the platform keys' spend against their caps
+func (l *Ladder) Refresh(ctx context.Context) error {
+	status := models.DegradationStatus{Level: LevelFull}
+	if l.spendCaps != nil {
+		for _, tier := range []struct {
+			useLLM bool
+			level  string
+		}{{true, LevelSLMOnly}, {false, LevelCachedOnly}} {
+			share, capped, err := l.spendCaps.PlatformShare(ctx, tier.useLLM)
+			if err != nil {
+				return err
+			}
+			if capped && share >= l.cfg.SpendThreshold {
+				status.Level = tier.level
+				status.Reasons = append(status.Reasons, fmt.Sprintf("%s key spent %.0f%% of its monthly cap", tierName(tier.useLLM), share*100))
+			}
+		}
+	}
+
+	l.mu.Lock()
+	l.spend = status
+	l.mu.Unlock()
+	return nil
+}
+
+// Run refreshes spend every check interval until ctx is cancelled
+func (l *Ladder) Run(ctx context.Context) {
+	ticker := time.NewTicker(l.cfg.CheckInterval)
+	defer ticker.Stop()
+	for {
+		if err := l.Refresh(ctx); err != nil {
+			log.Printf("Failed to check spend for the degradation ladder: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func tierName(useLLM bool) string {
+	if useLLM {
+		return "cloud-llm"
+	}
+	return "edge-slm"
+}
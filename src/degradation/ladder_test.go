@@ -0,0 +1,86 @@
+package degradation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+func TestLadder_Spend(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	spendCaps := usage.NewSpendCaps(client, config.SpendCapsConfig{Caps: []config.SpendCapConfig{
+		{Provider: "openai", MonthlyUSD: 10},
+		{Provider: "groq", MonthlyUSD: 10},
+	}}, "openai", "groq")
+	ladder := NewLadder(config.DegradationConfig{SpendThreshold: 0.9})
+	ladder.SetSpendCaps(spendCaps)
+	ctx := context.Background()
+
+	require.NoError(t, ladder.Refresh(ctx))
+	assert.Equal(t, LevelFull, ladder.Status().Level)
+
+	require.NoError(t, spendCaps.Record(ctx, true, 9.5))
+	require.NoError(t, ladder.Refresh(ctx))
+	status := ladder.Status()
+	assert.Equal(t, LevelSLMOnly, status.Level)
+	assert.Equal(t, []string{"cloud-llm key spent 95% of its monthly cap"}, status.Reasons)
+
+	require.NoError(t, spendCaps.Record(ctx, false, 9))
+	require.NoError(t, ladder.Refresh(ctx))
+	assert.Equal(t, LevelCachedOnly, ladder.Status().Level)
+}
+
+func TestLadder_OutagesAndLoad(t *testing.T) {
+	failing := func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		return "", errors.New("provider down")
+	}
+	breakerCfg := config.FailoverConfig{FailureThreshold: 1, OpenDuration: time.Minute}
+	llmBreaker := inference.NewCircuitBreaker("cloud-llm", breakerCfg)
+	slmBreaker := inference.NewCircuitBreaker("edge-slm", breakerCfg)
+	ladder := NewLadder(config.DegradationConfig{Load: config.DegradationLoadConfig{CachedOnly: 2, Maintenance: 3}})
+	ladder.SetBreakers(llmBreaker, slmBreaker)
+
+	llmBreaker.Wrap(failing)(context.Background(), &models.InferenceRequest{})
+	status := ladder.Status()
+	assert.Equal(t, LevelSLMOnly, status.Level)
+	assert.Equal(t, []string{"cloud-llm circuit open"}, status.Reasons)
+
+	slmBreaker.Wrap(failing)(context.Background(), &models.InferenceRequest{})
+	assert.Equal(t, LevelCachedOnly, ladder.Status().Level)
+
+	// Load alone
+	ladder.SetBreakers(nil, nil)
+	release := ladder.Enter()
+	assert.Equal(t, LevelFull, ladder.Status().Level)
+	releaseMore := ladder.Enter()
+	assert.Equal(t, LevelCachedOnly, ladder.Status().Level)
+	releaseMost := ladder.Enter()
+	assert.Equal(t, LevelMaintenance, ladder.Status().Level)
+	releaseMost()
+	releaseMore()
+	release()
+	assert.Equal(t, LevelFull, ladder.Status().Level)
+
+	var unset *Ladder
+	unset.Enter()()
+	assert.Equal(t, LevelFull, unset.Status().Level)
+}
+
+func TestReaches(t *testing.T) {
+	assert.True(t, Reaches(LevelMaintenance, LevelSLMOnly))
+	assert.True(t, Reaches(LevelSLMOnly, LevelSLMOnly))
+	assert.False(t, Reaches(LevelFull, LevelSLMOnly))
+	assert.False(t, Reaches(LevelCachedOnly, LevelMaintenance))
+}
@@ -0,0 +1,186 @@
+package fakes
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// EmbeddingDimensions is the size of the vectors returned by Embedder
+const EmbeddingDimensions = 64
+
+// Embedder produces deterministic bag-of-words embeddings: queries sharing
+// words are similar, identical queries have similarity 1
+type Embedder struct{}
+
+func NewEmbedder() *Embedder {
+	return &Embedder{}
+}
+
+// Embed hashes each lowercase word of text into a normalized vector
+func (e *Embedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	vector := make([]float32, EmbeddingDimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		h := fnv.New32a()
+		h.Write([]byte(word))
+		vector[h.Sum32()%EmbeddingDimensions]++
+	}
+
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vector {
+			vector[i] = float32(float64(vector[i]) / norm)
+		}
+	}
+	return vector, nil
+}
+
+type cacheEntry struct {
+	response  models.InferenceResponse
+	query     string
+	embedding []float32
+	expiresAt time.Time
+}
+
+// Cache is an in-memory models.SemanticCacheStore. Entries expire after the
+// TTL, measured on a clock tests can replace with SetClock.
+type Cache struct {
+	mu       sync.Mutex
+	entries  map[string]*cacheEntry
+	ttl      time.Duration
+	embedder *Embedder
+	clock    clock.Clock
+}
+
+// NewCache returns an empty cache; a ttl of 0 keeps entries forever
+func NewCache(ttl time.Duration) *Cache {
+	return &Cache{
+		entries:  make(map[string]*cacheEntry),
+		ttl:      ttl,
+		embedder: NewEmbedder(),
+		clock:    clock.Real(),
+	}
+}
+
+// SetClock replaces the clock used for expiry
+func (c *Cache) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clk
+}
+
+// Len returns the number of unexpired entries
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for _, entry := range c.entries {
+		if !c.expired(entry) {
+			n++
+		}
+	}
+	return n
+}
+
+// Get returns a copy of the cached response, or nil on a miss
+func (c *Cache) Get(ctx context.Context, key string) (*models.InferenceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || c.expired(entry) {
+		return nil, nil
+	}
+	response := entry.response
+	return &response, nil
+}
+
+func (c *Cache) Set(ctx context.Context, key string, response *models.InferenceResponse) error {
+	return c.SetWithEmbedding(ctx, key, "", response)
+}
+
+func (c *Cache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+	return nil
+}
+
+func (c *Cache) Close() error {
+	return nil
+}
+
+// GetSimilar returns the most similar cached query at or above the threshold
+func (c *Cache) GetSimilar(ctx context.Context, query string, threshold float64) (*models.SemanticCacheResult, error) {
+	embedding, err := c.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var best *models.SemanticCacheResult
+	for key, entry := range c.entries {
+		if entry.embedding == nil || c.expired(entry) {
+			continue
+		}
+		similarity := dot(embedding, entry.embedding)
+		if similarity >= threshold && (best == nil || similarity > best.Similarity) {
+			response := entry.response
+			best = &models.SemanticCacheResult{Response: &response, Similarity: similarity, CacheKey: key}
+		}
+	}
+	return best, nil
+}
+
+// SetWithEmbedding stores a copy of the response, searchable by query
+func (c *Cache) SetWithEmbedding(ctx context.Context, key string, query string, response *models.InferenceResponse) error {
+	entry := &cacheEntry{response: *response, query: query}
+	if query != "" {
+		embedding, err := c.embedder.Embed(ctx, query)
+		if err != nil {
+			return err
+		}
+		entry.embedding = embedding
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl := response.CacheTTL(c.ttl); ttl > 0 {
+		entry.expiresAt = c.clock.Now().Add(ttl)
+	}
+	c.entries[key] = entry
+	return nil
+}
+
+func (c *Cache) expired(entry *cacheEntry) bool {
+	return !entry.expiresAt.IsZero() && !c.clock.Now().Before(entry.expiresAt)
+}
+
+// dot is the cosine similarity of two normalized vectors
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
@@ -0,0 +1,144 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/providertest"
+)
+
+var (
+	_ models.LLMInferencer       = (*LLM)(nil)
+	_ models.StreamingInferencer = (*LLM)(nil)
+	_ models.SLMInferencer       = (*SLM)(nil)
+	_ models.StreamingInferencer = (*SLM)(nil)
+	_ models.SemanticCacheStore  = (*Cache)(nil)
+)
+
+// scenarioError is the error a real adapter would return for a failing upstream
+func scenarioError(scenario providertest.Scenario) error {
+	if scenario.Status == 0 {
+		return nil
+	}
+	return fmt.Errorf("upstream returned status %d: %s", scenario.Status, scenario.ErrorMessage)
+}
+
+func TestLLM_Conformance(t *testing.T) {
+	providertest.RunLLM(t, func(t *testing.T, scenario providertest.Scenario) models.LLMInferencer {
+		llm := NewLLM(scenario.Answer)
+		llm.SetLatency(scenario.Delay)
+		llm.SetError(scenarioError(scenario))
+		return llm
+	})
+}
+
+func TestSLM_Conformance(t *testing.T) {
+	providertest.RunSLM(t, func(t *testing.T, scenario providertest.Scenario) models.SLMInferencer {
+		slm := NewSLM("tiny", scenario.Answer)
+		slm.SetLatency(scenario.Delay)
+		slm.SetError(scenarioError(scenario))
+		return slm
+	})
+}
+
+func TestLLM_CannedAnswers(t *testing.T) {
+	llm := NewLLM("default")
+	llm.SetAnswer("What is Go?", "A language")
+
+	answer, err := llm.Infer(context.Background(), &models.InferenceRequest{Query: "What is Go?"})
+	require.NoError(t, err)
+	assert.Equal(t, "A language", answer)
+
+	answer, err = llm.Infer(context.Background(), &models.InferenceRequest{Query: "Anything else"})
+	require.NoError(t, err)
+	assert.Equal(t, "default", answer)
+	assert.Len(t, llm.Calls(), 2)
+
+	llm.SetError(errors.New("provider down"))
+	_, err = llm.Infer(context.Background(), &models.InferenceRequest{Query: "What is Go?"})
+	assert.EqualError(t, err, "provider down")
+}
+
+func TestLLM_Responder(t *testing.T) {
+	llm := NewLLM("default")
+	llm.SetAnswer("What is Go?", "A language")
+	llm.SetResponder(func(req *models.InferenceRequest) string {
+		return "echo: " + req.Query
+	})
+	llm.ForgetCalls()
+
+	answer, _ := llm.Infer(context.Background(), &models.InferenceRequest{Query: "hello"})
+	assert.Equal(t, "echo: hello", answer)
+	answer, _ = llm.Infer(context.Background(), &models.InferenceRequest{Query: "What is Go?"})
+	assert.Equal(t, "A language", answer, "canned answers take precedence")
+	assert.Empty(t, llm.Calls())
+}
+
+func TestLLM_LatencyHonorsContext(t *testing.T) {
+	llm := NewLLM("slow")
+	llm.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, err := llm.Infer(ctx, &models.InferenceRequest{Query: "q"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSLM_InferAndStream(t *testing.T) {
+	slm := NewSLM("tiny", "hello edge world")
+
+	result, err := slm.Infer(context.Background(), &models.InferenceRequest{Query: "q"})
+	require.NoError(t, err)
+	assert.Equal(t, "hello edge world", result.Response)
+	assert.Equal(t, "tiny", result.SelectedModel)
+
+	result, err = slm.Infer(context.Background(), &models.InferenceRequest{Query: "q", TargetModel: "other"})
+	require.NoError(t, err)
+	assert.Equal(t, "other", result.SelectedModel)
+
+	var chunks []string
+	err = slm.InferStreaming(context.Background(), &models.InferenceRequest{Query: "q"}, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"hello ", "edge ", "world"}, chunks)
+}
+
+func TestCache_ExpiryAndSimilarity(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewCache(time.Minute)
+	cache.SetClock(fakeClock)
+
+	response := &models.InferenceResponse{Response: "Paris"}
+	require.NoError(t, cache.SetWithEmbedding(ctx, "k1", "What is the capital of France?", response))
+
+	got, err := cache.Get(ctx, "k1")
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, "Paris", got.Response)
+
+	similar, err := cache.GetSimilar(ctx, "what is the capital of france", 0.99)
+	require.NoError(t, err)
+	require.NotNil(t, similar)
+	assert.Equal(t, "k1", similar.CacheKey)
+
+	similar, err = cache.GetSimilar(ctx, "How do I bake bread?", 0.9)
+	require.NoError(t, err)
+	assert.Nil(t, similar)
+
+	fakeClock.Advance(2 * time.Minute)
+	got, err = cache.Get(ctx, "k1")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	assert.Equal(t, 0, cache.Len())
+}
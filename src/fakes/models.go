@@ -0,0 +1,157 @@
+package fakes
+
+import (
+	"context"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+// LLM is a fake cloud LLM client implementing models.LLMInferencer and
+// models.StreamingInferencer
+type LLM struct {
+	script *script
+}
+
+// NewLLM returns a fake LLM that answers every query with defaultAnswer
+// unless a canned answer is set for it
+func NewLLM(defaultAnswer string) *LLM {
+	return &LLM{script: newScript(defaultAnswer)}
+}
+
+// SetAnswer makes the fake answer query with answer
+func (l *LLM) SetAnswer(query string, answer string) {
+	l.script.setAnswer(query, answer)
+}
+
+// SetResponder computes the answer to queries without a canned answer,
+// replacing the default answer
+func (l *LLM) SetResponder(fn func(req *models.InferenceRequest) string) {
+	l.script.setResponder(fn)
+}
+
+// SetLatency delays every call, honoring context cancellation
+func (l *LLM) SetLatency(latency time.Duration) {
+	l.script.setLatency(latency)
+}
+
+// SetError makes every call fail with err; nil restores normal answers
+func (l *LLM) SetError(err error) {
+	l.script.setError(err)
+}
+
+// ForgetCalls stops recording requests, for long-running use outside tests
+func (l *LLM) ForgetCalls() {
+	l.script.setForgetCalls(true)
+}
+
+// Calls returns every request received, in order
+func (l *LLM) Calls() []models.InferenceRequest {
+	return l.script.recorded()
+}
+
+func (l *LLM) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	return l.script.answer(ctx, req)
+}
+
+func (l *LLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+	return l.Infer(ctx, models.NewChatInferenceRequest(messages, opts))
+}
+
+func (l *LLM) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) error {
+	answer, err := l.script.answer(ctx, req)
+	if err != nil {
+		return err
+	}
+	return stream(answer, callback)
+}
+
+// SLM is a fake edge SLM engine implementing models.SLMInferencer and
+// models.StreamingInferencer. It reports a single model answering.
+type SLM struct {
+	script *script
+	model  string
+}
+
+// NewSLM returns a fake SLM engine reporting answers from model
+func NewSLM(model string, defaultAnswer string) *SLM {
+	return &SLM{
+		script: newScript(defaultAnswer),
+		model:  model,
+	}
+}
+
+// SetAnswer makes the fake answer query with answer
+func (s *SLM) SetAnswer(query string, answer string) {
+	s.script.setAnswer(query, answer)
+}
+
+// SetResponder computes the answer to queries without a canned answer,
+// replacing the default answer
+func (s *SLM) SetResponder(fn func(req *models.InferenceRequest) string) {
+	s.script.setResponder(fn)
+}
+
+// SetLatency delays every call, honoring context cancellation
+func (s *SLM) SetLatency(latency time.Duration) {
+	s.script.setLatency(latency)
+}
+
+// SetError makes every call fail with err; nil restores normal answers
+func (s *SLM) SetError(err error) {
+	s.script.setError(err)
+}
+
+// ForgetCalls stops recording requests, for long-running use outside tests
+func (s *SLM) ForgetCalls() {
+	s.script.setForgetCalls(true)
+}
+
+// Calls returns every request received, in order
+func (s *SLM) Calls() []models.InferenceRequest {
+	return s.script.recorded()
+}
+
+func (s *SLM) Infer(ctx context.Context, req *models.InferenceRequest) (*models.SLMResult, error) {
+	start := time.Now()
+	answer, err := s.script.answer(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	model := s.model
+	if req.TargetModel != "" {
+		model = req.TargetModel
+	}
+	return &models.SLMResult{
+		Response:       answer,
+		Strategy:       "single",
+		SelectedModel:  model,
+		ModelsUsed:     []string{model},
+		ModelLatencies: map[string]int64{model: time.Since(start).Milliseconds()},
+		Usage: []models.ModelUsage{{
+			Model:        model,
+			Calls:        1,
+			InputTokens:  utils.CountTokens(req.PromptText(), model),
+			OutputTokens: utils.CountTokens(answer, model),
+		}},
+	}, nil
+}
+
+func (s *SLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (*models.SLMResult, error) {
+	return s.Infer(ctx, models.NewChatInferenceRequest(messages, opts))
+}
+
+func (s *SLM) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) error {
+	result, err := s.Infer(ctx, req)
+	if err != nil {
+		return err
+	}
+	models.RecordSLMResult(ctx, result)
+	return stream(result.Response, callback)
+}
+
+func (s *SLM) Close() error {
+	return nil
+}
@@ -0,0 +1,122 @@
+// Package fakes provides deterministic in-memory implementations of the
+// model, embedding and cache interfaces for tests and for MOCK_PROVIDERS
+// local development. Unlike the testify mocks they need no expectations: they
+// answer from canned responses, can simulate latency and failures, and record
+// every call for assertions.
+package fakes
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// script holds the canned behaviour shared by the fake models
+type script struct {
+	mu            sync.Mutex
+	answers       map[string]string
+	defaultAnswer string
+	responder     func(req *models.InferenceRequest) string
+	latency       time.Duration
+	err           error
+	calls         []models.InferenceRequest
+	forgetCalls   bool
+}
+
+func newScript(defaultAnswer string) *script {
+	return &script{
+		answers:       make(map[string]string),
+		defaultAnswer: defaultAnswer,
+	}
+}
+
+// answer records the call, waits out the latency and returns the canned answer
+func (s *script) answer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	s.mu.Lock()
+	if !s.forgetCalls {
+		s.calls = append(s.calls, *req)
+	}
+	answer, ok := s.answers[req.Query]
+	if !ok {
+		answer = s.defaultAnswer
+		if s.responder != nil {
+			answer = s.responder(req)
+		}
+	}
+	latency, err := s.latency, s.err
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	return answer, nil
+}
+
+func (s *script) setAnswer(query string, answer string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.answers[query] = answer
+}
+
+func (s *script) setResponder(fn func(req *models.InferenceRequest) string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responder = fn
+}
+
+func (s *script) setForgetCalls(forget bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.forgetCalls = forget
+	s.calls = nil
+}
+
+func (s *script) setLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+func (s *script) setError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = err
+}
+
+func (s *script) recorded() []models.InferenceRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]models.InferenceRequest(nil), s.calls...)
+}
+
+// stream sends the answer word by word
+func stream(answer string, callback func(string) error) error {
+	words := strings.SplitAfter(answer, " ")
+	for _, word := range words {
+		if word == "" {
+			continue
+		}
+		if err := callback(word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,290 @@
+// Package faq manages curated "pinned answers": admin-reviewed answers to
+// frequently asked queries that are served without calling a model.
+package faq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+const (
+	answerKeyPrefix = "faq:answer:" // Answer ID -> PinnedAnswer JSON
+	queryKeyPrefix  = "faq:query:"  // Normalized query -> answer ID
+	idsKey          = "faq:ids"
+	approvedKey     = "faq:approved" // Normalized query -> approved PinnedAnswer JSON, for serving
+	hitsKey         = "faq:hits"     // Answer ID -> times served
+
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusRejected = "rejected"
+)
+
+var (
+	// ErrNotFound is returned for unknown answer IDs
+	ErrNotFound = errors.New("pinned answer not found")
+	// ErrDuplicateQuery is returned when the query already has a pinned answer
+	ErrDuplicateQuery = errors.New("query already has a pinned answer")
+	// ErrEmptyQuery is returned for queries that are empty once normalized
+	ErrEmptyQuery = errors.New("query is empty")
+)
+
+// Store keeps pinned answers in Redis. New and edited answers are pending
+// until reviewed; only approved answers are returned by Lookup.
+type Store struct {
+	client *redis.Client
+	clock  clock.Clock
+}
+
+func NewStore(client *redis.Client) *Store {
+	return &Store{
+		client: client,
+		clock:  clock.Real(),
+	}
+}
+
+// SetClock sets the clock used for creation and review times
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Create adds a pending answer for the query
+func (s *Store) Create(ctx context.Context, query string, answer string, author string) (*models.PinnedAnswer, error) {
+	query = router.NormalizeQuery(query)
+	if query == "" {
+		return nil, ErrEmptyQuery
+	}
+
+	now := s.clock.Now()
+	pinned := &models.PinnedAnswer{
+		ID:        "faq_" + uuid.New().String(),
+		Query:     query,
+		Answer:    answer,
+		Status:    StatusPending,
+		CreatedBy: author,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	claimed, err := s.client.SetNX(ctx, queryKeyPrefix+query, pinned.ID, 0).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pinned answer: %w", err)
+	}
+	if !claimed {
+		return nil, ErrDuplicateQuery
+	}
+
+	if err := s.save(ctx, pinned); err != nil {
+		_ = s.client.Del(ctx, queryKeyPrefix+query).Err()
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// Get returns an answer by ID
+func (s *Store) Get(ctx context.Context, id string) (*models.PinnedAnswer, error) {
+	data, err := s.client.Get(ctx, answerKeyPrefix+id).Result()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pinned answer: %w", err)
+	}
+
+	var pinned models.PinnedAnswer
+	if err := json.Unmarshal([]byte(data), &pinned); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pinned answer: %w", err)
+	}
+
+	hits, err := s.client.HGet(ctx, hitsKey, id).Int64()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get pinned answer hits: %w", err)
+	}
+	pinned.Hits = hits
+	return &pinned, nil
+}
+
+// List returns all answers with the status, or every answer when status is
+// empty, most recently updated first
+func (s *Store) List(ctx context.Context, status string) ([]models.PinnedAnswer, error) {
+	ids, err := s.client.SMembers(ctx, idsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned answers: %w", err)
+	}
+
+	answers := make([]models.PinnedAnswer, 0, len(ids))
+	for _, id := range ids {
+		pinned, err := s.Get(ctx, id)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if status == "" || pinned.Status == status {
+			answers = append(answers, *pinned)
+		}
+	}
+
+	sort.Slice(answers, func(i, j int) bool {
+		return answers[i].UpdatedAt.After(answers[j].UpdatedAt)
+	})
+	return answers, nil
+}
+
+// Update replaces the answer text. The edit has to be reviewed again, so the
+// answer stops being served until it is re-approved.
+func (s *Store) Update(ctx context.Context, id string, answer string, author string) (*models.PinnedAnswer, error) {
+	pinned, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned.Answer = answer
+	pinned.Status = StatusPending
+	pinned.UpdatedBy = author
+	pinned.ReviewedBy = ""
+	pinned.ReviewNote = ""
+	pinned.ReviewedAt = nil
+	pinned.UpdatedAt = s.clock.Now()
+
+	if err := s.save(ctx, pinned); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// Review approves or rejects an answer. Approved answers are served from the
+// next matching request on.
+func (s *Store) Review(ctx context.Context, id string, approve bool, reviewer string, note string) (*models.PinnedAnswer, error) {
+	pinned, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.clock.Now()
+	pinned.Status = StatusRejected
+	if approve {
+		pinned.Status = StatusApproved
+	}
+	pinned.ReviewedBy = reviewer
+	pinned.ReviewNote = note
+	pinned.ReviewedAt = &now
+	pinned.UpdatedAt = now
+
+	if err := s.save(ctx, pinned); err != nil {
+		return nil, err
+	}
+	return pinned, nil
+}
+
+// Delete removes an answer; it stops being served immediately
+func (s *Store) Delete(ctx context.Context, id string) error {
+	pinned, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Del(ctx, answerKeyPrefix+id)
+	pipe.Del(ctx, queryKeyPrefix+pinned.Query)
+	pipe.SRem(ctx, idsKey, id)
+	pipe.HDel(ctx, approvedKey, pinned.Query)
+	pipe.HDel(ctx, hitsKey, id)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete pinned answer: %w", err)
+	}
+	return nil
+}
+
+// Lookup returns the approved answer for the query, or nil if there is none,
+// and counts the hit
+func (s *Store) Lookup(ctx context.Context, query string) (*models.PinnedAnswer, error) {
+	query = router.NormalizeQuery(query)
+	if query == "" {
+		return nil, nil
+	}
+
+	data, err := s.client.HGet(ctx, approvedKey, query).Result()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up pinned answer: %w", err)
+	}
+
+	var pinned models.PinnedAnswer
+	if err := json.Unmarshal([]byte(data), &pinned); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pinned answer: %w", err)
+	}
+
+	hits, err := s.client.HIncrBy(ctx, hitsKey, pinned.ID, 1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count pinned answer hit: %w", err)
+	}
+	pinned.Hits = hits
+	return &pinned, nil
+}
+
+// Candidates returns the queries of the report asked at least minCount times
+// that don't have a pinned answer yet, most frequent first
+func (s *Store) Candidates(ctx context.Context, report *models.QueryReport, minCount int64) ([]models.QueryCount, error) {
+	var frequent []models.QueryCount
+	for _, query := range report.TopQueries {
+		if query.Count >= minCount {
+			frequent = append(frequent, query)
+		}
+	}
+	if len(frequent) == 0 {
+		return []models.QueryCount{}, nil
+	}
+
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(frequent))
+	for i, query := range frequent {
+		cmds[i] = pipe.Exists(ctx, queryKeyPrefix+router.NormalizeQuery(query.Query))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to check pinned answers: %w", err)
+	}
+
+	candidates := []models.QueryCount{}
+	for i, cmd := range cmds {
+		if cmd.Val() == 0 {
+			candidates = append(candidates, frequent[i])
+		}
+	}
+	return candidates, nil
+}
+
+// save stores the answer and keeps the serving index in step with its status
+func (s *Store) save(ctx context.Context, pinned *models.PinnedAnswer) error {
+	stored := *pinned
+	stored.Hits = 0 // Counted separately
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal pinned answer: %w", err)
+	}
+
+	pipe := s.client.TxPipeline()
+	pipe.Set(ctx, answerKeyPrefix+pinned.ID, data, 0)
+	pipe.SAdd(ctx, idsKey, pinned.ID)
+	if pinned.Status == StatusApproved {
+		pipe.HSet(ctx, approvedKey, pinned.Query, data)
+	} else {
+		pipe.HDel(ctx, approvedKey, pinned.Query)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to save pinned answer: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package faq
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupStore(t *testing.T) (*Store, *clock.Fake) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	store := NewStore(client)
+	store.SetClock(fakeClock)
+	return store, fakeClock
+}
+
+func TestStore_ReviewWorkflow(t *testing.T) {
+	store, fakeClock := setupStore(t)
+	ctx := context.Background()
+
+	pinned, err := store.Create(ctx, "What are your opening hours?", "9 to 5, Monday to Friday.", "alice")
+	require.NoError(t, err)
+	assert.Equal(t, "what are your opening hours", pinned.Query)
+	assert.Equal(t, StatusPending, pinned.Status)
+
+	served, err := store.Lookup(ctx, "what are your opening hours")
+	require.NoError(t, err)
+	assert.Nil(t, served, "pending answers aren't served")
+
+	fakeClock.Advance(time.Hour)
+	_, err = store.Review(ctx, pinned.ID, true, "bob", "Checked with support")
+	require.NoError(t, err)
+
+	served, err = store.Lookup(ctx, "  WHAT are your opening hours!")
+	require.NoError(t, err)
+	require.NotNil(t, served)
+	assert.Equal(t, "9 to 5, Monday to Friday.", served.Answer)
+	assert.Equal(t, int64(1), served.Hits)
+
+	// Edits go back to review and stop being served
+	_, err = store.Update(ctx, pinned.ID, "9 to 6, Monday to Saturday.", "alice")
+	require.NoError(t, err)
+	served, err = store.Lookup(ctx, "What are your opening hours?")
+	require.NoError(t, err)
+	assert.Nil(t, served)
+
+	stored, err := store.Get(ctx, pinned.ID)
+	require.NoError(t, err)
+	assert.Equal(t, StatusPending, stored.Status)
+	assert.Empty(t, stored.ReviewedBy)
+	assert.Equal(t, int64(1), stored.Hits)
+
+	_, err = store.Review(ctx, pinned.ID, false, "bob", "Saturdays aren't confirmed")
+	require.NoError(t, err)
+	rejected, err := store.List(ctx, StatusRejected)
+	require.NoError(t, err)
+	require.Len(t, rejected, 1)
+	assert.Equal(t, "Saturdays aren't confirmed", rejected[0].ReviewNote)
+}
+
+func TestStore_CreateAndDelete(t *testing.T) {
+	store, _ := setupStore(t)
+	ctx := context.Background()
+
+	pinned, err := store.Create(ctx, "Who are you?", "A helpful assistant.", "")
+	require.NoError(t, err)
+
+	_, err = store.Create(ctx, "who are you", "Someone else.", "")
+	assert.ErrorIs(t, err, ErrDuplicateQuery)
+	_, err = store.Create(ctx, " ?! ", "Nothing.", "")
+	assert.ErrorIs(t, err, ErrEmptyQuery)
+
+	_, err = store.Review(ctx, pinned.ID, true, "", "")
+	require.NoError(t, err)
+	require.NoError(t, store.Delete(ctx, pinned.ID))
+
+	served, err := store.Lookup(ctx, "Who are you?")
+	require.NoError(t, err)
+	assert.Nil(t, served)
+	_, err = store.Get(ctx, pinned.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.ErrorIs(t, store.Delete(ctx, pinned.ID), ErrNotFound)
+
+	// The query can be pinned again
+	_, err = store.Create(ctx, "who are you", "Someone else.", "")
+	assert.NoError(t, err)
+}
+
+func TestStore_Candidates(t *testing.T) {
+	store, _ := setupStore(t)
+	ctx := context.Background()
+
+	_, err := store.Create(ctx, "who are you", "A helpful assistant.", "")
+	require.NoError(t, err)
+
+	report := &models.QueryReport{TopQueries: []models.QueryCount{
+		{Query: "who are you", Count: 50},
+		{Query: "what is go", Count: 20},
+		{Query: "tell me a joke", Count: 3},
+	}}
+	candidates, err := store.Candidates(ctx, report, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []models.QueryCount{{Query: "what is go", Count: 20}}, candidates)
+}
@@ -0,0 +1,230 @@
+package flags
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+)
+
+const (
+	flagsKey = "feature_flags"
+
+	defaultRefreshInterval = 5 * time.Second
+)
+
+// Runtime switches, all off by default
+const (
+	DisableSemanticCache = "disable_semantic_cache" // Serve and store responses through the exact-match cache only
+	DisableLLM           = "disable_llm"            // Route every query to the SLM tier
+	MaintenanceMode      = "maintenance_mode"       // Reject mutating API requests with 503
+)
+
+// Known lists every flag that can be set through the admin API
+var Known = []string{DisableSemanticCache, DisableLLM, MaintenanceMode}
+
+var (
+	// ErrUnknownFlag is returned when setting a flag that isn't in Known
+	ErrUnknownFlag = errors.New("unknown feature flag")
+	// ErrInvalidPercentage is returned for rollout percentages outside 0-100
+	ErrInvalidPercentage = errors.New("rollout percentage must be between 0 and 100")
+)
+
+// Flag is the rollout rule for one feature flag. A flag is on for a user when
+// it is enabled for everyone, the user or their org is targeted, or the user
+// falls into the rollout percentage.
+type Flag struct {
+	Enabled    bool     `json:"enabled"`              // On for everyone
+	Percentage int      `json:"percentage,omitempty"` // Share of users (0-100) the flag is on for
+	Users      []string `json:"users,omitempty"`      // User IDs the flag is always on for
+	Orgs       []string `json:"orgs,omitempty"`       // Orgs (email domains) the flag is always on for
+}
+
+// OrgResolver returns the org a user belongs to, or "" if unknown
+type OrgResolver func(ctx context.Context, userID string) string
+
+// ConsentChecker reports whether a user may take part in percentage rollouts
+type ConsentChecker func(ctx context.Context, userID string) bool
+
+// Store keeps feature flags in a Redis hash so they can be flipped at runtime
+// and take effect on every instance. Reads are served from a local copy that
+// is refreshed at most once per refresh interval.
+type Store struct {
+	client          *redis.Client
+	refreshInterval time.Duration
+	resolveOrg      OrgResolver
+	rolloutConsent  ConsentChecker
+
+	mu       sync.Mutex
+	flags    map[string]Flag
+	loadedAt time.Time
+	clock    clock.Clock
+}
+
+func NewStore(client *redis.Client, refreshInterval time.Duration) *Store {
+	if refreshInterval <= 0 {
+		refreshInterval = defaultRefreshInterval
+	}
+
+	return &Store{
+		client:          client,
+		refreshInterval: refreshInterval,
+		flags:           make(map[string]Flag),
+		clock:           clock.Real(),
+	}
+}
+
+// SetClock sets the clock that schedules refreshes from Redis
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetOrgResolver enables org targeting. The resolver is only called for flags
+// that target orgs.
+func (s *Store) SetOrgResolver(resolver OrgResolver) {
+	s.resolveOrg = resolver
+}
+
+// SetRolloutConsent leaves users who opted out of experiments out of
+// percentage rollouts. Targeting by user or org still applies to them.
+func (s *Store) SetRolloutConsent(consent ConsentChecker) {
+	s.rolloutConsent = consent
+}
+
+// Enabled reports whether a flag is on for everyone. A nil store has every
+// flag off. If Redis can't be reached the last known values are kept.
+func (s *Store) Enabled(ctx context.Context, name string) bool {
+	return s.get(ctx, name).Enabled
+}
+
+// EnabledFor reports whether a flag is on for the given user, taking user and
+// org targeting and the rollout percentage into account
+func (s *Store) EnabledFor(ctx context.Context, name string, userID string) bool {
+	flag := s.get(ctx, name)
+
+	switch {
+	case flag.Enabled:
+		return true
+	case slices.Contains(flag.Users, userID):
+		return true
+	case len(flag.Orgs) > 0 && s.resolveOrg != nil:
+		if org := s.resolveOrg(ctx, userID); org != "" && slices.Contains(flag.Orgs, org) {
+			return true
+		}
+	}
+	if flag.Percentage <= 0 || bucket(name, userID) >= flag.Percentage {
+		return false
+	}
+	return s.rolloutConsent == nil || s.rolloutConsent(ctx, userID)
+}
+
+// List returns the current rule of every known flag, read straight from Redis
+func (s *Store) List(ctx context.Context) (map[string]Flag, error) {
+	flags, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	s.flags = flags
+	s.loadedAt = s.clock.Now()
+	s.mu.Unlock()
+
+	return flags, nil
+}
+
+// Set turns a flag on or off for everyone, clearing any targeting
+func (s *Store) Set(ctx context.Context, name string, enabled bool) error {
+	return s.Put(ctx, name, Flag{Enabled: enabled})
+}
+
+// Put replaces a flag's rollout rule for all instances. Other instances pick
+// up the change within their refresh interval; this one sees it immediately.
+func (s *Store) Put(ctx context.Context, name string, flag Flag) error {
+	if !slices.Contains(Known, name) {
+		return fmt.Errorf("%w: %s", ErrUnknownFlag, name)
+	}
+	if flag.Percentage < 0 || flag.Percentage > 100 {
+		return ErrInvalidPercentage
+	}
+
+	data, err := json.Marshal(flag)
+	if err != nil {
+		return fmt.Errorf("failed to marshal feature flag: %w", err)
+	}
+	if err := s.client.HSet(ctx, flagsKey, name, data).Err(); err != nil {
+		return fmt.Errorf("failed to set feature flag: %w", err)
+	}
+
+	s.mu.Lock()
+	s.flags[name] = flag
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *Store) get(ctx context.Context, name string) Flag {
+	if s == nil {
+		return Flag{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.clock.Now().Sub(s.loadedAt) >= s.refreshInterval {
+		flags, err := s.load(ctx)
+		if err != nil {
+			log.Printf("Failed to refresh feature flags: %v", err)
+		} else {
+			s.flags = flags
+		}
+		// Don't retry a failing Redis on every request
+		s.loadedAt = s.clock.Now()
+	}
+	return s.flags[name]
+}
+
+func (s *Store) load(ctx context.Context) (map[string]Flag, error) {
+	fields, err := s.client.HGetAll(ctx, flagsKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feature flags: %w", err)
+	}
+
+	flags := make(map[string]Flag, len(Known))
+	for _, name := range Known {
+		flags[name] = parseFlag(fields[name])
+	}
+	return flags, nil
+}
+
+// parseFlag decodes a stored rule. Plain "true"/"false" values (written before
+// rollouts existed) mean on or off for everyone.
+func parseFlag(value string) Flag {
+	if enabled, err := strconv.ParseBool(value); err == nil {
+		return Flag{Enabled: enabled}
+	}
+
+	var flag Flag
+	if err := json.Unmarshal([]byte(value), &flag); err != nil && value != "" {
+		log.Printf("Ignoring malformed feature flag value %q: %v", value, err)
+	}
+	return flag
+}
+
+// bucket deterministically maps a user to 0-99 for a flag, so a user stays in
+// or out of a rollout as the percentage grows, independently for each flag
+func bucket(name string, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + ":" + userID))
+	return int(h.Sum32() % 100)
+}
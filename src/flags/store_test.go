@@ -0,0 +1,142 @@
+package flags
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+)
+
+func setupStore(t *testing.T, fakeClock *clock.Fake) (*Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	store := NewStore(client, 5*time.Second)
+	store.SetClock(fakeClock)
+	return store, mr
+}
+
+func TestStore_SetAndList(t *testing.T) {
+	store, _ := setupStore(t, clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)))
+	ctx := context.Background()
+
+	assert.False(t, store.Enabled(ctx, MaintenanceMode))
+
+	require.NoError(t, store.Set(ctx, MaintenanceMode, true))
+	assert.True(t, store.Enabled(ctx, MaintenanceMode))
+
+	values, err := store.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Flag{
+		DisableSemanticCache: {},
+		DisableLLM:           {},
+		MaintenanceMode:      {Enabled: true},
+	}, values)
+
+	err = store.Set(ctx, "turbo_mode", true)
+	assert.ErrorIs(t, err, ErrUnknownFlag)
+
+	err = store.Put(ctx, DisableLLM, Flag{Percentage: 150})
+	assert.ErrorIs(t, err, ErrInvalidPercentage)
+}
+
+func TestStore_EnabledForTargetsUsersAndOrgs(t *testing.T) {
+	store, _ := setupStore(t, clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)))
+	store.SetOrgResolver(func(ctx context.Context, userID string) string {
+		if userID == "carol" {
+			return "acme.com"
+		}
+		return ""
+	})
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, DisableLLM, Flag{Users: []string{"alice"}, Orgs: []string{"acme.com"}}))
+
+	assert.True(t, store.EnabledFor(ctx, DisableLLM, "alice"))
+	assert.True(t, store.EnabledFor(ctx, DisableLLM, "carol"))
+	assert.False(t, store.EnabledFor(ctx, DisableLLM, "bob"))
+	assert.False(t, store.Enabled(ctx, DisableLLM), "not on for everyone")
+}
+
+func TestStore_PercentageRolloutIsStable(t *testing.T) {
+	store, _ := setupStore(t, clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)))
+	ctx := context.Background()
+
+	countEnabled := func() map[string]bool {
+		enabled := make(map[string]bool)
+		for i := 0; i < 1000; i++ {
+			userID := fmt.Sprintf("user-%d", i)
+			if store.EnabledFor(ctx, DisableSemanticCache, userID) {
+				enabled[userID] = true
+			}
+		}
+		return enabled
+	}
+
+	require.NoError(t, store.Put(ctx, DisableSemanticCache, Flag{Percentage: 5}))
+	atFive := countEnabled()
+	assert.InDelta(t, 50, len(atFive), 25)
+
+	// Growing the rollout keeps everyone who already had the flag
+	require.NoError(t, store.Put(ctx, DisableSemanticCache, Flag{Percentage: 25}))
+	atTwentyFive := countEnabled()
+	assert.InDelta(t, 250, len(atTwentyFive), 50)
+	for userID := range atFive {
+		assert.True(t, atTwentyFive[userID], userID)
+	}
+}
+
+func TestStore_RolloutSkipsOptedOutUsers(t *testing.T) {
+	store, _ := setupStore(t, clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)))
+	store.SetRolloutConsent(func(ctx context.Context, userID string) bool {
+		return userID != "alice"
+	})
+	ctx := context.Background()
+
+	require.NoError(t, store.Put(ctx, DisableLLM, Flag{Percentage: 100}))
+	assert.True(t, store.EnabledFor(ctx, DisableLLM, "bob"))
+	assert.False(t, store.EnabledFor(ctx, DisableLLM, "alice"))
+
+	// Explicit targeting isn't an experiment
+	require.NoError(t, store.Put(ctx, DisableLLM, Flag{Percentage: 100, Users: []string{"alice"}}))
+	assert.True(t, store.EnabledFor(ctx, DisableLLM, "alice"))
+}
+
+func TestStore_ReadsLegacyBooleanValues(t *testing.T) {
+	store, mr := setupStore(t, clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)))
+
+	mr.HSet(flagsKey, MaintenanceMode, "true")
+	assert.True(t, store.Enabled(context.Background(), MaintenanceMode))
+}
+
+func TestStore_PicksUpChangesFromOtherInstances(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+	store, mr := setupStore(t, fakeClock)
+	ctx := context.Background()
+
+	assert.False(t, store.Enabled(ctx, DisableLLM))
+
+	// Another instance flips the flag
+	mr.HSet(flagsKey, DisableLLM, "true")
+	assert.False(t, store.Enabled(ctx, DisableLLM), "served from the local copy until the refresh interval passes")
+
+	fakeClock.Advance(5 * time.Second)
+	assert.True(t, store.Enabled(ctx, DisableLLM))
+
+	// Redis outage keeps the last known values
+	mr.SetError("connection refused")
+	fakeClock.Advance(5 * time.Second)
+	assert.True(t, store.Enabled(ctx, DisableLLM))
+}
+
+func TestStore_NilStoreHasEverythingOff(t *testing.T) {
+	var store *Store
+	assert.False(t, store.Enabled(context.Background(), MaintenanceMode))
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/annotations"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const annotationsPageSize = 500
+
+// AnnotationsHandler lets reviewers label past responses by the user who sent
+// the request and its ID. Reviewers are admins signed in and API keys with
+// the responses:annotate scope.
+type AnnotationsHandler struct {
+	store *annotations.Store
+}
+
+func NewAnnotationsHandler(store *annotations.Store) *AnnotationsHandler {
+	return &AnnotationsHandler{store: store}
+}
+
+// RequireReviewer answers 403 to anyone who may not annotate responses
+func (h *AnnotationsHandler) RequireReviewer(c *gin.Context) {
+	allowed := middleware.GetRole(c) == models.RoleAdmin
+	if key := middleware.GetAPIKey(c); key != nil {
+		allowed = key.HasScope(models.ScopeAnnotate)
+	}
+	if !allowed {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Annotating responses needs an admin or an API key with the " + models.ScopeAnnotate + " scope"})
+		return
+	}
+	c.Next()
+}
+
+// response returns the response the path names, answering 400 when its IDs
+// are malformed. User IDs are held to the rules for request IDs.
+func (h *AnnotationsHandler) response(c *gin.Context) (annotations.Response, bool) {
+	response := annotations.Response{UserID: c.Param("user_id"), RequestID: c.Param("request_id")}
+	if !middleware.ValidRequestID(response.UserID) || !middleware.ValidRequestID(response.RequestID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user or request ID"})
+		return response, false
+	}
+	return response, true
+}
+
+// Annotate creates or replaces the caller's annotation of a response
+func (h *AnnotationsHandler) Annotate(c *gin.Context) {
+	response, ok := h.response(c)
+	if !ok {
+		return
+	}
+	var req models.AnnotationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	annotation, err := h.store.Annotate(c.Request.Context(), middleware.GetUserID(c), response, req)
+	if errors.Is(err, annotations.ErrUnknownCategory) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, annotations.ErrUnknownResponse) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No such request in the annotation window"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to annotate %s: %v", response.RequestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save annotation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, annotation)
+}
+
+// GetAnnotations returns every reviewer's annotation of a response
+func (h *AnnotationsHandler) GetAnnotations(c *gin.Context) {
+	response, ok := h.response(c)
+	if !ok {
+		return
+	}
+	annotated, err := h.store.Get(c.Request.Context(), response)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get annotations"})
+		return
+	}
+	if annotated == nil {
+		annotated = []models.Annotation{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": response.UserID, "request_id": response.RequestID, "annotations": annotated})
+}
+
+// DeleteAnnotation removes the caller's annotation of a response
+func (h *AnnotationsHandler) DeleteAnnotation(c *gin.Context) {
+	response, ok := h.response(c)
+	if !ok {
+		return
+	}
+	err := h.store.Delete(c.Request.Context(), middleware.GetUserID(c), response)
+	if errors.Is(err, annotations.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Annotation not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete annotation"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ExportAnnotations streams the annotations of responses annotated between
+// ?since= and ?until= (RFC 3339; since defaults to the beginning and until to
+// now) as JSON lines, for eval suites
+func (h *AnnotationsHandler) ExportAnnotations(c *gin.Context) {
+	var since, until time.Time
+	var err error
+	if raw := c.Query("since"); raw != "" {
+		if since, err = time.Parse(time.RFC3339, raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 time"})
+			return
+		}
+	}
+	if raw := c.Query("until"); raw != "" {
+		until, err = time.Parse(time.RFC3339, raw)
+		if err != nil || until.Before(since) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be an RFC 3339 time after since"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	err = h.store.Range(c.Request.Context(), since, until, annotationsPageSize, func(page []models.Annotation) error {
+		for _, annotation := range page {
+			if err := encoder.Encode(annotation); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		// The status has been sent; the client sees a truncated export
+		log.Printf("Failed to export annotations: %v", err)
+	}
+}
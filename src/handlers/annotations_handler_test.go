@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/annotations"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+// reviewer is who sends a request to the annotations API
+type reviewer struct {
+	userID string
+	role   string
+	key    *models.APIKey
+}
+
+var (
+	adminReviewer       = reviewer{userID: "admin-1", role: models.RoleAdmin}
+	userReviewer        = reviewer{userID: "user-1", role: models.RoleUser}
+	scopedKeyReviewer   = reviewer{userID: "user-2", role: models.RoleUser, key: &models.APIKey{ID: "key_1", Scopes: []string{models.ScopeAnnotate}}}
+	unscopedKeyReviewer = reviewer{userID: "admin-1", role: models.RoleAdmin, key: &models.APIKey{ID: "key_2"}}
+)
+
+// setupAnnotations serves the annotations API, with carol's request req-1
+// recorded by the usage ledger
+func setupAnnotations(t *testing.T) func(who reviewer, method string, path string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	usageStore := usage.NewStore(client)
+	usageStore.SetRequestRetention(time.Hour)
+	ctx := correlation.WithRequestID(context.Background(), "req-1")
+	require.NoError(t, usageStore.Record(ctx, "carol", &models.CostMetrics{}, false))
+
+	handler := NewAnnotationsHandler(annotations.NewStore(client, usageStore, config.AnnotationsConfig{Categories: []string{"factual"}}))
+
+	return func(who reviewer, method string, path string, body string) *httptest.ResponseRecorder {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			middleware.SetUserID(c, who.userID)
+			c.Set("role", who.role)
+			if who.key != nil {
+				c.Set("api_key", who.key)
+			}
+			c.Next()
+		})
+		reviewers := r.Group("/annotations", handler.RequireReviewer)
+		reviewers.GET("", handler.ExportAnnotations)
+		reviewers.GET("/:user_id/:request_id", handler.GetAnnotations)
+		reviewers.PUT("/:user_id/:request_id", handler.Annotate)
+		reviewers.DELETE("/:user_id/:request_id", handler.DeleteAnnotation)
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+}
+
+func TestAnnotationsHandler_RequireReviewer(t *testing.T) {
+	send := setupAnnotations(t)
+
+	tests := []struct {
+		name string
+		who  reviewer
+		want int
+	}{
+		{"admins review", adminReviewer, http.StatusOK},
+		{"users don't", userReviewer, http.StatusForbidden},
+		{"keys with the scope review", scopedKeyReviewer, http.StatusOK},
+		{"keys need the scope, whoever owns them", unscopedKeyReviewer, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.who, http.MethodGet, "/annotations/carol/req-1", "")
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestAnnotationsHandler_Annotate(t *testing.T) {
+	send := setupAnnotations(t)
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"annotates", "/annotations/carol/req-1", `{"label": "incorrect", "category": "factual"}`, http.StatusOK},
+		{"malformed request ID", "/annotations/carol/req%201", `{"label": "correct"}`, http.StatusBadRequest},
+		{"malformed user ID", "/annotations/car%0Aol/req-1", `{"label": "correct"}`, http.StatusBadRequest},
+		{"unknown label", "/annotations/carol/req-1", `{"label": "meh"}`, http.StatusBadRequest},
+		{"unknown category", "/annotations/carol/req-1", `{"label": "correct", "category": "vibes"}`, http.StatusBadRequest},
+		{"unknown request", "/annotations/carol/req-2", `{"label": "correct"}`, http.StatusNotFound},
+		{"someone else's request", "/annotations/dave/req-1", `{"label": "correct"}`, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(adminReviewer, http.MethodPut, tt.path, tt.body)
+			assert.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+
+	w := send(adminReviewer, http.MethodGet, "/annotations/carol/req-1", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var got struct {
+		Annotations []models.Annotation `json:"annotations"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &got))
+	require.Len(t, got.Annotations, 1)
+	assert.Equal(t, "admin-1", got.Annotations[0].Reviewer)
+	assert.Equal(t, "incorrect", got.Annotations[0].Label)
+
+	w = send(adminReviewer, http.MethodGet, "/annotations/carol/req%201", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAnnotationsHandler_Delete(t *testing.T) {
+	send := setupAnnotations(t)
+	require.Equal(t, http.StatusOK, send(adminReviewer, http.MethodPut, "/annotations/carol/req-1", `{"label": "correct"}`).Code)
+
+	assert.Equal(t, http.StatusNotFound, send(scopedKeyReviewer, http.MethodDelete, "/annotations/carol/req-1", "").Code, "only the reviewer's own annotation is deleted")
+	assert.Equal(t, http.StatusBadRequest, send(adminReviewer, http.MethodDelete, "/annotations/carol/req%201", "").Code)
+	assert.Equal(t, http.StatusNoContent, send(adminReviewer, http.MethodDelete, "/annotations/carol/req-1", "").Code)
+	assert.Equal(t, http.StatusNotFound, send(adminReviewer, http.MethodDelete, "/annotations/carol/req-1", "").Code)
+}
+
+func TestAnnotationsHandler_Export(t *testing.T) {
+	send := setupAnnotations(t)
+	require.Equal(t, http.StatusOK, send(adminReviewer, http.MethodPut, "/annotations/carol/req-1", `{"label": "correct"}`).Code)
+	require.Equal(t, http.StatusOK, send(scopedKeyReviewer, http.MethodPut, "/annotations/carol/req-1", `{"label": "incorrect"}`).Code)
+
+	w := send(adminReviewer, http.MethodGet, "/annotations", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	var reviewers []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		var annotation models.Annotation
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &annotation))
+		assert.Equal(t, "carol", annotation.UserID)
+		assert.Equal(t, "req-1", annotation.RequestID)
+		reviewers = append(reviewers, annotation.Reviewer)
+	}
+	assert.ElementsMatch(t, []string{"admin-1", "user-2"}, reviewers)
+
+	assert.Equal(t, http.StatusBadRequest, send(adminReviewer, http.MethodGet, "/annotations?since=yesterday", "").Code)
+	assert.Equal(t, http.StatusBadRequest, send(adminReviewer, http.MethodGet, "/annotations?since=2026-05-02T00:00:00Z&until=2026-05-01T00:00:00Z", "").Code)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/auth"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+// CreateAPIKeyRequest is the body of POST /api/v1/keys
+type CreateAPIKeyRequest struct {
+	Name              string   `json:"name" binding:"required"`
+	RequestsPerMinute int      `json:"requests_per_minute,omitempty" binding:"min=0"`                                   // 0 uses the default rate limit; held to rate_limit.max_key_requests_per_minute
+	Scopes            []string `json:"scopes,omitempty" binding:"omitempty,dive,oneof=cache:bypass responses:annotate"` // Only admins may grant them
+}
+
+// APIKeyHandler lets users manage API keys for machine-to-machine access
+type APIKeyHandler struct {
+	store  *auth.APIKeyStore
+	outbox *outbox.Outbox // Receives key creation and revocation audit events, optional
+	maxRPM int            // Highest rate a key may be given; any when 0
+}
+
+func NewAPIKeyHandler(store *auth.APIKeyStore) *APIKeyHandler {
+	return &APIKeyHandler{
+		store: store,
+	}
+}
+
+// SetOutbox records key creations and revocations as audit events
+func (h *APIKeyHandler) SetOutbox(o *outbox.Outbox) {
+	h.outbox = o
+}
+
+// SetMaxRequestsPerMinute holds the rates keys are created with to max, the
+// most the rate limiter lets a key have
+func (h *APIKeyHandler) SetMaxRequestsPerMinute(max int) {
+	h.maxRPM = max
+}
+
+// CreateKey issues a key for the current user. The secret is only returned
+// here. Keys can't be used to create more keys.
+func (h *APIKeyHandler) CreateKey(c *gin.Context) {
+	if middleware.GetAPIKey(c) != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys can't create API keys, sign in instead"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(req.Scopes) > 0 && middleware.GetRole(c) != models.RoleAdmin {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can create keys with scopes"})
+		return
+	}
+
+	if h.maxRPM > 0 && req.RequestsPerMinute > h.maxRPM {
+		req.RequestsPerMinute = h.maxRPM
+	}
+
+	userID := middleware.GetUserID(c)
+	key, secret, err := h.store.Create(c.Request.Context(), userID, req.Name, req.RequestsPerMinute, req.Scopes...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	log.Printf("🔑 API key %s created for user %s", key.ID, userID)
+	recordAudit(c, h.outbox, "api_key.created", userID, gin.H{"key_id": key.ID, "name": key.Name, "scopes": key.Scopes})
+	c.JSON(http.StatusCreated, gin.H{
+		"key":    key,
+		"secret": secret,
+	})
+}
+
+// ListKeys returns the current user's keys, without their secrets
+func (h *APIKeyHandler) ListKeys(c *gin.Context) {
+	keys, err := h.store.List(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"keys": keys})
+}
+
+// RevokeKey deletes one of the current user's keys
+func (h *APIKeyHandler) RevokeKey(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	keyID := c.Param("key_id")
+
+	err := h.store.Revoke(c.Request.Context(), userID, keyID)
+	if errors.Is(err, auth.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+
+	log.Printf("🔑 API key %s revoked for user %s", keyID, userID)
+	recordAudit(c, h.outbox, "api_key.revoked", userID, gin.H{"key_id": keyID})
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,739 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/assistants"
+	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/jobs"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+// States of runs and responses
+const (
+	runQueued     = "queued"
+	runInProgress = "in_progress"
+	runCompleted  = "completed"
+	runFailed     = "failed"
+)
+
+const (
+	defaultThreadMessagesLimit = 20
+	maxThreadMessagesLimit     = 100
+)
+
+// AssistantsHandler serves the OpenAI Assistants and Responses patterns on
+// top of chat sessions, so agent frameworks written against them can use
+// HybridLM. Threads are sessions, runs are chat turns queued as jobs, and
+// responses are chat turns chained by previous_response_id.
+type AssistantsHandler struct {
+	sessions *chat.SessionStore
+	store    *assistants.Store
+	queue    *jobs.Queue // Runs and background responses, optional
+	runner   *gin.Engine // Answers chat turns through the chat handler
+}
+
+func NewAssistantsHandler(chatHandler *ChatHandler, sessions *chat.SessionStore, store *assistants.Store) *AssistantsHandler {
+	runner := gin.New()
+	runner.Use(middleware.InternalCaller())
+	runner.POST("/chat", chatHandler.HandleChat)
+
+	return &AssistantsHandler{
+		sessions: sessions,
+		store:    store,
+		runner:   runner,
+	}
+}
+
+// SetJobQueue enables runs and background responses, which run as jobs
+func (h *AssistantsHandler) SetJobQueue(queue *jobs.Queue) {
+	h.queue = queue
+}
+
+// CreateThread creates a session. Messages up to the last non-user one
+// become its history; the user messages after it wait for a run.
+func (h *AssistantsHandler) CreateThread(c *gin.Context) {
+	var req models.CreateThreadRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	system, history, pending, err := splitMessages(req.Messages)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	session, err := h.sessions.CreateSessionWithPrompt(ctx, middleware.GetUserID(c), system)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to create thread")
+		return
+	}
+	if err := h.addHistory(ctx, session.SessionID, history); err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to create thread")
+		return
+	}
+	if err := h.store.AddPending(ctx, session.SessionID, pending...); err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to create thread")
+		return
+	}
+
+	metadata := req.Metadata
+	if metadata == nil {
+		metadata = map[string]string{}
+	}
+	c.JSON(http.StatusOK, models.Thread{ID: session.SessionID, Object: "thread", CreatedAt: session.CreatedAt.Unix(), Metadata: metadata})
+}
+
+// GetThread returns a thread
+func (h *AssistantsHandler) GetThread(c *gin.Context) {
+	session, ok := h.thread(c, true)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, models.Thread{ID: session.SessionID, Object: "thread", CreatedAt: session.CreatedAt.Unix(), Metadata: map[string]string{}})
+}
+
+// DeleteThread deletes a thread's session and unanswered messages
+func (h *AssistantsHandler) DeleteThread(c *gin.Context) {
+	session, ok := h.thread(c, false)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.sessions.DeleteSession(ctx, session.SessionID); err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to delete thread")
+		return
+	}
+	if err := h.store.DeletePending(ctx, session.SessionID); err != nil {
+		log.Printf("Failed to delete pending messages of thread %s: %v", session.SessionID, err)
+	}
+	c.JSON(http.StatusOK, gin.H{"id": session.SessionID, "object": "thread.deleted", "deleted": true})
+}
+
+// CreateMessage adds a user message to a thread, answered by its next run
+func (h *AssistantsHandler) CreateMessage(c *gin.Context) {
+	var req models.MessageInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Role != "user" {
+		apiError(c, http.StatusBadRequest, "Only user messages can be added, runs write the assistant's")
+		return
+	}
+	text, err := messageText(req.Content)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	session, ok := h.thread(c, false)
+	if !ok {
+		return
+	}
+
+	message := newPendingMessage(text)
+	if err := h.store.AddPending(c.Request.Context(), session.SessionID, message); err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to add message")
+		return
+	}
+	c.JSON(http.StatusOK, threadMessage(session.SessionID, message, runInProgress))
+}
+
+// ListMessages returns a thread's messages, newest first unless ?order=asc.
+// Messages waiting for a run come last and are in_progress.
+func (h *AssistantsHandler) ListMessages(c *gin.Context) {
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		apiError(c, http.StatusBadRequest, "order must be \"asc\" or \"desc\"")
+		return
+	}
+	limit := defaultThreadMessagesLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxThreadMessagesLimit {
+			apiError(c, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxThreadMessagesLimit))
+			return
+		}
+		limit = n
+	}
+	session, ok := h.thread(c, true)
+	if !ok {
+		return
+	}
+	pending, err := h.store.Pending(c.Request.Context(), session.SessionID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to list messages")
+		return
+	}
+
+	messages := []models.ThreadMessage{}
+	for _, message := range session.Messages {
+		// Summaries of compacted history aren't messages of the thread
+		if message.Role == "user" || message.Role == "assistant" {
+			messages = append(messages, threadMessage(session.SessionID, message, runCompleted))
+		}
+	}
+	for _, message := range pending {
+		messages = append(messages, threadMessage(session.SessionID, message, runInProgress))
+	}
+	if order == "desc" {
+		slices.Reverse(messages)
+	}
+
+	hasMore := len(messages) > limit
+	messages = messages[:min(limit, len(messages))]
+	list := gin.H{"object": "list", "data": messages, "has_more": hasMore}
+	if len(messages) > 0 {
+		list["first_id"], list["last_id"] = messages[0].ID, messages[len(messages)-1].ID
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// CreateRun queues a chat turn answering the messages added to the thread
+// since its last run
+func (h *AssistantsHandler) CreateRun(c *gin.Context) {
+	var req models.CreateRunRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if req.Stream {
+		apiError(c, http.StatusBadRequest, "Streaming runs aren't supported, poll the run instead")
+		return
+	}
+	additional := make([]models.ChatMessage, 0, len(req.AdditionalMessages))
+	for _, input := range req.AdditionalMessages {
+		if input.Role != "user" {
+			apiError(c, http.StatusBadRequest, "additional_messages can only hold user messages")
+			return
+		}
+		text, err := messageText(input.Content)
+		if err != nil {
+			apiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		additional = append(additional, newPendingMessage(text))
+	}
+	session, ok := h.thread(c, false)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	if err := h.store.AddPending(ctx, session.SessionID, additional...); err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to create run")
+		return
+	}
+	pending, err := h.store.TakePending(ctx, session.SessionID)
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to create run")
+		return
+	}
+	if len(pending) == 0 {
+		apiError(c, http.StatusBadRequest, "Thread has no new user messages to answer")
+		return
+	}
+	if !h.setInstructions(ctx, session, req.Instructions) {
+		_ = h.store.AddPending(ctx, session.SessionID, pending...)
+		apiError(c, http.StatusInternalServerError, "Failed to create run")
+		return
+	}
+
+	chatReq := compatChatRequest(session.SessionID, req.Model, joinMessages(pending), req.Temperature, req.MaxCompletionTokens)
+	job, err := h.queue.EnqueueChat(ctx, middleware.GetCaller(c), chatReq)
+	if err != nil {
+		log.Printf("Failed to queue run: %v", err)
+		_ = h.store.AddPending(ctx, session.SessionID, pending...)
+		apiError(c, http.StatusInternalServerError, "Failed to create run")
+		return
+	}
+	c.JSON(http.StatusOK, runFromJob(job))
+}
+
+// GetRun returns a run's status, and its usage once it has completed
+func (h *AssistantsHandler) GetRun(c *gin.Context) {
+	job, err := h.queue.Get(c.Request.Context(), c.Param("run_id"), middleware.GetUserID(c))
+	if errors.Is(err, jobs.ErrJobForbidden) {
+		apiError(c, http.StatusForbidden, "Run belongs to another user")
+		return
+	}
+	if errors.Is(err, jobs.ErrJobNotFound) || (err == nil && (job.Chat == nil || job.Chat.SessionID != c.Param("thread_id"))) {
+		apiError(c, http.StatusNotFound, "Run not found")
+		return
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to get run")
+		return
+	}
+	c.JSON(http.StatusOK, runFromJob(job))
+}
+
+// CreateResponse answers input as the next turn of the conversation of
+// previous_response_id, or of a new one. Background responses are queued as
+// jobs and polled with GetResponse.
+func (h *AssistantsHandler) CreateResponse(c *gin.Context) {
+	var req models.CreateResponseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Stream {
+		apiError(c, http.StatusBadRequest, "Streaming responses aren't supported, use background and poll instead")
+		return
+	}
+	if req.Background && h.queue == nil {
+		apiError(c, http.StatusBadRequest, "Background responses need async jobs to be enabled")
+		return
+	}
+	input, err := responseInput(req.Input)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	system, history, pending, err := splitMessages(input)
+	if err != nil {
+		apiError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(pending) == 0 {
+		apiError(c, http.StatusBadRequest, "input must end with a user message")
+		return
+	}
+	instructions := strings.TrimSpace(strings.Join([]string{req.Instructions, system}, "\n\n"))
+
+	ctx := c.Request.Context()
+	userID := middleware.GetUserID(c)
+	var session *models.ChatSession
+	if req.PreviousResponseID != "" {
+		previous, err := h.store.GetResponse(ctx, req.PreviousResponseID, userID)
+		if errors.Is(err, assistants.ErrResponseForbidden) {
+			apiError(c, http.StatusForbidden, "Previous response belongs to another user")
+			return
+		}
+		if errors.Is(err, assistants.ErrResponseNotFound) {
+			apiError(c, http.StatusNotFound, "Previous response not found")
+			return
+		}
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "Failed to get previous response")
+			return
+		}
+		session, err = h.sessions.GetSessionForUser(ctx, previous.SessionID, userID)
+		if err != nil {
+			apiError(c, http.StatusNotFound, "Conversation of the previous response has expired")
+			return
+		}
+		if !h.setInstructions(ctx, session, instructions) {
+			apiError(c, http.StatusInternalServerError, "Failed to create response")
+			return
+		}
+	} else {
+		session, err = h.sessions.CreateSessionWithPrompt(ctx, userID, instructions)
+		if err != nil {
+			apiError(c, http.StatusInternalServerError, "Failed to create response")
+			return
+		}
+	}
+	if err := h.addHistory(ctx, session.SessionID, history); err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to create response")
+		return
+	}
+
+	response := &assistants.Response{
+		ID:                 "resp_" + uuid.New().String(),
+		UserID:             userID,
+		SessionID:          session.SessionID,
+		PreviousResponseID: req.PreviousResponseID,
+		Model:              req.Model,
+		CreatedAt:          time.Now(),
+	}
+	chatReq := compatChatRequest(session.SessionID, req.Model, joinMessages(pending), req.Temperature, req.MaxOutputTokens)
+	status := http.StatusOK
+	if req.Background {
+		job, err := h.queue.EnqueueChat(ctx, middleware.GetCaller(c), chatReq)
+		if err != nil {
+			log.Printf("Failed to queue response: %v", err)
+			apiError(c, http.StatusInternalServerError, "Failed to create response")
+			return
+		}
+		response.JobID = job.ID
+		response.Status = runQueued
+	} else {
+		// The turn is answered for this request's caller, with its API key's
+		// scopes, and its tokens count against the caller's quota here
+		call := &middleware.InternalCall{Caller: middleware.GetCaller(c)}
+		var body []byte
+		status, body = serveInternal(ctx, h.runner, "/chat", call, chatReq)
+		middleware.AddTokenUsage(c, call.Tokens)
+		finishResponse(response, status, body, errorMessage(body))
+	}
+
+	if err := h.store.SaveResponse(context.WithoutCancel(ctx), response); err != nil {
+		log.Printf("Failed to save response %s: %v", response.ID, err)
+	}
+	if response.Status == runFailed {
+		if status < http.StatusBadRequest {
+			status = http.StatusInternalServerError
+		}
+		apiError(c, status, response.Error)
+		return
+	}
+	c.JSON(http.StatusOK, responseObject(response))
+}
+
+// GetResponse returns a response, checking on its job while it runs
+func (h *AssistantsHandler) GetResponse(c *gin.Context) {
+	response, ok := h.response(c)
+	if !ok {
+		return
+	}
+
+	if response.JobID != "" && h.queue != nil && response.Status != runCompleted && response.Status != runFailed {
+		ctx := c.Request.Context()
+		job, err := h.queue.Get(ctx, response.JobID, response.UserID)
+		switch {
+		case errors.Is(err, jobs.ErrJobNotFound):
+			response.Status, response.Error = runFailed, "Response expired before it finished"
+		case err != nil:
+			apiError(c, http.StatusInternalServerError, "Failed to get response")
+			return
+		case job.Done():
+			finishResponse(response, job.StatusCode, job.Result, job.Error)
+		default:
+			response.Status = runStatus(job.Status)
+		}
+		if response.Status == runCompleted || response.Status == runFailed {
+			if err := h.store.SaveResponse(ctx, response); err != nil {
+				log.Printf("Failed to save response %s: %v", response.ID, err)
+			}
+		}
+	}
+	c.JSON(http.StatusOK, responseObject(response))
+}
+
+// DeleteResponse deletes a response; its conversation stays in the session
+func (h *AssistantsHandler) DeleteResponse(c *gin.Context) {
+	response, ok := h.response(c)
+	if !ok {
+		return
+	}
+	if err := h.store.DeleteResponse(c.Request.Context(), response.ID); err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to delete response")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": response.ID, "object": "response", "deleted": true})
+}
+
+// thread loads the session of the thread_id param, answering 403 or 404 if
+// it's not the user's. view allows a read replica.
+func (h *AssistantsHandler) thread(c *gin.Context, view bool) (*models.ChatSession, bool) {
+	ctx := c.Request.Context()
+	threadID := c.Param("thread_id")
+	userID := middleware.GetUserID(c)
+
+	var session *models.ChatSession
+	var err error
+	if view {
+		session, err = h.sessions.ViewSession(ctx, threadID, userID)
+	} else {
+		session, err = h.sessions.GetSessionForUser(ctx, threadID, userID)
+	}
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		apiError(c, http.StatusForbidden, "Thread belongs to another user")
+		return nil, false
+	}
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		apiError(c, http.StatusNotFound, "Thread not found")
+		return nil, false
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to get thread")
+		return nil, false
+	}
+	return session, true
+}
+
+// response loads the response of the response_id param, answering 403 or
+// 404 if it's not the user's
+func (h *AssistantsHandler) response(c *gin.Context) (*assistants.Response, bool) {
+	response, err := h.store.GetResponse(c.Request.Context(), c.Param("response_id"), middleware.GetUserID(c))
+	if errors.Is(err, assistants.ErrResponseForbidden) {
+		apiError(c, http.StatusForbidden, "Response belongs to another user")
+		return nil, false
+	}
+	if errors.Is(err, assistants.ErrResponseNotFound) {
+		apiError(c, http.StatusNotFound, "Response not found")
+		return nil, false
+	}
+	if err != nil {
+		apiError(c, http.StatusInternalServerError, "Failed to get response")
+		return nil, false
+	}
+	return response, true
+}
+
+// setInstructions makes instructions the session's system prompt
+func (h *AssistantsHandler) setInstructions(ctx context.Context, session *models.ChatSession, instructions string) bool {
+	if instructions == "" || instructions == session.SystemPrompt {
+		return true
+	}
+	session.SystemPrompt = instructions
+	if err := h.sessions.SaveSession(ctx, session); err != nil {
+		log.Printf("Failed to set instructions of session %s: %v", session.SessionID, err)
+		return false
+	}
+	return true
+}
+
+// addHistory adds earlier turns given with a request to the session
+func (h *AssistantsHandler) addHistory(ctx context.Context, sessionID string, history []models.ChatMessage) error {
+	for _, message := range history {
+		if err := h.sessions.AddMessage(ctx, sessionID, message.Role, message.Content, utils.CountTokens(message.Content, "")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compatChatRequest turns a run or response into a chat turn. Only models
+// HybridLM serves can be asked for: "auto" or none lets the router decide,
+// and "llm" or "slm" pick a tier.
+func compatChatRequest(sessionID string, model string, message string, temperature float32, maxTokens int) models.ChatRequest {
+	req := models.ChatRequest{
+		SessionID:   sessionID,
+		Message:     message,
+		MaxTokens:   maxTokens,
+		Temperature: temperature,
+	}
+	switch model {
+	case "", "auto":
+	case "llm", "slm":
+		req.ModelPreference = model
+	default:
+		req.Model = model
+	}
+	return req
+}
+
+// finishResponse records the chat handler's answer to a response's turn
+func finishResponse(response *assistants.Response, status int, body []byte, message string) {
+	if status >= 200 && status < 300 {
+		var result models.ChatResponse
+		if err := json.Unmarshal(body, &result); err == nil {
+			response.Status = runCompleted
+			response.Result = &result
+			response.SessionID = result.SessionID
+			return
+		}
+	}
+	response.Status = runFailed
+	response.Error = message
+	if response.Error == "" {
+		response.Error = http.StatusText(status)
+	}
+}
+
+func responseObject(response *assistants.Response) models.ResponseObject {
+	object := models.ResponseObject{
+		ID:                 response.ID,
+		Object:             "response",
+		CreatedAt:          response.CreatedAt.Unix(),
+		Status:             response.Status,
+		Model:              response.Model,
+		Output:             []models.ResponseOutput{},
+		PreviousResponseID: response.PreviousResponseID,
+		Metadata:           map[string]string{"session_id": response.SessionID},
+	}
+	if response.Error != "" {
+		object.Error = &models.APIError{Code: "server_error", Message: response.Error}
+	}
+	if result := response.Result; result != nil {
+		object.Model = result.ModelUsed
+		object.OutputText = result.Response
+		object.Output = append(object.Output, models.ResponseOutput{
+			Type:    "message",
+			ID:      "msg_" + strings.TrimPrefix(response.ID, "resp_"),
+			Role:    "assistant",
+			Status:  runCompleted,
+			Content: []models.ResponseContent{{Type: "output_text", Text: result.Response, Annotations: []any{}}},
+		})
+		if metrics := result.CostMetrics; metrics != nil {
+			object.Usage = &models.ResponseUsage{InputTokens: metrics.InputTokens, OutputTokens: metrics.OutputTokens, TotalTokens: metrics.TotalTokens}
+		}
+	}
+	return object
+}
+
+func runFromJob(job *jobs.Job) models.Run {
+	run := models.Run{
+		ID:        job.ID,
+		Object:    "thread.run",
+		CreatedAt: job.CreatedAt.Unix(),
+		ThreadID:  job.Chat.SessionID,
+		Status:    runStatus(job.Status),
+		Model:     job.Chat.Model,
+	}
+	if !job.StartedAt.IsZero() {
+		started := job.StartedAt.Unix()
+		run.StartedAt = &started
+	}
+	switch job.Status {
+	case jobs.StatusSucceeded:
+		completed := job.CompletedAt.Unix()
+		run.CompletedAt = &completed
+		var result models.ChatResponse
+		if err := json.Unmarshal(job.Result, &result); err == nil {
+			run.Model = result.ModelUsed
+			if metrics := result.CostMetrics; metrics != nil {
+				run.Usage = &models.RunUsage{PromptTokens: metrics.InputTokens, CompletionTokens: metrics.OutputTokens, TotalTokens: metrics.TotalTokens}
+			}
+		}
+	case jobs.StatusFailed:
+		failed := job.CompletedAt.Unix()
+		run.FailedAt = &failed
+		run.LastError = &models.APIError{Code: "server_error", Message: job.Error}
+	}
+	return run
+}
+
+// runStatus maps a job's status to a run's
+func runStatus(status string) string {
+	switch status {
+	case jobs.StatusRunning:
+		return runInProgress
+	case jobs.StatusSucceeded:
+		return runCompleted
+	case jobs.StatusFailed:
+		return runFailed
+	}
+	return runQueued
+}
+
+func threadMessage(threadID string, message models.ChatMessage, status string) models.ThreadMessage {
+	return models.ThreadMessage{
+		ID:        message.ID,
+		Object:    "thread.message",
+		CreatedAt: message.Timestamp.Unix(),
+		ThreadID:  threadID,
+		Role:      message.Role,
+		Status:    status,
+		Content:   []models.MessageContent{{Type: "text", Text: models.MessageText{Value: message.Content, Annotations: []any{}}}},
+	}
+}
+
+func newPendingMessage(text string) models.ChatMessage {
+	return models.ChatMessage{ID: "msg_" + uuid.New().String(), Role: "user", Content: text, Timestamp: time.Now()}
+}
+
+// joinMessages makes one chat turn of the user messages a run answers
+func joinMessages(messages []models.ChatMessage) string {
+	texts := make([]string, len(messages))
+	for i, message := range messages {
+		texts[i] = message.Content
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+// splitMessages sorts a request's messages into the system prompt, the
+// history up to the last non-user message, and the user messages after it
+// that the next turn answers
+func splitMessages(inputs []models.MessageInput) (system string, history []models.ChatMessage, pending []models.ChatMessage, err error) {
+	var prompts []string
+	var conversation []models.ChatMessage
+	for _, input := range inputs {
+		text, err := messageText(input.Content)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		switch input.Role {
+		case "system", "developer":
+			prompts = append(prompts, text)
+		case "user", "assistant":
+			conversation = append(conversation, models.ChatMessage{Role: input.Role, Content: text})
+		default:
+			return "", nil, nil, errors.New("message role must be \"user\", \"assistant\", \"system\" or \"developer\"")
+		}
+	}
+
+	split := len(conversation)
+	for split > 0 && conversation[split-1].Role == "user" {
+		split--
+	}
+	for _, message := range conversation[split:] {
+		pending = append(pending, newPendingMessage(message.Content))
+	}
+	return strings.Join(prompts, "\n\n"), conversation[:split], pending, nil
+}
+
+// responseInput reads the input of a response: a string, or a list of messages
+func responseInput(raw json.RawMessage) ([]models.MessageInput, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		content, _ := json.Marshal(text)
+		return []models.MessageInput{{Role: "user", Content: content}}, nil
+	}
+	var inputs []models.MessageInput
+	if err := json.Unmarshal(raw, &inputs); err != nil {
+		return nil, errors.New("input must be a string or a list of messages")
+	}
+	return inputs, nil
+}
+
+// messageText reads a message's content: a string, or a list of text parts
+func messageText(raw json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(raw, &parts); err != nil {
+		return "", errors.New("message content must be a string or a list of text parts")
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		switch part.Type {
+		case "text", "input_text", "output_text":
+			texts = append(texts, part.Text)
+		default:
+			return "", errors.New("only text content is supported, got " + part.Type)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// apiError answers with an error in the shape OpenAI clients expect
+func apiError(c *gin.Context, status int, message string) {
+	c.JSON(status, gin.H{"error": gin.H{"message": message, "type": http.StatusText(status)}})
+}
+
+// errorMessage returns the "error" of an error response body
+func errorMessage(body []byte) string {
+	var response struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &response)
+	return response.Error
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/assistants"
+	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/mocks"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+// setupAssistants serves the Responses API like main does, behind a stub
+// auth middleware (the X-User header) and a daily token quota
+func setupAssistants(t *testing.T, tokensPerDay int) (*gin.Engine, *miniredis.Miniredis, *mocks.MockSLMEngine) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	mockLLM := new(mocks.MockLLMClient)
+	mockSLM := new(mocks.MockSLMEngine)
+	mockCache := new(mocks.MockCache)
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	sessions := chat.NewSessionStore(client)
+	chatHandler := NewChatHandler(router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65}), mockSLM, mockLLM, mockCache, sessions)
+	handler := NewAssistantsHandler(chatHandler, sessions, assistants.NewStore(client, time.Hour))
+
+	limiter := middleware.NewRateLimiter(client, &config.RateLimitConfig{TokensPerDay: tokensPerDay})
+	limiter.SetClock(clock.NewFake(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		middleware.SetUserID(c, c.GetHeader("X-User"))
+		c.Next()
+	})
+	r.Use(limiter.Middleware())
+	r.POST("/responses", handler.CreateResponse)
+
+	return r, mr, mockSLM
+}
+
+func createResponse(r *gin.Engine, user string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/responses", bytes.NewBufferString(`{"input": "What is 2+2?"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAssistantsHandler_ResponseChargesCallerQuota(t *testing.T) {
+	r, mr, mockSLM := setupAssistants(t, 1000)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
+
+	w := createResponse(r, "alice")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	used, err := mr.Get("ratelimit:tokens:alice:2026-01-15")
+	require.NoError(t, err)
+	tokens, _ := strconv.Atoi(used)
+	assert.Positive(t, tokens)
+
+	// The turn ran as the caller, whose session it went in
+	assert.False(t, mr.Exists("ratelimit:tokens:anonymous:2026-01-15"))
+}
+
+func TestAssistantsHandler_QuotaExceeded(t *testing.T) {
+	r, mr, mockSLM := setupAssistants(t, 1000)
+	require.NoError(t, mr.Set("ratelimit:tokens:alice:2026-01-15", "1000"))
+
+	w := createResponse(r, "alice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	mockSLM.AssertNotCalled(t, "Infer", mock.Anything, mock.Anything)
+}
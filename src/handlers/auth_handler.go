@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/auth"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+const (
+	oauthStateCookieName = "hybridlm_oauth_state"
+	oauthModeCookieName  = "hybridlm_oauth_mode"
+
+	// tokenLoginMode makes the OAuth callback answer with a token pair instead
+	// of setting the session cookie
+	tokenLoginMode = "token"
+)
+
+type AuthHandler struct {
+	google   *auth.GoogleOAuth
+	users    *auth.UserStore
+	sessions *auth.SessionManager
+	tokens   *auth.TokenIssuer
+	config   *config.AuthConfig
+	outbox   *outbox.Outbox // Receives login and logout audit events, optional
+}
+
+// tokenLoginResponse is the callback's answer to a token login
+type tokenLoginResponse struct {
+	models.TokenPair
+	User *models.User `json:"user"`
+}
+
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func NewAuthHandler(
+	google *auth.GoogleOAuth,
+	users *auth.UserStore,
+	sessions *auth.SessionManager,
+	cfg *config.AuthConfig,
+) *AuthHandler {
+	return &AuthHandler{
+		google:   google,
+		users:    users,
+		sessions: sessions,
+		config:   cfg,
+	}
+}
+
+// SetTokenIssuer enables JWT access and refresh tokens for mobile and CLI clients
+func (h *AuthHandler) SetTokenIssuer(tokens *auth.TokenIssuer) {
+	h.tokens = tokens
+}
+
+// SetOutbox records logins and logouts as audit events
+func (h *AuthHandler) SetOutbox(o *outbox.Outbox) {
+	h.outbox = o
+}
+
+// Login redirects the browser to Google's consent page. With ?mode=token the
+// callback returns a token pair instead of setting the session cookie.
+func (h *AuthHandler) Login(c *gin.Context) {
+	mode := c.Query("mode")
+	if mode == tokenLoginMode && h.tokens == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token login is not enabled"})
+		return
+	}
+
+	state, err := auth.NewState()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oauthStateCookieName, state, 600, "/", "", h.config.CookieSecure, true)
+	c.SetCookie(oauthModeCookieName, mode, 600, "/", "", h.config.CookieSecure, true)
+	c.Redirect(http.StatusTemporaryRedirect, h.google.AuthCodeURL(state))
+}
+
+// Callback completes the OAuth flow, creates the user and either a login
+// session cookie or, for token logins, an access and refresh token
+func (h *AuthHandler) Callback(c *gin.Context) {
+	state, err := c.Cookie(oauthStateCookieName)
+	if err != nil || state == "" || state != c.Query("state") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OAuth state"})
+		return
+	}
+	mode, _ := c.Cookie(oauthModeCookieName)
+	c.SetCookie(oauthStateCookieName, "", -1, "/", "", h.config.CookieSecure, true)
+	c.SetCookie(oauthModeCookieName, "", -1, "/", "", h.config.CookieSecure, true)
+
+	ctx := c.Request.Context()
+
+	info, err := h.google.Exchange(ctx, c.Query("code"))
+	if err != nil {
+		log.Printf("Google OAuth exchange failed: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Google authentication failed"})
+		return
+	}
+
+	user, err := h.users.UpsertGoogleUser(ctx, info)
+	if errors.Is(err, auth.ErrUserDeactivated) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+
+	if mode == tokenLoginMode && h.tokens != nil {
+		pair, err := h.tokens.Issue(ctx, user.ID)
+		if err != nil {
+			log.Printf("Failed to issue tokens: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to issue tokens"})
+			return
+		}
+
+		recordAudit(c, h.outbox, "login", user.ID, gin.H{"method": "token"})
+		c.JSON(http.StatusOK, tokenLoginResponse{TokenPair: *pair, User: user})
+		return
+	}
+
+	token, err := h.sessions.CreateSession(ctx, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	recordAudit(c, h.outbox, "login", user.ID, gin.H{"method": "session"})
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(middleware.SessionCookieName, token, int(h.sessions.TTL().Seconds()), "/", "", h.config.CookieSecure, true)
+	c.Redirect(http.StatusTemporaryRedirect, h.config.FrontendURL)
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var req refreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := h.tokens.Refresh(c.Request.Context(), req.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidToken) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to refresh tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pair)
+}
+
+// Logout invalidates the login session and clears the cookie. Token clients
+// send their refresh token in the body to revoke it.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	if token, err := c.Cookie(middleware.SessionCookieName); err == nil && token != "" {
+		if h.outbox != nil {
+			if userID, err := h.sessions.GetUserID(c.Request.Context(), token); err == nil {
+				recordAudit(c, h.outbox, "logout", userID, nil)
+			}
+		}
+		if err := h.sessions.DeleteSession(c.Request.Context(), token); err != nil {
+			log.Printf("Failed to delete login session: %v", err)
+		}
+	}
+
+	var req refreshRequest
+	if h.tokens != nil && c.ShouldBindJSON(&req) == nil {
+		if err := h.tokens.RevokeRefreshToken(c.Request.Context(), req.RefreshToken); err != nil {
+			log.Printf("Failed to revoke refresh token: %v", err)
+		}
+	}
+
+	c.SetCookie(middleware.SessionCookieName, "", -1, "/", "", h.config.CookieSecure, true)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// Me returns the authenticated user's profile
+func (h *AuthHandler) Me(c *gin.Context) {
+	user, err := h.users.GetUser(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
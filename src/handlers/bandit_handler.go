@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// modelFeedbackKey is the context key of the ID to rate the bandit's pick by
+const modelFeedbackKey = "model_feedback"
+
+// recordBanditAnswer keeps an answer from the model the bandit picked for
+// rating, and its ID for the response's metadata. Streamed answers count too:
+// their result comes from the engine's models.SLMResultRecorder.
+func recordBanditAnswer(c *gin.Context, b *bandit.Bandit, slmResult *models.SLMResult) {
+	if b == nil || slmResult == nil || slmResult.Strategy != inference.StrategyBandit {
+		return
+	}
+	answerID, err := b.RecordAnswer(c.Request.Context(), middleware.GetUserID(c), slmResult.SelectedModel)
+	if err != nil {
+		log.Printf("Failed to record SLM answer for feedback: %v", err)
+		return
+	}
+	c.Set(modelFeedbackKey, &models.ModelFeedback{ID: answerID, Model: slmResult.SelectedModel})
+}
+
+// BanditHandler takes ratings of the answers of the models the SLM bandit
+// picks and reports how it shares traffic
+type BanditHandler struct {
+	bandit *bandit.Bandit
+}
+
+func NewBanditHandler(b *bandit.Bandit) *BanditHandler {
+	return &BanditHandler{bandit: b}
+}
+
+// Feedback rates an answer the user was served, given its
+// metadata.model_feedback.id
+func (h *BanditHandler) Feedback(c *gin.Context) {
+	var req models.ModelFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	model, err := h.bandit.Rate(c.Request.Context(), middleware.GetUserID(c), req.AnswerID, req.Rating == "good")
+	if errors.Is(err, bandit.ErrAnswerNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Answer not found or already rated"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record model feedback: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record feedback"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feedback recorded", "model": model})
+}
+
+// Stats lists every SLM model's share of traffic, score and observations
+func (h *BanditHandler) Stats(c *gin.Context) {
+	arms, err := h.bandit.Stats(c.Request.Context())
+	if err != nil {
+		log.Printf("Failed to get SLM bandit stats: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get bandit stats"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"models": arms})
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// noCacheHeader asks for a request's answer to be generated by the models and
+// not cached, for debugging stale answers
+const noCacheHeader = "X-HybridLM-No-Cache"
+
+// bypassCache reports whether the request asked to skip the caches. Only
+// admins signed in, and API keys with the cache:bypass scope, may; anyone
+// else is answered 403 and ok is false.
+func bypassCache(c *gin.Context) (bypass bool, ok bool) {
+	value := c.GetHeader(noCacheHeader)
+	if value == "" {
+		return false, true
+	}
+	if bypass, err := strconv.ParseBool(value); err != nil || !bypass {
+		return false, true
+	}
+
+	allowed := middleware.GetRole(c) == models.RoleAdmin
+	if key := middleware.GetAPIKey(c); key != nil {
+		allowed = key.HasScope(models.ScopeCacheBypass)
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": noCacheHeader + " needs an admin or an API key with the " + models.ScopeCacheBypass + " scope"})
+		return false, false
+	}
+	return true, true
+}
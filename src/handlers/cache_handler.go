@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+type namedCache struct {
+	name  string
+	store models.ManagedCacheStore
+}
+
+// CacheHandler is the admin API for the response caches: flushing them,
+// invalidating single entries and reporting their size and hit ratio
+type CacheHandler struct {
+	caches []namedCache
+	tuner  *cache.ThresholdTuner // Tunes the semantic cache's threshold from feedback, optional
+}
+
+func NewCacheHandler() *CacheHandler {
+	return &CacheHandler{}
+}
+
+// AddCache registers a cache under the name used in responses
+func (h *CacheHandler) AddCache(name string, store models.ManagedCacheStore) {
+	h.caches = append(h.caches, namedCache{name: name, store: store})
+}
+
+// SetThresholdTuner reports the tuned similarity threshold in stats and
+// takes ratings of semantic cache hits
+func (h *CacheHandler) SetThresholdTuner(tuner *cache.ThresholdTuner) {
+	h.tuner = tuner
+}
+
+// Flush deletes every entry from every cache. A cache that fails is reported
+// in the response without stopping the others; the request fails only if
+// none could be flushed.
+func (h *CacheHandler) Flush(c *gin.Context) {
+	purged := make(map[string]int64)
+	failed := make(map[string]string)
+	for _, cache := range h.caches {
+		n, err := cache.store.Purge(c.Request.Context())
+		if err != nil {
+			log.Printf("Failed to flush %s cache: %v", cache.name, err)
+			failed[cache.name] = err.Error()
+			continue
+		}
+		purged[cache.name] = n
+	}
+
+	if len(failed) > 0 && len(purged) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to flush cache", "errors": failed})
+		return
+	}
+
+	log.Printf("🧹 Cache flushed (%v)", purged)
+	response := gin.H{"purged": purged}
+	if len(failed) > 0 {
+		response["errors"] = failed
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteKey invalidates one entry (inference:<sha256>) in every cache
+func (h *CacheHandler) DeleteKey(c *gin.Context) {
+	key := c.Param("key")
+	for _, cache := range h.caches {
+		if err := cache.store.Delete(c.Request.Context(), key); err != nil {
+			log.Printf("Failed to delete %s from %s cache: %v", key, cache.name, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cache entry"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cache entry deleted", "key": key})
+}
+
+// Stats returns the entry count, memory use and hit ratio of every cache
+func (h *CacheHandler) Stats(c *gin.Context) {
+	stats := make(map[string]*models.CacheStats)
+	failed := make(map[string]string)
+	for _, cache := range h.caches {
+		s, err := cache.store.Stats(c.Request.Context())
+		if err != nil {
+			failed[cache.name] = err.Error()
+			continue
+		}
+		stats[cache.name] = s
+	}
+
+	if len(failed) > 0 && len(stats) == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get cache stats", "errors": failed})
+		return
+	}
+
+	response := gin.H{"caches": stats}
+	if h.tuner != nil {
+		threshold, err := h.tuner.Stats(c.Request.Context())
+		if err != nil {
+			failed["similarity_threshold"] = err.Error()
+		} else {
+			response["similarity_threshold"] = threshold
+		}
+	}
+	if len(failed) > 0 {
+		response["errors"] = failed
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Feedback rates the answer a semantic cache hit reused, by the hit ID in
+// its metadata, to tune the similarity threshold
+func (h *CacheHandler) Feedback(c *gin.Context) {
+	var req models.CacheFeedbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	threshold, err := h.tuner.Rate(c.Request.Context(), middleware.GetUserID(c), req.HitID, req.Rating == "good")
+	if errors.Is(err, cache.ErrHitNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Semantic cache hit not found or already rated"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to record cache feedback: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record feedback"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Feedback recorded", "similarity_threshold": threshold})
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/canary"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// skipCachedKey marks requests, in the gin context, whose answers must come
+// from the models rather than the caches. Only set by private routers.
+const skipCachedKey = "skip_cached_answers"
+
+// NewCanaryRunner runs canary prompts through the inference handler like
+// POST /api/v1/inference on behalf of userID, skipping cached answers so
+// they always reach the models
+func NewCanaryRunner(inference *InferenceHandler, userID string) canary.Runner {
+	runner := gin.New()
+	runner.Use(middleware.InternalCaller())
+	runner.POST("/", func(c *gin.Context) {
+		c.Set(skipCachedKey, true)
+		inference.HandleInference(c)
+	})
+
+	return func(ctx context.Context, req models.InferenceRequest) (*models.InferenceResponse, error) {
+		status, body := serveInternal(ctx, runner, "/", &middleware.InternalCall{Caller: middleware.Caller{UserID: userID}}, req)
+		if status != http.StatusOK {
+			var response struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(body, &response)
+			return nil, fmt.Errorf("status %d: %s", status, response.Error)
+		}
+
+		var response models.InferenceResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return &response, nil
+	}
+}
+
+// CanaryHandler is the admin API for canary prompts
+type CanaryHandler struct {
+	monitor *canary.Monitor
+}
+
+func NewCanaryHandler(monitor *canary.Monitor) *CanaryHandler {
+	return &CanaryHandler{
+		monitor: monitor,
+	}
+}
+
+// ListResults returns the latest result of every canary
+func (h *CanaryHandler) ListResults(c *gin.Context) {
+	results, err := h.monitor.Results(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get canary results"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"canaries": results})
+}
+
+// Check runs the canaries now and returns their results
+func (h *CanaryHandler) Check(c *gin.Context) {
+	results, err := h.monitor.Check(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check canaries"})
+		return
+	}
+	if results == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Canaries are being checked already"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"canaries": results})
+}
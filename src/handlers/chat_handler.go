@@ -2,27 +2,87 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"www.github.com/Wanderer0074348/HybridLM/src/analytics"
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
 	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/degradation"
+	"www.github.com/Wanderer0074348/HybridLM/src/faq"
+	"www.github.com/Wanderer0074348/HybridLM/src/flags"
+	"www.github.com/Wanderer0074348/HybridLM/src/hooks"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/knowledge"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/moderation"
+	"www.github.com/Wanderer0074348/HybridLM/src/privacy"
+	"www.github.com/Wanderer0074348/HybridLM/src/receipts"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
 	"www.github.com/Wanderer0074348/HybridLM/src/router"
+	"www.github.com/Wanderer0074348/HybridLM/src/streaming"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
 	"www.github.com/Wanderer0074348/HybridLM/src/utils"
 )
 
+const (
+	titleTimeout = 30 * time.Second // Bounds generating a session title in the background
+
+	defaultSessionPageSize = 20
+	maxSessionPageSize     = 100
+)
+
 type ChatHandler struct {
-	queryRouter  *router.QueryRouter
-	slmEngine    models.SLMInferencer
-	llmClient    models.LLMInferencer
-	cache        models.CacheStore
-	sessionStore *chat.SessionStore
-	llmModelName string
-	slmModelName string
+	queryRouter   *router.QueryRouter
+	slmEngine     models.SLMInferencer
+	llmClient     models.LLMInferencer
+	cache         models.CacheStore
+	sessionStore  *chat.SessionStore
+	llmModelName  string
+	slmModelName  string
+	modelRegistry *registry.ModelRegistry
+	promptGuard   *inference.PromptGuard
+	continuer     *inference.Continuer
+	streamBuffer  *streaming.Buffer // Set when SSE streams are resumable
+	streamRate    float64           // Ceiling on streamed tokens per second, 0 for none
+	streamBurst   int               // Tokens a paced stream may send ahead of the rate
+	usageStore    *usage.Store      // Per-user usage ledger, optional
+	spendCaps     *usage.SpendCaps  // Monthly spend caps per provider key, optional
+	dedup         *chat.TurnDeduplicator
+	llmBreaker    *inference.CircuitBreaker
+	slmBreaker    *inference.CircuitBreaker
+	failover      bool                    // Fall back to the other tier when the routed one fails
+	coalescer     *inference.Coalescer    // Shares identical concurrent model calls, optional
+	featureFlags  *flags.Store            // Runtime switches, optional
+	hooks         *hooks.Manager          // Extension hooks, optional
+	moderator     *moderation.Moderator   // Screens messages before routing, optional
+	ladder        *degradation.Ladder     // Degrades service under spend, outages or load, optional
+	bandit        *bandit.Bandit          // Picks the SLM model, given ratings of its answers, optional
+	summarizer    *chat.Summarizer        // Compacts long sessions, optional
+	queryStats    *analytics.QueryStats   // Query frequency counters, optional
+	faq           *faq.Store              // Pinned answers, optional
+	knowledge     *knowledge.Base         // Canonical answers, optional
+	expiry        *cache.ExpiryEstimator  // Per-answer cache TTLs, optional
+	systemPrompt  string                  // Default for sessions without their own
+	titler        *chat.Titler            // Names new sessions, optional
+	analyzer      *chat.Analyzer          // Computes session analytics, optional
+	credentials   *credentials.Store      // Keys orgs brought, optional
+	receipts      *receipts.Signer        // Signs answers, optional
+	importLimits  config.ChatImportConfig // Bounds of POST /chat/import
+	consistency   *cache.Consistency      // Per-org cache freshness profiles, optional
+	rateLimiter   *middleware.RateLimiter // Bounds the summaries of imports by the token quota, optional
 }
 
 func NewChatHandler(
@@ -32,14 +92,19 @@ func NewChatHandler(
 	cache models.CacheStore,
 	sessionStore *chat.SessionStore,
 ) *ChatHandler {
+	modelRegistry := registry.NewModelRegistry(nil)
+
 	return &ChatHandler{
-		queryRouter:  queryRouter,
-		slmEngine:    slmEngine,
-		llmClient:    llmClient,
-		cache:        cache,
-		sessionStore: sessionStore,
-		llmModelName: "gpt-3.5-turbo",
-		slmModelName: "llama-3.1-8b-instant",
+		queryRouter:   queryRouter,
+		slmEngine:     slmEngine,
+		llmClient:     llmClient,
+		cache:         cache,
+		sessionStore:  sessionStore,
+		llmModelName:  "gpt-3.5-turbo",
+		slmModelName:  "llama-3.1-8b-instant",
+		modelRegistry: modelRegistry,
+		promptGuard:   inference.NewPromptGuard(modelRegistry),
+		continuer:     inference.NewContinuer(config.ContinuationConfig{}),
 	}
 }
 
@@ -48,6 +113,154 @@ func (h *ChatHandler) SetModelNames(llmModel, slmModel string) {
 	h.slmModelName = slmModel
 }
 
+// SetModelRegistry replaces the built-in model registry used for prompt sizing and validation
+func (h *ChatHandler) SetModelRegistry(modelRegistry *registry.ModelRegistry) {
+	h.modelRegistry = modelRegistry
+	h.promptGuard = inference.NewPromptGuard(modelRegistry)
+}
+
+// SetStreamBuffer makes SSE responses resumable: events are buffered in Redis
+// and can be replayed with Last-Event-ID
+func (h *ChatHandler) SetStreamBuffer(buffer *streaming.Buffer) {
+	h.streamBuffer = buffer
+}
+
+// SetStreamPacing sends streamed tokens at most tokensPerSecond, after a
+// first burst of burst tokens
+func (h *ChatHandler) SetStreamPacing(tokensPerSecond float64, burst int) {
+	h.streamRate = tokensPerSecond
+	h.streamBurst = burst
+}
+
+// SetUsageStore records every request's cost metrics in the user's usage ledger
+func (h *ChatHandler) SetUsageStore(store *usage.Store) {
+	h.usageStore = store
+}
+
+// SetSpendCaps adds what every request cost to the spend of the provider key
+// it used
+func (h *ChatHandler) SetSpendCaps(caps *usage.SpendCaps) {
+	h.spendCaps = caps
+}
+
+// SetTurnDeduplicator collapses identical turns sent to a session in quick succession
+func (h *ChatHandler) SetTurnDeduplicator(dedup *chat.TurnDeduplicator) {
+	h.dedup = dedup
+}
+
+// SetFailover enables the per-tier circuit breakers and LLM<->SLM failover
+func (h *ChatHandler) SetFailover(llmBreaker, slmBreaker *inference.CircuitBreaker) {
+	h.llmBreaker = llmBreaker
+	h.slmBreaker = slmBreaker
+	h.failover = true
+}
+
+// SetCoalescer makes identical concurrent requests share one model call
+func (h *ChatHandler) SetCoalescer(coalescer *inference.Coalescer) {
+	h.coalescer = coalescer
+}
+
+// SetFeatureFlags lets runtime flags switch off the LLM tier
+func (h *ChatHandler) SetFeatureFlags(store *flags.Store) {
+	h.featureFlags = store
+}
+
+// SetHooks runs custom extension hooks at the pre-route, post-route,
+// pre-cache and post-response stages
+func (h *ChatHandler) SetHooks(manager *hooks.Manager) {
+	h.hooks = manager
+}
+
+// SetDegradation steps service down the degradation ladder as spend,
+// outages or load demand
+func (h *ChatHandler) SetDegradation(ladder *degradation.Ladder) {
+	h.ladder = ladder
+}
+
+// SetBandit gives answers from the model the SLM bandit picked an ID to rate
+// them by
+func (h *ChatHandler) SetBandit(b *bandit.Bandit) {
+	h.bandit = b
+}
+
+// SetModerator screens messages for disallowed content before routing
+func (h *ChatHandler) SetModerator(moderator *moderation.Moderator) {
+	h.moderator = moderator
+}
+
+// SetSummarizer compacts sessions that grow past the summarization threshold
+// before their history is sent to a model
+func (h *ChatHandler) SetSummarizer(summarizer *chat.Summarizer) {
+	h.summarizer = summarizer
+}
+
+// SetQueryStats counts every chat message for the admin top-queries report
+func (h *ChatHandler) SetQueryStats(stats *analytics.QueryStats) {
+	h.queryStats = stats
+}
+
+// SetFAQ serves approved pinned answers without calling a model
+func (h *ChatHandler) SetFAQ(store *faq.Store) {
+	h.faq = store
+}
+
+// SetExpiryEstimator caches each answer for as long as it is expected to stay valid
+func (h *ChatHandler) SetExpiryEstimator(estimator *cache.ExpiryEstimator) {
+	h.expiry = estimator
+}
+
+// SetKnowledgeBase serves canonical answers ahead of pinned answers, caches and models
+func (h *ChatHandler) SetKnowledgeBase(base *knowledge.Base) {
+	h.knowledge = base
+}
+
+// SetSystemPrompt sets the system prompt of sessions created without one
+func (h *ChatHandler) SetSystemPrompt(prompt string) {
+	h.systemPrompt = prompt
+}
+
+// SetTitler names new sessions after their first exchange
+func (h *ChatHandler) SetTitler(titler *chat.Titler) {
+	h.titler = titler
+}
+
+// SetAnalyzer queues sessions for analytics after each turn
+func (h *ChatHandler) SetAnalyzer(analyzer *chat.Analyzer) {
+	h.analyzer = analyzer
+}
+
+// SetContinuation sets the budget for continuing truncated answers on "complete" requests
+func (h *ChatHandler) SetContinuation(cfg config.ContinuationConfig) {
+	h.continuer = inference.NewContinuer(cfg)
+}
+
+// SetCredentials makes model calls use the provider keys of the caller's org
+func (h *ChatHandler) SetCredentials(store *credentials.Store) {
+	h.credentials = store
+}
+
+// SetReceipts attaches a signed receipt to every answer
+func (h *ChatHandler) SetReceipts(signer *receipts.Signer) {
+	h.receipts = signer
+}
+
+// SetImportLimits bounds the exports POST /chat/import accepts
+func (h *ChatHandler) SetImportLimits(cfg config.ChatImportConfig) {
+	h.importLimits = cfg
+}
+
+// SetRateLimiter stops summarizing the conversations of an import once the
+// user's daily token quota is used up
+func (h *ChatHandler) SetRateLimiter(limiter *middleware.RateLimiter) {
+	h.rateLimiter = limiter
+}
+
+// SetConsistency applies each org's consistency profile to cached answers.
+// Chat turns only reuse fresh answers: a turn can't be refreshed later.
+func (h *ChatHandler) SetConsistency(consistency *cache.Consistency) {
+	h.consistency = consistency
+}
+
 // HandleChat handles conversational chat requests with session management
 func (h *ChatHandler) HandleChat(c *gin.Context) {
 	startTime := time.Now()
@@ -57,19 +270,39 @@ func (h *ChatHandler) HandleChat(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !useOrgKeys(c, h.credentials) {
+		return
+	}
 
-	ctx := context.Background()
+	ctx := c.Request.Context()
+	noCache, ok := bypassCache(c)
+	if !ok {
+		return
+	}
+
+	var stream *sseStream
+	if req.Stream {
+		stream = newResumableSSEStream(c, h.streamBuffer, middleware.GetUserID(c))
+		stream.pacer = streamPacer(c, h.streamRate, h.streamBurst)
+		defer stream.drain()
+	}
 
 	// Get or create session
 	var session *models.ChatSession
 	var err error
 
+	userID := middleware.GetUserID(c)
+
 	if req.SessionID != "" {
 		// Try to retrieve existing session
-		session, err = h.sessionStore.GetSession(ctx, req.SessionID)
+		session, err = h.sessionStore.GetSessionForUser(ctx, req.SessionID, userID)
+		if errors.Is(err, chat.ErrSessionForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+			return
+		}
 		if err != nil {
 			log.Printf("Failed to get session %s: %v, creating new session", req.SessionID, err)
-			session, err = h.sessionStore.CreateSession(ctx)
+			session, err = h.sessionStore.CreateSession(ctx, userID)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 				return
@@ -77,7 +310,7 @@ func (h *ChatHandler) HandleChat(c *gin.Context) {
 		}
 	} else {
 		// Create new session
-		session, err = h.sessionStore.CreateSession(ctx)
+		session, err = h.sessionStore.CreateSession(ctx, userID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
 			return
@@ -85,121 +318,428 @@ func (h *ChatHandler) HandleChat(c *gin.Context) {
 		log.Printf("Created new chat session: %s", session.SessionID)
 	}
 
-	// Build conversation context from session history
-	conversationContext := h.sessionStore.BuildConversationContext(session)
+	// Collapse double-submits of the same message into a single generation
+	turnClaimed := false
+	if h.dedup != nil && session.SessionID == req.SessionID {
+		claimed, err := h.dedup.Claim(ctx, session.SessionID, req.Message)
+		if err != nil {
+			log.Printf("Failed to check for duplicate chat turn: %v", err)
+		} else if !claimed {
+			h.writeDuplicateTurn(ctx, c, stream, session.SessionID, req.Message)
+			return
+		} else {
+			turnClaimed = true
+			defer func() {
+				if turnClaimed {
+					_ = h.dedup.Release(ctx, session.SessionID, req.Message)
+				}
+			}()
+		}
+	}
+
+	h.respond(c, stream, session, &req, &turnClaimed, turnOptions{noCache: noCache}, startTime)
+}
+
+// turnOptions changes how respond answers a turn
+type turnOptions struct {
+	fresh    bool // Skip canonical, pinned and cached answers
+	noCache  bool // Neither read nor write cached answers
+	forceLLM bool // Route this turn to the LLM tier
+	retake   *retake
+}
+
+// retake is a turn answered in place of an earlier message, which the answer
+// replaces along with everything after it
+type retake struct {
+	index     int
+	messageID string
+}
+
+// respond answers req.Message in the session, adds the exchange to its
+// history and writes the response. turnClaimed is cleared once the response
+// is shared with duplicates of the turn.
+func (h *ChatHandler) respond(c *gin.Context, stream *sseStream, session *models.ChatSession, req *models.ChatRequest, turnClaimed *bool, opts turnOptions, startTime time.Time) {
+	ctx := c.Request.Context()
+	userID := middleware.GetUserID(c)
+
+	release := h.ladder.Enter()
+	defer release()
+	service := degrade(c, h.ladder)
+	if service.Level == degradation.LevelMaintenance {
+		// Not added to the history, so the message can be sent again later
+		answer := maintenanceResponse(h.ladder, startTime)
+		writeResult(c, stream, answer.Response, &models.ChatResponse{
+			SessionID:     session.SessionID,
+			Response:      answer.Response,
+			ModelUsed:     answer.ModelUsed,
+			Tier:          answer.Tier,
+			RoutingReason: answer.RoutingReason,
+			Latency:       answer.Latency,
+			Timestamp:     answer.Timestamp,
+			MessageCount:  session.MessageCount,
+			CostMetrics:   answer.CostMetrics,
+		})
+		return
+	}
+
+	// A routing preference sticks to the session for later messages
+	if req.ModelPreference != "" || req.Model != "" {
+		session.ModelPreference = req.ModelPreference
+		if session.ModelPreference == "" {
+			session.ModelPreference = "auto"
+		}
+		session.PreferredModel = req.Model
+		if err := h.sessionStore.SaveSession(ctx, session); err != nil {
+			log.Printf("Failed to save model preference for session %s: %v", session.SessionID, err)
+		}
+	}
 
-	// Create inference request with conversation history
+	// Summarize older messages once the history gets too long for the context window
+	var summarization *models.ModelUsage
+	if h.summarizer != nil && h.summarizer.ShouldSummarize(session) && !h.featureFlags.EnabledFor(ctx, flags.DisableLLM, userID) &&
+		!degradation.Reaches(service.Level, degradation.LevelSLMOnly) {
+		session, summarization = h.summarizeSession(ctx, session, opts.retake == nil)
+	}
+
+	// Create inference request with the conversation history as role-tagged messages
 	inferenceReq := &models.InferenceRequest{
-		Query:       req.Message,
-		Context:     conversationContext,
-		MaxTokens:   req.MaxTokens,
-		Temperature: req.Temperature,
+		Query:           req.Message,
+		Messages:        h.conversationMessages(session),
+		MaxTokens:       req.MaxTokens,
+		Temperature:     req.Temperature,
+		Complete:        req.Complete,
+		UserID:          userID,
+		ModelPreference: session.ModelPreference,
+		Model:           session.PreferredModel,
+	}
+	if opts.forceLLM {
+		inferenceReq.ModelPreference = "llm"
+		inferenceReq.Model = ""
+	}
+
+	hookPayload := &hooks.Payload{UserID: userID, SessionID: session.SessionID, Request: inferenceReq}
+	if !runHooks(c, stream, h.hooks, hooks.PreRoute, hookPayload) {
+		return
+	}
+	if !moderate(c, stream, h.moderator, inferenceReq.Query) {
+		return
+	}
+	recordQuery(c, h.queryStats, inferenceReq.Query)
+
+	// Knowledge base answers take priority over pinned ones
+	var static *models.InferenceResponse
+	if !opts.fresh {
+		static = lookupKnowledgeAnswer(c, h.knowledge, inferenceReq, startTime)
+	}
+	if static == nil && !opts.fresh {
+		static = lookupPinnedAnswer(c, h.faq, inferenceReq, startTime)
+	}
+	if static != nil {
+		costMetrics := addSummarizationCost(static.CostMetrics, summarization)
+		inputTokens := utils.CountTokens(inferenceReq.PromptText(), "")
+		h.addTurn(ctx, session, opts, chat.Turn{
+			Question: req.Message, QuestionTokens: inputTokens,
+			Answer: static.Response, AnswerTokens: static.CostMetrics.OutputTokens,
+			Model: static.ModelUsed, Cost: totalCost(costMetrics),
+		})
+		h.titleSession(session, req.Message, static.Response)
+		h.analyzeSession(ctx, session.SessionID)
+
+		chatResponse := &models.ChatResponse{
+			SessionID:     session.SessionID,
+			Response:      static.Response,
+			ModelUsed:     static.ModelUsed,
+			Tier:          static.Tier,
+			RoutingReason: static.RoutingReason,
+			Latency:       static.Latency,
+			Timestamp:     static.Timestamp,
+			MessageCount:  session.MessageCount + 2,
+			CostMetrics:   costMetrics,
+		}
+		hookPayload.ChatResponse = chatResponse
+		if !runHooks(c, stream, h.hooks, hooks.PostResponse, hookPayload) {
+			return
+		}
+		if *turnClaimed {
+			*turnClaimed = !h.completeTurn(ctx, req.Message, chatResponse)
+		}
+
+		recordUsage(c, h.usageStore, chatResponse.CostMetrics, true)
+		h.receipts.ChatReceipt(middleware.GetUserID(c), req.Message, chatResponse)
+		writeResult(c, stream, static.Response, chatResponse)
+		return
 	}
 
 	// Check cache (with conversation context included in cache key)
 	cacheKey := h.queryRouter.GenerateCacheKey(inferenceReq)
-	cachedResponse, err := h.cache.Get(ctx, cacheKey)
-	if err == nil && cachedResponse != nil {
+	promptVersion := inference.PromptVersion(inferenceReq)
+	var cachedResponse *models.InferenceResponse
+	var err error
+	if !opts.fresh && !opts.noCache {
+		cachedResponse, err = h.cache.Get(ctx, cacheKey)
+	}
+	if err == nil && cachedResponse != nil && cachedResponse.PromptVersion == promptVersion &&
+		h.consistency.Profile(ctx, userID).Freshness(cachedResponse, time.Now()) == cache.Fresh {
 		// Cache hit - return cached response
 		latency := time.Since(startTime)
 
 		// Still add to session history
-		inputTokens := utils.EstimateTokenCount(req.Message + conversationContext)
-		outputTokens := utils.EstimateTokenCount(cachedResponse.Response)
-		h.sessionStore.AddMessage(ctx, session.SessionID, "user", req.Message, inputTokens)
-		h.sessionStore.AddMessage(ctx, session.SessionID, "assistant", cachedResponse.Response, outputTokens)
-
-		c.JSON(http.StatusOK, models.ChatResponse{
-			SessionID:      session.SessionID,
-			Response:       cachedResponse.Response,
-			ModelUsed:      cachedResponse.ModelUsed,
-			RoutingReason:  "Cache hit (exact match)",
-			Latency:        latency,
-			CacheHit:       true,
-			Timestamp:      time.Now(),
-			MessageCount:   session.MessageCount + 1,
-			CostMetrics:    cachedResponse.CostMetrics,
+		costMetrics := addSummarizationCost(cachedResponse.CostMetrics, summarization)
+		inputTokens := utils.CountTokens(inferenceReq.PromptText(), cachedResponse.ModelUsed)
+		outputTokens := utils.CountTokens(cachedResponse.Response, cachedResponse.ModelUsed)
+		h.addTurn(ctx, session, opts, chat.Turn{
+			Question: req.Message, QuestionTokens: inputTokens,
+			Answer: cachedResponse.Response, AnswerTokens: outputTokens,
+			Model: cachedResponse.ModelUsed, Cost: totalCost(costMetrics),
 		})
+		h.titleSession(session, req.Message, cachedResponse.Response)
+		h.analyzeSession(ctx, session.SessionID)
+
+		chatResponse := &models.ChatResponse{
+			SessionID:     session.SessionID,
+			Response:      cachedResponse.Response,
+			ModelUsed:     cachedResponse.ModelUsed,
+			Tier:          cachedResponse.Tier,
+			RoutingReason: "Cache hit (exact match)",
+			Latency:       latency,
+			CacheHit:      true,
+			Timestamp:     time.Now(),
+			MessageCount:  session.MessageCount + 1,
+			CostMetrics:   costMetrics,
+		}
+		hookPayload.ChatResponse = chatResponse
+		if !runHooks(c, stream, h.hooks, hooks.PostResponse, hookPayload) {
+			return
+		}
+		if *turnClaimed {
+			*turnClaimed = !h.completeTurn(ctx, req.Message, chatResponse)
+		}
+
+		recordUsage(c, h.usageStore, chatResponse.CostMetrics, true)
+		h.receipts.ChatReceipt(middleware.GetUserID(c), req.Message, chatResponse)
+		writeResult(c, stream, cachedResponse.Response, chatResponse)
+		return
+	}
+
+	if !rejectUncached(c, stream, service) {
 		return
 	}
 
 	// Route the query
 	decision, err := h.queryRouter.Route(ctx, inferenceReq)
+	if errors.Is(err, router.ErrNoCompliantModel) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, router.ErrNoCapableModel) || errors.Is(err, router.ErrUnknownModel) || errors.Is(err, router.ErrCostBudgetExceeded) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, usage.ErrSpendCapReached) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Routing failed: %v", err)})
 		return
 	}
 
+	hookPayload.Decision = decision
+	if !runHooks(c, stream, h.hooks, hooks.PostRoute, hookPayload) {
+		return
+	}
+	middleware.SetRoutingDecision(c, decision)
+
+	llmDisabled := h.llmClient == nil || h.featureFlags.EnabledFor(ctx, flags.DisableLLM, userID) ||
+		degradation.Reaches(service.Level, degradation.LevelSLMOnly)
+	if llmDisabled {
+		if err := avoidDisabledLLM(decision); err != nil {
+			writeError(c, stream, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	var response string
 	var modelUsed string
 	var costMetrics *models.CostMetrics
+	var promptTrim *models.PromptTrimInfo
+	var slmResult *models.SLMResult
+	var continuation *models.ContinuationInfo
 
-	if decision.UseLLM {
-		// Use LLM (cloud)
-		response, err = h.llmClient.Infer(ctx, inferenceReq)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("LLM inference failed: %v", err)})
-			return
+	var fallback *models.FallbackInfo
+
+	// Abandoning the request aborts the model call, except on resumable streams
+	generationCtx, stopGeneration := stream.generationContext(ctx)
+	defer stopGeneration()
+	inferCtx, providerMetadata := inference.WithProviderMetadata(generationCtx)
+
+	runTier := func(useLLM bool) (string, *models.PromptTrimInfo, error) {
+		inferenceReq.TargetModel = targetModel(decision, useLLM)
+		if useLLM {
+			// Use LLM (cloud)
+			model := modelOrDefault(inferenceReq.TargetModel, h.llmModelName)
+			clampMaxTokens(inferenceReq, h.modelRegistry, model)
+			infer := inferFunc(h.coalescer.WrapLLM(tierName(true), h.llmClient).Infer)
+			if stream != nil {
+				infer = stream.infer(h.llmClient, infer)
+			}
+			infer = observeLatency(h.queryRouter, infer)
+			infer = h.llmBreaker.Wrap(infer)
+			infer = h.continuer.Wrap(infer, func() string { return model }, &continuation)
+			return h.promptGuard.Run(inferCtx, inferenceReq, model, infer)
+		}
+
+		// Use SLM (edge)
+		model := modelOrDefault(inferenceReq.TargetModel, h.slmModelName)
+		clampMaxTokens(inferenceReq, h.modelRegistry, model)
+		infer := slmInfer(h.coalescer.WrapSLM(tierName(false), h.slmEngine), &slmResult)
+		if stream != nil {
+			infer = stream.inferSLM(h.slmEngine, infer, &slmResult)
+		}
+		infer = h.slmBreaker.Wrap(infer)
+		infer = h.continuer.Wrap(infer, func() string { return selectedSLM(slmResult, model) }, &continuation)
+		return h.promptGuard.Run(inferCtx, inferenceReq, model, infer)
+	}
+
+	useLLM := decision.UseLLM
+	response, promptTrim, err = runTier(useLLM)
+
+	// Fail over to the other tier when the routed provider is down
+	if h.failover && canFailOver(decision, stream, err) && (useLLM || !llmDisabled) {
+		fallback = newFallback(useLLM, err)
+		log.Printf("⚠️  %s failed, falling back to %s: %v", fallback.From, fallback.To, err)
+
+		fallbackResponse, fallbackTrim, fallbackErr := runTier(!useLLM)
+		if fallbackErr == nil {
+			useLLM = !useLLM
+			response, promptTrim, err = fallbackResponse, fallbackTrim, nil
+			decision.Reason = fmt.Sprintf("%s (fallback from %s)", decision.Reason, fallback.From)
+		} else {
+			fallback = nil
 		}
-		modelUsed = h.llmModelName
+	}
+
+	var blocked *privacy.BlockedError
+	if errors.As(err, &blocked) {
+		writeError(c, stream, http.StatusBadRequest, gin.H{"error": err.Error(), "pii": blocked.Kinds})
+		return
+	}
+	if errors.Is(err, inference.ErrPromptTooLarge) {
+		writeError(c, stream, http.StatusRequestEntityTooLarge, gin.H{"error": err.Error(), "prompt_trim": promptTrim})
+		return
+	}
+	if stream.cancelled() {
+		writeError(c, stream, http.StatusConflict, gin.H{"error": "Stream cancelled"})
+		return
+	}
+	if err != nil {
+		tier := "SLM"
+		if useLLM {
+			tier = "LLM"
+		}
+		writeError(c, stream, http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("%s inference failed: %v", tier, err)})
+		return
+	}
+
+	if useLLM {
+		modelUsed = modelOrDefault(inferenceReq.TargetModel, h.llmModelName)
 
 		// Calculate cost metrics
 		costMetrics = utils.CalculateCostMetrics(
-			inferenceReq.Query+inferenceReq.Context,
+			inferenceReq.PromptText(),
 			response,
 			"cloud-llm",
 			modelUsed,
 			false,
 			false,
 		)
-	} else {
-		// Use SLM (edge)
-		response, err = h.slmEngine.Infer(ctx, inferenceReq)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("SLM inference failed: %v", err)})
-			return
+		if reported := providerMetadata.For(modelUsed); reported != nil {
+			utils.ApplyReportedUsage(costMetrics, "cloud-llm", reported.InputTokens, reported.OutputTokens)
 		}
-		modelUsed = h.slmModelName
+	} else {
+		modelUsed = selectedSLM(slmResult, modelOrDefault(inferenceReq.TargetModel, h.slmModelName))
 
 		// Calculate cost metrics with savings
 		costMetrics = utils.CalculateCostMetrics(
-			inferenceReq.Query+inferenceReq.Context,
+			inferenceReq.PromptText(),
 			response,
 			"edge-slm",
 			modelUsed,
 			false,
 			false,
 		)
+		if slmResult != nil && len(slmResult.ModelsUsed) > 1 {
+			costMetrics.EnsembleModels = slmResult.ModelsUsed
+		}
+		if slmResult != nil && len(slmResult.Usage) > 1 {
+			utils.ApplyEnsembleBreakdown(costMetrics, slmResult.Usage)
+		} else if reported := providerMetadata.For(modelUsed); reported != nil {
+			utils.ApplyReportedUsage(costMetrics, "edge-slm", reported.InputTokens, reported.OutputTokens)
+		}
 	}
 
+	middleware.AddTokenUsage(c, costMetrics.TotalTokens)
+
 	latency := time.Since(startTime)
 
+	// Keep the answer that was paid for even if the client has gone away
+	ctx = context.WithoutCancel(ctx)
+
 	// Store in cache
 	inferenceResponse := &models.InferenceResponse{
 		Response:      response,
 		ModelUsed:     modelUsed,
+		Tier:          tierName(useLLM),
 		RoutingReason: decision.Reason,
 		Latency:       latency,
 		CacheHit:      false,
 		Timestamp:     time.Now(),
 		CostMetrics:   costMetrics,
 	}
-
-	if err := h.cache.Set(ctx, cacheKey, inferenceResponse); err != nil {
-		log.Printf("Failed to cache response: %v", err)
+	var metadata *models.ResponseMetadata
+	provider := providerMetadata.For(modelUsed)
+	if promptTrim != nil || slmResult != nil || provider != nil || continuation != nil {
+		metadata = &models.ResponseMetadata{
+			PromptTrim:   promptTrim,
+			SLM:          slmResult,
+			Provider:     provider,
+			Continuation: continuation,
+		}
+		if slmResult != nil {
+			metadata.Judge = slmResult.Judge
+		}
+		inferenceResponse.Metadata = metadata
 	}
 
-	// Add messages to session history
-	inputTokens := utils.EstimateTokenCount(req.Message + conversationContext)
-	outputTokens := utils.EstimateTokenCount(response)
+	inferenceResponse.Expiry = h.expiry.Estimate(ctx, inferenceReq.Query, inferenceResponse.Response)
+	inferenceResponse.PromptVersion = promptVersion
+	inferenceResponse.Retention = h.consistency.Retention(inferenceResponse)
 
-	if err := h.sessionStore.AddMessage(ctx, session.SessionID, "user", req.Message, inputTokens); err != nil {
-		log.Printf("Failed to add user message to session: %v", err)
+	hookPayload.Response = inferenceResponse
+	if !runHooks(c, stream, h.hooks, hooks.PreCache, hookPayload) {
+		return
 	}
-	if err := h.sessionStore.AddMessage(ctx, session.SessionID, "assistant", response, outputTokens); err != nil {
-		log.Printf("Failed to add assistant message to session: %v", err)
+	response = inferenceResponse.Response
+
+	if !opts.noCache {
+		if err := h.cache.Set(ctx, cacheKey, inferenceResponse); err != nil {
+			log.Printf("Failed to cache response: %v", err)
+		}
 	}
 
+	// Add messages to session history
+	inputTokens := utils.CountTokens(inferenceReq.PromptText(), modelUsed)
+	outputTokens := utils.CountTokens(response, modelUsed)
+	costMetrics = addSummarizationCost(costMetrics, summarization)
+
+	h.addTurn(ctx, session, opts, chat.Turn{
+		Question: req.Message, QuestionTokens: inputTokens,
+		Answer: response, AnswerTokens: outputTokens,
+		Model: modelUsed, Cost: totalCost(costMetrics),
+	})
+	h.titleSession(session, req.Message, response)
+	h.analyzeSession(ctx, session.SessionID)
+
 	// Update session
 	updatedSession, _ := h.sessionStore.GetSession(ctx, session.SessionID)
 	messageCount := 0
@@ -207,25 +747,182 @@ func (h *ChatHandler) HandleChat(c *gin.Context) {
 		messageCount = updatedSession.MessageCount
 	}
 
-	c.JSON(http.StatusOK, models.ChatResponse{
-		SessionID:      session.SessionID,
-		Response:       response,
-		ModelUsed:      modelUsed,
-		RoutingReason:  decision.Reason,
-		Latency:        latency,
-		CacheHit:       false,
-		Timestamp:      time.Now(),
-		MessageCount:   messageCount,
-		CostMetrics:    costMetrics,
-	})
+	chatResponse := &models.ChatResponse{
+		SessionID:     session.SessionID,
+		Response:      response,
+		ModelUsed:     modelUsed,
+		Tier:          tierName(useLLM),
+		RoutingReason: decision.Reason,
+		Latency:       latency,
+		CacheHit:      false,
+		Timestamp:     time.Now(),
+		MessageCount:  messageCount,
+		CostMetrics:   costMetrics,
+		Metadata:      metadata,
+		Fallback:      fallback,
+	}
+	hookPayload.ChatResponse = chatResponse
+	if !runHooks(c, stream, h.hooks, hooks.PostResponse, hookPayload) {
+		return
+	}
+	response = chatResponse.Response
+	if *turnClaimed {
+		*turnClaimed = !h.completeTurn(ctx, req.Message, chatResponse)
+	}
+
+	recordUsage(c, h.usageStore, chatResponse.CostMetrics, false)
+	recordSpend(c, h.spendCaps, useLLM, chatResponse.CostMetrics)
+	if !useLLM {
+		recordBanditAnswer(c, h.bandit, slmResult)
+	}
+	h.receipts.ChatReceipt(middleware.GetUserID(c), req.Message, chatResponse)
+	writeResult(c, stream, response, chatResponse)
+}
+
+// summarizeSession replaces the older messages of a long session with an LLM
+// summary and, if persist is set, saves the compacted session. On failure the
+// session is used as it is.
+func (h *ChatHandler) summarizeSession(ctx context.Context, session *models.ChatSession, persist bool) (*models.ChatSession, *models.ModelUsage) {
+	summarized, usage, err := h.summarizer.Summarize(ctx, session)
+	if err != nil {
+		log.Printf("Failed to summarize session %s: %v", session.SessionID, err)
+		return session, nil
+	}
+	if !persist {
+		return summarized, usage
+	}
+	if err := h.sessionStore.SaveSession(ctx, summarized); err != nil {
+		log.Printf("Failed to save summarized session %s: %v", session.SessionID, err)
+	}
+	return summarized, usage
+}
+
+// addTurn adds the question and its answer to the session's history. A
+// retaken turn replaces the messages from the one it retakes onwards, now
+// that there is an answer to put in their place.
+func (h *ChatHandler) addTurn(ctx context.Context, session *models.ChatSession, opts turnOptions, turn chat.Turn) {
+	if opts.retake != nil {
+		if _, err := h.sessionStore.RetakeTurn(ctx, session.SessionID, opts.retake.index, opts.retake.messageID, turn); err != nil {
+			log.Printf("Failed to replace turn in session %s: %v", session.SessionID, err)
+		}
+		return
+	}
+
+	if err := h.sessionStore.AddMessage(ctx, session.SessionID, "user", turn.Question, turn.QuestionTokens); err != nil {
+		log.Printf("Failed to add user message to session: %v", err)
+	}
+	if err := h.sessionStore.AddAnswer(ctx, session.SessionID, turn.Answer, turn.AnswerTokens, turn.Model, turn.Cost); err != nil {
+		log.Printf("Failed to add assistant message to session: %v", err)
+	}
+}
+
+// addSummarizationCost returns a copy of metrics that also accounts for the
+// session summary generated for this request
+func addSummarizationCost(metrics *models.CostMetrics, summarization *models.ModelUsage) *models.CostMetrics {
+	if summarization == nil {
+		return metrics
+	}
+
+	withSummary := &models.CostMetrics{}
+	if metrics != nil {
+		*withSummary = *metrics
+	}
+	withSummary.SummarizationCost = summarization.Cost
+	withSummary.TotalCost += summarization.Cost
+	return withSummary
+}
+
+// totalCost is the total of metrics, which may be nil
+func totalCost(metrics *models.CostMetrics) float64 {
+	if metrics == nil {
+		return 0
+	}
+	return metrics.TotalCost
+}
+
+// conversationMessages is the session history sent with the next message,
+// led by the session's system prompt or the server default
+func (h *ChatHandler) conversationMessages(session *models.ChatSession) []models.ChatMessage {
+	messages := h.sessionStore.ConversationMessages(session)
+
+	prompt := session.SystemPrompt
+	if prompt == "" {
+		prompt = h.systemPrompt
+	}
+	if prompt == "" {
+		return messages
+	}
+	return append([]models.ChatMessage{{Role: "system", Content: prompt}}, messages...)
+}
+
+// titleSession names a session after its first exchange. The title is
+// generated in the background so the answer isn't held up.
+func (h *ChatHandler) titleSession(session *models.ChatSession, message string, answer string) {
+	if h.titler == nil || session.Title != "" || session.MessageCount > 0 {
+		return
+	}
+
+	go func() {
+		// The user goes along so the title stays in their data's regions
+		ctx, cancel := context.WithTimeout(correlation.WithUserID(context.Background(), session.UserID), titleTimeout)
+		defer cancel()
+
+		title := h.titler.Title(ctx, message, answer)
+		if title == "" {
+			return
+		}
+		if err := h.sessionStore.SetDefaultTitle(ctx, session.SessionID, title); err != nil {
+			log.Printf("Failed to set title of session %s: %v", session.SessionID, err)
+		}
+	}()
+}
+
+// analyzeSession queues a session for analytics now that it changed
+func (h *ChatHandler) analyzeSession(ctx context.Context, sessionID string) {
+	if err := h.analyzer.MarkDirty(ctx, sessionID); err != nil {
+		log.Printf("Failed to queue analytics of session %s: %v", sessionID, err)
+	}
+}
+
+// completeTurn shares the response with duplicate requests for the same turn.
+// Returns false if it couldn't be stored, in which case the claim is released.
+func (h *ChatHandler) completeTurn(ctx context.Context, message string, response *models.ChatResponse) bool {
+	if err := h.dedup.Complete(ctx, response.SessionID, message, response); err != nil {
+		log.Printf("Failed to complete chat turn: %v", err)
+		return false
+	}
+	return true
+}
+
+// writeDuplicateTurn waits for the original request of a double-submitted turn
+// and returns its response without generating or storing anything again
+func (h *ChatHandler) writeDuplicateTurn(ctx context.Context, c *gin.Context, stream *sseStream, sessionID string, message string) {
+	response, err := h.dedup.Wait(ctx, sessionID, message)
+	if errors.Is(err, chat.ErrTurnFailed) {
+		writeError(c, stream, http.StatusConflict, gin.H{"error": "A duplicate of this message failed, please retry"})
+		return
+	}
+	if err != nil {
+		writeError(c, stream, http.StatusInternalServerError, gin.H{"error": "Failed to get response for duplicate message"})
+		return
+	}
+
+	response.Deduplicated = true
+	response.CostMetrics = nil // Nothing was spent on this request
+	h.receipts.ChatReceipt(middleware.GetUserID(c), message, response)
+	writeResult(c, stream, response.Response, response)
 }
 
 // GetSession returns session details
 func (h *ChatHandler) GetSession(c *gin.Context) {
 	sessionID := c.Param("session_id")
 
-	ctx := context.Background()
-	session, err := h.sessionStore.GetSession(ctx, sessionID)
+	ctx := c.Request.Context()
+	session, err := h.sessionStore.ViewSession(ctx, sessionID, middleware.GetUserID(c))
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 		return
@@ -234,11 +931,106 @@ func (h *ChatHandler) GetSession(c *gin.Context) {
 	c.JSON(http.StatusOK, session)
 }
 
+// GetSessionAnalytics returns the analytics of one of the user's sessions.
+// Sessions not analyzed yet answer 202 and are queued; those of users who
+// opted out of analytics answer 404.
+func (h *ChatHandler) GetSessionAnalytics(c *gin.Context) {
+	if h.analyzer == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session analytics are not enabled"})
+		return
+	}
+
+	sessionID := c.Param("session_id")
+	ctx := c.Request.Context()
+	userID := middleware.GetUserID(c)
+	session, err := h.sessionStore.ViewSession(ctx, sessionID, userID)
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+		return
+	}
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session analytics"})
+		return
+	}
+
+	if !h.analyzer.Allowed(ctx, userID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Analytics are turned off in your privacy settings"})
+		return
+	}
+
+	analytics, err := h.analyzer.Get(ctx, sessionID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session analytics"})
+		return
+	}
+	if analytics == nil {
+		h.analyzeSession(ctx, sessionID)
+		c.JSON(http.StatusAccepted, gin.H{"session_id": sessionID, "status": "pending"})
+		return
+	}
+
+	analytics.Stale = session.MessageCount > analytics.MessageCount
+	c.JSON(http.StatusOK, analytics)
+}
+
+// ExportSession returns the session as a Markdown transcript or as JSON,
+// picked with ?format=markdown (default) or ?format=json
+func (h *ChatHandler) ExportSession(c *gin.Context) {
+	format := c.DefaultQuery("format", chat.ExportFormatMarkdown)
+	if format != chat.ExportFormatMarkdown && format != chat.ExportFormatJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be \"markdown\" or \"json\""})
+		return
+	}
+
+	sessionID := c.Param("session_id")
+	ctx := c.Request.Context()
+	session, err := h.sessionStore.ViewSession(ctx, sessionID, middleware.GetUserID(c))
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+		return
+	}
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export session"})
+		return
+	}
+
+	export := chat.NewExport(session, time.Now())
+	if format == chat.ExportFormatJSON {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.json"`, sessionID))
+		c.JSON(http.StatusOK, export)
+		return
+	}
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.md"`, sessionID))
+	c.Data(http.StatusOK, "text/markdown; charset=utf-8", []byte(chat.RenderMarkdown(export)))
+}
+
 // DeleteSession deletes a session
 func (h *ChatHandler) DeleteSession(c *gin.Context) {
 	sessionID := c.Param("session_id")
 
-	ctx := context.Background()
+	ctx := c.Request.Context()
+	_, err := h.sessionStore.GetSessionForUser(ctx, sessionID, middleware.GetUserID(c))
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+		return
+	}
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
+		return
+	}
+
 	if err := h.sessionStore.DeleteSession(ctx, sessionID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete session"})
 		return
@@ -247,17 +1039,258 @@ func (h *ChatHandler) DeleteSession(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Session deleted successfully"})
 }
 
-// ListSessions returns all active session IDs
+// RenameSession sets the title of a session
+func (h *ChatHandler) RenameSession(c *gin.Context) {
+	var req models.RenameSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title must not be blank"})
+		return
+	}
+
+	sessionID := c.Param("session_id")
+	ctx := c.Request.Context()
+	_, err := h.sessionStore.GetSessionForUser(ctx, sessionID, middleware.GetUserID(c))
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+		return
+	}
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename session"})
+		return
+	}
+
+	session, err := h.sessionStore.RenameSession(ctx, sessionID, title)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// PinSession pins or unpins a session. Pinned sessions are kept until deleted.
+func (h *ChatHandler) PinSession(c *gin.Context) {
+	var req models.PinSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sessionID := c.Param("session_id")
+	ctx := c.Request.Context()
+	_, err := h.sessionStore.GetSessionForUser(ctx, sessionID, middleware.GetUserID(c))
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+		return
+	}
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin session"})
+		return
+	}
+
+	session, err := h.sessionStore.PinSession(ctx, sessionID, *req.Pinned)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pin session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// RegenerateMessage answers the question of an assistant message again,
+// replacing that answer and discarding the turns after it. The new answer
+// is always generated, never served from a cache, and "force_llm" sends it
+// to the LLM tier.
+func (h *ChatHandler) RegenerateMessage(c *gin.Context) {
+	startTime := time.Now()
+
+	var req models.RegenerateRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if !useOrgKeys(c, h.credentials) {
+		return
+	}
+
+	session, index, ok := h.sessionMessage(c)
+	if !ok {
+		return
+	}
+	if session.Messages[index].Role != "assistant" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only assistant messages can be regenerated"})
+		return
+	}
+	if index == 0 || session.Messages[index-1].Role != "user" {
+		c.JSON(http.StatusConflict, gin.H{"error": "The question of this message is no longer in the session"})
+		return
+	}
+	question := session.Messages[index-1]
+
+	h.retakeTurn(c, session, index-1, &models.ChatRequest{
+		SessionID:   session.SessionID,
+		Message:     question.Content,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      req.Stream,
+	}, turnOptions{fresh: true, forceLLM: req.ForceLLM}, startTime)
+}
+
+// EditMessage replaces a user message and answers the new version, discarding
+// the turns after it
+func (h *ChatHandler) EditMessage(c *gin.Context) {
+	startTime := time.Now()
+
+	var req models.EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !useOrgKeys(c, h.credentials) {
+		return
+	}
+
+	session, index, ok := h.sessionMessage(c)
+	if !ok {
+		return
+	}
+	if session.Messages[index].Role != "user" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only user messages can be edited"})
+		return
+	}
+
+	h.retakeTurn(c, session, index, &models.ChatRequest{
+		SessionID:   session.SessionID,
+		Message:     req.Message,
+		MaxTokens:   req.MaxTokens,
+		Temperature: req.Temperature,
+		Stream:      req.Stream,
+	}, turnOptions{}, startTime)
+}
+
+// sessionMessage loads the session of the request and the position of its
+// :index message, writing the error response if either can't be found
+func (h *ChatHandler) sessionMessage(c *gin.Context) (*models.ChatSession, int, bool) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil || index < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "index must be a message position"})
+		return nil, 0, false
+	}
+
+	session, err := h.sessionStore.GetSessionForUser(c.Request.Context(), c.Param("session_id"), middleware.GetUserID(c))
+	if errors.Is(err, chat.ErrSessionForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Session belongs to another user"})
+		return nil, 0, false
+	}
+	if errors.Is(err, chat.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return nil, 0, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get session"})
+		return nil, 0, false
+	}
+
+	if index >= len(session.Messages) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return nil, 0, false
+	}
+	return session, index, true
+}
+
+// retakeTurn answers req in place of the message at index, with the history
+// before it. The stored session is only cut back once the new answer is
+// there, so a failed retake leaves it as it was.
+func (h *ChatHandler) retakeTurn(c *gin.Context, session *models.ChatSession, index int, req *models.ChatRequest, opts turnOptions, startTime time.Time) {
+	before := *session
+	before.Messages = append([]models.ChatMessage(nil), session.Messages[:index]...)
+	for _, message := range session.Messages[index:] {
+		if message.Role != "system" {
+			before.MessageCount--
+		}
+	}
+	opts.retake = &retake{index: index, messageID: session.Messages[index].ID}
+
+	var stream *sseStream
+	if req.Stream {
+		stream = newResumableSSEStream(c, h.streamBuffer, middleware.GetUserID(c))
+		stream.pacer = streamPacer(c, h.streamRate, h.streamBurst)
+		defer stream.drain()
+	}
+	turnClaimed := false
+	h.respond(c, stream, &before, req, &turnClaimed, opts, startTime)
+}
+
+// CreateSession starts an empty session, optionally with its own system prompt
+// and in a project
+func (h *ChatHandler) CreateSession(c *gin.Context) {
+	var req models.CreateSessionRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	session, err := h.sessionStore.CreateProjectSession(c.Request.Context(), middleware.GetUserID(c), req.SystemPrompt, req.Project)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	log.Printf("Created new chat session: %s", session.SessionID)
+	c.JSON(http.StatusCreated, session)
+}
+
+// ListSessions returns a page of the active sessions owned by the
+// authenticated user, most recently used first. ?limit= sets the page size
+// and ?cursor= continues from a previous page's next_cursor. ?archived=true
+// lists archived sessions instead.
 func (h *ChatHandler) ListSessions(c *gin.Context) {
-	ctx := context.Background()
-	sessionIDs, err := h.sessionStore.GetRecentSessions(ctx)
+	limit := defaultSessionPageSize
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxSessionPageSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxSessionPageSize)})
+			return
+		}
+		limit = n
+	}
+
+	list := h.sessionStore.ListSessions
+	if c.Query("archived") == "true" {
+		list = h.sessionStore.ListArchivedSessions
+	}
+
+	ctx := c.Request.Context()
+	page, err := list(ctx, middleware.GetUserID(c), limit, c.Query("cursor"))
+	if errors.Is(err, chat.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list sessions"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"sessions": sessionIDs,
-		"count":    len(sessionIDs),
+		"sessions":    page.Sessions,
+		"count":       len(page.Sessions),
+		"next_cursor": page.NextCursor,
 	})
 }
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/mocks"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+// setupEdits serves message edits for alice's session, which holds one
+// answered question
+func setupEdits(t *testing.T) (*gin.Engine, *chat.SessionStore, string, *mocks.MockSLMEngine, *mocks.MockLLMClient) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	sessions := chat.NewSessionStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	mockLLM := new(mocks.MockLLMClient)
+	mockSLM := new(mocks.MockSLMEngine)
+	mockCache := new(mocks.MockCache)
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	handler := NewChatHandler(router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65}), mockSLM, mockLLM, mockCache, sessions)
+
+	ctx := context.Background()
+	session, err := sessions.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	require.NoError(t, sessions.AddMessage(ctx, session.SessionID, "user", "What is 2+2?", 5))
+	require.NoError(t, sessions.AddAnswer(ctx, session.SessionID, "4", 1, "llama-3.1-8b-instant", 0))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		middleware.SetUserID(c, "alice")
+		c.Next()
+	})
+	r.PATCH("/chat/sessions/:session_id/messages/:index", handler.EditMessage)
+
+	return r, sessions, session.SessionID, mockSLM, mockLLM
+}
+
+func editMessage(r *gin.Engine, sessionID string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/chat/sessions/"+sessionID+"/messages/0", bytes.NewBufferString(`{"message": "What is 3+3?"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestChatHandler_EditMessageReplacesTurn(t *testing.T) {
+	r, sessions, sessionID, mockSLM, _ := setupEdits(t)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "6", SelectedModel: "llama-3.1-8b-instant"}, nil)
+
+	w := editMessage(r, sessionID)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	session, err := sessions.GetSession(context.Background(), sessionID)
+	require.NoError(t, err)
+	require.Len(t, session.Messages, 2)
+	assert.Equal(t, "What is 3+3?", session.Messages[0].Content)
+	assert.Equal(t, "6", session.Messages[1].Content)
+	assert.Equal(t, 2, session.MessageCount)
+}
+
+func TestChatHandler_FailedEditKeepsSession(t *testing.T) {
+	r, sessions, sessionID, mockSLM, mockLLM := setupEdits(t)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(nil, errors.New("slm down"))
+	mockLLM.On("Infer", mock.Anything, mock.Anything).Return("", errors.New("llm down"))
+
+	w := editMessage(r, sessionID)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+
+	session, err := sessions.GetSession(context.Background(), sessionID)
+	require.NoError(t, err)
+	require.Len(t, session.Messages, 2, "the old turn stays until there is a new answer")
+	assert.Equal(t, "What is 2+2?", session.Messages[0].Content)
+	assert.Equal(t, "4", session.Messages[1].Content)
+}
+
+func TestChatHandler_SessionAnalyticsAreTheOwners(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sessions := chat.NewSessionStore(client)
+	analyzer := chat.NewAnalyzer(client, sessions, nil, 0)
+	handler := NewChatHandler(router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65}), new(mocks.MockSLMEngine), new(mocks.MockLLMClient), new(mocks.MockCache), sessions)
+	handler.SetAnalyzer(analyzer)
+
+	session, err := sessions.CreateSession(context.Background(), "alice")
+	require.NoError(t, err)
+
+	get := func(userID string, role string) int {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			middleware.SetUserID(c, userID)
+			c.Set("role", role)
+			c.Next()
+		})
+		r.GET("/chat/sessions/:session_id/analytics", handler.GetSessionAnalytics)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/chat/sessions/"+session.SessionID+"/analytics", nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusAccepted, get("alice", models.RoleUser))
+	assert.Equal(t, http.StatusForbidden, get("bob", models.RoleAdmin), "admins only read their own sessions' analytics too")
+
+	analyzer.SetConsent(func(ctx context.Context, userID string) bool { return false })
+	assert.Equal(t, http.StatusNotFound, get("alice", models.RoleUser))
+}
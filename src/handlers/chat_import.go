@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/degradation"
+	"www.github.com/Wanderer0074348/HybridLM/src/flags"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	defaultImportMaxBytes         = 32 << 20
+	defaultImportMaxConversations = 100
+)
+
+// ImportSessions turns the conversations of a ChatGPT or Claude export into
+// sessions of the user. ?format= ("chatgpt" or "claude") skips detecting it.
+// Conversations too long for the context window are summarized when a
+// summarizer is set, and keep only their latest messages otherwise, as do
+// those left once the user's daily token quota is used up or below the
+// SLM-only degradation level.
+func (h *ChatHandler) ImportSessions(c *gin.Context) {
+	format := c.Query("format")
+	if format != "" && format != chat.ImportFormatChatGPT && format != chat.ImportFormatClaude {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be \"chatgpt\" or \"claude\""})
+		return
+	}
+
+	maxBytes := h.importLimits.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultImportMaxBytes
+	}
+	maxConversations := h.importLimits.MaxConversations
+	if maxConversations <= 0 {
+		maxConversations = defaultImportMaxConversations
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Exports are limited to %d bytes", maxBytes)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read export"})
+		return
+	}
+
+	conversations, err := chat.ParseExport(data, format)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(conversations) > maxConversations {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Exports are limited to %d conversations, split it to import more", maxConversations)})
+		return
+	}
+
+	ctx := c.Request.Context()
+	userID := middleware.GetUserID(c)
+	service := degrade(c, h.ladder)
+	summarize := h.summarizer != nil && !h.featureFlags.EnabledFor(ctx, flags.DisableLLM, userID) &&
+		!degradation.Reaches(service.Level, degradation.LevelSLMOnly)
+	now := time.Now()
+
+	imported := make([]models.SessionSummary, 0, len(conversations))
+	skipped := 0
+	cost := &models.CostMetrics{}
+	for _, conversation := range conversations {
+		if len(conversation.Messages) == 0 {
+			skipped++
+			continue
+		}
+
+		session := chat.NewImportedSession(userID, conversation, now)
+		if summarize && h.summarizer.ShouldSummarize(session) {
+			if left, limited := h.rateLimiter.QuotaLeft(c); limited && left <= 0 {
+				log.Printf("Daily token quota of user %s used up, importing the rest of the export unsummarized", userID)
+				summarize = false
+			}
+		}
+		if summarize && h.summarizer.ShouldSummarize(session) {
+			summarized, usage, err := h.summarizer.Summarize(ctx, session)
+			if err != nil {
+				log.Printf("Failed to summarize imported session %s, keeping its latest messages: %v", session.SessionID, err)
+			} else if usage != nil {
+				session = summarized
+				session.TotalCost += usage.Cost
+				cost.SummarizationCost += usage.Cost
+				cost.TotalCost += usage.Cost
+				cost.TotalTokens += usage.InputTokens + usage.OutputTokens
+				middleware.AddTokenUsage(c, usage.InputTokens+usage.OutputTokens)
+			}
+		}
+
+		if err := h.sessionStore.ImportSession(ctx, session); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import sessions", "imported": imported})
+			return
+		}
+		h.analyzeSession(ctx, session.SessionID)
+		imported = append(imported, models.SessionSummary{
+			SessionID:       session.SessionID,
+			Title:           session.Title,
+			CreatedAt:       session.CreatedAt,
+			LastInteraction: session.LastInteraction,
+			MessageCount:    session.MessageCount,
+		})
+	}
+
+	if cost.TotalCost > 0 {
+		recordUsage(c, h.usageStore, cost, false)
+		recordSpend(c, h.spendCaps, false, cost)
+	}
+	log.Printf("Imported %d chat sessions for user %s", len(imported), userID)
+	c.JSON(http.StatusCreated, gin.H{"sessions": imported, "skipped": skipped})
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/degradation"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/mocks"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+// setupImports imports exports for alice, summarizing long conversations,
+// within a daily quota of 1000 tokens
+func setupImports(t *testing.T) (*gin.Engine, *ChatHandler, *miniredis.Miniredis, *mocks.MockLLMClient) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	mockLLM := new(mocks.MockLLMClient)
+	mockLLM.On("InferChat", mock.Anything, mock.Anything, mock.Anything).Return("They talked at length.", nil)
+	handler := NewChatHandler(router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65}), new(mocks.MockSLMEngine), mockLLM, new(mocks.MockCache), chat.NewSessionStore(client))
+	handler.SetSummarizer(chat.NewSummarizer(mockLLM))
+
+	limiter := middleware.NewRateLimiter(client, &config.RateLimitConfig{TokensPerDay: 1000})
+	limiter.SetClock(clock.NewFake(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)))
+	handler.SetRateLimiter(limiter)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		middleware.SetUserID(c, "alice")
+		c.Next()
+	})
+	r.Use(limiter.Middleware())
+	r.POST("/chat/import", handler.ImportSessions)
+	return r, handler, mr, mockLLM
+}
+
+// importLongConversations imports a Claude export of conversations too long
+// for the context window
+func importLongConversations(t *testing.T, r *gin.Engine, count int) {
+	type message struct {
+		Sender string `json:"sender"`
+		Text   string `json:"text"`
+	}
+	type conversation struct {
+		Name         string    `json:"name"`
+		ChatMessages []message `json:"chat_messages"`
+	}
+
+	export := make([]conversation, count)
+	for i := range export {
+		export[i].Name = "Long talk"
+		for j := 0; j < 6; j++ {
+			sender := "human"
+			if j%2 == 1 {
+				sender = "assistant"
+			}
+			export[i].ChatMessages = append(export[i].ChatMessages, message{Sender: sender, Text: strings.Repeat("more words ", 400)})
+		}
+	}
+	body, err := json.Marshal(export)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/chat/import?format=claude", bytes.NewReader(body)))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+}
+
+func TestChatHandler_ImportSummariesWithinQuota(t *testing.T) {
+	r, _, mr, mockLLM := setupImports(t)
+
+	// The first summary uses up the quota, the rest keep their latest messages
+	importLongConversations(t, r, 3)
+	mockLLM.AssertNumberOfCalls(t, "InferChat", 1)
+
+	used, err := mr.Get("ratelimit:tokens:alice:2026-01-15")
+	require.NoError(t, err)
+	assert.NotEqual(t, "0", used)
+}
+
+func TestChatHandler_ImportSkipsSummariesWhenSLMOnly(t *testing.T) {
+	r, handler, _, mockLLM := setupImports(t)
+	ladder := degradation.NewLadder(config.DegradationConfig{
+		Load: config.DegradationLoadConfig{SLMOnly: 1},
+	})
+	handler.SetDegradation(ladder)
+
+	release := ladder.Enter()
+	defer release()
+	importLongConversations(t, r, 2)
+	mockLLM.AssertNotCalled(t, "InferChat", mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+// CredentialsHandler is the admin API for the provider keys orgs bring
+type CredentialsHandler struct {
+	store     *credentials.Store
+	providers []string       // Providers a key can be stored for
+	outbox    *outbox.Outbox // Receives key change audit events, optional
+}
+
+func NewCredentialsHandler(store *credentials.Store, providers []string) *CredentialsHandler {
+	return &CredentialsHandler{
+		store:     store,
+		providers: providers,
+	}
+}
+
+// SetOutbox records key changes as audit events
+func (h *CredentialsHandler) SetOutbox(o *outbox.Outbox) {
+	h.outbox = o
+}
+
+// GetCredentials lists the org's keys, without the secrets
+func (h *CredentialsHandler) GetCredentials(c *gin.Context) {
+	described, err := h.store.Get(c.Request.Context(), c.Param("org"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get credentials"})
+		return
+	}
+
+	c.JSON(http.StatusOK, described)
+}
+
+// SetKey stores or replaces the org's key for a provider
+func (h *CredentialsHandler) SetKey(c *gin.Context) {
+	var req models.SetProviderKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	provider := c.Param("provider")
+	if !slices.Contains(h.providers, provider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Unknown provider", "providers": h.providers})
+		return
+	}
+
+	org := c.Param("org")
+	described, err := h.store.SetKey(c.Request.Context(), org, provider, req.APIKey)
+	if err != nil {
+		log.Printf("Failed to store %s key for %s: %v", provider, org, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store key"})
+		return
+	}
+
+	log.Printf("🔑 %s key set for org %s", provider, org)
+	recordAudit(c, h.outbox, "credentials.key_set", "", gin.H{"org": org, "provider": provider})
+	c.JSON(http.StatusOK, described)
+}
+
+// DeleteKey removes the org's key for a provider
+func (h *CredentialsHandler) DeleteKey(c *gin.Context) {
+	org, provider := c.Param("org"), c.Param("provider")
+	described, err := h.store.DeleteKey(c.Request.Context(), org, provider)
+	if errors.Is(err, credentials.ErrKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete key"})
+		return
+	}
+
+	log.Printf("🔑 %s key deleted for org %s", provider, org)
+	recordAudit(c, h.outbox, "credentials.key_deleted", "", gin.H{"org": org, "provider": provider})
+	c.JSON(http.StatusOK, described)
+}
+
+// SetSecondaryKey stores or replaces the org's standby key for a provider,
+// used while the provider rejects the primary one
+func (h *CredentialsHandler) SetSecondaryKey(c *gin.Context) {
+	var req models.SetProviderKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	org, provider := c.Param("org"), c.Param("provider")
+	described, err := h.store.SetSecondaryKey(c.Request.Context(), org, provider, req.APIKey)
+	if errors.Is(err, credentials.ErrKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Set a primary key for this provider first"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to store secondary %s key for %s: %v", provider, org, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store key"})
+		return
+	}
+
+	log.Printf("🔑 Secondary %s key set for org %s", provider, org)
+	recordAudit(c, h.outbox, "credentials.secondary_key_set", "", gin.H{"org": org, "provider": provider})
+	c.JSON(http.StatusOK, described)
+}
+
+// DeleteSecondaryKey removes the org's standby key for a provider
+func (h *CredentialsHandler) DeleteSecondaryKey(c *gin.Context) {
+	org, provider := c.Param("org"), c.Param("provider")
+	described, err := h.store.DeleteSecondaryKey(c.Request.Context(), org, provider)
+	if errors.Is(err, credentials.ErrNoSecondaryKey) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Key not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete key"})
+		return
+	}
+
+	log.Printf("🔑 Secondary %s key deleted for org %s", provider, org)
+	recordAudit(c, h.outbox, "credentials.secondary_key_deleted", "", gin.H{"org": org, "provider": provider})
+	c.JSON(http.StatusOK, described)
+}
+
+// PromoteKey swaps the org's primary and secondary keys for a provider
+func (h *CredentialsHandler) PromoteKey(c *gin.Context) {
+	org, provider := c.Param("org"), c.Param("provider")
+	described, err := h.store.PromoteKey(c.Request.Context(), org, provider)
+	if errors.Is(err, credentials.ErrNoSecondaryKey) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No secondary key to promote"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to promote key"})
+		return
+	}
+
+	log.Printf("🔑 Secondary %s key promoted for org %s", provider, org)
+	recordAudit(c, h.outbox, "credentials.key_promoted", "", gin.H{"org": org, "provider": provider})
+	c.JSON(http.StatusOK, described)
+}
+
+// UpdateCredentials changes whether the org may fall back to platform keys
+// and where its key alerts go
+func (h *CredentialsHandler) UpdateCredentials(c *gin.Context) {
+	var req models.UpdateOrgCredentialsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AlertWebhook != nil && *req.AlertWebhook != "" {
+		if u, err := url.Parse(*req.AlertWebhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "alert_webhook must be an http(s) URL"})
+			return
+		}
+	}
+
+	org := c.Param("org")
+	described, err := h.store.Update(c.Request.Context(), org, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update credentials"})
+		return
+	}
+
+	recordAudit(c, h.outbox, "credentials.updated", "", gin.H{"org": org, "platform_fallback": described.PlatformFallback, "alert_webhook": described.AlertWebhook})
+	c.JSON(http.StatusOK, described)
+}
+
+// useOrgKeys makes the request's model calls use the provider keys of the
+// caller's org. It answers 503 and returns false if they can't be loaded,
+// rather than bill the platform's keys.
+func useOrgKeys(c *gin.Context, store *credentials.Store) bool {
+	userID := middleware.GetUserID(c)
+	keys, err := store.ForUser(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to load org keys for %s: %v", userID, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to load your org's provider keys"})
+		return false
+	}
+
+	c.Request = c.Request.WithContext(credentials.WithKeys(c.Request.Context(), keys))
+	return true
+}
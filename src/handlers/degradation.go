@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/degradation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	// DegradationLevelHeader reports the service level a request ran at
+	DegradationLevelHeader = "X-Degradation-Level"
+
+	degradationKey         = "degradation" // Context key of the service level below full
+	maintenanceAnswerModel = "maintenance-answer"
+	maintenanceAnswerTier  = "maintenance"
+)
+
+// degrade returns the service level for a request, reporting it in a header
+// and, below full service, keeping it for the response's metadata
+func degrade(c *gin.Context, ladder *degradation.Ladder) models.DegradationStatus {
+	status := ladder.Status()
+	if ladder != nil {
+		c.Header(DegradationLevelHeader, status.Level)
+	}
+	if status.Level != degradation.LevelFull {
+		c.Set(degradationKey, &status)
+	}
+	return status
+}
+
+// maintenanceResponse is the static answer given at the maintenance level
+func maintenanceResponse(ladder *degradation.Ladder, startTime time.Time) *models.InferenceResponse {
+	return &models.InferenceResponse{
+		Response:      ladder.MaintenanceAnswer(),
+		ModelUsed:     maintenanceAnswerModel,
+		Tier:          maintenanceAnswerTier,
+		RoutingReason: "Service degraded to maintenance",
+		Latency:       time.Since(startTime),
+		Timestamp:     time.Now(),
+		CostMetrics:   &models.CostMetrics{Model: maintenanceAnswerModel},
+	}
+}
+
+// rejectUncached refuses a query without a cached answer at the cached-only
+// level. Returns false if it did.
+func rejectUncached(c *gin.Context, stream *sseStream, status models.DegradationStatus) bool {
+	if !degradation.Reaches(status.Level, degradation.LevelCachedOnly) {
+		return true
+	}
+	c.Header("Retry-After", "60")
+	writeError(c, stream, http.StatusServiceUnavailable, gin.H{
+		"error":       "Service is degraded to cached answers only, and this query has none",
+		"degradation": status,
+	})
+	return false
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// errLLMDisabled is returned when a query only the LLM tier can serve arrives
+// while the disable_llm flag is on
+var errLLMDisabled = errors.New("LLM tier is disabled")
+
+// tierName returns the ModelUsed label of a tier
+func tierName(useLLM bool) string {
+	if useLLM {
+		return "cloud-llm"
+	}
+	return "edge-slm"
+}
+
+// canFailOver reports whether a failed call may be retried on the other tier:
+// the provider must be at fault, the router must not have been forced to this
+// tier by a capability constraint, and no tokens may have reached the client yet
+func canFailOver(decision *models.RoutingDecision, stream *sseStream, err error) bool {
+	if !inference.IsProviderFailure(err) || decision.Forced {
+		return false
+	}
+	return stream == nil || !stream.sentTokens
+}
+
+// newFallback describes a failover away from the routed tier
+func newFallback(fromLLM bool, err error) *models.FallbackInfo {
+	return &models.FallbackInfo{
+		From:   tierName(fromLLM),
+		To:     tierName(!fromLLM),
+		Reason: err.Error(),
+	}
+}
+
+// avoidDisabledLLM reroutes an LLM decision to the SLM tier while the LLM tier
+// is switched off. Decisions forced onto the LLM by a capability constraint
+// can't be rerouted and return errLLMDisabled.
+func avoidDisabledLLM(decision *models.RoutingDecision) error {
+	if !decision.UseLLM {
+		return nil
+	}
+	if decision.Forced {
+		return errLLMDisabled
+	}
+	decision.UseLLM = false
+	decision.Model = ""
+	decision.Reason += " (LLM tier disabled)"
+	return nil
+}
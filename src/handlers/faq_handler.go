@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/analytics"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/faq"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+const (
+	pinnedAnswerModel = "pinned-answer"
+	pinnedAnswerTier  = "pinned"
+	maxFAQCandidates  = 1000
+)
+
+// CreatePinnedAnswerRequest is the body of POST /admin/faq
+type CreatePinnedAnswerRequest struct {
+	Query  string `json:"query" binding:"required"`
+	Answer string `json:"answer" binding:"required"`
+	Author string `json:"author,omitempty"`
+}
+
+// UpdatePinnedAnswerRequest is the body of PUT /admin/faq/:id
+type UpdatePinnedAnswerRequest struct {
+	Answer string `json:"answer" binding:"required"`
+	Author string `json:"author,omitempty"`
+}
+
+// ReviewPinnedAnswerRequest is the body of POST /admin/faq/:id/approve and /reject
+type ReviewPinnedAnswerRequest struct {
+	Reviewer string `json:"reviewer,omitempty"`
+	Note     string `json:"note,omitempty"`
+}
+
+// FAQHandler is the admin API for pinned answers
+type FAQHandler struct {
+	store *faq.Store
+	stats *analytics.QueryStats // Source of candidates, optional
+	cfg   config.FAQConfig
+}
+
+func NewFAQHandler(store *faq.Store, stats *analytics.QueryStats, cfg config.FAQConfig) *FAQHandler {
+	return &FAQHandler{
+		store: store,
+		stats: stats,
+		cfg:   cfg,
+	}
+}
+
+// Candidates returns frequent queries without a pinned answer yet
+func (h *FAQHandler) Candidates(c *gin.Context) {
+	if h.stats == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Query stats are disabled"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	report, err := h.stats.Top(ctx, h.cfg.CandidateDays, maxFAQCandidates)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get query stats"})
+		return
+	}
+	candidates, err := h.store.Candidates(ctx, report, h.cfg.MinCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get candidates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"days":       report.Days,
+		"min_count":  h.cfg.MinCount,
+		"candidates": candidates,
+	})
+}
+
+// ListAnswers returns pinned answers, optionally filtered by ?status=
+func (h *FAQHandler) ListAnswers(c *gin.Context) {
+	status := c.Query("status")
+	switch status {
+	case "", faq.StatusPending, faq.StatusApproved, faq.StatusRejected:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, approved or rejected"})
+		return
+	}
+
+	answers, err := h.store.List(c.Request.Context(), status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list pinned answers"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"answers": answers})
+}
+
+// GetAnswer returns one pinned answer
+func (h *FAQHandler) GetAnswer(c *gin.Context) {
+	pinned, err := h.store.Get(c.Request.Context(), c.Param("id"))
+	if !h.checkError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, pinned)
+}
+
+// CreateAnswer adds a pending answer for a query
+func (h *FAQHandler) CreateAnswer(c *gin.Context) {
+	var req CreatePinnedAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pinned, err := h.store.Create(c.Request.Context(), req.Query, req.Answer, req.Author)
+	if !h.checkError(c, err) {
+		return
+	}
+
+	log.Printf("📌 Pinned answer %s created for %q, pending review", pinned.ID, pinned.Query)
+	c.JSON(http.StatusCreated, pinned)
+}
+
+// UpdateAnswer edits an answer, which sends it back for review
+func (h *FAQHandler) UpdateAnswer(c *gin.Context) {
+	var req UpdatePinnedAnswerRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pinned, err := h.store.Update(c.Request.Context(), c.Param("id"), req.Answer, req.Author)
+	if !h.checkError(c, err) {
+		return
+	}
+
+	c.JSON(http.StatusOK, pinned)
+}
+
+// ApproveAnswer starts serving an answer
+func (h *FAQHandler) ApproveAnswer(c *gin.Context) {
+	h.review(c, true)
+}
+
+// RejectAnswer stops serving an answer
+func (h *FAQHandler) RejectAnswer(c *gin.Context) {
+	h.review(c, false)
+}
+
+// DeleteAnswer removes an answer
+func (h *FAQHandler) DeleteAnswer(c *gin.Context) {
+	id := c.Param("id")
+	if !h.checkError(c, h.store.Delete(c.Request.Context(), id)) {
+		return
+	}
+
+	log.Printf("📌 Pinned answer %s deleted", id)
+	c.JSON(http.StatusOK, gin.H{"message": "Pinned answer deleted"})
+}
+
+func (h *FAQHandler) review(c *gin.Context, approve bool) {
+	var req ReviewPinnedAnswerRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	pinned, err := h.store.Review(c.Request.Context(), c.Param("id"), approve, req.Reviewer, req.Note)
+	if !h.checkError(c, err) {
+		return
+	}
+
+	log.Printf("📌 Pinned answer %s %s", pinned.ID, pinned.Status)
+	c.JSON(http.StatusOK, pinned)
+}
+
+// checkError writes the response for a store error; returns true if there was none
+func (h *FAQHandler) checkError(c *gin.Context, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, faq.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, faq.ErrDuplicateQuery):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, faq.ErrEmptyQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update pinned answers"})
+	}
+	return false
+}
+
+// lookupPinnedAnswer returns the approved pinned answer for the request's
+// query as a response, or nil when there is none. Requests asking for a
+// specific output format never get one. Lookup failures are logged and
+// treated as a miss so requests still reach the models.
+func lookupPinnedAnswer(c *gin.Context, store *faq.Store, req *models.InferenceRequest, startTime time.Time) *models.InferenceResponse {
+	if store == nil || req.ResponseFormat != "" {
+		return nil
+	}
+
+	query := req.Query
+	pinned, err := store.Lookup(c.Request.Context(), query)
+	if err != nil {
+		log.Printf("Failed to look up pinned answer: %v", err)
+		return nil
+	}
+	if pinned == nil {
+		return nil
+	}
+
+	inputTokens := utils.CountTokens(query, "")
+	outputTokens := utils.CountTokens(pinned.Answer, "")
+	return &models.InferenceResponse{
+		Response:      pinned.Answer,
+		ModelUsed:     pinnedAnswerModel,
+		Tier:          pinnedAnswerTier,
+		RoutingReason: "Pinned answer " + pinned.ID,
+		Latency:       time.Since(startTime),
+		Timestamp:     time.Now(),
+		CostMetrics: &models.CostMetrics{
+			InputTokens:  inputTokens,
+			OutputTokens: outputTokens,
+			TotalTokens:  inputTokens + outputTokens,
+			Model:        pinnedAnswerModel,
+		},
+	}
+}
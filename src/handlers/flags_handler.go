@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/flags"
+)
+
+// FlagsHandler is the admin API for runtime feature flags
+type FlagsHandler struct {
+	store *flags.Store
+}
+
+func NewFlagsHandler(store *flags.Store) *FlagsHandler {
+	return &FlagsHandler{
+		store: store,
+	}
+}
+
+// ListFlags returns the current rollout rule of every feature flag
+func (h *FlagsHandler) ListFlags(c *gin.Context) {
+	values, err := h.store.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get feature flags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flags": values})
+}
+
+// SetFlag replaces one feature flag's rollout rule: on for everyone
+// ("enabled"), for a share of users ("percentage") or for specific users
+// and orgs ("users", "orgs")
+func (h *FlagsHandler) SetFlag(c *gin.Context) {
+	var flag flags.Flag
+	if err := c.ShouldBindJSON(&flag); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := c.Param("flag")
+	err := h.store.Put(c.Request.Context(), name, flag)
+	if errors.Is(err, flags.ErrUnknownFlag) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error(), "known_flags": flags.Known})
+		return
+	}
+	if errors.Is(err, flags.ErrInvalidPercentage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set feature flag"})
+		return
+	}
+
+	log.Printf("🚩 Feature flag %s set (enabled: %t, rollout: %d%%, %d users, %d orgs)",
+		name, flag.Enabled, flag.Percentage, len(flag.Users), len(flag.Orgs))
+	c.JSON(http.StatusOK, gin.H{"flag": name, "rule": flag})
+}
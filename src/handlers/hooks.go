@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/hooks"
+)
+
+// runHooks runs a stage's extension hooks. If one rejects the request the
+// rejection is written and false is returned.
+func runHooks(c *gin.Context, stream *sseStream, manager *hooks.Manager, stage hooks.Stage, payload *hooks.Payload) bool {
+	err := manager.Run(c.Request.Context(), stage, payload)
+
+	var rejection *hooks.Rejection
+	if errors.As(err, &rejection) {
+		writeError(c, stream, rejection.Status, gin.H{"error": rejection.Message})
+		return false
+	}
+	return true
+}
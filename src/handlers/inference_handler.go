@@ -1,34 +1,95 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"www.github.com/Wanderer0074348/HybridLM/src/analytics"
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/degradation"
+	"www.github.com/Wanderer0074348/HybridLM/src/faq"
+	"www.github.com/Wanderer0074348/HybridLM/src/flags"
+	"www.github.com/Wanderer0074348/HybridLM/src/health"
+	"www.github.com/Wanderer0074348/HybridLM/src/hooks"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/knowledge"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/moderation"
+	"www.github.com/Wanderer0074348/HybridLM/src/privacy"
+	"www.github.com/Wanderer0074348/HybridLM/src/receipts"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
 	"www.github.com/Wanderer0074348/HybridLM/src/router"
+	"www.github.com/Wanderer0074348/HybridLM/src/streaming"
+	"www.github.com/Wanderer0074348/HybridLM/src/supervisor"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
 	"www.github.com/Wanderer0074348/HybridLM/src/utils"
 )
 
 type InferenceHandler struct {
 	router              *router.QueryRouter
-	slmEngine           models.SLMInferencer     // Changed to interface
-	llmClient           models.LLMInferencer     // Changed to interface
-	cache               models.CacheStore        // Changed to interface
+	slmEngine           models.SLMInferencer      // Changed to interface
+	llmClient           models.LLMInferencer      // Changed to interface
+	cache               models.CacheStore         // Changed to interface
 	semanticCache       models.SemanticCacheStore // Semantic cache for similarity search
 	useSemanticCache    bool
 	similarityThreshold float64
 	llmModelName        string // e.g., "gpt-3.5-turbo"
 	slmModelName        string // e.g., "llama-3.1-8b-instant"
+	modelRegistry       *registry.ModelRegistry
+	promptGuard         *inference.PromptGuard
+	continuer           *inference.Continuer
+	streamBuffer        *streaming.Buffer // Set when SSE streams are resumable
+	streamRate          float64           // Ceiling on streamed tokens per second, 0 for none
+	streamBurst         int               // Tokens a paced stream may send ahead of the rate
+	usageStore          *usage.Store      // Per-user usage ledger, optional
+	spendCaps           *usage.SpendCaps  // Monthly spend caps per provider key, optional
+	llmBreaker          *inference.CircuitBreaker
+	slmBreaker          *inference.CircuitBreaker
+	failover            bool                 // Fall back to the other tier when the routed one fails
+	coalescer           *inference.Coalescer // Shares identical concurrent model calls, optional
+	featureFlags        *flags.Store         // Runtime switches, optional
+	health              *health.Registry
+	dependencies        *health.Checker         // Probes Redis and the providers, optional
+	hooks               *hooks.Manager          // Extension hooks, optional
+	queryStats          *analytics.QueryStats   // Query frequency counters, optional
+	faq                 *faq.Store              // Pinned answers, optional
+	knowledge           *knowledge.Base         // Canonical answers, optional
+	expiry              *cache.ExpiryEstimator  // Per-answer cache TTLs, optional
+	credentials         *credentials.Store      // Keys orgs brought, optional
+	receipts            *receipts.Signer        // Signs answers, optional
+	consistency         *cache.Consistency      // Per-org cache freshness profiles, optional
+	revalidator         *gin.Engine             // Refreshes stale answers, set with consistency
+	revalidations       *supervisor.Pool        // Runs the refreshes, set with consistency
+	revalidating        sync.Map                // Cache keys being refreshed
+	rateLimiter         *middleware.RateLimiter // Charges refreshes to the user's token quota, optional
+	moderator           *moderation.Moderator   // Screens queries before routing, optional
+	thresholdTuner      *cache.ThresholdTuner   // Tunes similarityThreshold from feedback, optional
+	ladder              *degradation.Ladder     // Degrades service under spend, outages or load, optional
+	bandit              *bandit.Bandit          // Picks the SLM model, given ratings of its answers, optional
 }
 
+// revalidateTimeout bounds the background refresh of a stale answer
+const revalidateTimeout = 2 * time.Minute
+
 func NewInferenceHandler(
 	r *router.QueryRouter,
 	slm models.SLMInferencer, // Changed to interface
 	llm models.LLMInferencer, // Changed to interface
 	c models.CacheStore, // Changed to interface
 ) *InferenceHandler {
+	modelRegistry := registry.NewModelRegistry(nil)
+
 	return &InferenceHandler{
 		router:              r,
 		slmEngine:           slm,
@@ -37,6 +98,9 @@ func NewInferenceHandler(
 		semanticCache:       nil, // Will be set via SetSemanticCache if enabled
 		useSemanticCache:    false,
 		similarityThreshold: 0.85,
+		modelRegistry:       modelRegistry,
+		promptGuard:         inference.NewPromptGuard(modelRegistry),
+		continuer:           inference.NewContinuer(config.ContinuationConfig{}),
 	}
 }
 
@@ -53,93 +117,423 @@ func (h *InferenceHandler) SetModelNames(llmModel, slmModel string) {
 	h.slmModelName = slmModel
 }
 
+// SetModelRegistry replaces the built-in model registry used for prompt sizing and validation
+func (h *InferenceHandler) SetModelRegistry(modelRegistry *registry.ModelRegistry) {
+	h.modelRegistry = modelRegistry
+	h.promptGuard = inference.NewPromptGuard(modelRegistry)
+}
+
+// SetStreamBuffer makes SSE responses resumable: events are buffered in Redis
+// and can be replayed with Last-Event-ID
+func (h *InferenceHandler) SetStreamBuffer(buffer *streaming.Buffer) {
+	h.streamBuffer = buffer
+}
+
+// SetStreamPacing sends streamed tokens at most tokensPerSecond, after a
+// first burst of burst tokens
+func (h *InferenceHandler) SetStreamPacing(tokensPerSecond float64, burst int) {
+	h.streamRate = tokensPerSecond
+	h.streamBurst = burst
+}
+
+// SetUsageStore records every request's cost metrics in the user's usage ledger
+func (h *InferenceHandler) SetUsageStore(store *usage.Store) {
+	h.usageStore = store
+}
+
+// SetSpendCaps adds what every request cost to the spend of the provider key
+// it used
+func (h *InferenceHandler) SetSpendCaps(caps *usage.SpendCaps) {
+	h.spendCaps = caps
+}
+
+// SetFailover enables the per-tier circuit breakers and LLM<->SLM failover
+func (h *InferenceHandler) SetFailover(llmBreaker, slmBreaker *inference.CircuitBreaker) {
+	h.llmBreaker = llmBreaker
+	h.slmBreaker = slmBreaker
+	h.failover = true
+}
+
+// SetCoalescer makes identical concurrent requests share one model call
+func (h *InferenceHandler) SetCoalescer(coalescer *inference.Coalescer) {
+	h.coalescer = coalescer
+}
+
+// SetFeatureFlags lets runtime flags switch off the semantic cache and the LLM tier
+func (h *InferenceHandler) SetFeatureFlags(store *flags.Store) {
+	h.featureFlags = store
+}
+
+// SetHealthRegistry makes the health check report the status of optional subsystems
+func (h *InferenceHandler) SetHealthRegistry(registry *health.Registry) {
+	h.health = registry
+}
+
+// SetDependencyChecker makes the health check probe the service's dependencies
+func (h *InferenceHandler) SetDependencyChecker(checker *health.Checker) {
+	h.dependencies = checker
+}
+
+// SetHooks runs custom extension hooks at the pre-route, post-route,
+// pre-cache and post-response stages
+func (h *InferenceHandler) SetHooks(manager *hooks.Manager) {
+	h.hooks = manager
+}
+
+// SetQueryStats counts every query for the admin top-queries report
+func (h *InferenceHandler) SetQueryStats(stats *analytics.QueryStats) {
+	h.queryStats = stats
+}
+
+// SetFAQ serves approved pinned answers without calling a model
+func (h *InferenceHandler) SetFAQ(store *faq.Store) {
+	h.faq = store
+}
+
+// SetExpiryEstimator caches each answer for as long as it is expected to stay valid
+func (h *InferenceHandler) SetExpiryEstimator(estimator *cache.ExpiryEstimator) {
+	h.expiry = estimator
+}
+
+// SetKnowledgeBase serves canonical answers ahead of pinned answers, caches and models
+func (h *InferenceHandler) SetKnowledgeBase(base *knowledge.Base) {
+	h.knowledge = base
+}
+
+// SetContinuation sets the budget for continuing truncated answers on "complete" requests
+func (h *InferenceHandler) SetContinuation(cfg config.ContinuationConfig) {
+	h.continuer = inference.NewContinuer(cfg)
+}
+
+// SetCredentials makes model calls use the provider keys of the caller's org
+func (h *InferenceHandler) SetCredentials(store *credentials.Store) {
+	h.credentials = store
+}
+
+// SetConsistency applies each org's consistency profile to cached answers:
+// how long they are served, how close semantic matches must be, and whether
+// stale ones are served while they are refreshed in the background, by
+// revalidations. Refreshes are charged to the token quota of the user the
+// stale answer was served to (see SetRateLimiter).
+func (h *InferenceHandler) SetConsistency(consistency *cache.Consistency, revalidations *supervisor.Pool) {
+	h.consistency = consistency
+	h.revalidations = revalidations
+	h.revalidator = gin.New()
+	h.revalidator.Use(middleware.InternalCaller(), func(c *gin.Context) {
+		h.rateLimiter.Quota(c)
+	})
+	h.revalidator.POST("/", func(c *gin.Context) {
+		c.Set(skipCachedKey, true)
+		h.HandleInference(c)
+	})
+}
+
+// SetRateLimiter charges the background refreshes of stale answers to the
+// daily token quota of their users, and skips them once it's used up
+func (h *InferenceHandler) SetRateLimiter(limiter *middleware.RateLimiter) {
+	h.rateLimiter = limiter
+}
+
+// SetThresholdTuner tunes the semantic cache's similarity threshold from
+// ratings of its hits, which are given IDs to rate them by
+func (h *InferenceHandler) SetThresholdTuner(tuner *cache.ThresholdTuner) {
+	h.thresholdTuner = tuner
+}
+
+// SetDegradation steps service down the degradation ladder as spend,
+// outages or load demand, and reports the level in health and responses
+func (h *InferenceHandler) SetDegradation(ladder *degradation.Ladder) {
+	h.ladder = ladder
+}
+
+// SetBandit gives answers from the model the SLM bandit picked an ID to rate
+// them by
+func (h *InferenceHandler) SetBandit(b *bandit.Bandit) {
+	h.bandit = b
+}
+
+// SetModerator screens queries for disallowed content before routing
+func (h *InferenceHandler) SetModerator(moderator *moderation.Moderator) {
+	h.moderator = moderator
+}
+
+// SetReceipts attaches a signed receipt to every answer
+func (h *InferenceHandler) SetReceipts(signer *receipts.Signer) {
+	h.receipts = signer
+}
+
 func (h *InferenceHandler) HandleInference(c *gin.Context) {
 	var req models.InferenceRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := req.ValidateMetadata(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	middleware.SetRequestMetadata(c, req.Metadata)
 
+	req.UserID = middleware.GetUserID(c)
 	startTime := time.Now()
+	noCache, ok := bypassCache(c)
+	if !ok {
+		return
+	}
+	if !useOrgKeys(c, h.credentials) {
+		return
+	}
+	release := h.ladder.Enter()
+	defer release()
+	service := degrade(c, h.ladder)
+
+	var stream *sseStream
+	if req.Stream {
+		stream = newResumableSSEStream(c, h.streamBuffer, req.UserID)
+		stream.pacer = streamPacer(c, h.streamRate, h.streamBurst)
+		defer stream.drain()
+	}
+
+	if service.Level == degradation.LevelMaintenance {
+		answer := maintenanceResponse(h.ladder, startTime)
+		writeResult(c, stream, answer.Response, answer)
+		return
+	}
+
+	hookPayload := &hooks.Payload{UserID: middleware.GetUserID(c), Request: &req}
+	if !runHooks(c, stream, h.hooks, hooks.PreRoute, hookPayload) {
+		return
+	}
+	if !moderate(c, stream, h.moderator, requestTexts(&req)...) {
+		return
+	}
+	recordQuery(c, h.queryStats, req.Query)
+
+	// Knowledge base answers take priority over pinned ones
+	static := lookupKnowledgeAnswer(c, h.knowledge, &req, startTime)
+	if static == nil {
+		static = lookupPinnedAnswer(c, h.faq, &req, startTime)
+	}
+	if static != nil {
+		hookPayload.Response = static
+		if !runHooks(c, stream, h.hooks, hooks.PostResponse, hookPayload) {
+			return
+		}
+
+		recordUsage(c, h.usageStore, static.CostMetrics, true)
+		h.receipts.InferenceReceipt(req.UserID, req.Query, static)
+		writeResult(c, stream, static.Response, static)
+		return
+	}
+
+	// Similar queries with other tools don't share answers
+	useSemanticCache := h.useSemanticCache && h.semanticCache != nil && len(req.Tools) == 0 &&
+		!h.featureFlags.EnabledFor(c.Request.Context(), flags.DisableSemanticCache, middleware.GetUserID(c))
+
+	// Cached answers generated with other prompts are misses
+	promptVersion := inference.PromptVersion(&req)
+
+	// Canary requests are always answered by the models
+	skipCached := noCache || c.GetBool(skipCachedKey)
+
+	cacheKey := h.router.GenerateCacheKey(&req)
+	profile := h.consistency.Profile(c.Request.Context(), req.UserID)
 
 	// Check semantic cache first if enabled
-	if h.useSemanticCache && h.semanticCache != nil {
-		semanticResult, err := h.semanticCache.GetSimilar(c.Request.Context(), req.Query, h.similarityThreshold)
-		if err == nil && semanticResult != nil {
+	if useSemanticCache && !skipCached {
+		threshold := h.similarityThreshold
+		if h.thresholdTuner != nil {
+			threshold = h.thresholdTuner.Threshold(c.Request.Context())
+		}
+		threshold = profile.Threshold(threshold)
+		semanticResult, err := h.semanticCache.GetSimilar(c.Request.Context(), req.Query, threshold)
+		if err == nil && semanticResult != nil && semanticResult.Response.PromptVersion == promptVersion &&
+			h.servable(c, profile, semanticResult.Response, req, cacheKey) {
 			// Found a semantically similar cached response
 			semanticResult.Response.CacheHit = true
 			semanticResult.Response.Latency = time.Since(startTime)
 			semanticResult.Response.RoutingReason = semanticResult.Response.RoutingReason +
 				" (semantic cache hit, similarity: " + formatFloat(semanticResult.Similarity) + ")"
+			h.recordSemanticHit(c.Request.Context(), req.UserID, semanticResult, threshold)
 
 			// Recalculate cost metrics for cache hit (if not already present)
 			if semanticResult.Response.CostMetrics == nil {
-				specificModel := h.llmModelName
-				if semanticResult.Response.ModelUsed != "cloud-llm" {
-					specificModel = h.slmModelName
-				}
+				tier, specificModel := h.cachedModel(semanticResult.Response)
 				semanticResult.Response.CostMetrics = utils.CalculateCostMetrics(
 					req.Query,
 					semanticResult.Response.Response,
-					semanticResult.Response.ModelUsed,
+					tier,
 					specificModel,
 					true, // cache hit
-					h.useSemanticCache,
+					useSemanticCache,
 				)
 			}
 
-			c.JSON(http.StatusOK, semanticResult.Response)
+			hookPayload.Response = semanticResult.Response
+			if !runHooks(c, stream, h.hooks, hooks.PostResponse, hookPayload) {
+				return
+			}
+
+			recordUsage(c, h.usageStore, semanticResult.Response.CostMetrics, true)
+			h.receipts.InferenceReceipt(req.UserID, req.Query, semanticResult.Response)
+			writeResult(c, stream, semanticResult.Response.Response, semanticResult.Response)
 			return
 		}
 	}
 
 	// Fall back to exact cache check
-	cacheKey := h.router.GenerateCacheKey(&req)
-	cachedResp, err := h.cache.Get(c.Request.Context(), cacheKey)
-	if err == nil && cachedResp != nil {
+	var cachedResp *models.InferenceResponse
+	var err error
+	if !skipCached {
+		cachedResp, err = h.cache.Get(c.Request.Context(), cacheKey)
+	}
+	if err == nil && cachedResp != nil && cachedResp.PromptVersion == promptVersion && h.servable(c, profile, cachedResp, req, cacheKey) {
 		cachedResp.CacheHit = true
 		cachedResp.Latency = time.Since(startTime)
 
 		// Recalculate cost metrics for cache hit (if not already present)
 		if cachedResp.CostMetrics == nil {
-			specificModel := h.llmModelName
-			if cachedResp.ModelUsed != "cloud-llm" {
-				specificModel = h.slmModelName
-			}
+			tier, specificModel := h.cachedModel(cachedResp)
 			cachedResp.CostMetrics = utils.CalculateCostMetrics(
 				req.Query,
 				cachedResp.Response,
-				cachedResp.ModelUsed,
+				tier,
 				specificModel,
 				true, // cache hit
-				h.useSemanticCache,
+				useSemanticCache,
 			)
 		}
 
-		c.JSON(http.StatusOK, cachedResp)
+		hookPayload.Response = cachedResp
+		if !runHooks(c, stream, h.hooks, hooks.PostResponse, hookPayload) {
+			return
+		}
+
+		recordUsage(c, h.usageStore, cachedResp.CostMetrics, true)
+		h.receipts.InferenceReceipt(req.UserID, req.Query, cachedResp)
+		writeResult(c, stream, cachedResp.Response, cachedResp)
+		return
+	}
+
+	if !rejectUncached(c, stream, service) {
 		return
 	}
 
 	// Route query
 	decision, err := h.router.Route(c.Request.Context(), &req)
+	if errors.Is(err, router.ErrNoCompliantModel) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, router.ErrNoCapableModel) || errors.Is(err, router.ErrUnknownModel) || errors.Is(err, router.ErrCostBudgetExceeded) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, usage.ErrSpendCapReached) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "routing failed"})
 		return
 	}
 
+	hookPayload.Decision = decision
+	if !runHooks(c, stream, h.hooks, hooks.PostRoute, hookPayload) {
+		return
+	}
+	middleware.SetRoutingDecision(c, decision)
+
+	llmDisabled := h.llmClient == nil || h.featureFlags.EnabledFor(c.Request.Context(), flags.DisableLLM, middleware.GetUserID(c)) ||
+		degradation.Reaches(service.Level, degradation.LevelSLMOnly)
+	if llmDisabled {
+		if err := avoidDisabledLLM(decision); err != nil {
+			writeError(c, stream, http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
 	var response string
 	var modelUsed string
+	var promptTrim *models.PromptTrimInfo
+	var slmResult *models.SLMResult
+	var continuation *models.ContinuationInfo
+	var fallback *models.FallbackInfo
 
-	if decision.UseLLM {
-		response, err = h.llmClient.Infer(c.Request.Context(), &req)
-		modelUsed = "cloud-llm"
-	} else {
-		response, err = h.slmEngine.Infer(c.Request.Context(), &req)
-		modelUsed = "edge-slm"
+	generationCtx, stopGeneration := stream.generationContext(c.Request.Context())
+	defer stopGeneration()
+	inferCtx, providerMetadata := inference.WithProviderMetadata(generationCtx)
+	inferCtx, toolCalls := inference.WithToolCalls(inferCtx)
+
+	runTier := func(useLLM bool) (string, *models.PromptTrimInfo, error) {
+		req.TargetModel = targetModel(decision, useLLM)
+		if useLLM {
+			model := modelOrDefault(req.TargetModel, h.llmModelName)
+			clampMaxTokens(&req, h.modelRegistry, model)
+			infer := inferFunc(h.coalescer.WrapLLM(tierName(true), h.llmClient).Infer)
+			if stream != nil {
+				infer = stream.infer(h.llmClient, infer)
+			}
+			infer = observeLatency(h.router, infer)
+			infer = h.llmBreaker.Wrap(infer)
+			infer = h.continuer.Wrap(infer, func() string { return model }, &continuation)
+			return h.promptGuard.Run(inferCtx, &req, model, infer)
+		}
+
+		model := modelOrDefault(req.TargetModel, h.slmModelName)
+		clampMaxTokens(&req, h.modelRegistry, model)
+		infer := slmInfer(h.coalescer.WrapSLM(tierName(false), h.slmEngine), &slmResult)
+		if stream != nil {
+			infer = stream.inferSLM(h.slmEngine, infer, &slmResult)
+		}
+		infer = h.slmBreaker.Wrap(infer)
+		infer = h.continuer.Wrap(infer, func() string { return selectedSLM(slmResult, model) }, &continuation)
+		return h.promptGuard.Run(inferCtx, &req, model, infer)
+	}
+
+	useLLM := decision.UseLLM
+	response, promptTrim, err = runTier(useLLM)
+
+	// Fail over to the other tier when the routed provider is down
+	if h.failover && canFailOver(decision, stream, err) && (useLLM || !llmDisabled) {
+		fallback = newFallback(useLLM, err)
+		log.Printf("⚠️  %s failed, falling back to %s: %v", fallback.From, fallback.To, err)
+
+		fallbackResponse, fallbackTrim, fallbackErr := runTier(!useLLM)
+		if fallbackErr == nil {
+			useLLM = !useLLM
+			response, promptTrim, err = fallbackResponse, fallbackTrim, nil
+			decision.Reason = fmt.Sprintf("%s (fallback from %s)", decision.Reason, fallback.From)
+		} else {
+			fallback = nil
+		}
 	}
 
+	tier := tierName(useLLM)
+	modelUsed = modelOrDefault(req.TargetModel, h.llmModelName)
+	if !useLLM {
+		modelUsed = selectedSLM(slmResult, modelOrDefault(req.TargetModel, h.slmModelName))
+	}
+
+	var blocked *privacy.BlockedError
+	if errors.As(err, &blocked) {
+		writeError(c, stream, http.StatusBadRequest, gin.H{"error": err.Error(), "pii": blocked.Kinds})
+		return
+	}
+	if errors.Is(err, inference.ErrPromptTooLarge) {
+		writeError(c, stream, http.StatusRequestEntityTooLarge, gin.H{
+			"error":       err.Error(),
+			"model":       modelUsed,
+			"prompt_trim": promptTrim,
+		})
+		return
+	}
+	if stream.cancelled() {
+		writeError(c, stream, http.StatusConflict, gin.H{"error": "Stream cancelled"})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
+		writeError(c, stream, http.StatusInternalServerError, gin.H{
 			"error":   err.Error(),
 			"model":   modelUsed,
 			"routing": decision.Reason,
@@ -147,42 +541,255 @@ func (h *InferenceHandler) HandleInference(c *gin.Context) {
 		return
 	}
 
-	// Determine specific model name
-	specificModel := h.llmModelName
-	if !decision.UseLLM {
-		specificModel = h.slmModelName
-	}
-
-	// Calculate cost metrics
+	// Calculate cost metrics, pricing the model whose answer was actually returned
 	costMetrics := utils.CalculateCostMetrics(
 		req.Query,
 		response,
+		tier,
 		modelUsed,
-		specificModel,
 		false, // not a cache hit
-		h.useSemanticCache,
+		useSemanticCache,
 	)
+	if slmResult != nil && len(slmResult.ModelsUsed) > 1 {
+		costMetrics.EnsembleModels = slmResult.ModelsUsed
+	}
+	if slmResult != nil && len(slmResult.Usage) > 1 {
+		utils.ApplyEnsembleBreakdown(costMetrics, slmResult.Usage)
+	} else if reported := providerMetadata.For(modelUsed); reported != nil {
+		utils.ApplyReportedUsage(costMetrics, tier, reported.InputTokens, reported.OutputTokens)
+	}
+	middleware.AddTokenUsage(c, costMetrics.TotalTokens)
 
 	result := &models.InferenceResponse{
 		Response:      response,
 		ModelUsed:     modelUsed,
+		Tier:          tier,
 		RoutingReason: decision.Reason,
 		Latency:       time.Since(startTime),
 		CacheHit:      false,
 		Timestamp:     time.Now(),
 		CostMetrics:   costMetrics,
+		Fallback:      fallback,
+		ToolCalls:     toolCalls.For(modelUsed),
+	}
+	provider := providerMetadata.For(modelUsed)
+	if promptTrim != nil || slmResult != nil || provider != nil || continuation != nil {
+		result.Metadata = &models.ResponseMetadata{
+			PromptTrim:   promptTrim,
+			SLM:          slmResult,
+			Provider:     provider,
+			Continuation: continuation,
+		}
+		if slmResult != nil {
+			result.Metadata.Judge = slmResult.Judge
+		}
 	}
 
-	// Cache the response
-	if h.useSemanticCache && h.semanticCache != nil {
-		// Store with embedding for semantic similarity search
-		_ = h.semanticCache.SetWithEmbedding(c.Request.Context(), cacheKey, req.Query, result)
-	} else {
+	result.Expiry = h.expiry.Estimate(c.Request.Context(), req.Query, result.Response)
+	result.PromptVersion = promptVersion
+	result.Retention = h.consistency.Retention(result)
+
+	hookPayload.Response = result
+	if !runHooks(c, stream, h.hooks, hooks.PreCache, hookPayload) {
+		return
+	}
+
+	// Cache the response, unless asked not to
+	switch {
+	case noCache:
+	case useSemanticCache:
+		// Store with embedding for semantic similarity search, or with the
+		// exact key only if the semantic cache is unavailable
+		if err := h.semanticCache.SetWithEmbedding(c.Request.Context(), cacheKey, req.Query, result); err != nil {
+			_ = h.cache.Set(c.Request.Context(), cacheKey, result)
+		}
+	default:
 		// Store with exact key only
 		_ = h.cache.Set(c.Request.Context(), cacheKey, result)
 	}
 
-	c.JSON(http.StatusOK, result)
+	if !runHooks(c, stream, h.hooks, hooks.PostResponse, hookPayload) {
+		return
+	}
+
+	recordUsage(c, h.usageStore, costMetrics, false)
+	recordSpend(c, h.spendCaps, useLLM, costMetrics)
+	if !useLLM {
+		recordBanditAnswer(c, h.bandit, slmResult)
+	}
+	h.receipts.InferenceReceipt(req.UserID, req.Query, result)
+	writeResult(c, stream, result.Response, result)
+}
+
+// recordSemanticHit notes a hit's similarity in the response's metadata and,
+// when the threshold is tuned, the ID to rate the reused answer by
+func (h *InferenceHandler) recordSemanticHit(ctx context.Context, userID string, result *models.SemanticCacheResult, threshold float64) {
+	hit := &models.SemanticHit{Similarity: result.Similarity, Threshold: threshold}
+	if h.thresholdTuner != nil {
+		hitID, err := h.thresholdTuner.RecordHit(ctx, userID)
+		if err != nil {
+			log.Printf("Failed to record semantic cache hit for feedback: %v", err)
+		}
+		hit.ID = hitID
+	}
+	if result.Response.Metadata == nil {
+		result.Response.Metadata = &models.ResponseMetadata{}
+	}
+	result.Response.Metadata.SemanticHit = hit
+}
+
+// servable reports whether a cached answer may be served under the user's
+// consistency profile. Stale answers are, marked as such, while a new answer
+// to req is generated in the background for the caller.
+func (h *InferenceHandler) servable(c *gin.Context, profile *cache.ConsistencyProfile, cached *models.InferenceResponse, req models.InferenceRequest, cacheKey string) bool {
+	switch profile.Freshness(cached, time.Now()) {
+	case cache.Fresh:
+		return true
+	case cache.Stale:
+		cached.Stale = true
+		h.revalidate(middleware.GetCaller(c), req, cacheKey)
+		return true
+	default:
+		return false
+	}
+}
+
+// revalidate answers req again in the background for caller, skipping the
+// caches, so its new answer replaces the stale one. It runs with the caller's
+// scopes and org keys, within their spend caps and token quota. Only one
+// refresh per cache key runs at a time on each instance, and none start
+// while the pool is full.
+func (h *InferenceHandler) revalidate(caller middleware.Caller, req models.InferenceRequest, cacheKey string) {
+	if h.revalidator == nil {
+		return
+	}
+	if _, running := h.revalidating.LoadOrStore(cacheKey, true); running {
+		return
+	}
+	req.Stream = false
+
+	started := h.revalidations.TryGo(func() {
+		defer h.revalidating.Delete(cacheKey)
+		ctx, cancel := context.WithTimeout(context.Background(), revalidateTimeout)
+		defer cancel()
+
+		if status, _ := serveInternal(ctx, h.revalidator, "/", &middleware.InternalCall{Caller: caller}, req); status != http.StatusOK {
+			log.Printf("Failed to refresh stale cached answer %s: status %d", cacheKey, status)
+		}
+	})
+	if !started {
+		h.revalidating.Delete(cacheKey)
+	}
+}
+
+// cachedModel returns the tier and model of a cached response. Entries cached
+// before responses carried a tier used the tier label as ModelUsed.
+func (h *InferenceHandler) cachedModel(resp *models.InferenceResponse) (string, string) {
+	if resp.Tier != "" {
+		return resp.Tier, resp.ModelUsed
+	}
+	if resp.ModelUsed == tierName(true) {
+		return resp.ModelUsed, h.llmModelName
+	}
+	return resp.ModelUsed, h.slmModelName
+}
+
+// slmInfer adapts the SLM engine to an inferFunc, keeping the engine's result
+// so handlers can report the selected model, latencies and per-model usage.
+// Results of follow-up calls (continuations) are merged into the first one.
+func slmInfer(engine models.SLMInferencer, result **models.SLMResult) inferFunc {
+	return func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		res, err := engine.Infer(ctx, req)
+		if err != nil {
+			return "", err
+		}
+		keepSLMResult(result, res)
+		return res.Response, nil
+	}
+}
+
+// keepSLMResult keeps an SLM call's result, merging it into the first one's
+func keepSLMResult(result **models.SLMResult, res *models.SLMResult) {
+	if *result == nil {
+		*result = res
+	} else {
+		mergeSLMResult(*result, res)
+	}
+}
+
+// observeLatency feeds the duration of successful LLM calls to the router's latency budget
+func observeLatency(r *router.QueryRouter, infer inferFunc) inferFunc {
+	return func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		start := time.Now()
+		response, err := infer(ctx, req)
+		if err == nil {
+			r.ObserveLLMLatency(time.Since(start))
+		}
+		return response, err
+	}
+}
+
+// mergeSLMResult folds a follow-up call's models, latencies and usage into result
+func mergeSLMResult(result *models.SLMResult, next *models.SLMResult) {
+	result.SelectedModel = next.SelectedModel
+	for _, model := range next.ModelsUsed {
+		if !slices.Contains(result.ModelsUsed, model) {
+			result.ModelsUsed = append(result.ModelsUsed, model)
+		}
+	}
+	if result.ModelLatencies == nil {
+		result.ModelLatencies = make(map[string]int64)
+	}
+	for model, latency := range next.ModelLatencies {
+		result.ModelLatencies[model] += latency
+	}
+	for _, usage := range next.Usage {
+		merged := false
+		for i := range result.Usage {
+			if result.Usage[i].Model == usage.Model {
+				result.Usage[i].Calls += usage.Calls
+				result.Usage[i].InputTokens += usage.InputTokens
+				result.Usage[i].OutputTokens += usage.OutputTokens
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			result.Usage = append(result.Usage, usage)
+		}
+	}
+}
+
+// selectedSLM returns the model whose answer the SLM engine returned, or fallback before any call
+func selectedSLM(result *models.SLMResult, fallback string) string {
+	if result != nil && result.SelectedModel != "" {
+		return result.SelectedModel
+	}
+	return fallback
+}
+
+// targetModel returns the routing target for a tier: the router's pick for
+// the tier it chose, the tier default ("") when failing over to the other one
+func targetModel(decision *models.RoutingDecision, useLLM bool) string {
+	if useLLM != decision.UseLLM {
+		return ""
+	}
+	return decision.Model
+}
+
+// modelOrDefault returns model, or fallback if it's empty
+func modelOrDefault(model string, fallback string) string {
+	if model != "" {
+		return model
+	}
+	return fallback
+}
+
+// clampMaxTokens caps the requested output length at the model's registered limit
+func clampMaxTokens(req *models.InferenceRequest, modelRegistry *registry.ModelRegistry, model string) {
+	if limit := modelRegistry.MaxOutputTokens(model); limit > 0 && req.MaxTokens > limit {
+		req.MaxTokens = limit
+	}
 }
 
 // formatFloat formats a float64 to 3 decimal places
@@ -191,8 +798,44 @@ func formatFloat(f float64) string {
 }
 
 func (h *InferenceHandler) HealthCheck(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	report := gin.H{
 		"status":    "healthy",
 		"timestamp": time.Now(),
-	})
+	}
+	if h.failover {
+		report["circuits"] = gin.H{
+			h.llmBreaker.Name(): h.llmBreaker.State(),
+			h.slmBreaker.Name(): h.slmBreaker.State(),
+		}
+	}
+	if h.featureFlags.Enabled(c.Request.Context(), flags.MaintenanceMode) {
+		report["maintenance_mode"] = true
+	}
+	if h.ladder != nil {
+		service := h.ladder.Status()
+		report["degradation"] = service
+		if service.Level != degradation.LevelFull {
+			report["status"] = "degraded"
+		}
+	}
+	if h.health != nil {
+		report["components"] = h.health.Snapshot()
+		if h.health.Degraded() {
+			report["status"] = "degraded"
+		}
+	}
+	status := http.StatusOK
+	if h.dependencies != nil {
+		dependencies := h.dependencies.Check(c.Request.Context())
+		report["dependencies"] = dependencies
+		switch {
+		case !health.Ready(dependencies):
+			report["status"] = "unhealthy"
+			status = http.StatusServiceUnavailable
+		case !health.AllUp(dependencies):
+			report["status"] = "degraded"
+		}
+	}
+
+	c.JSON(status, report)
 }
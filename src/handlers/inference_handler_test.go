@@ -2,20 +2,37 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/degradation"
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/hooks"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
 	"www.github.com/Wanderer0074348/HybridLM/src/mocks"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/moderation"
+	"www.github.com/Wanderer0074348/HybridLM/src/privacy"
 	"www.github.com/Wanderer0074348/HybridLM/src/router"
+	"www.github.com/Wanderer0074348/HybridLM/src/supervisor"
 )
 
 func setupTestHandler() (*InferenceHandler, *mocks.MockLLMClient, *mocks.MockSLMEngine, *mocks.MockCache) {
@@ -29,8 +46,9 @@ func setupTestHandler() (*InferenceHandler, *mocks.MockLLMClient, *mocks.MockSLM
 		ComplexityThreshold: 0.65,
 	}
 	queryRouter := router.NewQueryRouter(cfg)
-	
+
 	handler := NewInferenceHandler(queryRouter, mockSLM, mockLLM, mockCache)
+	handler.SetModelNames("gpt-3.5-turbo", "llama-3.1-8b-instant")
 
 	return handler, mockLLM, mockSLM, mockCache
 }
@@ -39,7 +57,7 @@ func TestInferenceHandler_SimpleQuery(t *testing.T) {
 	handler, _, mockSLM, mockCache := setupTestHandler()
 
 	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
-	mockSLM.On("Infer", mock.Anything, mock.Anything).Return("4", nil)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
 	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
 
 	reqBody := models.InferenceRequest{
@@ -61,8 +79,12 @@ func TestInferenceHandler_SimpleQuery(t *testing.T) {
 	json.Unmarshal(w.Body.Bytes(), &response)
 
 	assert.Equal(t, "4", response.Response)
-	assert.Equal(t, "edge-slm", response.ModelUsed)
+	assert.Equal(t, "llama-3.1-8b-instant", response.ModelUsed)
+	assert.Equal(t, "edge-slm", response.Tier)
 	assert.False(t, response.CacheHit)
+	if assert.NotNil(t, response.Metadata) && assert.NotNil(t, response.Metadata.SLM) {
+		assert.Equal(t, "llama-3.1-8b-instant", response.Metadata.SLM.SelectedModel)
+	}
 
 	mockSLM.AssertExpectations(t)
 	mockCache.AssertExpectations(t)
@@ -94,7 +116,8 @@ func TestInferenceHandler_ComplexQuery(t *testing.T) {
 	var response models.InferenceResponse
 	json.Unmarshal(w.Body.Bytes(), &response)
 
-	assert.Equal(t, "cloud-llm", response.ModelUsed)
+	assert.Equal(t, "gpt-3.5-turbo", response.ModelUsed)
+	assert.Equal(t, "cloud-llm", response.Tier)
 
 	mockLLM.AssertExpectations(t)
 	mockCache.AssertExpectations(t)
@@ -109,6 +132,7 @@ func TestInferenceHandler_CacheHit(t *testing.T) {
 		RoutingReason: "Simple query",
 		Latency:       50 * time.Millisecond,
 		Timestamp:     time.Now(),
+		PromptVersion: inference.PromptVersion(&models.InferenceRequest{}),
 	}
 
 	mockCache.On("Get", mock.Anything, mock.Anything).Return(cachedResponse, nil)
@@ -132,6 +156,110 @@ func TestInferenceHandler_CacheHit(t *testing.T) {
 	assert.Equal(t, "Cached answer", response.Response)
 }
 
+func TestInferenceHandler_StaleCachedPromptVersion(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+
+	cachedResponse := &models.InferenceResponse{
+		Response:      "Answer from old prompts",
+		ModelUsed:     "edge-slm",
+		Timestamp:     time.Now(),
+		PromptVersion: "t1",
+	}
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(cachedResponse, nil)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.MatchedBy(func(r *models.InferenceResponse) bool {
+		return r.PromptVersion == inference.PromptVersion(&models.InferenceRequest{})
+	})).Return(nil)
+
+	reqBody := models.InferenceRequest{Query: "What is 2+2?"}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.HandleInference(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.InferenceResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	assert.False(t, response.CacheHit)
+	assert.Equal(t, "4", response.Response)
+	mockCache.AssertExpectations(t)
+}
+
+// setupRevalidation serves the balanced consistency profile to every user,
+// refreshing stale answers within a daily quota of 1000 tokens
+func setupRevalidation(t *testing.T, handler *InferenceHandler) (*supervisor.Supervisor, *miniredis.Miniredis) {
+	consistency, err := cache.NewConsistency(config.ConsistencyConfig{Default: cache.ProfileBalanced}, time.Hour)
+	require.NoError(t, err)
+	workers := supervisor.New(config.SupervisorConfig{})
+	handler.SetConsistency(consistency, workers.NewPool("revalidate", 1))
+
+	mr := miniredis.RunT(t)
+	limiter := middleware.NewRateLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()}), &config.RateLimitConfig{TokensPerDay: 1000})
+	limiter.SetClock(clock.NewFake(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)))
+	handler.SetRateLimiter(limiter)
+	return workers, mr
+}
+
+func serveStale(handler *InferenceHandler, mockCache *mocks.MockCache) *httptest.ResponseRecorder {
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(&models.InferenceResponse{
+		Response:      "Old answer",
+		ModelUsed:     "llama-3.1-8b-instant",
+		Tier:          "edge-slm",
+		Timestamp:     time.Now().Add(-62 * time.Minute),
+		PromptVersion: inference.PromptVersion(&models.InferenceRequest{}),
+	}, nil)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", strings.NewReader(`{"query": "What is 2+2?"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	middleware.SetUserID(c, "alice")
+	handler.HandleInference(c)
+	return w
+}
+
+func TestInferenceHandler_RevalidationChargesCaller(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+	workers, mr := setupRevalidation(t, handler)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	w := serveStale(handler, mockCache)
+	workers.Wait()
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var response models.InferenceResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Stale)
+	assert.Equal(t, "Old answer", response.Response)
+
+	mockCache.AssertCalled(t, "Set", mock.Anything, mock.Anything, mock.MatchedBy(func(r *models.InferenceResponse) bool {
+		return r.Response == "4"
+	}))
+	used, err := mr.Get("ratelimit:tokens:alice:2026-01-15")
+	require.NoError(t, err)
+	assert.NotEqual(t, "0", used)
+}
+
+func TestInferenceHandler_RevalidationWithinQuota(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+	workers, mr := setupRevalidation(t, handler)
+	require.NoError(t, mr.Set("ratelimit:tokens:alice:2026-01-15", "1000"))
+
+	w := serveStale(handler, mockCache)
+	workers.Wait()
+
+	assert.Equal(t, http.StatusOK, w.Code, "the stale answer is still served")
+	mockSLM.AssertNotCalled(t, "Infer", mock.Anything, mock.Anything)
+}
+
 func TestInferenceHandler_InvalidRequest(t *testing.T) {
 	handler, _, _, _ := setupTestHandler()
 
@@ -161,3 +289,478 @@ func TestInferenceHandler_HealthCheck(t *testing.T) {
 
 	assert.Equal(t, "healthy", response["status"])
 }
+
+func TestInferenceHandler_EnsembleModelsAsCalled(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	// A cascade that stopped at its first model, then one that went on
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{
+		Response: "4", SelectedModel: "llama-3.1-8b-instant", ModelsUsed: []string{"llama-3.1-8b-instant"},
+	}, nil).Once()
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{
+		Response: "4", SelectedModel: "gemma2-9b-it", ModelsUsed: []string{"llama-3.1-8b-instant", "gemma2-9b-it"},
+	}, nil).Once()
+
+	do := func() *models.CostMetrics {
+		jsonBody, _ := json.Marshal(models.InferenceRequest{Query: "What is 2+2?"})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.HandleInference(c)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var response models.InferenceResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		require.NotNil(t, response.CostMetrics)
+		return response.CostMetrics
+	}
+
+	assert.Empty(t, do().EnsembleModels)
+	assert.Equal(t, []string{"llama-3.1-8b-instant", "gemma2-9b-it"}, do().EnsembleModels)
+}
+
+func TestInferenceHandler_Streaming(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	reqBody := models.InferenceRequest{
+		Query:  "What is 2+2?",
+		Stream: true,
+	}
+	jsonBody, _ := json.Marshal(reqBody)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.HandleInference(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/event-stream")
+
+	body := w.Body.String()
+	assert.Contains(t, body, "event:token")
+	assert.Contains(t, body, "event:done")
+	assert.Contains(t, body, `"tier":"edge-slm"`)
+}
+
+func TestInferenceHandler_StreamingReportsModel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCache := new(mocks.MockCache)
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	handler := NewInferenceHandler(router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65}), fakes.NewSLM("gemma2-9b-it", "4"), new(mocks.MockLLMClient), mockCache)
+	handler.SetModelNames("gpt-3.5-turbo", "llama-3.1-8b-instant")
+
+	jsonBody, _ := json.Marshal(models.InferenceRequest{Query: "What is 2+2?", Stream: true})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.HandleInference(c)
+
+	// The streamed answer is reported and priced as the model that gave it
+	body := w.Body.String()
+	assert.Contains(t, body, "event:done")
+	assert.Contains(t, body, `"model_used":"gemma2-9b-it"`)
+	assert.Contains(t, body, `"selected_model":"gemma2-9b-it"`)
+	assert.NotContains(t, body, `"ensemble_models"`)
+}
+
+// banditSLM streams answers as from the model the SLM bandit picked
+type banditSLM struct {
+	*fakes.SLM
+	model string
+}
+
+func (s banditSLM) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) error {
+	models.RecordSLMResult(ctx, &models.SLMResult{Response: "4", Strategy: inference.StrategyBandit, SelectedModel: s.model, ModelsUsed: []string{s.model}})
+	return callback("4")
+}
+
+func TestInferenceHandler_StreamingBanditAnswerIsRateable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mockCache := new(mocks.MockCache)
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	slm := banditSLM{SLM: fakes.NewSLM("gemma2-9b-it", "4"), model: "gemma2-9b-it"}
+	handler := NewInferenceHandler(router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65}), slm, new(mocks.MockLLMClient), mockCache)
+	handler.SetModelNames("gpt-3.5-turbo", "llama-3.1-8b-instant")
+	mr := miniredis.RunT(t)
+	handler.SetBandit(bandit.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}), config.SLMBanditConfig{FeedbackWindow: time.Hour},
+		[]config.SLMModelConfig{{Name: "llama-3.1-8b-instant"}, {Name: "gemma2-9b-it"}}))
+
+	jsonBody, _ := json.Marshal(models.InferenceRequest{Query: "What is 2+2?", Stream: true})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+	middleware.SetUserID(c, "alice")
+
+	handler.HandleInference(c)
+
+	body := w.Body.String()
+	done := body[strings.Index(body, "event:done\ndata:")+len("event:done\ndata:"):]
+	var response models.InferenceResponse
+	require.NoError(t, json.Unmarshal([]byte(strings.TrimSpace(done)), &response))
+	assert.Equal(t, "gemma2-9b-it", response.ModelUsed)
+	require.NotNil(t, response.Metadata)
+	require.NotNil(t, response.Metadata.ModelFeedback)
+	assert.Equal(t, "gemma2-9b-it", response.Metadata.ModelFeedback.Model)
+	assert.NotEmpty(t, response.Metadata.ModelFeedback.ID)
+}
+
+func TestInferenceHandler_PacedStreaming(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+	handler.SetStreamPacing(2000, 1)
+	answer := strings.Repeat("word ", 30)
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: answer, SelectedModel: "llama-3.1-8b-instant"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	jsonBody, _ := json.Marshal(models.InferenceRequest{Query: "What is 2+2?", Stream: true})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.HandleInference(c)
+
+	// Every paced token is sent before the final event
+	body := w.Body.String()
+	assert.Equal(t, 30, strings.Count(body, "event:token"))
+	assert.Greater(t, strings.Index(body, "event:done"), strings.LastIndex(body, "event:token"))
+}
+
+func TestInferenceHandler_FailoverToSLM(t *testing.T) {
+	handler, mockLLM, mockSLM, mockCache := setupTestHandler()
+	failover := config.FailoverConfig{FailureThreshold: 1, OpenDuration: time.Minute}
+	handler.SetFailover(inference.NewCircuitBreaker("cloud-llm", failover), inference.NewCircuitBreaker("edge-slm", failover))
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockLLM.On("Infer", mock.Anything, mock.Anything).Return("", errors.New("503 service unavailable")).Once()
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "Edge answer", SelectedModel: "llama-3.1-8b-instant"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	send := func() models.InferenceResponse {
+		jsonBody, _ := json.Marshal(models.InferenceRequest{
+			Query:   "Simple question",
+			Context: "With some context to force LLM routing",
+		})
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+
+		handler.HandleInference(c)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response models.InferenceResponse
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response
+	}
+
+	response := send()
+	assert.Equal(t, "Edge answer", response.Response)
+	assert.Equal(t, "llama-3.1-8b-instant", response.ModelUsed)
+	assert.Equal(t, "edge-slm", response.Tier)
+	if assert.NotNil(t, response.Fallback) {
+		assert.Equal(t, "cloud-llm", response.Fallback.From)
+		assert.Equal(t, "edge-slm", response.Fallback.To)
+	}
+	assert.Contains(t, response.RoutingReason, "fallback from cloud-llm")
+
+	// The LLM circuit is now open, so the next request skips the LLM entirely
+	response = send()
+	assert.Equal(t, "edge-slm", response.Tier)
+	mockLLM.AssertNumberOfCalls(t, "Infer", 1)
+}
+
+func TestInferenceHandler_PrivacyBlock(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLLM := new(mocks.MockLLMClient)
+	mockSLM := new(mocks.MockSLMEngine)
+	mockCache := new(mocks.MockCache)
+	guard, err := privacy.NewGuard(config.PrivacyConfig{Mode: privacy.ModeBlock})
+	require.NoError(t, err)
+	handler := NewInferenceHandler(router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65}), mockSLM, guard.WrapLLM(mockLLM), mockCache)
+	handler.SetModelNames("gpt-3.5-turbo", "llama-3.1-8b-instant")
+	failover := config.FailoverConfig{FailureThreshold: 1, OpenDuration: time.Minute}
+	handler.SetFailover(inference.NewCircuitBreaker("cloud-llm", failover), inference.NewCircuitBreaker("edge-slm", failover))
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+
+	jsonBody, _ := json.Marshal(models.InferenceRequest{
+		Query:   "Why was card 4111 1111 1111 1111 declined?",
+		Context: "With some context to force LLM routing",
+	})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.HandleInference(c)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var rejection struct {
+		PII []string `json:"pii"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &rejection)
+	assert.Equal(t, []string{privacy.KindCreditCard}, rejection.PII)
+	mockLLM.AssertNotCalled(t, "Infer", mock.Anything, mock.Anything)
+	mockSLM.AssertNotCalled(t, "Infer", mock.Anything, mock.Anything)
+}
+
+func TestInferenceHandler_RoutingTarget(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mockLLM := new(mocks.MockLLMClient)
+	mockSLM := new(mocks.MockSLMEngine)
+	mockCache := new(mocks.MockCache)
+
+	queryRouter := router.NewQueryRouter(&config.RouterConfig{
+		ComplexityThreshold: 0.65,
+		Targets: []config.RoutingTargetConfig{
+			{Model: "llama-3.3-70b-versatile", Tier: "slm"},
+		},
+	})
+	handler := NewInferenceHandler(queryRouter, mockSLM, mockLLM, mockCache)
+	handler.SetModelNames("gpt-3.5-turbo", "llama-3.1-8b-instant")
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockSLM.On("Infer", mock.Anything, mock.MatchedBy(func(req *models.InferenceRequest) bool {
+		return req.TargetModel == "llama-3.3-70b-versatile"
+	})).Return(&models.SLMResult{Response: "4", Strategy: "targeted", SelectedModel: "llama-3.3-70b-versatile"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	jsonBody, _ := json.Marshal(models.InferenceRequest{Query: "What is 2+2?"})
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.HandleInference(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.InferenceResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+
+	assert.Equal(t, "llama-3.3-70b-versatile", response.ModelUsed)
+	assert.Equal(t, "edge-slm", response.Tier)
+	assert.Contains(t, response.RoutingReason, "llama-3.3-70b-versatile")
+	mockSLM.AssertExpectations(t)
+}
+
+func TestInferenceHandler_Hooks(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+
+	manager := hooks.NewManager()
+	require.NoError(t, manager.Register(hooks.PreRoute, hooks.Func("blocklist", func(ctx context.Context, p *hooks.Payload) error {
+		if strings.Contains(p.Request.Query, "forbidden") {
+			return hooks.Reject(http.StatusForbidden, "query not allowed")
+		}
+		return nil
+	})))
+	require.NoError(t, manager.Register(hooks.PostResponse, hooks.Func("footer", func(ctx context.Context, p *hooks.Payload) error {
+		p.Response.Response += " [reviewed]"
+		return nil
+	})))
+	handler.SetHooks(manager)
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	do := func(query string) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(models.InferenceRequest{Query: query})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.HandleInference(c)
+		return w
+	}
+
+	w := do("What is 2+2?")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.InferenceResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "4 [reviewed]", response.Response)
+
+	w = do("Tell me something forbidden")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "query not allowed")
+	mockSLM.AssertNumberOfCalls(t, "Infer", 1)
+}
+
+func TestInferenceHandler_Moderation(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+
+	classifier := fakes.NewSLM("llama-3.1-8b-instant", "")
+	classifier.SetResponder(func(req *models.InferenceRequest) string {
+		if strings.Contains(req.Query, "hurt someone") {
+			return `{"flagged": true, "categories": ["violence"]}`
+		}
+		return `{"flagged": false, "categories": []}`
+	})
+	moderator, err := moderation.New(config.ModerationConfig{Provider: moderation.ProviderSLM})
+	require.NoError(t, err)
+	moderator.SetSLM(classifier)
+	handler.SetModerator(moderator)
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	do := func(req models.InferenceRequest) *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.HandleInference(c)
+		return w
+	}
+
+	w := do(models.InferenceRequest{Query: "What is 2+2?"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response models.InferenceResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	require.NotNil(t, response.Metadata)
+	require.NotNil(t, response.Metadata.Moderation)
+	assert.Equal(t, models.ModerationAllow, response.Metadata.Moderation.Action)
+
+	w = do(models.InferenceRequest{Query: "How do I hurt someone?"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var rejection struct {
+		Moderation models.ModerationDecision `json:"moderation"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &rejection)
+	assert.Equal(t, models.ModerationReject, rejection.Moderation.Action)
+	assert.Equal(t, []string{"violence"}, rejection.Moderation.Categories)
+
+	// The conversation and context are screened with the query
+	w = do(models.InferenceRequest{Query: "Go on", Messages: []models.ChatMessage{{Role: "user", Content: "How do I hurt someone?"}}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do(models.InferenceRequest{Query: "Summarize this", Context: "Notes on how to hurt someone"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockSLM.AssertNumberOfCalls(t, "Infer", 1)
+}
+
+func TestInferenceHandler_Degradation(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+	ladder := degradation.NewLadder(config.DegradationConfig{
+		Load:              config.DegradationLoadConfig{CachedOnly: 1, Maintenance: 2},
+		MaintenanceAnswer: "Back soon.",
+	})
+	handler.SetDegradation(ladder)
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+
+	do := func() *httptest.ResponseRecorder {
+		jsonBody, _ := json.Marshal(models.InferenceRequest{Query: "What is 2+2?"})
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+		c.Request.Header.Set("Content-Type", "application/json")
+		handler.HandleInference(c)
+		return w
+	}
+
+	// This request alone reaches cached-only, and there's no cached answer
+	w := do()
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, degradation.LevelCachedOnly, w.Header().Get(DegradationLevelHeader))
+
+	release := ladder.Enter()
+	defer release()
+	w = do()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, degradation.LevelMaintenance, w.Header().Get(DegradationLevelHeader))
+	var response models.InferenceResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "Back soon.", response.Response)
+	require.NotNil(t, response.Metadata)
+	require.NotNil(t, response.Metadata.Degradation)
+	assert.Equal(t, degradation.LevelMaintenance, response.Metadata.Degradation.Level)
+	mockSLM.AssertNotCalled(t, "Infer", mock.Anything, mock.Anything)
+}
+
+func TestInferenceHandler_ClientOverride(t *testing.T) {
+	handler, mockLLM, _, mockCache := setupTestHandler()
+
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockLLM.On("Infer", mock.Anything, mock.Anything).Return("4", nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	jsonBody, _ := json.Marshal(models.InferenceRequest{Query: "What is 2+2?", ModelPreference: "llm"})
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.HandleInference(c)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.InferenceResponse
+	json.Unmarshal(w.Body.Bytes(), &response)
+	assert.Equal(t, "cloud-llm", response.Tier)
+	assert.Equal(t, "Client override: llm", response.RoutingReason)
+
+	jsonBody, _ = json.Marshal(map[string]string{"query": "hi", "model_preference": "gpu"})
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/api/v1/inference", bytes.NewBuffer(jsonBody))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	handler.HandleInference(c)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestCanaryRunner_SkipsCachedAnswers(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+
+	run := NewCanaryRunner(handler, "canary")
+	response, err := run(context.Background(), models.InferenceRequest{Query: "What is 2+2?"})
+	require.NoError(t, err)
+	assert.Equal(t, "4", response.Response)
+	assert.False(t, response.CacheHit)
+	mockCache.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+}
+
+func TestInferenceHandler_NoCacheHeader(t *testing.T) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
+
+	send := func(key *models.APIKey) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/api/v1/inference", strings.NewReader(`{"query": "What is 2+2?"}`))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Request.Header.Set(noCacheHeader, "true")
+		if key != nil {
+			c.Set("api_key", key)
+		}
+		handler.HandleInference(c)
+		return w
+	}
+
+	w := send(&models.APIKey{ID: "key_1"})
+	assert.Equal(t, http.StatusForbidden, w.Code, "keys need the scope")
+
+	w = send(&models.APIKey{ID: "key_2", Scopes: []string{models.ScopeCacheBypass}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockCache.AssertNotCalled(t, "Get", mock.Anything, mock.Anything)
+	mockCache.AssertNotCalled(t, "Set", mock.Anything, mock.Anything, mock.Anything)
+}
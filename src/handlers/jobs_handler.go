@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/jobs"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// JobsHandler queues inference requests to run in the background and serves
+// their status and results
+type JobsHandler struct {
+	queue    *jobs.Queue
+	runner   *gin.Engine // Runs jobs through the inference handler like a synchronous request
+	sessions *chat.SessionStore
+}
+
+// NewJobsHandler runs jobs through inference. Like synchronous requests,
+// they count against the daily token quota of inference's rate limiter (see
+// InferenceHandler.SetRateLimiter), though not against the request rate.
+func NewJobsHandler(queue *jobs.Queue, inference *InferenceHandler) *JobsHandler {
+	runner := gin.New()
+	runner.Use(middleware.InternalCaller(), func(c *gin.Context) {
+		inference.rateLimiter.Quota(c)
+	})
+	runner.POST("/", inference.HandleInference)
+
+	return &JobsHandler{
+		queue:  queue,
+		runner: runner,
+	}
+}
+
+// SetChatHandler runs queued chat turns through the chat handler
+func (h *JobsHandler) SetChatHandler(chat *ChatHandler) {
+	h.runner.POST("/chat", chat.HandleChat)
+}
+
+// SetSessionStore runs bulk session operations against the store
+func (h *JobsHandler) SetSessionStore(store *chat.SessionStore) {
+	h.sessions = store
+}
+
+// Enqueue queues an inference request and answers 202 with the job to poll
+func (h *JobsHandler) Enqueue(c *gin.Context) {
+	var req models.InferenceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Stream {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Async requests can't stream, poll the job instead"})
+		return
+	}
+
+	job, err := h.queue.Enqueue(c.Request.Context(), middleware.GetCaller(c), req)
+	if err != nil {
+		log.Printf("Failed to queue inference job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+		return
+	}
+
+	accepted(c, job)
+}
+
+// EnqueueBulk queues a bulk delete, archive, unarchive or tag of the user's
+// chat sessions the filter selects, and answers 202 with the job to poll
+func (h *JobsHandler) EnqueueBulk(c *gin.Context) {
+	var req models.BulkSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := chat.ValidateBulk(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.queue.EnqueueBulk(c.Request.Context(), middleware.GetUserID(c), req)
+	if err != nil {
+		log.Printf("Failed to queue bulk session job: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to queue job"})
+		return
+	}
+	accepted(c, job)
+}
+
+// accepted answers 202 with the queued job to poll
+func accepted(c *gin.Context, job *jobs.Job) {
+	statusURL := "/api/v1/jobs/" + job.ID
+	c.Header("Location", statusURL)
+	c.JSON(http.StatusAccepted, gin.H{
+		"job_id":     job.ID,
+		"status":     job.Status,
+		"status_url": statusURL,
+	})
+}
+
+// GetJob returns a job's status, and its result once it has finished
+func (h *JobsHandler) GetJob(c *gin.Context) {
+	job, err := h.queue.Get(c.Request.Context(), c.Param("job_id"), middleware.GetUserID(c))
+	if errors.Is(err, jobs.ErrJobForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Job belongs to another user"})
+		return
+	}
+	if errors.Is(err, jobs.ErrJobNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get job"})
+		return
+	}
+
+	job.Caller = nil
+	c.JSON(http.StatusOK, job)
+}
+
+// Run is the jobs.Runner for the worker pool: it answers the job's request as
+// POST /api/v1/inference would, or its chat turn as POST /api/v1/chat would,
+// caching, hooks, failover, usage and quota included, for the caller who
+// queued it. Bulk session operations run against the session store.
+func (h *JobsHandler) Run(ctx context.Context, job *jobs.Job) (int, []byte) {
+	if job.Bulk != nil {
+		return h.runBulk(ctx, job)
+	}
+	path := "/"
+	var request any = job.Request
+	if job.Chat != nil {
+		path, request = "/chat", job.Chat
+	}
+	caller := middleware.Caller{UserID: job.UserID}
+	if job.Caller != nil {
+		caller = *job.Caller
+	}
+	return serveInternal(ctx, h.runner, path, &middleware.InternalCall{Caller: caller}, request)
+}
+
+// runBulk applies a bulk session operation, saving its progress as it goes
+func (h *JobsHandler) runBulk(ctx context.Context, job *jobs.Job) (int, []byte) {
+	if h.sessions == nil {
+		return http.StatusServiceUnavailable, errorBody("Chat sessions are not available")
+	}
+
+	result, err := h.sessions.BulkUpdate(ctx, job.UserID, *job.Bulk, func(progress models.BulkSessionResult) {
+		if err := h.queue.SaveProgress(ctx, job, progress); err != nil {
+			log.Printf("Failed to save progress of job %s: %v", job.ID, err)
+		}
+	})
+	if errors.Is(err, chat.ErrInvalidFilter) {
+		return http.StatusBadRequest, errorBody(err.Error())
+	}
+	if err != nil {
+		log.Printf("Bulk session job %s failed: %v", job.ID, err)
+		return http.StatusInternalServerError, errorBody("Failed to update sessions")
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return http.StatusInternalServerError, nil
+	}
+	log.Printf("Bulk %s of %d chat sessions for user %s", result.Action, result.Processed, job.UserID)
+	return http.StatusOK, body
+}
+
+// errorBody is an error response body, which failed jobs take their error from
+func errorBody(message string) []byte {
+	body, _ := json.Marshal(gin.H{"error": message})
+	return body
+}
+
+// serveInternal answers request as a POST to path on a handler's private
+// router, whose middleware.InternalCaller acts as call's caller and reports
+// the tokens used back to call
+func serveInternal(ctx context.Context, runner *gin.Engine, path string, call *middleware.InternalCall, request any) (int, []byte) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return http.StatusBadRequest, nil
+	}
+	req, err := http.NewRequestWithContext(middleware.WithInternalCall(ctx, call), http.MethodPost, path, bytes.NewReader(body))
+	if err != nil {
+		return http.StatusInternalServerError, nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	w := &jobResponse{header: make(http.Header)}
+	runner.ServeHTTP(w, req)
+	return w.status, w.body.Bytes()
+}
+
+// jobResponse collects the inference handler's answer to a job
+type jobResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *jobResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *jobResponse) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *jobResponse) Write(data []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(data)
+}
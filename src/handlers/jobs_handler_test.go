@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/jobs"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/mocks"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// setupJobs queues inference jobs like main does, behind a stub auth
+// middleware (the X-User header), within a daily quota of 1000 tokens
+func setupJobs(t *testing.T) (*gin.Engine, *JobsHandler, *jobs.Queue, *miniredis.Miniredis, *mocks.MockSLMEngine, *mocks.MockCache) {
+	handler, _, mockSLM, mockCache := setupTestHandler()
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	queue := jobs.NewQueue(client, config.JobsConfig{})
+	jobsHandler := NewJobsHandler(queue, handler)
+
+	limiter := middleware.NewRateLimiter(client, &config.RateLimitConfig{TokensPerDay: 1000})
+	limiter.SetClock(clock.NewFake(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)))
+	handler.SetRateLimiter(limiter)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		middleware.SetUserID(c, c.GetHeader("X-User"))
+		c.Next()
+	})
+	r.POST("/inference/async", jobsHandler.Enqueue)
+	return r, jobsHandler, queue, mr, mockSLM, mockCache
+}
+
+// runAsync queues a query for alice and runs its job
+func runAsync(t *testing.T, r *gin.Engine, jobsHandler *JobsHandler, queue *jobs.Queue) int {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/inference/async", bytes.NewBufferString(`{"query": "What is 2+2?"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", "alice")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+
+	var accepted struct {
+		JobID string `json:"job_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &accepted))
+	job, err := queue.Get(context.Background(), accepted.JobID, "alice")
+	require.NoError(t, err)
+
+	status, _ := jobsHandler.Run(context.Background(), job)
+	return status
+}
+
+func TestJobsHandler_ChargesCallerQuota(t *testing.T) {
+	r, jobsHandler, queue, mr, mockSLM, mockCache := setupJobs(t)
+	mockCache.On("Get", mock.Anything, mock.Anything).Return(nil, nil)
+	mockCache.On("Set", mock.Anything, mock.Anything, mock.Anything).Return(nil)
+	mockSLM.On("Infer", mock.Anything, mock.Anything).Return(&models.SLMResult{Response: "4", SelectedModel: "llama-3.1-8b-instant"}, nil)
+
+	require.Equal(t, http.StatusOK, runAsync(t, r, jobsHandler, queue))
+
+	used, err := mr.Get("ratelimit:tokens:alice:2026-01-15")
+	require.NoError(t, err)
+	assert.NotEqual(t, "0", used)
+}
+
+func TestJobsHandler_QuotaExceeded(t *testing.T) {
+	r, jobsHandler, queue, mr, mockSLM, _ := setupJobs(t)
+	require.NoError(t, mr.Set("ratelimit:tokens:alice:2026-01-15", "1000"))
+
+	assert.Equal(t, http.StatusTooManyRequests, runAsync(t, r, jobsHandler, queue))
+	mockSLM.AssertNotCalled(t, "Infer", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/knowledge"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+const (
+	knowledgeBaseModel = "knowledge-base"
+	knowledgeBaseTier  = "knowledge"
+)
+
+// KnowledgeHandler is the admin API for the knowledge base
+type KnowledgeHandler struct {
+	base *knowledge.Base
+}
+
+func NewKnowledgeHandler(base *knowledge.Base) *KnowledgeHandler {
+	return &KnowledgeHandler{base: base}
+}
+
+// ListEntries returns the loaded entries
+func (h *KnowledgeHandler) ListEntries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"entries": h.base.Entries()})
+}
+
+// Reload re-reads the knowledge base file without waiting for the watcher
+func (h *KnowledgeHandler) Reload(c *gin.Context) {
+	if err := h.base.Reload(c.Request.Context()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("✓ Reloaded %d knowledge base entries", h.base.Len())
+	c.JSON(http.StatusOK, gin.H{"entries": h.base.Len()})
+}
+
+// lookupKnowledgeAnswer returns the knowledge base answer for the request's
+// query as a response, or nil when no entry matches. Lookup failures are
+// logged and treated as a miss so requests still reach the models.
+func lookupKnowledgeAnswer(c *gin.Context, base *knowledge.Base, req *models.InferenceRequest, startTime time.Time) *models.InferenceResponse {
+	if base == nil {
+		return nil
+	}
+
+	match, err := base.Lookup(c.Request.Context(), req.Query)
+	if err != nil {
+		log.Printf("Failed to look up knowledge base answer: %v", err)
+		return nil
+	}
+	if match == nil {
+		return nil
+	}
+
+	reason := fmt.Sprintf("Knowledge base entry %s (exact match)", match.Entry.ID)
+	if !match.Exact {
+		reason = fmt.Sprintf("Knowledge base entry %s (similarity: %s)", match.Entry.ID, formatFloat(match.Similarity))
+	}
+
+	inputTokens := utils.CountTokens(req.Query, "")
+	outputTokens := utils.CountTokens(match.Entry.Answer, "")
+	return &models.InferenceResponse{
+		Response:      match.Entry.Answer,
+		ModelUsed:     knowledgeBaseModel,
+		Tier:          knowledgeBaseTier,
+		RoutingReason: reason,
+		Latency:       time.Since(startTime),
+		Timestamp:     time.Now(),
+		CostMetrics: &models.CostMetrics{
+			InputTokens:  inputTokens,
+			OutputTokens: outputTokens,
+			TotalTokens:  inputTokens + outputTokens,
+			Model:        knowledgeBaseModel,
+		},
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
+)
+
+type ModelsHandler struct {
+	registry *registry.ModelRegistry
+}
+
+func NewModelsHandler(modelRegistry *registry.ModelRegistry) *ModelsHandler {
+	return &ModelsHandler{
+		registry: modelRegistry,
+	}
+}
+
+// ListModels returns every registered model with its context window and capabilities
+func (h *ModelsHandler) ListModels(c *gin.Context) {
+	modelList := h.registry.List()
+
+	c.JSON(http.StatusOK, gin.H{
+		"models": modelList,
+		"count":  len(modelList),
+	})
+}
+
+// GetModel returns the registry entry for a single model
+func (h *ModelsHandler) GetModel(c *gin.Context) {
+	info, ok := h.registry.Get(c.Param("model"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Model not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/moderation"
+)
+
+// moderationKey is the context key of the request's moderation decision
+const moderationKey = "moderation"
+
+// moderate screens texts before routing. If they're refused the rejection is
+// written and false is returned; otherwise the decision is kept for the
+// response's metadata.
+func moderate(c *gin.Context, stream *sseStream, moderator *moderation.Moderator, texts ...string) bool {
+	decision, err := moderator.Check(c.Request.Context(), texts...)
+	if errors.Is(err, moderation.ErrUnavailable) {
+		log.Printf("Content moderation unavailable, refusing the query: %v", err)
+		writeError(c, stream, http.StatusServiceUnavailable, gin.H{"error": "Content moderation is unavailable, please retry"})
+		return false
+	}
+	if decision == nil {
+		return true
+	}
+
+	c.Set(moderationKey, decision)
+	if decision.Action == models.ModerationReject {
+		writeError(c, stream, http.StatusBadRequest, gin.H{
+			"error":      "The query was rejected by content moderation",
+			"moderation": decision,
+		})
+		return false
+	}
+	return true
+}
+
+// requestTexts is everything the client sent to be answered: the context,
+// the conversation and the query
+func requestTexts(req *models.InferenceRequest) []string {
+	texts := make([]string, 0, len(req.Messages)+2)
+	texts = append(texts, req.Context)
+	for _, message := range req.Messages {
+		texts = append(texts, message.Content)
+	}
+	return append(texts, req.Query)
+}
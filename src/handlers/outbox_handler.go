@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+// OutboxHandler is the admin API for the event outbox's sinks
+type OutboxHandler struct {
+	dispatchers []*outbox.Dispatcher
+}
+
+func NewOutboxHandler(dispatchers []*outbox.Dispatcher) *OutboxHandler {
+	return &OutboxHandler{
+		dispatchers: dispatchers,
+	}
+}
+
+// Status returns how many events each sink has pending and still to read
+func (h *OutboxHandler) Status(c *gin.Context) {
+	sinks := make([]*outbox.SinkStatus, 0, len(h.dispatchers))
+	for _, dispatcher := range h.dispatchers {
+		status, err := dispatcher.Status(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get outbox status"})
+			return
+		}
+		sinks = append(sinks, status)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sinks": sinks})
+}
+
+// Replay sends a sink the events published between ?since= and ?until=
+// (RFC 3339; until defaults to now) again, as far back as the stream goes
+func (h *OutboxHandler) Replay(c *gin.Context) {
+	var dispatcher *outbox.Dispatcher
+	for _, d := range h.dispatchers {
+		if d.Name() == c.Param("sink") {
+			dispatcher = d
+		}
+	}
+	if dispatcher == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outbox sink not found"})
+		return
+	}
+
+	since, err := time.Parse(time.RFC3339, c.Query("since"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 time"})
+		return
+	}
+	var until time.Time
+	if raw := c.Query("until"); raw != "" {
+		until, err = time.Parse(time.RFC3339, raw)
+		if err != nil || until.Before(since) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be an RFC 3339 time after since"})
+			return
+		}
+	}
+
+	replayed, err := dispatcher.Replay(c.Request.Context(), since, until)
+	if err != nil {
+		log.Printf("Failed to replay outbox events to %s: %v", dispatcher.Name(), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Replay failed", "replayed": replayed})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed})
+}
+
+// recordAudit publishes an audit event. Failures are logged; the action has
+// already happened.
+func recordAudit(c *gin.Context, o *outbox.Outbox, action string, userID string, data any) {
+	// Record even if the client has already disconnected
+	ctx := context.WithoutCancel(c.Request.Context())
+	if err := o.Publish(ctx, outbox.TypeAudit, action, userID, data); err != nil {
+		log.Printf("Failed to record audit event %s: %v", action, err)
+	}
+}
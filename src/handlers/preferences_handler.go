@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+	"www.github.com/Wanderer0074348/HybridLM/src/preferences"
+)
+
+// PreferencesHandler lets users see and change their privacy settings
+type PreferencesHandler struct {
+	store  *preferences.Store
+	outbox *outbox.Outbox // Receives preference change audit events, optional
+}
+
+func NewPreferencesHandler(store *preferences.Store) *PreferencesHandler {
+	return &PreferencesHandler{
+		store: store,
+	}
+}
+
+// SetOutbox records preference changes as audit events
+func (h *PreferencesHandler) SetOutbox(o *outbox.Outbox) {
+	h.outbox = o
+}
+
+// GetPreferences returns the current user's privacy settings
+func (h *PreferencesHandler) GetPreferences(c *gin.Context) {
+	prefs, err := h.store.Get(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get preferences"})
+		return
+	}
+
+	c.JSON(http.StatusOK, prefs)
+}
+
+// UpdatePreferences changes the settings in the body and leaves the rest
+func (h *PreferencesHandler) UpdatePreferences(c *gin.Context) {
+	var req models.UpdatePreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	prefs, err := h.store.Update(c.Request.Context(), userID, req)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update preferences"})
+		return
+	}
+
+	log.Printf("🔒 Privacy preferences updated for user %s", userID)
+	recordAudit(c, h.outbox, "preferences.updated", userID, prefs)
+	c.JSON(http.StatusOK, prefs)
+}
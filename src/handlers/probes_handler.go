@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/health"
+)
+
+// ProbesHandler serves the liveness and readiness probes of orchestrators
+type ProbesHandler struct {
+	checker *health.Checker
+}
+
+func NewProbesHandler(checker *health.Checker) *ProbesHandler {
+	return &ProbesHandler{
+		checker: checker,
+	}
+}
+
+// Live answers as long as the process serves requests; it checks nothing
+// else, so a dependency outage doesn't get the instance restarted
+func (h *ProbesHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "alive", "timestamp": time.Now()})
+}
+
+// Ready answers 503 while a critical dependency is down, taking the
+// instance out of rotation
+func (h *ProbesHandler) Ready(c *gin.Context) {
+	dependencies := h.checker.Check(c.Request.Context())
+	if !health.Ready(dependencies) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "dependencies": dependencies})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ready", "dependencies": dependencies})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/analytics"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+)
+
+const (
+	defaultTopQueryDays  = 7
+	defaultTopQueryLimit = 20
+	maxTopQueryLimit     = 1000
+)
+
+// QueryStatsHandler is the admin API for query frequency analytics
+type QueryStatsHandler struct {
+	stats *analytics.QueryStats
+}
+
+func NewQueryStatsHandler(stats *analytics.QueryStats) *QueryStatsHandler {
+	return &QueryStatsHandler{
+		stats: stats,
+	}
+}
+
+// TopQueries returns the most frequent normalized queries.
+// Query params: days (period ending today) and limit (number of queries).
+func (h *QueryStatsHandler) TopQueries(c *gin.Context) {
+	days := defaultTopQueryDays
+	if raw := c.Query("days"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > h.stats.RetentionDays() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "days must be between 1 and " + strconv.Itoa(h.stats.RetentionDays())})
+			return
+		}
+		days = n
+	}
+
+	limit := defaultTopQueryLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxTopQueryLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxTopQueryLimit)})
+			return
+		}
+		limit = n
+	}
+
+	report, err := h.stats.Top(c.Request.Context(), days, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get query stats"})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// recordQuery counts the query for the top-queries report, if counting is configured
+func recordQuery(c *gin.Context, stats *analytics.QueryStats, query string) {
+	if stats == nil {
+		return
+	}
+	// Count even if the client has already disconnected
+	ctx := context.WithoutCancel(c.Request.Context())
+	if err := stats.Record(ctx, middleware.GetUserID(c), query); err != nil {
+		log.Printf("Failed to record query stats: %v", err)
+	}
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/receipts"
+)
+
+// ReceiptsHandler verifies the receipts answers carry
+type ReceiptsHandler struct {
+	signer *receipts.Signer
+}
+
+func NewReceiptsHandler(signer *receipts.Signer) *ReceiptsHandler {
+	return &ReceiptsHandler{
+		signer: signer,
+	}
+}
+
+// VerifyReceipt reports whether a receipt was issued as is, and whether the
+// query and response given match it
+func (h *ReceiptsHandler) VerifyReceipt(c *gin.Context) {
+	var req models.VerifyReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, h.signer.Verify(req))
+}
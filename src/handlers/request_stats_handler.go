@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/analytics"
+)
+
+const (
+	defaultStatsWindow   = 24 * time.Hour
+	defaultTopUsersLimit = 20
+	maxTopUsersLimit     = 1000
+)
+
+// RequestStatsHandler is the admin API for aggregate request statistics
+type RequestStatsHandler struct {
+	stats *analytics.RequestStats
+}
+
+func NewRequestStatsHandler(stats *analytics.RequestStats) *RequestStatsHandler {
+	return &RequestStatsHandler{
+		stats: stats,
+	}
+}
+
+// GetStats returns request volume, the SLM/LLM split, cache hit rate, error
+// rates and latency, overall and per model.
+// Query params: window (e.g. "1h", "24h" or "7d").
+func (h *RequestStatsHandler) GetStats(c *gin.Context) {
+	window, ok := h.window(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.stats.Summary(c.Request.Context(), window)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get request stats"})
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// TopUsers returns the users whose requests cost the most.
+// Query params: window and limit (number of users).
+func (h *RequestStatsHandler) TopUsers(c *gin.Context) {
+	window, ok := h.window(c)
+	if !ok {
+		return
+	}
+
+	limit := defaultTopUsersLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxTopUsersLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxTopUsersLimit)})
+			return
+		}
+		limit = n
+	}
+
+	users, err := h.stats.TopUsers(c.Request.Context(), window, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get top users"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"window": window.String(), "users": users})
+}
+
+// window parses the window query param, answering 400 if it's invalid
+func (h *RequestStatsHandler) window(c *gin.Context) (time.Duration, bool) {
+	raw := c.Query("window")
+	if raw == "" {
+		return defaultStatsWindow, true
+	}
+	window, err := parseWindow(raw)
+	if err != nil || window < time.Hour || window > h.stats.MaxWindow() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "window must be between 1h and " + strconv.Itoa(int(h.stats.MaxWindow().Hours()/24)) + "d"})
+		return 0, false
+	}
+	return window, true
+}
+
+// parseWindow parses a duration, also accepting whole days like "7d"
+func parseWindow(raw string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, errors.New("invalid number of days")
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(raw)
+}
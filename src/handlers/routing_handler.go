@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/annotations"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+const examplesPageSize = 1000
+
+// RoutingHandler is the admin API for training routing models: it exports
+// labeled routing examples and imports the trained model
+type RoutingHandler struct {
+	events      *outbox.Outbox                 // Source of routing examples, optional
+	learned     *router.LearnedRoutingStrategy // Set when router.strategy is "learned"
+	consent     func(ctx context.Context, userID string) bool
+	annotations *annotations.Store // Reviewers' labels for the examples, optional
+}
+
+func NewRoutingHandler(events *outbox.Outbox, learned *router.LearnedRoutingStrategy) *RoutingHandler {
+	return &RoutingHandler{
+		events:  events,
+		learned: learned,
+	}
+}
+
+// SetConsent leaves the requests of users for whom allowed returns false out
+// of exported examples
+func (h *RoutingHandler) SetConsent(allowed func(ctx context.Context, userID string) bool) {
+	h.consent = allowed
+}
+
+// SetAnnotations adds reviewers' annotations of the requests to exported examples
+func (h *RoutingHandler) SetAnnotations(store *annotations.Store) {
+	h.annotations = store
+}
+
+// routingExample is one routed request: the features the router saw, what it
+// decided and how the request turned out
+type routingExample struct {
+	ID        string             `json:"id"`
+	RequestID string             `json:"request_id,omitempty"`
+	Timestamp time.Time          `json:"timestamp"`
+	Features  map[string]float64 `json:"features"`
+
+	UseLLM        bool    `json:"use_llm"`
+	RoutingReason string  `json:"routing_reason"`
+	Tier          string  `json:"tier,omitempty"` // Tier that answered; differs from the decision after a fallback
+	Model         string  `json:"model,omitempty"`
+	Fallback      bool    `json:"fallback"`
+	Status        int     `json:"status"`
+	LatencyMs     float64 `json:"latency_ms"`
+	TotalTokens   int     `json:"total_tokens"`
+	Cost          float64 `json:"cost"`
+
+	Annotations []models.Annotation `json:"annotations,omitempty"` // Reviewers' verdicts on the answer
+}
+
+// ExportExamples streams the routing examples recorded between ?since= and
+// ?until= (RFC 3339; until defaults to now) as JSON lines, as far back as the
+// event outbox goes
+func (h *RoutingHandler) ExportExamples(c *gin.Context) {
+	if h.events == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Routing examples need the event outbox"})
+		return
+	}
+
+	since, err := time.Parse(time.RFC3339, c.Query("since"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 time"})
+		return
+	}
+	var until time.Time
+	if raw := c.Query("until"); raw != "" {
+		until, err = time.Parse(time.RFC3339, raw)
+		if err != nil || until.Before(since) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be an RFC 3339 time after since"})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	err = h.events.Range(c.Request.Context(), since, until, examplesPageSize, func(events []outbox.Event) error {
+		var examples []*routingExample
+		var responses []annotations.Response // What each example's annotations are keyed on
+		for _, event := range events {
+			example, ok := toRoutingExample(event)
+			if !ok {
+				continue
+			}
+			if h.consent != nil && !h.consent(c.Request.Context(), event.UserID) {
+				continue
+			}
+			examples = append(examples, example)
+			responses = append(responses, annotations.Response{UserID: event.UserID, RequestID: example.RequestID})
+		}
+		if h.annotations != nil && len(examples) > 0 {
+			annotated, err := h.annotations.ForResponses(c.Request.Context(), responses)
+			if err != nil {
+				return err
+			}
+			for i, example := range examples {
+				example.Annotations = annotated[responses[i]]
+			}
+		}
+		for _, example := range examples {
+			if err := encoder.Encode(example); err != nil {
+				return err
+			}
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		// The status has been sent; the client sees a truncated export
+		log.Printf("Failed to export routing examples: %v", err)
+	}
+}
+
+func toRoutingExample(event outbox.Event) (*routingExample, bool) {
+	if event.Type != outbox.TypeRequest || event.Action != "completed" {
+		return nil, false
+	}
+	var request middleware.RequestEvent
+	if err := json.Unmarshal(event.Data, &request); err != nil || request.Decision == nil || request.Decision.Features == nil {
+		return nil, false
+	}
+
+	return &routingExample{
+		ID:            event.ID,
+		RequestID:     request.RequestID,
+		Timestamp:     event.Timestamp,
+		Features:      request.Decision.Features,
+		UseLLM:        request.Decision.UseLLM,
+		RoutingReason: request.Decision.Reason,
+		Tier:          request.Tier,
+		Model:         request.Model,
+		Fallback:      request.Fallback,
+		Status:        request.Status,
+		LatencyMs:     request.LatencyMs,
+		TotalTokens:   request.TotalTokens,
+		Cost:          request.Cost,
+	}, true
+}
+
+// GetModel returns the learned routing model in use
+func (h *RoutingHandler) GetModel(c *gin.Context) {
+	if h.learned == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The learned routing strategy is not enabled"})
+		return
+	}
+	model := h.learned.Model()
+	if model == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No learned routing model has been imported"})
+		return
+	}
+
+	c.JSON(http.StatusOK, model)
+}
+
+// ImportModel replaces the learned routing model on every instance
+func (h *RoutingHandler) ImportModel(c *gin.Context) {
+	if h.learned == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "The learned routing strategy is not enabled"})
+		return
+	}
+
+	var model router.LearnedModel
+	if err := c.ShouldBindJSON(&model); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := h.learned.Import(c.Request.Context(), &model)
+	if errors.Is(err, router.ErrInvalidModel) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to import model"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"type": model.Type, "version": model.Version})
+}
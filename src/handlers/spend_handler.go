@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+// SpendHandler is the admin API for provider key spend caps
+type SpendHandler struct {
+	caps *usage.SpendCaps
+}
+
+func NewSpendHandler(caps *usage.SpendCaps) *SpendHandler {
+	return &SpendHandler{
+		caps: caps,
+	}
+}
+
+// GetSpend returns this month's spend of every capped provider key
+func (h *SpendHandler) GetSpend(c *gin.Context) {
+	statuses, err := h.caps.Status(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get spend"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"caps": statuses, "action": h.caps.Action()})
+}
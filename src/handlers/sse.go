@@ -0,0 +1,266 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/streaming"
+)
+
+// inferFunc runs one inference attempt and returns the generated text
+type inferFunc func(ctx context.Context, req *models.InferenceRequest) (string, error)
+
+// sseStream writes inference output to the client as Server-Sent Events.
+// Headers are only sent with the first event, so failures before any output
+// can still be reported with a regular JSON error and status code.
+type sseStream struct {
+	c          *gin.Context
+	started    bool
+	sentTokens bool
+	pacer      *streaming.Pacer // Set when tokens are sent at a limited rate
+	paced      *pacedTokens     // Tokens waiting for the pacer, while it runs
+
+	// Set for resumable streams: events are also buffered for replay
+	buffer     *streaming.Buffer
+	streamID   string
+	generation context.Context // Cancelled when the stream is cancelled through the API
+}
+
+func newSSEStream(c *gin.Context) *sseStream {
+	return &sseStream{c: c}
+}
+
+// newResumableSSEStream creates a stream whose events are buffered in Redis so
+// the client can reconnect with Last-Event-ID. Falls back to a plain stream
+// if the buffer can't be created.
+func newResumableSSEStream(c *gin.Context, buffer *streaming.Buffer, userID string) *sseStream {
+	stream := newSSEStream(c)
+	if buffer == nil {
+		return stream
+	}
+
+	streamID, err := buffer.Create(c.Request.Context(), userID)
+	if err != nil {
+		log.Printf("Failed to create resumable stream: %v", err)
+		return stream
+	}
+
+	stream.buffer = buffer
+	stream.streamID = streamID
+	return stream
+}
+
+func (s *sseStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+
+	if s.streamID != "" {
+		s.c.Header("X-Stream-ID", s.streamID)
+	}
+	writeSSEHeaders(s.c)
+
+	if s.streamID != "" {
+		s.send("stream", gin.H{"stream_id": s.streamID})
+	}
+}
+
+// writeSSEHeaders starts an event-stream response. Streams outlast the
+// server's write timeout, which is meant for regular responses, so it is lifted.
+func writeSSEHeaders(c *gin.Context) {
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		log.Printf("Failed to lift the write deadline of a stream: %v", err)
+	}
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx)
+	c.Status(http.StatusOK)
+}
+
+// send writes one event, buffering it first when the stream is resumable
+func (s *sseStream) send(event string, data interface{}) {
+	if s.buffer == nil {
+		s.c.SSEvent(event, data)
+		s.c.Writer.Flush()
+		return
+	}
+
+	// Keep buffering after the client disconnects so it can catch up on reconnect
+	seq, err := s.buffer.Append(context.WithoutCancel(s.c.Request.Context()), s.streamID, event, data)
+	if err != nil {
+		log.Printf("Failed to buffer stream event: %v", err)
+		s.c.SSEvent(event, data)
+	} else {
+		s.c.Render(-1, sse.Event{Id: streaming.EventID(s.streamID, seq), Event: event, Data: data})
+	}
+	s.c.Writer.Flush()
+}
+
+// token sends a chunk of generated text as a "token" event
+func (s *sseStream) token(chunk string) error {
+	s.start()
+	s.sentTokens = true
+	if s.pacer != nil {
+		s.pace(chunk)
+	} else {
+		s.send("token", gin.H{"content": chunk})
+	}
+
+	// Resumable streams finish generating for a later replay, unless cancelled
+	if s.buffer != nil {
+		if s.generation == nil {
+			return nil
+		}
+		return context.Cause(s.generation)
+	}
+
+	// Stop generating once the client has gone away
+	return s.c.Request.Context().Err()
+}
+
+// generationContext returns the context to run inference with and a func to
+// release it when done. Resumable streams aren't cancelled when the client
+// disconnects, only when the stream is cancelled explicitly.
+func (s *sseStream) generationContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s == nil || s.buffer == nil {
+		return ctx, func() {}
+	}
+	ctx, stop := s.buffer.WithCancel(context.WithoutCancel(ctx), s.streamID)
+	s.generation = ctx
+	return ctx, stop
+}
+
+// cancelled reports whether the stream was cancelled explicitly
+func (s *sseStream) cancelled() bool {
+	return s != nil && s.generation != nil && errors.Is(context.Cause(s.generation), streaming.ErrStreamCancelled)
+}
+
+// finish sends the final "done" event with routing and cost details. If no
+// tokens were streamed (e.g. a cache hit), the full text is sent as one token first.
+func (s *sseStream) finish(text string, payload interface{}) {
+	if !s.sentTokens && text != "" {
+		_ = s.token(text)
+	}
+	s.start()
+	s.drain()
+	s.send("done", payload)
+}
+
+// fail reports an error, as JSON if nothing was streamed yet or as an "error" event otherwise
+func (s *sseStream) fail(status int, body gin.H) {
+	if !s.started {
+		s.c.JSON(status, body)
+		return
+	}
+	s.drain()
+	s.send("error", body)
+}
+
+// infer wraps a tier so tokens are forwarded to the client as they are
+// generated. Tiers without streaming support run fallback and are sent as a single token.
+func (s *sseStream) infer(target interface{}, fallback inferFunc) inferFunc {
+	return func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		streamer, ok := target.(models.StreamingInferencer)
+		if !ok {
+			response, err := fallback(ctx, req)
+			if err != nil {
+				return "", err
+			}
+			return response, s.token(response)
+		}
+
+		var sb strings.Builder
+		err := streamer.InferStreaming(ctx, req, func(chunk string) error {
+			sb.WriteString(chunk)
+			return s.token(chunk)
+		})
+		return sb.String(), err
+	}
+}
+
+// inferSLM wraps the SLM tier like infer, keeping the result of a streamed
+// answer in result, as slmInfer does for answers that aren't
+func (s *sseStream) inferSLM(engine models.SLMInferencer, fallback inferFunc, result **models.SLMResult) inferFunc {
+	infer := s.infer(engine, fallback)
+	return func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		ctx, recorder := models.WithSLMResult(ctx)
+		response, err := infer(ctx, req)
+		if streamed := recorder.Result(); streamed != nil {
+			keepSLMResult(result, streamed)
+		}
+		return response, err
+	}
+}
+
+// writeResult sends a successful result as JSON, or as the final SSE event when streaming
+func writeResult(c *gin.Context, stream *sseStream, text string, result interface{}) {
+	result = withRequestMetadata(c, result)
+	middleware.SetResult(c, result)
+	if stream == nil {
+		c.JSON(http.StatusOK, result)
+		return
+	}
+	stream.finish(text, result)
+}
+
+// withRequestMetadata returns result with the request's moderation decision,
+// service level and model feedback ID in its metadata. Results may be shared
+// with the cache, so they're copied rather than changed.
+func withRequestMetadata(c *gin.Context, result interface{}) interface{} {
+	moderation, moderated := c.Get(moderationKey)
+	degradation, degraded := c.Get(degradationKey)
+	feedback, rateable := c.Get(modelFeedbackKey)
+	if !moderated && !degraded && !rateable {
+		return result
+	}
+
+	withRequest := func(metadata *models.ResponseMetadata) *models.ResponseMetadata {
+		copied := models.ResponseMetadata{}
+		if metadata != nil {
+			copied = *metadata
+		}
+		if moderated {
+			copied.Moderation = moderation.(*models.ModerationDecision)
+		}
+		if degraded {
+			copied.Degradation = degradation.(*models.DegradationStatus)
+		}
+		if rateable {
+			copied.ModelFeedback = feedback.(*models.ModelFeedback)
+		}
+		return &copied
+	}
+	switch response := result.(type) {
+	case *models.InferenceResponse:
+		copied := *response
+		copied.Metadata = withRequest(response.Metadata)
+		return &copied
+	case *models.ChatResponse:
+		copied := *response
+		copied.Metadata = withRequest(response.Metadata)
+		return &copied
+	}
+	return result
+}
+
+// writeError sends an error as JSON, or as an SSE error event once streaming has begun
+func writeError(c *gin.Context, stream *sseStream, status int, body gin.H) {
+	if stream == nil {
+		c.JSON(status, body)
+		return
+	}
+	stream.fail(status, body)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSEStream_OutlastsWriteTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/stream", func(c *gin.Context) {
+		stream := newSSEStream(c)
+		require.NoError(t, stream.token("slow"))
+		time.Sleep(300 * time.Millisecond)
+		stream.send("done", gin.H{"tier": "edge-slm"})
+	})
+
+	server := httptest.NewUnstartedServer(r)
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/stream")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Contains(t, string(body), "event:token")
+	assert.Contains(t, string(body), "event:done")
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/streaming"
+)
+
+const (
+	streamPollInterval = 200 * time.Millisecond
+	streamIdleTimeout  = 2 * time.Minute // Give up tailing a stream that stopped producing events
+)
+
+// StreamHandler replays resumable SSE streams to reconnecting clients
+type StreamHandler struct {
+	buffer *streaming.Buffer
+}
+
+func NewStreamHandler(buffer *streaming.Buffer) *StreamHandler {
+	return &StreamHandler{
+		buffer: buffer,
+	}
+}
+
+// ResumeStream replays the events after Last-Event-ID (header or last_event_id
+// query parameter), then follows the stream until it finishes
+func (h *StreamHandler) ResumeStream(c *gin.Context) {
+	streamID := c.Param("stream_id")
+	ctx := c.Request.Context()
+
+	afterSeq := 0
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	if lastEventID != "" {
+		id, seq, err := streaming.ParseEventID(lastEventID)
+		if err != nil || id != streamID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Last-Event-ID for this stream"})
+			return
+		}
+		afterSeq = seq
+	}
+
+	err := h.buffer.CheckOwner(ctx, streamID, middleware.GetUserID(c))
+	if errors.Is(err, streaming.ErrStreamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream not found or expired"})
+		return
+	}
+	if errors.Is(err, streaming.ErrStreamForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stream"})
+		return
+	}
+
+	c.Header("X-Stream-ID", streamID)
+	writeSSEHeaders(c)
+
+	lastEvent := time.Now()
+	ticker := time.NewTicker(streamPollInterval)
+	defer ticker.Stop()
+
+	for {
+		events, err := h.buffer.Events(ctx, streamID, afterSeq)
+		if err != nil {
+			c.SSEvent("error", gin.H{"error": "Failed to read stream"})
+			c.Writer.Flush()
+			return
+		}
+
+		for _, event := range events {
+			c.Render(-1, sse.Event{Id: streaming.EventID(streamID, event.Seq), Event: event.Event, Data: event.Data})
+			afterSeq = event.Seq
+			if event.Terminal() {
+				c.Writer.Flush()
+				return
+			}
+		}
+		if len(events) > 0 {
+			c.Writer.Flush()
+			lastEvent = time.Now()
+		} else if time.Since(lastEvent) > streamIdleTimeout {
+			c.SSEvent("error", gin.H{"error": "Stream stalled"})
+			c.Writer.Flush()
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CancelStream stops generating a resumable stream, aborting the model call.
+// Clients following the stream get an "error" event.
+func (h *StreamHandler) CancelStream(c *gin.Context) {
+	streamID := c.Param("stream_id")
+	ctx := c.Request.Context()
+
+	err := h.buffer.CheckOwner(ctx, streamID, middleware.GetUserID(c))
+	if errors.Is(err, streaming.ErrStreamNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream not found or expired"})
+		return
+	}
+	if errors.Is(err, streaming.ErrStreamForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load stream"})
+		return
+	}
+
+	if err := h.buffer.Cancel(ctx, streamID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel stream"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"stream_id": streamID, "status": "cancelling"})
+}
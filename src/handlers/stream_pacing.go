@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"strconv"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/streaming"
+)
+
+// streamRateHeader asks for a streamed answer to be sent at most this many
+// tokens per second, e.g. to bound the bandwidth of a constrained client
+const streamRateHeader = "X-HybridLM-Stream-Rate"
+
+// minStreamRate keeps clients from holding a stream, and the resources
+// behind it, open for minutes on end
+const minStreamRate = 10.0
+
+// streamPacer returns the pacer for a stream: at the lower of the configured
+// ceiling and the rate the client asked for, or nil when neither is set.
+// Rates that aren't numbers are ignored.
+func streamPacer(c *gin.Context, tokensPerSecond float64, burst int) *streaming.Pacer {
+	if requested, err := strconv.ParseFloat(c.GetHeader(streamRateHeader), 64); err == nil && requested > 0 {
+		requested = max(requested, minStreamRate)
+		if tokensPerSecond <= 0 || requested < tokensPerSecond {
+			tokensPerSecond = requested
+		}
+	}
+	return streaming.NewPacer(tokensPerSecond, burst)
+}
+
+// pacedTokens holds a stream's tokens for a goroutine that sends them at the
+// pacer's rate. Providers stream into it without waiting, so a slow rate
+// doesn't hold their calls open past the per-attempt timeout.
+type pacedTokens struct {
+	mu      sync.Mutex
+	pending []string
+	closed  bool
+	wake    chan struct{} // Signalled when tokens are added or it's closed
+	done    chan struct{} // Closed once every token has been sent
+}
+
+// pace queues chunk to be sent at the pacer's rate, starting the goroutine
+// sending tokens with the first one
+func (s *sseStream) pace(chunk string) {
+	if s.paced == nil {
+		s.paced = &pacedTokens{wake: make(chan struct{}, 1), done: make(chan struct{})}
+		go s.sendPaced(s.paced)
+	}
+	s.paced.mu.Lock()
+	s.paced.pending = append(s.paced.pending, chunk)
+	s.paced.mu.Unlock()
+	s.paced.signal()
+}
+
+// sendPaced sends queued tokens at the pacer's rate until the queue is
+// drained. Once the client is gone the pacer sends them at once.
+func (s *sseStream) sendPaced(paced *pacedTokens) {
+	defer close(paced.done)
+	ctx := s.c.Request.Context()
+	for {
+		paced.mu.Lock()
+		chunks, closed := paced.pending, paced.closed
+		paced.pending = nil
+		paced.mu.Unlock()
+
+		for _, chunk := range chunks {
+			s.pacer.Pace(ctx, chunk, func(piece string) {
+				s.send("token", gin.H{"content": piece})
+			})
+		}
+		if len(chunks) > 0 {
+			continue
+		}
+		if closed {
+			return
+		}
+		<-paced.wake
+	}
+}
+
+// drain waits for the queued tokens to be sent, so the stream's last event
+// follows them. Streams without a pacer return at once.
+func (s *sseStream) drain() {
+	if s == nil || s.paced == nil {
+		return
+	}
+	s.paced.mu.Lock()
+	s.paced.closed = true
+	s.paced.mu.Unlock()
+	s.paced.signal()
+	<-s.paced.done
+	s.paced = nil
+}
+
+func (p *pacedTokens) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+	"www.github.com/Wanderer0074348/HybridLM/src/terms"
+)
+
+// TermsHandler serves the current terms version and records users accepting it
+type TermsHandler struct {
+	store  *terms.Store
+	config config.TermsConfig
+	outbox *outbox.Outbox // Receives acceptance audit events, optional
+}
+
+func NewTermsHandler(store *terms.Store, cfg config.TermsConfig) *TermsHandler {
+	return &TermsHandler{
+		store:  store,
+		config: cfg,
+	}
+}
+
+// SetOutbox records acceptances as audit events
+func (h *TermsHandler) SetOutbox(o *outbox.Outbox) {
+	h.outbox = o
+}
+
+// GetTerms returns the current terms version and where to read it
+func (h *TermsHandler) GetTerms(c *gin.Context) {
+	c.JSON(http.StatusOK, h.status())
+}
+
+// GetMyTerms returns the current terms and whether the user has accepted them
+func (h *TermsHandler) GetMyTerms(c *gin.Context) {
+	history, err := h.store.History(c.Request.Context(), middleware.GetUserID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get terms acceptance"})
+		return
+	}
+
+	status := h.status()
+	accepted := false
+	for _, acceptance := range history {
+		if acceptance.Version == h.config.Version {
+			accepted = true
+		}
+	}
+	status.Accepted = &accepted
+	status.History = history
+	c.JSON(http.StatusOK, status)
+}
+
+// AcceptTerms records the user accepting the current terms
+func (h *TermsHandler) AcceptTerms(c *gin.Context) {
+	var req models.AcceptTermsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Version != h.config.Version {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":         "Only the current terms can be accepted",
+			"terms_version": h.config.Version,
+		})
+		return
+	}
+
+	userID := middleware.GetUserID(c)
+	acceptance, err := h.store.Accept(c.Request.Context(), userID, models.TermsAcceptance{
+		Version:   req.Version,
+		IPAddress: c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record terms acceptance"})
+		return
+	}
+
+	log.Printf("📜 User %s accepted terms %s", userID, req.Version)
+	recordAudit(c, h.outbox, "terms.accepted", userID, acceptance)
+	c.JSON(http.StatusOK, acceptance)
+}
+
+func (h *TermsHandler) status() models.TermsStatus {
+	return models.TermsStatus{
+		Version:    h.config.Version,
+		TermsURL:   h.config.TermsURL,
+		PrivacyURL: h.config.PrivacyURL,
+		Required:   h.config.Required,
+	}
+}
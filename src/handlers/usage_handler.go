@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+const (
+	defaultUsageDays   = 30
+	maxUsageDays       = 365
+	defaultUsageMonths = 12
+	maxUsageMonths     = 36
+)
+
+// UsageHandler reports the authenticated user's token usage and spend
+type UsageHandler struct {
+	store *usage.Store
+}
+
+func NewUsageHandler(store *usage.Store) *UsageHandler {
+	return &UsageHandler{
+		store: store,
+	}
+}
+
+// GetUsage returns today's and this month's totals
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	ctx := c.Request.Context()
+	userID := middleware.GetUserID(c)
+
+	today, err := h.store.Today(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+	month, err := h.store.ThisMonth(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id":    userID,
+		"today":      today,
+		"this_month": month,
+	})
+}
+
+// GetUsageHistory returns per-period totals, newest first.
+// Query params: period ("day" or "month") and limit (number of periods).
+func (h *UsageHandler) GetUsageHistory(c *gin.Context) {
+	period := c.DefaultQuery("period", "day")
+
+	var defaultLimit, maxLimit int
+	switch period {
+	case "day":
+		defaultLimit, maxLimit = defaultUsageDays, maxUsageDays
+	case "month":
+		defaultLimit, maxLimit = defaultUsageMonths, maxUsageMonths
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period must be \"day\" or \"month\""})
+		return
+	}
+
+	limit := defaultLimit
+	if raw := c.Query("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > maxLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxLimit)})
+			return
+		}
+		limit = n
+	}
+
+	ctx := c.Request.Context()
+	userID := middleware.GetUserID(c)
+
+	var history []models.UsageSummary
+	var err error
+	if period == "day" {
+		history, err = h.store.DailyHistory(ctx, userID, limit)
+	} else {
+		history, err = h.store.MonthlyHistory(ctx, userID, limit)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get usage history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":  period,
+		"history": history,
+	})
+}
+
+// recordUsage adds a request's cost metrics to the user's usage ledger, if one is configured
+func recordUsage(c *gin.Context, store *usage.Store, metrics *models.CostMetrics, cacheHit bool) {
+	if store == nil {
+		return
+	}
+	// Record even if the client has already disconnected
+	ctx := context.WithoutCancel(c.Request.Context())
+	if err := store.Record(ctx, middleware.GetUserID(c), metrics, cacheHit); err != nil {
+		log.Printf("Failed to record usage: %v", err)
+	}
+}
+
+// recordSpend adds what a request's model calls cost to the spend of the
+// provider keys they used, if spend caps are configured
+func recordSpend(c *gin.Context, caps *usage.SpendCaps, useLLM bool, metrics *models.CostMetrics) {
+	if caps == nil || metrics == nil {
+		return
+	}
+	ctx := context.WithoutCancel(c.Request.Context())
+	if err := caps.Record(ctx, useLLM, metrics.Cost); err != nil {
+		log.Printf("Failed to record spend: %v", err)
+	}
+	// Chat sessions are compacted by the LLM
+	if err := caps.Record(ctx, true, metrics.SummarizationCost); err != nil {
+		log.Printf("Failed to record spend: %v", err)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/auth"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+// UsersHandler lets admins list users and deactivate them
+type UsersHandler struct {
+	users  *auth.UserStore
+	outbox *outbox.Outbox
+}
+
+func NewUsersHandler(users *auth.UserStore) *UsersHandler {
+	return &UsersHandler{
+		users: users,
+	}
+}
+
+// SetOutbox records deactivations as audit events
+func (h *UsersHandler) SetOutbox(o *outbox.Outbox) {
+	h.outbox = o
+}
+
+// ListUsers returns every user with their role
+func (h *UsersHandler) ListUsers(c *gin.Context) {
+	users, err := h.users.ListUsers(c.Request.Context())
+	if err != nil {
+		log.Printf("Failed to list users: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list users"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"users": users})
+}
+
+// DeactivateUser locks a user out of every session, token and API key
+func (h *UsersHandler) DeactivateUser(c *gin.Context) {
+	userID := c.Param("user_id")
+	if userID == middleware.GetUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Admins can't deactivate themselves"})
+		return
+	}
+	h.setDeactivated(c, userID, true)
+}
+
+// ReactivateUser lets a deactivated user back in
+func (h *UsersHandler) ReactivateUser(c *gin.Context) {
+	h.setDeactivated(c, c.Param("user_id"), false)
+}
+
+func (h *UsersHandler) setDeactivated(c *gin.Context, userID string, deactivated bool) {
+	user, err := h.users.SetDeactivated(c.Request.Context(), userID, deactivated)
+	if errors.Is(err, auth.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update user %s: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		return
+	}
+
+	action := "user.reactivated"
+	if deactivated {
+		action = "user.deactivated"
+	}
+	recordAudit(c, h.outbox, action, middleware.GetUserID(c), gin.H{"user_id": userID})
+	c.JSON(http.StatusOK, user)
+}
@@ -0,0 +1,25 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/supervisor"
+)
+
+// WorkersHandler is the admin API for supervised background workers
+type WorkersHandler struct {
+	supervisor *supervisor.Supervisor
+}
+
+func NewWorkersHandler(s *supervisor.Supervisor) *WorkersHandler {
+	return &WorkersHandler{
+		supervisor: s,
+	}
+}
+
+// ListWorkers returns each worker's state, panic counts and restarts
+func (h *WorkersHandler) ListWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"workers": h.supervisor.Workers()})
+}
@@ -0,0 +1,150 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+)
+
+// Dependency statuses
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+const (
+	defaultProbeTTL     = 30 * time.Second
+	defaultProbeTimeout = 5 * time.Second
+)
+
+// Probe checks that a dependency is reachable
+type Probe func(ctx context.Context) error
+
+// DependencyStatus is the outcome of a dependency's latest probe
+type DependencyStatus struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"` // The service isn't ready while it's down
+	Error     string    `json:"error,omitempty"`
+	LatencyMs float64   `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+type probe struct {
+	name     string
+	critical bool
+	fn       Probe
+}
+
+// Checker probes the service's dependencies. Results are reused for a TTL
+// so frequent health checks don't hammer Redis and the model providers.
+type Checker struct {
+	mu      sync.Mutex // Held while probing, so concurrent checks share one round
+	probes  []probe
+	ttl     time.Duration
+	timeout time.Duration
+	clock   clock.Clock
+	results map[string]DependencyStatus
+}
+
+func NewChecker(ttl time.Duration, timeout time.Duration) *Checker {
+	if ttl <= 0 {
+		ttl = defaultProbeTTL
+	}
+	if timeout <= 0 {
+		timeout = defaultProbeTimeout
+	}
+	return &Checker{
+		ttl:     ttl,
+		timeout: timeout,
+		clock:   clock.Real(),
+		results: make(map[string]DependencyStatus),
+	}
+}
+
+// SetClock sets the clock probe results are timed and expired with
+func (c *Checker) SetClock(clk clock.Clock) {
+	c.clock = clk
+}
+
+// Add registers a dependency's probe
+func (c *Checker) Add(name string, critical bool, fn Probe) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.probes = append(c.probes, probe{name: name, critical: critical, fn: fn})
+}
+
+// Check returns the status of every dependency, probing those whose last
+// result is older than the TTL
+func (c *Checker) Check(ctx context.Context) map[string]DependencyStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	var wg sync.WaitGroup
+	var resultsMu sync.Mutex
+	for _, p := range c.probes {
+		if result, ok := c.results[p.name]; ok && now.Sub(result.CheckedAt) < c.ttl {
+			continue
+		}
+
+		wg.Add(1)
+		go func(p probe) {
+			defer wg.Done()
+			result := c.probe(ctx, p)
+			resultsMu.Lock()
+			c.results[p.name] = result
+			resultsMu.Unlock()
+		}(p)
+	}
+	wg.Wait()
+
+	statuses := make(map[string]DependencyStatus, len(c.results))
+	for name, result := range c.results {
+		statuses[name] = result
+	}
+	return statuses
+}
+
+func (c *Checker) probe(ctx context.Context, p probe) DependencyStatus {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := c.clock.Now()
+	err := p.fn(ctx)
+	end := c.clock.Now()
+
+	result := DependencyStatus{
+		Status:    StatusUp,
+		Critical:  p.critical,
+		LatencyMs: float64(end.Sub(start).Microseconds()) / 1000,
+		CheckedAt: end,
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Ready reports whether every critical dependency is up
+func Ready(statuses map[string]DependencyStatus) bool {
+	for _, status := range statuses {
+		if status.Critical && status.Status != StatusUp {
+			return false
+		}
+	}
+	return true
+}
+
+// AllUp reports whether every dependency is up
+func AllUp(statuses map[string]DependencyStatus) bool {
+	for _, status := range statuses {
+		if status.Status != StatusUp {
+			return false
+		}
+	}
+	return true
+}
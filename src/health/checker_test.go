@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+)
+
+func TestChecker_ReusesResultsForTTL(t *testing.T) {
+	clk := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	checker := NewChecker(30*time.Second, time.Second)
+	checker.SetClock(clk)
+
+	redisCalls, llmCalls := 0, 0
+	var llmErr error
+	checker.Add("redis", true, func(ctx context.Context) error {
+		redisCalls++
+		return nil
+	})
+	checker.Add("llm", false, func(ctx context.Context) error {
+		llmCalls++
+		return llmErr
+	})
+
+	statuses := checker.Check(context.Background())
+	assert.Equal(t, StatusUp, statuses["redis"].Status)
+	assert.True(t, Ready(statuses))
+	assert.True(t, AllUp(statuses))
+
+	llmErr = errors.New("connection refused")
+	clk.Advance(10 * time.Second)
+	statuses = checker.Check(context.Background())
+	assert.Equal(t, StatusUp, statuses["llm"].Status, "the cached result is reused")
+	assert.Equal(t, 1, llmCalls)
+
+	clk.Advance(30 * time.Second)
+	statuses = checker.Check(context.Background())
+	assert.Equal(t, 2, redisCalls)
+	assert.Equal(t, StatusDown, statuses["llm"].Status)
+	assert.Equal(t, "connection refused", statuses["llm"].Error)
+	assert.True(t, Ready(statuses), "the LLM isn't critical")
+	assert.False(t, AllUp(statuses))
+}
+
+func TestChecker_CriticalDependencyDown(t *testing.T) {
+	checker := NewChecker(0, 10*time.Millisecond)
+	checker.Add("redis", true, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	statuses := checker.Check(context.Background())
+	assert.Equal(t, StatusDown, statuses["redis"].Status)
+	assert.False(t, Ready(statuses))
+}
@@ -0,0 +1,65 @@
+package health
+
+import (
+	"sync"
+)
+
+// Component statuses
+const (
+	StatusReady    = "ready"
+	StatusStarting = "starting" // Initialized lazily, not used yet
+	StatusDisabled = "disabled" // Turned off in config
+	StatusDegraded = "degraded" // Enabled but unavailable; the service runs without it
+)
+
+// ComponentStatus is the state of one subsystem as reported by the health check
+type ComponentStatus struct {
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Registry tracks the status of optional subsystems so the health check can
+// report what the service is running without
+type Registry struct {
+	mu         sync.RWMutex
+	components map[string]ComponentStatus
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		components: make(map[string]ComponentStatus),
+	}
+}
+
+// Set records a component's status
+func (r *Registry) Set(name string, status string, detail string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.components[name] = ComponentStatus{Status: status, Detail: detail}
+}
+
+// Snapshot returns a copy of every component's status
+func (r *Registry) Snapshot() map[string]ComponentStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	snapshot := make(map[string]ComponentStatus, len(r.components))
+	for name, status := range r.components {
+		snapshot[name] = status
+	}
+	return snapshot
+}
+
+// Degraded reports whether any enabled component is unavailable
+func (r *Registry) Degraded() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, status := range r.components {
+		if status.Status == StatusDegraded {
+			return true
+		}
+	}
+	return false
+}
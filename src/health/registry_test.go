@@ -0,0 +1,18 @@
+package health
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Degraded(t *testing.T) {
+	registry := NewRegistry()
+	registry.Set("llm", StatusDisabled, "")
+	registry.Set("semantic_cache", StatusStarting, "connects on first use")
+	assert.False(t, registry.Degraded(), "disabled and starting components aren't degraded")
+
+	registry.Set("semantic_cache", StatusDegraded, "index unavailable")
+	assert.True(t, registry.Degraded())
+	assert.Equal(t, ComponentStatus{Status: StatusDegraded, Detail: "index unavailable"}, registry.Snapshot()["semantic_cache"])
+}
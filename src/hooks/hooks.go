@@ -0,0 +1,145 @@
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Stage is an extension point in request handling
+type Stage string
+
+const (
+	PreRoute     Stage = "pre_route"     // Request received, before cache lookup and routing
+	PostRoute    Stage = "post_route"    // Routing decided, before inference
+	PreCache     Stage = "pre_cache"     // Fresh response built, before it is cached
+	PostResponse Stage = "post_response" // Before the response (fresh or cached) is sent
+)
+
+// Stages lists every extension point in the order they run
+var Stages = []Stage{PreRoute, PostRoute, PreCache, PostResponse}
+
+// Payload is what hooks see. Hooks may modify the request, decision and
+// response in place; which fields are set depends on the stage and endpoint.
+type Payload struct {
+	Stage        Stage                     `json:"stage"`
+	UserID       string                    `json:"user_id,omitempty"`
+	SessionID    string                    `json:"session_id,omitempty"`    // Chat only
+	Request      *models.InferenceRequest  `json:"request"`                 // Every stage
+	Decision     *models.RoutingDecision   `json:"decision,omitempty"`      // post_route onwards, except for cache hits
+	Response     *models.InferenceResponse `json:"response,omitempty"`      // pre_cache and post_response
+	ChatResponse *models.ChatResponse      `json:"chat_response,omitempty"` // post_response on /chat
+}
+
+// Hook is custom logic run at one or more stages. Returning a *Rejection stops
+// the request; any other error is logged and the request carries on.
+type Hook interface {
+	Name() string
+	Run(ctx context.Context, payload *Payload) error
+}
+
+type funcHook struct {
+	name string
+	fn   func(ctx context.Context, payload *Payload) error
+}
+
+// Func adapts a function to a Hook
+func Func(name string, fn func(ctx context.Context, payload *Payload) error) Hook {
+	return &funcHook{name: name, fn: fn}
+}
+
+func (h *funcHook) Name() string {
+	return h.name
+}
+
+func (h *funcHook) Run(ctx context.Context, payload *Payload) error {
+	return h.fn(ctx, payload)
+}
+
+// Rejection stops a request with the given HTTP status and message
+type Rejection struct {
+	Status  int    `json:"status"`
+	Message string `json:"message"`
+}
+
+func (r *Rejection) Error() string {
+	return fmt.Sprintf("rejected with %d: %s", r.Status, r.Message)
+}
+
+// Reject returns a Rejection, defaulting to 403 Forbidden
+func Reject(status int, message string) *Rejection {
+	if status == 0 {
+		status = http.StatusForbidden
+	}
+	return &Rejection{Status: status, Message: message}
+}
+
+// Manager runs registered hooks at each stage, in registration order
+type Manager struct {
+	mu    sync.RWMutex
+	hooks map[Stage][]Hook
+}
+
+func NewManager() *Manager {
+	return &Manager{
+		hooks: make(map[Stage][]Hook),
+	}
+}
+
+// Register adds a hook to a stage
+func (m *Manager) Register(stage Stage, hook Hook) error {
+	if !slices.Contains(Stages, stage) {
+		return fmt.Errorf("unknown hook stage %q (supported: %v)", stage, Stages)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks[stage] = append(m.hooks[stage], hook)
+	return nil
+}
+
+// Len returns the number of registered hooks across all stages
+func (m *Manager) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	n := 0
+	for _, hooks := range m.hooks {
+		n += len(hooks)
+	}
+	return n
+}
+
+// Run runs a stage's hooks. It returns the *Rejection of the first hook that
+// rejects the request; other hook errors are logged. A nil manager runs nothing.
+func (m *Manager) Run(ctx context.Context, stage Stage, payload *Payload) error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	hooks := m.hooks[stage]
+	m.mu.RUnlock()
+
+	payload.Stage = stage
+	for _, hook := range hooks {
+		err := hook.Run(ctx, payload)
+		if err == nil {
+			continue
+		}
+
+		var rejection *Rejection
+		if errors.As(err, &rejection) {
+			return rejection
+		}
+		log.Printf("Hook %s failed at %s: %v", hook.Name(), stage, err)
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package hooks
+
+import (
+	"fmt"
+	"plugin"
+)
+
+// PluginSymbol is the function a Go plugin must export to register its hooks:
+//
+//	func RegisterHooks(m *hooks.Manager) error
+//
+// Plugins are built with -buildmode=plugin against the same version of this
+// module and loaded once at startup.
+const PluginSymbol = "RegisterHooks"
+
+// LoadPlugin opens a Go plugin and lets it register its hooks
+func LoadPlugin(path string, m *Manager) error {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open plugin %s: %w", path, err)
+	}
+
+	symbol, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return fmt.Errorf("plugin %s doesn't export %s: %w", path, PluginSymbol, err)
+	}
+
+	register, ok := symbol.(func(*Manager) error)
+	if !ok {
+		return fmt.Errorf("plugin %s: %s must be func(*hooks.Manager) error, got %T", path, PluginSymbol, symbol)
+	}
+	if err := register(m); err != nil {
+		return fmt.Errorf("plugin %s failed to register hooks: %w", path, err)
+	}
+	return nil
+}
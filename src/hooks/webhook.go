@@ -0,0 +1,144 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const (
+	defaultWebhookTimeout = 2 * time.Second
+
+	// SignatureHeader carries the hex HMAC-SHA256 of the body when a secret is configured
+	SignatureHeader = "X-HybridLM-Signature"
+)
+
+// webhookReply is what a webhook may answer with. Every field is optional:
+// request, decision and response are merged into the payload, and reject stops
+// the request. An empty body (or 204) leaves the payload unchanged.
+type webhookReply struct {
+	Request      json.RawMessage `json:"request"`
+	Decision     json.RawMessage `json:"decision"`
+	Response     json.RawMessage `json:"response"`
+	ChatResponse json.RawMessage `json:"chat_response"`
+	Reject       *Rejection      `json:"reject"`
+}
+
+// WebhookHook POSTs the payload as JSON to an external service, which can
+// inspect it, modify it or reject the request
+type WebhookHook struct {
+	name       string
+	url        string
+	secret     []byte
+	failClosed bool
+	client     *http.Client
+}
+
+func NewWebhookHook(cfg *config.WebhookHookConfig) *WebhookHook {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+
+	return &WebhookHook{
+		name:       cfg.Name,
+		url:        cfg.URL,
+		secret:     []byte(cfg.Secret),
+		failClosed: cfg.FailClosed,
+		client:     &http.Client{Timeout: timeout},
+	}
+}
+
+func (w *WebhookHook) Name() string {
+	return w.name
+}
+
+// Run calls the webhook. If it can't be reached or answers with an error the
+// request carries on, unless the hook is fail-closed, in which case it is
+// rejected with 503.
+func (w *WebhookHook) Run(ctx context.Context, payload *Payload) error {
+	err := w.call(ctx, payload)
+	var rejection *Rejection
+	if err != nil && w.failClosed && !errors.As(err, &rejection) {
+		log.Printf("Fail-closed hook %s failed, rejecting request: %v", w.name, err)
+		return Reject(http.StatusServiceUnavailable, fmt.Sprintf("hook %s unavailable", w.name))
+	}
+	return err
+}
+
+func (w *WebhookHook) call(ctx context.Context, payload *Payload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal hook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create hook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(w.secret) > 0 {
+		mac := hmac.New(sha256.New, w.secret)
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("hook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("hook returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read hook response: %w", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+
+	var reply webhookReply
+	if err := json.Unmarshal(data, &reply); err != nil {
+		return fmt.Errorf("invalid hook response: %w", err)
+	}
+	if reply.Reject != nil {
+		return Reject(reply.Reject.Status, reply.Reject.Message)
+	}
+
+	// Decoding into the existing values merges the fields the hook returned
+	if err := merge(reply.Request, payload.Request); err != nil {
+		return err
+	}
+	if err := merge(reply.Decision, payload.Decision); err != nil {
+		return err
+	}
+	if err := merge(reply.Response, payload.Response); err != nil {
+		return err
+	}
+	return merge(reply.ChatResponse, payload.ChatResponse)
+}
+
+func merge[T any](data json.RawMessage, target *T) error {
+	if len(data) == 0 || target == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("invalid hook response: %w", err)
+	}
+	return nil
+}
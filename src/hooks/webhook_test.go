@@ -0,0 +1,93 @@
+package hooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestWebhookHook_MergesReply(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), r.Header.Get(SignatureHeader))
+
+		var payload Payload
+		require.NoError(t, json.Unmarshal(body, &payload))
+		assert.Equal(t, PostRoute, payload.Stage)
+
+		_, _ = w.Write([]byte(`{"decision": {"use_llm": true, "reason": "VIP user"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	manager := NewManager()
+	require.NoError(t, manager.Register(PostRoute, NewWebhookHook(&config.WebhookHookConfig{Name: "vip", URL: server.URL, Secret: "s3cret"})))
+
+	payload := &Payload{
+		Request:  &models.InferenceRequest{Query: "hi"},
+		Decision: &models.RoutingDecision{ComplexityScore: 0.1, Reason: "Simple query"},
+	}
+	require.NoError(t, manager.Run(context.Background(), PostRoute, payload))
+
+	assert.True(t, payload.Decision.UseLLM)
+	assert.Equal(t, "VIP user", payload.Decision.Reason)
+	assert.Equal(t, 0.1, payload.Decision.ComplexityScore, "fields the hook didn't return are kept")
+	assert.Equal(t, "hi", payload.Request.Query)
+}
+
+func TestWebhookHook_Reject(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"reject": {"status": 451, "message": "blocked in your region"}}`))
+	}))
+	t.Cleanup(server.Close)
+
+	manager := NewManager()
+	require.NoError(t, manager.Register(PreRoute, NewWebhookHook(&config.WebhookHookConfig{Name: "geo", URL: server.URL})))
+
+	err := manager.Run(context.Background(), PreRoute, &Payload{Request: &models.InferenceRequest{}})
+
+	var rejection *Rejection
+	require.True(t, errors.As(err, &rejection))
+	assert.Equal(t, 451, rejection.Status)
+	assert.Equal(t, "blocked in your region", rejection.Message)
+}
+
+func TestWebhookHook_FailurePolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(server.Close)
+
+	payload := &Payload{Request: &models.InferenceRequest{}}
+
+	openManager := NewManager()
+	require.NoError(t, openManager.Register(PreRoute, NewWebhookHook(&config.WebhookHookConfig{Name: "audit", URL: server.URL})))
+	assert.NoError(t, openManager.Run(context.Background(), PreRoute, payload), "fail-open hooks don't block requests")
+
+	closedManager := NewManager()
+	require.NoError(t, closedManager.Register(PreRoute, NewWebhookHook(&config.WebhookHookConfig{Name: "policy", URL: server.URL, FailClosed: true})))
+	err := closedManager.Run(context.Background(), PreRoute, payload)
+
+	var rejection *Rejection
+	require.True(t, errors.As(err, &rejection))
+	assert.Equal(t, http.StatusServiceUnavailable, rejection.Status)
+}
+
+func TestManager_RejectsUnknownStage(t *testing.T) {
+	err := NewManager().Register("pre_flight", Func("noop", func(ctx context.Context, p *Payload) error { return nil }))
+	assert.ErrorContains(t, err, `unknown hook stage "pre_flight"`)
+}
@@ -0,0 +1,303 @@
+// Package hybridllm is a langchaingo llms.Model backed by a HybridLM server,
+// so applications built on langchaingo get its routing, caching and
+// failover by swapping it in for their model:
+//
+//	llm := hybridllm.New("https://hybridlm.example.com", os.Getenv("HYBRIDLM_API_KEY"))
+//	answer, err := llms.GenerateFromSinglePrompt(ctx, llm, "What is a mutex?")
+package hybridllm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const inferencePath = "/api/v1/inference"
+
+// ErrNoQuery is returned when the messages end without a human message to answer
+var ErrNoQuery = errors.New("the last message must be a human message")
+
+// APIError is an error response from the server
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("hybridlm: %s (status %d)", e.Message, e.StatusCode)
+}
+
+// LLM sends langchaingo calls to a HybridLM server's inference endpoint.
+// llms.WithModel takes "llm", "slm" or "auto" to override routing, or a
+// served model's name. Each choice's GenerationInfo has the model that
+// answered, its tier, the routing reason, whether it came from the cache, its
+// cost and, when the server signs them, its receipt.
+type LLM struct {
+	baseURL         string
+	apiKey          string
+	client          *http.Client
+	modelPreference string
+}
+
+var _ llms.Model = (*LLM)(nil)
+
+// New returns a model for the server at baseURL, authenticating with an API
+// key ("" when the server has authentication disabled)
+func New(baseURL string, apiKey string) *LLM {
+	return &LLM{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  http.DefaultClient,
+	}
+}
+
+// SetHTTPClient sets the client requests are sent with
+func (l *LLM) SetHTTPClient(client *http.Client) {
+	l.client = client
+}
+
+// SetModelPreference sets the tier calls without llms.WithModel ask for:
+// "llm", "slm" or "auto" (the default)
+func (l *LLM) SetModelPreference(preference string) {
+	l.modelPreference = preference
+}
+
+// Call implements the deprecated single-prompt method of llms.Model
+func (l *LLM) Call(ctx context.Context, prompt string, options ...llms.CallOption) (string, error) {
+	return llms.GenerateFromSinglePrompt(ctx, l, prompt, options...)
+}
+
+// GenerateContent answers the last message, a human one, with the messages
+// before it as the conversation so far. Only text parts are supported.
+func (l *LLM) GenerateContent(ctx context.Context, messages []llms.MessageContent, options ...llms.CallOption) (*llms.ContentResponse, error) {
+	opts := llms.CallOptions{}
+	for _, option := range options {
+		option(&opts)
+	}
+
+	req, err := l.inferenceRequest(messages, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp *models.InferenceResponse
+	if opts.StreamingFunc != nil {
+		resp, err = l.stream(ctx, req, opts.StreamingFunc)
+	} else {
+		resp, err = l.infer(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	info := map[string]any{
+		"model_used":     resp.ModelUsed,
+		"tier":           resp.Tier,
+		"routing_reason": resp.RoutingReason,
+		"cache_hit":      resp.CacheHit,
+	}
+	if resp.CostMetrics != nil {
+		info["cost"] = resp.CostMetrics.TotalCost
+	}
+	if resp.Receipt != nil {
+		info["receipt"] = resp.Receipt
+	}
+	return &llms.ContentResponse{
+		Choices: []*llms.ContentChoice{{
+			Content:        resp.Response,
+			StopReason:     "stop",
+			GenerationInfo: info,
+		}},
+	}, nil
+}
+
+func (l *LLM) inferenceRequest(messages []llms.MessageContent, opts llms.CallOptions) (*models.InferenceRequest, error) {
+	if len(messages) == 0 || messages[len(messages)-1].Role != llms.ChatMessageTypeHuman {
+		return nil, ErrNoQuery
+	}
+
+	req := &models.InferenceRequest{
+		MaxTokens:       opts.MaxTokens,
+		Temperature:     float32(opts.Temperature),
+		ModelPreference: l.modelPreference,
+	}
+	switch opts.Model {
+	case "":
+	case "llm", "slm", "auto":
+		req.ModelPreference = opts.Model
+	default:
+		req.Model = opts.Model
+		req.ModelPreference = "auto"
+	}
+	if opts.JSONMode {
+		req.ResponseFormat = "json_object"
+	}
+	if len(opts.Metadata) > 0 {
+		req.Metadata = make(map[string]string, len(opts.Metadata))
+		for key, value := range opts.Metadata {
+			req.Metadata[key] = fmt.Sprint(value)
+		}
+	}
+
+	for i, message := range messages {
+		text, err := messageText(message)
+		if err != nil {
+			return nil, err
+		}
+		if i == len(messages)-1 {
+			req.Query = text
+			break
+		}
+
+		role, err := chatRole(message.Role)
+		if err != nil {
+			return nil, err
+		}
+		req.Messages = append(req.Messages, models.ChatMessage{Role: role, Content: text})
+	}
+	return req, nil
+}
+
+// infer makes a regular request and decodes the JSON response
+func (l *LLM) infer(ctx context.Context, req *models.InferenceRequest) (*models.InferenceResponse, error) {
+	httpResp, err := l.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	var resp models.InferenceResponse
+	if err := json.NewDecoder(httpResp.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return &resp, nil
+}
+
+// stream makes a streaming request, passing each token event's text to fn,
+// and returns the final "done" event's response
+func (l *LLM) stream(ctx context.Context, req *models.InferenceRequest, fn func(ctx context.Context, chunk []byte) error) (*models.InferenceResponse, error) {
+	req.Stream = true
+	httpResp, err := l.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	scanner := bufio.NewScanner(httpResp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "event:"); ok {
+			event = strings.TrimSpace(name)
+			continue
+		}
+		data, ok := strings.CutPrefix(line, "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+
+		switch event {
+		case "token":
+			var token struct {
+				Content string `json:"content"`
+			}
+			if err := json.Unmarshal([]byte(data), &token); err != nil {
+				return nil, fmt.Errorf("failed to decode token: %w", err)
+			}
+			if err := fn(ctx, []byte(token.Content)); err != nil {
+				return nil, err
+			}
+		case "done":
+			var resp models.InferenceResponse
+			if err := json.Unmarshal([]byte(data), &resp); err != nil {
+				return nil, fmt.Errorf("failed to decode response: %w", err)
+			}
+			return &resp, nil
+		case "error":
+			return nil, &APIError{StatusCode: httpResp.StatusCode, Message: errorMessage([]byte(data))}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read stream: %w", err)
+	}
+	return nil, errors.New("stream ended without a response")
+}
+
+// post sends an inference request, returning an *APIError for error statuses
+func (l *LLM) post(ctx context.Context, req *models.InferenceRequest) (*http.Response, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, l.baseURL+inferencePath, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if l.apiKey != "" {
+		httpReq.Header.Set("X-API-Key", l.apiKey)
+	}
+
+	httpResp, err := l.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call HybridLM: %w", err)
+	}
+	if httpResp.StatusCode >= 400 {
+		defer httpResp.Body.Close()
+		data, _ := io.ReadAll(io.LimitReader(httpResp.Body, 64*1024))
+		return nil, &APIError{StatusCode: httpResp.StatusCode, Message: errorMessage(data)}
+	}
+	return httpResp, nil
+}
+
+func messageText(message llms.MessageContent) (string, error) {
+	var sb strings.Builder
+	for _, part := range message.Parts {
+		text, ok := part.(llms.TextContent)
+		if !ok {
+			return "", fmt.Errorf("unsupported %T message part", part)
+		}
+		sb.WriteString(text.Text)
+	}
+	return sb.String(), nil
+}
+
+func chatRole(role llms.ChatMessageType) (string, error) {
+	switch role {
+	case llms.ChatMessageTypeSystem:
+		return "system", nil
+	case llms.ChatMessageTypeHuman, llms.ChatMessageTypeGeneric:
+		return "user", nil
+	case llms.ChatMessageTypeAI:
+		return "assistant", nil
+	default:
+		return "", fmt.Errorf("unsupported %s message", role)
+	}
+}
+
+// errorMessage returns the "error" field of a JSON error body, or the body
+func errorMessage(body []byte) string {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(body, &resp) == nil && resp.Error != "" {
+		return resp.Error
+	}
+	if len(body) == 0 {
+		return "request failed"
+	}
+	return strings.TrimSpace(string(body))
+}
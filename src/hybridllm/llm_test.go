@@ -0,0 +1,98 @@
+package hybridllm
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupTestServer(t *testing.T, received *models.InferenceRequest) *LLM {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST(inferencePath, func(c *gin.Context) {
+		if c.GetHeader("X-API-Key") != "hlm_test" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+			return
+		}
+		require.NoError(t, c.ShouldBindJSON(received))
+		resp := models.InferenceResponse{Response: "Hello there", ModelUsed: "llama-3.1-8b", Tier: "edge-slm"}
+		if !received.Stream {
+			c.JSON(http.StatusOK, resp)
+			return
+		}
+		c.SSEvent("token", gin.H{"content": "Hello"})
+		c.SSEvent("token", gin.H{"content": " there"})
+		c.SSEvent("done", resp)
+	})
+
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return New(server.URL+"/", "hlm_test")
+}
+
+func TestLLM_GenerateContent(t *testing.T) {
+	var received models.InferenceRequest
+	llm := setupTestServer(t, &received)
+
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "Be brief."),
+		llms.TextParts(llms.ChatMessageTypeHuman, "Hi"),
+		llms.TextParts(llms.ChatMessageTypeAI, "Hello!"),
+		llms.TextParts(llms.ChatMessageTypeHuman, "How are you?"),
+	}, llms.WithModel("slm"), llms.WithMaxTokens(100))
+	require.NoError(t, err)
+
+	assert.Equal(t, "How are you?", received.Query)
+	assert.Equal(t, "slm", received.ModelPreference)
+	assert.Equal(t, 100, received.MaxTokens)
+	require.Len(t, received.Messages, 3)
+	assert.Equal(t, "system", received.Messages[0].Role)
+	assert.Equal(t, "assistant", received.Messages[2].Role)
+
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "Hello there", resp.Choices[0].Content)
+	assert.Equal(t, "edge-slm", resp.Choices[0].GenerationInfo["tier"])
+}
+
+func TestLLM_Streaming(t *testing.T) {
+	var received models.InferenceRequest
+	llm := setupTestServer(t, &received)
+
+	var chunks []string
+	resp, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "Hi"),
+	}, llms.WithStreamingFunc(func(ctx context.Context, chunk []byte) error {
+		chunks = append(chunks, string(chunk))
+		return nil
+	}))
+	require.NoError(t, err)
+
+	assert.True(t, received.Stream)
+	assert.Equal(t, []string{"Hello", " there"}, chunks)
+	assert.Equal(t, "Hello there", resp.Choices[0].Content)
+}
+
+func TestLLM_Errors(t *testing.T) {
+	var received models.InferenceRequest
+	llm := setupTestServer(t, &received)
+
+	_, err := llm.GenerateContent(context.Background(), []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeAI, "Hello!"),
+	})
+	assert.ErrorIs(t, err, ErrNoQuery)
+
+	llm.apiKey = "hlm_wrong"
+	_, err = llm.Call(context.Background(), "Hi")
+	var apiErr *APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusUnauthorized, apiErr.StatusCode)
+	assert.Equal(t, "Invalid API key", apiErr.Message)
+}
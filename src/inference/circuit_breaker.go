@@ -0,0 +1,174 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/privacy"
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without calling the provider while its circuit is open
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// Circuit breaker states
+const (
+	CircuitClosed   = "closed"
+	CircuitOpen     = "open"
+	CircuitHalfOpen = "half-open"
+)
+
+// CircuitBreaker tracks the health of one inference tier. After
+// failureThreshold consecutive failures it opens and rejects calls for
+// openDuration, then lets a single probe through (half-open) to decide
+// whether to close again.
+type CircuitBreaker struct {
+	name             string
+	failureThreshold int
+	openDuration     time.Duration
+
+	mu            sync.Mutex
+	state         string
+	failures      int
+	openedAt      time.Time
+	probeInFlight bool
+	clock         clock.Clock
+}
+
+func NewCircuitBreaker(name string, cfg config.FailoverConfig) *CircuitBreaker {
+	threshold := cfg.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultFailureThreshold
+	}
+	openDuration := cfg.OpenDuration
+	if openDuration <= 0 {
+		openDuration = defaultOpenDuration
+	}
+
+	return &CircuitBreaker{
+		name:             name,
+		failureThreshold: threshold,
+		openDuration:     openDuration,
+		state:            CircuitClosed,
+		clock:            clock.Real(),
+	}
+}
+
+// SetClock sets the clock that times how long the circuit stays open
+func (b *CircuitBreaker) SetClock(c clock.Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.clock = c
+}
+
+// Name returns the tier the breaker protects
+func (b *CircuitBreaker) Name() string {
+	return b.name
+}
+
+// State returns the current breaker state
+func (b *CircuitBreaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == CircuitOpen && b.clock.Now().Sub(b.openedAt) >= b.openDuration {
+		return CircuitHalfOpen
+	}
+	return b.state
+}
+
+// Wrap returns an infer func that fails fast with ErrCircuitOpen while the
+// circuit is open and records the outcome of every call it lets through.
+// Calls from orgs with their own keys bypass it, so one org's revoked key
+// can't open the circuit for everyone. A nil breaker returns infer unchanged.
+func (b *CircuitBreaker) Wrap(
+	infer func(ctx context.Context, req *models.InferenceRequest) (string, error),
+) func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	if b == nil {
+		return infer
+	}
+	return func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		if credentials.FromContext(ctx) != nil {
+			return infer(ctx, req)
+		}
+		if !b.allow() {
+			return "", fmt.Errorf("%s: %w", b.name, ErrCircuitOpen)
+		}
+		response, err := infer(ctx, req)
+		b.record(err)
+		return response, err
+	}
+}
+
+func (b *CircuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case CircuitOpen:
+		if b.clock.Now().Sub(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probeInFlight = true
+		return true
+	case CircuitHalfOpen:
+		// Only one probe at a time
+		if b.probeInFlight {
+			return false
+		}
+		b.probeInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *CircuitBreaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probeInFlight = false
+
+	switch {
+	case err == nil:
+		b.state = CircuitClosed
+		b.failures = 0
+	case !IsProviderFailure(err):
+		// Says nothing about the provider's health
+	case b.state == CircuitHalfOpen:
+		b.state = CircuitOpen
+		b.openedAt = b.clock.Now()
+	default:
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.state = CircuitOpen
+			b.openedAt = b.clock.Now()
+		}
+	}
+}
+
+// IsProviderFailure reports whether an error reflects on the provider's
+// health, as opposed to the request (too large, personal data blocked) or
+// the client (cancelled)
+func IsProviderFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, ErrPromptTooLarge) || errors.Is(err, credentials.ErrNoKey) || errors.Is(err, privacy.ErrBlocked) || isContextLengthError(err) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestCircuitBreaker_OpensAndRecovers(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	breaker := NewCircuitBreaker("cloud-llm", config.FailoverConfig{FailureThreshold: 2, OpenDuration: 30 * time.Second})
+	breaker.SetClock(fakeClock)
+
+	providerErr := errors.New("502 bad gateway")
+	calls := 0
+	var result error
+	infer := breaker.Wrap(func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		calls++
+		return "ok", result
+	})
+	req := &models.InferenceRequest{Query: "hi"}
+
+	result = providerErr
+	_, _ = infer(context.Background(), req)
+	assert.Equal(t, CircuitClosed, breaker.State())
+	_, _ = infer(context.Background(), req)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// Open: fail fast without calling the provider
+	_, err := infer(context.Background(), req)
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, 2, calls)
+
+	// After the open duration a failed probe re-opens the circuit
+	fakeClock.Advance(31 * time.Second)
+	assert.Equal(t, CircuitHalfOpen, breaker.State())
+	_, _ = infer(context.Background(), req)
+	assert.Equal(t, CircuitOpen, breaker.State())
+
+	// A successful probe closes it
+	fakeClock.Advance(31 * time.Second)
+	result = nil
+	response, err := infer(context.Background(), req)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", response)
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestCircuitBreaker_IgnoresRequestErrors(t *testing.T) {
+	breaker := NewCircuitBreaker("edge-slm", config.FailoverConfig{FailureThreshold: 1})
+	infer := breaker.Wrap(func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		return "", context.Canceled
+	})
+
+	_, _ = infer(context.Background(), &models.InferenceRequest{Query: "hi"})
+	assert.Equal(t, CircuitClosed, breaker.State())
+}
+
+func TestCircuitBreaker_NilIsPassThrough(t *testing.T) {
+	var breaker *CircuitBreaker
+	infer := breaker.Wrap(func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		return "ok", nil
+	})
+
+	response, err := infer(context.Background(), &models.InferenceRequest{Query: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", response)
+}
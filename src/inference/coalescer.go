@@ -0,0 +1,212 @@
+package inference
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Coalescer merges identical concurrent model calls, so a burst of the same
+// query makes a single upstream request whose answer every caller receives.
+// With a negative TTL it also remembers provider failures for that long and
+// answers repeats with the same error instead of calling the provider again.
+//
+// The shared call runs detached from any one caller's cancellation; a caller
+// that gives up returns early while the others keep waiting. Provider
+// metadata is only recorded for the caller that started the call.
+type Coalescer struct {
+	group       singleflight.Group
+	negativeTTL time.Duration
+
+	mu       sync.Mutex
+	failures map[string]failure
+	clock    clock.Clock
+}
+
+type failure struct {
+	err       error
+	expiresAt time.Time
+}
+
+// NewCoalescer returns a coalescer; a negativeTTL of 0 disables negative caching
+func NewCoalescer(negativeTTL time.Duration) *Coalescer {
+	return &Coalescer{
+		negativeTTL: negativeTTL,
+		failures:    make(map[string]failure),
+		clock:       clock.Real(),
+	}
+}
+
+// SetClock sets the clock used to expire negatively cached failures
+func (c *Coalescer) SetClock(clk clock.Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clock = clk
+}
+
+// WrapLLM coalesces calls to an LLM client. A nil coalescer returns llm unchanged.
+func (c *Coalescer) WrapLLM(name string, llm models.LLMInferencer) models.LLMInferencer {
+	if c == nil {
+		return llm
+	}
+	return &coalescedLLM{coalescer: c, name: name, llm: llm}
+}
+
+// WrapSLM coalesces calls to an SLM engine. Each caller gets its own copy of
+// the result. A nil coalescer returns slm unchanged.
+func (c *Coalescer) WrapSLM(name string, slm models.SLMInferencer) models.SLMInferencer {
+	if c == nil {
+		return slm
+	}
+	return &coalescedSLM{coalescer: c, name: name, slm: slm}
+}
+
+// do runs fn once for every concurrent caller with the same key
+func (c *Coalescer) do(ctx context.Context, key string, fn func(ctx context.Context) (any, error)) (any, error) {
+	if err := c.failed(key); err != nil {
+		return nil, err
+	}
+
+	shared := context.WithoutCancel(ctx)
+	results := c.group.DoChan(key, func() (any, error) {
+		value, err := fn(shared)
+		if IsProviderFailure(err) {
+			c.remember(key, err)
+		}
+		return value, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		return result.Val, result.Err
+	}
+}
+
+// failed returns the remembered error for key, if it hasn't expired
+func (c *Coalescer) failed(key string) error {
+	if c.negativeTTL <= 0 {
+		return nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	f, ok := c.failures[key]
+	if !ok {
+		return nil
+	}
+	if !c.clock.Now().Before(f.expiresAt) {
+		delete(c.failures, key)
+		return nil
+	}
+	return f.err
+}
+
+func (c *Coalescer) remember(key string, err error) {
+	if c.negativeTTL <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.clock.Now()
+	// Drop expired failures so the map only holds recent ones
+	for k, f := range c.failures {
+		if !now.Before(f.expiresAt) {
+			delete(c.failures, k)
+		}
+	}
+	c.failures[key] = failure{err: err, expiresAt: now.Add(c.negativeTTL)}
+}
+
+// coalesceKey identifies identical requests to one model tier. The user is
+// left out so the same query from different users is shared, as the response
+// cache does, but orgs calling with their own keys only share among themselves.
+func coalesceKey(ctx context.Context, name string, req *models.InferenceRequest) string {
+	r := *req
+	r.UserID = ""
+	data, _ := json.Marshal(&r)
+
+	sum := sha256.Sum256(data)
+	key := name + ":" + hex.EncodeToString(sum[:])
+	if org := credentials.FromContext(ctx).Org(); org != "" {
+		key = org + ":" + key
+	}
+	return key
+}
+
+type coalescedLLM struct {
+	coalescer *Coalescer
+	name      string
+	llm       models.LLMInferencer
+}
+
+func (l *coalescedLLM) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	// Tool calls reach the caller through its context, so they can't be shared
+	if len(req.Tools) > 0 {
+		return l.llm.Infer(ctx, req)
+	}
+	value, err := l.coalescer.do(ctx, coalesceKey(ctx, l.name, req), func(ctx context.Context) (any, error) {
+		return l.llm.Infer(ctx, req)
+	})
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+func (l *coalescedLLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+	return l.Infer(ctx, models.NewChatInferenceRequest(messages, opts))
+}
+
+type coalescedSLM struct {
+	coalescer *Coalescer
+	name      string
+	slm       models.SLMInferencer
+}
+
+func (s *coalescedSLM) Infer(ctx context.Context, req *models.InferenceRequest) (*models.SLMResult, error) {
+	if len(req.Tools) > 0 {
+		return s.slm.Infer(ctx, req)
+	}
+	value, err := s.coalescer.do(ctx, coalesceKey(ctx, s.name, req), func(ctx context.Context) (any, error) {
+		return s.slm.Infer(ctx, req)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cloneSLMResult(value.(*models.SLMResult)), nil
+}
+
+func (s *coalescedSLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (*models.SLMResult, error) {
+	return s.Infer(ctx, models.NewChatInferenceRequest(messages, opts))
+}
+
+func (s *coalescedSLM) Close() error {
+	return s.slm.Close()
+}
+
+// cloneSLMResult copies a result so callers can merge continuations into it
+// without touching each other's
+func cloneSLMResult(result *models.SLMResult) *models.SLMResult {
+	clone := *result
+	clone.ModelsUsed = slices.Clone(result.ModelsUsed)
+	clone.ModelLatencies = maps.Clone(result.ModelLatencies)
+	clone.Usage = slices.Clone(result.Usage)
+	return &clone
+}
@@ -0,0 +1,102 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestCoalescer_SharesConcurrentIdenticalCalls(t *testing.T) {
+	llm := fakes.NewLLM("Paris")
+	llm.SetLatency(100 * time.Millisecond)
+	coalesced := NewCoalescer(0).WrapLLM("cloud-llm", llm)
+
+	var wg sync.WaitGroup
+	answers := make([]string, 10)
+	for i := range answers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := &models.InferenceRequest{Query: "Capital of France?", UserID: string(rune('a' + i))}
+			answers[i], _ = coalesced.Infer(context.Background(), req)
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, llm.Calls(), 1, "identical queries from different users share one call")
+	for _, answer := range answers {
+		assert.Equal(t, "Paris", answer)
+	}
+
+	_, err := coalesced.Infer(context.Background(), &models.InferenceRequest{Query: "Capital of France?", MaxTokens: 10})
+	require.NoError(t, err)
+	assert.Len(t, llm.Calls(), 2, "different parameters are a different call")
+}
+
+func TestCoalescer_CallerCanGiveUp(t *testing.T) {
+	slm := fakes.NewSLM("llama", "answer")
+	slm.SetLatency(100 * time.Millisecond)
+	coalesced := NewCoalescer(0).WrapSLM("edge-slm", slm)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := coalesced.Infer(ctx, &models.InferenceRequest{Query: "q"})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	result, err := coalesced.Infer(context.Background(), &models.InferenceRequest{Query: "q"})
+	require.NoError(t, err)
+	assert.Equal(t, "answer", result.Response)
+	assert.Len(t, slm.Calls(), 1, "the second caller joins the call the first one started")
+}
+
+func TestCoalescer_NegativeCache(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 4, 1, 9, 0, 0, 0, time.UTC))
+	coalescer := NewCoalescer(5 * time.Second)
+	coalescer.SetClock(fakeClock)
+
+	llm := fakes.NewLLM("ok")
+	llm.SetError(errors.New("503 service unavailable"))
+	coalesced := coalescer.WrapLLM("cloud-llm", llm)
+	req := &models.InferenceRequest{Query: "q"}
+
+	_, err := coalesced.Infer(context.Background(), req)
+	require.Error(t, err)
+	_, err = coalesced.Infer(context.Background(), req)
+	assert.ErrorContains(t, err, "503")
+	assert.Len(t, llm.Calls(), 1, "the failure is served from the negative cache")
+
+	llm.SetError(nil)
+	fakeClock.Advance(5 * time.Second)
+	answer, err := coalesced.Infer(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", answer)
+	assert.Len(t, llm.Calls(), 2)
+}
+
+func TestCoalescer_DoesNotCacheNonProviderFailures(t *testing.T) {
+	coalescer := NewCoalescer(time.Minute)
+	llm := fakes.NewLLM("ok")
+	llm.SetError(ErrPromptTooLarge)
+	coalesced := coalescer.WrapLLM("cloud-llm", llm)
+	req := &models.InferenceRequest{Query: "q"}
+
+	coalesced.Infer(context.Background(), req)
+	coalesced.Infer(context.Background(), req)
+	assert.Len(t, llm.Calls(), 2)
+}
+
+func TestCoalescer_NilWrapsNothing(t *testing.T) {
+	var coalescer *Coalescer
+	llm := fakes.NewLLM("ok")
+
+	assert.Same(t, llm, coalescer.WrapLLM("cloud-llm", llm))
+}
@@ -0,0 +1,53 @@
+package inference_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/providertest"
+)
+
+func TestLLMClient_Conformance(t *testing.T) {
+	for _, provider := range []string{"openai", "openai-compatible"} {
+		t.Run(provider, func(t *testing.T) {
+			providertest.RunLLM(t, func(t *testing.T, scenario providertest.Scenario) models.LLMInferencer {
+				server := providertest.NewOpenAIServer(t, scenario)
+				client, err := inference.NewLLMClient(&config.LLMConfig{
+					Provider:  provider,
+					Endpoint:  server.URL,
+					APIKey:    "test",
+					Model:     "gpt-4o",
+					MaxTokens: 64,
+				})
+				require.NoError(t, err)
+				return client
+			})
+		})
+	}
+}
+
+func TestSLMEngine_Conformance(t *testing.T) {
+	for _, strategy := range []string{"single", "parallel", "series", "hybrid"} {
+		t.Run(strategy, func(t *testing.T) {
+			providertest.RunSLM(t, func(t *testing.T, scenario providertest.Scenario) models.SLMInferencer {
+				server := providertest.NewOpenAIServer(t, scenario)
+				engine, err := inference.NewSLMEngine(&config.SLMConfig{
+					Models: []config.SLMModelConfig{
+						{Name: "llama-3.1-8b-instant", Endpoint: server.URL, APIKey: "test", Weight: 1},
+						{Name: "llama-3.3-70b-versatile", Endpoint: server.URL, APIKey: "test", Weight: 2},
+					},
+					Strategy:      strategy,
+					MaxConcurrent: 4,
+					MaxTokens:     64,
+					AggregationFn: "weighted",
+				})
+				require.NoError(t, err)
+				return engine
+			})
+		})
+	}
+}
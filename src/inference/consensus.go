@@ -0,0 +1,112 @@
+package inference
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// defaultConsensusThreshold is the cosine similarity from which two answers
+// count as agreeing
+const defaultConsensusThreshold = 0.85
+
+// SetEmbedder sets the embedder the embedding_consensus aggregation compares
+// answers with. Without one it falls back to voting.
+func (e *SLMEngine) SetEmbedder(embedder models.Embedder) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.embedder = embedder
+}
+
+// aggregateConsensus embeds every answer and groups those that agree, each
+// answer joining the group of any answer it is similar enough to. The group
+// with the most answers wins, ties going to the most total weight, and its
+// answer closest to the group's centroid, scaled by weight, is returned.
+func (e *SLMEngine) aggregateConsensus(ctx context.Context, results []inferenceResult) (inferenceResult, error) {
+	if len(results) == 1 {
+		return results[0], nil
+	}
+
+	embeddings := make([][]float32, len(results))
+	for i, r := range results {
+		embedding, err := e.embedder.Embed(ctx, r.response)
+		if err != nil {
+			return inferenceResult{}, fmt.Errorf("failed to embed %s's answer: %w", r.modelName, err)
+		}
+		embeddings[i] = embedding
+	}
+
+	threshold := e.config.ConsensusThreshold
+	if threshold <= 0 {
+		threshold = defaultConsensusThreshold
+	}
+
+	// Union-find over answers similar enough to each other
+	parent := make([]int, len(results))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range results {
+		for j := i + 1; j < len(results); j++ {
+			if cache.CosineSimilarity(embeddings[i], embeddings[j]) >= threshold {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	clusters := make(map[int][]int)
+	for i := range results {
+		root := find(i)
+		clusters[root] = append(clusters[root], i)
+	}
+	groups := make([][]int, 0, len(clusters))
+	for _, members := range clusters {
+		groups = append(groups, members)
+	}
+	totalWeight := func(members []int) float64 {
+		total := 0.0
+		for _, i := range members {
+			total += results[i].weight
+		}
+		return total
+	}
+	sort.Slice(groups, func(a, b int) bool {
+		if len(groups[a]) != len(groups[b]) {
+			return len(groups[a]) > len(groups[b])
+		}
+		return totalWeight(groups[a]) > totalWeight(groups[b])
+	})
+	winners := groups[0]
+
+	centroid := make([]float32, len(embeddings[winners[0]]))
+	for _, i := range winners {
+		for d, v := range embeddings[i] {
+			if d < len(centroid) {
+				centroid[d] += v
+			}
+		}
+	}
+
+	best, bestScore := winners[0], -1.0
+	for _, i := range winners {
+		weight := results[i].weight
+		if weight <= 0 {
+			weight = 1
+		}
+		if score := cache.CosineSimilarity(embeddings[i], centroid) * weight; score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	return results[best], nil
+}
@@ -0,0 +1,54 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// stubEmbedder embeds known answers as fixed vectors
+type stubEmbedder map[string][]float32
+
+func (s stubEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if embedding, ok := s[text]; ok {
+		return embedding, nil
+	}
+	return nil, errors.New("unknown text")
+}
+
+func TestSLMEngine_EmbeddingConsensus(t *testing.T) {
+	engine := &SLMEngine{config: &config.SLMConfig{AggregationFn: "embedding_consensus"}}
+	assert.Equal(t, "voting", engine.aggregationName(), "falls back without an embedder")
+
+	engine.SetEmbedder(stubEmbedder{
+		"Paris":                          {1, 0, 0},
+		"It's Paris":                     {0.95, 0.1, 0},
+		"The capital of France is Paris": {0.9, 0.05, 0.1},
+		"Lyon":                           {0, 1, 0},
+	})
+	assert.Equal(t, "embedding_consensus", engine.aggregationName())
+
+	// The outlier has the highest weight, but three models agree on Paris
+	best, err := engine.aggregateResults(context.Background(), &models.InferenceRequest{Query: "What is the capital of France?"}, []inferenceResult{
+		{modelName: "a", response: "Paris", weight: 1},
+		{modelName: "b", response: "It's Paris", weight: 1.5},
+		{modelName: "c", response: "The capital of France is Paris", weight: 1},
+		{modelName: "d", response: "Lyon", weight: 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "b", best.modelName)
+
+	// Answers that can't be embedded fall back to voting
+	best, err = engine.aggregateResults(context.Background(), &models.InferenceRequest{Query: "What is the capital of France?"}, []inferenceResult{
+		{modelName: "a", response: "Paris", weight: 1},
+		{modelName: "e", response: "Marseille", weight: 1},
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, best.modelName)
+}
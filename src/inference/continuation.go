@@ -0,0 +1,122 @@
+package inference
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+// continuationPrompt asks the model to pick up a truncated answer where it stopped
+const continuationPrompt = "Continue your answer exactly where it stopped. Do not repeat any text that was already written."
+
+// Continuer continues answers the provider cut off at the token limit, up to a
+// per-request budget, and stitches the chunks together
+type Continuer struct {
+	maxContinuations int
+	maxTotalTokens   int
+}
+
+func NewContinuer(cfg config.ContinuationConfig) *Continuer {
+	return &Continuer{
+		maxContinuations: cfg.MaxContinuations,
+		maxTotalTokens:   cfg.MaxTotalTokens,
+	}
+}
+
+// Wrap returns an infer func that keeps asking for more while the provider
+// reports a length finish reason. model names the model whose metadata to
+// check after each call; info is filled in when a continuation was attempted.
+// The context must carry a recorder from WithProviderMetadata, otherwise
+// truncation can't be detected and infer is called once.
+func (c *Continuer) Wrap(
+	infer func(ctx context.Context, req *models.InferenceRequest) (string, error),
+	model func() string,
+	info **models.ContinuationInfo,
+) func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	return func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		response, err := infer(ctx, req)
+		if err != nil || !req.Complete || c.maxContinuations <= 0 {
+			return response, err
+		}
+
+		recorder, _ := ctx.Value(providerMetadataKey{}).(*ProviderMetadataRecorder)
+		if recorder == nil || !isTruncated(recorder.For(model())) {
+			return response, nil
+		}
+
+		var answer strings.Builder
+		answer.WriteString(response)
+		result := &models.ContinuationInfo{Truncated: true}
+		*info = result
+
+		for result.Continuations < c.maxContinuations {
+			if c.maxTotalTokens > 0 && utils.CountTokens(answer.String(), model()) >= c.maxTotalTokens {
+				break
+			}
+
+			chunk, err := infer(ctx, continuationRequest(req, answer.String()))
+			if err != nil {
+				// Keep what we have rather than failing the whole request
+				break
+			}
+			result.Continuations++
+			answer.WriteString(chunk)
+
+			result.Truncated = isTruncated(recorder.For(model()))
+			if !result.Truncated {
+				break
+			}
+		}
+
+		return answer.String(), nil
+	}
+}
+
+// continuationRequest builds the follow-up request: the original question and
+// the partial answer become context, and the query asks to continue. Chat
+// requests get them as the user and assistant turns instead.
+func continuationRequest(req *models.InferenceRequest, partial string) *models.InferenceRequest {
+	next := *req
+	next.Complete = false
+
+	if len(req.Messages) > 0 {
+		question := req.Query
+		if req.Context != "" {
+			question = fmt.Sprintf("Context: %s\n\nQuestion: %s", req.Context, req.Query)
+		}
+		next.Messages = append(slices.Clone(req.Messages),
+			models.ChatMessage{Role: "user", Content: question},
+			models.ChatMessage{Role: "assistant", Content: partial},
+		)
+		next.Context = ""
+		next.Query = continuationPrompt
+		return &next
+	}
+
+	parts := make([]string, 0, 3)
+	if req.Context != "" {
+		parts = append(parts, req.Context)
+	}
+	parts = append(parts, "Question: "+req.Query, "Answer so far:\n"+partial)
+
+	next.Context = strings.Join(parts, "\n\n")
+	next.Query = continuationPrompt
+	return &next
+}
+
+// isTruncated reports whether the provider stopped because it hit the token limit
+func isTruncated(metadata *models.ProviderMetadata) bool {
+	if metadata == nil {
+		return false
+	}
+	switch metadata.FinishReason {
+	case "length", "max_tokens", "FinishReasonMaxTokens": // OpenAI/Mistral, Anthropic, Gemini
+		return true
+	}
+	return false
+}
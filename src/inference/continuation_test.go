@@ -0,0 +1,110 @@
+package inference
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// truncatingInfer returns chunks in order, reporting "length" for all but the last
+func truncatingInfer(chunks []string, requests *[]*models.InferenceRequest) func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	call := 0
+	return func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+		*requests = append(*requests, req)
+		chunk := chunks[call]
+		finishReason := "length"
+		if call == len(chunks)-1 {
+			finishReason = "stop"
+		}
+		call++
+
+		recorder := ctx.Value(providerMetadataKey{}).(*ProviderMetadataRecorder)
+		recorder.record("test-model", &models.ProviderMetadata{FinishReason: finishReason})
+		return chunk, nil
+	}
+}
+
+func TestContinuer_StitchesTruncatedAnswer(t *testing.T) {
+	var requests []*models.InferenceRequest
+	var info *models.ContinuationInfo
+	continuer := NewContinuer(config.ContinuationConfig{MaxContinuations: 3})
+
+	infer := continuer.Wrap(truncatingInfer([]string{"The quick ", "brown fox ", "jumps."}, &requests), func() string { return "test-model" }, &info)
+	ctx, _ := WithProviderMetadata(context.Background())
+
+	response, err := infer(ctx, &models.InferenceRequest{Query: "Finish the sentence", Complete: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, "The quick brown fox jumps.", response)
+	require.NotNil(t, info)
+	assert.Equal(t, 2, info.Continuations)
+	assert.False(t, info.Truncated)
+
+	require.Len(t, requests, 3)
+	assert.Equal(t, continuationPrompt, requests[2].Query)
+	assert.Contains(t, requests[2].Context, "Question: Finish the sentence")
+	assert.Contains(t, requests[2].Context, "The quick brown fox ")
+}
+
+func TestContinuer_StopsAtBudget(t *testing.T) {
+	var requests []*models.InferenceRequest
+	var info *models.ContinuationInfo
+	continuer := NewContinuer(config.ContinuationConfig{MaxContinuations: 1})
+
+	infer := continuer.Wrap(truncatingInfer([]string{"one ", "two ", "three"}, &requests), func() string { return "test-model" }, &info)
+	ctx, _ := WithProviderMetadata(context.Background())
+
+	response, err := infer(ctx, &models.InferenceRequest{Query: "Count", Complete: true})
+	require.NoError(t, err)
+
+	assert.Equal(t, "one two ", response)
+	require.NotNil(t, info)
+	assert.Equal(t, 1, info.Continuations)
+	assert.True(t, info.Truncated)
+}
+
+func TestContinuer_RequiresCompleteFlag(t *testing.T) {
+	var requests []*models.InferenceRequest
+	var info *models.ContinuationInfo
+	continuer := NewContinuer(config.ContinuationConfig{MaxContinuations: 3})
+
+	infer := continuer.Wrap(truncatingInfer([]string{"one ", "two"}, &requests), func() string { return "test-model" }, &info)
+	ctx, _ := WithProviderMetadata(context.Background())
+
+	response, err := infer(ctx, &models.InferenceRequest{Query: "Count"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "one ", response)
+	assert.Nil(t, info)
+	assert.Len(t, requests, 1)
+}
+
+func TestContinuer_ContinuesChatAsAssistantTurn(t *testing.T) {
+	var requests []*models.InferenceRequest
+	var info *models.ContinuationInfo
+	continuer := NewContinuer(config.ContinuationConfig{MaxContinuations: 3})
+
+	infer := continuer.Wrap(truncatingInfer([]string{"The quick ", "brown fox."}, &requests), func() string { return "test-model" }, &info)
+	ctx, _ := WithProviderMetadata(context.Background())
+
+	history := []models.ChatMessage{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello"}}
+	response, err := infer(ctx, &models.InferenceRequest{Query: "Finish the sentence", Messages: history, Complete: true})
+	require.NoError(t, err)
+	assert.Equal(t, "The quick brown fox.", response)
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, continuationPrompt, requests[1].Query)
+	assert.Empty(t, requests[1].Context)
+	assert.Equal(t, []models.ChatMessage{
+		{Role: "user", Content: "Hi"},
+		{Role: "assistant", Content: "Hello"},
+		{Role: "user", Content: "Finish the sentence"},
+		{Role: "assistant", Content: "The quick "},
+	}, requests[1].Messages)
+	assert.Len(t, requests[0].Messages, 2, "the original history is untouched")
+}
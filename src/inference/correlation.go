@@ -0,0 +1,89 @@
+package inference
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+)
+
+// clientRequestIDHeader tags a call with our request's ID; OpenAI logs it
+// with the call
+const clientRequestIDHeader = "X-Client-Request-Id"
+
+// providerCorrelation hashes the IDs provider calls are tagged with; nil
+// leaves calls untagged
+var (
+	providerCorrelation   *correlation.Hasher
+	providerCorrelationMu sync.RWMutex
+)
+
+// SetProviderCorrelation tags the calls of the OpenAI-compatible and
+// Anthropic clients with hashes of the request and user IDs in their
+// context: the request's in the X-Client-Request-Id header, the user's in the
+// body's "user" field (Anthropic: metadata.user_id). nil stops tagging.
+func SetProviderCorrelation(hasher *correlation.Hasher) {
+	providerCorrelationMu.Lock()
+	defer providerCorrelationMu.Unlock()
+
+	providerCorrelation = hasher
+}
+
+// correlate returns req tagged with the IDs of the request it's made for.
+// Bodies that aren't JSON objects, or already name a user, are sent as they are.
+func correlate(req *http.Request) (*http.Request, error) {
+	providerCorrelationMu.RLock()
+	hasher := providerCorrelation
+	providerCorrelationMu.RUnlock()
+	if hasher == nil {
+		return req, nil
+	}
+
+	requestID := hasher.Hash(correlation.RequestID(req.Context()))
+	userID := hasher.Hash(correlation.UserID(req.Context()))
+	if requestID == "" && userID == "" {
+		return req, nil
+	}
+	req = req.Clone(req.Context())
+	if requestID != "" {
+		req.Header.Set(clientRequestIDHeader, requestID)
+	}
+	if userID == "" || req.Body == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/json") {
+		return req, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(body, &fields) != nil || fields == nil {
+		return req, nil
+	}
+	field, value := "user", any(userID)
+	if strings.HasSuffix(req.URL.Path, "/messages") {
+		field, value = "metadata", map[string]string{"user_id": userID}
+	}
+	if _, ok := fields[field]; ok {
+		return req, nil
+	}
+	fields[field], _ = json.Marshal(value)
+	tagged, err := json.Marshal(fields)
+	if err != nil {
+		return req, nil
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(tagged))
+	req.ContentLength = int64(len(tagged))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(tagged)), nil
+	}
+	return req, nil
+}
@@ -0,0 +1,55 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+)
+
+func TestMetadataDoer_TagsProviderCalls(t *testing.T) {
+	hasher := correlation.NewHasher("secret")
+	SetProviderCorrelation(hasher)
+	t.Cleanup(func() { SetProviderCorrelation(nil) })
+
+	var header string
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(clientRequestIDHeader)
+		raw, _ := io.ReadAll(r.Body)
+		body = nil
+		_ = json.Unmarshal(raw, &body)
+	}))
+	t.Cleanup(server.Close)
+
+	ctx := correlation.WithUserID(correlation.WithRequestID(context.Background(), "req-1"), "alice")
+	call := func(path string, payload string) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, server.URL+path, strings.NewReader(payload))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := newMetadataDoer().Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	call("/v1/chat/completions", `{"model":"gpt-4o"}`)
+	assert.Equal(t, hasher.Hash("req-1"), header)
+	assert.Equal(t, hasher.Hash("alice"), body["user"])
+	assert.Len(t, header, 32)
+	assert.NotContains(t, header, "req-1")
+
+	call("/v1/messages", `{"model":"claude"}`)
+	assert.Equal(t, map[string]any{"user_id": hasher.Hash("alice")}, body["metadata"])
+	assert.NotContains(t, body, "user")
+
+	call("/v1/chat/completions", `{"model":"gpt-4o","user":"set-by-caller"}`)
+	assert.Equal(t, "set-by-caller", body["user"])
+}
@@ -0,0 +1,121 @@
+package inference
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Judge modes
+const (
+	judgeModeSelect     = "select"
+	judgeModeSynthesize = "synthesize"
+)
+
+// judgeVerdict is the JSON the judge is asked to answer with
+type judgeVerdict struct {
+	Choice    int    `json:"choice"` // 1-based candidate number, in select mode
+	Answer    string `json:"answer"` // The written answer, in synthesize mode
+	Rationale string `json:"rationale"`
+}
+
+// judgeModel returns the configured judge, or the last (usually most capable) model
+func (e *SLMEngine) judgeModel() modelClient {
+	if client, ok := e.client(e.config.Judge.Model); ok {
+		return client
+	}
+	return e.clients[len(e.clients)-1]
+}
+
+func (e *SLMEngine) judgeMode() string {
+	if e.config.Judge.Mode == judgeModeSynthesize {
+		return judgeModeSynthesize
+	}
+	return judgeModeSelect
+}
+
+// aggregateJudge shows the judge model the query and every candidate answer,
+// and returns the answer it picks or, in synthesize mode, the one it writes
+func (e *SLMEngine) aggregateJudge(ctx context.Context, req *models.InferenceRequest, results []inferenceResult) (inferenceResult, error) {
+	mode := e.judgeMode()
+	if len(results) == 1 && mode == judgeModeSelect {
+		return results[0], nil
+	}
+	judge := e.judgeModel()
+
+	// Number the answers by the models' configured order, not the order they
+	// finished in, so a choice always means the same model
+	order := make(map[string]int, len(e.clients))
+	for i, client := range e.clients {
+		order[client.name] = i
+	}
+	results = slices.Clone(results)
+	slices.SortStableFunc(results, func(a, b inferenceResult) int {
+		return cmp.Compare(order[a.modelName], order[b.modelName])
+	})
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "You are judging answers from several models to the same question.\n\nQuestion: %s\n\n", req.Query)
+	for i, r := range results {
+		fmt.Fprintf(&sb, "Answer %d:\n%s\n\n", i+1, r.response)
+	}
+	if mode == judgeModeSynthesize {
+		sb.WriteString(`Write the best possible answer to the question, keeping what the answers get right and fixing what they get wrong. Reply with JSON only: {"answer": "<your answer>", "rationale": "<one or two sentences on how you combined them>"}`)
+	} else {
+		sb.WriteString(`Pick the most accurate, complete and helpful answer. Reply with JSON only: {"choice": <answer number>, "rationale": "<one or two sentences on why>"}`)
+	}
+
+	judgeReq := &models.InferenceRequest{
+		Query:          req.Query,
+		Temperature:    0.1,
+		ResponseFormat: "json_object",
+	}
+	raw, err := e.runModel(ctx, judge, singlePrompt(sb.String()), judgeReq)
+	if err != nil {
+		return inferenceResult{}, err
+	}
+
+	var verdict judgeVerdict
+	if err := json.Unmarshal([]byte(extractJSON(raw)), &verdict); err != nil {
+		return inferenceResult{}, fmt.Errorf("judge %s answered with invalid JSON: %w", judge.name, err)
+	}
+
+	judged := &models.JudgeVerdict{
+		Model:     judge.name,
+		Mode:      mode,
+		Rationale: strings.TrimSpace(verdict.Rationale),
+	}
+	var best inferenceResult
+	if mode == judgeModeSynthesize {
+		if strings.TrimSpace(verdict.Answer) == "" {
+			return inferenceResult{}, fmt.Errorf("judge %s wrote an empty answer", judge.name)
+		}
+		best = inferenceResult{modelName: judge.name, response: verdict.Answer, weight: judge.weight}
+	} else {
+		if verdict.Choice < 1 || verdict.Choice > len(results) {
+			return inferenceResult{}, fmt.Errorf("judge %s chose answer %d of %d", judge.name, verdict.Choice, len(results))
+		}
+		best = results[verdict.Choice-1]
+		judged.Selected = best.modelName
+	}
+	if e.config.Judge.ReturnRationale {
+		best.verdict = judged
+	}
+	return best, nil
+}
+
+// extractJSON returns the outermost JSON object in text, for models that wrap
+// it in prose or code fences despite JSON mode
+func extractJSON(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+	return text[start : end+1]
+}
@@ -5,69 +5,107 @@ import (
 	"fmt"
 
 	"github.com/tmc/langchaingo/llms"
-	"github.com/tmc/langchaingo/llms/openai"
+	"go.opentelemetry.io/otel/attribute"
 
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
 )
 
 type LLMClient struct {
-	config *config.LLMConfig
-	llm    llms.Model
+	config   *config.LLMConfig
+	provider string
+	llm      llms.Model
+	keyed    keyedModels // Clients for orgs' keys
 }
 
+// NewLLMClient creates the cloud LLM client for the provider named by llm.provider (OpenAI by default)
 func NewLLMClient(cfg *config.LLMConfig) (*LLMClient, error) {
+	provider := cfg.Provider
+	if provider == "" {
+		provider = defaultLLMProvider
+	}
+
+	factory, err := llmProvider(provider)
+	if err != nil {
+		return nil, err
+	}
 
-	llm, err := openai.New(
-		openai.WithToken(cfg.APIKey),
-		openai.WithModel(cfg.Model),
-	)
+	llm, err := factory(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create OpenAI client: %w", err)
+		return nil, fmt.Errorf("failed to create %s client: %w", provider, err)
 	}
 
 	return &LLMClient{
-		config: cfg,
-		llm:    llm,
+		config:   cfg,
+		provider: provider,
+		llm:      llm,
 	}, nil
 }
 
-func (c *LLMClient) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+// Provider returns the name of the provider serving the cloud tier
+func (c *LLMClient) Provider() string {
+	return c.provider
+}
 
-	prompt := req.Query
-	if req.Context != "" {
-		prompt = fmt.Sprintf("Context: %s\n\nQuestion: %s", req.Context, req.Query)
-	}
+func (c *LLMClient) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	ctx, span := tracing.Start(ctx, "llm.Infer", attribute.String("gen_ai.system", c.provider))
+	response, err := c.infer(ctx, req)
+	tracing.End(span, err)
+	return response, err
+}
 
+func (c *LLMClient) infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
 	temperature := float64(req.Temperature)
 	if temperature == 0 {
 		temperature = 0.7
 	}
 
+	model := c.modelFor(req)
 	callOptions := []llms.CallOption{
+		llms.WithModel(model),
 		llms.WithTemperature(temperature),
 		llms.WithMaxTokens(c.config.MaxTokens),
 	}
-
-	response, err := llms.GenerateFromSinglePrompt(
-		ctx,
-		c.llm,
-		prompt,
-		callOptions...,
-	)
+	if req.ResponseFormat == "json_object" {
+		callOptions = append(callOptions, llms.WithJSONMode())
+	}
+	callOptions = withTools(req, callOptions)
+
+	var response string
+	err := withOrgKey(ctx, c.provider, c.llm, &c.keyed, c.llmWithKey, func(ctx context.Context, llm llms.Model) error {
+		var err error
+		response, _, err = generate(
+			ctx,
+			llm,
+			model,
+			promptMessages(req),
+			callOptions...,
+		)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("OpenAI generation failed: %w", err)
+		return "", fmt.Errorf("%s generation failed: %w", c.provider, err)
 	}
 
 	return response, nil
 }
 
-func (c *LLMClient) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) error {
-	prompt := req.Query
-	if req.Context != "" {
-		prompt = fmt.Sprintf("Context: %s\n\nQuestion: %s", req.Context, req.Query)
-	}
+// Ping asks the provider for a one-token completion with the platform's key,
+// to check that it's reachable
+func (c *LLMClient) Ping(ctx context.Context) error {
+	_, _, err := generate(ctx, c.llm, c.config.Model, pingPrompt(), llms.WithModel(c.config.Model), llms.WithMaxTokens(1))
+	return err
+}
+
+// InferChat answers a conversation whose last message is the user's turn
+func (c *LLMClient) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+	return c.Infer(ctx, models.NewChatInferenceRequest(messages, opts))
+}
 
+func (c *LLMClient) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) (err error) {
+	ctx, span := tracing.Start(ctx, "llm.InferStreaming", attribute.String("gen_ai.system", c.provider))
+	defer func() { tracing.End(span, err) }()
 	temperature := float64(req.Temperature)
 	if temperature == 0 {
 		temperature = 0.7
@@ -80,14 +118,39 @@ func (c *LLMClient) InferStreaming(ctx context.Context, req *models.InferenceReq
 		return nil
 	}
 
-	_, err := llms.GenerateFromSinglePrompt(
-		ctx,
-		c.llm,
-		prompt,
-		llms.WithTemperature(temperature),
-		llms.WithMaxTokens(c.config.MaxTokens),
-		llms.WithStreamingFunc(streamingFunc),
-	)
+	model := c.modelFor(req)
+	return withOrgKey(ctx, c.provider, c.llm, &c.keyed, c.llmWithKey, func(ctx context.Context, llm llms.Model) error {
+		_, _, err := generate(
+			ctx,
+			llm,
+			model,
+			promptMessages(req),
+			withTools(req, []llms.CallOption{
+				llms.WithModel(model),
+				llms.WithTemperature(temperature),
+				llms.WithMaxTokens(c.config.MaxTokens),
+				llms.WithStreamingFunc(streamingFunc),
+			})...,
+		)
+		return err
+	})
+}
 
-	return err
+// llmWithKey builds a client calling the provider with an org's key
+func (c *LLMClient) llmWithKey(key string) (llms.Model, error) {
+	factory, err := llmProvider(c.provider)
+	if err != nil {
+		return nil, err
+	}
+	cfg := *c.config
+	cfg.APIKey = key
+	return factory(&cfg)
+}
+
+// modelFor returns the model the router targeted, or the configured default
+func (c *LLMClient) modelFor(req *models.InferenceRequest) string {
+	if req.TargetModel != "" {
+		return req.TargetModel
+	}
+	return c.config.Model
 }
@@ -0,0 +1,144 @@
+package inference
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+	"github.com/tmc/langchaingo/llms/anthropic"
+	"github.com/tmc/langchaingo/llms/googleai"
+	"github.com/tmc/langchaingo/llms/mistral"
+	"github.com/tmc/langchaingo/llms/openai"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const (
+	defaultLLMProvider     = "openai"
+	defaultAzureAPIVersion = "2024-06-01"
+)
+
+// LLMProviderFactory builds the model client for one cloud LLM provider
+type LLMProviderFactory func(cfg *config.LLMConfig) (llms.Model, error)
+
+var (
+	llmProvidersMu sync.RWMutex
+	llmProviders   = map[string]LLMProviderFactory{
+		"openai":            newOpenAIModel,
+		"openai-compatible": newOpenAICompatibleModel,
+		"azure":             newAzureOpenAIModel,
+		"anthropic":         newAnthropicModel,
+		"gemini":            newGeminiModel,
+		"mistral":           newMistralModel,
+	}
+)
+
+// RegisterLLMProvider makes a provider available as llm.provider, replacing
+// any existing provider with the same name
+func RegisterLLMProvider(name string, factory LLMProviderFactory) {
+	llmProvidersMu.Lock()
+	defer llmProvidersMu.Unlock()
+
+	llmProviders[name] = factory
+}
+
+// LLMProviders returns the names of the registered providers, sorted
+func LLMProviders() []string {
+	llmProvidersMu.RLock()
+	defer llmProvidersMu.RUnlock()
+
+	names := make([]string, 0, len(llmProviders))
+	for name := range llmProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func llmProvider(name string) (LLMProviderFactory, error) {
+	llmProvidersMu.RLock()
+	defer llmProvidersMu.RUnlock()
+
+	factory, ok := llmProviders[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown LLM provider %q (supported: %v)", name, LLMProviders())
+	}
+	return factory, nil
+}
+
+func newOpenAIModel(cfg *config.LLMConfig) (llms.Model, error) {
+	options := []openai.Option{
+		openai.WithToken(cfg.APIKey),
+		openai.WithModel(cfg.Model),
+		openai.WithHTTPClient(newMetadataDoer()),
+	}
+	if cfg.Endpoint != "" {
+		options = append(options, openai.WithBaseURL(cfg.Endpoint))
+	}
+	return openai.New(options...)
+}
+
+// newOpenAICompatibleModel serves any endpoint that speaks the OpenAI chat
+// completions API (vLLM, Together, OpenRouter, LiteLLM, ...)
+func newOpenAICompatibleModel(cfg *config.LLMConfig) (llms.Model, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("llm.endpoint is required for the openai-compatible provider")
+	}
+	return newOpenAIModel(cfg)
+}
+
+// newAzureOpenAIModel uses llm.model as the deployment name
+func newAzureOpenAIModel(cfg *config.LLMConfig) (llms.Model, error) {
+	if cfg.Endpoint == "" {
+		return nil, fmt.Errorf("llm.endpoint is required for the azure provider")
+	}
+	apiVersion := cfg.APIVersion
+	if apiVersion == "" {
+		apiVersion = defaultAzureAPIVersion
+	}
+
+	return openai.New(
+		openai.WithAPIType(openai.APITypeAzure),
+		openai.WithAPIVersion(apiVersion),
+		openai.WithBaseURL(cfg.Endpoint),
+		openai.WithToken(cfg.APIKey),
+		openai.WithModel(cfg.Model),
+		openai.WithHTTPClient(newMetadataDoer()),
+	)
+}
+
+func newAnthropicModel(cfg *config.LLMConfig) (llms.Model, error) {
+	options := []anthropic.Option{
+		anthropic.WithToken(cfg.APIKey),
+		anthropic.WithModel(cfg.Model),
+		anthropic.WithHTTPClient(newMetadataDoer()),
+	}
+	if cfg.Endpoint != "" {
+		options = append(options, anthropic.WithBaseURL(cfg.Endpoint))
+	}
+	return anthropic.New(options...)
+}
+
+func newGeminiModel(cfg *config.LLMConfig) (llms.Model, error) {
+	return googleai.New(
+		context.Background(),
+		googleai.WithAPIKey(cfg.APIKey),
+		googleai.WithDefaultModel(cfg.Model),
+	)
+}
+
+func newMistralModel(cfg *config.LLMConfig) (llms.Model, error) {
+	options := []mistral.Option{
+		mistral.WithAPIKey(cfg.APIKey),
+		mistral.WithModel(cfg.Model),
+	}
+	if cfg.Endpoint != "" {
+		options = append(options, mistral.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Timeout > 0 {
+		options = append(options, mistral.WithTimeout(cfg.Timeout))
+	}
+	return mistral.New(options...)
+}
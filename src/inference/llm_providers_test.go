@@ -0,0 +1,160 @@
+package inference
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestNewLLMClient_Providers(t *testing.T) {
+	for _, provider := range []string{"openai", "anthropic", "gemini", "mistral"} {
+		t.Run(provider, func(t *testing.T) {
+			client, err := NewLLMClient(&config.LLMConfig{Provider: provider, APIKey: "test", Model: "some-model"})
+			require.NoError(t, err)
+			assert.Equal(t, provider, client.Provider())
+		})
+	}
+
+	client, err := NewLLMClient(&config.LLMConfig{APIKey: "test", Model: "gpt-4o"})
+	require.NoError(t, err)
+	assert.Equal(t, "openai", client.Provider(), "defaults to OpenAI")
+
+	_, err = NewLLMClient(&config.LLMConfig{Provider: "azure", APIKey: "test", Model: "my-deployment"})
+	assert.ErrorContains(t, err, "llm.endpoint is required")
+
+	_, err = NewLLMClient(&config.LLMConfig{Provider: "openai-compatible", APIKey: "test", Model: "m"})
+	assert.ErrorContains(t, err, "llm.endpoint is required")
+
+	_, err = NewLLMClient(&config.LLMConfig{Provider: "palm", APIKey: "test", Model: "m"})
+	assert.ErrorContains(t, err, `unknown LLM provider "palm"`)
+}
+
+func TestLLMClient_AnthropicRecordsMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages", r.URL.Path)
+		assert.Equal(t, "test", r.Header.Get("x-api-key"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"id": "msg_123",
+			"type": "message",
+			"role": "assistant",
+			"model": "claude-3-5-sonnet-20241022",
+			"content": [{"type": "text", "text": "Hello"}],
+			"stop_reason": "max_tokens",
+			"usage": {"input_tokens": 5, "output_tokens": 1}
+		}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewLLMClient(&config.LLMConfig{
+		Provider:  "anthropic",
+		Endpoint:  server.URL,
+		APIKey:    "test",
+		Model:     "claude-3-5-sonnet-latest",
+		MaxTokens: 16,
+	})
+	require.NoError(t, err)
+
+	ctx, recorder := WithProviderMetadata(context.Background())
+	response, err := client.Infer(ctx, &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", response)
+
+	metadata := recorder.For("claude-3-5-sonnet-latest")
+	require.NotNil(t, metadata)
+	assert.Equal(t, "max_tokens", metadata.FinishReason)
+	assert.Equal(t, "claude-3-5-sonnet-20241022", metadata.ServedModel)
+	assert.Equal(t, "msg_123", metadata.ResponseID)
+	assert.True(t, isTruncated(metadata))
+}
+
+func TestRegisterLLMProvider(t *testing.T) {
+	RegisterLLMProvider("test-provider", newOpenAICompatibleModel)
+	t.Cleanup(func() {
+		llmProvidersMu.Lock()
+		delete(llmProviders, "test-provider")
+		llmProvidersMu.Unlock()
+	})
+
+	assert.Contains(t, LLMProviders(), "test-provider")
+
+	client, err := NewLLMClient(&config.LLMConfig{Provider: "test-provider", Endpoint: "http://localhost:1", APIKey: "test", Model: "m"})
+	require.NoError(t, err)
+	assert.Equal(t, "test-provider", client.Provider())
+}
+
+func TestLLMClient_UsesOrgKey(t *testing.T) {
+	var seenKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenKeys = append(seenKeys, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := NewLLMClient(&config.LLMConfig{Provider: "openai-compatible", Endpoint: server.URL, APIKey: "platform", Model: "m"})
+	require.NoError(t, err)
+	req := &models.InferenceRequest{Query: "Hi"}
+
+	_, err = client.Infer(context.Background(), req)
+	require.NoError(t, err)
+	orgCtx := credentials.WithKeys(context.Background(), credentials.NewKeys("acme.com", map[string]string{"openai-compatible": "org"}, false))
+	_, err = client.Infer(orgCtx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer platform", "Bearer org"}, seenKeys)
+
+	// Without a key of its own or the platform fallback, the org's call fails
+	noKeyCtx := credentials.WithKeys(context.Background(), credentials.NewKeys("acme.com", map[string]string{}, false))
+	_, err = client.Infer(noKeyCtx, req)
+	assert.ErrorIs(t, err, credentials.ErrNoKey)
+	assert.False(t, IsProviderFailure(err))
+}
+
+func TestLLMClient_RetriesRejectedOrgKeyWithSecondary(t *testing.T) {
+	var seenKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenKeys = append(seenKeys, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Authorization") == "Bearer revoked" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error": {"message": "Incorrect API key provided"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	mr := miniredis.RunT(t)
+	store, err := credentials.NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), config.BYOKConfig{EncryptionKey: "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	require.NoError(t, err)
+	store.SetOrgResolver(func(ctx context.Context, userID string) string { return "acme.com" })
+	ctx := context.Background()
+	_, err = store.SetKey(ctx, "acme.com", "openai-compatible", "revoked")
+	require.NoError(t, err)
+	_, err = store.SetSecondaryKey(ctx, "acme.com", "openai-compatible", "standby")
+	require.NoError(t, err)
+	keys, err := store.ForUser(ctx, "alice")
+	require.NoError(t, err)
+
+	client, err := NewLLMClient(&config.LLMConfig{Provider: "openai-compatible", Endpoint: server.URL, APIKey: "platform", Model: "m"})
+	require.NoError(t, err)
+	orgCtx := credentials.WithKeys(ctx, keys)
+
+	response, err := client.Infer(orgCtx, &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", response)
+	_, err = client.Infer(orgCtx, &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer revoked", "Bearer standby", "Bearer standby"}, seenKeys)
+}
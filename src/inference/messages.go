@@ -0,0 +1,90 @@
+package inference
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// PromptTemplateVersion changes whenever the prompts built from requests
+// change, so answers cached under the old prompts stop being served
+const PromptTemplateVersion = "2"
+
+// PromptVersion identifies the prompts the request is answered with: the
+// template version and a hash of its system messages, if any
+func PromptVersion(req *models.InferenceRequest) string {
+	h := sha256.New()
+	system := false
+	for _, message := range req.Messages {
+		if message.Role == "system" {
+			h.Write([]byte(message.Content + "\x00"))
+			system = true
+		}
+	}
+	if !system {
+		return "t" + PromptTemplateVersion
+	}
+	return "t" + PromptTemplateVersion + "-s" + hex.EncodeToString(h.Sum(nil)[:6])
+}
+
+// pingPrompt is the smallest prompt providers accept, for health checks
+func pingPrompt() []llms.MessageContent {
+	return []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, "ping")}
+}
+
+// promptMessages builds the messages sent to the provider: the conversation
+// history with its roles, then the query as the final user message
+func promptMessages(req *models.InferenceRequest) []llms.MessageContent {
+	messages := make([]llms.MessageContent, 0, len(req.Messages)+1)
+	for _, message := range req.Messages {
+		messages = append(messages, llms.TextParts(messageType(message.Role), message.Content))
+	}
+
+	query := req.Query
+	if req.Context != "" {
+		query = fmt.Sprintf("Context: %s\n\nQuestion: %s", req.Context, req.Query)
+	}
+	if query != "" || len(messages) == 0 {
+		messages = append(messages, llms.TextParts(llms.ChatMessageTypeHuman, query))
+	}
+	return messages
+}
+
+// singlePrompt is a one-message conversation, for internal prompts such as refinements
+func singlePrompt(prompt string) []llms.MessageContent {
+	return []llms.MessageContent{llms.TextParts(llms.ChatMessageTypeHuman, prompt)}
+}
+
+// messageType maps a chat role to its langchaingo message type; unknown roles
+// are sent as the user's
+func messageType(role string) llms.ChatMessageType {
+	switch role {
+	case "system":
+		return llms.ChatMessageTypeSystem
+	case "assistant":
+		return llms.ChatMessageTypeAI
+	default:
+		return llms.ChatMessageTypeHuman
+	}
+}
+
+// messagesText joins the text of the messages, for token estimates
+func messagesText(messages []llms.MessageContent) string {
+	var text strings.Builder
+	for _, message := range messages {
+		for _, part := range message.Parts {
+			if content, ok := part.(llms.TextContent); ok {
+				if text.Len() > 0 {
+					text.WriteString("\n")
+				}
+				text.WriteString(content.Text)
+			}
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,69 @@
+package inference
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tmc/langchaingo/llms"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestPromptMessages_KeepsRoles(t *testing.T) {
+	req := &models.InferenceRequest{
+		Query: "And its population?",
+		Messages: []models.ChatMessage{
+			{Role: "system", Content: "[Conversation Summary]: They talked about France."},
+			{Role: "user", Content: "What is the capital of France?"},
+			{Role: "assistant", Content: "Paris."},
+		},
+	}
+
+	assert.Equal(t, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeSystem, "[Conversation Summary]: They talked about France."),
+		llms.TextParts(llms.ChatMessageTypeHuman, "What is the capital of France?"),
+		llms.TextParts(llms.ChatMessageTypeAI, "Paris."),
+		llms.TextParts(llms.ChatMessageTypeHuman, "And its population?"),
+	}, promptMessages(req))
+}
+
+func TestPromptMessages_SingleQuery(t *testing.T) {
+	req := &models.InferenceRequest{Query: "What is Go?", Context: "Go is a programming language."}
+
+	assert.Equal(t, []llms.MessageContent{
+		llms.TextParts(llms.ChatMessageTypeHuman, "Context: Go is a programming language.\n\nQuestion: What is Go?"),
+	}, promptMessages(req))
+}
+
+func TestNewChatInferenceRequest(t *testing.T) {
+	req := models.NewChatInferenceRequest([]models.ChatMessage{
+		{Role: "system", Content: "Be brief."},
+		{Role: "user", Content: "What is Go?"},
+	}, models.ChatOptions{Model: "gpt-4o", MaxTokens: 32})
+
+	assert.Equal(t, "What is Go?", req.Query)
+	assert.Equal(t, []models.ChatMessage{{Role: "system", Content: "Be brief."}}, req.Messages)
+	assert.Equal(t, "gpt-4o", req.TargetModel)
+	assert.Equal(t, 32, req.MaxTokens)
+	assert.Len(t, promptMessages(req), 2)
+}
+
+func TestPromptVersion(t *testing.T) {
+	plain := PromptVersion(&models.InferenceRequest{Query: "What is Go?"})
+	assert.Equal(t, "t"+PromptTemplateVersion, plain)
+
+	withHistory := PromptVersion(&models.InferenceRequest{
+		Query:    "What is Go?",
+		Messages: []models.ChatMessage{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello!"}},
+	})
+	assert.Equal(t, plain, withHistory, "history doesn't change the version")
+
+	pirate := PromptVersion(&models.InferenceRequest{
+		Messages: []models.ChatMessage{{Role: "system", Content: "Answer like a pirate."}},
+	})
+	formal := PromptVersion(&models.InferenceRequest{
+		Messages: []models.ChatMessage{{Role: "system", Content: "Answer formally."}},
+	})
+	assert.NotEqual(t, plain, pirate)
+	assert.NotEqual(t, pirate, formal)
+}
@@ -0,0 +1,116 @@
+package inference
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+)
+
+type keyCallKey struct{}
+
+// keyCall holds what metadataDoer saw of the provider's response to a call
+// made with an org's key
+type keyCall struct {
+	status    int
+	remaining float64 // Lowest fraction of the key's rate limits left, -1 if not reported
+}
+
+// rateLimitHeaders pairs the limit and remaining headers of OpenAI-compatible
+// providers (OpenAI, Groq, ...) and Anthropic
+var rateLimitHeaders = [][2]string{
+	{"x-ratelimit-limit-requests", "x-ratelimit-remaining-requests"},
+	{"x-ratelimit-limit-tokens", "x-ratelimit-remaining-tokens"},
+	{"anthropic-ratelimit-requests-limit", "anthropic-ratelimit-requests-remaining"},
+	{"anthropic-ratelimit-tokens-limit", "anthropic-ratelimit-tokens-remaining"},
+}
+
+// capture records the response's status and rate limit headers
+func (c *keyCall) capture(resp *http.Response) {
+	c.status = resp.StatusCode
+	for _, pair := range rateLimitHeaders {
+		limit, err := strconv.ParseFloat(resp.Header.Get(pair[0]), 64)
+		if err != nil || limit <= 0 {
+			continue
+		}
+		remaining, err := strconv.ParseFloat(resp.Header.Get(pair[1]), 64)
+		if err != nil {
+			continue
+		}
+		if fraction := remaining / limit; c.remaining < 0 || fraction < c.remaining {
+			c.remaining = fraction
+		}
+	}
+}
+
+// maxKeyedModels bounds the clients kept for orgs' keys. Past it the cache
+// starts over, which also drops the clients of rotated keys.
+const maxKeyedModels = 256
+
+// keyedModels caches the clients built for orgs' keys, so calls made with a
+// key reuse its client and connections. The zero value is ready to use.
+type keyedModels struct {
+	mu     sync.Mutex
+	models map[[sha256.Size]byte]llms.Model // By hash of the key
+}
+
+// get returns the client for key, building it the first time
+func (k *keyedModels) get(key string, build func(key string) (llms.Model, error)) (llms.Model, error) {
+	if k == nil {
+		return build(key)
+	}
+	id := sha256.Sum256([]byte(key))
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if llm, ok := k.models[id]; ok {
+		return llm, nil
+	}
+	llm, err := build(key)
+	if err != nil {
+		return nil, err
+	}
+	if k.models == nil || len(k.models) >= maxKeyedModels {
+		k.models = make(map[[sha256.Size]byte]llms.Model)
+	}
+	k.models[id] = llm
+	return llm, nil
+}
+
+// withOrgKey runs call with the platform's client, or with one built for the
+// key of the caller's org when it brought its own and kept in cached. The key's health is recorded from the provider's
+// response, and a call whose key the provider rejects is retried once with
+// the org's other key. Health is only tracked for providers whose clients go
+// through metadataDoer.
+func withOrgKey(ctx context.Context, provider string, platform llms.Model, cached *keyedModels, build func(key string) (llms.Model, error), call func(ctx context.Context, llm llms.Model) error) error {
+	keys := credentials.FromContext(ctx)
+	for attempt := 0; ; attempt++ {
+		key, ok, err := keys.Key(provider)
+		if err != nil {
+			return fmt.Errorf("%s: %w", provider, err)
+		}
+		if !ok {
+			return call(ctx, platform)
+		}
+
+		llm, err := cached.get(key, build)
+		if err != nil {
+			return fmt.Errorf("failed to create %s client with the org's key: %w", provider, err)
+		}
+		observed := &keyCall{remaining: -1}
+		err = call(context.WithValue(ctx, keyCallKey{}, observed), llm)
+		if observed.status == 0 {
+			return err
+		}
+		retry := keys.Report(ctx, provider, key, credentials.Outcome{Status: observed.status, Remaining: observed.remaining})
+		if err == nil || !retry || attempt > 0 {
+			return err
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+// responseReserve is the minimum number of tokens left free for the answer
+const responseReserve = 256
+
+// ErrPromptTooLarge is returned when the query alone doesn't fit the model's context window
+var ErrPromptTooLarge = errors.New("prompt exceeds model context window even after trimming context")
+
+// PromptGuard keeps assembled prompts inside the selected model's context window
+type PromptGuard struct {
+	contextWindow func(model string) int
+}
+
+func NewPromptGuard(modelRegistry *registry.ModelRegistry) *PromptGuard {
+	return &PromptGuard{
+		contextWindow: modelRegistry.ContextWindow,
+	}
+}
+
+// Fit drops the oldest history messages, then the oldest lines of req.Context,
+// until the prompt plus the response budget fits the model's context window. The returned request is a copy when
+// trimming was needed; trim info is nil when the request was left untouched.
+func (g *PromptGuard) Fit(req *models.InferenceRequest, model string) (*models.InferenceRequest, *models.PromptTrimInfo, error) {
+	return g.fitWithin(req, model, g.contextWindow(model))
+}
+
+// Run fits the request, calls infer, and if the provider still rejects the
+// prompt for being too long, halves the budget and retries once.
+func (g *PromptGuard) Run(
+	ctx context.Context,
+	req *models.InferenceRequest,
+	model string,
+	infer func(ctx context.Context, req *models.InferenceRequest) (string, error),
+) (string, *models.PromptTrimInfo, error) {
+	window := g.contextWindow(model)
+
+	fitted, trim, err := g.fitWithin(req, model, window)
+	if err != nil {
+		return "", trim, err
+	}
+
+	response, err := infer(ctx, fitted)
+	if err == nil || !isContextLengthError(err) {
+		return response, trim, err
+	}
+
+	// Our estimate was too optimistic for this model, retry with a tighter budget
+	retryReq, retryTrim, fitErr := g.fitWithin(req, model, window/2)
+	if fitErr != nil {
+		return "", retryTrim, fitErr
+	}
+	if retryTrim == nil {
+		retryTrim = &models.PromptTrimInfo{
+			OriginalTokens: countPromptTokens(req, model),
+			FinalTokens:    countPromptTokens(retryReq, model),
+			ContextWindow:  window,
+		}
+	}
+	retryTrim.Retried = true
+
+	response, err = infer(ctx, retryReq)
+	return response, retryTrim, err
+}
+
+func (g *PromptGuard) fitWithin(req *models.InferenceRequest, model string, window int) (*models.InferenceRequest, *models.PromptTrimInfo, error) {
+	budget := window - responseBudget(req)
+	original := countPromptTokens(req, model)
+	if original <= budget {
+		return req, nil, nil
+	}
+
+	trim := &models.PromptTrimInfo{
+		OriginalTokens: original,
+		ContextWindow:  g.contextWindow(model),
+	}
+
+	trimmed := *req
+	tokens := trimMessages(&trimmed, model, original, budget, trim)
+
+	// Then the oldest context lines, since history is appended in order.
+	// Lines are counted one by one, and the prompt recounted once it seems to fit.
+	lines := strings.Split(req.Context, "\n")
+	for len(lines) > 0 {
+		if tokens <= budget {
+			if tokens = countPromptTokens(&trimmed, model); tokens <= budget {
+				break
+			}
+		}
+		trim.TrimmedChars += len(lines[0]) + 1
+		if strings.TrimSpace(lines[0]) != "" {
+			trim.TrimmedLines++
+		}
+		tokens -= utils.CountTokens(lines[0]+"\n", model)
+		lines = lines[1:]
+		trimmed.Context = strings.Join(lines, "\n")
+	}
+
+	trim.FinalTokens = countPromptTokens(&trimmed, model)
+	if trim.FinalTokens > budget {
+		return nil, trim, ErrPromptTooLarge
+	}
+
+	return &trimmed, trim, nil
+}
+
+// trimMessages drops the oldest messages of req until it fits the budget and
+// returns the remaining prompt tokens, starting from the tokens of the whole
+// prompt. System messages set up the conversation, so they go only once
+// nothing else is left.
+func trimMessages(req *models.InferenceRequest, model string, tokens int, budget int, trim *models.PromptTrimInfo) int {
+	req.Messages = slices.Clone(req.Messages)
+	for _, dropSystem := range []bool{false, true} {
+		for i := 0; i < len(req.Messages) && tokens > budget; {
+			if !dropSystem && req.Messages[i].Role == "system" {
+				i++
+				continue
+			}
+			trim.TrimmedMessages++
+			trim.TrimmedChars += len(req.Messages[i].Content)
+			tokens -= utils.CountTokens(req.Messages[i].Content, model)
+			req.Messages = slices.Delete(req.Messages, i, i+1)
+		}
+	}
+	return tokens
+}
+
+// responseBudget is the number of tokens kept free for the model's answer
+func responseBudget(req *models.InferenceRequest) int {
+	if req.MaxTokens > responseReserve {
+		return req.MaxTokens
+	}
+	return responseReserve
+}
+
+// countPromptTokens counts the tokens of the prompt in model's encoding
+func countPromptTokens(req *models.InferenceRequest, model string) int {
+	tokens := utils.CountTokens(req.Query, model)
+	if req.Context != "" {
+		tokens += utils.CountTokens(req.Context, model)
+	}
+	for _, message := range req.Messages {
+		tokens += utils.CountTokens(message.Content, model)
+	}
+	return tokens
+}
+
+// isContextLengthError detects the provider errors returned for oversized prompts
+func isContextLengthError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "context_length_exceeded") ||
+		strings.Contains(msg, "maximum context length") ||
+		strings.Contains(msg, "context window") ||
+		strings.Contains(msg, "too many tokens")
+}
@@ -0,0 +1,102 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func newTestGuard(window int) *PromptGuard {
+	return &PromptGuard{
+		contextWindow: func(model string) int { return window },
+	}
+}
+
+func TestPromptGuard_FitsUntouched(t *testing.T) {
+	guard := newTestGuard(4096)
+
+	req := &models.InferenceRequest{Query: "What is 2+2?", Context: "user: hi\nassistant: hello\n"}
+
+	fitted, trim, err := guard.Fit(req, "test-model")
+
+	require.NoError(t, err)
+	assert.Nil(t, trim)
+	assert.Same(t, req, fitted)
+}
+
+func TestPromptGuard_TrimsOldestContext(t *testing.T) {
+	guard := newTestGuard(600)
+
+	var history []string
+	for i := 0; i < 40; i++ {
+		history = append(history, "user: "+strings.Repeat("x", 80))
+	}
+	req := &models.InferenceRequest{Query: "Latest question", Context: strings.Join(history, "\n")}
+
+	fitted, trim, err := guard.Fit(req, "test-model")
+
+	require.NoError(t, err)
+	require.NotNil(t, trim)
+	assert.Greater(t, trim.TrimmedLines, 0)
+	assert.Less(t, trim.FinalTokens, trim.OriginalTokens)
+	assert.Equal(t, req.Query, fitted.Query)
+	assert.True(t, strings.HasSuffix(req.Context, fitted.Context), "newest context should be kept")
+}
+
+func TestPromptGuard_QueryTooLarge(t *testing.T) {
+	guard := newTestGuard(300)
+
+	req := &models.InferenceRequest{Query: strings.Repeat("word ", 500)}
+
+	_, _, err := guard.Fit(req, "test-model")
+
+	assert.ErrorIs(t, err, ErrPromptTooLarge)
+}
+
+func TestPromptGuard_RetriesOnContextLengthError(t *testing.T) {
+	guard := newTestGuard(2000)
+
+	req := &models.InferenceRequest{Query: "Question", Context: strings.Repeat("assistant: earlier answer text\n", 150)}
+
+	calls := 0
+	infer := func(ctx context.Context, r *models.InferenceRequest) (string, error) {
+		calls++
+		if calls == 1 {
+			return "", errors.New("This model's maximum context length is 1000 tokens")
+		}
+		return "ok", nil
+	}
+
+	response, trim, err := guard.Run(context.Background(), req, "test-model", infer)
+
+	require.NoError(t, err)
+	assert.Equal(t, "ok", response)
+	assert.Equal(t, 2, calls)
+	require.NotNil(t, trim)
+	assert.True(t, trim.Retried)
+}
+
+func TestPromptGuard_TrimsOldestMessages(t *testing.T) {
+	guard := newTestGuard(600)
+
+	messages := []models.ChatMessage{{Role: "system", Content: "[Conversation Summary]: " + strings.Repeat("s", 80)}}
+	for i := 0; i < 40; i++ {
+		messages = append(messages, models.ChatMessage{Role: "user", Content: strings.Repeat("x", 80)})
+	}
+	req := &models.InferenceRequest{Query: "Latest question", Messages: messages}
+
+	fitted, trim, err := guard.Fit(req, "test-model")
+
+	require.NoError(t, err)
+	require.NotNil(t, trim)
+	assert.Greater(t, trim.TrimmedMessages, 0)
+	assert.Less(t, len(fitted.Messages), len(req.Messages))
+	assert.Equal(t, "system", fitted.Messages[0].Role, "system messages are dropped last")
+	assert.Len(t, req.Messages, 41, "the original request is untouched")
+}
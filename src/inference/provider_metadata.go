@@ -0,0 +1,232 @@
+package inference
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+	"go.opentelemetry.io/otel/attribute"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
+)
+
+var errEmptyResponse = errors.New("empty response from model")
+
+type providerMetadataKey struct{}
+
+type providerCallKey struct{}
+
+// ProviderMetadataRecorder collects the provider metadata of every model call
+// made while serving a request, keyed by the configured model name
+type ProviderMetadataRecorder struct {
+	byModel map[string]*models.ProviderMetadata
+	mu      sync.Mutex
+}
+
+// WithProviderMetadata returns a context that records provider metadata for
+// model calls made with it
+func WithProviderMetadata(ctx context.Context) (context.Context, *ProviderMetadataRecorder) {
+	recorder := &ProviderMetadataRecorder{
+		byModel: make(map[string]*models.ProviderMetadata),
+	}
+	return context.WithValue(ctx, providerMetadataKey{}, recorder), recorder
+}
+
+// For returns the metadata of the latest call to the given model, or nil if none was recorded
+func (r *ProviderMetadataRecorder) For(model string) *models.ProviderMetadata {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.byModel[model]
+}
+
+// record keeps the latest call's metadata, adding up the token usage of
+// every call to the model
+func (r *ProviderMetadataRecorder) record(model string, metadata *models.ProviderMetadata) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if previous := r.byModel[model]; previous != nil {
+		metadata.InputTokens += previous.InputTokens
+		metadata.OutputTokens += previous.OutputTokens
+	}
+	r.byModel[model] = metadata
+}
+
+// providerCall holds the response fields captured by metadataDoer for one call
+type providerCall struct {
+	ID                string `json:"id"`
+	Model             string `json:"model"`
+	SystemFingerprint string `json:"system_fingerprint"`
+}
+
+// metadataDoer is the HTTP client given to the OpenAI-compatible and Anthropic clients. It
+// captures the response fields langchaingo discards (served model, system
+// fingerprint) when the call's context asks for them, and tags calls with
+// correlation IDs when SetProviderCorrelation is on.
+type metadataDoer struct {
+	client *http.Client
+}
+
+// providerTransport carries the HTTP calls of the OpenAI-compatible and
+// Anthropic clients; nil uses http.DefaultTransport
+var (
+	providerTransport   http.RoundTripper
+	providerTransportMu sync.RWMutex
+)
+
+// SetHTTPTransport routes the OpenAI-compatible and Anthropic clients created
+// afterwards through transport, e.g. to record and replay provider calls
+func SetHTTPTransport(transport http.RoundTripper) {
+	providerTransportMu.Lock()
+	defer providerTransportMu.Unlock()
+
+	providerTransport = transport
+}
+
+func newMetadataDoer() *metadataDoer {
+	providerTransportMu.RLock()
+	defer providerTransportMu.RUnlock()
+
+	if providerTransport == nil {
+		return &metadataDoer{client: http.DefaultClient}
+	}
+	return &metadataDoer{client: &http.Client{Transport: providerTransport}}
+}
+
+func (d *metadataDoer) Do(req *http.Request) (*http.Response, error) {
+	req, err := correlate(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if observed, _ := req.Context().Value(keyCallKey{}).(*keyCall); observed != nil {
+		observed.capture(resp)
+	}
+	if status, _ := req.Context().Value(callStatusKey{}).(*callStatus); status != nil {
+		status.code = resp.StatusCode
+	}
+
+	call, _ := req.Context().Value(providerCallKey{}).(*providerCall)
+	if call == nil || !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Best effort: error bodies and unexpected payloads simply leave the fields empty
+	_ = json.Unmarshal(body, call)
+
+	return resp, nil
+}
+
+// tokenUsage is the token usage a provider reported for one call
+type tokenUsage struct {
+	input  int
+	output int
+}
+
+func (u tokenUsage) reported() bool {
+	return u.input > 0 || u.output > 0
+}
+
+// reportedUsage reads the token usage out of langchaingo's generation info,
+// whose keys differ per provider. It is zero when the provider reported none,
+// e.g. for most streamed responses.
+func reportedUsage(info map[string]any) tokenUsage {
+	switch {
+	case info["PromptTokens"] != nil: // OpenAI and compatible
+		return tokenUsage{input: toInt(info["PromptTokens"]), output: toInt(info["CompletionTokens"])}
+	case info["InputTokens"] != nil: // Anthropic
+		return tokenUsage{input: toInt(info["InputTokens"]), output: toInt(info["OutputTokens"])}
+	case info["input_tokens"] != nil: // Gemini
+		return tokenUsage{input: toInt(info["input_tokens"]), output: toInt(info["output_tokens"])}
+	case info["usage"] != nil: // Mistral, as the SDK's usage struct
+		var usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		}
+		if data, err := json.Marshal(info["usage"]); err == nil && json.Unmarshal(data, &usage) == nil {
+			return tokenUsage{input: usage.PromptTokens, output: usage.CompletionTokens}
+		}
+	}
+	return tokenUsage{}
+}
+
+func toInt(value any) int {
+	switch v := value.(type) {
+	case int:
+		return v
+	case int32:
+		return int(v)
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	}
+	return 0
+}
+
+// generate runs a completion of the conversation and records the provider
+// metadata under the given model name when the context carries a recorder.
+// It returns the token usage the provider reported, if any.
+func generate(ctx context.Context, llm llms.Model, model string, messages []llms.MessageContent, options ...llms.CallOption) (response string, usage tokenUsage, err error) {
+	ctx, span := tracing.Start(ctx, "model.Generate", attribute.String("gen_ai.request.model", model))
+	defer func() {
+		if usage.reported() {
+			span.SetAttributes(
+				attribute.Int("gen_ai.usage.input_tokens", usage.input),
+				attribute.Int("gen_ai.usage.output_tokens", usage.output),
+			)
+		}
+		tracing.End(span, err)
+	}()
+
+	recorder, _ := ctx.Value(providerMetadataKey{}).(*ProviderMetadataRecorder)
+	call := &providerCall{}
+	if recorder != nil {
+		ctx = context.WithValue(ctx, providerCallKey{}, call)
+	}
+
+	resp, err := llm.GenerateContent(ctx, messages, options...)
+	if err != nil {
+		return "", tokenUsage{}, err
+	}
+	if len(resp.Choices) == 0 {
+		return "", tokenUsage{}, errEmptyResponse
+	}
+
+	choice := resp.Choices[0]
+	usage = reportedUsage(choice.GenerationInfo)
+	if toolCalls, _ := ctx.Value(toolCallsKey{}).(*ToolCallRecorder); toolCalls != nil {
+		toolCalls.record(model, choice.ToolCalls)
+	}
+	if recorder != nil {
+		recorder.record(model, &models.ProviderMetadata{
+			FinishReason:      choice.StopReason,
+			ServedModel:       call.Model,
+			SystemFingerprint: call.SystemFingerprint,
+			ResponseID:        call.ID,
+			InputTokens:       usage.input,
+			OutputTokens:      usage.output,
+		})
+	}
+
+	return choice.Content, usage, nil
+}
@@ -0,0 +1,78 @@
+package inference
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms/openai"
+)
+
+func newTestProvider(t *testing.T) *openai.LLM {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"id": "chatcmpl-123",
+			"model": "gpt-4o-2024-08-06",
+			"system_fingerprint": "fp_abc",
+			"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "length"}],
+			"usage": {"prompt_tokens": 5, "completion_tokens": 1, "total_tokens": 6}
+		}`))
+	}))
+	t.Cleanup(server.Close)
+
+	llm, err := openai.New(
+		openai.WithBaseURL(server.URL),
+		openai.WithToken("test"),
+		openai.WithModel("gpt-4o"),
+		openai.WithHTTPClient(newMetadataDoer()),
+	)
+	require.NoError(t, err)
+	return llm
+}
+
+func TestGenerate_RecordsProviderMetadata(t *testing.T) {
+	llm := newTestProvider(t)
+	ctx, recorder := WithProviderMetadata(context.Background())
+
+	response, usage, err := generate(ctx, llm, "gpt-4o", singlePrompt("Hi"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", response)
+	assert.Equal(t, tokenUsage{input: 5, output: 1}, usage)
+
+	metadata := recorder.For("gpt-4o")
+	require.NotNil(t, metadata)
+	assert.Equal(t, "length", metadata.FinishReason)
+	assert.Equal(t, "gpt-4o-2024-08-06", metadata.ServedModel)
+	assert.Equal(t, "fp_abc", metadata.SystemFingerprint)
+	assert.Equal(t, "chatcmpl-123", metadata.ResponseID)
+	assert.Equal(t, 5, metadata.InputTokens)
+
+	// Usage adds up over calls to the same model
+	_, _, err = generate(ctx, llm, "gpt-4o", singlePrompt("Hi again"))
+	require.NoError(t, err)
+	assert.Equal(t, 10, recorder.For("gpt-4o").InputTokens)
+	assert.Equal(t, 2, recorder.For("gpt-4o").OutputTokens)
+}
+
+func TestReportedUsage_ProviderFormats(t *testing.T) {
+	assert.Equal(t, tokenUsage{input: 3, output: 4}, reportedUsage(map[string]any{"InputTokens": 3, "OutputTokens": 4}))
+	assert.Equal(t, tokenUsage{input: 3, output: 4}, reportedUsage(map[string]any{"input_tokens": int32(3), "output_tokens": int32(4)}))
+	assert.Equal(t, tokenUsage{input: 3, output: 4}, reportedUsage(map[string]any{"usage": struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens,omitempty"`
+	}{3, 4}}))
+	assert.False(t, reportedUsage(map[string]any{"created": 1}).reported())
+	assert.False(t, reportedUsage(nil).reported())
+}
+
+func TestGenerate_WithoutRecorder(t *testing.T) {
+	llm := newTestProvider(t)
+
+	response, _, err := generate(context.Background(), llm, "gpt-4o", singlePrompt("Hi"))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", response)
+}
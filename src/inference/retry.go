@@ -0,0 +1,90 @@
+package inference
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+type callStatusKey struct{}
+
+// callStatus holds the HTTP status of the provider's response to a call, as
+// seen by metadataDoer; 0 if there was none
+type callStatus struct {
+	code int
+}
+
+// retryPolicy retries model calls that fail with a transient provider error
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryPolicy(cfg config.SLMRetryConfig) retryPolicy {
+	return retryPolicy{
+		maxAttempts:    max(cfg.MaxAttempts, 1),
+		initialBackoff: cfg.InitialBackoff,
+		maxBackoff:     max(cfg.MaxBackoff, cfg.InitialBackoff),
+	}
+}
+
+// do runs call until it succeeds, fails for good or runs out of attempts.
+// Each attempt is given timeout, when set. retryable can veto a retry, e.g.
+// once a stream has sent output.
+func (p retryPolicy) do(ctx context.Context, timeout time.Duration, retryable func() bool, call func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		status := &callStatus{}
+		attemptCtx := context.WithValue(ctx, callStatusKey{}, status)
+		cancel := context.CancelFunc(func() {})
+		if timeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(attemptCtx, timeout)
+		}
+		err := call(attemptCtx)
+		timedOut := ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded)
+		cancel()
+
+		if err == nil {
+			return nil
+		}
+		if timedOut {
+			return fmt.Errorf("timed out after %v: %w", timeout, err)
+		}
+		if attempt >= p.maxAttempts || !transientStatus(status.code) || (retryable != nil && !retryable()) {
+			return err
+		}
+
+		timer := time.NewTimer(p.backoff(attempt))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		}
+	}
+}
+
+// backoff returns the wait before the attempt after the given one: doubling
+// from the initial backoff up to the maximum, with up to half of it random
+// so rate limited calls don't retry in lockstep
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	backoff := p.initialBackoff
+	for i := 1; i < attempt && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	backoff = min(backoff, p.maxBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// transientStatus reports whether a provider response is worth retrying
+func transientStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
@@ -0,0 +1,87 @@
+package inference
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// StrategyBandit sends each query to the one model a bandit picks
+const StrategyBandit = "bandit"
+
+// defaultJudgeTimeout bounds a judge's scoring when its model has no timeout
+const defaultJudgeTimeout = 30 * time.Second
+
+// SetBandit sets the bandit that picks the model under the bandit strategy.
+// Without one the first model answers.
+func (e *SLMEngine) SetBandit(b *bandit.Bandit) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.bandit = b
+}
+
+// inferBandit asks the model the bandit picks and tells the bandit how it
+// went: how long it took, a failure, and now and then the judge's score
+func (e *SLMEngine) inferBandit(ctx context.Context, req *models.InferenceRequest) (strategyOutcome, error) {
+	b := e.bandit
+	client, ok := e.client(b.Select(ctx))
+	if !ok {
+		client = e.clients[0]
+	}
+
+	start := time.Now()
+	outcome, err := e.inferSingleModel(ctx, req, client)
+	if err != nil {
+		if IsProviderFailure(err) && ctx.Err() == nil {
+			if err := b.ObserveQuality(ctx, client.name, 0); err != nil {
+				log.Printf("Failed to record SLM bandit observation: %v", err)
+			}
+		}
+		return outcome, err
+	}
+	if err := b.ObserveAnswer(ctx, client.name, time.Since(start)); err != nil {
+		log.Printf("Failed to record SLM bandit observation: %v", err)
+	}
+	if b.ShouldJudge() {
+		go e.judgeAnswer(b, req.Query, client.name, outcome.response)
+	}
+	return outcome, nil
+}
+
+// judgeAnswer has the judge model score an answer from 1 to 10 and counts
+// the score toward the answering model's quality
+func (e *SLMEngine) judgeAnswer(b *bandit.Bandit, query string, model string, answer string) {
+	judge := e.judgeModel()
+	ctx, cancel := context.WithTimeout(context.Background(), cmp.Or(judge.timeout, defaultJudgeTimeout))
+	defer cancel()
+
+	prompt := fmt.Sprintf("You are judging a model's answer.\n\nQuestion: %s\n\nAnswer:\n%s\n\n", query, answer) +
+		`Score the answer from 1 (wrong or useless) to 10 (accurate, complete and helpful). Reply with JSON only: {"score": <1-10>}`
+	raw, err := e.runModel(ctx, judge, singlePrompt(prompt), &models.InferenceRequest{
+		Query:          query,
+		Temperature:    0.1,
+		ResponseFormat: "json_object",
+	})
+	if err != nil {
+		log.Printf("Judge %s failed to score %s's answer: %v", judge.name, model, err)
+		return
+	}
+
+	var verdict struct {
+		Score float64 `json:"score"`
+	}
+	if err := json.Unmarshal([]byte(extractJSON(raw)), &verdict); err != nil || verdict.Score < 1 || verdict.Score > 10 {
+		log.Printf("Judge %s answered with an invalid score for %s's answer: %q", judge.name, model, raw)
+		return
+	}
+	if err := b.ObserveQuality(ctx, model, (verdict.Score-1)/9); err != nil {
+		log.Printf("Failed to record SLM bandit observation: %v", err)
+	}
+}
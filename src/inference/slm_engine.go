@@ -3,7 +3,7 @@ package inference
 /*
 Hybrid SLM Inference Engine
 
-This engine implements three inference strategies for Small Language Models (SLMs):
+This engine implements five inference strategies for Small Language Models (SLMs):
 
 1. PARALLEL Strategy (like parallel resistors):
    - Runs all models simultaneously with the same prompt
@@ -23,10 +23,25 @@ This engine implements three inference strategies for Small Language Models (SLM
    - Balances speed and quality
    - Best for: General use cases requiring both diversity and refinement
 
+4. RACE Strategy (first success):
+   - Runs all models simultaneously and keeps the first answer that succeeds
+   - The calls still running are cancelled
+   - Fastest, but the answer is whichever model was quickest, not the best
+   - Best for: Latency-sensitive traffic
+
+5. BANDIT Strategy (learned allocation):
+   - Runs one model per query, picked by a multi-armed bandit
+   - Traffic starts out following the weights and shifts toward the models
+     with the best rated, judged and fastest answers; pinned models keep
+     their weight as a fixed share
+   - Best for: Finding the best model for the traffic at the cost of one call
+
 Configuration (config.yaml):
-- strategy: "parallel" | "series" | "hybrid"
-- aggregation_fn: "weighted" | "longest" | "voting"
-- models: Array of models with name, endpoint, api_key, and weight
+- strategy: "parallel" | "series" | "hybrid" | "race" | "bandit"
+- aggregation_fn: "weighted" | "longest" | "voting" | "embedding_consensus" | "judge"
+- models: Array of models with name, endpoint, api_key, weight and an optional timeout
+- timeout: How long each model call may take; retry: how rate limited and
+  failing calls are retried
 
 Example:
   models:
@@ -39,23 +54,40 @@ Example:
 */
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"net/url"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/tmc/langchaingo/llms"
 	"github.com/tmc/langchaingo/llms/openai"
+	"go.opentelemetry.io/otel/attribute"
 
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
 )
 
+// SLMProvider names the SLM tier's provider for keys orgs bring
+const SLMProvider = "groq"
+
 type modelClient struct {
-	name   string
-	llm    llms.Model
-	weight float64
+	name     string
+	endpoint string
+	provider string       // SLMProvider if endpoint is its API, else "" (see slmProviderFor)
+	keyed    *keyedModels // Clients for orgs' keys
+	llm      llms.Model
+	weight   float64
+	timeout  time.Duration // Per call; 0 for none
 }
 
 type inferenceResult struct {
@@ -63,11 +95,24 @@ type inferenceResult struct {
 	response  string
 	weight    float64
 	err       error
+	verdict   *models.JudgeVerdict // Set when the judge aggregation's rationale is returned
+}
+
+// strategyOutcome is the answer a strategy settled on and the model that produced it
+type strategyOutcome struct {
+	response      string
+	selectedModel string
+	aggregated    bool // True if the answer was picked by the aggregation function
+	verdict       *models.JudgeVerdict
 }
 
 type SLMEngine struct {
 	config     *config.SLMConfig
 	clients    []modelClient
+	retry      retryPolicy
+	embedder   models.Embedder // For the embedding_consensus aggregation, optional
+	bandit     *bandit.Bandit  // Picks the model under the bandit strategy, optional
+	allows     ResidencyCheck  // Data residency rules, optional
 	workerPool chan struct{}
 	mu         sync.RWMutex
 }
@@ -93,19 +138,19 @@ func NewSLMEngine(cfg *config.SLMConfig) (*SLMEngine, error) {
 			return nil, fmt.Errorf("API key is empty for model %s (check GROQ_API_KEY environment variable)", modelCfg.Name)
 		}
 
-		llm, err := openai.New(
-			openai.WithBaseURL(modelCfg.Endpoint),
-			openai.WithToken(modelCfg.APIKey),
-			openai.WithModel(modelCfg.Name),
-		)
+		llm, err := newSLMModel(modelCfg.Endpoint, modelCfg.APIKey, modelCfg.Name)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create client for model %s: %w", modelCfg.Name, err)
 		}
 
 		clients = append(clients, modelClient{
-			name:   modelCfg.Name,
-			llm:    llm,
-			weight: modelCfg.Weight,
+			name:     modelCfg.Name,
+			endpoint: modelCfg.Endpoint,
+			provider: slmProviderFor(modelCfg.Endpoint),
+			keyed:    &keyedModels{},
+			llm:      llm,
+			weight:   modelCfg.Weight,
+			timeout:  cmp.Or(modelCfg.Timeout, cfg.Timeout),
 		})
 	}
 
@@ -114,42 +159,151 @@ func NewSLMEngine(cfg *config.SLMConfig) (*SLMEngine, error) {
 	return &SLMEngine{
 		config:     cfg,
 		clients:    clients,
+		retry:      newRetryPolicy(cfg.Retry),
 		workerPool: workerPool,
 	}, nil
 }
 
-func (e *SLMEngine) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+// Infer runs the configured strategy and reports which models were called,
+// how long each took, and which model's answer was returned
+func (e *SLMEngine) Infer(ctx context.Context, req *models.InferenceRequest) (*models.SLMResult, error) {
+	ctx, span := tracing.Start(ctx, "slm.Infer")
+	result, err := e.infer(ctx, req)
+	if result != nil {
+		span.SetAttributes(
+			attribute.String("hybridlm.strategy", result.Strategy),
+			attribute.String("hybridlm.selected_model", result.SelectedModel),
+		)
+	}
+	tracing.End(span, err)
+	return result, err
+}
+
+func (e *SLMEngine) infer(ctx context.Context, req *models.InferenceRequest) (*models.SLMResult, error) {
 
 	select {
 	case e.workerPool <- struct{}{}:
 		defer func() { <-e.workerPool }()
 	case <-ctx.Done():
-		return "", ctx.Err()
+		return nil, ctx.Err()
 	}
 
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	// Choose strategy based on configuration
-	switch e.config.Strategy {
-	case "parallel":
-		return e.inferParallel(ctx, req)
-	case "series":
-		return e.inferSeries(ctx, req)
-	case "hybrid":
-		return e.inferHybrid(ctx, req)
-	default:
-		// Default to first model if strategy not recognized
-		return e.inferSingleModel(ctx, req, e.clients[0])
+	req, err := e.keepInRegions(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ctx, tracker := withUsageTracker(ctx)
+
+	var outcome strategyOutcome
+	strategy := e.config.Strategy
+
+	// A routing target runs just that model; otherwise choose strategy based on configuration
+	if client, ok := e.client(req.TargetModel); ok {
+		strategy = "targeted"
+		outcome, err = e.inferSingleModel(ctx, req, client)
+	} else if len(req.Tools) > 0 && (strategy != StrategyBandit || e.bandit == nil) {
+		// Tool calls can't be aggregated or refined, so one model answers
+		strategy = "single"
+		outcome, err = e.inferSingleModel(ctx, req, e.clients[0])
+	} else {
+		switch strategy {
+		case "parallel":
+			outcome, err = e.inferParallel(ctx, req)
+		case "series":
+			outcome, err = e.inferSeries(ctx, req)
+		case "hybrid":
+			outcome, err = e.inferHybrid(ctx, req)
+		case "race":
+			outcome, err = e.inferRace(ctx, req)
+		case StrategyBandit:
+			if e.bandit == nil {
+				strategy = "single"
+				outcome, err = e.inferSingleModel(ctx, req, e.clients[0])
+				break
+			}
+			outcome, err = e.inferBandit(ctx, req)
+		default:
+			// Default to first model if strategy not recognized
+			strategy = "single"
+			outcome, err = e.inferSingleModel(ctx, req, e.clients[0])
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.SLMResult{
+		Response:       outcome.response,
+		Strategy:       strategy,
+		SelectedModel:  outcome.selectedModel,
+		ModelsUsed:     tracker.models(),
+		ModelLatencies: tracker.latencies(),
+		Usage:          tracker.snapshot(),
+		Judge:          outcome.verdict,
+	}
+	if outcome.aggregated {
+		result.Aggregation = e.aggregationName()
+	}
+
+	return result, nil
+}
+
+func newSLMModel(endpoint string, apiKey string, model string) (llms.Model, error) {
+	return openai.New(
+		openai.WithBaseURL(endpoint),
+		openai.WithToken(apiKey),
+		openai.WithModel(model),
+		openai.WithHTTPClient(newMetadataDoer()),
+	)
+}
+
+// slmProviderHosts are the API hosts of SLMProvider. Keys orgs bring for it
+// are only sent there, never to other endpoints (self-hosted models, other
+// OpenAI-compatible services) the SLM tier calls.
+var slmProviderHosts = []string{"api.groq.com"}
+
+// slmProviderFor returns SLMProvider if endpoint is its API, else ""
+func slmProviderFor(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
 	}
+	if slices.Contains(slmProviderHosts, strings.ToLower(u.Hostname())) {
+		return SLMProvider
+	}
+	return ""
+}
+
+// withLLM runs call with the model's platform client, or with one using the
+// key of the caller's org when it brought its own and the model is served by
+// SLMProvider (see withOrgKey). Other endpoints always get the platform's
+// client, if the org allows it.
+func (c modelClient) withLLM(ctx context.Context, call func(ctx context.Context, llm llms.Model) error) error {
+	if c.provider == "" {
+		if _, _, err := credentials.FromContext(ctx).Key(SLMProvider); err != nil {
+			return fmt.Errorf("%s: %w", SLMProvider, err)
+		}
+		return call(ctx, c.llm)
+	}
+	return withOrgKey(ctx, SLMProvider, c.llm, c.keyed, func(key string) (llms.Model, error) {
+		return newSLMModel(c.endpoint, key, c.name)
+	}, call)
+}
+
+// InferChat answers a conversation whose last message is the user's turn
+func (e *SLMEngine) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (*models.SLMResult, error) {
+	return e.Infer(ctx, models.NewChatInferenceRequest(messages, opts))
 }
 
 // Parallel inference: Run all models simultaneously and aggregate results
-func (e *SLMEngine) inferParallel(ctx context.Context, req *models.InferenceRequest) (string, error) {
+func (e *SLMEngine) inferParallel(ctx context.Context, req *models.InferenceRequest) (strategyOutcome, error) {
 	results := make(chan inferenceResult, len(e.clients))
 	var wg sync.WaitGroup
 
-	prompt := e.buildPrompt(req)
+	prompt := promptMessages(req)
 
 	// Run all models in parallel
 	for _, client := range e.clients {
@@ -157,7 +311,7 @@ func (e *SLMEngine) inferParallel(ctx context.Context, req *models.InferenceRequ
 		go func(c modelClient) {
 			defer wg.Done()
 
-			response, err := e.runModel(ctx, c, prompt, req.Temperature)
+			response, err := e.runModel(ctx, c, prompt, req)
 			results <- inferenceResult{
 				modelName: c.name,
 				response:  response,
@@ -180,18 +334,49 @@ func (e *SLMEngine) inferParallel(ctx context.Context, req *models.InferenceRequ
 	}
 
 	// Aggregate results
-	return e.aggregateResults(allResults)
+	best, err := e.aggregateResults(ctx, req, allResults)
+	if err != nil {
+		return strategyOutcome{}, err
+	}
+	return strategyOutcome{response: best.response, selectedModel: best.modelName, aggregated: true, verdict: best.verdict}, nil
+}
+
+// Race inference: Run all models simultaneously and answer with the first
+// that succeeds, cancelling the others
+func (e *SLMEngine) inferRace(ctx context.Context, req *models.InferenceRequest) (strategyOutcome, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan inferenceResult, len(e.clients))
+	prompt := promptMessages(req)
+	for _, client := range e.clients {
+		go func(c modelClient) {
+			response, err := e.runModel(ctx, c, prompt, req)
+			results <- inferenceResult{modelName: c.name, response: response, err: err}
+		}(client)
+	}
+
+	var errs []error
+	for range e.clients {
+		result := <-results
+		if result.err == nil {
+			return strategyOutcome{response: result.response, selectedModel: result.modelName}, nil
+		}
+		errs = append(errs, result.err)
+	}
+	return strategyOutcome{}, fmt.Errorf("all models failed: %w", errors.Join(errs...))
 }
 
 // Series inference: Chain models sequentially, each refining the previous output
-func (e *SLMEngine) inferSeries(ctx context.Context, req *models.InferenceRequest) (string, error) {
-	prompt := e.buildPrompt(req)
+func (e *SLMEngine) inferSeries(ctx context.Context, req *models.InferenceRequest) (strategyOutcome, error) {
+	prompt := promptMessages(req)
 
 	// First model generates initial response
-	response, err := e.runModel(ctx, e.clients[0], prompt, req.Temperature)
+	response, err := e.runModel(ctx, e.clients[0], prompt, req)
 	if err != nil {
-		return "", fmt.Errorf("first model failed: %w", err)
+		return strategyOutcome{}, fmt.Errorf("first model failed: %w", err)
 	}
+	selectedModel := e.clients[0].name
 
 	// Subsequent models refine the response
 	for i := 1; i < len(e.clients); i++ {
@@ -201,19 +386,20 @@ func (e *SLMEngine) inferSeries(ctx context.Context, req *models.InferenceReques
 			response,
 		)
 
-		refined, err := e.runModel(ctx, e.clients[i], refinementPrompt, req.Temperature)
+		refined, err := e.runModel(ctx, e.clients[i], singlePrompt(refinementPrompt), req)
 		if err != nil {
 			// If refinement fails, return previous response
-			return response, nil
+			return strategyOutcome{response: response, selectedModel: selectedModel}, nil
 		}
 		response = refined
+		selectedModel = e.clients[i].name
 	}
 
-	return response, nil
+	return strategyOutcome{response: response, selectedModel: selectedModel}, nil
 }
 
 // Hybrid inference: Parallel first, then series refinement with best result
-func (e *SLMEngine) inferHybrid(ctx context.Context, req *models.InferenceRequest) (string, error) {
+func (e *SLMEngine) inferHybrid(ctx context.Context, req *models.InferenceRequest) (strategyOutcome, error) {
 	// Phase 1: Parallel inference with first N-1 models
 	parallelCount := len(e.clients) - 1
 	if parallelCount < 1 {
@@ -223,7 +409,7 @@ func (e *SLMEngine) inferHybrid(ctx context.Context, req *models.InferenceReques
 	results := make(chan inferenceResult, parallelCount)
 	var wg sync.WaitGroup
 
-	prompt := e.buildPrompt(req)
+	prompt := promptMessages(req)
 
 	// Run parallel inference
 	for i := 0; i < parallelCount; i++ {
@@ -231,7 +417,7 @@ func (e *SLMEngine) inferHybrid(ctx context.Context, req *models.InferenceReques
 		go func(c modelClient) {
 			defer wg.Done()
 
-			response, err := e.runModel(ctx, c, prompt, req.Temperature)
+			response, err := e.runModel(ctx, c, prompt, req)
 			results <- inferenceResult{
 				modelName: c.name,
 				response:  response,
@@ -253,10 +439,12 @@ func (e *SLMEngine) inferHybrid(ctx context.Context, req *models.InferenceReques
 	}
 
 	// Get best response from parallel phase
-	bestResponse, err := e.aggregateResults(allResults)
+	best, err := e.aggregateResults(ctx, req, allResults)
 	if err != nil {
-		return "", err
+		return strategyOutcome{}, err
 	}
+	bestResponse := best.response
+	aggregatedOutcome := strategyOutcome{response: bestResponse, selectedModel: best.modelName, aggregated: true, verdict: best.verdict}
 
 	// Phase 2: Refine with the last (usually most capable) model
 	if len(e.clients) > 1 {
@@ -267,34 +455,43 @@ func (e *SLMEngine) inferHybrid(ctx context.Context, req *models.InferenceReques
 			bestResponse,
 		)
 
-		refined, err := e.runModel(ctx, lastModel, refinementPrompt, req.Temperature)
+		refined, err := e.runModel(ctx, lastModel, singlePrompt(refinementPrompt), req)
 		if err != nil {
 			// If refinement fails, return aggregated response
-			return bestResponse, nil
+			return aggregatedOutcome, nil
 		}
-		return refined, nil
+		return strategyOutcome{response: refined, selectedModel: lastModel.name, aggregated: true, verdict: best.verdict}, nil
 	}
 
-	return bestResponse, nil
+	return aggregatedOutcome, nil
 }
 
 // Helper: Run a single model
-func (e *SLMEngine) inferSingleModel(ctx context.Context, req *models.InferenceRequest, client modelClient) (string, error) {
-	prompt := e.buildPrompt(req)
-	return e.runModel(ctx, client, prompt, req.Temperature)
+func (e *SLMEngine) inferSingleModel(ctx context.Context, req *models.InferenceRequest, client modelClient) (strategyOutcome, error) {
+	prompt := promptMessages(req)
+	response, err := e.runModel(ctx, client, prompt, req)
+	if err != nil {
+		return strategyOutcome{}, err
+	}
+	return strategyOutcome{response: response, selectedModel: client.name}, nil
 }
 
-// Helper: Build prompt from request
-func (e *SLMEngine) buildPrompt(req *models.InferenceRequest) string {
-	if req.Context != "" {
-		return fmt.Sprintf("Context: %s\n\nQuestion: %s", req.Context, req.Query)
+// Helper: Find the client for a configured model
+func (e *SLMEngine) client(name string) (modelClient, bool) {
+	if name == "" {
+		return modelClient{}, false
 	}
-	return req.Query
+	for _, client := range e.clients {
+		if client.name == name {
+			return client, true
+		}
+	}
+	return modelClient{}, false
 }
 
 // Helper: Run inference on a specific model
-func (e *SLMEngine) runModel(ctx context.Context, client modelClient, prompt string, temperature float32) (string, error) {
-	temp := float64(temperature)
+func (e *SLMEngine) runModel(ctx context.Context, client modelClient, prompt []llms.MessageContent, req *models.InferenceRequest) (string, error) {
+	temp := float64(req.Temperature)
 	if temp == 0 {
 		temp = 0.7
 	}
@@ -303,13 +500,32 @@ func (e *SLMEngine) runModel(ctx context.Context, client modelClient, prompt str
 		llms.WithTemperature(temp),
 		llms.WithMaxTokens(e.config.MaxTokens),
 	}
-
-	response, err := llms.GenerateFromSinglePrompt(
-		ctx,
-		client.llm,
-		prompt,
-		callOptions...,
-	)
+	if req.ResponseFormat == "json_object" {
+		callOptions = append(callOptions, llms.WithJSONMode())
+	}
+	callOptions = withTools(req, callOptions)
+
+	var response string
+	err := e.retry.do(ctx, client.timeout, nil, func(ctx context.Context) error {
+		return client.withLLM(ctx, func(ctx context.Context, llm llms.Model) error {
+			start := time.Now()
+			var usage tokenUsage
+			var err error
+			response, usage, err = generate(
+				ctx,
+				llm,
+				client.name,
+				prompt,
+				callOptions...,
+			)
+
+			// Failed calls still consumed prompt tokens on the provider side
+			if tracker := usageTrackerFrom(ctx); tracker != nil {
+				tracker.record(client.name, messagesText(prompt), response, usage, time.Since(start))
+			}
+			return err
+		})
+	})
 	if err != nil {
 		return "", fmt.Errorf("model %s generation failed: %w", client.name, err)
 	}
@@ -318,60 +534,92 @@ func (e *SLMEngine) runModel(ctx context.Context, client modelClient, prompt str
 }
 
 // Helper: Aggregate results from multiple models
-func (e *SLMEngine) aggregateResults(results []inferenceResult) (string, error) {
+func (e *SLMEngine) aggregateResults(ctx context.Context, req *models.InferenceRequest, results []inferenceResult) (inferenceResult, error) {
 	// Filter out errors and collect error messages
 	validResults := make([]inferenceResult, 0)
-	var errorMessages []string
+	var errorFormats []string
+	var errorArgs []any
 
 	for _, r := range results {
 		if r.err == nil && r.response != "" {
 			validResults = append(validResults, r)
 		} else if r.err != nil {
-			errorMessages = append(errorMessages, fmt.Sprintf("%s: %v", r.modelName, r.err))
+			errorFormats = append(errorFormats, "%s: %w")
+			errorArgs = append(errorArgs, r.modelName, r.err)
 		}
 	}
 
 	if len(validResults) == 0 {
-		errorDetail := ""
-		if len(errorMessages) > 0 {
-			errorDetail = " - Errors: " + strings.Join(errorMessages, "; ")
+		if len(errorFormats) == 0 {
+			return inferenceResult{}, fmt.Errorf("all models failed to generate responses")
 		}
-		return "", fmt.Errorf("all models failed to generate responses%s", errorDetail)
+		// Wrap every model's error so callers can still tell cancellations
+		// and context length errors apart from provider failures
+		return inferenceResult{}, fmt.Errorf("all models failed to generate responses - Errors: "+strings.Join(errorFormats, "; "), errorArgs...)
 	}
 
-	switch e.config.AggregationFn {
+	switch e.aggregationName() {
 	case "weighted":
 		return e.aggregateWeighted(validResults), nil
 	case "longest":
 		return e.aggregateLongest(validResults), nil
 	case "voting":
 		return e.aggregateVoting(validResults), nil
+	case "embedding_consensus":
+		best, err := e.aggregateConsensus(ctx, validResults)
+		if err != nil {
+			log.Printf("Embedding consensus failed, falling back to voting: %v", err)
+			return e.aggregateVoting(validResults), nil
+		}
+		return best, nil
+	case "judge":
+		best, err := e.aggregateJudge(ctx, req, validResults)
+		if err != nil {
+			log.Printf("Judge aggregation failed, falling back to weighted: %v", err)
+			return e.aggregateWeighted(validResults), nil
+		}
+		return best, nil
 	default:
-		// Default to weighted
 		return e.aggregateWeighted(validResults), nil
 	}
 }
 
+// aggregationName returns the configured aggregation function, defaulting to
+// weighted. Embedding consensus falls back to voting without an embedder.
+func (e *SLMEngine) aggregationName() string {
+	switch e.config.AggregationFn {
+	case "embedding_consensus":
+		if e.embedder == nil {
+			return "voting"
+		}
+		return e.config.AggregationFn
+	case "weighted", "longest", "voting", "judge":
+		return e.config.AggregationFn
+	default:
+		return "weighted"
+	}
+}
+
 // Weighted aggregation: Choose response from highest weighted model
-func (e *SLMEngine) aggregateWeighted(results []inferenceResult) string {
+func (e *SLMEngine) aggregateWeighted(results []inferenceResult) inferenceResult {
 	sort.Slice(results, func(i, j int) bool {
 		return results[i].weight > results[j].weight
 	})
-	return results[0].response
+	return results[0]
 }
 
 // Longest aggregation: Choose the most detailed response
-func (e *SLMEngine) aggregateLongest(results []inferenceResult) string {
+func (e *SLMEngine) aggregateLongest(results []inferenceResult) inferenceResult {
 	sort.Slice(results, func(i, j int) bool {
 		return len(results[i].response) > len(results[j].response)
 	})
-	return results[0].response
+	return results[0]
 }
 
 // Voting aggregation: Simple similarity-based voting (returns most common pattern)
-func (e *SLMEngine) aggregateVoting(results []inferenceResult) string {
+func (e *SLMEngine) aggregateVoting(results []inferenceResult) inferenceResult {
 	if len(results) == 1 {
-		return results[0].response
+		return results[0]
 	}
 
 	// For simplicity, use weighted approach with a twist:
@@ -400,7 +648,7 @@ func (e *SLMEngine) aggregateVoting(results []inferenceResult) string {
 		return scores[i].score > scores[j].score
 	})
 
-	return scores[0].result.response
+	return scores[0].result
 }
 
 // Simple similarity metric based on length and common words
@@ -434,7 +682,11 @@ func (e *SLMEngine) calculateSimilarity(s1, s2 string) float64 {
 	return float64(common) / float64(union)
 }
 
-func (e *SLMEngine) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) error {
+// InferStreaming streams one model's answer. Its result, with the model that
+// answered and the tokens it used, goes to the context's models.SLMResultRecorder.
+func (e *SLMEngine) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) (err error) {
+	ctx, span := tracing.Start(ctx, "slm.InferStreaming")
+	defer func() { tracing.End(span, err) }()
 
 	select {
 	case e.workerPool <- struct{}{}:
@@ -446,31 +698,105 @@ func (e *SLMEngine) InferStreaming(ctx context.Context, req *models.InferenceReq
 	e.mu.RLock()
 	defer e.mu.RUnlock()
 
-	// For streaming, use the first (fastest) model only
-	// Hybrid/parallel strategies don't work well with streaming
-	prompt := e.buildPrompt(req)
+	req, err = e.keepInRegions(ctx, req)
+	if err != nil {
+		return err
+	}
+	ctx, tracker := withUsageTracker(ctx)
+
+	// For streaming, use the targeted model, the bandit's pick or the first
+	// (fastest) one only. Hybrid/parallel strategies don't work well with streaming
+	strategy := "targeted"
+	client, ok := e.client(req.TargetModel)
+	if !ok && e.config.Strategy == StrategyBandit && e.bandit != nil {
+		client, ok = e.client(e.bandit.Select(ctx))
+		if ok {
+			strategy = StrategyBandit
+			start := time.Now()
+			defer func() {
+				if err == nil {
+					if err := e.bandit.ObserveAnswer(ctx, client.name, time.Since(start)); err != nil {
+						log.Printf("Failed to record SLM bandit observation: %v", err)
+					}
+				}
+			}()
+		}
+	}
+	if !ok {
+		strategy = "single"
+		client = e.clients[0]
+	}
+	prompt := promptMessages(req)
 
 	temperature := float64(req.Temperature)
 	if temperature == 0 {
 		temperature = 0.7
 	}
 
+	streamed := false
 	streamingFunc := func(ctx context.Context, chunk []byte) error {
 		if len(chunk) > 0 {
+			streamed = true
 			return callback(string(chunk))
 		}
 		return nil
 	}
 
-	_, err := llms.GenerateFromSinglePrompt(
-		ctx,
-		e.clients[0].llm,
-		prompt,
-		llms.WithTemperature(temperature),
-		llms.WithMaxTokens(e.config.MaxTokens),
-		llms.WithStreamingFunc(streamingFunc),
-	)
+	// Once output has reached the client, a retry would repeat it
+	notStreamed := func() bool { return !streamed }
+	var response string
+	err = e.retry.do(ctx, client.timeout, notStreamed, func(ctx context.Context) error {
+		return client.withLLM(ctx, func(ctx context.Context, llm llms.Model) error {
+			start := time.Now()
+			var usage tokenUsage
+			var err error
+			response, usage, err = generate(
+				ctx,
+				llm,
+				client.name,
+				prompt,
+				withTools(req, []llms.CallOption{
+					llms.WithTemperature(temperature),
+					llms.WithMaxTokens(e.config.MaxTokens),
+					llms.WithStreamingFunc(streamingFunc),
+				})...,
+			)
+			tracker.record(client.name, messagesText(prompt), response, usage, time.Since(start))
+			return err
+		})
+	})
+	if err != nil {
+		return err
+	}
 
+	models.RecordSLMResult(ctx, &models.SLMResult{
+		Response:       response,
+		Strategy:       strategy,
+		SelectedModel:  client.name,
+		ModelsUsed:     tracker.models(),
+		ModelLatencies: tracker.latencies(),
+		Usage:          tracker.snapshot(),
+	})
+	return nil
+}
+
+// Models returns the names of the configured models
+func (e *SLMEngine) Models() []string {
+	names := make([]string, len(e.clients))
+	for i, client := range e.clients {
+		names[i] = client.name
+	}
+	return names
+}
+
+// PingModel asks a model for a one-token completion with the platform's key,
+// to check that it's reachable
+func (e *SLMEngine) PingModel(ctx context.Context, model string) error {
+	client, ok := e.client(model)
+	if !ok {
+		return fmt.Errorf("unknown model %s", model)
+	}
+	_, _, err := generate(ctx, client.llm, client.name, pingPrompt(), llms.WithMaxTokens(1))
 	return err
 }
 
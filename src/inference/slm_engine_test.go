@@ -0,0 +1,390 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/bandit"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestSLMEngine_TracesEachModelCall(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	engine, err := NewSLMEngine(&config.SLMConfig{
+		Models: []config.SLMModelConfig{
+			{Name: "small", Endpoint: server.URL, APIKey: "test"},
+			{Name: "large", Endpoint: server.URL, APIKey: "test"},
+		},
+		Strategy:      "parallel",
+		MaxConcurrent: 2,
+		AggregationFn: "longest",
+	})
+	require.NoError(t, err)
+
+	_, err = engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+
+	ended := spans.Ended()
+	var infer sdktrace.ReadOnlySpan
+	calls := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range ended {
+		switch span.Name() {
+		case "slm.Infer":
+			infer = span
+		case "model.Generate":
+			for _, attr := range span.Attributes() {
+				if attr.Key == "gen_ai.request.model" {
+					calls[attr.Value.AsString()] = span
+				}
+			}
+		}
+	}
+	require.NotNil(t, infer)
+	require.Len(t, calls, 2)
+	for _, call := range calls {
+		assert.Equal(t, infer.SpanContext().SpanID(), call.Parent().SpanID(), "model calls are children of the strategy's span")
+	}
+}
+
+func TestSLMEngine_RetriesTransientErrors(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error": {"message": "rate limited"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	engine, err := NewSLMEngine(&config.SLMConfig{
+		Models:        []config.SLMModelConfig{{Name: "small", Endpoint: server.URL, APIKey: "test"}},
+		MaxConcurrent: 1,
+		Retry:         config.SLMRetryConfig{MaxAttempts: 2, InitialBackoff: time.Millisecond},
+	})
+	require.NoError(t, err)
+
+	result, err := engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Equal(t, "Hello", result.Response)
+	assert.EqualValues(t, 2, calls.Load())
+}
+
+func TestSLMEngine_OrgKeysOnlyGoToTheProvider(t *testing.T) {
+	var seenKeys []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenKeys = append(seenKeys, r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	newEngine := func() *SLMEngine {
+		engine, err := NewSLMEngine(&config.SLMConfig{
+			Models:        []config.SLMModelConfig{{Name: "small", Endpoint: server.URL, APIKey: "platform"}},
+			MaxConcurrent: 1,
+		})
+		require.NoError(t, err)
+		return engine
+	}
+	orgCtx := credentials.WithKeys(context.Background(), credentials.NewKeys("acme.com", map[string]string{SLMProvider: "org"}, true))
+	req := &models.InferenceRequest{Query: "Hi"}
+
+	// A self-hosted endpoint isn't the provider the org's key is for
+	_, err := newEngine().Infer(orgCtx, req)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Bearer platform"}, seenKeys)
+
+	// The provider's own endpoint gets it, through one client per key
+	previous := slmProviderHosts
+	slmProviderHosts = []string{"127.0.0.1"}
+	t.Cleanup(func() { slmProviderHosts = previous })
+	engine := newEngine()
+	for range 2 {
+		_, err = engine.Infer(orgCtx, req)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, []string{"Bearer platform", "Bearer org", "Bearer org"}, seenKeys)
+	assert.Len(t, engine.clients[0].keyed.models, 1)
+}
+
+func TestSLMProviderFor(t *testing.T) {
+	assert.Equal(t, SLMProvider, slmProviderFor("https://api.groq.com/openai/v1"))
+	assert.Empty(t, slmProviderFor("http://localhost:8000/v1"))
+	assert.Empty(t, slmProviderFor("https://api.groq.com.example.net/v1"))
+}
+
+func TestSLMEngine_SlowModelTimesOut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer slow" {
+			// The request's context is only cancelled once its body was read
+			_, _ = io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	engine, err := NewSLMEngine(&config.SLMConfig{
+		Models: []config.SLMModelConfig{
+			{Name: "fast", Endpoint: server.URL, APIKey: "fast"},
+			{Name: "slow", Endpoint: server.URL, APIKey: "slow", Weight: 2, Timeout: 50 * time.Millisecond},
+		},
+		Strategy:      "parallel",
+		MaxConcurrent: 1,
+		Timeout:       time.Minute,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	result, err := engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, "fast", result.SelectedModel, "the slow model's call was abandoned")
+}
+
+func TestSLMEngine_JudgeSelectsAnswer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		content := map[string]string{
+			"small":  "Lyon",
+			"medium": "Paris",
+			"judge":  `{\"choice\": 2, \"rationale\": \"Paris is the capital.\"}`,
+		}[body.Model]
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "` + content + `"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	engine, err := NewSLMEngine(&config.SLMConfig{
+		Models: []config.SLMModelConfig{
+			{Name: "small", Endpoint: server.URL, APIKey: "test", Weight: 2},
+			{Name: "medium", Endpoint: server.URL, APIKey: "test", Weight: 1},
+			{Name: "judge", Endpoint: server.URL, APIKey: "test"},
+		},
+		Strategy:      "hybrid",
+		MaxConcurrent: 1,
+		AggregationFn: "judge",
+		Judge:         config.SLMJudgeConfig{Model: "judge", ReturnRationale: true},
+	})
+	require.NoError(t, err)
+
+	// Hybrid runs small and medium in parallel; the judge picks between them
+	// (numbered in configured order, so choice 2 is medium) and, as the last
+	// model, also refines the pick
+	result, err := engine.Infer(context.Background(), &models.InferenceRequest{Query: "What is the capital of France?"})
+	require.NoError(t, err)
+	require.NotNil(t, result.Judge)
+	assert.Equal(t, "medium", result.Judge.Selected)
+	assert.Equal(t, "Paris is the capital.", result.Judge.Rationale)
+	assert.Equal(t, "judge", result.Aggregation)
+}
+
+func TestSLMEngine_RaceReturnsFirstSuccess(t *testing.T) {
+	var slowCancelled atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer slow":
+			_, _ = io.Copy(io.Discard, r.Body)
+			<-r.Context().Done()
+			slowCancelled.Store(true)
+			return
+		case "Bearer broken":
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": {"message": "bad request"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	engine, err := NewSLMEngine(&config.SLMConfig{
+		Models: []config.SLMModelConfig{
+			{Name: "slow", Endpoint: server.URL, APIKey: "slow"},
+			{Name: "broken", Endpoint: server.URL, APIKey: "broken"},
+			{Name: "fast", Endpoint: server.URL, APIKey: "fast"},
+		},
+		Strategy:      "race",
+		MaxConcurrent: 1,
+		Timeout:       time.Minute,
+	})
+	require.NoError(t, err)
+
+	start := time.Now()
+	result, err := engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, "fast", result.SelectedModel)
+	assert.Equal(t, "race", result.Strategy)
+	assert.Empty(t, result.Aggregation)
+	assert.Eventually(t, slowCancelled.Load, 5*time.Second, 10*time.Millisecond, "the slow call was cancelled")
+}
+
+func TestSLMEngine_BanditObservesItsPick(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "Bearer broken" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error": {"message": "bad request"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	banditCfg := config.SLMBanditConfig{LatencyTarget: time.Second, Temperature: 0.1, PriorStrength: 20, FeedbackWindow: time.Hour}
+
+	newEngine := func(model config.SLMModelConfig) (*SLMEngine, *bandit.Bandit) {
+		cfg := &config.SLMConfig{Models: []config.SLMModelConfig{model}, Strategy: StrategyBandit, MaxConcurrent: 1, Retry: config.SLMRetryConfig{MaxAttempts: 1}}
+		engine, err := NewSLMEngine(cfg)
+		require.NoError(t, err)
+		b := bandit.New(client, banditCfg, cfg.Models)
+		engine.SetBandit(b)
+		return engine, b
+	}
+
+	engine, b := newEngine(config.SLMModelConfig{Name: "healthy", Endpoint: server.URL, APIKey: "healthy"})
+	result, err := engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Equal(t, StrategyBandit, result.Strategy)
+	assert.Equal(t, "healthy", result.SelectedModel)
+	arms, err := b.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), arms[0].Answers)
+	assert.Zero(t, arms[0].Ratings)
+
+	engine, b = newEngine(config.SLMModelConfig{Name: "broken", Endpoint: server.URL, APIKey: "broken"})
+	_, err = engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi"})
+	require.Error(t, err)
+	arms, err = b.Stats(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), arms[0].Ratings, "a failure counts as a bad rating")
+	assert.Less(t, arms[0].Quality, 0.5)
+}
+
+func TestSLMEngine_ResidencyKeepsCallsInRegion(t *testing.T) {
+	var mu sync.Mutex
+	var called []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Model string `json:"model"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		called = append(called, body.Model)
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices": [{"index": 0, "message": {"role": "assistant", "content": "Hello"}, "finish_reason": "stop"}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	engine, err := NewSLMEngine(&config.SLMConfig{
+		Models: []config.SLMModelConfig{
+			{Name: "us-model", Endpoint: server.URL, APIKey: "key"},
+			{Name: "eu-model", Endpoint: server.URL, APIKey: "key"},
+		},
+		Strategy:      "parallel",
+		AggregationFn: "longest",
+		MaxConcurrent: 2,
+	})
+	require.NoError(t, err)
+	engine.SetResidency(func(ctx context.Context, userID string, model string) bool {
+		switch userID {
+		case "alice":
+			return model == "eu-model"
+		case "mallory":
+			return false
+		}
+		return true
+	})
+
+	_, err = engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi", UserID: "bob"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"us-model", "eu-model"}, called, "users without rules get the whole ensemble")
+
+	// The user can come from the context, as for titles and expiry estimates
+	called = nil
+	result, err := engine.Infer(correlation.WithUserID(context.Background(), "alice"), &models.InferenceRequest{Query: "Hi"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eu-model"}, called)
+	assert.Equal(t, "eu-model", result.SelectedModel)
+
+	_, err = engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi", UserID: "alice", TargetModel: "us-model"})
+	assert.ErrorIs(t, err, errOutsideRegions)
+	_, err = engine.Infer(context.Background(), &models.InferenceRequest{Query: "Hi", UserID: "mallory"})
+	assert.ErrorIs(t, err, errOutsideRegions)
+}
+
+func TestSLMEngine_StreamingRecordsItsResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		_, _ = w.Write([]byte(`data: {"choices": [{"index": 0, "delta": {"role": "assistant", "content": "Hel"}}]}` + "\n\n"))
+		_, _ = w.Write([]byte(`data: {"choices": [{"index": 0, "delta": {"content": "lo"}, "finish_reason": "stop"}]}` + "\n\n"))
+		_, _ = w.Write([]byte("data: [DONE]\n\n"))
+	}))
+	t.Cleanup(server.Close)
+	mr := miniredis.RunT(t)
+	cfg := &config.SLMConfig{
+		Models:        []config.SLMModelConfig{{Name: "healthy", Endpoint: server.URL, APIKey: "healthy"}},
+		Strategy:      StrategyBandit,
+		MaxConcurrent: 1,
+		Retry:         config.SLMRetryConfig{MaxAttempts: 1},
+	}
+	engine, err := NewSLMEngine(cfg)
+	require.NoError(t, err)
+	engine.SetBandit(bandit.New(redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+		config.SLMBanditConfig{LatencyTarget: time.Second, Temperature: 0.1, PriorStrength: 20, FeedbackWindow: time.Hour}, cfg.Models))
+
+	ctx, recorder := models.WithSLMResult(context.Background())
+	var streamed string
+	require.NoError(t, engine.InferStreaming(ctx, &models.InferenceRequest{Query: "Hi"}, func(chunk string) error {
+		streamed += chunk
+		return nil
+	}))
+
+	result := recorder.Result()
+	require.NotNil(t, result)
+	assert.Equal(t, "Hello", streamed)
+	assert.Equal(t, StrategyBandit, result.Strategy)
+	assert.Equal(t, "healthy", result.SelectedModel)
+	assert.Equal(t, []string{"healthy"}, result.ModelsUsed)
+	require.Len(t, result.Usage, 1)
+	assert.Equal(t, 1, result.Usage[0].Calls)
+}
@@ -0,0 +1,61 @@
+package inference
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// errOutsideRegions is returned for requests no configured model may
+// process under the user's data residency rules
+var errOutsideRegions = errors.New("no SLM model in the allowed data residency regions")
+
+// ResidencyCheck reports whether a model may process the user's data
+type ResidencyCheck func(ctx context.Context, userID string, model string) bool
+
+// SetResidency restricts every call to models allowed to process the user's
+// data, side calls like titles and expiry estimates included, which routing
+// never sees
+func (e *SLMEngine) SetResidency(allows ResidencyCheck) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.allows = allows
+}
+
+// keepInRegions pins a request of a user whose data only some models may
+// process to the first of them, so no strategy fans out to, refines with or
+// judges with a model elsewhere. Requests any model may serve are returned
+// as they are. Callers hold e.mu.
+func (e *SLMEngine) keepInRegions(ctx context.Context, req *models.InferenceRequest) (*models.InferenceRequest, error) {
+	if e.allows == nil {
+		return req, nil
+	}
+	userID := cmp.Or(req.UserID, correlation.UserID(ctx))
+	if client, ok := e.client(req.TargetModel); ok {
+		if !e.allows(ctx, userID, client.name) {
+			return nil, fmt.Errorf("%w: %s", errOutsideRegions, client.name)
+		}
+		return req, nil
+	}
+
+	var allowed []modelClient
+	for _, client := range e.clients {
+		if e.allows(ctx, userID, client.name) {
+			allowed = append(allowed, client)
+		}
+	}
+	switch len(allowed) {
+	case len(e.clients):
+		return req, nil
+	case 0:
+		return nil, errOutsideRegions
+	}
+	pinned := *req
+	pinned.TargetModel = allowed[0].name
+	return &pinned, nil
+}
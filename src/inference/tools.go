@@ -0,0 +1,80 @@
+package inference
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tmc/langchaingo/llms"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+type toolCallsKey struct{}
+
+// ToolCallRecorder collects the tool calls models made while serving a
+// request, keyed by the configured model name
+type ToolCallRecorder struct {
+	byModel map[string][]models.ToolCall
+	mu      sync.Mutex
+}
+
+// WithToolCalls returns a context that records the tool calls of model calls
+// made with it
+func WithToolCalls(ctx context.Context) (context.Context, *ToolCallRecorder) {
+	recorder := &ToolCallRecorder{
+		byModel: make(map[string][]models.ToolCall),
+	}
+	return context.WithValue(ctx, toolCallsKey{}, recorder), recorder
+}
+
+// For returns the tool calls of the latest call to the given model
+func (r *ToolCallRecorder) For(model string) []models.ToolCall {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.byModel[model]
+}
+
+func (r *ToolCallRecorder) record(model string, calls []llms.ToolCall) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(calls) == 0 {
+		delete(r.byModel, model)
+		return
+	}
+	recorded := make([]models.ToolCall, 0, len(calls))
+	for _, call := range calls {
+		if call.FunctionCall == nil {
+			continue
+		}
+		recorded = append(recorded, models.ToolCall{
+			ID:   call.ID,
+			Type: "function",
+			Function: models.ToolCallFunction{
+				Name:      call.FunctionCall.Name,
+				Arguments: call.FunctionCall.Arguments,
+			},
+		})
+	}
+	r.byModel[model] = recorded
+}
+
+// withTools adds the request's tools to a model call's options
+func withTools(req *models.InferenceRequest, options []llms.CallOption) []llms.CallOption {
+	if len(req.Tools) == 0 {
+		return options
+	}
+	tools := make([]llms.Tool, len(req.Tools))
+	for i, tool := range req.Tools {
+		tools[i] = llms.Tool{
+			Type: "function",
+			Function: &llms.FunctionDefinition{
+				Name:        tool.Function.Name,
+				Description: tool.Function.Description,
+				Parameters:  tool.Function.Parameters,
+			},
+		}
+	}
+	return append(options, llms.WithTools(tools))
+}
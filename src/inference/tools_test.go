@@ -0,0 +1,58 @@
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tmc/langchaingo/llms/openai"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestGenerate_RecordsToolCalls(t *testing.T) {
+	var sent struct {
+		Tools []struct {
+			Type     string `json:"type"`
+			Function struct {
+				Name string `json:"name"`
+			} `json:"function"`
+		} `json:"tools"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&sent)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{
+			"id": "chatcmpl-123",
+			"choices": [{"index": 0, "finish_reason": "tool_calls", "message": {"role": "assistant", "content": "",
+				"tool_calls": [{"id": "call_1", "type": "function", "function": {"name": "get_weather", "arguments": "{\"city\":\"Paris\"}"}}]}}]
+		}`))
+	}))
+	t.Cleanup(server.Close)
+	llm, err := openai.New(openai.WithBaseURL(server.URL), openai.WithToken("test"), openai.WithModel("gpt-4o"))
+	require.NoError(t, err)
+
+	req := &models.InferenceRequest{
+		Query: "Weather in Paris?",
+		Tools: []models.Tool{{Type: "function", Function: models.ToolFunction{
+			Name:       "get_weather",
+			Parameters: map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+		}}},
+	}
+	ctx, recorder := WithToolCalls(context.Background())
+	_, _, err = generate(ctx, llm, "gpt-4o", singlePrompt(req.Query), withTools(req, nil)...)
+	require.NoError(t, err)
+
+	require.Len(t, sent.Tools, 1)
+	assert.Equal(t, "get_weather", sent.Tools[0].Function.Name)
+	assert.Equal(t, []models.ToolCall{{
+		ID:       "call_1",
+		Type:     "function",
+		Function: models.ToolCallFunction{Name: "get_weather", Arguments: `{"city":"Paris"}`},
+	}}, recorder.For("gpt-4o"))
+	assert.Empty(t, recorder.For("gpt-4o-mini"))
+}
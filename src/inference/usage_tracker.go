@@ -0,0 +1,94 @@
+package inference
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+type usageTrackerKey struct{}
+
+// usageTracker collects per-model token usage across every model call made
+// while serving a single request (parallel, series, and hybrid strategies)
+type usageTracker struct {
+	usage     map[string]*models.ModelUsage
+	durations map[string]time.Duration
+	order     []string
+	mu        sync.Mutex
+}
+
+func withUsageTracker(ctx context.Context) (context.Context, *usageTracker) {
+	tracker := &usageTracker{
+		usage:     make(map[string]*models.ModelUsage),
+		durations: make(map[string]time.Duration),
+	}
+	return context.WithValue(ctx, usageTrackerKey{}, tracker), tracker
+}
+
+func usageTrackerFrom(ctx context.Context) *usageTracker {
+	tracker, _ := ctx.Value(usageTrackerKey{}).(*usageTracker)
+	return tracker
+}
+
+// record adds one model call's token usage and latency. Tokens are counted
+// locally when the provider didn't report them.
+func (t *usageTracker) record(model string, prompt string, response string, usage tokenUsage, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.usage[model]
+	if !ok {
+		entry = &models.ModelUsage{Model: model}
+		t.usage[model] = entry
+		t.order = append(t.order, model)
+	}
+
+	entry.Calls++
+	t.durations[model] += latency
+	if usage.reported() {
+		entry.InputTokens += usage.input
+		entry.OutputTokens += usage.output
+		return
+	}
+
+	entry.Estimated = true
+	entry.InputTokens += utils.CountTokens(prompt, model)
+	if response != "" {
+		entry.OutputTokens += utils.CountTokens(response, model)
+	}
+}
+
+// snapshot returns usage per model in the order the models were first called
+func (t *usageTracker) snapshot() []models.ModelUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]models.ModelUsage, 0, len(t.order))
+	for _, model := range t.order {
+		result = append(result, *t.usage[model])
+	}
+	return result
+}
+
+// models returns the names of the models called, in call order
+func (t *usageTracker) models() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.order...)
+}
+
+// latencies returns the total time spent in each model, in milliseconds
+func (t *usageTracker) latencies() map[string]int64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make(map[string]int64, len(t.durations))
+	for model, latency := range t.durations {
+		result[model] = latency.Milliseconds()
+	}
+	return result
+}
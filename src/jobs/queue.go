@@ -0,0 +1,396 @@
+// Package jobs queues inference requests on a Redis stream so they can run in
+// the background, for clients whose connections would time out waiting for
+// a long answer. Jobs and their results are kept in Redis until they expire,
+// and clients poll for them by ID.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Job states
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+const (
+	defaultStream    = "jobs:queue"
+	defaultTimeout   = 5 * time.Minute
+	defaultResultTTL = 24 * time.Hour
+
+	jobKeyPrefix = "job:"
+	group        = "workers"
+	maxAttempts  = 3                // Runs of a job interrupted by crashes before it is failed
+	claimGrace   = time.Minute      // Added to the timeout before a running job counts as abandoned
+	readBlock    = 5 * time.Second  // Longest wait for a new job before checking for abandoned ones
+	errorBackoff = time.Second      // Pause after Redis errors
+	finishBudget = 10 * time.Second // For saving a result after the job's own deadline
+)
+
+var (
+	// ErrJobNotFound is returned when a job doesn't exist or has expired
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobForbidden is returned when a job belongs to another user
+	ErrJobForbidden = errors.New("job belongs to another user")
+)
+
+// Job is a queued inference request and, once it has run, its outcome
+type Job struct {
+	ID          string                     `json:"id"`
+	UserID      string                     `json:"user_id"`
+	Caller      *middleware.Caller         `json:"caller,omitempty"` // Who queued it, whose scopes, quota and request ID it runs with
+	Status      string                     `json:"status"`
+	Request     models.InferenceRequest    `json:"request"`
+	Chat        *models.ChatRequest        `json:"chat,omitempty"`        // A chat turn to run instead of Request
+	Bulk        *models.BulkSessionRequest `json:"bulk,omitempty"`        // A bulk session operation to run instead of Request
+	Progress    *models.BulkSessionResult  `json:"progress,omitempty"`    // How far a bulk operation has got
+	StatusCode  int                        `json:"status_code,omitempty"` // HTTP status the request would have been answered with
+	Result      json.RawMessage            `json:"result,omitempty"`      // The response, for succeeded jobs
+	Error       string                     `json:"error,omitempty"`       // Why a failed job failed
+	Attempts    int                        `json:"attempts"`
+	CreatedAt   time.Time                  `json:"created_at"`
+	StartedAt   time.Time                  `json:"started_at,omitzero"`
+	CompletedAt time.Time                  `json:"completed_at,omitzero"`
+}
+
+// Done reports whether the job has finished, successfully or not
+func (j *Job) Done() bool {
+	return j.Status == StatusSucceeded || j.Status == StatusFailed
+}
+
+// Runner runs a job's request, returning the HTTP status and body it was
+// answered with
+type Runner func(ctx context.Context, job *Job) (int, []byte)
+
+// Queue stores jobs and shares them out between workers through a consumer
+// group, so jobs are spread across every instance of the server. A job whose
+// worker died is picked up again by another one once it has been running for
+// longer than the timeout allows.
+type Queue struct {
+	client    *redis.Client
+	stream    string
+	consumer  string
+	timeout   time.Duration
+	resultTTL time.Duration
+	clock     clock.Clock
+}
+
+func NewQueue(client *redis.Client, cfg config.JobsConfig) *Queue {
+	q := &Queue{
+		client:    client,
+		stream:    cfg.Stream,
+		consumer:  consumerName(),
+		timeout:   cfg.Timeout,
+		resultTTL: cfg.ResultTTL,
+		clock:     clock.Real(),
+	}
+	if q.stream == "" {
+		q.stream = defaultStream
+	}
+	if q.timeout <= 0 {
+		q.timeout = defaultTimeout
+	}
+	if q.resultTTL <= 0 {
+		q.resultTTL = defaultResultTTL
+	}
+	return q
+}
+
+// SetClock sets the clock that timestamps jobs
+func (q *Queue) SetClock(c clock.Clock) {
+	q.clock = c
+}
+
+// consumerName identifies this instance within the consumer group
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "hybridlm"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+func jobKey(id string) string {
+	return jobKeyPrefix + id
+}
+
+// Enqueue queues req to run for the caller and returns the queued job
+func (q *Queue) Enqueue(ctx context.Context, caller middleware.Caller, req models.InferenceRequest) (*Job, error) {
+	return q.enqueue(ctx, &Job{
+		ID:        "job_" + uuid.New().String(),
+		UserID:    caller.UserID,
+		Caller:    &caller,
+		Status:    StatusQueued,
+		Request:   req,
+		CreatedAt: q.clock.Now(),
+	})
+}
+
+// EnqueueChat queues a chat turn to run for the caller and returns the queued job
+func (q *Queue) EnqueueChat(ctx context.Context, caller middleware.Caller, req models.ChatRequest) (*Job, error) {
+	return q.enqueue(ctx, &Job{
+		ID:        "job_" + uuid.New().String(),
+		UserID:    caller.UserID,
+		Caller:    &caller,
+		Status:    StatusQueued,
+		Chat:      &req,
+		CreatedAt: q.clock.Now(),
+	})
+}
+
+// EnqueueBulk queues a bulk operation on the user's chat sessions and returns
+// the queued job
+func (q *Queue) EnqueueBulk(ctx context.Context, userID string, req models.BulkSessionRequest) (*Job, error) {
+	return q.enqueue(ctx, &Job{
+		ID:        "job_" + uuid.New().String(),
+		UserID:    userID,
+		Status:    StatusQueued,
+		Bulk:      &req,
+		CreatedAt: q.clock.Now(),
+	})
+}
+
+func (q *Queue) enqueue(ctx context.Context, job *Job) (*Job, error) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+
+	pipe := q.client.TxPipeline()
+	pipe.Set(ctx, jobKey(job.ID), data, q.resultTTL)
+	pipe.XAdd(ctx, &redis.XAddArgs{Stream: q.stream, Values: []interface{}{"job_id", job.ID}})
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to queue job: %w", err)
+	}
+	return job, nil
+}
+
+// Get returns a job, checking that it belongs to the user
+func (q *Queue) Get(ctx context.Context, id string, userID string) (*Job, error) {
+	job, err := q.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.UserID != userID {
+		return nil, ErrJobForbidden
+	}
+	return job, nil
+}
+
+func (q *Queue) load(ctx context.Context, id string) (*Job, error) {
+	data, err := q.client.Get(ctx, jobKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	return &job, nil
+}
+
+// SaveProgress saves a running job's progress, for clients polling it
+func (q *Queue) SaveProgress(ctx context.Context, job *Job, progress models.BulkSessionResult) error {
+	job.Progress = &progress
+	return q.save(ctx, job)
+}
+
+func (q *Queue) save(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to encode job: %w", err)
+	}
+	// Polling stays possible for the result TTL after the job finishes
+	if err := q.client.Set(ctx, jobKey(job.ID), data, q.resultTTL).Err(); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+// Depth returns how many jobs are queued or running
+func (q *Queue) Depth(ctx context.Context) (int64, error) {
+	return q.client.XLen(ctx, q.stream).Result()
+}
+
+// Work runs jobs one at a time with run until ctx is done. Start several
+// workers to run jobs concurrently.
+func (q *Queue) Work(ctx context.Context, run Runner) {
+	if err := q.createGroup(ctx); err != nil {
+		log.Printf("⚠️  Job worker stopped: %v", err)
+		return
+	}
+
+	for ctx.Err() == nil {
+		if _, err := q.RunNext(ctx, run, readBlock); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Job worker failed to run a job: %v", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(errorBackoff):
+			}
+		}
+	}
+}
+
+// createGroup creates the workers' consumer group, which starts with the
+// jobs queued before any worker ran
+func (q *Queue) createGroup(ctx context.Context) error {
+	err := q.client.XGroupCreateMkStream(ctx, q.stream, group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+// RunNext runs one job: an abandoned one if there is any, otherwise the next
+// queued job, waiting up to block for one. It reports whether a job was run.
+func (q *Queue) RunNext(ctx context.Context, run Runner, block time.Duration) (bool, error) {
+	messages, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.stream,
+		Group:    group,
+		Consumer: q.consumer,
+		MinIdle:  q.timeout + claimGrace,
+		Start:    "0-0",
+		Count:    1,
+	}).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to claim abandoned jobs: %w", err)
+	}
+
+	if len(messages) == 0 {
+		streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: q.consumer,
+			Streams:  []string{q.stream, ">"},
+			Count:    1,
+			Block:    block,
+		}).Result()
+		if err == redis.Nil {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to read jobs: %w", err)
+		}
+		for _, stream := range streams {
+			messages = append(messages, stream.Messages...)
+		}
+	}
+
+	for _, message := range messages {
+		if err := q.process(ctx, message, run); err != nil {
+			return true, err
+		}
+	}
+	return len(messages) > 0, nil
+}
+
+// process runs the job behind a stream entry and removes the entry once the
+// outcome is saved. Jobs that expired or already finished are just removed.
+func (q *Queue) process(ctx context.Context, message redis.XMessage, run Runner) error {
+	id, _ := message.Values["job_id"].(string)
+	job, err := q.load(ctx, id)
+	if errors.Is(err, ErrJobNotFound) {
+		return q.remove(ctx, message.ID)
+	}
+	if err != nil {
+		return err
+	}
+	if job.Done() {
+		return q.remove(ctx, message.ID)
+	}
+
+	job.Attempts++
+	if job.Attempts > maxAttempts {
+		q.finish(job, http.StatusInternalServerError, nil, "job was interrupted too many times")
+	} else {
+		job.Status = StatusRunning
+		job.StartedAt = q.clock.Now()
+		if err := q.save(ctx, job); err != nil {
+			return err
+		}
+
+		runCtx, cancel := context.WithTimeout(ctx, q.timeout)
+		status, body := run(runCtx, job)
+		timedOut := runCtx.Err() == context.DeadlineExceeded
+		cancel()
+
+		switch {
+		case timedOut && status >= 300:
+			q.finish(job, http.StatusGatewayTimeout, nil, fmt.Sprintf("job did not finish within %s", q.timeout))
+		case ctx.Err() != nil && status >= 300:
+			// Shutting down: leave the job pending for another worker
+			return nil
+		default:
+			q.finish(job, status, body, errorMessage(body))
+		}
+	}
+
+	// The job's own deadline may have passed, and the outcome must still be saved
+	saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), finishBudget)
+	defer cancel()
+	if err := q.save(saveCtx, job); err != nil {
+		return err
+	}
+	return q.remove(saveCtx, message.ID)
+}
+
+// finish records a job's outcome. 2xx answers succeed with the body as the
+// result; anything else fails with message.
+func (q *Queue) finish(job *Job, status int, body []byte, message string) {
+	job.StatusCode = status
+	job.CompletedAt = q.clock.Now()
+	if status >= 200 && status < 300 {
+		job.Status = StatusSucceeded
+		job.Result = body
+		return
+	}
+	job.Status = StatusFailed
+	job.Error = message
+	if job.Error == "" {
+		job.Error = http.StatusText(status)
+	}
+}
+
+// remove acknowledges a stream entry and deletes it, so the stream only holds
+// unfinished jobs
+func (q *Queue) remove(ctx context.Context, messageID string) error {
+	pipe := q.client.TxPipeline()
+	pipe.XAck(ctx, q.stream, group, messageID)
+	pipe.XDel(ctx, q.stream, messageID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to remove job from the queue: %w", err)
+	}
+	return nil
+}
+
+// errorMessage returns the "error" of an error response body
+func errorMessage(body []byte) string {
+	var response struct {
+		Error string `json:"error"`
+	}
+	_ = json.Unmarshal(body, &response)
+	return response.Error
+}
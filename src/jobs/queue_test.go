@@ -0,0 +1,147 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func newTestQueue(t *testing.T) (*Queue, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Now())
+	q := NewQueue(redis.NewClient(&redis.Options{Addr: mr.Addr()}), config.JobsConfig{Timeout: time.Minute})
+	require.NoError(t, q.createGroup(context.Background()))
+	return q, mr
+}
+
+func answer(status int, body string) Runner {
+	return func(ctx context.Context, job *Job) (int, []byte) {
+		return status, []byte(body)
+	}
+}
+
+func TestQueue_RunsJobs(t *testing.T) {
+	q, _ := newTestQueue(t)
+	ctx := context.Background()
+
+	job, err := q.Enqueue(ctx, middleware.Caller{UserID: "alice"}, models.InferenceRequest{Query: "hello"})
+	require.NoError(t, err)
+	assert.Equal(t, StatusQueued, job.Status)
+
+	var ran *Job
+	run := func(ctx context.Context, job *Job) (int, []byte) {
+		ran = job
+		got, err := q.Get(ctx, job.ID, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, StatusRunning, got.Status)
+		return http.StatusOK, []byte(`{"response":"hi"}`)
+	}
+	found, err := q.RunNext(ctx, run, time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "hello", ran.Request.Query)
+
+	got, err := q.Get(ctx, job.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+	assert.JSONEq(t, `{"response":"hi"}`, string(got.Result))
+	assert.Equal(t, 1, got.Attempts)
+	assert.False(t, got.CompletedAt.IsZero())
+
+	depth, err := q.Depth(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, depth, "finished jobs leave the queue")
+
+	found, err = q.RunNext(ctx, run, time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestQueue_RecordsFailures(t *testing.T) {
+	q, _ := newTestQueue(t)
+	ctx := context.Background()
+
+	job, err := q.Enqueue(ctx, middleware.Caller{UserID: "alice"}, models.InferenceRequest{Query: "hello"})
+	require.NoError(t, err)
+	_, err = q.RunNext(ctx, answer(http.StatusServiceUnavailable, `{"error":"LLM tier disabled"}`), time.Millisecond)
+	require.NoError(t, err)
+
+	got, err := q.Get(ctx, job.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.Equal(t, http.StatusServiceUnavailable, got.StatusCode)
+	assert.Equal(t, "LLM tier disabled", got.Error)
+	assert.Empty(t, got.Result)
+}
+
+func TestQueue_GetChecksOwner(t *testing.T) {
+	q, _ := newTestQueue(t)
+	ctx := context.Background()
+
+	job, err := q.Enqueue(ctx, middleware.Caller{UserID: "alice"}, models.InferenceRequest{Query: "hello"})
+	require.NoError(t, err)
+
+	_, err = q.Get(ctx, job.ID, "bob")
+	assert.ErrorIs(t, err, ErrJobForbidden)
+	_, err = q.Get(ctx, "job_missing", "alice")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestQueue_ReclaimsAbandonedJobs(t *testing.T) {
+	q, mr := newTestQueue(t)
+	ctx := context.Background()
+
+	job, err := q.Enqueue(ctx, middleware.Caller{UserID: "alice"}, models.InferenceRequest{Query: "hello"})
+	require.NoError(t, err)
+
+	// A worker reads the job and dies before finishing it
+	_, err = q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group: group, Consumer: "dead", Streams: []string{q.stream, ">"}, Count: 1,
+	}).Result()
+	require.NoError(t, err)
+
+	found, err := q.RunNext(ctx, answer(http.StatusOK, `{}`), time.Millisecond)
+	require.NoError(t, err)
+	assert.False(t, found, "the job may still be running")
+
+	mr.SetTime(time.Now().Add(q.timeout + claimGrace + time.Second))
+	found, err = q.RunNext(ctx, answer(http.StatusOK, `{}`), time.Millisecond)
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	got, err := q.Get(ctx, job.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, StatusSucceeded, got.Status)
+}
+
+func TestQueue_FailsJobsThatTimeOut(t *testing.T) {
+	mr := miniredis.RunT(t)
+	q := NewQueue(redis.NewClient(&redis.Options{Addr: mr.Addr()}), config.JobsConfig{Timeout: 10 * time.Millisecond})
+	ctx := context.Background()
+	require.NoError(t, q.createGroup(ctx))
+
+	job, err := q.Enqueue(ctx, middleware.Caller{UserID: "alice"}, models.InferenceRequest{Query: "hello"})
+	require.NoError(t, err)
+	_, err = q.RunNext(ctx, func(ctx context.Context, job *Job) (int, []byte) {
+		<-ctx.Done()
+		return http.StatusInternalServerError, []byte(`{"error":"context deadline exceeded"}`)
+	}, time.Millisecond)
+	require.NoError(t, err)
+
+	got, err := q.Get(ctx, job.ID, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, StatusFailed, got.Status)
+	assert.Equal(t, http.StatusGatewayTimeout, got.StatusCode)
+	assert.Contains(t, got.Error, "did not finish")
+}
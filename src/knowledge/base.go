@@ -0,0 +1,209 @@
+// Package knowledge serves operator-maintained canonical answers. Questions
+// matching an entry, exactly or by meaning, get its answer instead of a model's.
+package knowledge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+const defaultReloadInterval = 10 * time.Second
+
+// Entry is a canonical answer and the questions it answers
+type Entry struct {
+	ID        string   `mapstructure:"id" json:"id"`
+	Questions []string `mapstructure:"questions" json:"questions"`
+	Answer    string   `mapstructure:"answer" json:"answer"`
+	ExactOnly bool     `mapstructure:"exact_only" json:"exact_only,omitempty"` // Only match the questions as written, never by similarity
+}
+
+// Match is the entry answering a query and how it was matched
+type Match struct {
+	Entry      Entry
+	Exact      bool
+	Similarity float64 // 1 for exact matches
+}
+
+type embeddedQuestion struct {
+	entry     int
+	embedding []float32
+}
+
+// Base holds the entries of a YAML file. The file is re-read when it changes,
+// and a file that fails to load leaves the previous entries in place.
+type Base struct {
+	path      string
+	embedder  models.Embedder // nil disables semantic matching
+	threshold float64
+
+	mu        sync.RWMutex
+	entries   []Entry
+	exact     map[string]int // Normalized question -> entry index
+	questions []embeddedQuestion
+	modTime   time.Time
+}
+
+// NewBase loads the entries in path. Questions are also matched by meaning
+// when embedder is set and threshold is above 0.
+func NewBase(ctx context.Context, path string, embedder models.Embedder, threshold float64) (*Base, error) {
+	b := &Base{
+		path:      path,
+		embedder:  embedder,
+		threshold: threshold,
+	}
+	if threshold <= 0 {
+		b.embedder = nil
+	}
+	if err := b.Reload(ctx); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Entries returns the loaded entries in file order
+func (b *Base) Entries() []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.entries
+}
+
+// Len returns the number of loaded entries
+func (b *Base) Len() int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.entries)
+}
+
+// Reload re-reads the file and embeds the questions of entries that can be
+// matched by similarity
+func (b *Base) Reload(ctx context.Context) error {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return fmt.Errorf("failed to read knowledge base: %w", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(b.path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read knowledge base: %w", err)
+	}
+
+	var entries []Entry
+	if err := v.UnmarshalKey("entries", &entries); err != nil {
+		return fmt.Errorf("failed to parse knowledge base: %w", err)
+	}
+
+	exact := make(map[string]int)
+	var questions []embeddedQuestion
+	for i, entry := range entries {
+		if entry.ID == "" || entry.Answer == "" || len(entry.Questions) == 0 {
+			return fmt.Errorf("knowledge base entry %d: id, questions and answer are required", i+1)
+		}
+		for _, question := range entry.Questions {
+			normalized := router.NormalizeQuery(question)
+			if other, ok := exact[normalized]; ok && other != i {
+				return fmt.Errorf("knowledge base entry %q: question %q is already answered by %q", entry.ID, question, entries[other].ID)
+			}
+			exact[normalized] = i
+
+			if b.embedder == nil || entry.ExactOnly {
+				continue
+			}
+			embedding, err := b.embedder.Embed(ctx, question)
+			if err != nil {
+				return fmt.Errorf("knowledge base entry %q: failed to embed question: %w", entry.ID, err)
+			}
+			questions = append(questions, embeddedQuestion{entry: i, embedding: embedding})
+		}
+	}
+
+	b.mu.Lock()
+	b.entries = entries
+	b.exact = exact
+	b.questions = questions
+	b.modTime = info.ModTime()
+	b.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the file whenever it changes until ctx is done
+func (b *Base) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !b.changed() {
+				continue
+			}
+			if err := b.Reload(ctx); err != nil {
+				log.Printf("⚠️  Keeping previous knowledge base: %v", err)
+				continue
+			}
+			log.Printf("✓ Reloaded %d knowledge base entries", b.Len())
+		}
+	}
+}
+
+func (b *Base) changed() bool {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return !info.ModTime().Equal(b.modTime)
+}
+
+// Lookup returns the entry answering the query, or nil if there is none. An
+// exact match on a normalized question wins; otherwise the most similar
+// question at or above the threshold does.
+func (b *Base) Lookup(ctx context.Context, query string) (*Match, error) {
+	b.mu.RLock()
+	entries, exact, questions := b.entries, b.exact, b.questions
+	b.mu.RUnlock()
+
+	if i, ok := exact[router.NormalizeQuery(query)]; ok {
+		return &Match{Entry: entries[i], Exact: true, Similarity: 1}, nil
+	}
+	// Skip the embedding call when nothing can match by similarity
+	if len(questions) == 0 || query == "" {
+		return nil, nil
+	}
+
+	embedding, err := b.embedder.Embed(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed query: %w", err)
+	}
+
+	var best *Match
+	for _, question := range questions {
+		similarity := cache.CosineSimilarity(embedding, question.embedding)
+		if similarity >= b.threshold && (best == nil || similarity > best.Similarity) {
+			best = &Match{Entry: entries[question.entry], Similarity: similarity}
+		}
+	}
+	return best, nil
+}
@@ -0,0 +1,107 @@
+package knowledge
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+)
+
+const testEntries = `
+entries:
+  - id: refund-policy
+    questions:
+      - What is your refund policy?
+      - Can I get my money back?
+    answer: Purchases can be refunded within 30 days.
+  - id: data-retention
+    questions:
+      - How long do you keep my data?
+    answer: Conversations are deleted after 24 hours of inactivity.
+    exact_only: true
+`
+
+func writeEntries(t *testing.T, path string, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func setupBase(t *testing.T) (*Base, string) {
+	path := filepath.Join(t.TempDir(), "knowledge_base.yaml")
+	writeEntries(t, path, testEntries)
+
+	base, err := NewBase(context.Background(), path, fakes.NewEmbedder(), 0.6)
+	require.NoError(t, err)
+	return base, path
+}
+
+func TestBase_ExactMatch(t *testing.T) {
+	base, _ := setupBase(t)
+
+	match, err := base.Lookup(context.Background(), "  can I get my MONEY back")
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, "refund-policy", match.Entry.ID)
+	assert.True(t, match.Exact)
+	assert.Equal(t, 1.0, match.Similarity)
+}
+
+func TestBase_SemanticMatch(t *testing.T) {
+	base, _ := setupBase(t)
+	ctx := context.Background()
+
+	match, err := base.Lookup(ctx, "what is the refund policy")
+	require.NoError(t, err)
+	require.NotNil(t, match)
+	assert.Equal(t, "refund-policy", match.Entry.ID)
+	assert.False(t, match.Exact)
+	assert.GreaterOrEqual(t, match.Similarity, 0.6)
+
+	match, err = base.Lookup(ctx, "how long do you keep my data around")
+	require.NoError(t, err)
+	assert.Nil(t, match, "exact_only entries aren't matched by similarity")
+
+	match, err = base.Lookup(ctx, "tell me a joke")
+	require.NoError(t, err)
+	assert.Nil(t, match)
+}
+
+func TestBase_ExactOnlyWithoutEmbedder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "knowledge_base.yaml")
+	writeEntries(t, path, testEntries)
+
+	base, err := NewBase(context.Background(), path, nil, 0.6)
+	require.NoError(t, err)
+
+	match, err := base.Lookup(context.Background(), "what is the refund policy")
+	require.NoError(t, err)
+	assert.Nil(t, match)
+}
+
+func TestBase_InvalidReloadKeepsEntries(t *testing.T) {
+	base, path := setupBase(t)
+	ctx := context.Background()
+
+	writeEntries(t, path, `
+entries:
+  - id: one
+    questions: ["What is Go?"]
+    answer: A language.
+  - id: two
+    questions: ["what is go"]
+    answer: Also a language.
+`)
+	assert.ErrorContains(t, base.Reload(ctx), "already answered")
+
+	writeEntries(t, path, "entries:\n  - id: no-answer\n    questions: [Hello]\n")
+	assert.ErrorContains(t, base.Reload(ctx), "required")
+
+	assert.Equal(t, 2, base.Len())
+	match, err := base.Lookup(ctx, "What is your refund policy?")
+	require.NoError(t, err)
+	assert.NotNil(t, match)
+}
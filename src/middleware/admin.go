@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminMiddleware requires the admin token as a bearer token
+func AdminMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Admin token required"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole only lets users with the role through. It has to run after
+// authentication with role checks.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetRole(c) != role {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "The " + role + " role is required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,146 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/auth"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	// SessionCookieName is the cookie holding the login session token
+	SessionCookieName = "hybridlm_session"
+
+	// APIKeyHeader carries an API key for machine-to-machine callers
+	APIKeyHeader = "X-API-Key"
+
+	// AnonymousUserID owns all sessions when authentication is disabled
+	AnonymousUserID = "anonymous"
+
+	userIDKey = "user_id"
+	apiKeyKey = "api_key"
+	roleKey   = "role"
+)
+
+// RoleFunc returns a user's role, or auth.ErrUserDeactivated for users who
+// may no longer use the API
+type RoleFunc func(ctx context.Context, userID string) (string, error)
+
+// AuthMiddleware requires a valid API key (X-API-Key header, or as a bearer
+// token like OpenAI clients send it), JWT access token (Authorization: Bearer)
+// or login session cookie and stores the user ID in the context, along with
+// the user's role when roles is set. apiKeys, tokens and roles may be nil to
+// disable those methods and role checks.
+func AuthMiddleware(sessions *auth.SessionManager, apiKeys *auth.APIKeyStore, tokens *auth.TokenIssuer, roles RoleFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authenticated := func(userID string) {
+			if roles != nil {
+				role, err := roles(c.Request.Context(), userID)
+				if errors.Is(err, auth.ErrUserDeactivated) {
+					c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Account deactivated"})
+					return
+				}
+				if err != nil {
+					log.Printf("Failed to get role of user %s: %v", userID, err)
+					c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication unavailable"})
+					return
+				}
+				c.Set(roleKey, role)
+			}
+			SetUserID(c, userID)
+			c.Next()
+		}
+
+		secret := c.GetHeader(APIKeyHeader)
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && secret == "" && auth.IsAPIKey(bearer) {
+			secret = bearer
+		}
+		if secret != "" && apiKeys != nil {
+			key, err := apiKeys.Authenticate(c.Request.Context(), secret)
+			if errors.Is(err, auth.ErrInvalidAPIKey) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to authenticate API key: %v", err)
+				c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Authentication unavailable"})
+				return
+			}
+
+			c.Set(apiKeyKey, key)
+			authenticated(key.UserID)
+			return
+		}
+
+		if bearer, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer "); ok && tokens != nil {
+			userID, err := tokens.ValidateAccessToken(bearer)
+			if err != nil {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+				return
+			}
+
+			authenticated(userID)
+			return
+		}
+
+		token, err := c.Cookie(SessionCookieName)
+		if err != nil || token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		userID, err := sessions.GetUserID(c.Request.Context(), token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired session"})
+			return
+		}
+
+		authenticated(userID)
+	}
+}
+
+// AnonymousMiddleware is used when authentication is disabled: every request
+// runs as the shared anonymous user
+func AnonymousMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		SetUserID(c, AnonymousUserID)
+		c.Next()
+	}
+}
+
+// SetUserID stores the authenticated user ID in the context
+func SetUserID(c *gin.Context, userID string) {
+	c.Set(userIDKey, userID)
+	if c.Request != nil {
+		c.Request = c.Request.WithContext(correlation.WithUserID(c.Request.Context(), userID))
+	}
+}
+
+// GetUserID returns the authenticated user ID, or the anonymous user if none was set
+func GetUserID(c *gin.Context) string {
+	if userID := c.GetString(userIDKey); userID != "" {
+		return userID
+	}
+	return AnonymousUserID
+}
+
+// GetRole returns the authenticated user's role, or "" when roles aren't
+// checked
+func GetRole(c *gin.Context) string {
+	return c.GetString(roleKey)
+}
+
+// GetAPIKey returns the API key the request authenticated with, or nil for
+// session and anonymous requests
+func GetAPIKey(c *gin.Context) *models.APIKey {
+	key, _ := c.Get(apiKeyKey)
+	apiKey, _ := key.(*models.APIKey)
+	return apiKey
+}
@@ -0,0 +1,150 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/auth"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+func TestAuthMiddleware_APIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	apiKeys := auth.NewAPIKeyStore(client)
+	limiter := NewRateLimiter(client, &config.RateLimitConfig{RequestsPerMinute: 60})
+
+	key, secret, err := apiKeys.Create(context.Background(), "alice", "ci", 1)
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(auth.NewSessionManager(client, time.Hour), apiKeys, nil, nil), limiter.Middleware())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserID(c))
+	})
+
+	do := func(secret string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if secret != "" {
+			req.Header.Set(APIKeyHeader, secret)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(secret)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	// The key's own limit of 1 request per minute applies
+	assert.Equal(t, http.StatusTooManyRequests, do(secret).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, do("hlm_wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("").Code, "no key and no session cookie")
+
+	require.NoError(t, apiKeys.Revoke(context.Background(), "alice", key.ID))
+	assert.Equal(t, http.StatusUnauthorized, do(secret).Code)
+}
+
+func TestAuthMiddleware_BearerTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	sessions := auth.NewSessionManager(client, time.Hour)
+	tokens := auth.NewTokenIssuer(client, &config.AuthConfig{
+		JWTSecret:       "secret",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	})
+
+	pair, err := tokens.Issue(context.Background(), "alice")
+	require.NoError(t, err)
+	session, err := sessions.CreateSession(context.Background(), "bob")
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(sessions, nil, tokens, nil))
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, GetUserID(c))
+	})
+
+	do := func(authorization string, cookie string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: cookie})
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("Bearer "+pair.AccessToken, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "alice", w.Body.String())
+
+	w = do("", session)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "bob", w.Body.String(), "session cookies still work")
+
+	assert.Equal(t, http.StatusUnauthorized, do("Bearer not-a-jwt", session).Code, "an invalid token is not ignored")
+}
+
+func TestAuthMiddleware_Roles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	ctx := context.Background()
+	sessions := auth.NewSessionManager(client, time.Hour)
+	users := auth.NewUserStore(client)
+	users.SetAdminEmails([]string{"Alice@Example.com"})
+
+	alice, err := users.UpsertGoogleUser(ctx, &auth.GoogleUserInfo{ID: "1", Email: "alice@example.com"})
+	require.NoError(t, err)
+	bob, err := users.UpsertGoogleUser(ctx, &auth.GoogleUserInfo{ID: "2", Email: "bob@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "admin", alice.Role)
+	assert.Equal(t, "user", bob.Role)
+
+	r := gin.New()
+	r.Use(AuthMiddleware(sessions, nil, nil, users.RoleOf))
+	r.GET("/", func(c *gin.Context) { c.String(http.StatusOK, GetRole(c)) })
+	r.GET("/admin", RequireRole("admin"), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(path string, userID string) *httptest.ResponseRecorder {
+		session, err := sessions.CreateSession(ctx, userID)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.AddCookie(&http.Cookie{Name: SessionCookieName, Value: session})
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do("/admin", alice.ID).Code)
+	assert.Equal(t, http.StatusForbidden, do("/admin", bob.ID).Code)
+	assert.Equal(t, "user", do("/", bob.ID).Body.String())
+
+	// Deactivated users are locked out of existing sessions and can't sign in again
+	_, err = users.SetDeactivated(ctx, bob.ID, true)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, do("/", bob.ID).Code)
+	_, err = users.UpsertGoogleUser(ctx, &auth.GoogleUserInfo{ID: "2", Email: "bob@example.com"})
+	assert.ErrorIs(t, err, auth.ErrUserDeactivated)
+}
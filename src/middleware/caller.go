@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Caller is who a request is made for, as the auth and request_id middleware
+// found it. Handlers that answer through a private router (assistant runs,
+// jobs, revalidations) hand it on, so the inner request has the same scopes,
+// limits and request ID as the one that started it.
+type Caller struct {
+	UserID            string         `json:"user_id"`
+	Role              string         `json:"role,omitempty"`
+	APIKey            *models.APIKey `json:"api_key,omitempty"`
+	RequestID         string         `json:"request_id,omitempty"`
+	ProviderRequestID string         `json:"provider_request_id,omitempty"`
+}
+
+// GetCaller returns the current request's caller
+func GetCaller(c *gin.Context) Caller {
+	return Caller{
+		UserID:            GetUserID(c),
+		Role:              GetRole(c),
+		APIKey:            GetAPIKey(c),
+		RequestID:         GetRequestID(c),
+		ProviderRequestID: c.GetString(providerRequestIDKey),
+	}
+}
+
+// InternalCall is a request made through a private router: the caller it
+// acts for, and the tokens it reported once it has been served
+type InternalCall struct {
+	Caller Caller
+	Tokens int
+}
+
+type internalCallKey struct{}
+
+// WithInternalCall returns ctx for a request made through a private router
+// on behalf of call.Caller
+func WithInternalCall(ctx context.Context, call *InternalCall) context.Context {
+	return context.WithValue(ctx, internalCallKey{}, call)
+}
+
+// InternalCaller goes on private routers in place of the auth middleware: it
+// restores the caller of the request's InternalCall, and hands the tokens the
+// handler reported back to it. Requests without one are rejected, so the
+// router can't be reached from outside.
+func InternalCaller() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		call, _ := c.Request.Context().Value(internalCallKey{}).(*InternalCall)
+		if call == nil || call.Caller.UserID == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			return
+		}
+
+		caller := call.Caller
+		if caller.Role != "" {
+			c.Set(roleKey, caller.Role)
+		}
+		if caller.APIKey != nil {
+			c.Set(apiKeyKey, caller.APIKey)
+		}
+		if caller.RequestID != "" {
+			c.Set(requestIDKey, caller.RequestID)
+			c.Request = c.Request.WithContext(correlation.WithRequestID(c.Request.Context(), caller.RequestID))
+		}
+		if caller.ProviderRequestID != "" {
+			c.Set(providerRequestIDKey, caller.ProviderRequestID)
+		}
+		SetUserID(c, caller.UserID)
+
+		c.Next()
+
+		call.Tokens += c.GetInt(tokenUsageKey)
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestInternalCaller_RestoresCaller(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	caller := Caller{
+		UserID:    "alice",
+		Role:      models.RoleAdmin,
+		APIKey:    &models.APIKey{ID: "key-1", UserID: "alice", Scopes: []string{models.ScopeCacheBypass}},
+		RequestID: "req-1",
+	}
+
+	var inner Caller
+	var requestID string
+	r := gin.New()
+	r.Use(InternalCaller())
+	r.POST("/", func(c *gin.Context) {
+		inner = GetCaller(c)
+		requestID = correlation.RequestID(c.Request.Context())
+		AddTokenUsage(c, 120)
+		c.Status(http.StatusOK)
+	})
+
+	call := &InternalCall{Caller: caller}
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req.WithContext(WithInternalCall(req.Context(), call)))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, caller, inner)
+	assert.True(t, inner.APIKey.HasScope(models.ScopeCacheBypass))
+	assert.Equal(t, "req-1", requestID)
+	assert.Equal(t, 120, call.Tokens)
+}
+
+func TestInternalCaller_RejectsOutsideRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(InternalCaller())
+	r.POST("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChain_BuildsInConfiguredOrder(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var order []string
+	record := func(name string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			order = append(order, name)
+			c.Next()
+		}
+	}
+
+	chain := NewChain()
+	chain.Register("cors", record("cors"))
+	chain.Register("auth", record("auth"))
+	chain.Register("rate_limit", nil) // Turned off
+
+	handlers, err := chain.Build([]string{"auth", "rate_limit", "cors"})
+	require.NoError(t, err)
+
+	r := gin.New()
+	r.Use(handlers...)
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, []string{"auth", "cors"}, order)
+}
+
+func TestChain_RejectsUnknownMiddleware(t *testing.T) {
+	chain := NewChain()
+	chain.Register("auth", func(c *gin.Context) {})
+
+	_, err := chain.Build([]string{"auht"})
+	assert.ErrorContains(t, err, `unknown middleware "auht"`)
+}
@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+const (
+	routingDecisionKey = "routing_decision"
+	resultKey          = "result"
+	requestMetadataKey = "request_metadata"
+)
+
+// RequestEvent is the data of the request events: what was asked and how it
+// was answered, as far as the request got
+type RequestEvent struct {
+	RequestID         string  `json:"request_id,omitempty"`
+	ProviderRequestID string  `json:"provider_request_id,omitempty"` // Sent to providers as X-Client-Request-Id
+	Method            string  `json:"method"`
+	Path              string  `json:"path"`
+	Status            int     `json:"status"`
+	LatencyMs         float64 `json:"latency_ms"`
+
+	Tier          string  `json:"tier,omitempty"`
+	Model         string  `json:"model,omitempty"`
+	RoutingReason string  `json:"routing_reason,omitempty"`
+	CacheHit      bool    `json:"cache_hit,omitempty"`
+	InputTokens   int     `json:"input_tokens,omitempty"`
+	OutputTokens  int     `json:"output_tokens,omitempty"`
+	TotalTokens   int     `json:"total_tokens,omitempty"`
+	Cost          float64 `json:"cost,omitempty"`
+	Fallback      bool    `json:"fallback,omitempty"`
+	Experiment    string  `json:"experiment,omitempty"` // From metadata.experiment
+	TraceTag      string  `json:"trace_tag,omitempty"`  // From metadata.trace_tag
+
+	Decision *models.RoutingDecision `json:"decision,omitempty"`
+}
+
+// SetRoutingDecision reports the routing decision made for the current request
+func SetRoutingDecision(c *gin.Context, decision *models.RoutingDecision) {
+	c.Set(routingDecisionKey, decision)
+}
+
+// SetRequestMetadata reports the current request's metadata, whose experiment
+// and trace tag are added to its events and trace span
+func SetRequestMetadata(c *gin.Context, metadata map[string]string) {
+	c.Set(requestMetadataKey, metadata)
+
+	var attrs []attribute.KeyValue
+	if experiment := metadata[models.MetadataExperiment]; experiment != "" {
+		attrs = append(attrs, attribute.String("hybridlm.experiment", experiment))
+	}
+	if tag := metadata[models.MetadataTraceTag]; tag != "" {
+		attrs = append(attrs, attribute.String("hybridlm.trace_tag", tag))
+	}
+	if len(attrs) > 0 {
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attrs...)
+	}
+}
+
+// SetResult reports the response the current request was answered with
+func SetResult(c *gin.Context, result any) {
+	c.Set(resultKey, result)
+}
+
+// RequestEvents publishes request events to the outbox once each request is
+// done: "routed" with the routing decision, "cache_hit" when a cache served
+// it, "completed" for every model request however it ended, and
+// "quota_exceeded" when the rate limiter turned it away. It has to run
+// before the rate limiter to see its rejections.
+func RequestEvents(o *outbox.Outbox) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		event, answered := requestEvent(c, start)
+		var actions []string
+		if event.Decision != nil {
+			actions = append(actions, "routed")
+		}
+		if event.CacheHit {
+			actions = append(actions, "cache_hit")
+		}
+		if answered || event.Decision != nil {
+			actions = append(actions, "completed")
+		}
+		if event.Status == http.StatusTooManyRequests {
+			actions = append(actions, "quota_exceeded")
+		}
+
+		// Publish even if the client has already disconnected
+		ctx := context.WithoutCancel(c.Request.Context())
+		userID := GetUserID(c)
+		for _, action := range actions {
+			if err := o.Publish(ctx, outbox.TypeRequest, action, userID, event); err != nil {
+				log.Printf("Failed to publish request event %s: %v", action, err)
+			}
+		}
+	}
+}
+
+// requestEvent describes a finished request. answered is false if it got no
+// response from a model or cache.
+func requestEvent(c *gin.Context, start time.Time) (event RequestEvent, answered bool) {
+	event = RequestEvent{
+		RequestID:         GetRequestID(c),
+		ProviderRequestID: c.GetString(providerRequestIDKey),
+		Method:            c.Request.Method,
+		Path:              c.FullPath(),
+		Status:            c.Writer.Status(),
+		LatencyMs:         float64(time.Since(start).Microseconds()) / 1000,
+	}
+	decision, _ := c.Get(routingDecisionKey)
+	event.Decision, _ = decision.(*models.RoutingDecision)
+	if metadata, ok := c.Get(requestMetadataKey); ok {
+		metadata := metadata.(map[string]string)
+		event.Experiment, event.TraceTag = metadata[models.MetadataExperiment], metadata[models.MetadataTraceTag]
+	}
+	result, answered := c.Get(resultKey)
+	switch result := result.(type) {
+	case *models.InferenceResponse:
+		event.Tier, event.Model, event.RoutingReason, event.CacheHit = result.Tier, result.ModelUsed, result.RoutingReason, result.CacheHit
+		addCost(&event, result.CostMetrics)
+	case *models.ChatResponse:
+		event.Tier, event.Model, event.RoutingReason, event.CacheHit = result.Tier, result.ModelUsed, result.RoutingReason, result.CacheHit
+		event.Fallback = result.Fallback != nil
+		addCost(&event, result.CostMetrics)
+	}
+	return event, answered
+}
+
+func addCost(event *RequestEvent, metrics *models.CostMetrics) {
+	if metrics == nil {
+		return
+	}
+	event.InputTokens = metrics.InputTokens
+	event.OutputTokens = metrics.OutputTokens
+	event.TotalTokens = metrics.TotalTokens
+	event.Cost = metrics.TotalCost
+}
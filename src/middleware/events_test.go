@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+func TestRequestEvents(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	o := outbox.NewOutbox(client, config.OutboxConfig{Stream: "events"})
+
+	r := gin.New()
+	r.Use(RequestEvents(o))
+	r.POST("/routed", func(c *gin.Context) {
+		SetRequestMetadata(c, map[string]string{models.MetadataExperiment: "short-prompts", models.MetadataTraceTag: "nightly", "team": "search"})
+		SetRoutingDecision(c, &models.RoutingDecision{UseLLM: true, Reason: "complex"})
+		result := &models.InferenceResponse{Tier: "llm", ModelUsed: "gpt-4o", CostMetrics: &models.CostMetrics{TotalTokens: 42, TotalCost: 0.01}}
+		SetResult(c, result)
+		c.JSON(http.StatusOK, result)
+	})
+	r.POST("/cached", func(c *gin.Context) {
+		result := &models.InferenceResponse{Tier: "cache", CacheHit: true}
+		SetResult(c, result)
+		c.JSON(http.StatusOK, result)
+	})
+	r.POST("/limited", func(c *gin.Context) {
+		c.AbortWithStatus(http.StatusTooManyRequests)
+	})
+	r.GET("/other", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	actions := func(path string, method string) ([]string, []map[string]any) {
+		require.NoError(t, client.Del(context.Background(), "events").Err())
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, path, nil))
+
+		messages, err := client.XRange(context.Background(), "events", "-", "+").Result()
+		require.NoError(t, err)
+		var names []string
+		var data []map[string]any
+		for _, message := range messages {
+			var event outbox.Event
+			require.NoError(t, json.Unmarshal([]byte(message.Values["event"].(string)), &event))
+			assert.Equal(t, outbox.TypeRequest, event.Type)
+			var fields map[string]any
+			require.NoError(t, json.Unmarshal(event.Data, &fields))
+			names = append(names, event.Action)
+			data = append(data, fields)
+		}
+		return names, data
+	}
+
+	names, data := actions("/routed", http.MethodPost)
+	assert.Equal(t, []string{"routed", "completed"}, names)
+	assert.Equal(t, "gpt-4o", data[1]["model"])
+	assert.Equal(t, float64(42), data[1]["total_tokens"])
+	assert.Equal(t, "short-prompts", data[1]["experiment"])
+	assert.Equal(t, "nightly", data[1]["trace_tag"])
+	assert.Equal(t, "complex", data[0]["decision"].(map[string]any)["reason"])
+
+	names, _ = actions("/cached", http.MethodPost)
+	assert.Equal(t, []string{"cache_hit", "completed"}, names)
+
+	names, data = actions("/limited", http.MethodPost)
+	assert.Equal(t, []string{"quota_exceeded"}, names)
+	assert.Equal(t, float64(http.StatusTooManyRequests), data[0]["status"])
+
+	names, _ = actions("/other", http.MethodGet)
+	assert.Empty(t, names)
+}
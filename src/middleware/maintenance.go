@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/flags"
+)
+
+// maintenanceRetryAfter is the Retry-After hint, in seconds, sent during maintenance
+const maintenanceRetryAfter = "60"
+
+// MaintenanceMode rejects mutating requests with 503 while the maintenance_mode
+// flag is on. Reads (GET, HEAD, OPTIONS) keep working.
+func MaintenanceMode(store *flags.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if isReadOnlyMethod(c.Request.Method) || !store.Enabled(c.Request.Context(), flags.MaintenanceMode) {
+			c.Next()
+			return
+		}
+
+		c.Header("Retry-After", maintenanceRetryAfter)
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Service is in read-only maintenance mode"})
+	}
+}
+
+func isReadOnlyMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
@@ -0,0 +1,44 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/flags"
+)
+
+func TestMaintenanceMode_RejectsMutatingRequests(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	store := flags.NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}), time.Second)
+
+	r := gin.New()
+	r.Use(MaintenanceMode(store))
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func(method string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, "/", nil))
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPost).Code)
+
+	require.NoError(t, store.Set(context.Background(), flags.MaintenanceMode, true))
+
+	w := do(http.MethodPost)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet).Code)
+}
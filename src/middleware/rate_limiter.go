@@ -0,0 +1,245 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const (
+	requestBucketKeyPrefix = "ratelimit:requests:"
+	tokenQuotaKeyPrefix    = "ratelimit:tokens:"
+
+	tokenUsageKey = "token_usage"
+)
+
+// tokenBucketScript refills the bucket for the elapsed time, then takes one
+// request from it. Returns {allowed, remaining, retry_after_ms}.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2]) -- tokens per millisecond
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated_at")
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil then
+  tokens = capacity
+  updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+
+local allowed = 0
+local retry_after = 0
+if tokens >= 1 then
+  allowed = 1
+  tokens = tokens - 1
+else
+  retry_after = math.ceil((1 - tokens) / rate)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated_at", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(capacity / rate) + 1000)
+
+return {allowed, math.floor(tokens), retry_after}
+`)
+
+// RateLimiter enforces per-user request rates (token bucket) and daily token
+// quotas in Redis. It must run after the auth middleware so limits key off
+// the authenticated user ID.
+type RateLimiter struct {
+	client            *redis.Client
+	requestsPerMinute int
+	burst             int
+	tokensPerDay      int
+	maxKeyRate        int // Highest per-minute rate an API key gets, whatever it asked for; none when 0
+	clock             clock.Clock
+}
+
+func NewRateLimiter(client *redis.Client, cfg *config.RateLimitConfig) *RateLimiter {
+	burst := cfg.Burst
+	if burst <= 0 {
+		burst = cfg.RequestsPerMinute
+	}
+	maxKeyRate := cfg.MaxKeyRequestsPerMinute
+	if maxKeyRate <= 0 {
+		maxKeyRate = cfg.RequestsPerMinute
+	}
+
+	return &RateLimiter{
+		client:            client,
+		requestsPerMinute: cfg.RequestsPerMinute,
+		burst:             burst,
+		tokensPerDay:      cfg.TokensPerDay,
+		maxKeyRate:        maxKeyRate,
+		clock:             clock.Real(),
+	}
+}
+
+// SetClock sets the clock that refills request buckets and rolls daily quotas
+func (l *RateLimiter) SetClock(c clock.Clock) {
+	l.clock = c
+}
+
+// MaxKeyRate returns the highest per-minute rate an API key gets, or 0 when
+// keys may have any rate
+func (l *RateLimiter) MaxKeyRate() int {
+	return l.maxKeyRate
+}
+
+// Middleware rejects requests over the user's limits with 429 and a
+// Retry-After header, and charges the tokens handlers report via AddTokenUsage
+func (l *RateLimiter) Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		userID := GetUserID(c)
+		now := l.clock.Now().UTC()
+
+		// API keys get their own bucket, at the key's rate if it has one, up
+		// to the maximum
+		bucket, perMinute, burst := userID, l.requestsPerMinute, l.burst
+		if key := GetAPIKey(c); key != nil {
+			bucket = "key:" + key.ID
+			if key.RequestsPerMinute > 0 {
+				perMinute = key.RequestsPerMinute
+				if l.maxKeyRate > 0 {
+					perMinute = min(perMinute, l.maxKeyRate)
+				}
+				burst = perMinute
+			}
+		}
+
+		if perMinute > 0 {
+			allowed, remaining, retryAfter, err := l.takeRequest(ctx, bucket, perMinute, burst, now)
+			if err != nil {
+				// Fail open: a Redis hiccup shouldn't take the API down
+				log.Printf("Rate limiter unavailable: %v", err)
+			} else {
+				c.Header("X-RateLimit-Limit", strconv.Itoa(perMinute))
+				c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+				if !allowed {
+					rejectRateLimited(c, retryAfter, "Request rate limit exceeded")
+					return
+				}
+			}
+		}
+
+		l.quota(c, userID, now)
+	}
+}
+
+// Quota enforces and charges only the daily token quota. It goes on private
+// routers answering for a user in the background, such as refreshes of stale
+// answers, which shouldn't take from the user's request rate. A nil limiter
+// lets every request through.
+func (l *RateLimiter) Quota(c *gin.Context) {
+	if l == nil {
+		c.Next()
+		return
+	}
+	l.quota(c, GetUserID(c), l.clock.Now().UTC())
+}
+
+// QuotaLeft returns how many of the user's daily tokens are left once those
+// the request has reported so far are charged, for handlers making many model
+// calls per request. It's false when there's no daily quota, including on a
+// nil limiter, or it can't be read.
+func (l *RateLimiter) QuotaLeft(c *gin.Context) (int, bool) {
+	if l == nil || l.tokensPerDay <= 0 {
+		return 0, false
+	}
+	used, err := l.client.Get(c.Request.Context(), l.tokenQuotaKey(GetUserID(c), l.clock.Now().UTC())).Int()
+	if err != nil && err != redis.Nil {
+		log.Printf("Rate limiter unavailable: %v", err)
+		return 0, false
+	}
+	return max(l.tokensPerDay-used-c.GetInt(tokenUsageKey), 0), true
+}
+
+// quota rejects the request if the user's daily tokens are used up, else
+// serves it and charges the tokens it reported
+func (l *RateLimiter) quota(c *gin.Context, userID string, now time.Time) {
+	ctx := c.Request.Context()
+	if l.tokensPerDay > 0 {
+		used, err := l.client.Get(ctx, l.tokenQuotaKey(userID, now)).Int()
+		if err != nil && err != redis.Nil {
+			log.Printf("Rate limiter unavailable: %v", err)
+		} else if used >= l.tokensPerDay {
+			rejectRateLimited(c, untilNextDay(now), "Daily token quota exceeded")
+			return
+		}
+	}
+
+	c.Next()
+
+	// Charged even if the client has gone, as streams' clients often have
+	if tokens := c.GetInt(tokenUsageKey); l.tokensPerDay > 0 && tokens > 0 {
+		if err := l.chargeTokens(context.WithoutCancel(ctx), userID, now, tokens); err != nil {
+			log.Printf("Failed to record token usage: %v", err)
+		}
+	}
+}
+
+// takeRequest takes one request from a bucket refilling at perMinute
+func (l *RateLimiter) takeRequest(ctx context.Context, bucket string, perMinute int, burst int, now time.Time) (bool, int, time.Duration, error) {
+	rate := float64(perMinute) / float64(time.Minute.Milliseconds())
+
+	result, err := tokenBucketScript.Run(ctx, l.client,
+		[]string{requestBucketKeyPrefix + bucket},
+		burst, rate, now.UnixMilli(),
+	).Int64Slice()
+	if err != nil {
+		return false, 0, 0, fmt.Errorf("token bucket script failed: %w", err)
+	}
+
+	return result[0] == 1, int(result[1]), time.Duration(result[2]) * time.Millisecond, nil
+}
+
+func (l *RateLimiter) chargeTokens(ctx context.Context, userID string, now time.Time, tokens int) error {
+	key := l.tokenQuotaKey(userID, now)
+
+	pipe := l.client.TxPipeline()
+	pipe.IncrBy(ctx, key, int64(tokens))
+	pipe.Expire(ctx, key, 48*time.Hour)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (l *RateLimiter) tokenQuotaKey(userID string, now time.Time) string {
+	return tokenQuotaKeyPrefix + userID + ":" + now.Format("2006-01-02")
+}
+
+// AddTokenUsage reports tokens consumed by the current request so the rate
+// limiter can charge them against the user's daily quota
+func AddTokenUsage(c *gin.Context, tokens int) {
+	c.Set(tokenUsageKey, c.GetInt(tokenUsageKey)+tokens)
+}
+
+func rejectRateLimited(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       message,
+		"retry_after": seconds,
+	})
+}
+
+// untilNextDay returns the time left until the daily quota resets at midnight UTC
+func untilNextDay(now time.Time) time.Duration {
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(now)
+}
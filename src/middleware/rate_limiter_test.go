@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupRateLimiter(t *testing.T, cfg *config.RateLimitConfig) (*RateLimiter, *gin.Engine, *clock.Fake) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	fakeClock := clock.NewFake(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC))
+	limiter := NewRateLimiter(client, cfg)
+	limiter.SetClock(fakeClock)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		SetUserID(c, c.GetHeader("X-User"))
+		c.Next()
+	})
+	r.Use(limiter.Middleware())
+	r.GET("/", func(c *gin.Context) {
+		AddTokenUsage(c, 600)
+		c.Status(http.StatusOK)
+	})
+
+	return limiter, r, fakeClock
+}
+
+func doRequest(r *gin.Engine, user string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-User", user)
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimiter_RequestBucket(t *testing.T) {
+	_, r, fakeClock := setupRateLimiter(t, &config.RateLimitConfig{RequestsPerMinute: 60, Burst: 2})
+
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+
+	w := doRequest(r, "alice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+
+	// Limits are per user
+	assert.Equal(t, http.StatusOK, doRequest(r, "bob").Code)
+
+	// One request per second refills
+	fakeClock.Advance(time.Second)
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+}
+
+func TestRateLimiter_DailyTokenQuota(t *testing.T) {
+	_, r, fakeClock := setupRateLimiter(t, &config.RateLimitConfig{TokensPerDay: 1000})
+
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+
+	w := doRequest(r, "alice")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "43200", w.Header().Get("Retry-After"))
+
+	// The quota resets the next day
+	fakeClock.Advance(12 * time.Hour)
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+}
+
+func TestRateLimiter_ChargesDisconnectedClients(t *testing.T) {
+	limiter, _, _ := setupRateLimiter(t, &config.RateLimitConfig{TokensPerDay: 1000})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		SetUserID(c, c.GetHeader("X-User"))
+		ctx, cancel := context.WithCancel(c.Request.Context())
+		c.Request = c.Request.WithContext(ctx)
+		c.Set("cancel", cancel)
+		c.Next()
+	})
+	r.Use(limiter.Middleware())
+	r.GET("/", func(c *gin.Context) {
+		AddTokenUsage(c, 600)
+		// The client goes away once the answer is generated
+		c.MustGet("cancel").(context.CancelFunc)()
+		c.Status(http.StatusOK)
+	})
+
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(r, "alice").Code)
+}
+
+func TestRateLimiter_QuotaOnly(t *testing.T) {
+	limiter, _, _ := setupRateLimiter(t, &config.RateLimitConfig{RequestsPerMinute: 1, TokensPerDay: 1000})
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		SetUserID(c, c.GetHeader("X-User"))
+		c.Next()
+	})
+	r.Use(limiter.Quota)
+	r.GET("/", func(c *gin.Context) {
+		AddTokenUsage(c, 600)
+		c.Status(http.StatusOK)
+	})
+
+	// The request rate doesn't apply, the daily tokens do
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(r, "alice").Code)
+
+	var none *RateLimiter
+	r = gin.New()
+	r.Use(none.Quota)
+	r.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+}
+
+func TestRateLimiter_KeyRateIsCapped(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	mr := miniredis.RunT(t)
+	limiter := NewRateLimiter(redis.NewClient(&redis.Options{Addr: mr.Addr()}), &config.RateLimitConfig{RequestsPerMinute: 60, MaxKeyRequestsPerMinute: 2})
+	limiter.SetClock(clock.NewFake(time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		SetUserID(c, "alice")
+		c.Set(apiKeyKey, &models.APIKey{ID: "key_1", RequestsPerMinute: 1000})
+		c.Next()
+	})
+	r.Use(limiter.Middleware())
+	r.GET("/", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	w := doRequest(r, "alice")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"), "the key asked for 1000")
+	assert.Equal(t, http.StatusOK, doRequest(r, "alice").Code)
+	assert.Equal(t, http.StatusTooManyRequests, doRequest(r, "alice").Code)
+}
@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+)
+
+// RequestIDHeader carries the ID of a request, from the caller or generated,
+// and is echoed in the response
+const RequestIDHeader = "X-Request-ID"
+
+const (
+	requestIDKey         = "request_id"
+	providerRequestIDKey = "provider_request_id"
+
+	maxRequestIDLength = 128
+)
+
+// RequestID gives every request an ID: the caller's X-Request-ID when it's a
+// sensible one, or a new UUID. The ID is returned in the response, added to
+// the trace span and carried to the model calls made for the request. With a
+// hasher, the hash provider calls are tagged with is kept for request events.
+func RequestID(hasher *correlation.Hasher) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !ValidRequestID(requestID) {
+			requestID = uuid.New().String()
+		}
+
+		c.Set(requestIDKey, requestID)
+		if hasher != nil {
+			c.Set(providerRequestIDKey, hasher.Hash(requestID))
+		}
+		c.Header(RequestIDHeader, requestID)
+		c.Request = c.Request.WithContext(correlation.WithRequestID(c.Request.Context(), requestID))
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("hybridlm.request_id", requestID))
+		c.Next()
+	}
+}
+
+// GetRequestID returns the ID of the current request, or "" without the
+// request_id middleware
+func GetRequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
+
+// ValidRequestID accepts IDs of printable ASCII without spaces, so they can't
+// break log lines or headers
+func ValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if requestID[i] <= ' ' || requestID[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// LogFormatter formats access log lines like gin's default logger, followed
+// by the request's ID
+func LogFormatter(param gin.LogFormatterParams) string {
+	requestID, _ := param.Keys[requestIDKey].(string)
+	if requestID == "" {
+		requestID = "-"
+	}
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v | %s\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency.Truncate(time.Microsecond),
+		param.ClientIP,
+		param.Method,
+		param.Path,
+		requestID,
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	hasher := correlation.NewHasher("secret")
+	r := gin.New()
+	r.Use(RequestID(hasher))
+	r.GET("/", func(c *gin.Context) {
+		SetUserID(c, "alice")
+		assert.Equal(t, GetRequestID(c), correlation.RequestID(c.Request.Context()))
+		assert.Equal(t, "alice", correlation.UserID(c.Request.Context()))
+		assert.Equal(t, hasher.Hash(GetRequestID(c)), c.GetString(providerRequestIDKey))
+		c.Status(http.StatusOK)
+	})
+
+	serve := func(requestID string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if requestID != "" {
+			req.Header.Set(RequestIDHeader, requestID)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header().Get(RequestIDHeader)
+	}
+
+	assert.Equal(t, "req-123", serve("req-123"), "the caller's ID is kept")
+	assert.Len(t, serve(""), 36)
+	assert.NotEqual(t, "bad id", serve("bad id"))
+}
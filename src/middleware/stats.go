@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestRecorder keeps statistics of finished requests
+type RequestRecorder interface {
+	RecordRequest(ctx context.Context, userID string, event RequestEvent) error
+}
+
+// RequestStats records every request once it's done. Like RequestEvents, it
+// has to run before the rate limiter to count its rejections.
+func RequestStats(recorder RequestRecorder) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		event, _ := requestEvent(c, start)
+		// Record even if the client has already disconnected
+		ctx := context.WithoutCancel(c.Request.Context())
+		if err := recorder.RecordRequest(ctx, GetUserID(c), event); err != nil {
+			log.Printf("Failed to record request stats: %v", err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/terms"
+)
+
+// RequireTerms rejects requests with 403 until the user has accepted version
+// of the terms, through POST /api/v1/me/terms. It must run after auth.
+func RequireTerms(store *terms.Store, version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := GetUserID(c)
+		accepted, err := store.Accepted(c.Request.Context(), userID, version)
+		if err != nil {
+			log.Printf("Failed to check terms acceptance of %s: %v", userID, err)
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "Failed to check terms acceptance"})
+			return
+		}
+		if !accepted {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+				"error":         "The current terms must be accepted first",
+				"terms_version": version,
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/terms"
+)
+
+func TestRequireTerms_GatesUntilCurrentVersionAccepted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	mr := miniredis.RunT(t)
+	store := terms.NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+
+	r := gin.New()
+	r.Use(AnonymousMiddleware(), RequireTerms(store, "2026-10"))
+	r.POST("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	do := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+		return w
+	}
+
+	w := do()
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"terms_version":"2026-10"`)
+
+	// Accepting an older version isn't enough
+	_, err := store.Accept(context.Background(), AnonymousUserID, models.TermsAcceptance{Version: "2026-01"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, do().Code)
+
+	_, err = store.Accept(context.Background(), AnonymousUserID, models.TermsAcceptance{Version: "2026-10"})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, do().Code)
+
+	mr.Close()
+	assert.Equal(t, http.StatusOK, do().Code, "acceptances are remembered")
+}
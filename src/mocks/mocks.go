@@ -17,14 +17,30 @@ func (m *MockLLMClient) Infer(ctx context.Context, req *models.InferenceRequest)
 	return args.String(0), args.Error(1)
 }
 
+func (m *MockLLMClient) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+	args := m.Called(ctx, messages, opts)
+	return args.String(0), args.Error(1)
+}
+
 // MockSLMEngine implements models.SLMInferencer
 type MockSLMEngine struct {
 	mock.Mock
 }
 
-func (m *MockSLMEngine) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+func (m *MockSLMEngine) Infer(ctx context.Context, req *models.InferenceRequest) (*models.SLMResult, error) {
 	args := m.Called(ctx, req)
-	return args.String(0), args.Error(1)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SLMResult), args.Error(1)
+}
+
+func (m *MockSLMEngine) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (*models.SLMResult, error) {
+	args := m.Called(ctx, messages, opts)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.SLMResult), args.Error(1)
 }
 
 func (m *MockSLMEngine) Close() error {
@@ -2,19 +2,73 @@ package models
 
 import (
 	"context"
+	"sync"
 )
 
 // LLMInferencer defines the interface for LLM clients
 type LLMInferencer interface {
 	Infer(ctx context.Context, req *InferenceRequest) (string, error)
+	// InferChat answers a conversation, sending each message with its role
+	InferChat(ctx context.Context, messages []ChatMessage, opts ChatOptions) (string, error)
 }
 
 // SLMInferencer defines the interface for SLM engines
 type SLMInferencer interface {
-	Infer(ctx context.Context, req *InferenceRequest) (string, error)
+	Infer(ctx context.Context, req *InferenceRequest) (*SLMResult, error)
+	// InferChat answers a conversation, sending each message with its role
+	InferChat(ctx context.Context, messages []ChatMessage, opts ChatOptions) (*SLMResult, error)
 	Close() error
 }
 
+// Embedder turns text into an embedding vector for semantic similarity
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float32, error)
+}
+
+// StreamingInferencer is implemented by clients that can stream tokens as they are generated.
+// SLM engines report the result of a streamed answer with RecordSLMResult.
+type StreamingInferencer interface {
+	InferStreaming(ctx context.Context, req *InferenceRequest, callback func(string) error) error
+}
+
+type slmResultKey struct{}
+
+// SLMResultRecorder keeps the result of a streamed SLM answer, which
+// InferStreaming has no way to return: the model that answered and the
+// tokens it used
+type SLMResultRecorder struct {
+	result *SLMResult
+	mu     sync.Mutex
+}
+
+// WithSLMResult returns a context that records the result of an SLM answer
+// streamed with it
+func WithSLMResult(ctx context.Context) (context.Context, *SLMResultRecorder) {
+	recorder := &SLMResultRecorder{}
+	return context.WithValue(ctx, slmResultKey{}, recorder), recorder
+}
+
+// Result returns the recorded result, or nil if none was
+func (r *SLMResultRecorder) Result() *SLMResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.result
+}
+
+// RecordSLMResult reports a streamed answer's result to ctx's recorder, if it
+// has one
+func RecordSLMResult(ctx context.Context, result *SLMResult) {
+	recorder, _ := ctx.Value(slmResultKey{}).(*SLMResultRecorder)
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.result = result
+}
+
 // CacheStore defines the interface for cache operations
 type CacheStore interface {
 	Get(ctx context.Context, key string) (*InferenceResponse, error)
@@ -38,3 +92,35 @@ type SemanticCacheStore interface {
 	// SetWithEmbedding stores a response with its query embedding
 	SetWithEmbedding(ctx context.Context, key string, query string, response *InferenceResponse) error
 }
+
+// CacheStats describes what a cache holds and how often it is hit. Hits and
+// misses are counted by this instance since it started.
+type CacheStats struct {
+	Entries     int64   `json:"entries"`
+	MemoryBytes int64   `json:"memory_bytes"`
+	Hits        int64   `json:"hits"`
+	Misses      int64   `json:"misses"`
+	HitRatio    float64 `json:"hit_ratio"`
+	// Memory is this instance's in-memory tier in front of the cache, if any
+	Memory *CacheStats `json:"memory,omitempty"`
+}
+
+// ThresholdStats reports the semantic cache's similarity threshold as tuned
+// from feedback, and the ratings counted toward its next adjustment
+type ThresholdStats struct {
+	Configured float64 `json:"configured"`
+	Effective  float64 `json:"effective"`
+	Min        float64 `json:"min"`
+	Max        float64 `json:"max"`
+	Good       int64   `json:"good"`
+	Bad        int64   `json:"bad"`
+}
+
+// ManagedCacheStore extends CacheStore with administration
+type ManagedCacheStore interface {
+	CacheStore
+	// Purge deletes every entry and returns how many keys were removed
+	Purge(ctx context.Context) (int64, error)
+	// Stats reports the number of entries, their memory use and the hit ratio
+	Stats(ctx context.Context) (*CacheStats, error)
+}
@@ -1,41 +1,438 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
 
 type InferenceRequest struct {
-	Query       string            `json:"query" binding:"required"`
-	Context     string            `json:"context,omitempty"`
-	MaxTokens   int               `json:"max_tokens,omitempty"`
-	Temperature float32           `json:"temperature,omitempty"`
-	Metadata    map[string]string `json:"metadata,omitempty"`
+	Query       string        `json:"query" binding:"required"`
+	Context     string        `json:"context,omitempty"`
+	Messages    []ChatMessage `json:"messages,omitempty"` // Earlier turns, sent to the model with their roles before Query
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float32       `json:"temperature,omitempty"`
+	// Metadata tags the request for routing policies; the Metadata* keys
+	// below also mean something to the router and request logging
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// ResponseFormat requests structured output: "json_object" enables JSON mode
+	ResponseFormat string `json:"response_format,omitempty"`
+	// Capabilities lists extra model capabilities the request needs, e.g. "vision"
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Tools are functions the model may call instead of answering; the calls
+	// it makes are returned in tool_calls. Routed to a model supporting tools.
+	Tools []Tool `json:"tools,omitempty" binding:"omitempty,max=128,dive"`
+	// Stream enables Server-Sent Events streaming of the response
+	Stream bool `json:"stream,omitempty"`
+	// Complete asks for answers cut off by the token limit to be continued
+	Complete bool `json:"complete,omitempty"`
+	// ModelPreference overrides routing: "llm", "slm" or "auto" (the default)
+	ModelPreference string `json:"model_preference,omitempty" binding:"omitempty,oneof=llm slm auto"`
+	// Model asks for a specific model; with "auto" its tier is inferred
+	Model string `json:"model,omitempty"`
+	// TargetModel is the model the router picked; empty lets the tier use its default
+	TargetModel string `json:"-"`
+	// UserID is the authenticated user, set by the handler for routing policies
+	UserID string `json:"-"`
+}
+
+// Tool is a function the model may call, in the OpenAI format
+type Tool struct {
+	Type     string       `json:"type" binding:"required,eq=function"`
+	Function ToolFunction `json:"function"`
+}
+
+// ToolFunction describes a function and its parameters as a JSON schema
+type ToolFunction struct {
+	Name        string         `json:"name" binding:"required,max=64"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+}
+
+// ToolCall is a call the model made to one of the request's tools
+type ToolCall struct {
+	ID       string           `json:"id"`
+	Type     string           `json:"type"` // "function"
+	Function ToolCallFunction `json:"function"`
+}
+
+// ToolCallFunction is the function called and its arguments as a JSON string
+type ToolCallFunction struct {
+	Name      string `json:"name"`
+	Arguments string `json:"arguments"`
+}
+
+// Request metadata keys with a meaning of their own
+const (
+	MetadataForceTier  = "force_tier" // "llm" or "slm": routes like model_preference, which wins if both are set
+	MetadataExperiment = "experiment" // Experiment the request belongs to; request stats are broken down by it
+	MetadataTraceTag   = "trace_tag"  // Free-form tag added to the request's events and trace span
+)
+
+// maxMetadataLabel bounds experiment names and trace tags, which end up in
+// stats keys and trace attributes
+const maxMetadataLabel = 64
+
+// ValidateMetadata checks the values of the recognized metadata keys
+func (r *InferenceRequest) ValidateMetadata() error {
+	if tier, ok := r.Metadata[MetadataForceTier]; ok && tier != "llm" && tier != "slm" {
+		return fmt.Errorf("metadata.%s must be \"llm\" or \"slm\"", MetadataForceTier)
+	}
+	for _, key := range []string{MetadataExperiment, MetadataTraceTag} {
+		if !validLabel(r.Metadata[key]) {
+			return fmt.Errorf("metadata.%s must be at most %d letters, digits, '.', '_' or '-'", key, maxMetadataLabel)
+		}
+	}
+	return nil
+}
+
+// TierPreference is the tier the client asked for: model_preference, or
+// metadata.force_tier when model_preference is unset or "auto"
+func (r *InferenceRequest) TierPreference() string {
+	if r.ModelPreference != "" && r.ModelPreference != "auto" {
+		return r.ModelPreference
+	}
+	if tier := r.Metadata[MetadataForceTier]; tier != "" {
+		return tier
+	}
+	return r.ModelPreference
+}
+
+func validLabel(label string) bool {
+	if len(label) > maxMetadataLabel {
+		return false
+	}
+	for _, ch := range label {
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9', ch == '.', ch == '_', ch == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequiredCapabilities returns the model capabilities needed to serve this request
+func (r *InferenceRequest) RequiredCapabilities() []string {
+	required := make([]string, 0, len(r.Capabilities)+1)
+	seen := make(map[string]bool)
+	for _, capability := range r.Capabilities {
+		if !seen[capability] {
+			seen[capability] = true
+			required = append(required, capability)
+		}
+	}
+	if r.ResponseFormat == "json_object" && !seen["json_mode"] {
+		required = append(required, "json_mode")
+	}
+	if len(r.Tools) > 0 && !seen["tools"] {
+		required = append(required, "tools")
+	}
+	return required
+}
+
+// PromptText is everything sent to the model as plain text, for token estimates
+func (r *InferenceRequest) PromptText() string {
+	parts := make([]string, 0, len(r.Messages)+2)
+	if r.Context != "" {
+		parts = append(parts, r.Context)
+	}
+	for _, message := range r.Messages {
+		parts = append(parts, message.Content)
+	}
+	parts = append(parts, r.Query)
+	return strings.Join(parts, "\n")
+}
+
+// ChatOptions are the generation settings of an InferChat call
+type ChatOptions struct {
+	Model          string // Empty uses the tier's default model
+	MaxTokens      int
+	Temperature    float32
+	ResponseFormat string
+}
+
+// NewChatInferenceRequest turns a conversation into a request: a trailing
+// user message becomes the query and the messages before it the history
+func NewChatInferenceRequest(messages []ChatMessage, opts ChatOptions) *InferenceRequest {
+	req := &InferenceRequest{
+		MaxTokens:      opts.MaxTokens,
+		Temperature:    opts.Temperature,
+		ResponseFormat: opts.ResponseFormat,
+		TargetModel:    opts.Model,
+	}
+	if n := len(messages); n > 0 && messages[n-1].Role == "user" {
+		req.Query = messages[n-1].Content
+		messages = messages[:n-1]
+	}
+	req.Messages = messages
+	return req
 }
 
 type InferenceResponse struct {
-	Response      string        `json:"response"`
-	ModelUsed     string        `json:"model_used"`
-	RoutingReason string        `json:"routing_reason"`
-	Latency       time.Duration `json:"latency"`
-	CacheHit      bool          `json:"cache_hit"`
-	Timestamp     time.Time     `json:"timestamp"`
-	CostMetrics   *CostMetrics  `json:"cost_metrics,omitempty"`
+	Response      string            `json:"response"`
+	ToolCalls     []ToolCall        `json:"tool_calls,omitempty"` // Calls the model made to the request's tools
+	ModelUsed     string            `json:"model_used"`           // Model whose answer was returned
+	Tier          string            `json:"tier"`                 // "cloud-llm" or "edge-slm"
+	RoutingReason string            `json:"routing_reason"`
+	Latency       time.Duration     `json:"latency"`
+	CacheHit      bool              `json:"cache_hit"`
+	Timestamp     time.Time         `json:"timestamp"`
+	CostMetrics   *CostMetrics      `json:"cost_metrics,omitempty"`
+	Metadata      *ResponseMetadata `json:"metadata,omitempty"`
+	Fallback      *FallbackInfo     `json:"fallback,omitempty"`       // Set when the routed tier failed and the other tier answered
+	Expiry        *ExpiryHint       `json:"expiry,omitempty"`         // How long the answer is expected to stay valid
+	PromptVersion string            `json:"prompt_version,omitempty"` // Prompts the answer was generated with; cached answers from other versions are misses
+	Receipt       *Receipt          `json:"receipt,omitempty"`        // Signed record of what was answered, when receipts are enabled
+	Stale         bool              `json:"stale,omitempty"`          // A cached answer past its freshness, served while a new one is generated
+	Retention     time.Duration     `json:"-"`                        // How long caches keep the answer past its TTL, for consistency profiles that use it longer
+}
+
+// Receipt is a signed record of what a request was answered with, for
+// settling billing disputes and auditing what was generated. Hashes are the
+// hex SHA-256 of the query and response text.
+type Receipt struct {
+	ID           string    `json:"id"`
+	UserID       string    `json:"user_id"`
+	RequestHash  string    `json:"request_hash"`
+	ResponseHash string    `json:"response_hash"`
+	Model        string    `json:"model"`
+	CostUSD      float64   `json:"cost_usd"`
+	IssuedAt     time.Time `json:"issued_at"`
+	Signature    string    `json:"signature"` // HMAC-SHA256 of the fields above
+}
+
+// VerifyReceiptRequest is the body of POST /receipts/verify. Query and
+// response are optional; when given they are checked against the hashes.
+type VerifyReceiptRequest struct {
+	Receipt  Receipt `json:"receipt"`
+	Query    *string `json:"query,omitempty"`
+	Response *string `json:"response,omitempty"`
+}
+
+// ReceiptVerification is the outcome of checking a receipt
+type ReceiptVerification struct {
+	Valid           bool  `json:"valid"`                      // The signature matches: the platform issued the receipt as is
+	QueryMatches    *bool `json:"query_matches,omitempty"`    // Set when a query was given
+	ResponseMatches *bool `json:"response_matches,omitempty"` // Set when a response was given
+}
+
+// Expiry classes of answers
+const (
+	ExpiryEvergreen = "evergreen" // Doesn't change, e.g. definitions and explanations
+	ExpiryStandard  = "standard"
+	ExpiryVolatile  = "volatile" // Depends on the current time, e.g. news, prices and weather
+)
+
+// ExpiryHint estimates how long an answer stays valid. Caches keep the answer
+// for TTL instead of their default.
+type ExpiryHint struct {
+	Class  string        `json:"class"`  // ExpiryEvergreen, ExpiryStandard or ExpiryVolatile
+	TTL    time.Duration `json:"ttl"`    // 0 keeps the cache's default
+	Source string        `json:"source"` // "heuristic" or "slm"
+}
+
+// CacheTTL is how long caches keep the response: the TTL of its expiry hint,
+// or defaultTTL without one, and its retention. 0 keeps it until evicted.
+func (r *InferenceResponse) CacheTTL(defaultTTL time.Duration) time.Duration {
+	ttl := r.FreshTTL(defaultTTL)
+	if ttl <= 0 {
+		return ttl
+	}
+	return ttl + r.Retention
+}
+
+// FreshTTL is how long the response stays fresh: the TTL of its expiry hint,
+// or defaultTTL without one
+func (r *InferenceResponse) FreshTTL(defaultTTL time.Duration) time.Duration {
+	if r.Expiry != nil && r.Expiry.TTL > 0 {
+		return r.Expiry.TTL
+	}
+	return defaultTTL
+}
+
+// FallbackInfo records a failover from the routed tier to the other one
+type FallbackInfo struct {
+	From   string `json:"from"`   // Tier the router picked, "cloud-llm" or "edge-slm"
+	To     string `json:"to"`     // Tier that served the response
+	Reason string `json:"reason"` // Why the routed tier failed
+}
+
+// ResponseMetadata carries optional details about how a response was produced
+type ResponseMetadata struct {
+	PromptTrim   *PromptTrimInfo     `json:"prompt_trim,omitempty"`  // Set when the prompt was trimmed to fit the context window
+	SLM          *SLMResult          `json:"slm,omitempty"`          // Set when the edge SLM engine served the request
+	Provider     *ProviderMetadata   `json:"provider,omitempty"`     // Set when the provider reported it
+	Continuation *ContinuationInfo   `json:"continuation,omitempty"` // Set when a truncated answer was continued
+	Judge        *JudgeVerdict       `json:"judge,omitempty"`        // Set when a judge model picked the answer
+	Moderation   *ModerationDecision `json:"moderation,omitempty"`   // Set when content moderation screened the query
+	SemanticHit  *SemanticHit        `json:"semantic_hit,omitempty"` // Set when a similar query's cached answer was reused
+	Degradation  *DegradationStatus  `json:"degradation,omitempty"`  // Set when service was degraded
+
+	// Set when the SLM bandit picked the model, for rating its answer
+	ModelFeedback *ModelFeedback `json:"model_feedback,omitempty"`
+}
+
+// ModelFeedback identifies an answer from the model the SLM bandit picked.
+// Rating it through POST /slm/feedback with its ID steers traffic.
+type ModelFeedback struct {
+	ID    string `json:"id"`
+	Model string `json:"model"`
+}
+
+// ModelFeedbackRequest rates an answer from the model the SLM bandit picked
+type ModelFeedbackRequest struct {
+	AnswerID string `json:"answer_id" binding:"required"`
+	Rating   string `json:"rating" binding:"required,oneof=good bad"`
+}
+
+// BanditArm is one SLM model's standing with the bandit
+type BanditArm struct {
+	Model     string  `json:"model"`
+	Pinned    bool    `json:"pinned"`
+	Share     float64 `json:"share"`      // Share of traffic it gets
+	Score     float64 `json:"score"`      // Quality and latency combined, 0-1
+	Quality   float64 `json:"quality"`    // Estimated, starting from 0.5
+	Ratings   int64   `json:"ratings"`    // Quality observations: feedback, judge scores and failures
+	LatencyMs float64 `json:"latency_ms"` // Mean, 0 before its first answer
+	Answers   int64   `json:"answers"`
+}
+
+// DegradationStatus is the rung of the degradation ladder service is on and
+// what put it there
+type DegradationStatus struct {
+	Level   string   `json:"level"`             // "full", "slm_only", "cached_only" or "maintenance"
+	Reasons []string `json:"reasons,omitempty"` // e.g. "cloud-llm circuit open"
+}
+
+// SemanticHit describes a semantic cache hit. When the threshold is tuned
+// from feedback, the hit is rated through POST /cache/feedback with its ID.
+type SemanticHit struct {
+	ID         string  `json:"id,omitempty"`
+	Similarity float64 `json:"similarity"`
+	Threshold  float64 `json:"threshold"`
+}
+
+// CacheFeedbackRequest rates the answer a semantic cache hit reused
+type CacheFeedbackRequest struct {
+	HitID  string `json:"hit_id" binding:"required"`
+	Rating string `json:"rating" binding:"required,oneof=good bad"`
+}
+
+// Moderation actions
+const (
+	ModerationAllow  = "allow"
+	ModerationFlag   = "flag"   // Answered, with the decision recorded
+	ModerationReject = "reject" // Refused with 400
+)
+
+// ModerationDecision is how content moderation judged a query
+type ModerationDecision struct {
+	Action     string             `json:"action"`               // ModerationAllow, ModerationFlag or ModerationReject
+	Categories []string           `json:"categories,omitempty"` // Disallowed categories the query falls in
+	Scores     map[string]float64 `json:"scores,omitempty"`     // The provider's score per category, when it gives them
+	Provider   string             `json:"provider"`
+}
+
+// ContinuationInfo reports how a length-truncated answer was continued
+type ContinuationInfo struct {
+	Continuations int  `json:"continuations"` // Follow-up calls made after the first response
+	Truncated     bool `json:"truncated"`     // True if the answer was still cut off when the budget ran out
+}
+
+// ProviderMetadata is what the model provider reported about a generation
+type ProviderMetadata struct {
+	FinishReason      string `json:"finish_reason,omitempty"`      // e.g. "stop", "length", "content_filter"
+	ServedModel       string `json:"served_model,omitempty"`       // Model version that actually served the request
+	SystemFingerprint string `json:"system_fingerprint,omitempty"` // Backend configuration identifier
+	ResponseID        string `json:"response_id,omitempty"`
+	InputTokens       int    `json:"input_tokens,omitempty"`  // Prompt tokens billed, summed over the request's calls to the model
+	OutputTokens      int    `json:"output_tokens,omitempty"` // Completion tokens billed, likewise
+}
+
+// SLMResult is the SLM engine's answer along with how it was produced
+type SLMResult struct {
+	Response       string           `json:"-"`
+	Strategy       string           `json:"strategy"`              // "parallel", "series", "hybrid", "race", "bandit" or "single"
+	Aggregation    string           `json:"aggregation,omitempty"` // Aggregation function, when results were aggregated
+	SelectedModel  string           `json:"selected_model"`        // Model whose answer was returned
+	ModelsUsed     []string         `json:"models_used"`           // Every model called, in call order
+	ModelLatencies map[string]int64 `json:"model_latencies_ms"`    // Time spent in each model
+	Usage          []ModelUsage     `json:"-"`                     // Per-model token usage, folded into CostMetrics
+	Judge          *JudgeVerdict    `json:"-"`                     // Set by the judge aggregation when its rationale is returned
+}
+
+// JudgeVerdict is how the judge model settled on an answer
+type JudgeVerdict struct {
+	Model     string `json:"model"`              // The judge
+	Mode      string `json:"mode"`               // "select" or "synthesize"
+	Selected  string `json:"selected,omitempty"` // Model whose answer was picked, in select mode
+	Rationale string `json:"rationale,omitempty"`
+}
+
+// PromptTrimInfo reports what was removed from a prompt to fit the model's context window
+type PromptTrimInfo struct {
+	OriginalTokens  int  `json:"original_tokens"`
+	FinalTokens     int  `json:"final_tokens"`
+	ContextWindow   int  `json:"context_window"`
+	TrimmedLines    int  `json:"trimmed_lines"`              // Context lines (oldest first) dropped from the prompt
+	TrimmedMessages int  `json:"trimmed_messages,omitempty"` // Conversation messages (oldest first) dropped from the prompt
+	TrimmedChars    int  `json:"trimmed_chars"`
+	Retried         bool `json:"retried"` // True if the provider rejected the first attempt as too long
 }
 
 type CostMetrics struct {
-	InputTokens      int     `json:"input_tokens"`
-	OutputTokens     int     `json:"output_tokens"`
-	TotalTokens      int     `json:"total_tokens"`
-	Cost             float64 `json:"cost"`              // Actual cost in USD
-	CacheCost        float64 `json:"cache_cost"`        // Cost of cache operation (embeddings)
-	TotalCost        float64 `json:"total_cost"`        // Cost + CacheCost
-	EstimatedSavings float64 `json:"estimated_savings"` // Money saved by using SLM instead of LLM
-	Model            string  `json:"model"`             // Specific model used
+	InputTokens       int          `json:"input_tokens"`
+	OutputTokens      int          `json:"output_tokens"`
+	TotalTokens       int          `json:"total_tokens"`
+	Cost              float64      `json:"cost"`                         // Actual cost in USD
+	CacheCost         float64      `json:"cache_cost"`                   // Cost of cache operation (embeddings)
+	TotalCost         float64      `json:"total_cost"`                   // Cost + CacheCost + SummarizationCost
+	SummarizationCost float64      `json:"summarization_cost,omitempty"` // LLM cost of compacting the chat session first
+	EstimatedSavings  float64      `json:"estimated_savings"`            // Money saved by using SLM instead of LLM
+	Model             string       `json:"model"`                        // Specific model used
+	EnsembleModels    []string     `json:"ensemble_models,omitempty"`    // All SLMs involved when an ensemble strategy was used
+	ModelBreakdown    []ModelUsage `json:"model_breakdown,omitempty"`    // Per-model usage and cost for ensemble requests
+	UsageReported     bool         `json:"usage_reported"`               // Token counts are the provider's rather than estimates
+}
+
+// ModelUsage is the token usage and cost of one model within a request
+type ModelUsage struct {
+	Model        string  `json:"model"`
+	Calls        int     `json:"calls"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+	Estimated    bool    `json:"estimated,omitempty"` // Some calls' tokens were counted locally because the provider didn't report usage
+}
+
+// ModelInfo describes a model's context window and capabilities
+type ModelInfo struct {
+	Name             string `json:"name"`
+	Tier             string `json:"tier"` // "llm" or "slm"
+	ContextWindow    int    `json:"context_window"`
+	MaxOutputTokens  int    `json:"max_output_tokens"`
+	SupportsTools    bool   `json:"supports_tools"`
+	SupportsVision   bool   `json:"supports_vision"`
+	SupportsJSONMode bool   `json:"supports_json_mode"`
+	Encoding         string `json:"encoding,omitempty"` // tiktoken encoding its tokens are counted in, if not picked from the name
+	Region           string `json:"region,omitempty"`   // Where the provider processes requests, for data residency
 }
 
 type RoutingDecision struct {
-	UseLLM          bool
-	Reason          string
-	Confidence      float64
-	ComplexityScore float64
+	UseLLM           bool     `json:"use_llm"`
+	Reason           string   `json:"reason"`
+	Confidence       float64  `json:"confidence"`
+	ComplexityScore  float64  `json:"complexity_score"`
+	Forced           bool     `json:"forced"`                       // Only the chosen tier can serve the request, so don't fail over
+	Model            string   `json:"model,omitempty"`              // Specific model picked by the routing targets, empty for the tier default
+	EstimatedCostUSD float64  `json:"estimated_cost_usd,omitempty"` // Pre-routing LLM cost estimate, when a cost threshold is set
+	Regions          []string `json:"regions,omitempty"`            // Regions the request's data had to stay in
+
+	Features map[string]float64 `json:"features,omitempty"` // What the router knew about the request, for training routing models
 }
 
 type QueryMetrics struct {
@@ -45,40 +442,642 @@ type QueryMetrics struct {
 	QueryLength int
 }
 
+// UsageSummary aggregates a user's requests and spend over one day or month
+type UsageSummary struct {
+	Period       string  `json:"period"` // "2006-01-02" for a day, "2006-01" for a month
+	Requests     int     `json:"requests"`
+	CacheHits    int     `json:"cache_hits"`
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	TotalTokens  int     `json:"total_tokens"`
+	Cost         float64 `json:"cost"` // Total cost in USD, including cache costs
+	Savings      float64 `json:"savings"`
+}
+
+// QueryCount is how many times a normalized query was asked
+type QueryCount struct {
+	Query string `json:"query"`
+	Count int64  `json:"count"`
+}
+
+// QueryReport summarizes query frequency over the last Days days
+type QueryReport struct {
+	Days            int          `json:"days"`
+	TotalQueries    int64        `json:"total_queries"`
+	DistinctQueries int64        `json:"distinct_queries"` // Estimated
+	TopQueries      []QueryCount `json:"top_queries"`      // Most frequent first
+}
+
+// PinnedAnswer is a curated answer served for a normalized query without
+// calling a model, once an admin has approved it
+type PinnedAnswer struct {
+	ID         string     `json:"id"`
+	Query      string     `json:"query"` // Normalized
+	Answer     string     `json:"answer"`
+	Status     string     `json:"status"` // "pending", "approved" or "rejected"
+	CreatedBy  string     `json:"created_by,omitempty"`
+	UpdatedBy  string     `json:"updated_by,omitempty"`
+	ReviewedBy string     `json:"reviewed_by,omitempty"`
+	ReviewNote string     `json:"review_note,omitempty"`
+	Hits       int64      `json:"hits"` // Times it was served
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// Annotation is a reviewer's verdict on a past response, identified by the
+// user who sent the request and its ID (X-Request-ID). Annotations build a
+// labeled dataset for eval suites and routing training.
+type Annotation struct {
+	UserID    string    `json:"user_id"`
+	RequestID string    `json:"request_id"`
+	Reviewer  string    `json:"reviewer"`
+	Label     string    `json:"label"` // "correct" or "incorrect"
+	Category  string    `json:"category,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AnnotationRequest is the body of PUT /annotations/:user_id/:request_id
+type AnnotationRequest struct {
+	Label    string `json:"label" binding:"required,oneof=correct incorrect"`
+	Category string `json:"category" binding:"max=64"`
+	Notes    string `json:"notes" binding:"max=4000"`
+}
+
+// User is an authenticated account
+type User struct {
+	ID            string    `json:"id"`
+	Email         string    `json:"email"`
+	Name          string    `json:"name"`
+	Picture       string    `json:"picture,omitempty"`
+	Role          string    `json:"role"`                  // RoleUser or RoleAdmin, from the admin allow-list
+	Deactivated   bool      `json:"deactivated,omitempty"` // Deactivated users can't sign in or use the API
+	DeactivatedAt time.Time `json:"deactivated_at,omitzero"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastLoginAt   time.Time `json:"last_login_at"`
+}
+
+// User roles
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+// UserPreferences are a user's privacy settings. Users take part in
+// everything until they opt out.
+type UserPreferences struct {
+	ShadowEvaluationOptOut bool      `json:"shadow_evaluation_opt_out"` // Keep the user out of percentage rollouts, which try features on a share of users
+	AnalyticsOptOut        bool      `json:"analytics_opt_out"`         // Don't count queries in the retained query statistics
+	TrainingExportOptOut   bool      `json:"training_export_opt_out"`   // Leave requests out of warehouse exports and routing examples
+	UpdatedAt              time.Time `json:"updated_at,omitzero"`
+}
+
+// UpdatePreferencesRequest is the body of PATCH /me/preferences; settings
+// that are left out keep their value
+type UpdatePreferencesRequest struct {
+	ShadowEvaluationOptOut *bool `json:"shadow_evaluation_opt_out"`
+	AnalyticsOptOut        *bool `json:"analytics_opt_out"`
+	TrainingExportOptOut   *bool `json:"training_export_opt_out"`
+}
+
+// TermsAcceptance records a user accepting a version of the terms of service
+// and privacy policy
+type TermsAcceptance struct {
+	Version    string    `json:"version"`
+	AcceptedAt time.Time `json:"accepted_at"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+}
+
+// TermsStatus describes the current terms and, for a signed-in user, whether
+// they have accepted them
+type TermsStatus struct {
+	Version    string            `json:"version"`
+	TermsURL   string            `json:"terms_url,omitempty"`
+	PrivacyURL string            `json:"privacy_url,omitempty"`
+	Required   bool              `json:"required"` // Inference is refused until the version is accepted
+	Accepted   *bool             `json:"accepted,omitempty"`
+	History    []TermsAcceptance `json:"history,omitempty"` // The user's acceptances, oldest first
+}
+
+// AcceptTermsRequest is the body of POST /me/terms. The version must be the
+// current one, so clients can't accept terms they didn't show.
+type AcceptTermsRequest struct {
+	Version string `json:"version" binding:"required"`
+}
+
+// OrgCredentials lists the provider keys an org brought. The keys themselves
+// are never returned.
+type OrgCredentials struct {
+	Org              string        `json:"org"`
+	Keys             []ProviderKey `json:"keys"`
+	PlatformFallback bool          `json:"platform_fallback"`       // Providers without a key use the platform's
+	AlertWebhook     string        `json:"alert_webhook,omitempty"` // Notified when one of the org's keys becomes unhealthy
+}
+
+// ProviderKey describes one of an org's stored provider keys
+type ProviderKey struct {
+	Provider  string     `json:"provider"` // "openai", "anthropic", "groq", ...
+	Last4     string     `json:"last4"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Health    KeyHealth  `json:"health"`
+	Active    string     `json:"active"`              // "primary", or "secondary" while the primary key is failing
+	Secondary *StoredKey `json:"secondary,omitempty"` // Standby key, used when the primary one fails
+}
+
+// StoredKey describes an org's standby key for a provider
+type StoredKey struct {
+	Last4     string    `json:"last4"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Health    KeyHealth `json:"health"`
+}
+
+// Key health statuses
+const (
+	KeyHealthy     = "healthy"
+	KeyAuthFailing = "auth_failing" // The provider rejected the key
+	KeyQuotaLow    = "quota_low"    // Little of the key's rate limit is left
+)
+
+// KeyHealth is what the latest model calls showed about a stored key
+type KeyHealth struct {
+	Status string    `json:"status"`
+	Detail string    `json:"detail,omitempty"`
+	Since  time.Time `json:"since,omitempty"`
+}
+
+// KeyAlert is raised when one of an org's keys becomes unhealthy or recovers
+type KeyAlert struct {
+	Org      string    `json:"org"`
+	Provider string    `json:"provider"`
+	Slot     string    `json:"slot"` // "primary" or "secondary"
+	Last4    string    `json:"last4"`
+	Status   string    `json:"status"`
+	Detail   string    `json:"detail,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// RequestStatsReport aggregates the requests served over a time window
+type RequestStatsReport struct {
+	Window          string       `json:"window"`
+	Since           time.Time    `json:"since"`
+	Requests        int64        `json:"requests"`
+	LLMRequests     int64        `json:"llm_requests"`
+	SLMRequests     int64        `json:"slm_requests"`
+	LLMShare        float64      `json:"llm_share"` // Of the requests a model answered
+	CacheHits       int64        `json:"cache_hits"`
+	CacheHitRate    float64      `json:"cache_hit_rate"` // Of the requests a model or cache answered
+	ClientErrors    int64        `json:"client_errors"`
+	ServerErrors    int64        `json:"server_errors"`
+	ClientErrorRate float64      `json:"client_error_rate"`
+	ServerErrorRate float64      `json:"server_error_rate"`
+	AvgLatencyMs    float64      `json:"avg_latency_ms"`
+	CostUSD         float64      `json:"cost_usd"`
+	Models          []ModelStats `json:"models"`
+	// Experiments break the requests down by metadata.experiment
+	Experiments []ExperimentStats `json:"experiments"`
+}
+
+// ModelStats are one model's requests within a RequestStatsReport
+type ModelStats struct {
+	Model        string  `json:"model"`
+	Requests     int64   `json:"requests"`
+	Errors       int64   `json:"errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+}
+
+// ExperimentStats are one experiment's requests within a RequestStatsReport
+type ExperimentStats struct {
+	Experiment   string  `json:"experiment"`
+	Requests     int64   `json:"requests"`
+	LLMRequests  int64   `json:"llm_requests"`
+	CacheHits    int64   `json:"cache_hits"`
+	Errors       int64   `json:"errors"`
+	AvgLatencyMs float64 `json:"avg_latency_ms"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+// UserCost is what a user's requests cost over a time window
+type UserCost struct {
+	UserID  string  `json:"user_id"`
+	CostUSD float64 `json:"cost_usd"`
+}
+
+// Spend alert levels
+const (
+	SpendCapWarning = "warning"
+	SpendCapReached = "cap_reached"
+)
+
+// SpendAlert is raised when a provider key's spend this month crosses the
+// alert threshold or reaches its cap
+type SpendAlert struct {
+	Provider string    `json:"provider"`
+	Org      string    `json:"org,omitempty"` // Empty for the platform's key
+	Month    string    `json:"month"`
+	Level    string    `json:"level"`
+	SpentUSD float64   `json:"spent_usd"`
+	CapUSD   float64   `json:"cap_usd"`
+	Time     time.Time `json:"time"`
+}
+
+// Canary alert levels
+const (
+	CanaryFailing   = "failing"
+	CanaryRecovered = "recovered"
+)
+
+// CanaryResult is the outcome of sending a canary prompt through the
+// inference pipeline
+type CanaryResult struct {
+	Name           string    `json:"name"`
+	Passed         bool      `json:"passed"`
+	Similarity     float64   `json:"similarity"`                // Between the answer and the expected one, 1 without an expected answer
+	Method         string    `json:"method,omitempty"`          // "embedding" or "word_overlap"
+	MissingPhrases []string  `json:"missing_phrases,omitempty"` // Required phrases the answer lacked
+	Response       string    `json:"response,omitempty"`
+	Model          string    `json:"model,omitempty"`
+	Tier           string    `json:"tier,omitempty"`
+	LatencyMs      float64   `json:"latency_ms"`
+	Error          string    `json:"error,omitempty"` // Why the request failed
+	CheckedAt      time.Time `json:"checked_at"`
+}
+
+// CanaryAlert is raised when a canary starts failing and when it passes again
+type CanaryAlert struct {
+	Level  string       `json:"level"`
+	Result CanaryResult `json:"result"`
+}
+
+// SpendCapStatus is a capped key's spend this month
+type SpendCapStatus struct {
+	Provider string  `json:"provider"`
+	Org      string  `json:"org,omitempty"`
+	Month    string  `json:"month"`
+	SpentUSD float64 `json:"spent_usd"`
+	CapUSD   float64 `json:"cap_usd"`
+	Reached  bool    `json:"reached"`
+}
+
+// SetProviderKeyRequest is the body of PUT /admin/orgs/:org/credentials/:provider
+type SetProviderKeyRequest struct {
+	APIKey string `json:"api_key" binding:"required"`
+}
+
+// UpdateOrgCredentialsRequest is the body of PATCH /admin/orgs/:org/credentials
+type UpdateOrgCredentialsRequest struct {
+	PlatformFallback *bool   `json:"platform_fallback"`
+	AlertWebhook     *string `json:"alert_webhook"` // "" stops the alerts
+}
+
+// APIKey is a key for machine-to-machine access on behalf of a user. Only a
+// hash of the secret is stored; the secret itself is shown once, at creation.
+type APIKey struct {
+	ID                string    `json:"id"`
+	UserID            string    `json:"user_id"`
+	Name              string    `json:"name"`
+	Prefix            string    `json:"prefix"`                        // First characters of the secret, to recognize it
+	RequestsPerMinute int       `json:"requests_per_minute,omitempty"` // Per-key rate limit, 0 for the default
+	Scopes            []string  `json:"scopes,omitempty"`              // Extra permissions, e.g. ScopeCacheBypass
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// API key scopes
+const (
+	ScopeCacheBypass = "cache:bypass"       // May send X-HybridLM-No-Cache
+	ScopeAnnotate    = "responses:annotate" // May annotate past responses
+)
+
+// HasScope reports whether the key was granted a scope
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// TokenPair is issued to clients that authenticate with bearer tokens
+// instead of the session cookie
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // Access token lifetime in seconds
+}
+
 // Chat-specific types for conversational interactions
 
 type ChatMessage struct {
-	Role      string    `json:"role"`      // "user" or "assistant"
-	Content   string    `json:"content"`   // The actual message text
-	Timestamp time.Time `json:"timestamp"` // When the message was created
+	ID        string    `json:"id,omitempty"`    // Stable message ID; summaries have none
+	Role      string    `json:"role"`            // "system", "user" or "assistant"
+	Content   string    `json:"content"`         // The actual message text
+	Timestamp time.Time `json:"timestamp"`       // When the message was created
+	Model     string    `json:"model,omitempty"` // Model that wrote an assistant message
+	Cost      float64   `json:"cost,omitempty"`  // USD spent on an assistant message
 }
 
 type ChatSession struct {
-	SessionID        string        `json:"session_id"`
-	Messages         []ChatMessage `json:"messages"`
-	CreatedAt        time.Time     `json:"created_at"`
-	LastInteraction  time.Time     `json:"last_interaction"`
-	TotalTokens      int           `json:"total_tokens"`       // Running token count
-	MessageCount     int           `json:"message_count"`      // Number of messages in session
-	ModelPreference  string        `json:"model_preference"`   // "llm", "slm", or "auto"
+	SessionID       string        `json:"session_id"`
+	UserID          string        `json:"user_id"` // Owner of the session
+	Messages        []ChatMessage `json:"messages"`
+	CreatedAt       time.Time     `json:"created_at"`
+	LastInteraction time.Time     `json:"last_interaction"`
+	TotalTokens     int           `json:"total_tokens"`              // Running token count
+	TotalCost       float64       `json:"total_cost"`                // Running cost in USD
+	MessageCount    int           `json:"message_count"`             // Number of messages in session
+	ModelPreference string        `json:"model_preference"`          // "llm", "slm", or "auto"
+	PreferredModel  string        `json:"preferred_model,omitempty"` // Specific model asked for, if any
+	SystemPrompt    string        `json:"system_prompt,omitempty"`   // Sent as the first message of every inference
+	Title           string        `json:"title,omitempty"`           // Generated from the first exchange unless renamed
+	Pinned          bool          `json:"pinned,omitempty"`          // Kept until deleted instead of expiring when idle
+	Archived        bool          `json:"archived,omitempty"`        // Listed apart from active sessions and kept until deleted
+	Project         string        `json:"project,omitempty"`         // Groups sessions, set when the session is created
+	Tags            []string      `json:"tags,omitempty"`
+}
+
+// SessionSummary is a session as listed in GET /chat/sessions
+type SessionSummary struct {
+	SessionID       string    `json:"session_id"`
+	Title           string    `json:"title,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+	LastInteraction time.Time `json:"last_interaction"`
+	MessageCount    int       `json:"message_count"`
+	Pinned          bool      `json:"pinned,omitempty"`
+	Archived        bool      `json:"archived,omitempty"`
+	Project         string    `json:"project,omitempty"`
+	Tags            []string  `json:"tags,omitempty"`
+}
+
+// PinSessionRequest is the body of PATCH /chat/sessions/:session_id/pin
+type PinSessionRequest struct {
+	Pinned *bool `json:"pinned" binding:"required"`
+}
+
+// SessionPage is a page of GET /chat/sessions
+type SessionPage struct {
+	Sessions   []SessionSummary `json:"sessions"`
+	NextCursor string           `json:"next_cursor,omitempty"` // Pass as ?cursor= for the next page; empty on the last page
+}
+
+// Sentiment trends of SessionAnalytics
+const (
+	SentimentImproving = "improving"
+	SentimentDeclining = "declining"
+	SentimentStable    = "stable"
+)
+
+// SessionAnalytics is GET /chat/sessions/:session_id/analytics
+type SessionAnalytics struct {
+	SessionID           string    `json:"session_id"`
+	Topics              []string  `json:"topics"`
+	Sentiment           []float64 `json:"sentiment"`            // Score of each user message in order, from -1 (negative) to 1 (positive)
+	SentimentTrend      string    `json:"sentiment_trend"`      // "improving", "declining" or "stable"
+	Escalations         int       `json:"escalations"`          // User messages asking for a human or complaining
+	UnresolvedQuestions []string  `json:"unresolved_questions"` // User questions left unanswered or that the assistant couldn't answer
+	MessageCount        int       `json:"message_count"`        // Messages the analytics cover
+	ComputedAt          time.Time `json:"computed_at"`
+	Stale               bool      `json:"stale"` // The session has grown since; fresh analytics are on their way
+}
+
+// SessionExport is a session as exported by GET /chat/sessions/:session_id/export
+type SessionExport struct {
+	SessionID       string            `json:"session_id"`
+	Title           string            `json:"title,omitempty"`
+	SystemPrompt    string            `json:"system_prompt,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+	LastInteraction time.Time         `json:"last_interaction"`
+	ExportedAt      time.Time         `json:"exported_at"`
+	MessageCount    int               `json:"message_count"`
+	OmittedMessages int               `json:"omitted_messages,omitempty"` // Earlier messages no longer stored
+	Models          []string          `json:"models,omitempty"`           // Models that answered, in order of first answer
+	TotalTokens     int               `json:"total_tokens"`
+	TotalCost       float64           `json:"total_cost"`
+	Messages        []ExportedMessage `json:"messages"`
+}
+
+// ExportedMessage is a message of a session export
+type ExportedMessage struct {
+	ChatMessage
+	CumulativeCost float64 `json:"cumulative_cost"` // Session cost up to and including this message
+}
+
+// RenameSessionRequest is the body of PATCH /chat/sessions/:session_id
+type RenameSessionRequest struct {
+	Title string `json:"title" binding:"required,max=200"`
+}
+
+// EditMessageRequest is the body of PATCH
+// /chat/sessions/:session_id/messages/:index, which replaces a user message
+// and answers it again; the turns after it are discarded
+type EditMessageRequest struct {
+	Message     string  `json:"message" binding:"required"`
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+	Stream      bool    `json:"stream,omitempty"`
+}
+
+// RegenerateRequest is the optional body of POST
+// /chat/sessions/:session_id/messages/:index/regenerate
+type RegenerateRequest struct {
+	ForceLLM    bool    `json:"force_llm,omitempty"` // Answer with the LLM tier whatever the routing
+	MaxTokens   int     `json:"max_tokens,omitempty"`
+	Temperature float32 `json:"temperature,omitempty"`
+	Stream      bool    `json:"stream,omitempty"`
+}
+
+// CreateSessionRequest is the body of POST /chat/sessions
+type CreateSessionRequest struct {
+	SystemPrompt string `json:"system_prompt,omitempty" binding:"max=8000"` // Overrides the server's default system prompt
+	Project      string `json:"project,omitempty" binding:"max=100"`
+}
+
+// Bulk session actions
+const (
+	BulkActionDelete    = "delete"
+	BulkActionArchive   = "archive"
+	BulkActionUnarchive = "unarchive"
+	BulkActionTag       = "tag"
+)
+
+// SessionFilter selects a user's sessions; every set field must match
+type SessionFilter struct {
+	OlderThan string `json:"older_than,omitempty"` // Idle for longer than this duration, e.g. "720h"
+	Tag       string `json:"tag,omitempty"`
+	Project   string `json:"project,omitempty"`
+	Archived  *bool  `json:"archived,omitempty"`
+}
+
+// BulkSessionRequest is the body of POST /chat/sessions/bulk
+type BulkSessionRequest struct {
+	Action string        `json:"action" binding:"required,oneof=delete archive unarchive tag"`
+	Filter SessionFilter `json:"filter"`
+	Tags   []string      `json:"tags,omitempty" binding:"max=20,dive,min=1,max=50"` // Added by "tag"
+}
+
+// BulkSessionResult is what a bulk session job did
+type BulkSessionResult struct {
+	Action    string `json:"action"`
+	Matched   int    `json:"matched"`
+	Processed int    `json:"processed"`
 }
 
 type ChatRequest struct {
-	SessionID   string  `json:"session_id,omitempty"`   // Optional: if not provided, creates new session
+	SessionID   string  `json:"session_id,omitempty"`       // Optional: if not provided, creates new session
 	Message     string  `json:"message" binding:"required"` // User's message
 	MaxTokens   int     `json:"max_tokens,omitempty"`
 	Temperature float32 `json:"temperature,omitempty"`
-	Stream      bool    `json:"stream,omitempty"`       // Enable streaming response
+	Stream      bool    `json:"stream,omitempty"`   // Enable streaming response
+	Complete    bool    `json:"complete,omitempty"` // Continue answers cut off by the token limit
+
+	// ModelPreference and Model override routing like on InferenceRequest, and
+	// are remembered by the session for later messages
+	ModelPreference string `json:"model_preference,omitempty" binding:"omitempty,oneof=llm slm auto"`
+	Model           string `json:"model,omitempty"`
 }
 
 type ChatResponse struct {
-	SessionID      string        `json:"session_id"`
-	Response       string        `json:"response"`
-	ModelUsed      string        `json:"model_used"`
-	RoutingReason  string        `json:"routing_reason"`
-	Latency        time.Duration `json:"latency"`
-	CacheHit       bool          `json:"cache_hit"`
-	Timestamp      time.Time     `json:"timestamp"`
-	MessageCount   int           `json:"message_count"`   // Total messages in this session
-	CostMetrics    *CostMetrics  `json:"cost_metrics,omitempty"`
+	SessionID     string            `json:"session_id"`
+	Response      string            `json:"response"`
+	ModelUsed     string            `json:"model_used"`
+	Tier          string            `json:"tier"`
+	RoutingReason string            `json:"routing_reason"`
+	Latency       time.Duration     `json:"latency"`
+	CacheHit      bool              `json:"cache_hit"`
+	Timestamp     time.Time         `json:"timestamp"`
+	MessageCount  int               `json:"message_count"` // Total messages in this session
+	CostMetrics   *CostMetrics      `json:"cost_metrics,omitempty"`
+	Metadata      *ResponseMetadata `json:"metadata,omitempty"`
+	Fallback      *FallbackInfo     `json:"fallback,omitempty"`
+	Deduplicated  bool              `json:"deduplicated,omitempty"` // True if this repeated a concurrent identical turn
+	Receipt       *Receipt          `json:"receipt,omitempty"`
+}
+
+// OpenAI-compatible assistants objects: threads are chat sessions, runs are
+// chat turns run as background jobs, and responses are chat turns linked by
+// previous_response_id
+
+// Thread is a chat session as the Assistants API shows it
+type Thread struct {
+	ID        string            `json:"id"`
+	Object    string            `json:"object"` // "thread"
+	CreatedAt int64             `json:"created_at"`
+	Metadata  map[string]string `json:"metadata"`
+}
+
+// ThreadMessage is a message of a thread
+type ThreadMessage struct {
+	ID        string           `json:"id"`
+	Object    string           `json:"object"` // "thread.message"
+	CreatedAt int64            `json:"created_at"`
+	ThreadID  string           `json:"thread_id"`
+	Role      string           `json:"role"`
+	Status    string           `json:"status"` // "completed", or "pending" until a run answers it
+	Content   []MessageContent `json:"content"`
+}
+
+type MessageContent struct {
+	Type string      `json:"type"` // "text"
+	Text MessageText `json:"text"`
+}
+
+type MessageText struct {
+	Value       string `json:"value"`
+	Annotations []any  `json:"annotations"`
+}
+
+// MessageInput is a message added to a thread or passed as response input.
+// Content is a string or a list of text parts.
+type MessageInput struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// CreateThreadRequest is the body of POST /threads
+type CreateThreadRequest struct {
+	Messages []MessageInput    `json:"messages,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// CreateRunRequest is the body of POST /threads/:thread_id/runs
+type CreateRunRequest struct {
+	Model               string         `json:"model,omitempty"`
+	Instructions        string         `json:"instructions,omitempty"` // Becomes the thread's system prompt
+	AdditionalMessages  []MessageInput `json:"additional_messages,omitempty"`
+	Temperature         float32        `json:"temperature,omitempty"`
+	MaxCompletionTokens int            `json:"max_completion_tokens,omitempty"`
+	Stream              bool           `json:"stream,omitempty"`
+}
+
+// Run is a background generation answering a thread's new messages
+type Run struct {
+	ID          string    `json:"id"`
+	Object      string    `json:"object"` // "thread.run"
+	CreatedAt   int64     `json:"created_at"`
+	ThreadID    string    `json:"thread_id"`
+	Status      string    `json:"status"` // "queued", "in_progress", "completed" or "failed"
+	Model       string    `json:"model,omitempty"`
+	StartedAt   *int64    `json:"started_at"`
+	CompletedAt *int64    `json:"completed_at"`
+	FailedAt    *int64    `json:"failed_at"`
+	LastError   *APIError `json:"last_error"`
+	Usage       *RunUsage `json:"usage"`
+}
+
+type RunUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// APIError is a failed run's or response's error
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// CreateResponseRequest is the body of POST /responses. Input is a string or
+// a list of messages.
+type CreateResponseRequest struct {
+	Model              string          `json:"model,omitempty"`
+	Input              json.RawMessage `json:"input" binding:"required"`
+	Instructions       string          `json:"instructions,omitempty"` // Becomes the conversation's system prompt
+	PreviousResponseID string          `json:"previous_response_id,omitempty"`
+	Background         bool            `json:"background,omitempty"`
+	Temperature        float32         `json:"temperature,omitempty"`
+	MaxOutputTokens    int             `json:"max_output_tokens,omitempty"`
+	Stream             bool            `json:"stream,omitempty"`
+}
+
+// ResponseObject is a response as the Responses API shows it
+type ResponseObject struct {
+	ID                 string            `json:"id"`
+	Object             string            `json:"object"` // "response"
+	CreatedAt          int64             `json:"created_at"`
+	Status             string            `json:"status"` // "queued", "in_progress", "completed" or "failed"
+	Model              string            `json:"model,omitempty"`
+	Output             []ResponseOutput  `json:"output"`
+	OutputText         string            `json:"output_text,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	Error              *APIError         `json:"error"`
+	Usage              *ResponseUsage    `json:"usage"`
+	Metadata           map[string]string `json:"metadata"` // Holds the session_id of the conversation
+}
+
+type ResponseOutput struct {
+	Type    string            `json:"type"` // "message"
+	ID      string            `json:"id"`
+	Role    string            `json:"role"`
+	Status  string            `json:"status"`
+	Content []ResponseContent `json:"content"`
+}
+
+type ResponseContent struct {
+	Type        string `json:"type"` // "output_text"
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+type ResponseUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+	TotalTokens  int `json:"total_tokens"`
 }
@@ -0,0 +1,275 @@
+// Package moderation screens queries for disallowed content before they are
+// routed, with the OpenAI moderation API or the SLM as a classifier.
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	ProviderOff    = "off"
+	ProviderOpenAI = "openai"
+	ProviderSLM    = "slm"
+
+	defaultEndpoint = "https://api.openai.com/v1"
+	defaultModel    = "omni-moderation-latest"
+	defaultTimeout  = 5 * time.Second
+)
+
+// slmCategories are the categories the SLM is asked about, named like
+// OpenAI's so config works with either provider
+var slmCategories = []string{"harassment", "hate", "illicit", "self-harm", "sexual", "sexual/minors", "violence"}
+
+var slmInstructions = "You are a content moderation classifier. Decide whether the user's message asks for or contains " +
+	"disallowed content in any of these categories: " + strings.Join(slmCategories, ", ") + ". " +
+	`Reply with only a JSON object: {"flagged": false, "categories": []} if it doesn't, otherwise ` +
+	`{"flagged": true, "categories": [...]} listing the matching category names exactly as given.`
+
+// slmVerdict is the SLM's reply
+type slmVerdict struct {
+	Flagged    *bool    `json:"flagged"`
+	Categories []string `json:"categories"`
+}
+
+// ErrUnavailable is returned when the provider can't be reached and queries
+// aren't let through unscreened
+var ErrUnavailable = errors.New("content moderation unavailable")
+
+// Moderator judges queries and decides what happens to those it flags
+type Moderator struct {
+	provider   string
+	action     string   // models.ModerationFlag or models.ModerationReject
+	categories []string // Categories acted on; empty for all of them
+	failClosed bool
+	endpoint   string
+	apiKey     string
+	model      string
+	client     *http.Client
+	slm        models.SLMInferencer // Used by the slm provider
+}
+
+// New returns the moderator cfg configures, or nil when moderation is off
+func New(cfg config.ModerationConfig) (*Moderator, error) {
+	switch cfg.Provider {
+	case "", ProviderOff:
+		return nil, nil
+	case ProviderOpenAI:
+		if cfg.APIKey == "" {
+			return nil, errors.New("moderation.api_key or MODERATION_API_KEY is required for the openai moderation provider")
+		}
+	case ProviderSLM:
+	default:
+		return nil, fmt.Errorf("unknown moderation provider %q", cfg.Provider)
+	}
+
+	m := &Moderator{
+		provider:   cfg.Provider,
+		action:     cfg.Action,
+		categories: cfg.Categories,
+		failClosed: cfg.FailClosed,
+		endpoint:   strings.TrimSuffix(cfg.Endpoint, "/"),
+		apiKey:     cfg.APIKey,
+		model:      cfg.Model,
+	}
+	switch m.action {
+	case "":
+		m.action = models.ModerationReject
+	case models.ModerationReject, models.ModerationFlag:
+	default:
+		return nil, fmt.Errorf("unknown moderation action %q", cfg.Action)
+	}
+	if m.endpoint == "" {
+		m.endpoint = defaultEndpoint
+	}
+	if m.model == "" {
+		m.model = defaultModel
+	}
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	m.client = &http.Client{Timeout: timeout}
+	return m, nil
+}
+
+// SetSLM sets the model the slm provider asks
+func (m *Moderator) SetSLM(slm models.SLMInferencer) {
+	m.slm = slm
+}
+
+// Provider returns the provider's name
+func (m *Moderator) Provider() string {
+	return m.provider
+}
+
+// Check judges texts together, such as a query and the conversation and
+// context sent with it: the decision covers the categories any of them falls
+// in. A nil moderator returns no decision. When the provider fails, the texts
+// are let through without one unless moderation fails closed, in which case
+// ErrUnavailable is returned.
+func (m *Moderator) Check(ctx context.Context, texts ...string) (*models.ModerationDecision, error) {
+	if m == nil {
+		return nil, nil
+	}
+
+	var inputs []string
+	for _, text := range texts {
+		if strings.TrimSpace(text) != "" && !slices.Contains(inputs, text) {
+			inputs = append(inputs, text)
+		}
+	}
+	if len(inputs) == 0 {
+		return &models.ModerationDecision{Action: models.ModerationAllow, Provider: m.provider}, nil
+	}
+
+	var flagged []string
+	var scores map[string]float64
+	var err error
+	if m.provider == ProviderSLM {
+		flagged, err = m.classifySLM(ctx, inputs)
+	} else {
+		flagged, scores, err = m.classifyOpenAI(ctx, inputs)
+	}
+	if err != nil {
+		if m.failClosed {
+			return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+		}
+		log.Printf("⚠️  Content moderation failed, letting the query through: %v", err)
+		return nil, nil
+	}
+
+	decision := &models.ModerationDecision{Action: models.ModerationAllow, Provider: m.provider, Scores: scores}
+	for _, category := range flagged {
+		if m.actsOn(category) {
+			decision.Categories = append(decision.Categories, category)
+		}
+	}
+	if len(decision.Categories) > 0 {
+		decision.Action = m.action
+	}
+	return decision, nil
+}
+
+// actsOn reports whether a flagged category is acted on; configuring a
+// category covers its subcategories, like "violence" does "violence/graphic"
+func (m *Moderator) actsOn(category string) bool {
+	return len(m.categories) == 0 || slices.ContainsFunc(m.categories, func(configured string) bool {
+		return category == configured || strings.HasPrefix(category, configured+"/")
+	})
+}
+
+// classifyOpenAI asks the moderation API for the categories any of texts
+// falls in, and the highest score of each category
+func (m *Moderator) classifyOpenAI(ctx context.Context, texts []string) ([]string, map[string]float64, error) {
+	body, err := json.Marshal(map[string]any{"input": texts, "model": m.model})
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.endpoint+"/moderations", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+m.apiKey)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, nil, fmt.Errorf("moderation API returned %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	var out struct {
+		Results []struct {
+			Categories     map[string]bool    `json:"categories"`
+			CategoryScores map[string]float64 `json:"category_scores"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode moderation response: %w", err)
+	}
+	if len(out.Results) != len(texts) {
+		return nil, nil, fmt.Errorf("moderation API returned %d results for %d inputs", len(out.Results), len(texts))
+	}
+
+	var flagged []string
+	scores := make(map[string]float64)
+	for _, result := range out.Results {
+		for category, hit := range result.Categories {
+			if hit && !slices.Contains(flagged, category) {
+				flagged = append(flagged, category)
+			}
+		}
+		for category, score := range result.CategoryScores {
+			scores[category] = max(scores[category], score)
+		}
+	}
+	sort.Strings(flagged)
+	return flagged, scores, nil
+}
+
+// classifySLM asks the SLM for the categories texts fall in, in one call
+func (m *Moderator) classifySLM(ctx context.Context, texts []string) ([]string, error) {
+	if m.slm == nil {
+		return nil, errors.New("no SLM to moderate with")
+	}
+
+	text := texts[0]
+	if len(texts) > 1 {
+		parts := make([]string, len(texts))
+		for i, part := range texts {
+			parts[i] = fmt.Sprintf("Part %d:\n%s", i+1, part)
+		}
+		text = strings.Join(parts, "\n\n")
+	}
+	messages := []models.ChatMessage{
+		{Role: "system", Content: slmInstructions},
+		{Role: "user", Content: text},
+	}
+	result, err := m.slm.InferChat(ctx, messages, models.ChatOptions{MaxTokens: 60, ResponseFormat: "json_object"})
+	if err != nil {
+		return nil, err
+	}
+	return parseVerdict(result.Response)
+}
+
+// parseVerdict returns the categories the SLM's verdict flags. Verdicts that
+// aren't JSON, flag without a known category, or name categories without
+// flagging are errors, so a garbled reply never counts as safe.
+func parseVerdict(reply string) ([]string, error) {
+	start, end := strings.Index(reply, "{"), strings.LastIndex(reply, "}")
+	var verdict slmVerdict
+	if start < 0 || end < start || json.Unmarshal([]byte(reply[start:end+1]), &verdict) != nil || verdict.Flagged == nil {
+		return nil, fmt.Errorf("unexpected moderation reply %q", reply)
+	}
+
+	var flagged []string
+	for _, category := range verdict.Categories {
+		category = strings.ToLower(strings.TrimSpace(category))
+		if slices.Contains(slmCategories, category) && !slices.Contains(flagged, category) {
+			flagged = append(flagged, category)
+		}
+	}
+	if *verdict.Flagged != (len(flagged) > 0) {
+		return nil, fmt.Errorf("inconsistent moderation reply %q", reply)
+	}
+	sort.Strings(flagged)
+	return flagged, nil
+}
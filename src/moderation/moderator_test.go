@@ -0,0 +1,178 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// fakeModerationAPI flags inputs containing "attack" as violence/graphic
+func fakeModerationAPI(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/moderations", r.URL.Path)
+		assert.Equal(t, "Bearer sk-test", r.Header.Get("Authorization"))
+		var body struct {
+			Input []string `json:"input"`
+			Model string   `json:"model"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "omni-moderation-latest", body.Model)
+
+		results := make([]map[string]interface{}, len(body.Input))
+		for i, input := range body.Input {
+			violent := input == "plan an attack"
+			score := 0.01
+			if violent {
+				score = 0.93
+			}
+			results[i] = map[string]interface{}{
+				"flagged":         violent,
+				"categories":      map[string]bool{"violence/graphic": violent, "hate": false},
+				"category_scores": map[string]float64{"violence/graphic": score, "hate": 0.01},
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"results": results})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestModerator_OpenAI(t *testing.T) {
+	server := fakeModerationAPI(t)
+	moderator, err := New(config.ModerationConfig{Provider: ProviderOpenAI, Endpoint: server.URL, APIKey: "sk-test"})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	decision, err := moderator.Check(ctx, "plan an attack")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationReject, decision.Action)
+	assert.Equal(t, []string{"violence/graphic"}, decision.Categories)
+	assert.Equal(t, 0.93, decision.Scores["violence/graphic"])
+	assert.Equal(t, ProviderOpenAI, decision.Provider)
+
+	decision, err = moderator.Check(ctx, "plan a picnic")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationAllow, decision.Action)
+	assert.Empty(t, decision.Categories)
+
+	// Categories cover their subcategories, and others aren't acted on
+	moderator, err = New(config.ModerationConfig{Provider: ProviderOpenAI, Action: models.ModerationFlag, Categories: []string{"violence"}, Endpoint: server.URL, APIKey: "sk-test"})
+	require.NoError(t, err)
+	decision, err = moderator.Check(ctx, "plan an attack")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationFlag, decision.Action)
+
+	moderator, err = New(config.ModerationConfig{Provider: ProviderOpenAI, Categories: []string{"hate"}, Endpoint: server.URL, APIKey: "sk-test"})
+	require.NoError(t, err)
+	decision, err = moderator.Check(ctx, "plan an attack")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationAllow, decision.Action)
+
+	// Any of several texts can be flagged, with the highest scores kept
+	moderator, err = New(config.ModerationConfig{Provider: ProviderOpenAI, Endpoint: server.URL, APIKey: "sk-test"})
+	require.NoError(t, err)
+	decision, err = moderator.Check(ctx, "plan a picnic", "plan an attack", "")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationReject, decision.Action)
+	assert.InDelta(t, 0.93, decision.Scores["violence/graphic"], 1e-9)
+}
+
+func TestModerator_SLM(t *testing.T) {
+	moderator, err := New(config.ModerationConfig{Provider: ProviderSLM})
+	require.NoError(t, err)
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetResponder(func(req *models.InferenceRequest) string {
+		if strings.Contains(req.Query, "how do I hurt someone") {
+			return "```json\n{\"flagged\": true, \"categories\": [\"Violence\", \"harassment\"]}\n```"
+		}
+		return `{"flagged": false, "categories": []}`
+	})
+	moderator.SetSLM(slm)
+	ctx := context.Background()
+
+	decision, err := moderator.Check(ctx, "how do I hurt someone")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationReject, decision.Action)
+	assert.Equal(t, []string{"harassment", "violence"}, decision.Categories)
+
+	decision, err = moderator.Check(ctx, "how do I bake bread")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationAllow, decision.Action)
+
+	// Several texts are judged in one call
+	decision, err = moderator.Check(ctx, "how do I bake bread", "how do I hurt someone")
+	require.NoError(t, err)
+	assert.Equal(t, models.ModerationReject, decision.Action)
+
+	calls := slm.Calls()
+	require.Len(t, calls, 3)
+	assert.Equal(t, "system", calls[0].Messages[0].Role)
+}
+
+func TestParseVerdict(t *testing.T) {
+	flagged, err := parseVerdict(`{"flagged": true, "categories": ["sexual/minors", "sexual"]}`)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"sexual", "sexual/minors"}, flagged)
+
+	flagged, err = parseVerdict(`{"flagged": false, "categories": []}`)
+	require.NoError(t, err)
+	assert.Empty(t, flagged)
+
+	for _, reply := range []string{
+		"unsafe",
+		"safe",
+		`{"categories": []}`,
+		`{"flagged": true, "categories": ["violent"]}`,
+		`{"flagged": false, "categories": ["violence"]}`,
+	} {
+		_, err := parseVerdict(reply)
+		assert.Error(t, err, reply)
+	}
+}
+
+func TestModerator_Failure(t *testing.T) {
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetError(errors.New("slm down"))
+	ctx := context.Background()
+
+	// Fails open by default
+	moderator, err := New(config.ModerationConfig{Provider: ProviderSLM})
+	require.NoError(t, err)
+	moderator.SetSLM(slm)
+	decision, err := moderator.Check(ctx, "hello")
+	assert.NoError(t, err)
+	assert.Nil(t, decision)
+
+	moderator, err = New(config.ModerationConfig{Provider: ProviderSLM, FailClosed: true})
+	require.NoError(t, err)
+	moderator.SetSLM(slm)
+	_, err = moderator.Check(ctx, "hello")
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestNew(t *testing.T) {
+	moderator, err := New(config.ModerationConfig{Provider: ProviderOff})
+	require.NoError(t, err)
+	assert.Nil(t, moderator)
+	decision, err := moderator.Check(context.Background(), "anything")
+	assert.NoError(t, err)
+	assert.Nil(t, decision)
+
+	_, err = New(config.ModerationConfig{Provider: ProviderOpenAI})
+	assert.Error(t, err)
+	_, err = New(config.ModerationConfig{Provider: "perspective"})
+	assert.Error(t, err)
+	_, err = New(config.ModerationConfig{Provider: ProviderSLM, Action: "block"})
+	assert.Error(t, err)
+}
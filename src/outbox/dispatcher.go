@@ -0,0 +1,274 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const (
+	defaultBatchSize     = 100
+	defaultRetryInterval = 30 * time.Second
+
+	readBlock = 5 * time.Second // Longest wait for new events before checking for retries
+)
+
+// SinkStatus is a sink's progress through the stream
+type SinkStatus struct {
+	Name    string   `json:"name"`
+	Types   []string `json:"types,omitempty"` // Event types delivered; all when empty
+	Pending int64    `json:"pending"`         // Read but not yet delivered
+	Lag     int64    `json:"lag"`             // Not read yet
+}
+
+// Dispatcher delivers the stream's events to one sink through the sink's
+// consumer group. Every instance of the server runs a dispatcher per sink and
+// the group shares the events out between them. Events are acknowledged once
+// the sink takes them; failed ones stay pending and are claimed again, by any
+// instance, after the retry interval.
+type Dispatcher struct {
+	client        *redis.Client
+	stream        string
+	name          string
+	consumer      string
+	sink          Sink
+	types         []string
+	batchSize     int64
+	retryInterval time.Duration
+}
+
+// NewDispatcher creates the dispatcher of sinkCfg, one of the sinks in cfg
+func NewDispatcher(client *redis.Client, cfg config.OutboxConfig, sinkCfg config.OutboxSinkConfig, sink Sink) *Dispatcher {
+	d := &Dispatcher{
+		client:        client,
+		stream:        cfg.Stream,
+		name:          sinkCfg.Name,
+		consumer:      consumerName(),
+		sink:          sink,
+		types:         sinkCfg.Types,
+		batchSize:     int64(cfg.BatchSize),
+		retryInterval: cfg.RetryInterval,
+	}
+	if d.stream == "" {
+		d.stream = defaultStream
+	}
+	if d.batchSize <= 0 {
+		d.batchSize = defaultBatchSize
+	}
+	if d.retryInterval <= 0 {
+		d.retryInterval = defaultRetryInterval
+	}
+	return d
+}
+
+// Name returns the sink's name, which is also its consumer group
+func (d *Dispatcher) Name() string {
+	return d.name
+}
+
+// consumerName identifies this instance within the consumer groups
+func consumerName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "hybridlm"
+	}
+	return host + "-" + strconv.Itoa(os.Getpid())
+}
+
+// Run delivers events until ctx is done. A sink's first run starts with the
+// events published from then on; older ones can be sent with Replay.
+func (d *Dispatcher) Run(ctx context.Context) {
+	if err := d.createGroup(ctx); err != nil {
+		log.Printf("⚠️  Outbox sink %s stopped: %v", d.name, err)
+		return
+	}
+
+	for ctx.Err() == nil {
+		if _, err := d.RetryFailed(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Outbox sink %s failed to retry events: %v", d.name, err)
+		}
+		if _, err := d.deliverNew(ctx, readBlock); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Outbox sink %s failed to deliver events: %v", d.name, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}
+}
+
+func (d *Dispatcher) createGroup(ctx context.Context) error {
+	err := d.client.XGroupCreateMkStream(ctx, d.stream, d.name, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create consumer group: %w", err)
+	}
+	return nil
+}
+
+// deliverNew reads the next batch of events no instance has read yet,
+// waiting up to block for one, and delivers it. It returns how many events
+// were delivered.
+func (d *Dispatcher) deliverNew(ctx context.Context, block time.Duration) (int, error) {
+	streams, err := d.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    d.name,
+		Consumer: d.consumer,
+		Streams:  []string{d.stream, ">"},
+		Count:    d.batchSize,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, stream := range streams {
+		n, err := d.deliver(ctx, stream.Messages)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+	}
+	return delivered, nil
+}
+
+// RetryFailed claims the events that have been pending for longer than the
+// retry interval, on this or another instance, and delivers them again. It
+// returns how many events were delivered.
+func (d *Dispatcher) RetryFailed(ctx context.Context) (int, error) {
+	delivered := 0
+	start := "0-0"
+	for {
+		messages, next, err := d.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   d.stream,
+			Group:    d.name,
+			Consumer: d.consumer,
+			MinIdle:  d.retryInterval,
+			Start:    start,
+			Count:    d.batchSize,
+		}).Result()
+		if err != nil {
+			return delivered, err
+		}
+
+		n, err := d.deliver(ctx, messages)
+		delivered += n
+		if err != nil {
+			return delivered, err
+		}
+		if next == "0-0" {
+			return delivered, nil
+		}
+		start = next
+	}
+}
+
+// deliver sends the sink's types of events among messages and acknowledges
+// all of them. Entries that can't be decoded are logged and acknowledged, as
+// no retry will fix them.
+func (d *Dispatcher) deliver(ctx context.Context, messages []redis.XMessage) (int, error) {
+	if len(messages) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, len(messages))
+	var events []Event
+	for i, message := range messages {
+		ids[i] = message.ID
+		if eventType, _ := message.Values["type"].(string); !d.accepts(eventType) {
+			continue
+		}
+		event, err := decodeEvent(message)
+		if err != nil {
+			log.Printf("⚠️  Outbox sink %s skipped an event: %v", d.name, err)
+			continue
+		}
+		events = append(events, event)
+	}
+
+	if len(events) > 0 {
+		if err := d.sink.Deliver(ctx, events); err != nil {
+			return 0, err
+		}
+	}
+	if err := d.client.XAck(ctx, d.stream, d.name, ids...).Err(); err != nil {
+		return len(events), fmt.Errorf("failed to acknowledge events: %w", err)
+	}
+	return len(events), nil
+}
+
+func (d *Dispatcher) accepts(eventType string) bool {
+	return len(d.types) == 0 || slices.Contains(d.types, eventType)
+}
+
+// Replay sends the sink the events published between since and until that
+// are still in the stream, without affecting the consumer group. A zero
+// until replays up to the newest event. It returns how many were sent.
+func (d *Dispatcher) Replay(ctx context.Context, since time.Time, until time.Time) (int, error) {
+	start := strconv.FormatInt(since.UnixMilli(), 10)
+	end := "+"
+	if !until.IsZero() {
+		end = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+
+	replayed := 0
+	for {
+		messages, err := d.client.XRangeN(ctx, d.stream, start, end, d.batchSize).Result()
+		if err != nil {
+			return replayed, fmt.Errorf("failed to read events: %w", err)
+		}
+		if len(messages) == 0 {
+			return replayed, nil
+		}
+
+		var events []Event
+		for _, message := range messages {
+			if eventType, _ := message.Values["type"].(string); !d.accepts(eventType) {
+				continue
+			}
+			if event, err := decodeEvent(message); err == nil {
+				events = append(events, event)
+			}
+		}
+		if len(events) > 0 {
+			if err := d.sink.Deliver(ctx, events); err != nil {
+				return replayed, fmt.Errorf("failed to deliver events: %w", err)
+			}
+			replayed += len(events)
+		}
+
+		if int64(len(messages)) < d.batchSize {
+			return replayed, nil
+		}
+		// Continue after the last entry read
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
+
+// Status returns how far the sink is behind the stream
+func (d *Dispatcher) Status(ctx context.Context) (*SinkStatus, error) {
+	status := &SinkStatus{Name: d.name, Types: d.types}
+
+	groups, err := d.client.XInfoGroups(ctx, d.stream).Result()
+	if err != nil && !strings.Contains(err.Error(), "no such key") {
+		return nil, fmt.Errorf("failed to get outbox status: %w", err)
+	}
+	for _, group := range groups {
+		if group.Name == d.name {
+			status.Pending = group.Pending
+			status.Lag = group.Lag
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,175 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSSink publishes each event to the subject <topic>.<type>.<action>, like
+// hybridlm.request.completed, over the NATS client protocol. A batch counts as
+// delivered once the server has answered the PING sent after it, so it was
+// accepted; subjects captured by a JetStream stream are also persisted.
+type NATSSink struct {
+	address string
+	user    string
+	pass    string
+	token   string
+	topic   string
+	timeout time.Duration
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// natsConnect is the CONNECT options sent after the server's INFO
+type natsConnect struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	Version   string `json:"version"`
+	Protocol  int    `json:"protocol"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// newNATSSink parses a nats://[user:pass@ or token@]host:port URL
+func newNATSSink(rawURL string, topic string, timeout time.Duration) (*NATSSink, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "nats" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid NATS url %q, expected nats://host:port", rawURL)
+	}
+
+	sink := &NATSSink{address: parsed.Host, topic: topic, timeout: timeout}
+	if parsed.Port() == "" {
+		sink.address = net.JoinHostPort(parsed.Hostname(), "4222")
+	}
+	if parsed.User != nil {
+		if pass, ok := parsed.User.Password(); ok {
+			sink.user, sink.pass = parsed.User.Username(), pass
+		} else {
+			sink.token = parsed.User.Username()
+		}
+	}
+	return sink, nil
+}
+
+func (s *NATSSink) Deliver(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if err := s.connect(ctx); err != nil {
+			return err
+		}
+	}
+	if err := s.publish(ctx, events); err != nil {
+		// Start over on a new connection next time
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+func (s *NATSSink) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: s.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", s.address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	conn.SetDeadline(time.Now().Add(s.timeout))
+	reader := bufio.NewReader(conn)
+
+	info, err := reader.ReadString('\n')
+	if err != nil || !strings.HasPrefix(info, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected NATS greeting %q: %v", strings.TrimSpace(info), err)
+	}
+
+	options, err := json.Marshal(natsConnect{
+		Name:      "hybridlm-outbox",
+		Lang:      "go",
+		Version:   "1",
+		Protocol:  1,
+		User:      s.user,
+		Pass:      s.pass,
+		AuthToken: s.token,
+	})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to encode NATS options: %w", err)
+	}
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\n", options); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+
+	s.conn, s.reader = conn, reader
+	return nil
+}
+
+// publish sends every event followed by a PING and waits for the PONG, which
+// the server only sends after processing what came before it
+func (s *NATSSink) publish(ctx context.Context, events []Event) error {
+	deadline := time.Now().Add(s.timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	s.conn.SetDeadline(deadline)
+
+	writer := bufio.NewWriter(s.conn)
+	for _, event := range events {
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+		fmt.Fprintf(writer, "PUB %s %d\r\n", s.subject(event), len(payload))
+		writer.Write(payload)
+		writer.WriteString("\r\n")
+	}
+	writer.WriteString("PING\r\n")
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to publish to NATS: %w", err)
+	}
+
+	for {
+		line, err := s.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read NATS reply: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case line == "PING":
+			if _, err := s.conn.Write([]byte("PONG\r\n")); err != nil {
+				return fmt.Errorf("failed to answer NATS ping: %w", err)
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.New("NATS " + strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// +OK and INFO updates need no answer
+	}
+}
+
+func (s *NATSSink) subject(event Event) string {
+	subject := event.Type
+	if event.Action != "" {
+		subject += "." + event.Action
+	}
+	if s.topic != "" {
+		subject = s.topic + "." + subject
+	}
+	return subject
+}
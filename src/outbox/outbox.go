@@ -0,0 +1,199 @@
+// Package outbox records usage, billing, audit, request and annotation events
+// in a Redis stream and delivers them to external sinks. Events are appended
+// in the same transaction as the change they describe where possible, and
+// each sink reads the stream through its own consumer group, so every event
+// is delivered at least once and can be replayed while the stream retains it.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const (
+	TypeUsage      = "usage"      // A request was served
+	TypeBilling    = "billing"    // A request cost money
+	TypeAudit      = "audit"      // A user or admin changed something
+	TypeRequest    = "request"    // A model request was routed, served or turned away
+	TypeAlert      = "alert"      // Something needs an operator's or org owner's attention
+	TypeAnnotation = "annotation" // A reviewer annotated a past response
+
+	defaultStream = "outbox:events"
+	defaultMaxLen = 100000
+)
+
+// Event is one outbox entry as delivered to sinks
+type Event struct {
+	ID        string          `json:"id"`     // Stream entry ID: unique, increasing, and the same on every redelivery
+	Type      string          `json:"type"`   // usage, billing, audit, request, alert or annotation
+	Action    string          `json:"action"` // What happened, like "request" or "api_key.created"
+	UserID    string          `json:"user_id,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Data      json.RawMessage `json:"data,omitempty"`
+}
+
+// Outbox appends events to the stream
+type Outbox struct {
+	client *redis.Client
+	stream string
+	maxLen int64
+	clock  clock.Clock
+}
+
+func NewOutbox(client *redis.Client, cfg config.OutboxConfig) *Outbox {
+	o := &Outbox{
+		client: client,
+		stream: cfg.Stream,
+		maxLen: cfg.MaxLen,
+		clock:  clock.Real(),
+	}
+	if o.stream == "" {
+		o.stream = defaultStream
+	}
+	if o.maxLen <= 0 {
+		o.maxLen = defaultMaxLen
+	}
+	return o
+}
+
+// SetClock sets the clock that timestamps events
+func (o *Outbox) SetClock(c clock.Clock) {
+	o.clock = c
+}
+
+// Publish appends an event on its own. data is encoded as JSON. A nil outbox
+// publishes nothing.
+func (o *Outbox) Publish(ctx context.Context, eventType string, action string, userID string, data any) error {
+	if o == nil {
+		return nil
+	}
+
+	args, err := o.entry(eventType, action, userID, data)
+	if err != nil {
+		return err
+	}
+	if err := o.client.XAdd(ctx, args).Err(); err != nil {
+		return fmt.Errorf("failed to publish %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// Append queues an event on pipe, so it is only recorded if the transaction
+// it describes is. A nil outbox appends nothing.
+func (o *Outbox) Append(ctx context.Context, pipe redis.Pipeliner, eventType string, action string, userID string, data any) error {
+	if o == nil {
+		return nil
+	}
+
+	args, err := o.entry(eventType, action, userID, data)
+	if err != nil {
+		return err
+	}
+	pipe.XAdd(ctx, args)
+	return nil
+}
+
+func (o *Outbox) entry(eventType string, action string, userID string, data any) (*redis.XAddArgs, error) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+	event, err := json.Marshal(Event{
+		Type:      eventType,
+		Action:    action,
+		UserID:    userID,
+		Timestamp: o.clock.Now().UTC(),
+		Data:      encoded,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	// The oldest events are trimmed once the stream is over its length, which
+	// bounds how far back events can be replayed
+	return &redis.XAddArgs{
+		Stream: o.stream,
+		MaxLen: o.maxLen,
+		Approx: true,
+		Values: []interface{}{"type", eventType, "event", event},
+	}, nil
+}
+
+// Read returns up to count events published after the event with ID after,
+// oldest first, or from the oldest one still in the stream when after is empty
+func (o *Outbox) Read(ctx context.Context, after string, count int64) ([]Event, error) {
+	start := "-"
+	if after != "" {
+		start = "(" + after
+	}
+	messages, err := o.client.XRangeN(ctx, o.stream, start, "+", count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	events := make([]Event, 0, len(messages))
+	for _, message := range messages {
+		event, err := decodeEvent(message)
+		if err != nil {
+			// Keep the ID so readers can move past it
+			event = Event{ID: message.ID}
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// Range calls fn with each page of up to count events published between
+// since and until that are still in the stream, oldest first. A zero until
+// reads up to the newest event.
+func (o *Outbox) Range(ctx context.Context, since time.Time, until time.Time, count int64, fn func([]Event) error) error {
+	start := strconv.FormatInt(since.UnixMilli(), 10)
+	end := "+"
+	if !until.IsZero() {
+		end = strconv.FormatInt(until.UnixMilli(), 10)
+	}
+
+	for {
+		messages, err := o.client.XRangeN(ctx, o.stream, start, end, count).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read events: %w", err)
+		}
+		if len(messages) == 0 {
+			return nil
+		}
+
+		events := make([]Event, 0, len(messages))
+		for _, message := range messages {
+			if event, err := decodeEvent(message); err == nil {
+				events = append(events, event)
+			}
+		}
+		if err := fn(events); err != nil {
+			return err
+		}
+
+		if int64(len(messages)) < count {
+			return nil
+		}
+		start = "(" + messages[len(messages)-1].ID
+	}
+}
+
+// decodeEvent turns a stream entry back into its event
+func decodeEvent(message redis.XMessage) (Event, error) {
+	var event Event
+	raw, _ := message.Values["event"].(string)
+	if err := json.Unmarshal([]byte(raw), &event); err != nil {
+		return Event{}, fmt.Errorf("failed to decode event %s: %w", message.ID, err)
+	}
+	event.ID = message.ID
+	return event, nil
+}
@@ -0,0 +1,187 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+// recordingSink keeps what it is sent and fails while err is set
+type recordingSink struct {
+	mu     sync.Mutex
+	err    error
+	events []Event
+}
+
+func (s *recordingSink) Deliver(ctx context.Context, events []Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.events = append(s.events, events...)
+	return nil
+}
+
+func (s *recordingSink) actions() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	actions := make([]string, len(s.events))
+	for i, event := range s.events {
+		actions[i] = event.Action
+	}
+	return actions
+}
+
+func setupOutbox(t *testing.T) (*Outbox, *redis.Client, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	mr.SetTime(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return NewOutbox(client, config.OutboxConfig{}), client, mr
+}
+
+func newTestDispatcher(t *testing.T, client *redis.Client, sink Sink, types ...string) *Dispatcher {
+	d := NewDispatcher(client, config.OutboxConfig{RetryInterval: time.Minute}, config.OutboxSinkConfig{Name: "test", Types: types}, sink)
+	require.NoError(t, d.createGroup(context.Background()))
+	return d
+}
+
+func TestDispatcher_DeliversAtLeastOnce(t *testing.T) {
+	o, client, mr := setupOutbox(t)
+	sink := &recordingSink{err: errors.New("sink down")}
+	d := newTestDispatcher(t, client, sink)
+	ctx := context.Background()
+
+	require.NoError(t, o.Publish(ctx, TypeAudit, "login", "alice", map[string]string{"method": "session"}))
+	require.NoError(t, o.Publish(ctx, TypeAudit, "logout", "alice", nil))
+
+	// A failed batch stays pending
+	_, err := d.deliverNew(ctx, time.Millisecond)
+	assert.Error(t, err)
+	status, err := d.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), status.Pending)
+
+	// and isn't retried before the retry interval
+	sink.err = nil
+	delivered, err := d.RetryFailed(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, delivered)
+
+	mr.SetTime(time.Date(2026, 10, 1, 12, 1, 0, 0, time.UTC))
+	delivered, err = d.RetryFailed(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, delivered)
+	assert.Equal(t, []string{"login", "logout"}, sink.actions())
+	assert.Equal(t, "alice", sink.events[0].UserID)
+	assert.JSONEq(t, `{"method":"session"}`, string(sink.events[0].Data))
+	assert.NotEmpty(t, sink.events[0].ID)
+
+	status, err = d.Status(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, status.Pending)
+}
+
+func TestDispatcher_FiltersTypes(t *testing.T) {
+	o, client, _ := setupOutbox(t)
+	sink := &recordingSink{}
+	d := newTestDispatcher(t, client, sink, TypeBilling)
+	ctx := context.Background()
+
+	require.NoError(t, o.Publish(ctx, TypeUsage, "request", "alice", nil))
+	require.NoError(t, o.Publish(ctx, TypeBilling, "charge", "alice", nil))
+
+	delivered, err := d.deliverNew(ctx, time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, 1, delivered)
+	assert.Equal(t, []string{"charge"}, sink.actions())
+
+	// Skipped events are acknowledged too
+	status, err := d.Status(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, status.Pending)
+}
+
+func TestDispatcher_Replay(t *testing.T) {
+	o, client, mr := setupOutbox(t)
+	sink := &recordingSink{}
+	d := newTestDispatcher(t, client, sink)
+	d.batchSize = 2
+	ctx := context.Background()
+
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, action := range []string{"one", "two", "three", "four"} {
+		mr.SetTime(start.Add(time.Duration(i) * time.Hour))
+		require.NoError(t, o.Publish(ctx, TypeAudit, action, "alice", nil))
+	}
+	_, err := d.deliverNew(ctx, time.Millisecond)
+	require.NoError(t, err)
+	sink.events = nil
+
+	replayed, err := d.Replay(ctx, start.Add(time.Hour), start.Add(3*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 3, replayed)
+	assert.Equal(t, []string{"two", "three", "four"}, sink.actions())
+
+	sink.events = nil
+	replayed, err = d.Replay(ctx, start.Add(2*time.Hour), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, replayed)
+	assert.Equal(t, []string{"three", "four"}, sink.actions())
+}
+
+func TestOutbox_NilPublishesNothing(t *testing.T) {
+	var o *Outbox
+	assert.NoError(t, o.Publish(context.Background(), TypeAudit, "login", "alice", nil))
+}
+
+func TestOutbox_Read(t *testing.T) {
+	o, _, _ := setupOutbox(t)
+	ctx := context.Background()
+	for _, action := range []string{"one", "two", "three"} {
+		require.NoError(t, o.Publish(ctx, TypeAudit, action, "alice", nil))
+	}
+
+	events, err := o.Read(ctx, "", 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, "one", events[0].Action)
+
+	events, err = o.Read(ctx, events[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "three", events[0].Action)
+}
+
+func TestOutbox_Range(t *testing.T) {
+	o, _, mr := setupOutbox(t)
+	ctx := context.Background()
+	start := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	for i, action := range []string{"one", "two", "three", "four"} {
+		mr.SetTime(start.Add(time.Duration(i) * time.Minute))
+		require.NoError(t, o.Publish(ctx, TypeAudit, action, "alice", nil))
+	}
+
+	var actions []string
+	pages := 0
+	err := o.Range(ctx, start.Add(time.Minute), start.Add(2*time.Minute), 1, func(events []Event) error {
+		pages++
+		for _, event := range events {
+			actions = append(actions, event.Action)
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"two", "three"}, actions)
+	assert.Equal(t, 2, pages, "empty pages are not passed on")
+}
@@ -0,0 +1,174 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/hooks"
+)
+
+const (
+	SinkWebhook = "webhook"
+	SinkFile    = "file"
+	SinkKafka   = "kafka"
+	SinkNATS    = "nats"
+
+	defaultSinkTimeout = 10 * time.Second
+	kafkaContentType   = "application/vnd.kafka.json.v2+json"
+)
+
+// Sink delivers a batch of events. A batch is delivered again if Deliver
+// fails, so sinks should tolerate duplicates, which share an event ID.
+type Sink interface {
+	Deliver(ctx context.Context, events []Event) error
+}
+
+// NewSink creates the sink described by cfg
+func NewSink(cfg config.OutboxSinkConfig) (Sink, error) {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = defaultSinkTimeout
+	}
+
+	switch cfg.Type {
+	case SinkWebhook:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("outbox sink %s needs a url", cfg.Name)
+		}
+		return &WebhookSink{url: cfg.URL, secret: []byte(cfg.Secret), client: &http.Client{Timeout: timeout}}, nil
+	case SinkFile:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("outbox sink %s needs a path", cfg.Name)
+		}
+		return &FileSink{path: cfg.Path}, nil
+	case SinkKafka:
+		if cfg.URL == "" || cfg.Topic == "" {
+			return nil, fmt.Errorf("outbox sink %s needs the Kafka REST Proxy url and a topic", cfg.Name)
+		}
+		return &KafkaSink{
+			endpoint: cfg.URL + "/topics/" + url.PathEscape(cfg.Topic),
+			client:   &http.Client{Timeout: timeout},
+		}, nil
+	case SinkNATS:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("outbox sink %s needs a nats:// url", cfg.Name)
+		}
+		return newNATSSink(cfg.URL, cfg.Topic, timeout)
+	default:
+		return nil, fmt.Errorf("outbox sink %s has unknown type %q", cfg.Name, cfg.Type)
+	}
+}
+
+// WebhookSink POSTs each batch as {"events": [...]}, signed like hook
+// webhooks when a secret is set. Any answer other than 2xx fails the batch.
+type WebhookSink struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func (s *WebhookSink) Deliver(ctx context.Context, events []Event) error {
+	body, err := json.Marshal(map[string][]Event{"events": events})
+	if err != nil {
+		return fmt.Errorf("failed to encode events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		req.Header.Set(hooks.SignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+	}
+	return post(s.client, req)
+}
+
+// KafkaSink produces each event to a topic through a Kafka REST Proxy (v2 API),
+// keyed by user so a user's events stay in one partition
+type KafkaSink struct {
+	endpoint string
+	client   *http.Client
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key,omitempty"`
+	Value Event  `json:"value"`
+}
+
+func (s *KafkaSink) Deliver(ctx context.Context, events []Event) error {
+	records := make([]kafkaRecord, len(events))
+	for i, event := range events {
+		records[i] = kafkaRecord{Key: event.UserID, Value: event}
+	}
+	body, err := json.Marshal(map[string][]kafkaRecord{"records": records})
+	if err != nil {
+		return fmt.Errorf("failed to encode events: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create Kafka request: %w", err)
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+	return post(s.client, req)
+}
+
+func post(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// FileSink appends events to a file as JSON lines
+type FileSink struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (s *FileSink) Deliver(ctx context.Context, events []Event) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", s.path, err)
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", s.path, err)
+	}
+	// Acknowledged events must survive a crash
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync %s: %w", s.path, err)
+	}
+	return file.Close()
+}
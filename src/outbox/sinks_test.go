@@ -0,0 +1,169 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/hooks"
+)
+
+var testEvents = []Event{
+	{ID: "1-0", Type: TypeUsage, Action: "request", UserID: "alice"},
+	{ID: "2-0", Type: TypeBilling, Action: "charge", UserID: "bob"},
+}
+
+func TestWebhookSink(t *testing.T) {
+	var body []byte
+	var signature string
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(hooks.SignatureHeader)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(config.OutboxSinkConfig{Name: "hook", Type: SinkWebhook, URL: server.URL, Secret: "s3cret"})
+	require.NoError(t, err)
+	require.NoError(t, sink.Deliver(context.Background(), testEvents))
+
+	var payload struct {
+		Events []Event `json:"events"`
+	}
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Len(t, payload.Events, 2)
+	assert.Len(t, signature, 64)
+
+	status = http.StatusServiceUnavailable
+	assert.Error(t, sink.Deliver(context.Background(), testEvents))
+}
+
+func TestKafkaSink(t *testing.T) {
+	var path, contentType string
+	var payload struct {
+		Records []struct {
+			Key   string `json:"key"`
+			Value Event  `json:"value"`
+		} `json:"records"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	sink, err := NewSink(config.OutboxSinkConfig{Name: "kafka", Type: SinkKafka, URL: server.URL, Topic: "hybridlm.events"})
+	require.NoError(t, err)
+	require.NoError(t, sink.Deliver(context.Background(), testEvents))
+
+	assert.Equal(t, "/topics/hybridlm.events", path)
+	assert.Equal(t, kafkaContentType, contentType)
+	require.Len(t, payload.Records, 2)
+	assert.Equal(t, "bob", payload.Records[1].Key)
+	assert.Equal(t, "charge", payload.Records[1].Value.Action)
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	sink, err := NewSink(config.OutboxSinkConfig{Name: "file", Type: SinkFile, Path: path})
+	require.NoError(t, err)
+
+	require.NoError(t, sink.Deliver(context.Background(), testEvents[:1]))
+	require.NoError(t, sink.Deliver(context.Background(), testEvents[1:]))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, "2-0", event.ID)
+}
+
+func TestNewSink_Validates(t *testing.T) {
+	_, err := NewSink(config.OutboxSinkConfig{Name: "x", Type: "carrier-pigeon"})
+	assert.ErrorContains(t, err, "unknown type")
+	_, err = NewSink(config.OutboxSinkConfig{Name: "x", Type: SinkKafka, URL: "http://kafka-rest"})
+	assert.ErrorContains(t, err, "topic")
+	_, err = NewSink(config.OutboxSinkConfig{Name: "x", Type: SinkNATS, URL: "tcp://nats:4222"})
+	assert.ErrorContains(t, err, "nats://")
+}
+
+func TestNATSSink(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	received := make(chan []string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+
+		var lines []string
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			if line == "PING" {
+				conn.Write([]byte("PONG\r\n"))
+				received <- lines
+				return
+			}
+			lines = append(lines, line)
+		}
+	}()
+
+	sink, err := NewSink(config.OutboxSinkConfig{Name: "bus", Type: SinkNATS, URL: "nats://user:pw@" + listener.Addr().String(), Topic: "hybridlm"})
+	require.NoError(t, err)
+	require.NoError(t, sink.Deliver(context.Background(), testEvents))
+
+	lines := <-received
+	require.Len(t, lines, 5)
+	assert.Contains(t, lines[0], `"user":"user"`)
+	assert.Contains(t, lines[0], `"pass":"pw"`)
+	assert.True(t, strings.HasPrefix(lines[1], "PUB hybridlm.usage.request "))
+	assert.True(t, strings.HasPrefix(lines[3], "PUB hybridlm.billing.charge "))
+	var event Event
+	require.NoError(t, json.Unmarshal([]byte(lines[4]), &event))
+	assert.Equal(t, "2-0", event.ID)
+}
+
+func TestNATSSink_ServerError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("INFO {}\r\n-ERR 'Authorization Violation'\r\n"))
+		io.Copy(io.Discard, conn)
+	}()
+
+	sink, err := NewSink(config.OutboxSinkConfig{Name: "bus", Type: SinkNATS, URL: "nats://" + listener.Addr().String()})
+	require.NoError(t, err)
+	assert.ErrorContains(t, sink.Deliver(context.Background(), testEvents), "Authorization Violation")
+}
@@ -0,0 +1,159 @@
+// Package preferences stores users' privacy settings, which the analytics,
+// evaluation and export code paths check before using a user's requests.
+package preferences
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	preferencesKeyPrefix = "user_prefs:"
+	cacheTTL             = 30 * time.Second // How long another instance may take to see a change
+)
+
+type cached struct {
+	prefs    models.UserPreferences
+	loadedAt time.Time
+}
+
+// Store keeps preferences in Redis, with a short-lived local copy because
+// they are checked on every request
+type Store struct {
+	client *redis.Client
+	clock  clock.Clock
+
+	mu    sync.Mutex
+	cache map[string]cached
+}
+
+func NewStore(client *redis.Client) *Store {
+	return &Store{
+		client: client,
+		clock:  clock.Real(),
+		cache:  make(map[string]cached),
+	}
+}
+
+// SetClock sets the clock that expires cached preferences
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Get returns the user's preferences, the defaults if they never set any
+func (s *Store) Get(ctx context.Context, userID string) (*models.UserPreferences, error) {
+	s.mu.Lock()
+	entry, ok := s.cache[userID]
+	s.mu.Unlock()
+	if ok && s.clock.Now().Sub(entry.loadedAt) < cacheTTL {
+		prefs := entry.prefs
+		return &prefs, nil
+	}
+
+	var prefs models.UserPreferences
+	data, err := s.client.Get(ctx, preferencesKeyPrefix+userID).Bytes()
+	if err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get preferences: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &prefs); err != nil {
+			return nil, fmt.Errorf("failed to decode preferences: %w", err)
+		}
+	}
+
+	s.remember(userID, prefs)
+	return &prefs, nil
+}
+
+// Update changes the settings set in update and returns the result
+func (s *Store) Update(ctx context.Context, userID string, update models.UpdatePreferencesRequest) (*models.UserPreferences, error) {
+	key := preferencesKeyPrefix + userID
+	var prefs models.UserPreferences
+
+	// Optimistic locking keeps concurrent updates of different settings
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		prefs = models.UserPreferences{}
+		data, err := tx.Get(ctx, key).Bytes()
+		if err != nil && err != redis.Nil {
+			return fmt.Errorf("failed to get preferences: %w", err)
+		}
+		if err == nil {
+			if err := json.Unmarshal(data, &prefs); err != nil {
+				return fmt.Errorf("failed to decode preferences: %w", err)
+			}
+		}
+
+		apply(&prefs.ShadowEvaluationOptOut, update.ShadowEvaluationOptOut)
+		apply(&prefs.AnalyticsOptOut, update.AnalyticsOptOut)
+		apply(&prefs.TrainingExportOptOut, update.TrainingExportOptOut)
+		prefs.UpdatedAt = s.clock.Now()
+
+		data, err = json.Marshal(prefs)
+		if err != nil {
+			return fmt.Errorf("failed to encode preferences: %w", err)
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, 0)
+			return nil
+		})
+		return err
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update preferences: %w", err)
+	}
+
+	s.remember(userID, prefs)
+	return &prefs, nil
+}
+
+func apply(setting *bool, value *bool) {
+	if value != nil {
+		*setting = *value
+	}
+}
+
+func (s *Store) remember(userID string, prefs models.UserPreferences) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cache[userID] = cached{prefs: prefs, loadedAt: s.clock.Now()}
+}
+
+// AnalyticsAllowed reports whether the user's queries may be counted in
+// retained statistics. Without a store everyone is counted; if the
+// preferences can't be read nobody is.
+func (s *Store) AnalyticsAllowed(ctx context.Context, userID string) bool {
+	return s.allowed(ctx, userID, func(p *models.UserPreferences) bool { return p.AnalyticsOptOut })
+}
+
+// TrainingExportAllowed reports whether the user's requests may be exported
+// for training, like AnalyticsAllowed
+func (s *Store) TrainingExportAllowed(ctx context.Context, userID string) bool {
+	return s.allowed(ctx, userID, func(p *models.UserPreferences) bool { return p.TrainingExportOptOut })
+}
+
+// ShadowEvaluationAllowed reports whether the user may be put in percentage
+// rollouts of features still being evaluated, like AnalyticsAllowed
+func (s *Store) ShadowEvaluationAllowed(ctx context.Context, userID string) bool {
+	return s.allowed(ctx, userID, func(p *models.UserPreferences) bool { return p.ShadowEvaluationOptOut })
+}
+
+func (s *Store) allowed(ctx context.Context, userID string, optedOut func(*models.UserPreferences) bool) bool {
+	if s == nil {
+		return true
+	}
+	prefs, err := s.Get(ctx, userID)
+	if err != nil {
+		log.Printf("Failed to check preferences of %s, treating as opted out: %v", userID, err)
+		return false
+	}
+	return !optedOut(prefs)
+}
@@ -0,0 +1,72 @@
+package preferences
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupStore(t *testing.T, fakeClock *clock.Fake) (*Store, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	store := NewStore(client)
+	store.SetClock(fakeClock)
+	return store, mr
+}
+
+func TestStore_UpdateKeepsUnsetSettings(t *testing.T) {
+	store, _ := setupStore(t, clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)))
+	ctx := context.Background()
+
+	prefs, err := store.Get(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, models.UserPreferences{}, *prefs, "everyone takes part by default")
+
+	optOut, optIn := true, false
+	_, err = store.Update(ctx, "alice", models.UpdatePreferencesRequest{AnalyticsOptOut: &optOut, TrainingExportOptOut: &optOut})
+	require.NoError(t, err)
+	prefs, err = store.Update(ctx, "alice", models.UpdatePreferencesRequest{TrainingExportOptOut: &optIn})
+	require.NoError(t, err)
+
+	assert.True(t, prefs.AnalyticsOptOut)
+	assert.False(t, prefs.TrainingExportOptOut)
+	assert.False(t, store.AnalyticsAllowed(ctx, "alice"))
+	assert.True(t, store.TrainingExportAllowed(ctx, "alice"))
+	assert.True(t, store.AnalyticsAllowed(ctx, "bob"))
+}
+
+func TestStore_PicksUpChangesFromOtherInstances(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	store, mr := setupStore(t, fakeClock)
+	other := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	ctx := context.Background()
+
+	assert.True(t, store.ShadowEvaluationAllowed(ctx, "alice"))
+
+	optOut := true
+	_, err := other.Update(ctx, "alice", models.UpdatePreferencesRequest{ShadowEvaluationOptOut: &optOut})
+	require.NoError(t, err)
+	assert.True(t, store.ShadowEvaluationAllowed(ctx, "alice"), "served from the local copy for a while")
+
+	fakeClock.Advance(cacheTTL)
+	assert.False(t, store.ShadowEvaluationAllowed(ctx, "alice"))
+}
+
+func TestStore_UnreadablePreferencesOptOut(t *testing.T) {
+	store, mr := setupStore(t, clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)))
+	mr.SetError("connection refused")
+
+	assert.False(t, store.AnalyticsAllowed(context.Background(), "alice"))
+
+	var noStore *Store
+	assert.True(t, noStore.AnalyticsAllowed(context.Background(), "alice"))
+}
@@ -0,0 +1,157 @@
+// Package privacy keeps personal data out of queries sent to the cloud LLM:
+// emails, phone numbers, credit cards and API keys are detected, then logged,
+// replaced with placeholders restored in the answer, or refused.
+package privacy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Kinds of personal data detected
+const (
+	KindEmail      = "email"
+	KindPhone      = "phone"
+	KindCreditCard = "credit_card"
+	KindAPIKey     = "api_key"
+)
+
+// Kinds lists every kind detected, in the order they're looked for
+var Kinds = []string{KindAPIKey, KindEmail, KindCreditCard, KindPhone}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*\.[A-Za-z]{2,}`)
+	// Runs of 13-19 digits, optionally grouped by spaces or dashes
+	cardPattern = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+	// Runs of digits with the separators phone numbers are written with
+	phonePattern = regexp.MustCompile(`(?:\+|\b)\d[\d ().-]{6,}\d\b`)
+	// Keys with well-known prefixes
+	apiKeyPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{20,}`),
+		regexp.MustCompile(`\b(?:gsk|ghp|gho|ghs|github_pat|xoxb|xoxp|glpat)[_-][A-Za-z0-9_-]{16,}`),
+		regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`),
+		regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`),
+	}
+	// Other long tokens, kept if they look random
+	tokenPattern = regexp.MustCompile(`\b[A-Za-z0-9_-]{32,}\b`)
+)
+
+// Finding is personal data found in a text
+type Finding struct {
+	Kind  string
+	Value string
+	Start int
+	End   int
+}
+
+// Detector finds the kinds of personal data it's configured for
+type Detector struct {
+	kinds []string
+}
+
+// NewDetector finds kinds, or every kind when it's empty
+func NewDetector(kinds []string) (*Detector, error) {
+	for _, kind := range kinds {
+		if !slices.Contains(Kinds, kind) {
+			return nil, fmt.Errorf("unknown personal data kind %q (supported: %s)", kind, strings.Join(Kinds, ", "))
+		}
+	}
+	if len(kinds) == 0 {
+		kinds = Kinds
+	}
+	return &Detector{kinds: kinds}, nil
+}
+
+// Scan returns the personal data in text, in order and without overlaps
+func (d *Detector) Scan(text string) []Finding {
+	var findings []Finding
+	taken := func(start, end int) bool {
+		return slices.ContainsFunc(findings, func(f Finding) bool { return start < f.End && f.Start < end })
+	}
+	add := func(kind string, pattern *regexp.Regexp, valid func(string) bool) {
+		for _, loc := range pattern.FindAllStringIndex(text, -1) {
+			value := text[loc[0]:loc[1]]
+			if !taken(loc[0], loc[1]) && valid(value) {
+				findings = append(findings, Finding{Kind: kind, Value: value, Start: loc[0], End: loc[1]})
+			}
+		}
+	}
+
+	// Kinds are looked for most specific first, so a card number isn't taken
+	// for a phone number
+	for _, kind := range Kinds {
+		if !slices.Contains(d.kinds, kind) {
+			continue
+		}
+		switch kind {
+		case KindAPIKey:
+			for _, pattern := range apiKeyPatterns {
+				add(kind, pattern, always)
+			}
+			add(kind, tokenPattern, looksRandom)
+		case KindEmail:
+			add(kind, emailPattern, always)
+		case KindCreditCard:
+			add(kind, cardPattern, luhnValid)
+		case KindPhone:
+			add(kind, phonePattern, looksLikePhone)
+		}
+	}
+
+	sort.Slice(findings, func(i, j int) bool { return findings[i].Start < findings[j].Start })
+	return findings
+}
+
+func always(string) bool { return true }
+
+// looksRandom takes tokens mixing upper and lower case letters with digits,
+// leaving long identifiers and hex digests alone
+func looksRandom(value string) bool {
+	var upper, lower, digit bool
+	for _, r := range value {
+		upper = upper || unicode.IsUpper(r)
+		lower = lower || unicode.IsLower(r)
+		digit = digit || unicode.IsDigit(r)
+	}
+	return upper && lower && digit
+}
+
+// looksLikePhone takes 10-15 digit numbers written with separators or a
+// leading +, leaving plain numbers, dates and versions alone
+func looksLikePhone(value string) bool {
+	digits := digitsOf(value)
+	if len(digits) < 10 || len(digits) > 15 {
+		return false
+	}
+	return strings.HasPrefix(value, "+") || strings.ContainsAny(value, " ()-")
+}
+
+// luhnValid reports whether a card number's check digit is right
+func luhnValid(value string) bool {
+	digits := digitsOf(value)
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+func digitsOf(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, value)
+}
@@ -0,0 +1,399 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// Modes of handling personal data bound for model providers
+const (
+	ModeOff    = "off"
+	ModeLog    = "log"    // Sent as it is, with what was found logged
+	ModeRedact = "redact" // Replaced with placeholders, restored in the answer
+	ModeBlock  = "block"  // Refused
+)
+
+// ErrBlocked is returned for queries with personal data in block mode
+var ErrBlocked = errors.New("query contains personal data")
+
+// BlockedError lists the kinds of personal data a blocked query contains
+type BlockedError struct {
+	Kinds []string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("%s (%s); remove it and try again", ErrBlocked, strings.Join(e.Kinds, ", "))
+}
+
+func (e *BlockedError) Is(target error) bool {
+	return target == ErrBlocked
+}
+
+// Guard screens what is sent to model providers for personal data
+type Guard struct {
+	mode       string
+	detector   *Detector
+	slm        bool // SLM calls are screened too
+	embeddings bool // Embedded texts are screened too
+}
+
+// NewGuard returns the guard cfg configures, or nil when it's off
+func NewGuard(cfg config.PrivacyConfig) (*Guard, error) {
+	switch cfg.Mode {
+	case "", ModeOff:
+		return nil, nil
+	case ModeLog, ModeRedact, ModeBlock:
+	default:
+		return nil, fmt.Errorf("unknown privacy mode %q", cfg.Mode)
+	}
+	detector, err := NewDetector(cfg.Kinds)
+	if err != nil {
+		return nil, err
+	}
+	return &Guard{mode: cfg.Mode, detector: detector, slm: cfg.SLM, embeddings: cfg.Embeddings}, nil
+}
+
+// Mode returns how personal data is handled
+func (g *Guard) Mode() string {
+	return g.mode
+}
+
+// Redaction replaces personal data with placeholders and puts it back
+type Redaction struct {
+	detector     *Detector
+	placeholders map[string]string // Placeholder by original value
+	originals    map[string]string // Original value by placeholder
+	counts       map[string]int    // Placeholders handed out by kind
+	kinds        []string          // Kinds found, in the order first found
+}
+
+func newRedaction(detector *Detector) *Redaction {
+	return &Redaction{
+		detector:     detector,
+		placeholders: make(map[string]string),
+		originals:    make(map[string]string),
+		counts:       make(map[string]int),
+	}
+}
+
+// Redact returns text with its personal data replaced. The same value gets
+// the same placeholder, like [EMAIL_1], throughout a redaction.
+func (r *Redaction) Redact(text string) string {
+	findings := r.detector.Scan(text)
+	if len(findings) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+	for _, finding := range findings {
+		placeholder, ok := r.placeholders[finding.Value]
+		if !ok {
+			r.counts[finding.Kind]++
+			placeholder = fmt.Sprintf("[%s_%d]", strings.ToUpper(finding.Kind), r.counts[finding.Kind])
+			r.placeholders[finding.Value] = placeholder
+			r.originals[placeholder] = finding.Value
+		}
+		if !slices.Contains(r.kinds, finding.Kind) {
+			r.kinds = append(r.kinds, finding.Kind)
+		}
+		sb.WriteString(text[last:finding.Start])
+		sb.WriteString(placeholder)
+		last = finding.End
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
+}
+
+// Kinds returns the kinds of personal data redacted so far
+func (r *Redaction) Kinds() []string {
+	return r.kinds
+}
+
+// Restore puts the original values back in place of their placeholders
+func (r *Redaction) Restore(text string) string {
+	if len(r.originals) == 0 {
+		return text
+	}
+	pairs := make([]string, 0, 2*len(r.originals))
+	for placeholder, original := range r.originals {
+		pairs = append(pairs, placeholder, original)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// restorer restores placeholders in streamed chunks, holding back the end of
+// a chunk that may be the start of a placeholder split across chunks
+type restorer struct {
+	redaction *Redaction
+	pending   string
+}
+
+// maxPlaceholderLen bounds how much is held back, e.g. [CREDIT_CARD_12]
+const maxPlaceholderLen = 24
+
+func (s *restorer) write(chunk string) string {
+	text := s.pending + chunk
+	s.pending = ""
+	if open := strings.LastIndexByte(text, '['); open >= 0 && !strings.Contains(text[open:], "]") && len(text)-open < maxPlaceholderLen {
+		s.pending = text[open:]
+		text = text[:open]
+	}
+	return s.redaction.Restore(text)
+}
+
+func (s *restorer) flush() string {
+	text := s.pending
+	s.pending = ""
+	return s.redaction.Restore(text)
+}
+
+// screen looks for personal data in texts bound for target, e.g. "the cloud
+// LLM". In redact mode it's replaced in place and the redaction to restore
+// the answer with is returned.
+func (g *Guard) screen(texts []*string, target string) (*Redaction, error) {
+	redaction := newRedaction(g.detector)
+	redacted := make([]string, len(texts))
+	for i, text := range texts {
+		redacted[i] = redaction.Redact(*text)
+	}
+	kinds := redaction.Kinds()
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	switch g.mode {
+	case ModeBlock:
+		log.Printf("🔒 Blocked a query with personal data (%s) from %s", strings.Join(kinds, ", "), target)
+		return nil, &BlockedError{Kinds: kinds}
+	case ModeLog:
+		log.Printf("🔒 Query with personal data (%s) sent to %s", strings.Join(kinds, ", "), target)
+		return nil, nil
+	}
+	for i, text := range texts {
+		*text = redacted[i]
+	}
+	log.Printf("🔒 Redacted personal data (%s) from a query to %s", strings.Join(kinds, ", "), target)
+	return redaction, nil
+}
+
+// redactRequest returns a copy of req with its personal data redacted
+func (g *Guard) redactRequest(req *models.InferenceRequest, target string) (*models.InferenceRequest, *Redaction, error) {
+	copied := *req
+	copied.Messages = slices.Clone(req.Messages)
+	texts := []*string{&copied.Query, &copied.Context}
+	for i := range copied.Messages {
+		texts = append(texts, &copied.Messages[i].Content)
+	}
+	redaction, err := g.screen(texts, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &copied, redaction, nil
+}
+
+// redactMessages returns a copy of messages with their personal data redacted
+func (g *Guard) redactMessages(messages []models.ChatMessage, target string) ([]models.ChatMessage, *Redaction, error) {
+	messages = slices.Clone(messages)
+	texts := make([]*string, len(messages))
+	for i := range messages {
+		texts[i] = &messages[i].Content
+	}
+	redaction, err := g.screen(texts, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	return messages, redaction, nil
+}
+
+// restoreStream calls stream with a callback restoring the placeholders of
+// redaction in the chunks it's given before passing them to callback
+func restoreStream(redaction *Redaction, callback func(string) error, stream func(func(string) error) error) error {
+	if redaction == nil {
+		return stream(callback)
+	}
+	restore := &restorer{redaction: redaction}
+	err := stream(func(chunk string) error {
+		if text := restore.write(chunk); text != "" {
+			return callback(text)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if text := restore.flush(); text != "" {
+		return callback(text)
+	}
+	return nil
+}
+
+// WrapLLM screens every request to llm. Answers to redacted requests have
+// their placeholders restored, streamed ones included. A nil guard returns
+// llm unchanged.
+func (g *Guard) WrapLLM(llm models.LLMInferencer) models.LLMInferencer {
+	if g == nil {
+		return llm
+	}
+	return &guardedLLM{guard: g, llm: llm}
+}
+
+type guardedLLM struct {
+	guard *Guard
+	llm   models.LLMInferencer
+}
+
+const llmTarget = "the cloud LLM"
+
+func (l *guardedLLM) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	redacted, redaction, err := l.guard.redactRequest(req, llmTarget)
+	if err != nil {
+		return "", err
+	}
+	response, err := l.llm.Infer(ctx, redacted)
+	if redaction != nil {
+		response = redaction.Restore(response)
+	}
+	return response, err
+}
+
+func (l *guardedLLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+	messages, redaction, err := l.guard.redactMessages(messages, llmTarget)
+	if err != nil {
+		return "", err
+	}
+	response, err := l.llm.InferChat(ctx, messages, opts)
+	if redaction != nil {
+		response = redaction.Restore(response)
+	}
+	return response, err
+}
+
+// InferStreaming streams the answer with placeholders restored. LLMs that
+// can't stream send the whole answer as one chunk.
+func (l *guardedLLM) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) error {
+	redacted, redaction, err := l.guard.redactRequest(req, llmTarget)
+	if err != nil {
+		return err
+	}
+	streamer, ok := l.llm.(models.StreamingInferencer)
+	if !ok {
+		response, err := l.llm.Infer(ctx, redacted)
+		if err != nil {
+			return err
+		}
+		if redaction != nil {
+			response = redaction.Restore(response)
+		}
+		return callback(response)
+	}
+	return restoreStream(redaction, callback, func(callback func(string) error) error {
+		return streamer.InferStreaming(ctx, redacted, callback)
+	})
+}
+
+// WrapSLM screens every request to the SLM tier when the guard covers SLMs,
+// which it does unless they run on premises. Otherwise, or for a nil guard,
+// slm is returned unchanged.
+func (g *Guard) WrapSLM(slm models.SLMInferencer) models.SLMInferencer {
+	if g == nil || !g.slm {
+		return slm
+	}
+	return &guardedSLM{guard: g, slm: slm}
+}
+
+type guardedSLM struct {
+	guard *Guard
+	slm   models.SLMInferencer
+}
+
+const slmTarget = "the SLM tier"
+
+func (s *guardedSLM) Infer(ctx context.Context, req *models.InferenceRequest) (*models.SLMResult, error) {
+	redacted, redaction, err := s.guard.redactRequest(req, slmTarget)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.slm.Infer(ctx, redacted)
+	if result != nil && redaction != nil {
+		result.Response = redaction.Restore(result.Response)
+	}
+	return result, err
+}
+
+func (s *guardedSLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (*models.SLMResult, error) {
+	messages, redaction, err := s.guard.redactMessages(messages, slmTarget)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.slm.InferChat(ctx, messages, opts)
+	if result != nil && redaction != nil {
+		result.Response = redaction.Restore(result.Response)
+	}
+	return result, err
+}
+
+// InferStreaming streams the answer with placeholders restored. Engines that
+// can't stream send the whole answer as one chunk.
+func (s *guardedSLM) InferStreaming(ctx context.Context, req *models.InferenceRequest, callback func(string) error) error {
+	redacted, redaction, err := s.guard.redactRequest(req, slmTarget)
+	if err != nil {
+		return err
+	}
+	streamer, ok := s.slm.(models.StreamingInferencer)
+	if !ok {
+		result, err := s.slm.Infer(ctx, redacted)
+		if err != nil {
+			return err
+		}
+		if redaction != nil {
+			result.Response = redaction.Restore(result.Response)
+		}
+		models.RecordSLMResult(ctx, result)
+		return callback(result.Response)
+	}
+	return restoreStream(redaction, callback, func(callback func(string) error) error {
+		return streamer.InferStreaming(ctx, redacted, callback)
+	})
+}
+
+func (s *guardedSLM) Close() error {
+	return s.slm.Close()
+}
+
+// ErrNotEmbedded is returned for texts with personal data the guard won't
+// send to the embeddings API, which then skip semantic matching
+var ErrNotEmbedded = errors.New("text contains personal data, not embedded")
+
+// WrapEmbedder screens texts sent to the embeddings API when the guard
+// covers embeddings. Redacting would make texts about different people embed
+// alike, so in redact and block mode texts with personal data aren't
+// embedded at all. A nil guard returns embedder unchanged.
+func (g *Guard) WrapEmbedder(embedder models.Embedder) models.Embedder {
+	if g == nil || !g.embeddings || embedder == nil {
+		return embedder
+	}
+	return &guardedEmbedder{guard: g, embedder: embedder}
+}
+
+type guardedEmbedder struct {
+	guard    *Guard
+	embedder models.Embedder
+}
+
+func (e *guardedEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	if findings := e.guard.detector.Scan(text); len(findings) > 0 {
+		if e.guard.mode != ModeLog {
+			return nil, ErrNotEmbedded
+		}
+		log.Printf("🔒 Text with personal data (%s) sent to the embeddings API", findings[0].Kind)
+	}
+	return e.embedder.Embed(ctx, text)
+}
@@ -0,0 +1,126 @@
+package privacy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestDetector_Scan(t *testing.T) {
+	detector, err := NewDetector(nil)
+	require.NoError(t, err)
+
+	findings := detector.Scan("Mail jane.doe@example.com or call +1 (415) 555-0132, card 4111 1111 1111 1111, key sk-abcdefghijklmnopqrstuvwx")
+	var kinds, values []string
+	for _, finding := range findings {
+		kinds = append(kinds, finding.Kind)
+		values = append(values, finding.Value)
+	}
+	assert.Equal(t, []string{KindEmail, KindPhone, KindCreditCard, KindAPIKey}, kinds)
+	assert.Equal(t, []string{"jane.doe@example.com", "+1 (415) 555-0132", "4111 1111 1111 1111", "sk-abcdefghijklmnopqrstuvwx"}, values)
+
+	// Numbers that aren't personal data
+	assert.Empty(t, detector.Scan("Released 2024-01-15 as v1.2.3, order 1234567890123, sha 9f86d081884c7d659a2feaa0c55ad015"))
+	assert.Len(t, detector.Scan("token AbCdEf0123456789GhIjKl0123456789MnOp"), 1)
+
+	emailsOnly, err := NewDetector([]string{KindEmail})
+	require.NoError(t, err)
+	assert.Len(t, emailsOnly.Scan("jane@example.com, 4111 1111 1111 1111"), 1)
+
+	_, err = NewDetector([]string{"passport"})
+	assert.Error(t, err)
+}
+
+func TestGuard_Redact(t *testing.T) {
+	llm := fakes.NewLLM("")
+	llm.SetResponder(func(req *models.InferenceRequest) string {
+		return "I'll write to " + strings.Fields(req.Query)[2] + " and cc [EMAIL_2]."
+	})
+	guard, err := NewGuard(config.PrivacyConfig{Mode: ModeRedact})
+	require.NoError(t, err)
+	guarded := guard.WrapLLM(llm)
+	req := &models.InferenceRequest{Query: "Email to jane@example.com and bob@example.com", Context: "jane@example.com signed up"}
+
+	response, err := guarded.Infer(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, "I'll write to jane@example.com and cc bob@example.com.", response)
+	sent := llm.Calls()[0]
+	assert.Equal(t, "Email to [EMAIL_1] and [EMAIL_2]", sent.Query)
+	assert.Equal(t, "[EMAIL_1] signed up", sent.Context)
+	assert.Equal(t, "Email to jane@example.com and bob@example.com", req.Query, "the caller's request is left alone")
+
+	// Placeholders split across streamed chunks are restored
+	var chunks []string
+	err = guarded.(models.StreamingInferencer).InferStreaming(context.Background(), req, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "I'll write to jane@example.com and cc bob@example.com.", strings.Join(chunks, ""))
+
+	restore := &restorer{redaction: newRedaction(guard.detector)}
+	restore.redaction.Redact("jane@example.com")
+	assert.Equal(t, "Hi ", restore.write("Hi [EMA"))
+	assert.Equal(t, "jane@example.com!", restore.write("IL_1]!"))
+	assert.Equal(t, " ", restore.write(" [x"))
+	assert.Equal(t, "[x", restore.flush())
+}
+
+func TestGuard_BlockAndLog(t *testing.T) {
+	llm := fakes.NewLLM("answer")
+	blocking, err := NewGuard(config.PrivacyConfig{Mode: ModeBlock, Kinds: []string{KindCreditCard}})
+	require.NoError(t, err)
+
+	_, err = blocking.WrapLLM(llm).Infer(context.Background(), &models.InferenceRequest{Query: "Charge 4111-1111-1111-1111"})
+	var blocked *BlockedError
+	require.True(t, errors.As(err, &blocked))
+	assert.Equal(t, []string{KindCreditCard}, blocked.Kinds)
+	assert.ErrorIs(t, err, ErrBlocked)
+	assert.Empty(t, llm.Calls())
+
+	_, err = blocking.WrapLLM(llm).InferChat(context.Background(), []models.ChatMessage{{Role: "user", Content: "Mail jane@example.com"}}, models.ChatOptions{})
+	assert.NoError(t, err, "only the configured kinds are blocked")
+
+	logging, err := NewGuard(config.PrivacyConfig{Mode: ModeLog})
+	require.NoError(t, err)
+	_, err = logging.WrapLLM(llm).Infer(context.Background(), &models.InferenceRequest{Query: "Charge 4111-1111-1111-1111"})
+	require.NoError(t, err)
+	assert.Equal(t, "Charge 4111-1111-1111-1111", llm.Calls()[1].Query)
+
+	off, err := NewGuard(config.PrivacyConfig{Mode: ModeOff})
+	require.NoError(t, err)
+	assert.Same(t, llm, off.WrapLLM(llm))
+}
+
+func TestGuard_SLMAndEmbeddings(t *testing.T) {
+	slm := fakes.NewSLM("llama-3.1-8b-instant", "")
+	slm.SetResponder(func(req *models.InferenceRequest) string {
+		return "Writing to " + strings.Fields(req.Query)[2]
+	})
+	guard, err := NewGuard(config.PrivacyConfig{Mode: ModeRedact, SLM: true, Embeddings: true})
+	require.NoError(t, err)
+
+	result, err := guard.WrapSLM(slm).Infer(context.Background(), &models.InferenceRequest{Query: "Email to jane@example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "Writing to jane@example.com", result.Response)
+	assert.Equal(t, "Email to [EMAIL_1]", slm.Calls()[0].Query)
+
+	embedder := guard.WrapEmbedder(fakes.NewEmbedder())
+	_, err = embedder.Embed(context.Background(), "Email to jane@example.com")
+	assert.ErrorIs(t, err, ErrNotEmbedded)
+	_, err = embedder.Embed(context.Background(), "What is 2+2?")
+	assert.NoError(t, err)
+
+	// SLMs on premises aren't screened
+	onPremises, err := NewGuard(config.PrivacyConfig{Mode: ModeRedact})
+	require.NoError(t, err)
+	assert.Same(t, slm, onPremises.WrapSLM(slm))
+}
@@ -0,0 +1,216 @@
+// Package providertest is a conformance suite for model backends. Every
+// models.LLMInferencer and models.SLMInferencer implementation should pass
+// RunLLM or RunSLM, which check the behaviors the handlers, failover and
+// circuit breakers rely on: answers, chats and streams arrive intact, failures
+// are classified correctly, usage is reported and deadlines are respected.
+package providertest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	answer = "The capital of France is Paris."
+
+	// slowDelay is how long a slow upstream takes; deadlines are far shorter
+	slowDelay = 5 * time.Second
+	deadline  = 100 * time.Millisecond
+)
+
+// Scenario is how the upstream behind a provider should behave for one check
+type Scenario struct {
+	Answer       string        // Text the model answers with
+	Status       int           // When 300 or more, the upstream fails with this HTTP status
+	ErrorMessage string        // Error message sent with a failing status
+	Delay        time.Duration // How long the upstream takes to answer
+}
+
+func (s Scenario) errorMessage() string {
+	if s.ErrorMessage != "" {
+		return s.ErrorMessage
+	}
+	return http.StatusText(s.Status)
+}
+
+// LLMFactory returns the LLM under test, backed by an upstream following the scenario
+type LLMFactory func(t *testing.T, scenario Scenario) models.LLMInferencer
+
+// SLMFactory returns the SLM engine under test, backed by an upstream following the scenario
+type SLMFactory func(t *testing.T, scenario Scenario) models.SLMInferencer
+
+var errStopStream = errors.New("client went away")
+
+// RunLLM runs the conformance suite against an LLM backend
+func RunLLM(t *testing.T, factory LLMFactory) {
+	run(t, func(t *testing.T, scenario Scenario) backend {
+		llm := factory(t, scenario)
+		streamer, _ := llm.(models.StreamingInferencer)
+		return backend{infer: llm.Infer, chat: llm.InferChat, streamer: streamer}
+	})
+}
+
+// RunSLM runs the conformance suite against an SLM backend, including its
+// usage reporting
+func RunSLM(t *testing.T, factory SLMFactory) {
+	newBackend := func(t *testing.T, scenario Scenario) backend {
+		slm := factory(t, scenario)
+		t.Cleanup(func() { _ = slm.Close() })
+
+		streamer, _ := slm.(models.StreamingInferencer)
+		infer := func(ctx context.Context, req *models.InferenceRequest) (string, error) {
+			result, err := slm.Infer(ctx, req)
+			if err != nil {
+				return "", err
+			}
+			return result.Response, nil
+		}
+		chat := func(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+			result, err := slm.InferChat(ctx, messages, opts)
+			if err != nil {
+				return "", err
+			}
+			return result.Response, nil
+		}
+		return backend{infer: infer, chat: chat, streamer: streamer}
+	}
+	run(t, newBackend)
+
+	t.Run("reports usage", func(t *testing.T) {
+		slm := factory(t, Scenario{Answer: answer})
+		t.Cleanup(func() { _ = slm.Close() })
+
+		result, err := slm.Infer(context.Background(), &models.InferenceRequest{Query: "What is the capital of France?"})
+		require.NoError(t, err)
+		require.NotEmpty(t, result.SelectedModel, "the answering model must be reported")
+		assert.Contains(t, result.ModelsUsed, result.SelectedModel)
+		assert.Contains(t, result.ModelLatencies, result.SelectedModel)
+
+		var usage *models.ModelUsage
+		for i := range result.Usage {
+			if result.Usage[i].Model == result.SelectedModel {
+				usage = &result.Usage[i]
+			}
+		}
+		require.NotNil(t, usage, "usage must include the answering model")
+		assert.Positive(t, usage.Calls)
+		assert.Positive(t, usage.InputTokens)
+		assert.Positive(t, usage.OutputTokens)
+	})
+}
+
+// backend is the part of a provider the shared checks exercise
+type backend struct {
+	infer    func(ctx context.Context, req *models.InferenceRequest) (string, error)
+	chat     func(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error)
+	streamer models.StreamingInferencer
+}
+
+func run(t *testing.T, newBackend func(t *testing.T, scenario Scenario) backend) {
+	req := func() *models.InferenceRequest {
+		return &models.InferenceRequest{Query: "What is the capital of France?"}
+	}
+
+	t.Run("answers", func(t *testing.T) {
+		b := newBackend(t, Scenario{Answer: answer})
+
+		response, err := b.infer(context.Background(), req())
+		require.NoError(t, err)
+		assert.Equal(t, answer, response)
+	})
+
+	t.Run("answers chat", func(t *testing.T) {
+		b := newBackend(t, Scenario{Answer: answer})
+
+		response, err := b.chat(context.Background(), []models.ChatMessage{
+			{Role: "system", Content: "Answer in one sentence."},
+			{Role: "user", Content: "I'm planning a trip to France."},
+			{Role: "assistant", Content: "Sounds lovely, how can I help?"},
+			{Role: "user", Content: "What is its capital?"},
+		}, models.ChatOptions{MaxTokens: 32})
+		require.NoError(t, err)
+		assert.Equal(t, answer, response)
+	})
+
+	t.Run("streams", func(t *testing.T) {
+		b := newBackend(t, Scenario{Answer: answer})
+		if b.streamer == nil {
+			t.Skip("backend does not stream")
+		}
+
+		var chunks []string
+		err := b.streamer.InferStreaming(context.Background(), req(), func(chunk string) error {
+			chunks = append(chunks, chunk)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, chunks)
+		assert.Equal(t, answer, strings.Join(chunks, ""), "chunks must reassemble the answer")
+	})
+
+	t.Run("stops streaming on callback error", func(t *testing.T) {
+		b := newBackend(t, Scenario{Answer: answer})
+		if b.streamer == nil {
+			t.Skip("backend does not stream")
+		}
+
+		chunks := 0
+		err := b.streamer.InferStreaming(context.Background(), req(), func(chunk string) error {
+			chunks++
+			return errStopStream
+		})
+		assert.ErrorIs(t, err, errStopStream)
+		assert.Equal(t, 1, chunks, "no chunks may be sent after the callback fails")
+	})
+
+	t.Run("upstream failure is a provider failure", func(t *testing.T) {
+		b := newBackend(t, Scenario{Status: http.StatusServiceUnavailable})
+
+		_, err := b.infer(context.Background(), req())
+		require.Error(t, err)
+		assert.True(t, inference.IsProviderFailure(err), "got %v", err)
+	})
+
+	t.Run("context length error is not a provider failure", func(t *testing.T) {
+		b := newBackend(t, Scenario{
+			Status:       http.StatusBadRequest,
+			ErrorMessage: "This model's maximum context length is 8192 tokens",
+		})
+
+		_, err := b.infer(context.Background(), req())
+		require.Error(t, err)
+		assert.False(t, inference.IsProviderFailure(err), "got %v", err)
+	})
+
+	t.Run("respects deadline", func(t *testing.T) {
+		b := newBackend(t, Scenario{Answer: answer, Delay: slowDelay})
+
+		ctx, cancel := context.WithTimeout(context.Background(), deadline)
+		defer cancel()
+
+		start := time.Now()
+		_, err := b.infer(ctx, req())
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), slowDelay/2, "must return once the deadline passes")
+	})
+
+	t.Run("cancellation is not a provider failure", func(t *testing.T) {
+		b := newBackend(t, Scenario{Answer: answer, Delay: slowDelay})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		time.AfterFunc(deadline, cancel)
+
+		_, err := b.infer(ctx, req())
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.False(t, inference.IsProviderFailure(err), "got %v", err)
+	})
+}
@@ -0,0 +1,87 @@
+package providertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// NewOpenAIServer starts an upstream speaking the OpenAI chat completions API
+// (plain and streamed) that behaves as the scenario describes. Adapters for
+// OpenAI-compatible providers can point their endpoint at its URL.
+func NewOpenAIServer(t *testing.T, scenario Scenario) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Reading the body first lets the server notice clients that give up
+		var body struct {
+			Model  string `json:"model"`
+			Stream bool   `json:"stream"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+
+		if scenario.Delay > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(scenario.Delay):
+			}
+		}
+
+		if scenario.Status >= http.StatusMultipleChoices {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(scenario.Status)
+			_ = json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]any{"message": scenario.errorMessage(), "type": "invalid_request_error"},
+			})
+			return
+		}
+
+		if body.Stream {
+			writeStream(w, body.Model, scenario.Answer)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"id":    "chatcmpl-test",
+			"model": body.Model,
+			"choices": []map[string]any{{
+				"index":         0,
+				"message":       map[string]any{"role": "assistant", "content": scenario.Answer},
+				"finish_reason": "stop",
+			}},
+			"usage": map[string]any{
+				"prompt_tokens":     10,
+				"completion_tokens": len(strings.Fields(scenario.Answer)),
+				"total_tokens":      10 + len(strings.Fields(scenario.Answer)),
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// writeStream sends the answer as server-sent events, one word per chunk
+func writeStream(w http.ResponseWriter, model string, answer string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	flusher, _ := w.(http.Flusher)
+
+	for _, word := range strings.SplitAfter(answer, " ") {
+		if word == "" {
+			continue
+		}
+		chunk, _ := json.Marshal(map[string]any{
+			"id":      "chatcmpl-test",
+			"model":   model,
+			"choices": []map[string]any{{"index": 0, "delta": map[string]any{"content": word}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
@@ -0,0 +1,128 @@
+// Package receipts signs and verifies receipts for answers: tamper-evident
+// records of what a request was answered with, by which model and at what
+// cost. Receipts aren't stored; the signature is all it takes to check one.
+package receipts
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	minSecretLength = 32
+	// signatureVersion prefixes signatures so the signed fields can change
+	signatureVersion = "v1"
+)
+
+// ErrWeakSecret is returned for signing secrets too short to be safe
+var ErrWeakSecret = errors.New("receipts secret must be at least 32 bytes")
+
+// Signer issues and verifies receipts
+type Signer struct {
+	secret []byte
+	clock  clock.Clock
+}
+
+func NewSigner(cfg config.ReceiptsConfig) (*Signer, error) {
+	if len(cfg.Secret) < minSecretLength {
+		return nil, ErrWeakSecret
+	}
+	return &Signer{
+		secret: []byte(cfg.Secret),
+		clock:  clock.Real(),
+	}, nil
+}
+
+// SetClock sets the clock receipts are dated with
+func (s *Signer) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Issue signs a receipt for a user's query and the response it got
+func (s *Signer) Issue(userID string, query string, response string, model string, cost float64) *models.Receipt {
+	if s == nil {
+		return nil
+	}
+	receipt := &models.Receipt{
+		ID:           "rcpt_" + uuid.New().String(),
+		UserID:       userID,
+		RequestHash:  Hash(query),
+		ResponseHash: Hash(response),
+		Model:        model,
+		CostUSD:      cost,
+		IssuedAt:     s.clock.Now().UTC(),
+	}
+	receipt.Signature = s.sign(receipt)
+	return receipt
+}
+
+// Verify checks a receipt's signature, and the query and response against
+// its hashes when given
+func (s *Signer) Verify(req models.VerifyReceiptRequest) models.ReceiptVerification {
+	expected := s.sign(&req.Receipt)
+	verification := models.ReceiptVerification{
+		Valid: hmac.Equal([]byte(expected), []byte(req.Receipt.Signature)),
+	}
+	if req.Query != nil {
+		matches := Hash(*req.Query) == req.Receipt.RequestHash
+		verification.QueryMatches = &matches
+	}
+	if req.Response != nil {
+		matches := Hash(*req.Response) == req.Receipt.ResponseHash
+		verification.ResponseMatches = &matches
+	}
+	return verification
+}
+
+// InferenceReceipt attaches a receipt to an inference response
+func (s *Signer) InferenceReceipt(userID string, query string, resp *models.InferenceResponse) {
+	resp.Receipt = s.Issue(userID, query, resp.Response, resp.ModelUsed, totalCost(resp.CostMetrics))
+}
+
+// ChatReceipt attaches a receipt to a chat turn's response
+func (s *Signer) ChatReceipt(userID string, message string, resp *models.ChatResponse) {
+	resp.Receipt = s.Issue(userID, message, resp.Response, resp.ModelUsed, totalCost(resp.CostMetrics))
+}
+
+// sign returns the HMAC of a receipt's fields, one per line
+func (s *Signer) sign(receipt *models.Receipt) string {
+	fields := strings.Join([]string{
+		signatureVersion,
+		receipt.ID,
+		receipt.UserID,
+		receipt.RequestHash,
+		receipt.ResponseHash,
+		receipt.Model,
+		strconv.FormatFloat(receipt.CostUSD, 'f', -1, 64),
+		receipt.IssuedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(fields))
+	return signatureVersion + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Hash returns the hex SHA-256 of a text, as receipts record it
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+func totalCost(metrics *models.CostMetrics) float64 {
+	if metrics == nil {
+		return 0
+	}
+	return metrics.TotalCost
+}
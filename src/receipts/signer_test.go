@@ -0,0 +1,54 @@
+package receipts
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func TestSigner_VerifiesIssuedReceipts(t *testing.T) {
+	signer, err := NewSigner(config.ReceiptsConfig{Secret: testSecret})
+	require.NoError(t, err)
+	signer.SetClock(clock.NewFake(time.Date(2025, 3, 1, 12, 0, 0, 123456789, time.UTC)))
+
+	issued := signer.Issue("alice", "What is Go?", "A programming language.", "llama-3.1-8b-instant", 0.000123)
+
+	// Receipts are checked as clients send them back, after a JSON round trip
+	data, err := json.Marshal(issued)
+	require.NoError(t, err)
+	var receipt models.Receipt
+	require.NoError(t, json.Unmarshal(data, &receipt))
+
+	query, response, other := "What is Go?", "A programming language.", "A board game."
+	verification := signer.Verify(models.VerifyReceiptRequest{Receipt: receipt, Query: &query, Response: &response})
+	assert.True(t, verification.Valid)
+	assert.True(t, *verification.QueryMatches)
+	assert.True(t, *verification.ResponseMatches)
+
+	verification = signer.Verify(models.VerifyReceiptRequest{Receipt: receipt, Response: &other})
+	assert.True(t, verification.Valid)
+	assert.Nil(t, verification.QueryMatches)
+	assert.False(t, *verification.ResponseMatches)
+
+	tampered := receipt
+	tampered.CostUSD = 0
+	assert.False(t, signer.Verify(models.VerifyReceiptRequest{Receipt: tampered}).Valid)
+
+	otherSigner, err := NewSigner(config.ReceiptsConfig{Secret: testSecret + "!"})
+	require.NoError(t, err)
+	assert.False(t, otherSigner.Verify(models.VerifyReceiptRequest{Receipt: receipt}).Valid)
+}
+
+func TestNewSigner_RejectsWeakSecrets(t *testing.T) {
+	_, err := NewSigner(config.ReceiptsConfig{Secret: "short"})
+	assert.ErrorIs(t, err, ErrWeakSecret)
+}
@@ -0,0 +1,133 @@
+package registry
+
+import (
+	"sort"
+	"sync"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// DefaultContextWindow is used for models that aren't in the registry
+const DefaultContextWindow = 8192
+
+// Capabilities that requests can require from a model
+const (
+	CapabilityTools    = "tools"
+	CapabilityVision   = "vision"
+	CapabilityJSONMode = "json_mode"
+)
+
+// Built-in entries for the models we ship configs for; config.yaml entries override these
+var builtinModels = []models.ModelInfo{
+	{Name: "gpt-3.5-turbo", Tier: "llm", ContextWindow: 16385, MaxOutputTokens: 4096, SupportsTools: true, SupportsJSONMode: true},
+	{Name: "gpt-4", Tier: "llm", ContextWindow: 8192, MaxOutputTokens: 8192, SupportsTools: true},
+	{Name: "gpt-4o", Tier: "llm", ContextWindow: 128000, MaxOutputTokens: 16384, SupportsTools: true, SupportsVision: true, SupportsJSONMode: true},
+	{Name: "gpt-4o-mini", Tier: "llm", ContextWindow: 128000, MaxOutputTokens: 16384, SupportsTools: true, SupportsVision: true, SupportsJSONMode: true},
+	{Name: "llama-3.1-8b-instant", Tier: "slm", ContextWindow: 131072, MaxOutputTokens: 8192, SupportsTools: true, SupportsJSONMode: true},
+	{Name: "llama-3.3-70b-versatile", Tier: "slm", ContextWindow: 131072, MaxOutputTokens: 32768, SupportsTools: true, SupportsJSONMode: true},
+	{Name: "mixtral-8x7b-32768", Tier: "slm", ContextWindow: 32768, MaxOutputTokens: 32768, SupportsTools: true},
+}
+
+// ModelRegistry holds per-model context window sizes and capabilities
+type ModelRegistry struct {
+	models map[string]models.ModelInfo
+	mu     sync.RWMutex
+}
+
+// NewModelRegistry creates a registry seeded with the built-in models and
+// overridden/extended by the configured entries
+func NewModelRegistry(entries []config.ModelInfoConfig) *ModelRegistry {
+	r := &ModelRegistry{
+		models: make(map[string]models.ModelInfo),
+	}
+
+	for _, info := range builtinModels {
+		r.models[info.Name] = info
+	}
+
+	for _, entry := range entries {
+		if entry.Name == "" {
+			continue
+		}
+		r.Register(models.ModelInfo{
+			Name:             entry.Name,
+			Tier:             entry.Tier,
+			ContextWindow:    entry.ContextWindow,
+			MaxOutputTokens:  entry.MaxOutputTokens,
+			SupportsTools:    entry.SupportsTools,
+			SupportsVision:   entry.SupportsVision,
+			SupportsJSONMode: entry.SupportsJSONMode,
+			Encoding:         entry.Encoding,
+			Region:           entry.Region,
+		})
+	}
+
+	return r
+}
+
+// Register adds or replaces a model entry
+func (r *ModelRegistry) Register(info models.ModelInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.models[info.Name] = info
+}
+
+// Get returns the registry entry for a model
+func (r *ModelRegistry) Get(name string) (models.ModelInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	info, ok := r.models[name]
+	return info, ok
+}
+
+// List returns all registered models sorted by name
+func (r *ModelRegistry) List() []models.ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]models.ModelInfo, 0, len(r.models))
+	for _, info := range r.models {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// ContextWindow returns the context window size for a model
+func (r *ModelRegistry) ContextWindow(name string) int {
+	if info, ok := r.Get(name); ok && info.ContextWindow > 0 {
+		return info.ContextWindow
+	}
+	return DefaultContextWindow
+}
+
+// MaxOutputTokens returns the output token limit for a model, or 0 if unknown
+func (r *ModelRegistry) MaxOutputTokens(name string) int {
+	if info, ok := r.Get(name); ok {
+		return info.MaxOutputTokens
+	}
+	return 0
+}
+
+// Supports reports whether a model has the given capability.
+// Unknown models are assumed to support nothing beyond plain text.
+func (r *ModelRegistry) Supports(name string, capability string) bool {
+	info, ok := r.Get(name)
+	if !ok {
+		return false
+	}
+
+	switch capability {
+	case CapabilityTools:
+		return info.SupportsTools
+	case CapabilityVision:
+		return info.SupportsVision
+	case CapabilityJSONMode:
+		return info.SupportsJSONMode
+	default:
+		return false
+	}
+}
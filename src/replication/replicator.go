@@ -0,0 +1,369 @@
+// Package replication copies cache entries and usage counters to the Redis
+// instances of other regions, driven by Redis keyspace notifications.
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+const (
+	ConflictLastWriteWins = "last_write_wins" // A copy replaces the peer's entry
+	ConflictKeepExisting  = "keep_existing"   // A peer keeps the entry it already has
+
+	// Marks a key written by replication so the receiving region doesn't send
+	// it back; consumed by the receiving replicator's first event for the key
+	originKeyPrefix = "replication:origin:"
+	originTTL       = time.Minute
+
+	// Keyspace notification classes: generic (del), string and hash commands
+	notifyEvents = "Kg$h"
+
+	defaultUsageFlushInterval = 5 * time.Second
+)
+
+var (
+	// Key prefixes of the exact response cache and the semantic cache
+	cachePrefixes = []string{"inference:", "query:", "embedding:"}
+	usagePrefix   = "usage:"
+)
+
+// mergeCounters raises each field of a region's usage replica to the sent
+// value, so replicas only grow and copies arriving out of order are harmless.
+// ARGV[1] is the TTL in milliseconds, followed by field/value pairs.
+var mergeCounters = redis.NewScript(`
+for i = 2, #ARGV, 2 do
+	local current = tonumber(redis.call('HGET', KEYS[1], ARGV[i]) or '0')
+	if tonumber(ARGV[i + 1]) > current then
+		redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1])
+	end
+end
+if tonumber(ARGV[1]) > 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+type peer struct {
+	region string
+	client *redis.Client
+}
+
+// Replicator sends local writes to every peer region. Cache entries are
+// copied as they change; usage counters are collected and sent every flush
+// interval as this region's replica on each peer.
+type Replicator struct {
+	local         *redis.Client
+	db            int
+	region        string
+	peers         []peer
+	cache         bool
+	usage         bool
+	conflict      string
+	flushInterval time.Duration
+
+	mu         sync.Mutex
+	dirtyUsage map[string]bool
+}
+
+// NewReplicator connects to the peers of cfg. db is the local Redis database,
+// whose keyspace notifications are followed.
+func NewReplicator(local *redis.Client, db int, cfg config.ReplicationConfig) (*Replicator, error) {
+	if cfg.Region == "" {
+		return nil, errors.New("replication region is required")
+	}
+	switch cfg.Conflict {
+	case "", ConflictLastWriteWins, ConflictKeepExisting:
+	default:
+		return nil, fmt.Errorf("unknown replication conflict policy %q", cfg.Conflict)
+	}
+
+	r := &Replicator{
+		local:         local,
+		db:            db,
+		region:        cfg.Region,
+		cache:         cfg.Cache,
+		usage:         cfg.Usage,
+		conflict:      cfg.Conflict,
+		flushInterval: cfg.UsageFlushInterval,
+		dirtyUsage:    make(map[string]bool),
+	}
+	if r.flushInterval <= 0 {
+		r.flushInterval = defaultUsageFlushInterval
+	}
+
+	for _, peerCfg := range cfg.Peers {
+		if peerCfg.Region == "" || peerCfg.Region == cfg.Region {
+			r.Close()
+			return nil, fmt.Errorf("replication peer %s needs a region other than %q", peerCfg.Address, cfg.Region)
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:     peerCfg.Address,
+			Password: peerCfg.Password,
+			DB:       peerCfg.DB,
+		})
+		r.peers = append(r.peers, peer{region: peerCfg.Region, client: client})
+	}
+	return r, nil
+}
+
+// Regions returns the peer regions
+func (r *Replicator) Regions() []string {
+	regions := make([]string, len(r.peers))
+	for i, p := range r.peers {
+		regions[i] = p.region
+	}
+	return regions
+}
+
+// EnableNotifications turns on the keyspace notifications replication
+// follows, keeping any classes already enabled. Managed Redis often disables
+// CONFIG, in which case notify-keyspace-events must be set by the operator.
+func (r *Replicator) EnableNotifications(ctx context.Context) error {
+	current, err := r.local.ConfigGet(ctx, "notify-keyspace-events").Result()
+	if err != nil {
+		return fmt.Errorf("failed to read keyspace notification settings: %w", err)
+	}
+
+	flags := current["notify-keyspace-events"]
+	for _, class := range notifyEvents {
+		if !strings.ContainsRune(flags, class) {
+			flags += string(class)
+		}
+	}
+	if err := r.local.ConfigSet(ctx, "notify-keyspace-events", flags).Err(); err != nil {
+		return fmt.Errorf("failed to enable keyspace notifications: %w", err)
+	}
+	return nil
+}
+
+// Run follows local writes until ctx is done, flushing changed usage counters
+// every flush interval
+func (r *Replicator) Run(ctx context.Context) {
+	channel := fmt.Sprintf("__keyspace@%d__:", r.db)
+	var patterns []string
+	if r.cache {
+		for _, prefix := range cachePrefixes {
+			patterns = append(patterns, channel+prefix+"*")
+		}
+	}
+	if r.usage {
+		patterns = append(patterns, channel+usagePrefix+"*")
+	}
+	if len(patterns) == 0 {
+		return
+	}
+
+	pubsub := r.local.PSubscribe(ctx, patterns...)
+	defer pubsub.Close()
+	messages := pubsub.Channel()
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			r.FlushUsage(context.WithoutCancel(ctx))
+			return
+		case <-ticker.C:
+			r.FlushUsage(ctx)
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			key := strings.TrimPrefix(message.Channel, channel)
+			if err := r.Replicate(ctx, key, message.Payload); err != nil {
+				log.Printf("⚠️  Failed to replicate %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// Replicate handles a keyspace event for key. Cache entries are copied to the
+// peers at once; usage counters are queued for the next flush.
+func (r *Replicator) Replicate(ctx context.Context, key string, event string) error {
+	if strings.HasPrefix(key, usagePrefix) {
+		if r.usage && !usage.IsReplicaKey(key) && strings.HasPrefix(event, "hincrby") {
+			r.mu.Lock()
+			r.dirtyUsage[key] = true
+			r.mu.Unlock()
+		}
+		return nil
+	}
+
+	if !r.cache || !isCacheKey(key) {
+		return nil
+	}
+	switch event {
+	case "set", "hset", "del":
+	default:
+		// Expirations happen on every region by themselves
+		return nil
+	}
+
+	// Entries written by another region's replicator stop here
+	origin, err := r.local.GetDel(ctx, originKeyPrefix+key).Result()
+	if err != nil && err != redis.Nil {
+		return fmt.Errorf("failed to check origin: %w", err)
+	}
+	if origin != "" {
+		return nil
+	}
+
+	var write func(ctx context.Context, pipe redis.Pipeliner)
+	switch event {
+	case "del":
+		write = func(ctx context.Context, pipe redis.Pipeliner) {
+			pipe.Del(ctx, key)
+		}
+	case "set":
+		value, ttl, err := r.readString(ctx, key)
+		if err != nil || ttl < 0 {
+			return err
+		}
+		write = func(ctx context.Context, pipe redis.Pipeliner) {
+			pipe.Set(ctx, key, value, ttl)
+		}
+	case "hset":
+		fields, ttl, err := r.readHash(ctx, key)
+		if err != nil || ttl < 0 {
+			return err
+		}
+		write = func(ctx context.Context, pipe redis.Pipeliner) {
+			pipe.HSet(ctx, key, fields)
+			if ttl > 0 {
+				pipe.PExpire(ctx, key, ttl)
+			}
+		}
+	}
+
+	var errs []error
+	for _, p := range r.peers {
+		if err := r.copyTo(ctx, p, key, event, write); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.region, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (r *Replicator) copyTo(ctx context.Context, p peer, key string, event string, write func(ctx context.Context, pipe redis.Pipeliner)) error {
+	if event != "del" && r.conflict == ConflictKeepExisting {
+		exists, err := p.client.Exists(ctx, key).Result()
+		if err != nil {
+			return err
+		}
+		if exists > 0 {
+			return nil
+		}
+	}
+
+	_, err := p.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, originKeyPrefix+key, r.region, originTTL)
+		write(ctx, pipe)
+		return nil
+	})
+	return err
+}
+
+// readString returns a string key and its TTL (0 without one). A TTL below
+// 0 means the key is already gone.
+func (r *Replicator) readString(ctx context.Context, key string) (string, time.Duration, error) {
+	pipe := r.local.Pipeline()
+	get := pipe.Get(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err == redis.Nil {
+		return "", -1, nil
+	} else if err != nil {
+		return "", 0, err
+	}
+	return get.Val(), ttlOf(pttl.Val()), nil
+}
+
+// readHash returns a hash key and its TTL like readString
+func (r *Replicator) readHash(ctx context.Context, key string) (map[string]string, time.Duration, error) {
+	pipe := r.local.Pipeline()
+	getAll := pipe.HGetAll(ctx, key)
+	pttl := pipe.PTTL(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, 0, err
+	}
+	if len(getAll.Val()) == 0 {
+		return nil, -1, nil
+	}
+	return getAll.Val(), ttlOf(pttl.Val()), nil
+}
+
+// ttlOf converts a PTTL reply: -1 (no expiry) becomes 0
+func ttlOf(pttl time.Duration) time.Duration {
+	if pttl < 0 {
+		return 0
+	}
+	return pttl
+}
+
+// FlushUsage sends the usage counters changed since the last flush to every
+// peer as this region's replica
+func (r *Replicator) FlushUsage(ctx context.Context) {
+	r.mu.Lock()
+	keys := make([]string, 0, len(r.dirtyUsage))
+	for key := range r.dirtyUsage {
+		keys = append(keys, key)
+	}
+	r.dirtyUsage = make(map[string]bool)
+	r.mu.Unlock()
+
+	for _, key := range keys {
+		fields, ttl, err := r.readHash(ctx, key)
+		if err != nil {
+			log.Printf("⚠️  Failed to read usage %s for replication: %v", key, err)
+			continue
+		}
+		if ttl < 0 {
+			continue
+		}
+
+		args := []interface{}{ttl.Milliseconds()}
+		for field, value := range fields {
+			args = append(args, field, value)
+		}
+		for _, p := range r.peers {
+			replica := usage.ReplicaKey(key, r.region)
+			if err := mergeCounters.Run(ctx, p.client, []string{replica}, args...).Err(); err != nil {
+				log.Printf("⚠️  Failed to replicate usage %s to %s: %v", key, p.region, err)
+				// Retried on the next flush
+				r.mu.Lock()
+				r.dirtyUsage[key] = true
+				r.mu.Unlock()
+			}
+		}
+	}
+}
+
+// Close closes the peer connections
+func (r *Replicator) Close() error {
+	var errs []error
+	for _, p := range r.peers {
+		errs = append(errs, p.client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func isCacheKey(key string) bool {
+	for _, prefix := range cachePrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
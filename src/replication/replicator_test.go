@@ -0,0 +1,168 @@
+package replication
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+type region struct {
+	mr     *miniredis.Miniredis
+	client *redis.Client
+}
+
+func newRegion(t *testing.T) region {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { client.Close() })
+	return region{mr: mr, client: client}
+}
+
+func newTestReplicator(t *testing.T, name string, local region, conflict string, peers map[string]region) *Replicator {
+	cfg := config.ReplicationConfig{
+		Enabled:  true,
+		Region:   name,
+		Cache:    true,
+		Usage:    true,
+		Conflict: conflict,
+	}
+	for peerName, peer := range peers {
+		cfg.Peers = append(cfg.Peers, config.ReplicationPeer{Region: peerName, Address: peer.mr.Addr()})
+	}
+
+	replicator, err := NewReplicator(local.client, 0, cfg)
+	require.NoError(t, err)
+	t.Cleanup(func() { replicator.Close() })
+	return replicator
+}
+
+func TestReplicator_CopiesCacheEntries(t *testing.T) {
+	us, eu := newRegion(t), newRegion(t)
+	usReplicator := newTestReplicator(t, "us-east", us, ConflictLastWriteWins, map[string]region{"eu-west": eu})
+	euReplicator := newTestReplicator(t, "eu-west", eu, ConflictLastWriteWins, map[string]region{"us-east": us})
+	ctx := context.Background()
+
+	require.NoError(t, us.client.Set(ctx, "inference:abc", `{"response":"4"}`, time.Hour).Err())
+	require.NoError(t, us.client.HSet(ctx, "embedding:abc", "key", "abc").Err())
+	require.NoError(t, usReplicator.Replicate(ctx, "inference:abc", "set"))
+	require.NoError(t, usReplicator.Replicate(ctx, "embedding:abc", "hset"))
+
+	value, err := eu.mr.Get("inference:abc")
+	require.NoError(t, err)
+	assert.Equal(t, `{"response":"4"}`, value)
+	assert.Equal(t, time.Hour, eu.mr.TTL("inference:abc"))
+	assert.Equal(t, "abc", eu.mr.HGet("embedding:abc", "key"))
+
+	// The copy's own events aren't sent back
+	us.mr.Del("inference:abc")
+	require.NoError(t, euReplicator.Replicate(ctx, "inference:abc", "set"))
+	assert.False(t, us.mr.Exists("inference:abc"))
+
+	// But later local writes are
+	require.NoError(t, eu.client.Set(ctx, "inference:abc", `{"response":"four"}`, time.Hour).Err())
+	require.NoError(t, euReplicator.Replicate(ctx, "inference:abc", "set"))
+	value, err = us.mr.Get("inference:abc")
+	require.NoError(t, err)
+	assert.Equal(t, `{"response":"four"}`, value)
+	require.NoError(t, usReplicator.Replicate(ctx, "inference:abc", "set"), "the copy's event on us-east")
+
+	// Deletes are replicated, expirations and other keys aren't
+	require.NoError(t, us.client.Del(ctx, "inference:abc").Err())
+	require.NoError(t, usReplicator.Replicate(ctx, "inference:abc", "del"))
+	assert.False(t, eu.mr.Exists("inference:abc"))
+
+	require.NoError(t, us.client.Set(ctx, "chat_session:sess_1", "{}", time.Hour).Err())
+	require.NoError(t, usReplicator.Replicate(ctx, "chat_session:sess_1", "set"))
+	assert.False(t, eu.mr.Exists("chat_session:sess_1"))
+}
+
+func TestReplicator_KeepExisting(t *testing.T) {
+	us, eu := newRegion(t), newRegion(t)
+	replicator := newTestReplicator(t, "us-east", us, ConflictKeepExisting, map[string]region{"eu-west": eu})
+	ctx := context.Background()
+
+	require.NoError(t, eu.client.Set(ctx, "inference:abc", "eu answer", time.Hour).Err())
+	require.NoError(t, us.client.Set(ctx, "inference:abc", "us answer", time.Hour).Err())
+	require.NoError(t, us.client.Set(ctx, "inference:def", "us answer", time.Hour).Err())
+	require.NoError(t, replicator.Replicate(ctx, "inference:abc", "set"))
+	require.NoError(t, replicator.Replicate(ctx, "inference:def", "set"))
+
+	value, err := eu.mr.Get("inference:abc")
+	require.NoError(t, err)
+	assert.Equal(t, "eu answer", value)
+	value, err = eu.mr.Get("inference:def")
+	require.NoError(t, err)
+	assert.Equal(t, "us answer", value)
+}
+
+func TestReplicator_MergesUsage(t *testing.T) {
+	us, eu := newRegion(t), newRegion(t)
+	usReplicator := newTestReplicator(t, "us-east", us, ConflictLastWriteWins, map[string]region{"eu-west": eu})
+	euReplicator := newTestReplicator(t, "eu-west", eu, ConflictLastWriteWins, map[string]region{"us-east": us})
+	ctx := context.Background()
+
+	usStore := usage.NewStore(us.client)
+	usStore.SetReplicaRegions(usReplicator.Regions())
+	euStore := usage.NewStore(eu.client)
+	euStore.SetReplicaRegions(euReplicator.Regions())
+
+	// Both regions serve alice at the same time
+	metrics := &models.CostMetrics{InputTokens: 10, OutputTokens: 5, TotalTokens: 15, TotalCost: 0.01}
+	require.NoError(t, usStore.Record(ctx, "alice", metrics, false))
+	require.NoError(t, usStore.Record(ctx, "alice", metrics, true))
+	require.NoError(t, euStore.Record(ctx, "alice", metrics, false))
+
+	for _, key := range us.mr.Keys() {
+		require.NoError(t, usReplicator.Replicate(ctx, key, "hincrby"))
+	}
+	for _, key := range eu.mr.Keys() {
+		require.NoError(t, euReplicator.Replicate(ctx, key, "hincrbyfloat"))
+	}
+	usReplicator.FlushUsage(ctx)
+	euReplicator.FlushUsage(ctx)
+	// A second flush of unchanged counters changes nothing
+	usReplicator.FlushUsage(ctx)
+
+	for _, store := range []*usage.Store{usStore, euStore} {
+		today, err := store.Today(ctx, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, 3, today.Requests)
+		assert.Equal(t, 1, today.CacheHits)
+		assert.Equal(t, 45, today.TotalTokens)
+		assert.InDelta(t, 0.03, today.Cost, 1e-9)
+	}
+
+	// Replicas of other regions' counts aren't replicated again
+	for _, key := range eu.mr.Keys() {
+		require.NoError(t, euReplicator.Replicate(ctx, key, "hincrby"))
+	}
+	euReplicator.FlushUsage(ctx)
+	for _, key := range us.mr.Keys() {
+		assert.NotContains(t, key, ":replica:us-east")
+	}
+}
+
+func TestNewReplicator_Validates(t *testing.T) {
+	local := newRegion(t)
+
+	_, err := NewReplicator(local.client, 0, config.ReplicationConfig{})
+	assert.ErrorContains(t, err, "region is required")
+
+	_, err = NewReplicator(local.client, 0, config.ReplicationConfig{Region: "us-east", Conflict: "newest"})
+	assert.ErrorContains(t, err, "conflict policy")
+
+	_, err = NewReplicator(local.client, 0, config.ReplicationConfig{
+		Region: "us-east",
+		Peers:  []config.ReplicationPeer{{Region: "us-east", Address: "localhost:6379"}},
+	})
+	assert.ErrorContains(t, err, "region other than")
+}
@@ -0,0 +1,131 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+// Actions for LLM requests estimated to cost more than router.cost_threshold_usd
+const (
+	CostActionRouteSLM = "route_slm"
+	CostActionReject   = "reject"
+)
+
+const (
+	// Output assumed for requests that don't set max_tokens
+	defaultEstimatedOutputTokens = 500
+
+	latencyWindowSize       = 200
+	latencyWindowMinSamples = 20
+)
+
+// ErrCostBudgetExceeded is returned with the "reject" cost action when a
+// request's estimated LLM cost exceeds the threshold
+var ErrCostBudgetExceeded = errors.New("estimated cost exceeds budget")
+
+// LatencyWindow keeps the most recent latencies of a tier to compute a
+// rolling p95
+type LatencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+func NewLatencyWindow() *LatencyWindow {
+	return &LatencyWindow{
+		samples: make([]time.Duration, 0, latencyWindowSize),
+	}
+}
+
+// Observe records a latency, replacing the oldest once the window is full
+func (w *LatencyWindow) Observe(latency time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, latency)
+		return
+	}
+	w.samples[w.next] = latency
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+// P95 returns the 95th percentile latency, or false until enough samples are in
+func (w *LatencyWindow) P95() (time.Duration, bool) {
+	w.mu.Lock()
+	sorted := slices.Clone(w.samples)
+	w.mu.Unlock()
+
+	if len(sorted) < latencyWindowMinSamples {
+		return 0, false
+	}
+	slices.Sort(sorted)
+	return sorted[(len(sorted)*95+99)/100-1], true
+}
+
+// EstimateLLMCost prices a request on an LLM before it runs: the prompt's
+// tokens plus max_tokens of output, or a typical answer length if unset
+func EstimateLLMCost(req *models.InferenceRequest, model string) float64 {
+	outputTokens := req.MaxTokens
+	if outputTokens <= 0 {
+		outputTokens = defaultEstimatedOutputTokens
+	}
+	return utils.CalculateLLMCost(utils.CountTokens(req.PromptText(), model), outputTokens, model)
+}
+
+// applyBudgets enforces router.cost_threshold_usd and router.latency_budget_ms
+// on an LLM decision. Decisions the router made are moved to the SLM tier;
+// forced ones (client overrides, capability constraints) can only be rejected.
+func (r *QueryRouter) applyBudgets(req *models.InferenceRequest, decision *models.RoutingDecision) error {
+	if !decision.UseLLM {
+		return nil
+	}
+
+	if threshold := r.config.CostThresholdUSD; threshold > 0 {
+		model := decision.Model
+		if model == "" {
+			model = r.llmModel
+		}
+		estimate := EstimateLLMCost(req, model)
+		decision.EstimatedCostUSD = estimate
+
+		if estimate > threshold {
+			if r.config.CostAction == CostActionReject {
+				return fmt.Errorf("%w: %s would cost an estimated $%.4f, over the $%.4f limit per request; shorten the prompt or lower max_tokens",
+					ErrCostBudgetExceeded, modelOrTier(model), estimate, threshold)
+			}
+			if !decision.Forced {
+				r.preferSLM(decision, req, fmt.Sprintf("estimated LLM cost $%.4f exceeds budget $%.4f", estimate, threshold))
+				return nil
+			}
+		}
+	}
+
+	if budget := time.Duration(r.config.LatencyBudgetMs) * time.Millisecond; budget > 0 && !decision.Forced {
+		if p95, ok := r.llmLatency.P95(); ok && p95 > budget {
+			r.preferSLM(decision, req, fmt.Sprintf("LLM p95 latency %s exceeds budget %s", p95.Round(time.Millisecond), budget))
+		}
+	}
+	return nil
+}
+
+// preferSLM moves an LLM decision to the SLM tier
+func (r *QueryRouter) preferSLM(decision *models.RoutingDecision, req *models.InferenceRequest, why string) {
+	decision.UseLLM = false
+	decision.Model = ""
+	decision.Reason = fmt.Sprintf("%s, but %s: routed to SLM", decision.Reason, why)
+	r.selectTarget(decision, req.RequiredCapabilities())
+}
+
+func modelOrTier(model string) string {
+	if model == "" {
+		return "the LLM tier"
+	}
+	return model
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+// contextQuery is routed to the LLM by the heuristic strategy
+func contextQuery(contextWords int) *models.InferenceRequest {
+	return &models.InferenceRequest{
+		Query:   "Summarize this",
+		Context: strings.Repeat("word ", contextWords),
+	}
+}
+
+func TestQueryRouter_CostBudgetRoutesToSLM(t *testing.T) {
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65, CostThresholdUSD: 0.002})
+	router.SetModelPool(nil, "gpt-3.5-turbo", nil)
+
+	decision, err := router.Route(context.Background(), contextQuery(10))
+	require.NoError(t, err)
+	assert.True(t, decision.UseLLM, "a cheap request stays on the LLM")
+	assert.Positive(t, decision.EstimatedCostUSD)
+
+	decision, err = router.Route(context.Background(), contextQuery(5000))
+	require.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Contains(t, decision.Reason, "exceeds budget")
+}
+
+func TestQueryRouter_CostBudgetRejects(t *testing.T) {
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65, CostThresholdUSD: 0.002, CostAction: CostActionReject})
+
+	_, err := router.Route(context.Background(), contextQuery(5000))
+	assert.ErrorIs(t, err, ErrCostBudgetExceeded)
+
+	// Forced decisions are rejected too rather than silently moved
+	req := contextQuery(5000)
+	req.ModelPreference = "llm"
+	_, err = router.Route(context.Background(), req)
+	assert.ErrorIs(t, err, ErrCostBudgetExceeded)
+}
+
+func TestQueryRouter_LatencyBudget(t *testing.T) {
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65, LatencyBudgetMs: 1000})
+
+	for i := 0; i < latencyWindowMinSamples; i++ {
+		router.ObserveLLMLatency(3 * time.Second)
+	}
+	decision, err := router.Route(context.Background(), contextQuery(10))
+	require.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Contains(t, decision.Reason, "p95 latency")
+
+	// Client overrides are honored whatever the latency
+	req := contextQuery(10)
+	req.ModelPreference = "llm"
+	decision, err = router.Route(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+}
+
+func TestLatencyWindow_P95(t *testing.T) {
+	window := NewLatencyWindow()
+	_, ok := window.P95()
+	assert.False(t, ok)
+
+	for i := 1; i <= 100; i++ {
+		window.Observe(time.Duration(i) * time.Millisecond)
+	}
+	p95, ok := window.P95()
+	assert.True(t, ok)
+	assert.Equal(t, 95*time.Millisecond, p95)
+
+	// Old samples roll out of the window
+	for i := 0; i < latencyWindowSize; i++ {
+		window.Observe(time.Millisecond)
+	}
+	p95, _ = window.P95()
+	assert.Equal(t, time.Millisecond, p95)
+}
+
+func TestQueryRouter_SpendCapRoutesToOtherTier(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	caps := config.SpendCapsConfig{Caps: []config.SpendCapConfig{{Provider: "openai", MonthlyUSD: 1}}}
+
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65})
+	spendCaps := usage.NewSpendCaps(client, caps, "openai", "groq")
+	router.SetSpendCaps(spendCaps)
+	require.NoError(t, spendCaps.Record(context.Background(), true, 2))
+
+	decision, err := router.Route(context.Background(), contextQuery(10))
+	require.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Contains(t, decision.Reason, "spend cap")
+
+	caps.Action = usage.SpendActionReject
+	router.SetSpendCaps(usage.NewSpendCaps(client, caps, "openai", "groq"))
+	_, err = router.Route(context.Background(), contextQuery(10))
+	assert.ErrorIs(t, err, usage.ErrSpendCapReached)
+}
@@ -0,0 +1,106 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	// CacheKeysNormalized ignores case, extra whitespace and surrounding punctuation in the query
+	CacheKeysNormalized = "normalized"
+	// CacheKeysExact only matches byte-identical queries
+	CacheKeysExact = "exact"
+
+	cacheKeyPrefix = "inference:"
+
+	sentencePunctuation = `.,!?;:'"…¿¡`
+)
+
+// CacheKeyStrategy derives the response cache key for a request. Requests
+// with the same key share a cached answer.
+type CacheKeyStrategy interface {
+	Key(req *models.InferenceRequest) string
+}
+
+// NewCacheKeyStrategy returns the strategy named by router.cache_keys,
+// defaulting to normalized keys
+func NewCacheKeyStrategy(name string) CacheKeyStrategy {
+	if name == CacheKeysExact {
+		return &ParameterCacheKeys{}
+	}
+	return &ParameterCacheKeys{Normalize: true}
+}
+
+// ParameterCacheKeys hashes the query and context together with every
+// parameter that changes the answer (generation settings, output format,
+// capabilities and model overrides) into a SHA-256 key
+type ParameterCacheKeys struct {
+	Normalize bool // Normalize the query before hashing
+}
+
+func (k *ParameterCacheKeys) Key(req *models.InferenceRequest) string {
+	query := req.Query
+	context := req.Context
+	if k.Normalize {
+		query = NormalizeQuery(query)
+		context = strings.Join(strings.Fields(context), " ")
+	}
+
+	preference := req.TierPreference()
+	if preference == "auto" {
+		preference = ""
+	}
+	capabilities := slices.Clone(req.Capabilities)
+	slices.Sort(capabilities)
+	capabilities = slices.Compact(capabilities)
+
+	fields := []string{
+		query,
+		context,
+		strconv.FormatFloat(float64(req.Temperature), 'g', -1, 32),
+		strconv.Itoa(req.MaxTokens),
+		req.ResponseFormat,
+		strings.Join(capabilities, ","),
+		strconv.FormatBool(req.Complete),
+		preference,
+		req.Model,
+	}
+	// Conversation history, when present, is part of the prompt. Keys of
+	// requests without it are unchanged.
+	for _, message := range req.Messages {
+		content := message.Content
+		if k.Normalize {
+			content = strings.Join(strings.Fields(content), " ")
+		}
+		fields = append(fields, message.Role, content)
+	}
+	// Likewise for tools, which change what the model can answer with
+	if len(req.Tools) > 0 {
+		tools, _ := json.Marshal(req.Tools)
+		fields = append(fields, string(tools))
+	}
+
+	h := sha256.New()
+	for _, field := range fields {
+		// Length prefixes keep field boundaries unambiguous
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field + "|"))
+	}
+	return cacheKeyPrefix + hex.EncodeToString(h.Sum(nil))
+}
+
+// NormalizeQuery lowercases the query, collapses runs of whitespace and trims
+// sentence punctuation from both ends, so "What is Go?" and "  what is go "
+// match. Symbols such as the "#" in "C#" are kept.
+func NormalizeQuery(query string) string {
+	query = strings.ToLower(strings.Join(strings.Fields(query), " "))
+	return strings.TrimFunc(query, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(sentencePunctuation, r)
+	})
+}
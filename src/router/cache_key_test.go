@@ -0,0 +1,59 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestNormalizeQuery(t *testing.T) {
+	assert.Equal(t, "what is go", NormalizeQuery("  What   is\tGo? "))
+	assert.Equal(t, "what is c#", NormalizeQuery("What is C#?"), "symbols are kept")
+	assert.Equal(t, "hello, world", NormalizeQuery("Hello, World!!!"), "inner punctuation is kept")
+}
+
+func TestParameterCacheKeys(t *testing.T) {
+	normalized := NewCacheKeyStrategy(CacheKeysNormalized)
+	exact := NewCacheKeyStrategy(CacheKeysExact)
+
+	base := &models.InferenceRequest{Query: "What is Go?", Temperature: 0.7, MaxTokens: 100}
+	variant := &models.InferenceRequest{Query: "  what is go ", Temperature: 0.7, MaxTokens: 100}
+
+	assert.Equal(t, normalized.Key(base), normalized.Key(variant))
+	assert.NotEqual(t, exact.Key(base), exact.Key(variant))
+	assert.Regexp(t, `^inference:[0-9a-f]{64}$`, normalized.Key(base))
+
+	// Every parameter that changes the answer changes the key
+	for name, change := range map[string]func(req *models.InferenceRequest){
+		"temperature":     func(req *models.InferenceRequest) { req.Temperature = 0.2 },
+		"max_tokens":      func(req *models.InferenceRequest) { req.MaxTokens = 500 },
+		"response_format": func(req *models.InferenceRequest) { req.ResponseFormat = "json_object" },
+		"capabilities":    func(req *models.InferenceRequest) { req.Capabilities = []string{"vision"} },
+		"preference":      func(req *models.InferenceRequest) { req.ModelPreference = "llm" },
+		"model":           func(req *models.InferenceRequest) { req.Model = "gpt-4o" },
+		"context":         func(req *models.InferenceRequest) { req.Context = "We talked about Rust" },
+		"tools": func(req *models.InferenceRequest) {
+			req.Tools = []models.Tool{{Type: "function", Function: models.ToolFunction{Name: "get_weather"}}}
+		},
+	} {
+		changed := *base
+		change(&changed)
+		assert.NotEqual(t, normalized.Key(base), normalized.Key(&changed), name)
+	}
+
+	// "auto" is the same as no preference, and capability order doesn't matter
+	auto := *base
+	auto.ModelPreference = "auto"
+	assert.Equal(t, normalized.Key(base), normalized.Key(&auto))
+
+	a := &models.InferenceRequest{Query: "q", Capabilities: []string{"vision", "tools"}}
+	b := &models.InferenceRequest{Query: "q", Capabilities: []string{"tools", "vision"}}
+	assert.Equal(t, normalized.Key(a), normalized.Key(b))
+
+	// Field boundaries are unambiguous
+	assert.NotEqual(t,
+		exact.Key(&models.InferenceRequest{Query: "a|b", Context: ""}),
+		exact.Key(&models.InferenceRequest{Query: "a", Context: "b"}))
+}
@@ -0,0 +1,111 @@
+package router
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const complexityCachePrefix = "complexity:"
+
+const classifierPrompt = `Rate how much reasoning the following user query needs to be answered well, on a scale from 0 (small talk or a simple fact) to 1 (multi-step analysis, expert knowledge or long-form writing). Reply with only the number.
+
+Query: %s`
+
+var scorePattern = regexp.MustCompile(`\d*\.?\d+`)
+
+// ComplexityClassifier scores how complex a query is, from 0 to 1
+type ComplexityClassifier interface {
+	Classify(ctx context.Context, query string) (float64, error)
+}
+
+// LLMClassifier scores complexity with a small, cheap model. Scores are cached
+// in Redis so repeated queries cost one model call per cache TTL.
+type LLMClassifier struct {
+	llm     models.LLMInferencer
+	model   string
+	client  *redis.Client // Optional; scores aren't cached without it
+	ttl     time.Duration
+	timeout time.Duration
+}
+
+func NewLLMClassifier(llm models.LLMInferencer, client *redis.Client, cfg *config.ClassifierConfig) *LLMClassifier {
+	return &LLMClassifier{
+		llm:     llm,
+		model:   cfg.Model,
+		client:  client,
+		ttl:     cfg.CacheTTL,
+		timeout: cfg.Timeout,
+	}
+}
+
+func (c *LLMClassifier) Classify(ctx context.Context, query string) (float64, error) {
+	key := c.cacheKey(query)
+	if c.client != nil {
+		score, err := c.client.Get(ctx, key).Float64()
+		if err == nil {
+			return score, nil
+		}
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Failed to read cached complexity score: %v", err)
+		}
+	}
+
+	inferCtx := ctx
+	if c.timeout > 0 {
+		var cancel context.CancelFunc
+		inferCtx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	response, err := c.llm.Infer(inferCtx, &models.InferenceRequest{
+		Query:       fmt.Sprintf(classifierPrompt, query),
+		Temperature: 0.1,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("complexity classification failed: %w", err)
+	}
+
+	score, err := parseScore(response)
+	if err != nil {
+		return 0, err
+	}
+
+	if c.client != nil {
+		if err := c.client.Set(ctx, key, score, c.ttl).Err(); err != nil {
+			log.Printf("Failed to cache complexity score: %v", err)
+		}
+	}
+	return score, nil
+}
+
+// cacheKey includes the model so switching classifiers doesn't reuse old scores
+func (c *LLMClassifier) cacheKey(query string) string {
+	hash := md5.Sum([]byte(c.model + "|" + query))
+	return complexityCachePrefix + hex.EncodeToString(hash[:])
+}
+
+// parseScore reads the first number in the classifier's reply, clamped to 0-1
+func parseScore(response string) (float64, error) {
+	match := scorePattern.FindString(response)
+	if match == "" {
+		return 0, fmt.Errorf("classifier returned no score: %q", response)
+	}
+
+	score, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, fmt.Errorf("classifier returned an invalid score %q: %w", match, err)
+	}
+	return math.Min(math.Max(score, 0), 1), nil
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/mocks"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+type stubClassifier struct {
+	score float64
+	err   error
+	calls int
+}
+
+func (s *stubClassifier) Classify(ctx context.Context, query string) (float64, error) {
+	s.calls++
+	return s.score, s.err
+}
+
+func TestLLMClassifier_CachesScores(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	llm := new(mocks.MockLLMClient)
+	llm.On("Infer", mock.Anything, mock.Anything).Return("Score: 0.8", nil).Once()
+
+	classifier := NewLLMClassifier(llm, client, &config.ClassifierConfig{Model: "gpt-4o-mini", CacheTTL: time.Hour})
+
+	score, err := classifier.Classify(context.Background(), "Compare B-trees and LSM trees")
+	require.NoError(t, err)
+	assert.Equal(t, 0.8, score)
+
+	// Served from Redis, the mock would fail a second call
+	score, err = classifier.Classify(context.Background(), "Compare B-trees and LSM trees")
+	require.NoError(t, err)
+	assert.Equal(t, 0.8, score)
+	llm.AssertExpectations(t)
+
+	assert.Len(t, mr.Keys(), 1)
+	assert.Equal(t, time.Hour, mr.TTL(mr.Keys()[0]))
+}
+
+func TestParseScore(t *testing.T) {
+	score, err := parseScore(" 0.35\n")
+	require.NoError(t, err)
+	assert.Equal(t, 0.35, score)
+
+	score, err = parseScore("7")
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, score, "clamped to 1")
+
+	_, err = parseScore("hard to say")
+	assert.Error(t, err)
+}
+
+func TestClassifierRoutingStrategy_UsesClassifierScore(t *testing.T) {
+	cfg := &config.RouterConfig{ComplexityThreshold: 0.65}
+	classifier := &stubClassifier{score: 0.9}
+	strategy := NewClassifierRoutingStrategy(cfg, classifier, 0)
+
+	// The heuristic would send this short query to the SLM
+	decision := strategy.Decide(context.Background(), &models.InferenceRequest{Query: "Prove P != NP"}, &models.QueryMetrics{Complexity: 0.2, TokenCount: 3})
+
+	assert.True(t, decision.UseLLM)
+	assert.Equal(t, 0.9, decision.ComplexityScore)
+	assert.Contains(t, decision.Reason, "Classifier scored complexity 0.90")
+}
+
+func TestClassifierRoutingStrategy_HybridOnlyClassifiesBorderlineScores(t *testing.T) {
+	cfg := &config.RouterConfig{ComplexityThreshold: 0.65}
+	classifier := &stubClassifier{score: 0.3}
+	strategy := NewClassifierRoutingStrategy(cfg, classifier, 0.15)
+
+	decision := strategy.Decide(context.Background(), &models.InferenceRequest{Query: "hi"}, &models.QueryMetrics{Complexity: 0.1, TokenCount: 1})
+	assert.False(t, decision.UseLLM)
+	assert.Contains(t, decision.Reason, "Simple query")
+	assert.Equal(t, 0, classifier.calls, "clear-cut scores skip the classifier")
+
+	decision = strategy.Decide(context.Background(), &models.InferenceRequest{Query: "Why is the sky blue?"}, &models.QueryMetrics{Complexity: 0.7, TokenCount: 5})
+	assert.False(t, decision.UseLLM)
+	assert.Equal(t, 1, classifier.calls)
+}
+
+func TestClassifierRoutingStrategy_FallsBackToHeuristic(t *testing.T) {
+	cfg := &config.RouterConfig{ComplexityThreshold: 0.65}
+	strategy := NewClassifierRoutingStrategy(cfg, &stubClassifier{err: errors.New("timeout")}, 0)
+
+	decision := strategy.Decide(context.Background(), &models.InferenceRequest{Query: "Explain"}, &models.QueryMetrics{Complexity: 0.8, TokenCount: 1})
+
+	assert.True(t, decision.UseLLM)
+	assert.Contains(t, decision.Reason, "High complexity")
+	assert.Contains(t, decision.Reason, "classifier unavailable")
+}
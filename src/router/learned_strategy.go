@@ -0,0 +1,282 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// StrategyLearned routes with a model trained offline on exported routing examples
+const StrategyLearned = "learned"
+
+// Learned model types
+const (
+	ModelLogisticRegression = "logistic_regression"
+	ModelGradientBoosted    = "gradient_boosted"
+)
+
+const (
+	learnedModelKey               = "router:learned_model"
+	defaultLearnedRefreshInterval = 30 * time.Second
+	defaultLearnedThreshold       = 0.5
+)
+
+// FeatureNames are the routing features a learned model can use, as recorded
+// in every routing decision and exported with the routing examples
+var FeatureNames = []string{
+	"complexity", "token_count", "query_length", "has_context", "message_count",
+	"max_tokens", "capabilities", "json_mode", "complete",
+}
+
+// ErrInvalidModel is returned when importing a learned model that can't be used
+var ErrInvalidModel = errors.New("invalid learned routing model")
+
+// RoutingFeatures returns the feature vector of a request
+func RoutingFeatures(req *models.InferenceRequest, metrics *models.QueryMetrics) map[string]float64 {
+	return map[string]float64{
+		"complexity":    metrics.Complexity,
+		"token_count":   float64(metrics.TokenCount),
+		"query_length":  float64(metrics.QueryLength),
+		"has_context":   boolFeature(metrics.HasContext),
+		"message_count": float64(len(req.Messages)),
+		"max_tokens":    float64(req.MaxTokens),
+		"capabilities":  float64(len(req.RequiredCapabilities())),
+		"json_mode":     boolFeature(req.ResponseFormat == "json_object"),
+		"complete":      boolFeature(req.Complete),
+	}
+}
+
+func boolFeature(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// LearnedModel predicts the probability that a request needs the LLM tier,
+// either as a logistic regression over the features or as the sigmoid of a
+// gradient-boosted tree ensemble's summed leaves
+type LearnedModel struct {
+	Type      string    `json:"type"`
+	Version   string    `json:"version"`             // Free-form, reported in routing reasons
+	Threshold float64   `json:"threshold,omitempty"` // Route to the LLM from this probability; 0.5 by default
+	Features  []string  `json:"features,omitempty"`  // logistic_regression: the features Weights apply to
+	Weights   []float64 `json:"weights,omitempty"`
+	Bias      float64   `json:"bias,omitempty"` // Intercept, or the trees' base score
+	Trees     []Tree    `json:"trees,omitempty"`
+}
+
+// Tree is one regression tree; Nodes[0] is the root
+type Tree struct {
+	Nodes []TreeNode `json:"nodes"`
+}
+
+// TreeNode is a split sending requests whose feature is below the threshold
+// to the left node, or a leaf when Leaf is set
+type TreeNode struct {
+	Feature   string   `json:"feature,omitempty"`
+	Threshold float64  `json:"threshold,omitempty"`
+	Left      int      `json:"left,omitempty"`
+	Right     int      `json:"right,omitempty"`
+	Leaf      *float64 `json:"leaf,omitempty"`
+}
+
+// Validate checks that the model can be evaluated
+func (m *LearnedModel) Validate() error {
+	if m.Threshold < 0 || m.Threshold >= 1 {
+		return fmt.Errorf("%w: threshold must be between 0 and 1", ErrInvalidModel)
+	}
+
+	switch m.Type {
+	case ModelLogisticRegression:
+		if len(m.Features) == 0 || len(m.Features) != len(m.Weights) {
+			return fmt.Errorf("%w: needs one weight per feature", ErrInvalidModel)
+		}
+		for _, feature := range m.Features {
+			if !slices.Contains(FeatureNames, feature) {
+				return fmt.Errorf("%w: unknown feature %q", ErrInvalidModel, feature)
+			}
+		}
+	case ModelGradientBoosted:
+		if len(m.Trees) == 0 {
+			return fmt.Errorf("%w: needs at least one tree", ErrInvalidModel)
+		}
+		for i, tree := range m.Trees {
+			if err := tree.validate(); err != nil {
+				return fmt.Errorf("%w: tree %d: %v", ErrInvalidModel, i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidModel, m.Type)
+	}
+	return nil
+}
+
+func (t *Tree) validate() error {
+	if len(t.Nodes) == 0 {
+		return errors.New("has no nodes")
+	}
+	for i, node := range t.Nodes {
+		if node.Leaf != nil {
+			continue
+		}
+		if !slices.Contains(FeatureNames, node.Feature) {
+			return fmt.Errorf("node %d splits on unknown feature %q", i, node.Feature)
+		}
+		// Children come after their parent, so evaluation always ends
+		if node.Left <= i || node.Right <= i || node.Left >= len(t.Nodes) || node.Right >= len(t.Nodes) {
+			return fmt.Errorf("node %d has children out of order or range", i)
+		}
+	}
+	return nil
+}
+
+// Predict returns the probability that a request with these features needs the LLM
+func (m *LearnedModel) Predict(features map[string]float64) float64 {
+	score := m.Bias
+	if m.Type == ModelLogisticRegression {
+		for i, feature := range m.Features {
+			score += m.Weights[i] * features[feature]
+		}
+	} else {
+		for _, tree := range m.Trees {
+			score += tree.evaluate(features)
+		}
+	}
+	return 1 / (1 + math.Exp(-score))
+}
+
+func (t *Tree) evaluate(features map[string]float64) float64 {
+	node := t.Nodes[0]
+	for node.Leaf == nil {
+		if features[node.Feature] < node.Threshold {
+			node = t.Nodes[node.Left]
+		} else {
+			node = t.Nodes[node.Right]
+		}
+	}
+	return *node.Leaf
+}
+
+func (m *LearnedModel) threshold() float64 {
+	if m.Threshold > 0 {
+		return m.Threshold
+	}
+	return defaultLearnedThreshold
+}
+
+// LearnedRoutingStrategy routes with the learned model imported through the
+// admin API. The model is kept in Redis so every instance uses the same one;
+// until one has been imported the heuristic strategy decides.
+type LearnedRoutingStrategy struct {
+	client    *redis.Client
+	heuristic RoutingStrategy
+	model     atomic.Pointer[LearnedModel]
+}
+
+func NewLearnedRoutingStrategy(cfg *config.RouterConfig, client *redis.Client) *LearnedRoutingStrategy {
+	return &LearnedRoutingStrategy{
+		client:    client,
+		heuristic: NewHybridRoutingStrategy(cfg),
+	}
+}
+
+func (s *LearnedRoutingStrategy) Decide(ctx context.Context, req *models.InferenceRequest, metrics *models.QueryMetrics) *models.RoutingDecision {
+	model := s.model.Load()
+	if model == nil {
+		decision := s.heuristic.Decide(ctx, req, metrics)
+		decision.Reason += " (no learned model)"
+		return decision
+	}
+
+	p := model.Predict(RoutingFeatures(req, metrics))
+	decision := &models.RoutingDecision{
+		ComplexityScore: metrics.Complexity,
+		Confidence:      math.Max(p, 1-p),
+	}
+	if p >= model.threshold() {
+		decision.UseLLM = true
+		decision.Reason = fmt.Sprintf("Learned model %s predicts the LLM is needed (p=%.2f)", model.Version, p)
+	} else {
+		decision.Reason = fmt.Sprintf("Learned model %s predicts the edge SLM suffices (p=%.2f)", model.Version, p)
+	}
+	return decision
+}
+
+// Model returns the model in use, or nil if none has been imported
+func (s *LearnedRoutingStrategy) Model() *LearnedModel {
+	return s.model.Load()
+}
+
+// Import validates a model, stores it for every instance and starts using it
+func (s *LearnedRoutingStrategy) Import(ctx context.Context, model *LearnedModel) error {
+	if err := model.Validate(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(model)
+	if err != nil {
+		return fmt.Errorf("failed to encode learned model: %w", err)
+	}
+	if err := s.client.Set(ctx, learnedModelKey, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to store learned model: %w", err)
+	}
+	s.model.Store(model)
+	return nil
+}
+
+// Load reads the stored model. A stored model that fails validation, which
+// could only come from another version, is ignored.
+func (s *LearnedRoutingStrategy) Load(ctx context.Context) error {
+	data, err := s.client.Get(ctx, learnedModelKey).Bytes()
+	if err == redis.Nil {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load learned model: %w", err)
+	}
+
+	var model LearnedModel
+	if err := json.Unmarshal(data, &model); err != nil {
+		return fmt.Errorf("failed to decode learned model: %w", err)
+	}
+	if err := model.Validate(); err != nil {
+		return err
+	}
+	if current := s.model.Load(); current == nil || current.Version != model.Version {
+		log.Printf("✓ Routing with learned model %s (%s)", model.Version, model.Type)
+	}
+	s.model.Store(&model)
+	return nil
+}
+
+// Watch picks up models imported on other instances until ctx is done
+func (s *LearnedRoutingStrategy) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultLearnedRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil {
+				log.Printf("⚠️  Keeping the current learned routing model: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func leaf(v float64) *float64 {
+	return &v
+}
+
+func TestLearnedModel_Predict(t *testing.T) {
+	logistic := &LearnedModel{
+		Type:     ModelLogisticRegression,
+		Features: []string{"complexity", "has_context"},
+		Weights:  []float64{10, 2},
+		Bias:     -6,
+	}
+	require.NoError(t, logistic.Validate())
+	assert.Less(t, logistic.Predict(map[string]float64{"complexity": 0.2}), 0.5)
+	assert.Greater(t, logistic.Predict(map[string]float64{"complexity": 0.5, "has_context": 1}), 0.5)
+
+	boosted := &LearnedModel{
+		Type: ModelGradientBoosted,
+		Trees: []Tree{{Nodes: []TreeNode{
+			{Feature: "token_count", Threshold: 100, Left: 1, Right: 2},
+			{Leaf: leaf(-2)},
+			{Leaf: leaf(3)},
+		}}},
+	}
+	require.NoError(t, boosted.Validate())
+	assert.Less(t, boosted.Predict(map[string]float64{"token_count": 20}), 0.5)
+	assert.Greater(t, boosted.Predict(map[string]float64{"token_count": 200}), 0.5)
+}
+
+func TestLearnedModel_Validate(t *testing.T) {
+	for name, model := range map[string]*LearnedModel{
+		"unknown type":     {Type: "random_forest"},
+		"weight count":     {Type: ModelLogisticRegression, Features: []string{"complexity"}},
+		"unknown feature":  {Type: ModelLogisticRegression, Features: []string{"zodiac"}, Weights: []float64{1}},
+		"no trees":         {Type: ModelGradientBoosted},
+		"cycle":            {Type: ModelGradientBoosted, Trees: []Tree{{Nodes: []TreeNode{{Feature: "complexity", Left: 0, Right: 0}}}}},
+		"out of range":     {Type: ModelGradientBoosted, Trees: []Tree{{Nodes: []TreeNode{{Feature: "complexity", Left: 1, Right: 2}}}}},
+		"threshold over 1": {Type: ModelLogisticRegression, Features: []string{"complexity"}, Weights: []float64{1}, Threshold: 2},
+	} {
+		assert.ErrorIs(t, model.Validate(), ErrInvalidModel, name)
+	}
+}
+
+func TestLearnedRoutingStrategy(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	cfg := &config.RouterConfig{ComplexityThreshold: 0.65}
+	ctx := context.Background()
+	metrics := &models.QueryMetrics{Complexity: 0.3, TokenCount: 5, HasContext: true}
+
+	strategy := NewLearnedRoutingStrategy(cfg, client)
+	decision := strategy.Decide(ctx, &models.InferenceRequest{}, metrics)
+	assert.Contains(t, decision.Reason, "no learned model")
+	assert.True(t, decision.UseLLM, "the heuristic sends context-aware queries to the LLM")
+
+	model := &LearnedModel{
+		Type:     ModelLogisticRegression,
+		Version:  "v1",
+		Features: []string{"complexity"},
+		Weights:  []float64{10},
+		Bias:     -5,
+	}
+	require.NoError(t, strategy.Import(ctx, model))
+	decision = strategy.Decide(ctx, &models.InferenceRequest{}, metrics)
+	assert.False(t, decision.UseLLM)
+	assert.Contains(t, decision.Reason, "Learned model v1")
+	assert.InDelta(t, 0.88, decision.Confidence, 0.01)
+
+	// Another instance picks the imported model up from Redis
+	other := NewLearnedRoutingStrategy(cfg, client)
+	require.NoError(t, other.Load(ctx))
+	assert.Equal(t, "v1", other.Model().Version)
+
+	assert.ErrorIs(t, strategy.Import(ctx, &LearnedModel{Type: "random_forest"}), ErrInvalidModel)
+	assert.Equal(t, "v1", strategy.Model().Version)
+}
+
+func TestQueryRouter_RecordsFeatures(t *testing.T) {
+	r := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65})
+	decision, err := r.Route(context.Background(), &models.InferenceRequest{Query: "What is two plus two?", MaxTokens: 50})
+	require.NoError(t, err)
+
+	assert.Len(t, decision.Features, len(FeatureNames))
+	assert.Equal(t, float64(6), decision.Features["token_count"])
+	assert.Equal(t, float64(50), decision.Features["max_tokens"])
+}
@@ -2,42 +2,328 @@ package router
 
 import (
 	"context"
-	"crypto/md5"
-	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 	"unicode"
 
+	"go.opentelemetry.io/otel/attribute"
+
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
+	"www.github.com/Wanderer0074348/HybridLM/src/tracing"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+var (
+	// ErrNoCapableModel is returned when neither tier has a model with the capabilities a request needs
+	ErrNoCapableModel = errors.New("no configured model supports the requested capabilities")
+	// ErrUnknownModel is returned when a client asks for a model that isn't served by the requested tier
+	ErrUnknownModel = errors.New("requested model is not available")
 )
 
 type QueryRouter struct {
-	config   *config.RouterConfig
-	strategy RoutingStrategy
+	config    *config.RouterConfig
+	strategy  RoutingStrategy
+	policies  *PolicyEngine    // Operator routing overrides, optional
+	residency *Residency       // Data residency rules, optional
+	spendCaps *usage.SpendCaps // Monthly spend caps per provider key, optional
+	cacheKeys CacheKeyStrategy
+
+	llmLatency *LatencyWindow // Rolling LLM latencies for the latency budget
+
+	// Model pool used for capability filtering (optional)
+	modelRegistry *registry.ModelRegistry
+	llmModel      string
+	slmModels     []string
 }
 
 func NewQueryRouter(cfg *config.RouterConfig) *QueryRouter {
 	return &QueryRouter{
-		config:   cfg,
-		strategy: NewHybridRoutingStrategy(cfg),
+		config:     cfg,
+		strategy:   NewHybridRoutingStrategy(cfg),
+		cacheKeys:  NewCacheKeyStrategy(cfg.CacheKeys),
+		llmLatency: NewLatencyWindow(),
+	}
+}
+
+// SetModelPool enables capability-aware routing against the given LLM and SLM models
+func (r *QueryRouter) SetModelPool(modelRegistry *registry.ModelRegistry, llmModel string, slmModels []string) {
+	r.modelRegistry = modelRegistry
+	r.llmModel = llmModel
+	r.slmModels = slmModels
+}
+
+// SetClassifier enables the "llm_classifier" and "hybrid" strategies selected
+// by router.strategy; with the heuristic strategy the classifier is unused
+func (r *QueryRouter) SetClassifier(classifier ComplexityClassifier) {
+	switch r.config.Strategy {
+	case StrategyLLMClassifier:
+		r.strategy = NewClassifierRoutingStrategy(r.config, classifier, 0)
+	case StrategyHybrid:
+		r.strategy = NewClassifierRoutingStrategy(r.config, classifier, r.config.Classifier.HybridMargin)
 	}
 }
 
+// SetStrategy replaces the routing strategy, for strategies that need more
+// than the router config, like the learned one
+func (r *QueryRouter) SetStrategy(strategy RoutingStrategy) {
+	r.strategy = strategy
+}
+
+// SetCacheKeyStrategy replaces the strategy configured by router.cache_keys
+func (r *QueryRouter) SetCacheKeyStrategy(strategy CacheKeyStrategy) {
+	r.cacheKeys = strategy
+}
+
+// ObserveLLMLatency records how long an LLM call took, for the latency budget
+func (r *QueryRouter) ObserveLLMLatency(latency time.Duration) {
+	r.llmLatency.Observe(latency)
+}
+
+// SetPolicies makes matching routing policies override the routing strategy
+func (r *QueryRouter) SetPolicies(policies *PolicyEngine) {
+	r.policies = policies
+}
+
+// Route decides which tier and model serve the request
 func (r *QueryRouter) Route(ctx context.Context, req *models.InferenceRequest) (*models.RoutingDecision, error) {
+	ctx, span := tracing.Start(ctx, "router.Route")
+	decision, err := r.route(ctx, req)
+	if decision != nil {
+		span.SetAttributes(
+			attribute.String("hybridlm.tier", tierName(decision.UseLLM)),
+			attribute.String("hybridlm.model", decision.Model),
+			attribute.Float64("hybridlm.complexity", decision.ComplexityScore),
+		)
+	}
+	tracing.End(span, err)
+	return decision, err
+}
+
+func (r *QueryRouter) route(ctx context.Context, req *models.InferenceRequest) (*models.RoutingDecision, error) {
 	metrics := r.analyzeQuery(req)
-	decision := r.strategy.Decide(metrics)
 
+	// An explicit client preference wins over everything but capabilities
+	decision, err := r.clientOverride(req, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out tiers that can't serve the request before asking the strategy
+	if decision == nil {
+		decision, err = r.applyCapabilityConstraints(req, metrics)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if decision == nil && r.policies != nil {
+		decision = r.policies.Evaluate(ctx, req, metrics)
+	}
+	if decision == nil {
+		// Side calls the strategy makes, like the LLM classifier's, are for the
+		// request's user, whose regions and privacy rules they're held to
+		strategyCtx := ctx
+		if req.UserID != "" {
+			strategyCtx = correlation.WithUserID(ctx, req.UserID)
+		}
+		decision = r.strategy.Decide(strategyCtx, req, metrics)
+	}
+
+	// A policy may already have named the model
+	if decision.Model == "" {
+		r.selectTarget(decision, req.RequiredCapabilities())
+	}
+
+	if err := r.applyBudgets(req, decision); err != nil {
+		return nil, err
+	}
+	if err := r.applySpendCaps(ctx, req, decision); err != nil {
+		return nil, err
+	}
+	if err := r.applyResidency(ctx, req, decision); err != nil {
+		return nil, err
+	}
+
+	decision.Features = RoutingFeatures(req, metrics)
 	return decision, nil
 }
 
+// selectTarget picks a specific model within the decided tier from the
+// configured routing targets: the first one whose complexity band covers the
+// query, or the tier's last (most capable) target if none does. Targets
+// lacking a required capability are skipped.
+func (r *QueryRouter) selectTarget(decision *models.RoutingDecision, required []string) {
+	tier := "slm"
+	if decision.UseLLM {
+		tier = "llm"
+	}
+
+	var candidate *config.RoutingTargetConfig
+	for i := range r.config.Targets {
+		target := &r.config.Targets[i]
+		if target.Tier != tier {
+			continue
+		}
+		if r.modelRegistry != nil && !r.supportsAll(target.Model, required) {
+			continue
+		}
+		candidate = target
+		if target.MaxComplexity <= 0 || decision.ComplexityScore <= target.MaxComplexity {
+			break
+		}
+	}
+	if candidate == nil {
+		return
+	}
+
+	decision.Model = candidate.Model
+	decision.Reason = fmt.Sprintf("%s → %s", decision.Reason, candidate.Model)
+}
+
+// clientOverride honors the request's model_preference (or metadata.force_tier)
+// and model. A model without a preference (or with "auto") implies its tier.
+// Returns nil when the client left routing to the router.
+func (r *QueryRouter) clientOverride(req *models.InferenceRequest, metrics *models.QueryMetrics) (*models.RoutingDecision, error) {
+	preference := req.TierPreference()
+	if req.Model != "" && (preference == "" || preference == "auto") {
+		tier, ok := r.tierOf(req.Model)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownModel, req.Model)
+		}
+		preference = tier
+	}
+	if preference != "llm" && preference != "slm" {
+		return nil, nil
+	}
+
+	reason := "Client override: " + preference
+	if req.Model != "" {
+		if !r.servesModel(preference, req.Model) {
+			return nil, fmt.Errorf("%w: %s is not a %s model", ErrUnknownModel, req.Model, preference)
+		}
+		reason = fmt.Sprintf("Client override: %s (%s)", preference, req.Model)
+	}
+
+	required := req.RequiredCapabilities()
+	if r.modelRegistry != nil && len(required) > 0 && !r.tierSupports(preference, req.Model, required) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCapableModel, strings.Join(required, ", "))
+	}
+
+	return &models.RoutingDecision{
+		UseLLM:          preference == "llm",
+		Reason:          reason,
+		Confidence:      1.0,
+		ComplexityScore: metrics.Complexity,
+		Forced:          true,
+		Model:           req.Model,
+	}, nil
+}
+
+// tierOf returns the tier serving a model, using the model pool and registry
+func (r *QueryRouter) tierOf(model string) (string, bool) {
+	switch {
+	case r.servesModel("slm", model) && len(r.slmModels) > 0:
+		return "slm", true
+	case r.servesModel("llm", model) && (r.llmModel != "" || r.modelRegistry != nil):
+		return "llm", true
+	}
+	return "", false
+}
+
+// servesModel reports whether a tier can run a model. The SLM tier only runs
+// its configured models; the LLM tier runs any LLM in the registry. Without a
+// model pool every model is accepted.
+func (r *QueryRouter) servesModel(tier string, model string) bool {
+	if tier == "slm" {
+		return len(r.slmModels) == 0 || slices.Contains(r.slmModels, model)
+	}
+	if model == r.llmModel || r.modelRegistry == nil {
+		return true
+	}
+	info, ok := r.modelRegistry.Get(model)
+	return ok && info.Tier == "llm"
+}
+
+// tierSupports checks the requested model, or else every model the tier may use
+func (r *QueryRouter) tierSupports(tier string, model string, required []string) bool {
+	switch {
+	case model != "":
+		return r.supportsAll(model, required)
+	case tier == "llm":
+		return r.supportsAll(r.llmModel, required)
+	}
+	for _, slm := range r.slmModels {
+		if !r.supportsAll(slm, required) {
+			return false
+		}
+	}
+	return len(r.slmModels) > 0
+}
+
+// applyCapabilityConstraints forces the tier when only one of them has the
+// capabilities the request needs, and fails when neither does
+func (r *QueryRouter) applyCapabilityConstraints(req *models.InferenceRequest, metrics *models.QueryMetrics) (*models.RoutingDecision, error) {
+	required := req.RequiredCapabilities()
+	if r.modelRegistry == nil || len(required) == 0 {
+		return nil, nil
+	}
+
+	llmCapable := r.supportsAll(r.llmModel, required)
+	slmCapable := len(r.slmModels) > 0
+	for _, model := range r.slmModels {
+		if !r.supportsAll(model, required) {
+			slmCapable = false
+			break
+		}
+	}
+
+	switch {
+	case llmCapable && slmCapable:
+		return nil, nil
+	case llmCapable:
+		return &models.RoutingDecision{
+			UseLLM:          true,
+			Reason:          fmt.Sprintf("Capability constraint: only LLM supports %s", strings.Join(required, ", ")),
+			Confidence:      1.0,
+			ComplexityScore: metrics.Complexity,
+			Forced:          true,
+		}, nil
+	case slmCapable:
+		return &models.RoutingDecision{
+			UseLLM:          false,
+			Reason:          fmt.Sprintf("Capability constraint: only SLM supports %s", strings.Join(required, ", ")),
+			Confidence:      1.0,
+			ComplexityScore: metrics.Complexity,
+			Forced:          true,
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrNoCapableModel, strings.Join(required, ", "))
+	}
+}
+
+func (r *QueryRouter) supportsAll(model string, capabilities []string) bool {
+	for _, capability := range capabilities {
+		if !r.modelRegistry.Supports(model, capability) {
+			return false
+		}
+	}
+	return true
+}
+
 func (r *QueryRouter) analyzeQuery(req *models.InferenceRequest) *models.QueryMetrics {
 	metrics := &models.QueryMetrics{
 		QueryLength: len(req.Query),
-		HasContext:  len(req.Context) > 0,
+		HasContext:  len(req.Context) > 0 || len(req.Messages) > 0,
 	}
 
-	// Estimate token count (rough approximation)
-	metrics.TokenCount = len(strings.Fields(req.Query))
+	// The target model isn't known yet, so count in the default encoding
+	metrics.TokenCount = utils.CountTokens(req.Query, "")
 
 	// Calculate complexity score
 	metrics.Complexity = r.calculateComplexity(req.Query)
@@ -93,8 +379,7 @@ func (r *QueryRouter) calculateComplexity(query string) float64 {
 	return score
 }
 
+// GenerateCacheKey returns the response cache key for a request
 func (r *QueryRouter) GenerateCacheKey(req *models.InferenceRequest) string {
-	data := req.Query + "|" + req.Context
-	hash := md5.Sum([]byte(data))
-	return "inference:" + hex.EncodeToString(hash[:])
+	return r.cacheKeys.Key(req)
 }
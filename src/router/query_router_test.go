@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
 )
 
 func TestQueryRouter_SimpleQuery(t *testing.T) {
@@ -79,6 +80,50 @@ func TestQueryRouter_CacheKey(t *testing.T) {
 	assert.NotEqual(t, key1, key3)
 }
 
+func TestQueryRouter_CapabilityConstraint(t *testing.T) {
+	cfg := &config.RouterConfig{
+		ComplexityThreshold: 0.65,
+	}
+	router := NewQueryRouter(cfg)
+	router.SetModelPool(
+		registry.NewModelRegistry(nil),
+		"gpt-4o",
+		[]string{"llama-3.1-8b-instant", "mixtral-8x7b-32768"},
+	)
+
+	// Simple query would normally go to the SLM, but mixtral lacks JSON mode
+	req := &models.InferenceRequest{
+		Query:          "What is 2+2?",
+		ResponseFormat: "json_object",
+	}
+	decision, err := router.Route(context.Background(), req)
+	assert.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+	assert.Contains(t, decision.Reason, "Capability constraint")
+
+	// Nobody in the pool supports an unknown capability
+	req = &models.InferenceRequest{
+		Query:        "What is 2+2?",
+		Capabilities: []string{"audio"},
+	}
+	_, err = router.Route(context.Background(), req)
+	assert.ErrorIs(t, err, ErrNoCapableModel)
+
+	// Requests with tools need a model that supports function calling
+	router.SetModelPool(
+		registry.NewModelRegistry([]config.ModelInfoConfig{{Name: "local-phi", Tier: "slm", ContextWindow: 4096}}),
+		"gpt-4o",
+		[]string{"local-phi"},
+	)
+	req = &models.InferenceRequest{
+		Query: "What is 2+2?",
+		Tools: []models.Tool{{Type: "function", Function: models.ToolFunction{Name: "calculator"}}},
+	}
+	decision, err = router.Route(context.Background(), req)
+	assert.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+}
+
 func BenchmarkQueryRouter_Route(b *testing.B) {
 	cfg := &config.RouterConfig{
 		ComplexityThreshold: 0.65,
@@ -94,3 +139,97 @@ func BenchmarkQueryRouter_Route(b *testing.B) {
 		router.Route(context.Background(), req)
 	}
 }
+
+func TestQueryRouter_RoutingTargets(t *testing.T) {
+	cfg := &config.RouterConfig{
+		ComplexityThreshold: 0.65,
+		Targets: []config.RoutingTargetConfig{
+			{Model: "llama-3.1-8b-instant", Tier: "slm", MaxComplexity: 0.35},
+			{Model: "llama-3.3-70b-versatile", Tier: "slm", MaxComplexity: 0.65},
+			{Model: "gpt-4o", Tier: "llm"},
+		},
+	}
+	router := NewQueryRouter(cfg)
+
+	decision, err := router.Route(context.Background(), &models.InferenceRequest{Query: "What is 2+2?"})
+	assert.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Equal(t, "llama-3.1-8b-instant", decision.Model)
+	assert.Contains(t, decision.Reason, "llama-3.1-8b-instant")
+
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "Explain why the sky is blue"})
+	assert.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Equal(t, "llama-3.3-70b-versatile", decision.Model)
+
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{
+		Query:   "What are the bottlenecks?",
+		Context: "We have a distributed system with Redis caching.",
+	})
+	assert.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+	assert.Equal(t, "gpt-4o", decision.Model)
+
+	// Targets without a required capability are skipped
+	router.SetModelPool(registry.NewModelRegistry(nil), "gpt-4o", []string{"llama-3.1-8b-instant", "llama-3.3-70b-versatile"})
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "Describe this image", Capabilities: []string{"vision"}})
+	assert.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+	assert.Equal(t, "gpt-4o", decision.Model)
+}
+
+func TestQueryRouter_ClientOverride(t *testing.T) {
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65})
+	router.SetModelPool(registry.NewModelRegistry(nil), "gpt-3.5-turbo", []string{"llama-3.1-8b-instant", "llama-3.3-70b-versatile"})
+
+	decision, err := router.Route(context.Background(), &models.InferenceRequest{Query: "What is 2+2?", ModelPreference: "llm"})
+	assert.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+	assert.True(t, decision.Forced)
+	assert.Equal(t, "Client override: llm", decision.Reason)
+
+	// The model's tier is inferred with "auto"
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "What is 2+2?", Model: "gpt-4o"})
+	assert.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+	assert.Equal(t, "gpt-4o", decision.Model)
+
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "What is 2+2?", ModelPreference: "slm", Model: "llama-3.3-70b-versatile"})
+	assert.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Equal(t, "Client override: slm (llama-3.3-70b-versatile)", decision.Reason)
+
+	_, err = router.Route(context.Background(), &models.InferenceRequest{Query: "hi", ModelPreference: "slm", Model: "gpt-4o"})
+	assert.ErrorIs(t, err, ErrUnknownModel)
+
+	_, err = router.Route(context.Background(), &models.InferenceRequest{Query: "hi", Model: "claude-9"})
+	assert.ErrorIs(t, err, ErrUnknownModel)
+
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "What is 2+2?", ModelPreference: "auto"})
+	assert.NoError(t, err)
+	assert.Contains(t, decision.Reason, "Simple query")
+
+	// Overrides are cached separately
+	plain := router.GenerateCacheKey(&models.InferenceRequest{Query: "hi"})
+	assert.Equal(t, plain, router.GenerateCacheKey(&models.InferenceRequest{Query: "hi", ModelPreference: "auto"}))
+	assert.NotEqual(t, plain, router.GenerateCacheKey(&models.InferenceRequest{Query: "hi", ModelPreference: "llm"}))
+}
+
+func TestQueryRouter_ForceTierMetadata(t *testing.T) {
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65})
+	forced := map[string]string{models.MetadataForceTier: "llm"}
+
+	decision, err := router.Route(context.Background(), &models.InferenceRequest{Query: "What is 2+2?", Metadata: forced})
+	assert.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+	assert.Equal(t, "Client override: llm", decision.Reason)
+
+	// model_preference wins
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "What is 2+2?", ModelPreference: "slm", Metadata: forced})
+	assert.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+
+	assert.Equal(t,
+		router.GenerateCacheKey(&models.InferenceRequest{Query: "hi", ModelPreference: "llm"}),
+		router.GenerateCacheKey(&models.InferenceRequest{Query: "hi", Metadata: forced}))
+}
@@ -0,0 +1,231 @@
+package router
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
+)
+
+// ErrNoCompliantModel is returned when no model in the regions allowed for
+// the user's org can serve a request. Requests fail rather than leave the
+// regions.
+var ErrNoCompliantModel = errors.New("no model in the allowed data residency regions can serve the request")
+
+// Residency resolves which regions may process a user's data
+type Residency struct {
+	config     config.ResidencyConfig
+	models     *registry.ModelRegistry // Where each model processes requests
+	resolveOrg func(ctx context.Context, userID string) string
+}
+
+func NewResidency(cfg config.ResidencyConfig, modelRegistry *registry.ModelRegistry) *Residency {
+	return &Residency{
+		config: cfg,
+		models: modelRegistry,
+	}
+}
+
+// SetOrgResolver enables the per-org rules; without it every user gets the
+// default regions
+func (r *Residency) SetOrgResolver(resolver func(ctx context.Context, userID string) string) {
+	r.resolveOrg = resolver
+}
+
+// Regions returns the regions the user's data may be processed in, or nil if
+// it may go anywhere
+func (r *Residency) Regions(ctx context.Context, userID string) []string {
+	if r.resolveOrg != nil {
+		if org := r.resolveOrg(ctx, userID); org != "" {
+			for _, rule := range r.config.Rules {
+				if slices.Contains(rule.Orgs, org) {
+					return rule.Regions
+				}
+			}
+		}
+	}
+	if len(r.config.DefaultRegions) > 0 {
+		return r.config.DefaultRegions
+	}
+	return nil
+}
+
+// Allows reports whether the user's data may be processed by a model: any
+// model for users without regions, otherwise only models registered in one.
+// A nil Residency allows everything.
+func (r *Residency) Allows(ctx context.Context, userID string, model string) bool {
+	if r == nil {
+		return true
+	}
+	regions := r.Regions(ctx, userID)
+	if regions == nil {
+		return true
+	}
+	if r.models == nil {
+		return false
+	}
+	info, ok := r.models.Get(model)
+	return ok && info.Region != "" && slices.Contains(regions, info.Region)
+}
+
+// WrapEmbedder refuses to embed texts of users whose regions the embedding
+// model isn't in, who then skip semantic matching. The user is the one ctx
+// serves, if any. A nil Residency returns embedder unchanged.
+func (r *Residency) WrapEmbedder(embedder models.Embedder, model string) models.Embedder {
+	if r == nil || embedder == nil {
+		return embedder
+	}
+	return &residentEmbedder{residency: r, embedder: embedder, model: model}
+}
+
+type residentEmbedder struct {
+	residency *Residency
+	embedder  models.Embedder
+	model     string
+}
+
+func (e *residentEmbedder) Embed(ctx context.Context, text string) ([]float32, error) {
+	// Texts embedded for no user, like the knowledge base's questions, are ours
+	if userID := correlation.UserID(ctx); userID != "" && !e.residency.Allows(ctx, userID, e.model) {
+		return nil, fmt.Errorf("%w: %s", ErrNoCompliantModel, e.model)
+	}
+	return e.embedder.Embed(ctx, text)
+}
+
+// WrapLLM refuses calls for users whose regions the model called isn't in:
+// the one asked for, or else model. It's for side calls like summaries,
+// which routing doesn't see; the wrapped client doesn't stream. A nil
+// Residency returns llm unchanged.
+func (r *Residency) WrapLLM(llm models.LLMInferencer, model string) models.LLMInferencer {
+	if r == nil || llm == nil {
+		return llm
+	}
+	return &residentLLM{residency: r, llm: llm, model: model}
+}
+
+type residentLLM struct {
+	residency *Residency
+	llm       models.LLMInferencer
+	model     string
+}
+
+func (l *residentLLM) allow(ctx context.Context, userID string, model string) error {
+	model = cmp.Or(model, l.model)
+	if !l.residency.Allows(ctx, cmp.Or(userID, correlation.UserID(ctx)), model) {
+		return fmt.Errorf("%w: %s", ErrNoCompliantModel, model)
+	}
+	return nil
+}
+
+func (l *residentLLM) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	if err := l.allow(ctx, req.UserID, req.TargetModel); err != nil {
+		return "", err
+	}
+	return l.llm.Infer(ctx, req)
+}
+
+func (l *residentLLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+	if err := l.allow(ctx, "", opts.Model); err != nil {
+		return "", err
+	}
+	return l.llm.InferChat(ctx, messages, opts)
+}
+
+// SetResidency restricts requests to models in the regions allowed for the
+// user's org
+func (r *QueryRouter) SetResidency(residency *Residency) {
+	r.residency = residency
+}
+
+// applyResidency moves the decision onto a model in the user's regions,
+// switching tiers if the decided one has none. The decision is then forced so
+// failover can't take the request to a default model elsewhere.
+func (r *QueryRouter) applyResidency(ctx context.Context, req *models.InferenceRequest, decision *models.RoutingDecision) error {
+	if r.residency == nil {
+		return nil
+	}
+	regions := r.residency.Regions(ctx, req.UserID)
+	if regions == nil {
+		return nil
+	}
+	decision.Regions = regions
+
+	if req.Model != "" && !r.inRegions(req.Model, regions) {
+		return fmt.Errorf("%w: %s is not processed in %s", ErrNoCompliantModel, req.Model, strings.Join(regions, ", "))
+	}
+
+	required := req.RequiredCapabilities()
+	model, ok := r.compliantModel(decision.UseLLM, decision.Model, regions, required)
+	if !ok && !decision.Forced {
+		if model, ok = r.compliantModel(!decision.UseLLM, "", regions, required); ok {
+			decision.UseLLM = !decision.UseLLM
+			decision.Reason = fmt.Sprintf("%s, but only %s is in %s", decision.Reason, tierName(decision.UseLLM), strings.Join(regions, ", "))
+		}
+	}
+	if !ok {
+		return fmt.Errorf("%w (%s)", ErrNoCompliantModel, strings.Join(regions, ", "))
+	}
+
+	if model != decision.Model {
+		decision.Model = model
+		if model != "" {
+			decision.Reason = fmt.Sprintf("%s → %s (data residency)", decision.Reason, model)
+		}
+	}
+	decision.Forced = true
+	return nil
+}
+
+// compliantModel returns the model a tier should run to stay in regions: the
+// decided one or the tier default ("") if they comply, or else the first
+// compliant model the tier serves
+func (r *QueryRouter) compliantModel(useLLM bool, model string, regions []string, required []string) (string, bool) {
+	if model != "" && r.inRegions(model, regions) {
+		return model, true
+	}
+
+	defaults := r.slmModels
+	if useLLM {
+		defaults = []string{r.llmModel}
+	}
+	allCompliant := len(defaults) > 0 && !slices.ContainsFunc(defaults, func(m string) bool { return !r.inRegions(m, regions) })
+	if model == "" && allCompliant && r.tierSupports(tierName(useLLM), "", required) {
+		return "", true
+	}
+
+	candidates := slices.Clone(defaults)
+	for _, target := range r.config.Targets {
+		if target.Tier == tierName(useLLM) {
+			candidates = append(candidates, target.Model)
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate != "" && r.inRegions(candidate, regions) && r.supportsAll(candidate, required) {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// inRegions reports whether a model is registered as processed in one of regions
+func (r *QueryRouter) inRegions(model string, regions []string) bool {
+	if r.modelRegistry == nil {
+		return false
+	}
+	info, ok := r.modelRegistry.Get(model)
+	return ok && info.Region != "" && slices.Contains(regions, info.Region)
+}
+
+func tierName(useLLM bool) string {
+	if useLLM {
+		return "llm"
+	}
+	return "slm"
+}
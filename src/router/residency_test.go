@@ -0,0 +1,154 @@
+package router
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/mocks"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/registry"
+)
+
+func TestQueryRouter_ResidencyKeepsOrgInRegion(t *testing.T) {
+	modelRegistry := registry.NewModelRegistry([]config.ModelInfoConfig{
+		{Name: "gpt-4o-mini", Tier: "llm", Region: "us"},
+		{Name: "llama-3.1-8b-instant", Tier: "slm", Region: "eu"},
+		{Name: "mixtral-8x7b-32768", Tier: "slm", Region: "us"},
+	})
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65})
+	router.SetModelPool(modelRegistry, "gpt-4o-mini", []string{"llama-3.1-8b-instant", "mixtral-8x7b-32768"})
+
+	residency := NewResidency(config.ResidencyConfig{
+		Rules: []config.ResidencyRuleConfig{{Orgs: []string{"acme.eu"}, Regions: []string{"eu"}}},
+	}, modelRegistry)
+	residency.SetOrgResolver(func(ctx context.Context, userID string) string {
+		if userID == "alice" {
+			return "acme.eu"
+		}
+		return ""
+	})
+	router.SetResidency(residency)
+
+	req := contextQuery(10)
+	req.UserID = "bob"
+	decision, err := router.Route(context.Background(), req)
+	require.NoError(t, err)
+	assert.True(t, decision.UseLLM, "users without a rule are routed as usual")
+	assert.Empty(t, decision.Regions)
+
+	// Only one of the SLMs is in the EU, so it runs alone
+	req.UserID = "alice"
+	decision, err = router.Route(context.Background(), req)
+	require.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Equal(t, "llama-3.1-8b-instant", decision.Model)
+	assert.Equal(t, []string{"eu"}, decision.Regions)
+	assert.True(t, decision.Forced, "failover mustn't leave the region")
+
+	req.Model = "gpt-4o-mini"
+	_, err = router.Route(context.Background(), req)
+	assert.ErrorIs(t, err, ErrNoCompliantModel)
+
+	req.Model = ""
+	req.ModelPreference = "llm"
+	_, err = router.Route(context.Background(), req)
+	assert.ErrorIs(t, err, ErrNoCompliantModel)
+}
+
+func TestQueryRouter_ClassifierStaysInRegion(t *testing.T) {
+	modelRegistry := registry.NewModelRegistry([]config.ModelInfoConfig{
+		{Name: "gpt-4o-mini", Tier: "llm", Region: "us"},
+		{Name: "llama-3.1-8b-instant", Tier: "slm", Region: "eu"},
+	})
+	residency := NewResidency(config.ResidencyConfig{
+		Rules: []config.ResidencyRuleConfig{{Orgs: []string{"acme.eu"}, Regions: []string{"eu"}}},
+	}, modelRegistry)
+	residency.SetOrgResolver(func(ctx context.Context, userID string) string {
+		if userID == "alice" {
+			return "acme.eu"
+		}
+		return ""
+	})
+
+	llm := new(mocks.MockLLMClient)
+	llm.On("Infer", mock.Anything, mock.Anything).Return("Score: 0.2", nil)
+	cfg := &config.RouterConfig{ComplexityThreshold: 0.65, Strategy: StrategyLLMClassifier}
+	router := NewQueryRouter(cfg)
+	router.SetModelPool(modelRegistry, "gpt-4o-mini", []string{"llama-3.1-8b-instant"})
+	router.SetResidency(residency)
+	router.SetClassifier(NewLLMClassifier(residency.WrapLLM(llm, "gpt-4o-mini"), nil, &config.ClassifierConfig{Model: "gpt-4o-mini"}))
+
+	// The classifier runs in the US, so EU users' queries don't go to it
+	req := contextQuery(10)
+	req.UserID = "alice"
+	decision, err := router.Route(context.Background(), req)
+	require.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	llm.AssertNotCalled(t, "Infer", mock.Anything, mock.Anything)
+
+	req.UserID = "bob"
+	_, err = router.Route(context.Background(), req)
+	require.NoError(t, err)
+	llm.AssertNumberOfCalls(t, "Infer", 1)
+}
+
+func TestResidency_DefaultRegions(t *testing.T) {
+	residency := NewResidency(config.ResidencyConfig{DefaultRegions: []string{"us"}}, nil)
+	assert.Equal(t, []string{"us"}, residency.Regions(context.Background(), "anonymous"))
+	assert.Nil(t, NewResidency(config.ResidencyConfig{}, nil).Regions(context.Background(), "anonymous"))
+}
+
+// embedderFunc is an Embedder calling a function
+type embedderFunc func(ctx context.Context, text string) ([]float32, error)
+
+func (f embedderFunc) Embed(ctx context.Context, text string) ([]float32, error) {
+	return f(ctx, text)
+}
+
+// chatLLM is an LLM answering every chat with the model it was asked for
+type chatLLM struct{}
+
+func (chatLLM) Infer(ctx context.Context, req *models.InferenceRequest) (string, error) {
+	return req.TargetModel, nil
+}
+
+func (chatLLM) InferChat(ctx context.Context, messages []models.ChatMessage, opts models.ChatOptions) (string, error) {
+	return opts.Model, nil
+}
+
+func TestResidency_SideCalls(t *testing.T) {
+	modelRegistry := registry.NewModelRegistry([]config.ModelInfoConfig{
+		{Name: "gpt-4o-mini", Tier: "llm", Region: "us"},
+		{Name: "mistral-large", Tier: "llm", Region: "eu"},
+		{Name: "text-embedding-ada-002", Tier: "embedding", Region: "us"},
+	})
+	residency := NewResidency(config.ResidencyConfig{DefaultRegions: []string{"eu"}}, modelRegistry)
+	userCtx := correlation.WithUserID(context.Background(), "alice")
+
+	embedded := 0
+	embedder := residency.WrapEmbedder(embedderFunc(func(ctx context.Context, text string) ([]float32, error) {
+		embedded++
+		return []float32{1}, nil
+	}), "text-embedding-ada-002")
+	_, err := embedder.Embed(userCtx, "What is 2+2?")
+	assert.ErrorIs(t, err, ErrNoCompliantModel)
+	_, err = embedder.Embed(context.Background(), "A knowledge base question")
+	assert.NoError(t, err, "texts of no user aren't restricted")
+	assert.Equal(t, 1, embedded)
+
+	llm := residency.WrapLLM(chatLLM{}, "gpt-4o-mini")
+	_, err = llm.InferChat(userCtx, nil, models.ChatOptions{})
+	assert.ErrorIs(t, err, ErrNoCompliantModel, "the default model is in the US")
+	answer, err := llm.InferChat(userCtx, nil, models.ChatOptions{Model: "mistral-large"})
+	require.NoError(t, err)
+	assert.Equal(t, "mistral-large", answer)
+
+	var unrestricted *Residency
+	assert.True(t, unrestricted.Allows(userCtx, "alice", "gpt-4o-mini"))
+}
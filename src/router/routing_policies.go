@@ -0,0 +1,220 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/spf13/viper"
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const defaultPolicyReloadInterval = 10 * time.Second
+
+// RoutingPolicy overrides routing when its expression matches. Policies are
+// checked in file order and the first match wins.
+type RoutingPolicy struct {
+	Name  string `mapstructure:"name"`
+	When  string `mapstructure:"when"`  // expr-lang boolean expression over PolicyEnv
+	Route string `mapstructure:"route"` // "llm" or "slm"
+	Model string `mapstructure:"model"` // Optional specific model within the tier
+}
+
+// PolicyEnv is what policy expressions can refer to
+type PolicyEnv struct {
+	Query       string            `expr:"query"`
+	TokenCount  int               `expr:"token_count"`
+	QueryLength int               `expr:"query_length"`
+	Complexity  float64           `expr:"complexity"`
+	HasContext  bool              `expr:"has_context"`
+	UserID      string            `expr:"user_id"`
+	Org         string            `expr:"org"` // Empty unless an org resolver is set
+	Metadata    map[string]string `expr:"metadata"`
+	Hour        int               `expr:"hour"` // Current hour, UTC
+}
+
+type compiledPolicy struct {
+	RoutingPolicy
+	program *vm.Program
+	usesOrg bool
+}
+
+// PolicyEngine evaluates routing policies loaded from a YAML file. The file is
+// re-read when it changes, and a file that fails to load or compile leaves the
+// previous policies in place.
+type PolicyEngine struct {
+	path       string
+	resolveOrg func(ctx context.Context, userID string) string
+
+	mu       sync.RWMutex
+	policies []compiledPolicy
+	modTime  time.Time
+	clock    clock.Clock
+}
+
+// NewPolicyEngine loads the policies in path, failing if any of them is invalid
+func NewPolicyEngine(path string) (*PolicyEngine, error) {
+	e := &PolicyEngine{
+		path:  path,
+		clock: clock.Real(),
+	}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// SetClock sets the clock policies see as hour
+func (e *PolicyEngine) SetClock(c clock.Clock) {
+	e.clock = c
+}
+
+// SetOrgResolver makes the user's org available to policies as org
+func (e *PolicyEngine) SetOrgResolver(resolver func(ctx context.Context, userID string) string) {
+	e.resolveOrg = resolver
+}
+
+// Len returns the number of loaded policies
+func (e *PolicyEngine) Len() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return len(e.policies)
+}
+
+// Reload re-reads and compiles the policy file
+func (e *PolicyEngine) Reload() error {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return fmt.Errorf("failed to read routing policies: %w", err)
+	}
+
+	v := viper.New()
+	v.SetConfigFile(e.path)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read routing policies: %w", err)
+	}
+
+	var policies []RoutingPolicy
+	if err := v.UnmarshalKey("policies", &policies); err != nil {
+		return fmt.Errorf("failed to parse routing policies: %w", err)
+	}
+
+	compiled := make([]compiledPolicy, 0, len(policies))
+	for _, policy := range policies {
+		if policy.Route != "llm" && policy.Route != "slm" {
+			return fmt.Errorf("routing policy %q: route must be \"llm\" or \"slm\"", policy.Name)
+		}
+		program, err := expr.Compile(policy.When, expr.Env(PolicyEnv{}), expr.AsBool())
+		if err != nil {
+			return fmt.Errorf("routing policy %q: %w", policy.Name, err)
+		}
+		compiled = append(compiled, compiledPolicy{
+			RoutingPolicy: policy,
+			program:       program,
+			usesOrg:       strings.Contains(policy.When, "org"),
+		})
+	}
+
+	e.mu.Lock()
+	e.policies = compiled
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Watch reloads the policy file whenever it changes until ctx is done
+func (e *PolicyEngine) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPolicyReloadInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !e.changed() {
+				continue
+			}
+			if err := e.Reload(); err != nil {
+				log.Printf("⚠️  Keeping previous routing policies: %v", err)
+				continue
+			}
+			log.Printf("✓ Reloaded %d routing policies", e.Len())
+		}
+	}
+}
+
+func (e *PolicyEngine) changed() bool {
+	info, err := os.Stat(e.path)
+	if err != nil {
+		return false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return !info.ModTime().Equal(e.modTime)
+}
+
+// Evaluate returns the decision of the first matching policy, or nil if none
+// matches. Policies that fail at runtime are skipped.
+func (e *PolicyEngine) Evaluate(ctx context.Context, req *models.InferenceRequest, metrics *models.QueryMetrics) *models.RoutingDecision {
+	e.mu.RLock()
+	policies := e.policies
+	e.mu.RUnlock()
+
+	if len(policies) == 0 {
+		return nil
+	}
+
+	env := PolicyEnv{
+		Query:       req.Query,
+		TokenCount:  metrics.TokenCount,
+		QueryLength: metrics.QueryLength,
+		Complexity:  metrics.Complexity,
+		HasContext:  metrics.HasContext,
+		UserID:      req.UserID,
+		Metadata:    req.Metadata,
+		Hour:        e.clock.Now().UTC().Hour(),
+	}
+	orgResolved := false
+
+	for _, policy := range policies {
+		// Only look the org up when a policy needs it
+		if policy.usesOrg && !orgResolved && e.resolveOrg != nil && req.UserID != "" {
+			env.Org = e.resolveOrg(ctx, req.UserID)
+			orgResolved = true
+		}
+
+		matched, err := expr.Run(policy.program, env)
+		if err != nil {
+			log.Printf("Routing policy %s failed: %v", policy.Name, err)
+			continue
+		}
+		if matched != true {
+			continue
+		}
+
+		return &models.RoutingDecision{
+			UseLLM:          policy.Route == "llm",
+			Reason:          fmt.Sprintf("Routing policy %s", policy.Name),
+			Confidence:      1.0,
+			ComplexityScore: metrics.Complexity,
+			Model:           policy.Model,
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package router
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func writePolicies(t *testing.T, path string, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
+
+func TestPolicyEngine_FirstMatchOverridesStrategy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	writePolicies(t, path, `
+policies:
+  - name: enterprise
+    when: org == "acme.com"
+    route: llm
+    model: gpt-4o
+  - name: short-to-slm
+    when: token_count < 5 && metadata["tier"] != "premium"
+    route: slm
+`)
+
+	policies, err := NewPolicyEngine(path)
+	require.NoError(t, err)
+	policies.SetOrgResolver(func(ctx context.Context, userID string) string {
+		if userID == "alice" {
+			return "acme.com"
+		}
+		return ""
+	})
+
+	router := NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65})
+	router.SetPolicies(policies)
+
+	decision, err := router.Route(context.Background(), &models.InferenceRequest{Query: "hi", UserID: "alice"})
+	require.NoError(t, err)
+	assert.True(t, decision.UseLLM)
+	assert.Equal(t, "gpt-4o", decision.Model)
+	assert.Equal(t, "Routing policy enterprise", decision.Reason)
+
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "hi", UserID: "bob"})
+	require.NoError(t, err)
+	assert.False(t, decision.UseLLM)
+	assert.Equal(t, "Routing policy short-to-slm", decision.Reason)
+
+	// No policy matches, so the strategy decides
+	decision, err = router.Route(context.Background(), &models.InferenceRequest{Query: "hi", UserID: "bob", Metadata: map[string]string{"tier": "premium"}})
+	require.NoError(t, err)
+	assert.Contains(t, decision.Reason, "Simple query")
+}
+
+func TestPolicyEngine_ReloadKeepsPreviousPoliciesOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	writePolicies(t, path, `
+policies:
+  - name: all-llm
+    when: "true"
+    route: llm
+`)
+
+	policies, err := NewPolicyEngine(path)
+	require.NoError(t, err)
+	assert.Equal(t, 1, policies.Len())
+
+	writePolicies(t, path, `
+policies:
+  - name: broken
+    when: token_count >
+    route: llm
+`)
+	assert.Error(t, policies.Reload())
+	assert.Equal(t, 1, policies.Len())
+
+	writePolicies(t, path, `
+policies:
+  - name: night
+    when: hour < 6
+    route: slm
+  - name: big
+    when: query_length > 1000
+    route: llm
+`)
+	// Make sure the change is visible even on filesystems with coarse mtimes
+	future := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(path, future, future))
+	assert.True(t, policies.changed())
+	require.NoError(t, policies.Reload())
+	assert.Equal(t, 2, policies.Len())
+	assert.False(t, policies.changed())
+}
+
+func TestPolicyEngine_RejectsInvalidPolicies(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+
+	writePolicies(t, path, `
+policies:
+  - name: wrong-tier
+    when: "true"
+    route: gpu
+`)
+	_, err := NewPolicyEngine(path)
+	assert.ErrorContains(t, err, `route must be "llm" or "slm"`)
+
+	writePolicies(t, path, `
+policies:
+  - name: not-bool
+    when: token_count + 1
+    route: llm
+`)
+	_, err = NewPolicyEngine(path)
+	assert.ErrorContains(t, err, `routing policy "not-bool"`)
+}
@@ -1,14 +1,28 @@
 package router
 
 import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+
 	"www.github.com/Wanderer0074348/HybridLM/src/config"
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
 )
 
+// Routing strategies selectable with router.strategy
+const (
+	StrategyHeuristic     = "heuristic"
+	StrategyLLMClassifier = "llm_classifier"
+	StrategyHybrid        = "hybrid"
+)
+
 type RoutingStrategy interface {
-	Decide(metrics *models.QueryMetrics) *models.RoutingDecision
+	Decide(ctx context.Context, req *models.InferenceRequest, metrics *models.QueryMetrics) *models.RoutingDecision
 }
 
+// HybridRoutingStrategy is the heuristic strategy: it routes on the locally
+// computed complexity score, query length and context
 type HybridRoutingStrategy struct {
 	config *config.RouterConfig
 }
@@ -19,7 +33,7 @@ func NewHybridRoutingStrategy(cfg *config.RouterConfig) *HybridRoutingStrategy {
 	}
 }
 
-func (s *HybridRoutingStrategy) Decide(metrics *models.QueryMetrics) *models.RoutingDecision {
+func (s *HybridRoutingStrategy) Decide(ctx context.Context, req *models.InferenceRequest, metrics *models.QueryMetrics) *models.RoutingDecision {
 	decision := &models.RoutingDecision{
 		ComplexityScore: metrics.Complexity,
 	}
@@ -51,3 +65,49 @@ func (s *HybridRoutingStrategy) Decide(metrics *models.QueryMetrics) *models.Rou
 
 	return decision
 }
+
+// ClassifierRoutingStrategy routes on the score from a ComplexityClassifier.
+// With a margin it only asks the classifier when the heuristic score is that
+// close to the threshold ("hybrid"); without one every query is classified
+// ("llm_classifier"). If the classifier fails the heuristic decision is used.
+type ClassifierRoutingStrategy struct {
+	config     *config.RouterConfig
+	classifier ComplexityClassifier
+	heuristic  RoutingStrategy
+	margin     float64
+}
+
+func NewClassifierRoutingStrategy(cfg *config.RouterConfig, classifier ComplexityClassifier, margin float64) *ClassifierRoutingStrategy {
+	return &ClassifierRoutingStrategy{
+		config:     cfg,
+		classifier: classifier,
+		heuristic:  NewHybridRoutingStrategy(cfg),
+		margin:     margin,
+	}
+}
+
+func (s *ClassifierRoutingStrategy) Decide(ctx context.Context, req *models.InferenceRequest, metrics *models.QueryMetrics) *models.RoutingDecision {
+	if s.margin > 0 && math.Abs(metrics.Complexity-s.config.ComplexityThreshold) > s.margin {
+		return s.heuristic.Decide(ctx, req, metrics)
+	}
+
+	score, err := s.classifier.Classify(ctx, req.Query)
+	if err != nil {
+		log.Printf("Complexity classifier failed, using heuristic routing: %v", err)
+		decision := s.heuristic.Decide(ctx, req, metrics)
+		decision.Reason += " (classifier unavailable)"
+		return decision
+	}
+
+	decision := &models.RoutingDecision{
+		ComplexityScore: score,
+		Confidence:      math.Min(0.5+math.Abs(score-s.config.ComplexityThreshold), 1.0),
+	}
+	if score > s.config.ComplexityThreshold {
+		decision.UseLLM = true
+		decision.Reason = fmt.Sprintf("Classifier scored complexity %.2f, routed to LLM", score)
+	} else {
+		decision.Reason = fmt.Sprintf("Classifier scored complexity %.2f, suitable for edge SLM", score)
+	}
+	return decision
+}
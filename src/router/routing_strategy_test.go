@@ -1,6 +1,7 @@
 package router
 
 import (
+	"context"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -19,7 +20,7 @@ func TestRoutingStrategy_HighComplexity(t *testing.T) {
 		QueryLength: 200,
 	}
 
-	decision := strategy.Decide(metrics)
+	decision := strategy.Decide(context.Background(), &models.InferenceRequest{}, metrics)
 
 	assert.True(t, decision.UseLLM)
 	assert.Contains(t, decision.Reason, "High complexity")
@@ -36,7 +37,7 @@ func TestRoutingStrategy_LongQuery(t *testing.T) {
 		HasContext: false,
 	}
 
-	decision := strategy.Decide(metrics)
+	decision := strategy.Decide(context.Background(), &models.InferenceRequest{}, metrics)
 
 	assert.True(t, decision.UseLLM)
 	assert.Contains(t, decision.Reason, "Long query")
@@ -52,7 +53,7 @@ func TestRoutingStrategy_SimpleQuery(t *testing.T) {
 		HasContext: false,
 	}
 
-	decision := strategy.Decide(metrics)
+	decision := strategy.Decide(context.Background(), &models.InferenceRequest{}, metrics)
 
 	assert.False(t, decision.UseLLM)
 	assert.Contains(t, decision.Reason, "Simple query")
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/usage"
+)
+
+// SetSpendCaps keeps requests off provider keys that reached their monthly
+// spend cap
+func (r *QueryRouter) SetSpendCaps(caps *usage.SpendCaps) {
+	r.spendCaps = caps
+}
+
+// applySpendCaps moves a decision whose tier's key is capped to the other
+// tier, unless the spend_caps action is "reject", the decision is forced, or
+// the other tier is capped or unavailable too
+func (r *QueryRouter) applySpendCaps(ctx context.Context, req *models.InferenceRequest, decision *models.RoutingDecision) error {
+	if r.spendCaps == nil {
+		return nil
+	}
+	capErr := r.spendCaps.Check(ctx, decision.UseLLM)
+	if capErr == nil {
+		return nil
+	}
+	if r.spendCaps.Action() == usage.SpendActionReject || decision.Forced || !r.spendCaps.Available(!decision.UseLLM) {
+		return capErr
+	}
+	if err := r.spendCaps.Check(ctx, !decision.UseLLM); errors.Is(err, usage.ErrSpendCapReached) {
+		return capErr
+	}
+
+	if decision.UseLLM {
+		r.preferSLM(decision, req, "the LLM key's monthly spend cap is reached")
+		return nil
+	}
+
+	// The LLM tier still has to fit the per-request cost budget
+	if threshold := r.config.CostThresholdUSD; threshold > 0 && EstimateLLMCost(req, r.llmModel) > threshold {
+		return capErr
+	}
+	decision.UseLLM = true
+	decision.Model = ""
+	decision.Reason = fmt.Sprintf("%s, but the SLM key's monthly spend cap is reached: routed to LLM", decision.Reason)
+	r.selectTarget(decision, req.RequiredCapabilities())
+	return nil
+}
@@ -0,0 +1,312 @@
+// Package storage keeps users, chat sessions and usage in PostgreSQL, so they
+// survive Redis losing them; Redis stays in front as a read-through cache.
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// schema is applied at start; every statement is idempotent
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id         TEXT PRIMARY KEY,
+		email      TEXT NOT NULL,
+		last_login TIMESTAMPTZ,
+		data       JSONB NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS users_email ON users (lower(email))`,
+	`CREATE TABLE IF NOT EXISTS chat_sessions (
+		id               TEXT PRIMARY KEY,
+		user_id          TEXT NOT NULL,
+		last_interaction TIMESTAMPTZ NOT NULL,
+		expires_at       TIMESTAMPTZ,
+		data             JSONB NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS chat_sessions_user ON chat_sessions (user_id, last_interaction DESC)`,
+	`CREATE INDEX IF NOT EXISTS chat_sessions_expiry ON chat_sessions (expires_at) WHERE expires_at IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS usage (
+		user_id       TEXT NOT NULL,
+		period        TEXT NOT NULL,
+		requests      BIGINT NOT NULL DEFAULT 0,
+		cache_hits    BIGINT NOT NULL DEFAULT 0,
+		input_tokens  BIGINT NOT NULL DEFAULT 0,
+		output_tokens BIGINT NOT NULL DEFAULT 0,
+		total_tokens  BIGINT NOT NULL DEFAULT 0,
+		cost          DOUBLE PRECISION NOT NULL DEFAULT 0,
+		savings       DOUBLE PRECISION NOT NULL DEFAULT 0,
+		PRIMARY KEY (user_id, period)
+	)`,
+}
+
+// Postgres persists users, chat sessions and usage aggregates. Users and
+// sessions are stored as the same JSON documents Redis holds.
+type Postgres struct {
+	db *pgxpool.Pool
+}
+
+// NewPostgres connects to the database at cfg.DSN and creates the tables
+// that are missing. The DSN's sslmode is honored as libpq does, so
+// verify-ca and verify-full check the server's certificate.
+func NewPostgres(cfg config.PostgresConfig) (*Postgres, error) {
+	if cfg.DSN == "" {
+		return nil, fmt.Errorf("storage.postgres.dsn is empty")
+	}
+	poolConfig, err := pgxpool.ParseConfig(cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PostgreSQL URL: %w", err)
+	}
+	if cfg.MaxOpenConns > 0 {
+		poolConfig.MaxConns = int32(cfg.MaxOpenConns)
+	}
+	poolConfig.MaxConnIdleTime = 5 * time.Minute
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	db, err := pgxpool.NewWithConfig(ctx, poolConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to PostgreSQL: %w", err)
+	}
+	for _, statement := range schema {
+		if _, err := db.Exec(ctx, statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("failed to migrate PostgreSQL: %w", err)
+		}
+	}
+	return &Postgres{db: db}, nil
+}
+
+func (p *Postgres) Close() error {
+	p.db.Close()
+	return nil
+}
+
+// Ping checks the database is reachable, for health checks
+func (p *Postgres) Ping(ctx context.Context) error {
+	return p.db.Ping(ctx)
+}
+
+// LoadUser returns the user, or nil if there's none with the ID
+func (p *Postgres) LoadUser(ctx context.Context, userID string) (*models.User, error) {
+	var data []byte
+	err := p.db.QueryRow(ctx, `SELECT data FROM users WHERE id = $1`, userID).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load user: %w", err)
+	}
+
+	var user models.User
+	if err := json.Unmarshal(data, &user); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+	}
+	return &user, nil
+}
+
+func (p *Postgres) SaveUser(ctx context.Context, user *models.User) error {
+	data, err := json.Marshal(user)
+	if err != nil {
+		return fmt.Errorf("failed to marshal user: %w", err)
+	}
+	_, err = p.db.Exec(ctx, `
+		INSERT INTO users (id, email, last_login, data) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET email = EXCLUDED.email, last_login = EXCLUDED.last_login, data = EXCLUDED.data`,
+		user.ID, user.Email, user.LastLoginAt, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save user: %w", err)
+	}
+	return nil
+}
+
+// ListUsers returns every user, most recently signed in first
+func (p *Postgres) ListUsers(ctx context.Context) ([]models.User, error) {
+	rows, err := p.db.Query(ctx, `SELECT data FROM users ORDER BY last_login DESC`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to list users: %w", err)
+		}
+		var user models.User
+		if err := json.Unmarshal(data, &user); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal user: %w", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// LoadSession returns the session, or nil if there's none with the ID or it
+// has expired
+func (p *Postgres) LoadSession(ctx context.Context, sessionID string) (*models.ChatSession, error) {
+	var data []byte
+	err := p.db.QueryRow(ctx, `
+		SELECT data FROM chat_sessions
+		WHERE id = $1 AND (expires_at IS NULL OR expires_at > now())`, sessionID).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load session: %w", err)
+	}
+
+	var session models.ChatSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+	return &session, nil
+}
+
+// SaveSession saves the session until expiresAt, or until it's deleted if
+// expiresAt is zero
+func (p *Postgres) SaveSession(ctx context.Context, session *models.ChatSession, expiresAt time.Time) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+	var expiry any
+	if !expiresAt.IsZero() {
+		expiry = expiresAt
+	}
+	_, err = p.db.Exec(ctx, `
+		INSERT INTO chat_sessions (id, user_id, last_interaction, expires_at, data) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET
+			user_id = EXCLUDED.user_id, last_interaction = EXCLUDED.last_interaction,
+			expires_at = EXCLUDED.expires_at, data = EXCLUDED.data`,
+		session.SessionID, session.UserID, session.LastInteraction, expiry, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteSession(ctx context.Context, sessionID string) error {
+	if _, err := p.db.Exec(ctx, `DELETE FROM chat_sessions WHERE id = $1`, sessionID); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// ListUserSessions returns the user's sessions that haven't expired, most
+// recently used first
+func (p *Postgres) ListUserSessions(ctx context.Context, userID string) ([]*models.ChatSession, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT data FROM chat_sessions
+		WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > now())
+		ORDER BY last_interaction DESC`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.ChatSession
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to list sessions: %w", err)
+		}
+		var session models.ChatSession
+		if err := json.Unmarshal(data, &session); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+		}
+		sessions = append(sessions, &session)
+	}
+	return sessions, rows.Err()
+}
+
+// AddUsage adds the counts of delta to the user's usage in each period and
+// returns the new totals, in the same order
+func (p *Postgres) AddUsage(ctx context.Context, userID string, periods []string, delta models.UsageSummary) ([]models.UsageSummary, error) {
+	totals := make([]models.UsageSummary, len(periods))
+	for i, period := range periods {
+		totals[i].Period = period
+		err := p.db.QueryRow(ctx, `
+			INSERT INTO usage AS u (user_id, period, requests, cache_hits, input_tokens, output_tokens, total_tokens, cost, savings)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			ON CONFLICT (user_id, period) DO UPDATE SET
+				requests = u.requests + EXCLUDED.requests,
+				cache_hits = u.cache_hits + EXCLUDED.cache_hits,
+				input_tokens = u.input_tokens + EXCLUDED.input_tokens,
+				output_tokens = u.output_tokens + EXCLUDED.output_tokens,
+				total_tokens = u.total_tokens + EXCLUDED.total_tokens,
+				cost = u.cost + EXCLUDED.cost,
+				savings = u.savings + EXCLUDED.savings
+			RETURNING requests, cache_hits, input_tokens, output_tokens, total_tokens, cost, savings`,
+			userID, period, delta.Requests, delta.CacheHits, delta.InputTokens, delta.OutputTokens, delta.TotalTokens, delta.Cost, delta.Savings,
+		).Scan(&totals[i].Requests, &totals[i].CacheHits, &totals[i].InputTokens, &totals[i].OutputTokens, &totals[i].TotalTokens, &totals[i].Cost, &totals[i].Savings)
+		if err != nil {
+			return nil, fmt.Errorf("failed to record usage: %w", err)
+		}
+	}
+	return totals, nil
+}
+
+// LoadUsage returns the user's usage in each period, zero for periods
+// without any
+func (p *Postgres) LoadUsage(ctx context.Context, userID string, periods []string) ([]models.UsageSummary, error) {
+	rows, err := p.db.Query(ctx, `
+		SELECT period, requests, cache_hits, input_tokens, output_tokens, total_tokens, cost, savings
+		FROM usage WHERE user_id = $1 AND period = ANY($2)`,
+		userID, periods)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]models.UsageSummary)
+	for rows.Next() {
+		var summary models.UsageSummary
+		if err := rows.Scan(&summary.Period, &summary.Requests, &summary.CacheHits, &summary.InputTokens, &summary.OutputTokens, &summary.TotalTokens, &summary.Cost, &summary.Savings); err != nil {
+			return nil, fmt.Errorf("failed to get usage: %w", err)
+		}
+		stored[summary.Period] = summary
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	summaries := make([]models.UsageSummary, len(periods))
+	for i, period := range periods {
+		summaries[i] = stored[period]
+		summaries[i].Period = period
+	}
+	return summaries, nil
+}
+
+// PruneSessions deletes the sessions that have expired every interval until
+// ctx is done
+func (p *Postgres) PruneSessions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			result, err := p.db.Exec(ctx, `DELETE FROM chat_sessions WHERE expires_at <= now()`)
+			if err != nil {
+				log.Printf("⚠️  Failed to prune expired chat sessions: %v", err)
+				continue
+			}
+			if pruned := result.RowsAffected(); pruned > 0 {
+				log.Printf("🧹 Pruned %d expired chat sessions", pruned)
+			}
+		}
+	}
+}
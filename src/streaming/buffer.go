@@ -0,0 +1,194 @@
+package streaming
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	streamEventsKeyPrefix = "stream_events:"
+	streamOwnerKeyPrefix  = "stream_owner:"
+	streamCancelKeyPrefix = "stream_cancel:" // Set, and published on, when a stream is cancelled
+	defaultBufferTTL      = 10 * time.Minute
+)
+
+var (
+	// ErrStreamNotFound is returned when a stream doesn't exist or its buffer has expired
+	ErrStreamNotFound = errors.New("stream not found")
+	// ErrStreamForbidden is returned when a stream belongs to another user
+	ErrStreamForbidden = errors.New("stream belongs to another user")
+	// ErrStreamCancelled is the cause of a generation stopped with Cancel. It
+	// wraps context.Canceled, so it isn't mistaken for a provider failure.
+	ErrStreamCancelled = fmt.Errorf("stream cancelled: %w", context.Canceled)
+)
+
+// Event is one buffered Server-Sent Event. Seq starts at 1 and is the
+// position of the event within its stream.
+type Event struct {
+	Seq   int             `json:"-"`
+	Event string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// Terminal reports whether the event ends the stream
+func (e Event) Terminal() bool {
+	return e.Event == "done" || e.Event == "error"
+}
+
+// Buffer keeps the events of recent SSE streams in Redis so clients that
+// lose their connection can reconnect with Last-Event-ID and replay them
+type Buffer struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+func NewBuffer(client *redis.Client, ttl time.Duration) *Buffer {
+	if ttl <= 0 {
+		ttl = defaultBufferTTL
+	}
+
+	return &Buffer{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+// Create registers a new stream owned by the user and returns its ID
+func (b *Buffer) Create(ctx context.Context, userID string) (string, error) {
+	streamID := "strm_" + uuid.New().String()
+
+	if err := b.client.Set(ctx, streamOwnerKeyPrefix+streamID, userID, b.ttl).Err(); err != nil {
+		return "", fmt.Errorf("failed to create stream: %w", err)
+	}
+
+	return streamID, nil
+}
+
+// Append buffers an event and returns its sequence number
+func (b *Buffer) Append(ctx context.Context, streamID string, event string, data interface{}) (int, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event data: %w", err)
+	}
+
+	encoded, err := json.Marshal(Event{Event: event, Data: payload})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	key := streamEventsKeyPrefix + streamID
+	pipe := b.client.TxPipeline()
+	length := pipe.RPush(ctx, key, encoded)
+	pipe.Expire(ctx, key, b.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to buffer event: %w", err)
+	}
+
+	return int(length.Val()), nil
+}
+
+// Events returns the buffered events after the given sequence number
+func (b *Buffer) Events(ctx context.Context, streamID string, afterSeq int) ([]Event, error) {
+	raw, err := b.client.LRange(ctx, streamEventsKeyPrefix+streamID, int64(afterSeq), -1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stream events: %w", err)
+	}
+
+	events := make([]Event, 0, len(raw))
+	for i, item := range raw {
+		var event Event
+		if err := json.Unmarshal([]byte(item), &event); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal stream event: %w", err)
+		}
+		event.Seq = afterSeq + i + 1
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// CheckOwner verifies the stream exists and belongs to the user
+func (b *Buffer) CheckOwner(ctx context.Context, streamID string, userID string) error {
+	owner, err := b.client.Get(ctx, streamOwnerKeyPrefix+streamID).Result()
+	if err == redis.Nil {
+		return ErrStreamNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get stream: %w", err)
+	}
+	if owner != userID {
+		return ErrStreamForbidden
+	}
+	return nil
+}
+
+// Cancel stops the generation of a stream, on whichever instance runs it
+func (b *Buffer) Cancel(ctx context.Context, streamID string) error {
+	key := streamCancelKeyPrefix + streamID
+	pipe := b.client.TxPipeline()
+	pipe.Set(ctx, key, "1", b.ttl)
+	pipe.Publish(ctx, key, "1")
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to cancel stream: %w", err)
+	}
+	return nil
+}
+
+// WithCancel returns a copy of ctx that is cancelled with ErrStreamCancelled
+// when Cancel is called for the stream. Call stop once the stream is done to
+// release the subscription.
+func (b *Buffer) WithCancel(ctx context.Context, streamID string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	stop := func() { cancel(context.Canceled) }
+
+	key := streamCancelKeyPrefix + streamID
+	sub := b.client.Subscribe(ctx, key)
+	if _, err := sub.Receive(ctx); err != nil {
+		log.Printf("Failed to watch stream %s for cancellation: %v", streamID, err)
+		sub.Close()
+		return ctx, stop
+	}
+	// Subscribing first means a cancellation is either seen here or published after
+	if n, err := b.client.Exists(ctx, key).Result(); err == nil && n > 0 {
+		cancel(ErrStreamCancelled)
+	}
+
+	go func() {
+		defer sub.Close()
+		select {
+		case <-sub.Channel():
+			cancel(ErrStreamCancelled)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, stop
+}
+
+// EventID formats the SSE id of an event: "<stream ID>:<seq>"
+func EventID(streamID string, seq int) string {
+	return streamID + ":" + strconv.Itoa(seq)
+}
+
+// ParseEventID splits a Last-Event-ID value into stream ID and sequence number
+func ParseEventID(id string) (string, int, error) {
+	sep := strings.LastIndex(id, ":")
+	if sep <= 0 {
+		return "", 0, fmt.Errorf("invalid event ID %q", id)
+	}
+
+	seq, err := strconv.Atoi(id[sep+1:])
+	if err != nil || seq < 0 {
+		return "", 0, fmt.Errorf("invalid event ID %q", id)
+	}
+
+	return id[:sep], seq, nil
+}
@@ -0,0 +1,91 @@
+package streaming
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupBuffer(t *testing.T) (*Buffer, *miniredis.Miniredis) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return NewBuffer(client, time.Minute), mr
+}
+
+func TestBuffer_AppendAndReplay(t *testing.T) {
+	buffer, _ := setupBuffer(t)
+	ctx := context.Background()
+
+	streamID, err := buffer.Create(ctx, "user-1")
+	require.NoError(t, err)
+
+	for i, event := range []string{"stream", "token", "token", "done"} {
+		seq, err := buffer.Append(ctx, streamID, event, map[string]int{"n": i})
+		require.NoError(t, err)
+		assert.Equal(t, i+1, seq)
+	}
+
+	events, err := buffer.Events(ctx, streamID, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	assert.Equal(t, 3, events[0].Seq)
+	assert.Equal(t, "token", events[0].Event)
+	assert.JSONEq(t, `{"n":2}`, string(events[0].Data))
+	assert.True(t, events[1].Terminal())
+}
+
+func TestBuffer_CheckOwner(t *testing.T) {
+	buffer, mr := setupBuffer(t)
+	ctx := context.Background()
+
+	streamID, err := buffer.Create(ctx, "user-1")
+	require.NoError(t, err)
+
+	assert.NoError(t, buffer.CheckOwner(ctx, streamID, "user-1"))
+	assert.ErrorIs(t, buffer.CheckOwner(ctx, streamID, "user-2"), ErrStreamForbidden)
+
+	mr.FastForward(2 * time.Minute)
+	assert.ErrorIs(t, buffer.CheckOwner(ctx, streamID, "user-1"), ErrStreamNotFound)
+}
+
+func TestParseEventID(t *testing.T) {
+	streamID, seq, err := ParseEventID(EventID("strm_abc", 7))
+	require.NoError(t, err)
+	assert.Equal(t, "strm_abc", streamID)
+	assert.Equal(t, 7, seq)
+
+	_, _, err = ParseEventID("strm_abc")
+	assert.Error(t, err)
+	_, _, err = ParseEventID("strm_abc:x")
+	assert.Error(t, err)
+}
+
+func TestBuffer_CancelStopsGeneration(t *testing.T) {
+	buffer, _ := setupBuffer(t)
+	ctx := context.Background()
+
+	streamID, err := buffer.Create(ctx, "user-1")
+	require.NoError(t, err)
+	genCtx, stop := buffer.WithCancel(ctx, streamID)
+	defer stop()
+	assert.NoError(t, genCtx.Err())
+
+	require.NoError(t, buffer.Cancel(ctx, streamID))
+	select {
+	case <-genCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("generation context wasn't cancelled")
+	}
+	assert.ErrorIs(t, context.Cause(genCtx), ErrStreamCancelled)
+	assert.ErrorIs(t, context.Cause(genCtx), context.Canceled)
+
+	// Streams cancelled before generation starts don't start
+	lateCtx, stopLate := buffer.WithCancel(ctx, streamID)
+	defer stopLate()
+	assert.ErrorIs(t, context.Cause(lateCtx), ErrStreamCancelled)
+}
@@ -0,0 +1,84 @@
+package streaming
+
+import (
+	"context"
+	"time"
+	"unicode"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/utils"
+)
+
+// Pacer spreads a stream's tokens out to at most a set rate, so chunks a
+// provider sends in bursts reach the client word by word. A stream may run
+// ahead of the rate by a burst of tokens, which lets the start of an answer
+// through at once.
+type Pacer struct {
+	interval time.Duration // Time per token
+	burst    time.Duration // How far ahead of the rate the stream may run
+	next     time.Time     // When the stream is back on schedule
+	clock    clock.Clock
+}
+
+// NewPacer returns a pacer for one stream, or nil, which doesn't pace, when
+// tokensPerSecond isn't positive
+func NewPacer(tokensPerSecond float64, burst int) *Pacer {
+	if tokensPerSecond <= 0 {
+		return nil
+	}
+	interval := time.Duration(float64(time.Second) / tokensPerSecond)
+	return &Pacer{
+		interval: interval,
+		burst:    time.Duration(max(burst, 0)) * interval,
+		clock:    clock.Real(),
+	}
+}
+
+// SetClock sets the clock the pacer waits on
+func (p *Pacer) SetClock(c clock.Clock) {
+	p.clock = c
+}
+
+// Pace sends chunk a word at a time, waiting whenever the stream is ahead of
+// the rate. Once ctx is done the rest is sent at once.
+func (p *Pacer) Pace(ctx context.Context, chunk string, send func(piece string)) {
+	if p == nil {
+		send(chunk)
+		return
+	}
+
+	for _, piece := range splitWords(chunk) {
+		// Time the stream was idle isn't saved up beyond the burst
+		now := p.clock.Now()
+		p.next = later(p.next, now).Add(time.Duration(utils.CountTokens(piece, "")) * p.interval)
+		if wait := p.next.Sub(now) - p.burst; wait > 0 {
+			if clock.Sleep(ctx, p.clock, wait) != nil {
+				send(chunk)
+				return
+			}
+		}
+		send(piece)
+		chunk = chunk[len(piece):]
+	}
+}
+
+// splitWords splits text after each run of whitespace, keeping every character
+func splitWords(text string) []string {
+	var words []string
+	start, space := 0, false
+	for i, r := range text {
+		if space && !unicode.IsSpace(r) {
+			words = append(words, text[start:i])
+			start = i
+		}
+		space = unicode.IsSpace(r)
+	}
+	return append(words, text[start:])
+}
+
+func later(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
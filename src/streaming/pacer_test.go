@@ -0,0 +1,64 @@
+package streaming
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+)
+
+func TestPacer_Pace(t *testing.T) {
+	started := time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+	fakeClock := clock.NewFake(started)
+	pacer := NewPacer(100, 5)
+	pacer.SetClock(fakeClock)
+	chunk := strings.Repeat("a ", 15)
+
+	var pieces []string
+	var sentAt []time.Duration
+	pacer.Pace(context.Background(), chunk, func(piece string) {
+		pieces = append(pieces, piece)
+		sentAt = append(sentAt, fakeClock.Now().Sub(started))
+	})
+
+	// The first 5 words are the burst, the other 10 take 10ms each
+	assert.Len(t, pieces, 15)
+	assert.Equal(t, chunk, strings.Join(pieces, ""))
+	assert.Equal(t, time.Duration(0), sentAt[4])
+	assert.Equal(t, 10*time.Millisecond, sentAt[5])
+	assert.Equal(t, 100*time.Millisecond, sentAt[14])
+
+	// Time the stream was idle isn't saved up beyond the burst
+	fakeClock.Advance(time.Minute)
+	sentAt = nil
+	resumed := fakeClock.Now()
+	pacer.Pace(context.Background(), strings.Repeat("b ", 6), func(string) {
+		sentAt = append(sentAt, fakeClock.Now().Sub(resumed))
+	})
+	assert.Equal(t, time.Duration(0), sentAt[4])
+	assert.Equal(t, 10*time.Millisecond, sentAt[5])
+
+	// Once the client is gone, the rest is sent at once
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pieces = nil
+	pacer.Pace(ctx, strings.Repeat("c ", 20), func(piece string) {
+		pieces = append(pieces, piece)
+	})
+	assert.Equal(t, []string{strings.Repeat("c ", 20)}, pieces)
+
+	unpaced := NewPacer(0, 5)
+	unpaced.Pace(context.Background(), chunk, func(piece string) {
+		assert.Equal(t, chunk, piece)
+	})
+}
+
+func TestSplitWords(t *testing.T) {
+	assert.Equal(t, []string{"Hello, ", "wörld\n\n", "ok"}, splitWords("Hello, wörld\n\nok"))
+	assert.Equal(t, []string{" ", "leading ", "space "}, splitWords(" leading space "))
+	assert.Equal(t, []string{""}, splitWords(""))
+}
@@ -0,0 +1,45 @@
+package supervisor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const alertTimeout = 5 * time.Second
+
+// WebhookAlert returns an alert handler that POSTs each panic as JSON to url.
+// Delivery is best effort; failures are logged.
+func WebhookAlert(url string) func(Panic) {
+	client := &http.Client{Timeout: alertTimeout}
+	return func(p Panic) {
+		body, err := json.Marshal(p)
+		if err != nil {
+			log.Printf("Failed to encode panic alert: %v", err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), alertTimeout)
+		defer cancel()
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Failed to create panic alert: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Printf("Failed to send panic alert for %s: %v", p.Worker, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Panic alert webhook for %s returned %d", p.Worker, resp.StatusCode)
+		}
+	}
+}
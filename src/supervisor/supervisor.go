@@ -0,0 +1,300 @@
+// Package supervisor runs background workers so that a panic in one subsystem
+// restarts that worker instead of taking the whole process down.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/health"
+)
+
+const (
+	defaultRestartBackoff = time.Second
+	defaultMaxBackoff     = time.Minute
+	defaultPanicBudget    = 5
+	defaultBudgetWindow   = 10 * time.Minute
+)
+
+// Worker states
+const (
+	StateRunning    = "running"
+	StateRestarting = "restarting" // Waiting out the backoff after a panic
+	StateStopped    = "stopped"    // Returned normally or its context was cancelled
+	StateFailed     = "failed"     // Exhausted its panic budget and was not restarted
+	StateTask       = "task"       // One-off jobs started with Task; only their panics are tracked
+)
+
+// Panic describes a recovered worker panic, passed to alert handlers
+type Panic struct {
+	Worker string    `json:"worker"`
+	Value  string    `json:"panic"`
+	Stack  string    `json:"stack"`
+	At     time.Time `json:"at"`
+	Final  bool      `json:"final"` // The panic budget is exhausted; the worker won't be restarted
+}
+
+// WorkerStatus is a snapshot of one worker's health and panic counters
+type WorkerStatus struct {
+	Name         string    `json:"name"`
+	State        string    `json:"state"`
+	Panics       int       `json:"panics"`        // Since the process started
+	RecentPanics int       `json:"recent_panics"` // Within the budget window
+	Restarts     int       `json:"restarts"`
+	LastPanic    string    `json:"last_panic,omitempty"`
+	LastPanicAt  time.Time `json:"last_panic_at,omitzero"`
+}
+
+type worker struct {
+	status     WorkerStatus
+	panicTimes []time.Time
+}
+
+// Supervisor runs named workers, recovering their panics. A long-running
+// worker that panics is restarted with exponential backoff until it panics
+// more than the budget allows within the window; then it is marked failed
+// and its health component degraded.
+type Supervisor struct {
+	mu             sync.Mutex
+	workers        map[string]*worker
+	restartBackoff time.Duration
+	maxBackoff     time.Duration
+	budget         int
+	window         time.Duration
+	alerts         []func(Panic)
+	health         *health.Registry
+	clock          clock.Clock
+	wg             sync.WaitGroup
+}
+
+func New(cfg config.SupervisorConfig) *Supervisor {
+	s := &Supervisor{
+		workers:        make(map[string]*worker),
+		restartBackoff: cfg.RestartBackoff,
+		maxBackoff:     cfg.MaxBackoff,
+		budget:         cfg.PanicBudget,
+		window:         cfg.BudgetWindow,
+		clock:          clock.Real(),
+	}
+	if s.restartBackoff <= 0 {
+		s.restartBackoff = defaultRestartBackoff
+	}
+	if s.maxBackoff < s.restartBackoff {
+		s.maxBackoff = max(defaultMaxBackoff, s.restartBackoff)
+	}
+	if s.budget <= 0 {
+		s.budget = defaultPanicBudget
+	}
+	if s.window <= 0 {
+		s.window = defaultBudgetWindow
+	}
+	return s
+}
+
+// SetClock sets the clock used to timestamp panics and age them out of the budget window
+func (s *Supervisor) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetHealthRegistry reports each worker as a health component
+func (s *Supervisor) SetHealthRegistry(registry *health.Registry) {
+	s.health = registry
+}
+
+// OnPanic registers an alert handler, called for every recovered panic
+func (s *Supervisor) OnPanic(fn func(Panic)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.alerts = append(s.alerts, fn)
+}
+
+// Go runs a long-lived worker in the background until it returns or ctx is
+// done, restarting it whenever it panics
+func (s *Supervisor) Go(ctx context.Context, name string, fn func(ctx context.Context)) {
+	s.register(name, StateRunning)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		backoff := s.restartBackoff
+		for {
+			s.setState(name, StateRunning)
+			p := s.protect(name, true, func() { fn(ctx) })
+			if p == nil || ctx.Err() != nil {
+				s.setState(name, StateStopped)
+				return
+			}
+			if p.Final {
+				return
+			}
+
+			s.setState(name, StateRestarting)
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				s.setState(name, StateStopped)
+				return
+			case <-timer.C:
+			}
+			backoff = min(backoff*2, s.maxBackoff)
+			s.restarted(name)
+		}
+	}()
+}
+
+// Task runs a one-off job in the background. A panic is recovered, counted
+// under name and alerted on, but the job is not retried and the panic budget
+// doesn't apply.
+func (s *Supervisor) Task(name string, fn func()) {
+	s.register(name, StateTask)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.protect(name, false, fn)
+	}()
+}
+
+// Pool runs one-off tasks under a supervisor, at most size at a time
+type Pool struct {
+	supervisor *Supervisor
+	name       string
+	slots      chan struct{}
+}
+
+// NewPool returns a pool running tasks named name, at most size (at least 1)
+// at a time. s may be nil, for tests; tasks then run unsupervised.
+func (s *Supervisor) NewPool(name string, size int) *Pool {
+	return &Pool{supervisor: s, name: name, slots: make(chan struct{}, max(size, 1))}
+}
+
+// TryGo starts fn as a task unless the pool is full, and reports whether it did
+func (p *Pool) TryGo(fn func()) bool {
+	select {
+	case p.slots <- struct{}{}:
+	default:
+		return false
+	}
+
+	run := func() {
+		defer func() { <-p.slots }()
+		fn()
+	}
+	if p.supervisor == nil {
+		go run()
+	} else {
+		p.supervisor.Task(p.name, run)
+	}
+	return true
+}
+
+// Wait blocks until every worker and task has returned
+func (s *Supervisor) Wait() {
+	s.wg.Wait()
+}
+
+// Workers returns the status of every worker, sorted by name
+func (s *Supervisor) Workers() []WorkerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]WorkerStatus, 0, len(s.workers))
+	for _, w := range s.workers {
+		status := w.status
+		status.RecentPanics = len(s.recentPanics(w))
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
+
+// protect calls fn, returning the recovered panic if it panicked
+func (s *Supervisor) protect(name string, budgeted bool, fn func()) (p *Panic) {
+	defer func() {
+		if r := recover(); r != nil {
+			p = s.recordPanic(name, budgeted, r, debug.Stack())
+		}
+	}()
+
+	fn()
+	return nil
+}
+
+func (s *Supervisor) recordPanic(name string, budgeted bool, recovered any, stack []byte) *Panic {
+	now := s.clock.Now()
+	p := Panic{Worker: name, Value: fmt.Sprint(recovered), Stack: string(stack), At: now}
+
+	s.mu.Lock()
+	w := s.workers[name]
+	w.status.Panics++
+	w.status.LastPanic = p.Value
+	w.status.LastPanicAt = now
+	w.panicTimes = append(s.recentPanics(w), now)
+	if budgeted && len(w.panicTimes) > s.budget {
+		p.Final = true
+		w.status.State = StateFailed
+	}
+	alerts := s.alerts
+	s.mu.Unlock()
+
+	log.Printf("🚨 Worker %s panicked: %s\n%s", name, p.Value, stack)
+	if p.Final {
+		log.Printf("🚨 Worker %s exceeded its panic budget (%d in %s), not restarting", name, s.budget, s.window)
+		if s.health != nil {
+			s.health.Set(name, health.StatusDegraded, fmt.Sprintf("stopped after %d panics in %s: %s", len(w.panicTimes), s.window, p.Value))
+		}
+	}
+	for _, alert := range alerts {
+		alert(p)
+	}
+	return &p
+}
+
+// recentPanics drops panics older than the budget window; callers hold s.mu
+func (s *Supervisor) recentPanics(w *worker) []time.Time {
+	cutoff := s.clock.Now().Add(-s.window)
+	recent := w.panicTimes[:0]
+	for _, at := range w.panicTimes {
+		if at.After(cutoff) {
+			recent = append(recent, at)
+		}
+	}
+	w.panicTimes = recent
+	return recent
+}
+
+func (s *Supervisor) register(name string, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.workers[name]; !ok {
+		s.workers[name] = &worker{status: WorkerStatus{Name: name, State: state}}
+	}
+}
+
+func (s *Supervisor) setState(name string, state string) {
+	s.mu.Lock()
+	s.workers[name].status.State = state
+	s.mu.Unlock()
+
+	if s.health != nil && state == StateRunning {
+		s.health.Set(name, health.StatusReady, "")
+	}
+}
+
+func (s *Supervisor) restarted(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workers[name].status.Restarts++
+}
@@ -0,0 +1,135 @@
+package supervisor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/health"
+)
+
+func newTestSupervisor(budget int) (*Supervisor, *clock.Fake) {
+	s := New(config.SupervisorConfig{
+		RestartBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+		PanicBudget:    budget,
+		BudgetWindow:   time.Minute,
+	})
+	clk := clock.NewFake(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.SetClock(clk)
+	return s, clk
+}
+
+func TestSupervisor_RestartsAfterPanic(t *testing.T) {
+	s, _ := newTestSupervisor(5)
+	var alerts []Panic
+	s.OnPanic(func(p Panic) { alerts = append(alerts, p) })
+
+	var runs atomic.Int32
+	s.Go(context.Background(), "worker", func(ctx context.Context) {
+		if runs.Add(1) <= 2 {
+			panic("boom")
+		}
+	})
+	s.Wait()
+
+	assert.Equal(t, int32(3), runs.Load())
+	require.Len(t, s.Workers(), 1)
+	status := s.Workers()[0]
+	assert.Equal(t, StateStopped, status.State)
+	assert.Equal(t, 2, status.Panics)
+	assert.Equal(t, 2, status.Restarts)
+	assert.Equal(t, "boom", status.LastPanic)
+	require.Len(t, alerts, 2)
+	assert.Equal(t, "worker", alerts[0].Worker)
+	assert.False(t, alerts[1].Final)
+}
+
+func TestSupervisor_StopsWorkerOverBudget(t *testing.T) {
+	s, _ := newTestSupervisor(2)
+	registry := health.NewRegistry()
+	s.SetHealthRegistry(registry)
+
+	var runs atomic.Int32
+	s.Go(context.Background(), "worker", func(ctx context.Context) {
+		runs.Add(1)
+		panic("always")
+	})
+	s.Wait()
+
+	assert.Equal(t, int32(3), runs.Load(), "budget of 2 allows two restarts")
+	status := s.Workers()[0]
+	assert.Equal(t, StateFailed, status.State)
+	assert.Equal(t, 3, status.RecentPanics)
+	assert.Equal(t, health.StatusDegraded, registry.Snapshot()["worker"].Status)
+}
+
+func TestSupervisor_BudgetWindowSlides(t *testing.T) {
+	s, clk := newTestSupervisor(1)
+
+	var runs atomic.Int32
+	s.Go(context.Background(), "worker", func(ctx context.Context) {
+		n := runs.Add(1)
+		if n <= 3 {
+			// Each panic lands in a new window, so the budget never runs out
+			clk.Advance(2 * time.Minute)
+			panic("intermittent")
+		}
+	})
+	s.Wait()
+
+	status := s.Workers()[0]
+	assert.Equal(t, StateStopped, status.State)
+	assert.Equal(t, 3, status.Panics)
+	assert.Equal(t, 1, status.RecentPanics)
+}
+
+func TestSupervisor_TaskRecoversPanic(t *testing.T) {
+	s, _ := newTestSupervisor(1)
+
+	for i := 0; i < 3; i++ {
+		s.Task("cache_writer", func() { panic("write failed") })
+	}
+	s.Wait()
+
+	status := s.Workers()[0]
+	assert.Equal(t, StateTask, status.State)
+	assert.Equal(t, 3, status.Panics)
+}
+
+func TestSupervisor_StopsOnCancel(t *testing.T) {
+	s, _ := newTestSupervisor(5)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.Go(ctx, "worker", func(ctx context.Context) {
+		<-ctx.Done()
+	})
+	cancel()
+	s.Wait()
+
+	assert.Equal(t, StateStopped, s.Workers()[0].State)
+}
+
+func TestPool_CapsRunningTasks(t *testing.T) {
+	s, _ := newTestSupervisor(5)
+	pool := s.NewPool("refresh", 1)
+
+	release := make(chan struct{})
+	assert.True(t, pool.TryGo(func() { <-release }))
+	assert.False(t, pool.TryGo(func() {}), "the pool is full")
+	close(release)
+	s.Wait()
+
+	// A panicking task frees its slot too
+	assert.True(t, pool.TryGo(func() { panic("refresh failed") }))
+	s.Wait()
+	assert.True(t, pool.TryGo(func() {}))
+	s.Wait()
+	assert.Equal(t, 1, s.Workers()[0].Panics)
+}
@@ -0,0 +1,115 @@
+// Package terms records which versions of the terms of service and privacy
+// policy each user has accepted.
+package terms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+// acceptedKeyPrefix prefixes a hash of a user's acceptances by version
+const acceptedKeyPrefix = "terms_accepted:"
+
+// Store keeps acceptances in Redis. An acceptance is never withdrawn, so
+// positive answers are remembered locally and the gate costs a Redis call only
+// until the user accepts.
+type Store struct {
+	client *redis.Client
+	clock  clock.Clock
+
+	mu       sync.Mutex
+	accepted map[string]bool // "userID\x00version" pairs known to be accepted
+}
+
+func NewStore(client *redis.Client) *Store {
+	return &Store{
+		client:   client,
+		clock:    clock.Real(),
+		accepted: make(map[string]bool),
+	}
+}
+
+// SetClock sets the clock that timestamps acceptances
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// Accept records the user accepting version. Accepting a version again keeps
+// the original record.
+func (s *Store) Accept(ctx context.Context, userID string, acceptance models.TermsAcceptance) (*models.TermsAcceptance, error) {
+	acceptance.AcceptedAt = s.clock.Now()
+	data, err := json.Marshal(acceptance)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode acceptance: %w", err)
+	}
+
+	key := acceptedKeyPrefix + userID
+	if err := s.client.HSetNX(ctx, key, acceptance.Version, data).Err(); err != nil {
+		return nil, fmt.Errorf("failed to record acceptance: %w", err)
+	}
+	stored, err := s.client.HGet(ctx, key, acceptance.Version).Bytes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get acceptance: %w", err)
+	}
+	var recorded models.TermsAcceptance
+	if err := json.Unmarshal(stored, &recorded); err != nil {
+		return nil, fmt.Errorf("failed to decode acceptance: %w", err)
+	}
+
+	s.remember(userID, acceptance.Version)
+	return &recorded, nil
+}
+
+// Accepted reports whether the user has accepted version
+func (s *Store) Accepted(ctx context.Context, userID string, version string) (bool, error) {
+	s.mu.Lock()
+	known := s.accepted[userID+"\x00"+version]
+	s.mu.Unlock()
+	if known {
+		return true, nil
+	}
+
+	accepted, err := s.client.HExists(ctx, acceptedKeyPrefix+userID, version).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check acceptance: %w", err)
+	}
+	if accepted {
+		s.remember(userID, version)
+	}
+	return accepted, nil
+}
+
+// History returns every version the user has accepted, oldest first
+func (s *Store) History(ctx context.Context, userID string) ([]models.TermsAcceptance, error) {
+	fields, err := s.client.HGetAll(ctx, acceptedKeyPrefix+userID).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get acceptances: %w", err)
+	}
+
+	history := make([]models.TermsAcceptance, 0, len(fields))
+	for _, data := range fields {
+		var acceptance models.TermsAcceptance
+		if err := json.Unmarshal([]byte(data), &acceptance); err != nil {
+			return nil, fmt.Errorf("failed to decode acceptance: %w", err)
+		}
+		history = append(history, acceptance)
+	}
+	sort.Slice(history, func(i, j int) bool {
+		return history[i].AcceptedAt.Before(history[j].AcceptedAt)
+	})
+	return history, nil
+}
+
+func (s *Store) remember(userID string, version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.accepted[userID+"\x00"+version] = true
+}
@@ -0,0 +1,51 @@
+package terms
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestStore_AcceptKeepsFirstRecord(t *testing.T) {
+	mr := miniredis.RunT(t)
+	fakeClock := clock.NewFake(time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC))
+	store := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	store.SetClock(fakeClock)
+	ctx := context.Background()
+
+	accepted, err := store.Accepted(ctx, "alice", "2026-10")
+	require.NoError(t, err)
+	assert.False(t, accepted)
+
+	first, err := store.Accept(ctx, "alice", models.TermsAcceptance{Version: "2026-01", IPAddress: "10.0.0.1"})
+	require.NoError(t, err)
+	fakeClock.Advance(time.Hour)
+	_, err = store.Accept(ctx, "alice", models.TermsAcceptance{Version: "2026-10"})
+	require.NoError(t, err)
+	fakeClock.Advance(time.Hour)
+	again, err := store.Accept(ctx, "alice", models.TermsAcceptance{Version: "2026-01", IPAddress: "10.0.0.2"})
+	require.NoError(t, err)
+	assert.Equal(t, first, again, "accepting again keeps the original record")
+
+	accepted, err = store.Accepted(ctx, "alice", "2026-10")
+	require.NoError(t, err)
+	assert.True(t, accepted)
+	accepted, err = store.Accepted(ctx, "bob", "2026-10")
+	require.NoError(t, err)
+	assert.False(t, accepted)
+
+	history, err := store.History(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "2026-01", history[0].Version)
+	assert.Equal(t, "10.0.0.1", history[0].IPAddress)
+	assert.Equal(t, "2026-10", history[1].Version)
+}
@@ -0,0 +1,276 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+const (
+	spendKeyPrefix = "spend:"
+	platformOwner  = "platform"
+	spendTTL       = 62 * 24 * time.Hour // Long enough to still report last month's spend
+)
+
+// Actions once a tier's provider key reaches its cap
+const (
+	SpendActionRouteOtherTier = "route_other_tier"
+	SpendActionReject         = "reject"
+)
+
+// ErrSpendCapReached is returned for requests that would use a provider key
+// whose monthly spend cap is reached
+var ErrSpendCapReached = errors.New("monthly spend cap reached")
+
+// SpendCaps tracks what each provider key, the platform's or an org's own,
+// spent this month and stops it being used once it reaches its cap
+type SpendCaps struct {
+	client      *redis.Client
+	clock       clock.Clock
+	config      config.SpendCapsConfig
+	llmProvider string // "" when the LLM tier is disabled
+	slmProvider string
+	alerts      []func(models.SpendAlert)
+}
+
+func NewSpendCaps(client *redis.Client, cfg config.SpendCapsConfig, llmProvider string, slmProvider string) *SpendCaps {
+	return &SpendCaps{
+		client:      client,
+		clock:       clock.Real(),
+		config:      cfg,
+		llmProvider: llmProvider,
+		slmProvider: slmProvider,
+	}
+}
+
+// SetClock sets the clock that decides which month spend lands in
+func (s *SpendCaps) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// OnAlert registers a handler, called once a month per key when its spend
+// crosses the alert threshold and when it reaches its cap
+func (s *SpendCaps) OnAlert(fn func(models.SpendAlert)) {
+	s.alerts = append(s.alerts, fn)
+}
+
+// Action returns what happens to requests for a capped tier
+func (s *SpendCaps) Action() string {
+	if s.config.Action == SpendActionReject {
+		return SpendActionReject
+	}
+	return SpendActionRouteOtherTier
+}
+
+// Available reports whether a tier has a provider at all
+func (s *SpendCaps) Available(useLLM bool) bool {
+	return s.provider(useLLM) != ""
+}
+
+// Check returns ErrSpendCapReached if the key a request's calls to a tier
+// would use has reached its cap. Spend that can't be read doesn't block
+// requests.
+func (s *SpendCaps) Check(ctx context.Context, useLLM bool) error {
+	if s == nil {
+		return nil
+	}
+	provider := s.provider(useLLM)
+	org := keyOwner(ctx, provider)
+	limit, ok := s.capFor(provider, org)
+	if !ok {
+		return nil
+	}
+
+	now := s.clock.Now().UTC()
+	spent, err := s.client.Get(ctx, spendKey(now, provider, org)).Float64()
+	if err != nil && err != redis.Nil {
+		log.Printf("Failed to check %s spend: %v", provider, err)
+		return nil
+	}
+	if spent < limit {
+		return nil
+	}
+
+	next := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	return fmt.Errorf("%w: %s has spent $%.2f of its $%.2f monthly cap; it resets on %s",
+		ErrSpendCapReached, describeKey(provider, org), spent, limit, next.Format(dayLayout))
+}
+
+// Record adds what a request's calls to a tier cost to the spend of the key
+// they used
+func (s *SpendCaps) Record(ctx context.Context, useLLM bool, cost float64) error {
+	if s == nil || cost <= 0 {
+		return nil
+	}
+	provider := s.provider(useLLM)
+	if provider == "" {
+		return nil
+	}
+	org := keyOwner(ctx, provider)
+
+	now := s.clock.Now().UTC()
+	key := spendKey(now, provider, org)
+	pipe := s.client.TxPipeline()
+	total := pipe.IncrByFloat(ctx, key, cost)
+	pipe.Expire(ctx, key, spendTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to record %s spend: %w", provider, err)
+	}
+
+	limit, ok := s.capFor(provider, org)
+	if !ok {
+		return nil
+	}
+	// Increments are atomic, so exactly one request sees each threshold crossed
+	spent := total.Val()
+	previous := spent - cost
+	level := ""
+	switch {
+	case previous < limit && spent >= limit:
+		level = models.SpendCapReached
+	case s.config.AlertAt > 0 && previous < limit*s.config.AlertAt && spent >= limit*s.config.AlertAt:
+		level = models.SpendCapWarning
+	}
+	if level != "" {
+		s.alert(models.SpendAlert{
+			Provider: provider,
+			Org:      org,
+			Month:    now.Format(monthLayout),
+			Level:    level,
+			SpentUSD: spent,
+			CapUSD:   limit,
+			Time:     now,
+		})
+	}
+	return nil
+}
+
+// Status returns this month's spend of every capped key that has spent
+// anything, and of the capped platform keys
+func (s *SpendCaps) Status(ctx context.Context) ([]models.SpendCapStatus, error) {
+	now := s.clock.Now().UTC()
+	month := now.Format(monthLayout)
+
+	var statuses []models.SpendCapStatus
+	add := func(provider string, org string, spent float64) {
+		limit, ok := s.capFor(provider, org)
+		if !ok {
+			return
+		}
+		statuses = append(statuses, models.SpendCapStatus{
+			Provider: provider,
+			Org:      org,
+			Month:    month,
+			SpentUSD: spent,
+			CapUSD:   limit,
+			Reached:  spent >= limit,
+		})
+	}
+
+	for _, provider := range []string{s.llmProvider, s.slmProvider} {
+		if provider == "" {
+			continue
+		}
+		spent, err := s.client.Get(ctx, spendKey(now, provider, "")).Float64()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("failed to get spend: %w", err)
+		}
+		add(provider, "", spent)
+
+		prefix := spendKeyPrefix + month + ":" + provider + ":org:"
+		iter := s.client.Scan(ctx, 0, prefix+"*", 100).Iterator()
+		for iter.Next(ctx) {
+			spent, err := s.client.Get(ctx, iter.Val()).Float64()
+			if err != nil {
+				continue
+			}
+			add(provider, strings.TrimPrefix(iter.Val(), prefix), spent)
+		}
+		if err := iter.Err(); err != nil {
+			return nil, fmt.Errorf("failed to list spend: %w", err)
+		}
+	}
+	return statuses, nil
+}
+
+// PlatformShare returns the share of its monthly cap the platform's key for a
+// tier has spent, or false if it has no cap
+func (s *SpendCaps) PlatformShare(ctx context.Context, useLLM bool) (float64, bool, error) {
+	provider := s.provider(useLLM)
+	limit, ok := s.capFor(provider, "")
+	if provider == "" || !ok {
+		return 0, false, nil
+	}
+	spent, err := s.client.Get(ctx, spendKey(s.clock.Now().UTC(), provider, "")).Float64()
+	if err != nil && err != redis.Nil {
+		return 0, false, fmt.Errorf("failed to get spend: %w", err)
+	}
+	return spent / limit, true, nil
+}
+
+func (s *SpendCaps) provider(useLLM bool) string {
+	if useLLM {
+		return s.llmProvider
+	}
+	return s.slmProvider
+}
+
+// capFor returns the cap of a provider's key: the platform's when org is
+// empty, else the org's own. A cap naming the org wins over one for "*".
+func (s *SpendCaps) capFor(provider string, org string) (float64, bool) {
+	limit, found := 0.0, false
+	for _, c := range s.config.Caps {
+		if c.Provider != provider || c.MonthlyUSD <= 0 {
+			continue
+		}
+		switch {
+		case c.Org == org:
+			return c.MonthlyUSD, true
+		case c.Org == "*" && org != "":
+			limit, found = c.MonthlyUSD, true
+		}
+	}
+	return limit, found
+}
+
+func (s *SpendCaps) alert(alert models.SpendAlert) {
+	log.Printf("💸 %s %s: $%.2f of $%.2f spent in %s", describeKey(alert.Provider, alert.Org), alert.Level, alert.SpentUSD, alert.CapUSD, alert.Month)
+	for _, fn := range s.alerts {
+		fn(alert)
+	}
+}
+
+// keyOwner returns the org whose own key calls to provider use, or "" for the
+// platform's key
+func keyOwner(ctx context.Context, provider string) string {
+	keys := credentials.FromContext(ctx)
+	if _, ok, _ := keys.Key(provider); ok {
+		return keys.Org()
+	}
+	return ""
+}
+
+func describeKey(provider string, org string) string {
+	if org == "" {
+		return "the platform's " + provider + " key"
+	}
+	return "org " + org + "'s " + provider + " key"
+}
+
+func spendKey(t time.Time, provider string, org string) string {
+	owner := platformOwner
+	if org != "" {
+		owner = "org:" + org
+	}
+	return spendKeyPrefix + t.Format(monthLayout) + ":" + provider + ":" + owner
+}
@@ -0,0 +1,76 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/credentials"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func setupSpendCaps(t *testing.T, fakeClock *clock.Fake, caps ...config.SpendCapConfig) *SpendCaps {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	spendCaps := NewSpendCaps(client, config.SpendCapsConfig{Caps: caps, AlertAt: 0.8}, "openai", "groq")
+	spendCaps.SetClock(fakeClock)
+	return spendCaps
+}
+
+func TestSpendCaps_CapsKeyUntilNextMonth(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC))
+	spendCaps := setupSpendCaps(t, fakeClock, config.SpendCapConfig{Provider: "openai", MonthlyUSD: 10})
+	ctx := context.Background()
+
+	var alerts []models.SpendAlert
+	spendCaps.OnAlert(func(alert models.SpendAlert) { alerts = append(alerts, alert) })
+
+	for i := 0; i < 4; i++ {
+		require.NoError(t, spendCaps.Record(ctx, true, 3))
+	}
+	require.NoError(t, spendCaps.Record(ctx, false, 100), "the SLM key has no cap")
+
+	require.Len(t, alerts, 2, "one alert per threshold")
+	assert.Equal(t, models.SpendCapWarning, alerts[0].Level)
+	assert.Equal(t, models.SpendCapReached, alerts[1].Level)
+	assert.InDelta(t, 12, alerts[1].SpentUSD, 1e-9)
+
+	err := spendCaps.Check(ctx, true)
+	assert.ErrorIs(t, err, ErrSpendCapReached)
+	assert.Contains(t, err.Error(), "2026-04-01")
+	assert.NoError(t, spendCaps.Check(ctx, false))
+
+	statuses, err := spendCaps.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.True(t, statuses[0].Reached)
+
+	fakeClock.Advance(20 * 24 * time.Hour)
+	assert.NoError(t, spendCaps.Check(ctx, true), "caps reset every month")
+}
+
+func TestSpendCaps_OrgKeysHaveTheirOwnCaps(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC))
+	spendCaps := setupSpendCaps(t, fakeClock,
+		config.SpendCapConfig{Provider: "groq", MonthlyUSD: 100},
+		config.SpendCapConfig{Provider: "groq", Org: "*", MonthlyUSD: 5},
+		config.SpendCapConfig{Provider: "groq", Org: "big", MonthlyUSD: 50},
+	)
+	acme := credentials.WithKeys(context.Background(), credentials.NewKeys("acme", map[string]string{"groq": "gsk-acme"}, true))
+	big := credentials.WithKeys(context.Background(), credentials.NewKeys("big", map[string]string{"groq": "gsk-big"}, true))
+
+	require.NoError(t, spendCaps.Record(acme, false, 6))
+	require.NoError(t, spendCaps.Record(big, false, 6))
+
+	assert.ErrorIs(t, spendCaps.Check(acme, false), ErrSpendCapReached)
+	assert.NoError(t, spendCaps.Check(big, false), "a cap naming the org wins over \"*\"")
+	assert.NoError(t, spendCaps.Check(context.Background(), false), "the platform's key is counted apart")
+}
@@ -0,0 +1,339 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+const (
+	usageKeyPrefix  = "usage:"
+	servedKeyPrefix = "served:"   // User and request ID -> marker that the request was recorded
+	replicaInfix    = ":replica:" // Separates a usage key from the region whose counts a replica holds
+	dayLayout       = "2006-01-02"
+	monthLayout     = "2006-01"
+	dailyTTL        = 400 * 24 * time.Hour     // Keep a little over a year of daily history
+	monthlyTTL      = 3 * 365 * 24 * time.Hour // Keep three years of monthly history
+)
+
+// Database keeps usage aggregates durably behind Redis
+type Database interface {
+	// AddUsage adds delta to the user's usage in each period and returns the new totals
+	AddUsage(ctx context.Context, userID string, periods []string, delta models.UsageSummary) ([]models.UsageSummary, error)
+	// LoadUsage returns the user's usage in each period
+	LoadUsage(ctx context.Context, userID string, periods []string) ([]models.UsageSummary, error)
+}
+
+// Store is a per-user usage ledger: every request's cost metrics are added to
+// daily and monthly aggregates kept in Redis hashes
+type Store struct {
+	client   *redis.Client
+	clock    clock.Clock
+	replicas []string       // Regions whose counts are replicated here and added to ours
+	outbox   *outbox.Outbox // Receives a usage event per request and a billing event per charge, optional
+	database Database       // Holds this region's aggregates when set, optional
+	requests time.Duration  // How long served requests' IDs are kept; not kept when 0
+}
+
+// usageEvent is the data of a usage event
+type usageEvent struct {
+	RequestID string `json:"request_id,omitempty"` // Matches the request's annotations
+	CacheHit  bool   `json:"cache_hit"`
+	*models.CostMetrics
+}
+
+// billingEvent is the data of a billing event
+type billingEvent struct {
+	Model          string              `json:"model"`
+	Cost           float64             `json:"cost"` // Total charged in USD
+	ModelBreakdown []models.ModelUsage `json:"model_breakdown,omitempty"`
+}
+
+func NewStore(client *redis.Client) *Store {
+	return &Store{
+		client: client,
+		clock:  clock.Real(),
+	}
+}
+
+// SetClock sets the clock that decides which day and month usage lands in
+func (s *Store) SetClock(c clock.Clock) {
+	s.clock = c
+}
+
+// SetReplicaRegions adds the counts replicated from the regions to every
+// summary, so totals cover the whole deployment
+func (s *Store) SetReplicaRegions(regions []string) {
+	s.replicas = regions
+}
+
+// SetOutbox records every request as a usage event, and every request that
+// cost money as a billing event, in the same transaction as its counters
+func (s *Store) SetOutbox(o *outbox.Outbox) {
+	s.outbox = o
+}
+
+// SetRequestRetention keeps the ID of every recorded request for ttl, so
+// references to a request (like annotations of its response) can be checked
+func (s *Store) SetRequestRetention(ttl time.Duration) {
+	s.requests = ttl
+}
+
+// SetDatabase keeps the aggregates in the database, with Redis caching the
+// totals it returns. Aggregates Redis lost are read from it, and restored by
+// the next request.
+func (s *Store) SetDatabase(database Database) {
+	s.database = database
+}
+
+// ReplicaKey is where a region's copy of a usage key is kept on other regions
+func ReplicaKey(key string, region string) string {
+	return key + replicaInfix + region
+}
+
+// IsReplicaKey reports whether key holds another region's counts
+func IsReplicaKey(key string) bool {
+	return strings.Contains(key, replicaInfix)
+}
+
+// Record adds one request to the user's daily and monthly aggregates
+func (s *Store) Record(ctx context.Context, userID string, metrics *models.CostMetrics, cacheHit bool) error {
+	if metrics == nil {
+		metrics = &models.CostMetrics{}
+	}
+
+	now := s.clock.Now().UTC()
+	cacheHits := 0
+	if cacheHit {
+		cacheHits = 1
+	}
+
+	periods := []struct {
+		key    string
+		period string
+		ttl    time.Duration
+	}{
+		{dayKey(userID, now), now.Format(dayLayout), dailyTTL},
+		{monthKey(userID, now), now.Format(monthLayout), monthlyTTL},
+	}
+
+	// With a database, it holds the counts and Redis caches its totals, so
+	// there's a single write to get right; without one, Redis counts
+	var totals []models.UsageSummary
+	if s.database != nil {
+		var err error
+		totals, err = s.database.AddUsage(ctx, userID, []string{periods[0].period, periods[1].period}, models.UsageSummary{
+			Requests:     1,
+			CacheHits:    cacheHits,
+			InputTokens:  metrics.InputTokens,
+			OutputTokens: metrics.OutputTokens,
+			TotalTokens:  metrics.TotalTokens,
+			Cost:         metrics.TotalCost,
+			Savings:      metrics.EstimatedSavings,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	pipe := s.client.TxPipeline()
+	for i, period := range periods {
+		if totals != nil {
+			pipe.HSet(ctx, period.key, map[string]interface{}{
+				"requests":      totals[i].Requests,
+				"cache_hits":    totals[i].CacheHits,
+				"input_tokens":  totals[i].InputTokens,
+				"output_tokens": totals[i].OutputTokens,
+				"total_tokens":  totals[i].TotalTokens,
+				"cost":          totals[i].Cost,
+				"savings":       totals[i].Savings,
+			})
+		} else {
+			pipe.HIncrBy(ctx, period.key, "requests", 1)
+			pipe.HIncrBy(ctx, period.key, "cache_hits", int64(cacheHits))
+			pipe.HIncrBy(ctx, period.key, "input_tokens", int64(metrics.InputTokens))
+			pipe.HIncrBy(ctx, period.key, "output_tokens", int64(metrics.OutputTokens))
+			pipe.HIncrBy(ctx, period.key, "total_tokens", int64(metrics.TotalTokens))
+			pipe.HIncrByFloat(ctx, period.key, "cost", metrics.TotalCost)
+			pipe.HIncrByFloat(ctx, period.key, "savings", metrics.EstimatedSavings)
+		}
+		pipe.Expire(ctx, period.key, period.ttl)
+	}
+	requestID := correlation.RequestID(ctx)
+	if s.requests > 0 && requestID != "" {
+		pipe.Set(ctx, requestKey(userID, requestID), 1, s.requests)
+	}
+	if err := s.outbox.Append(ctx, pipe, outbox.TypeUsage, "request", userID, usageEvent{RequestID: requestID, CacheHit: cacheHit, CostMetrics: metrics}); err != nil {
+		return err
+	}
+	if metrics.TotalCost > 0 {
+		charge := billingEvent{Model: metrics.Model, Cost: metrics.TotalCost, ModelBreakdown: metrics.ModelBreakdown}
+		if err := s.outbox.Append(ctx, pipe, outbox.TypeBilling, "charge", userID, charge); err != nil {
+			return err
+		}
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		// The database counted the request; the next one brings Redis up to date
+		return fmt.Errorf("failed to record usage: %w", err)
+	}
+	return nil
+}
+
+// Served reports whether a request of the user's with the ID was recorded
+// within the request retention
+func (s *Store) Served(ctx context.Context, userID string, requestID string) (bool, error) {
+	n, err := s.client.Exists(ctx, requestKey(userID, requestID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to look up request: %w", err)
+	}
+	return n > 0, nil
+}
+
+// Today returns the user's usage for the current UTC day
+func (s *Store) Today(ctx context.Context, userID string) (*models.UsageSummary, error) {
+	now := s.clock.Now().UTC()
+	return s.get(ctx, userID, dayKey(userID, now), now.Format(dayLayout))
+}
+
+// ThisMonth returns the user's usage for the current UTC month
+func (s *Store) ThisMonth(ctx context.Context, userID string) (*models.UsageSummary, error) {
+	now := s.clock.Now().UTC()
+	return s.get(ctx, userID, monthKey(userID, now), now.Format(monthLayout))
+}
+
+// DailyHistory returns the user's usage for each of the last n days, newest first
+func (s *Store) DailyHistory(ctx context.Context, userID string, days int) ([]models.UsageSummary, error) {
+	now := s.clock.Now().UTC()
+
+	keys := make([]string, days)
+	periods := make([]string, days)
+	for i := 0; i < days; i++ {
+		day := now.AddDate(0, 0, -i)
+		keys[i] = dayKey(userID, day)
+		periods[i] = day.Format(dayLayout)
+	}
+
+	return s.getMany(ctx, userID, keys, periods)
+}
+
+// MonthlyHistory returns the user's usage for each of the last n months, newest first
+func (s *Store) MonthlyHistory(ctx context.Context, userID string, months int) ([]models.UsageSummary, error) {
+	now := s.clock.Now().UTC()
+	firstOfMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	keys := make([]string, months)
+	periods := make([]string, months)
+	for i := 0; i < months; i++ {
+		month := firstOfMonth.AddDate(0, -i, 0)
+		keys[i] = monthKey(userID, month)
+		periods[i] = month.Format(monthLayout)
+	}
+
+	return s.getMany(ctx, userID, keys, periods)
+}
+
+func (s *Store) get(ctx context.Context, userID string, key string, period string) (*models.UsageSummary, error) {
+	summaries, err := s.getMany(ctx, userID, []string{key}, []string{period})
+	if err != nil {
+		return nil, err
+	}
+	return &summaries[0], nil
+}
+
+func (s *Store) getMany(ctx context.Context, userID string, keys []string, periods []string) ([]models.UsageSummary, error) {
+	pipe := s.client.Pipeline()
+	cmds := make([][]*redis.MapStringStringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = append(cmds[i], pipe.HGetAll(ctx, key))
+		for _, region := range s.replicas {
+			cmds[i] = append(cmds[i], pipe.HGetAll(ctx, ReplicaKey(key, region)))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	summaries := make([]models.UsageSummary, len(keys))
+	var lost []int // Periods missing from Redis, read from the database
+	for i, regionCmds := range cmds {
+		summaries[i] = parseSummary(periods[i], regionCmds[0].Val())
+		if len(regionCmds[0].Val()) == 0 && s.database != nil {
+			lost = append(lost, i)
+		}
+	}
+	if len(lost) > 0 {
+		lostPeriods := make([]string, len(lost))
+		for j, i := range lost {
+			lostPeriods[j] = periods[i]
+		}
+		stored, err := s.database.LoadUsage(ctx, userID, lostPeriods)
+		if err != nil {
+			return nil, err
+		}
+		for j, i := range lost {
+			summaries[i] = stored[j]
+		}
+	}
+	for i, regionCmds := range cmds {
+		for _, cmd := range regionCmds[1:] {
+			addSummary(&summaries[i], parseSummary(periods[i], cmd.Val()))
+		}
+	}
+	return summaries, nil
+}
+
+// addSummary adds the counts of other to summary
+func addSummary(summary *models.UsageSummary, other models.UsageSummary) {
+	summary.Requests += other.Requests
+	summary.CacheHits += other.CacheHits
+	summary.InputTokens += other.InputTokens
+	summary.OutputTokens += other.OutputTokens
+	summary.TotalTokens += other.TotalTokens
+	summary.Cost += other.Cost
+	summary.Savings += other.Savings
+}
+
+// parseSummary converts a usage hash into a summary; missing fields count as zero
+func parseSummary(period string, fields map[string]string) models.UsageSummary {
+	atoi := func(field string) int {
+		n, _ := strconv.Atoi(fields[field])
+		return n
+	}
+	atof := func(field string) float64 {
+		f, _ := strconv.ParseFloat(fields[field], 64)
+		return f
+	}
+
+	return models.UsageSummary{
+		Period:       period,
+		Requests:     atoi("requests"),
+		CacheHits:    atoi("cache_hits"),
+		InputTokens:  atoi("input_tokens"),
+		OutputTokens: atoi("output_tokens"),
+		TotalTokens:  atoi("total_tokens"),
+		Cost:         atof("cost"),
+		Savings:      atof("savings"),
+	}
+}
+
+func requestKey(userID string, requestID string) string {
+	return servedKeyPrefix + userID + ":" + requestID
+}
+
+func dayKey(userID string, t time.Time) string {
+	return usageKeyPrefix + userID + ":day:" + t.Format(dayLayout)
+}
+
+func monthKey(userID string, t time.Time) string {
+	return usageKeyPrefix + userID + ":month:" + t.Format(monthLayout)
+}
@@ -0,0 +1,158 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/correlation"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+func setupStore(t *testing.T, fakeClock *clock.Fake) *Store {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+
+	store := NewStore(client)
+	store.SetClock(fakeClock)
+	return store
+}
+
+func TestStore_RecordAggregatesDayAndMonth(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC))
+	store := setupStore(t, fakeClock)
+	ctx := context.Background()
+
+	metrics := &models.CostMetrics{InputTokens: 100, OutputTokens: 50, TotalTokens: 150, TotalCost: 0.002, EstimatedSavings: 0.01}
+	require.NoError(t, store.Record(ctx, "user-1", metrics, false))
+	require.NoError(t, store.Record(ctx, "user-1", metrics, true))
+	require.NoError(t, store.Record(ctx, "user-2", metrics, false))
+
+	today, err := store.Today(ctx, "user-1")
+	require.NoError(t, err)
+	assert.Equal(t, "2026-03-31", today.Period)
+	assert.Equal(t, 2, today.Requests)
+	assert.Equal(t, 1, today.CacheHits)
+	assert.Equal(t, 300, today.TotalTokens)
+	assert.InDelta(t, 0.004, today.Cost, 1e-9)
+	assert.InDelta(t, 0.02, today.Savings, 1e-9)
+
+	// Next day, new month
+	fakeClock.Advance(2 * time.Hour)
+	require.NoError(t, store.Record(ctx, "user-1", metrics, false))
+
+	days, err := store.DailyHistory(ctx, "user-1", 3)
+	require.NoError(t, err)
+	require.Len(t, days, 3)
+	assert.Equal(t, "2026-04-01", days[0].Period)
+	assert.Equal(t, 1, days[0].Requests)
+	assert.Equal(t, "2026-03-31", days[1].Period)
+	assert.Equal(t, 2, days[1].Requests)
+	assert.Equal(t, 0, days[2].Requests)
+
+	months, err := store.MonthlyHistory(ctx, "user-1", 2)
+	require.NoError(t, err)
+	require.Len(t, months, 2)
+	assert.Equal(t, "2026-04", months[0].Period)
+	assert.Equal(t, 1, months[0].Requests)
+	assert.Equal(t, "2026-03", months[1].Period)
+	assert.Equal(t, 2, months[1].Requests)
+}
+
+func TestStore_RecordWritesOutboxEvents(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	store := NewStore(client)
+	store.SetOutbox(outbox.NewOutbox(client, config.OutboxConfig{Stream: "events"}))
+	ctx := context.Background()
+
+	require.NoError(t, store.Record(ctx, "alice", &models.CostMetrics{TotalTokens: 10, TotalCost: 0.01, Model: "gpt-4o"}, false))
+	require.NoError(t, store.Record(ctx, "alice", &models.CostMetrics{TotalTokens: 10}, true))
+
+	entries, err := client.XRange(ctx, "events", "-", "+").Result()
+	require.NoError(t, err)
+	var types []string
+	for _, entry := range entries {
+		types = append(types, entry.Values["type"].(string))
+	}
+	assert.Equal(t, []string{outbox.TypeUsage, outbox.TypeBilling, outbox.TypeUsage}, types, "free requests aren't billed")
+	assert.Contains(t, entries[1].Values["event"], `"cost":0.01`)
+}
+
+func TestStore_Served(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC))
+	store := setupStore(t, fakeClock)
+	store.SetRequestRetention(time.Hour)
+	ctx := correlation.WithRequestID(context.Background(), "req-1")
+
+	require.NoError(t, store.Record(ctx, "alice", &models.CostMetrics{TotalTokens: 10}, false))
+
+	served, err := store.Served(ctx, "alice", "req-1")
+	require.NoError(t, err)
+	assert.True(t, served)
+	served, err = store.Served(ctx, "bob", "req-1")
+	require.NoError(t, err)
+	assert.False(t, served, "request IDs are only unique per user")
+}
+
+// memoryDatabase is a usage Database in memory
+type memoryDatabase struct {
+	usage map[string]models.UsageSummary // By user and period
+}
+
+func (d *memoryDatabase) AddUsage(ctx context.Context, userID string, periods []string, delta models.UsageSummary) ([]models.UsageSummary, error) {
+	totals := make([]models.UsageSummary, len(periods))
+	for i, period := range periods {
+		total := d.usage[userID+period]
+		total.Period = period
+		addSummary(&total, delta)
+		d.usage[userID+period] = total
+		totals[i] = total
+	}
+	return totals, nil
+}
+
+func (d *memoryDatabase) LoadUsage(ctx context.Context, userID string, periods []string) ([]models.UsageSummary, error) {
+	summaries := make([]models.UsageSummary, len(periods))
+	for i, period := range periods {
+		summaries[i] = d.usage[userID+period]
+		summaries[i].Period = period
+	}
+	return summaries, nil
+}
+
+func TestStore_Database(t *testing.T) {
+	mr := miniredis.RunT(t)
+	store := NewStore(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	store.SetClock(clock.NewFake(time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)))
+	store.SetDatabase(&memoryDatabase{usage: make(map[string]models.UsageSummary)})
+	ctx := context.Background()
+
+	metrics := &models.CostMetrics{TotalTokens: 100, TotalCost: 0.01}
+	require.NoError(t, store.Record(ctx, "alice", metrics, false))
+	require.NoError(t, store.Record(ctx, "alice", metrics, true))
+
+	// Redis loses the counts; they're read from the database
+	mr.FlushAll()
+	today, err := store.Today(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 2, today.Requests)
+	assert.Equal(t, 1, today.CacheHits)
+
+	// The next request restores them in Redis
+	require.NoError(t, store.Record(ctx, "alice", metrics, false))
+	assert.Equal(t, "3", mr.HGet(dayKey("alice", time.Date(2026, 3, 31, 0, 0, 0, 0, time.UTC)), "requests"))
+	month, err := store.ThisMonth(ctx, "alice")
+	require.NoError(t, err)
+	assert.Equal(t, 3, month.Requests)
+	assert.Equal(t, 300, month.TotalTokens)
+	assert.InDelta(t, 0.03, month.Cost, 1e-9)
+}
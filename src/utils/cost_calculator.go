@@ -6,17 +6,18 @@ import (
 	"www.github.com/Wanderer0074348/HybridLM/src/models"
 )
 
-// Pricing per 1M tokens (as of 2025)
+// Built-in pricing per 1M tokens, used for anything the pricing section of
+// the config doesn't price
 const (
-	// OpenAI GPT-3.5-turbo
-	GPT35InputPer1M  = 0.50  // $0.50 per 1M input tokens
-	GPT35OutputPer1M = 1.50  // $1.50 per 1M output tokens
+	// OpenAI GPT-3.5-turbo, also the price of unknown LLM models
+	GPT35InputPer1M  = 0.50 // $0.50 per 1M input tokens
+	GPT35OutputPer1M = 1.50 // $1.50 per 1M output tokens
 
 	// OpenAI GPT-4
 	GPT4InputPer1M  = 30.00 // $30 per 1M input tokens
 	GPT4OutputPer1M = 60.00 // $60 per 1M output tokens
 
-	// Groq (free tier, but for estimation we use costs)
+	// Groq fallback for models not in groqPricing
 	GroqInputPer1M  = 0.10 // $0.10 per 1M tokens (estimate for Llama)
 	GroqOutputPer1M = 0.10 // $0.10 per 1M tokens
 
@@ -24,8 +25,17 @@ const (
 	EmbeddingPer1M = 0.10 // $0.10 per 1M tokens (text-embedding-ada-002)
 )
 
+// Groq on-demand pricing per model (per 1M tokens)
+var groqPricing = map[string]Rate{
+	"llama-3.1-8b-instant":    {InputPer1M: 0.05, OutputPer1M: 0.08},
+	"llama-3.3-70b-versatile": {InputPer1M: 0.59, OutputPer1M: 0.79},
+	"mixtral-8x7b-32768":      {InputPer1M: 0.24, OutputPer1M: 0.24},
+	"gemma2-9b-it":            {InputPer1M: 0.20, OutputPer1M: 0.20},
+}
+
 // EstimateTokenCount estimates token count from text (rough approximation)
-// More accurate: ~1 token per 4 characters for English
+// More accurate: ~1 token per 4 characters for English. CountTokens falls
+// back to it when no encoding is loaded.
 func EstimateTokenCount(text string) int {
 	// Remove extra whitespace
 	text = strings.TrimSpace(text)
@@ -42,37 +52,19 @@ func EstimateTokenCount(text string) int {
 	return tokenCount
 }
 
-// CalculateLLMCost calculates the cost for LLM inference
+// CalculateLLMCost calculates the cost for LLM inference at the model's price
 func CalculateLLMCost(inputTokens, outputTokens int, model string) float64 {
-	var inputCost, outputCost float64
-
-	// Determine pricing based on model
-	switch {
-	case strings.Contains(strings.ToLower(model), "gpt-4"):
-		inputCost = float64(inputTokens) * GPT4InputPer1M / 1000000
-		outputCost = float64(outputTokens) * GPT4OutputPer1M / 1000000
-	case strings.Contains(strings.ToLower(model), "gpt-3.5"):
-		inputCost = float64(inputTokens) * GPT35InputPer1M / 1000000
-		outputCost = float64(outputTokens) * GPT35OutputPer1M / 1000000
-	default:
-		// Default to GPT-3.5 pricing
-		inputCost = float64(inputTokens) * GPT35InputPer1M / 1000000
-		outputCost = float64(outputTokens) * GPT35OutputPer1M / 1000000
-	}
-
-	return inputCost + outputCost
+	return Pricing().LLMRate(model).Cost(inputTokens, outputTokens)
 }
 
-// CalculateSLMCost calculates the cost for SLM inference (Groq models)
-func CalculateSLMCost(inputTokens, outputTokens int) float64 {
-	inputCost := float64(inputTokens) * GroqInputPer1M / 1000000
-	outputCost := float64(outputTokens) * GroqOutputPer1M / 1000000
-	return inputCost + outputCost
+// CalculateSLMCost calculates the cost for SLM inference at the model's price
+func CalculateSLMCost(inputTokens, outputTokens int, model string) float64 {
+	return Pricing().SLMRate(model).Cost(inputTokens, outputTokens)
 }
 
 // CalculateEmbeddingCost calculates the cost for generating embeddings
 func CalculateEmbeddingCost(tokens int) float64 {
-	return float64(tokens) * EmbeddingPer1M / 1000000
+	return float64(tokens) * Pricing().embedding / 1000000
 }
 
 // CalculateCostMetrics calculates comprehensive cost metrics for an inference
@@ -84,8 +76,8 @@ func CalculateCostMetrics(
 	cacheHit bool,
 	semanticCacheEnabled bool,
 ) *models.CostMetrics {
-	inputTokens := EstimateTokenCount(query)
-	outputTokens := EstimateTokenCount(response)
+	inputTokens := CountTokens(query, specificModel)
+	outputTokens := CountTokens(response, specificModel)
 	totalTokens := inputTokens + outputTokens
 
 	metrics := &models.CostMetrics{
@@ -112,7 +104,7 @@ func CalculateCostMetrics(
 		if modelUsed == "cloud-llm" {
 			metrics.EstimatedSavings = CalculateLLMCost(inputTokens, outputTokens, specificModel)
 		} else {
-			metrics.EstimatedSavings = CalculateSLMCost(inputTokens, outputTokens)
+			metrics.EstimatedSavings = CalculateSLMCost(inputTokens, outputTokens, specificModel)
 		}
 
 		return metrics
@@ -125,7 +117,7 @@ func CalculateCostMetrics(
 		metrics.EstimatedSavings = 0
 	} else {
 		// SLM used
-		metrics.Cost = CalculateSLMCost(inputTokens, outputTokens)
+		metrics.Cost = CalculateSLMCost(inputTokens, outputTokens, specificModel)
 		// Calculate savings compared to if we had used LLM
 		llmCost := CalculateLLMCost(inputTokens, outputTokens, "gpt-3.5-turbo")
 		metrics.EstimatedSavings = llmCost - metrics.Cost
@@ -140,3 +132,60 @@ func CalculateCostMetrics(
 
 	return metrics
 }
+
+// ApplyReportedUsage replaces the estimated token counts of a generated
+// answer with the ones the provider billed, repricing the inference
+func ApplyReportedUsage(metrics *models.CostMetrics, modelUsed string, inputTokens, outputTokens int) {
+	if metrics == nil || inputTokens+outputTokens == 0 {
+		return
+	}
+
+	metrics.InputTokens = inputTokens
+	metrics.OutputTokens = outputTokens
+	metrics.TotalTokens = inputTokens + outputTokens
+	metrics.UsageReported = true
+	if modelUsed == "cloud-llm" {
+		metrics.Cost = CalculateLLMCost(inputTokens, outputTokens, metrics.Model)
+	} else {
+		metrics.Cost = CalculateSLMCost(inputTokens, outputTokens, metrics.Model)
+		metrics.EstimatedSavings = CalculateLLMCost(inputTokens, outputTokens, "gpt-3.5-turbo") - metrics.Cost
+	}
+	metrics.TotalCost = metrics.Cost + metrics.CacheCost
+}
+
+// ApplyEnsembleBreakdown replaces single-model SLM costs with the sum of every
+// model call made by an ensemble strategy, keeping the per-model breakdown
+func ApplyEnsembleBreakdown(metrics *models.CostMetrics, usage []models.ModelUsage) {
+	if metrics == nil || len(usage) == 0 {
+		return
+	}
+
+	breakdown := make([]models.ModelUsage, len(usage))
+	ensembleModels := make([]string, len(usage))
+	var totalCost float64
+	var inputTokens, outputTokens int
+	reported := true
+
+	for i, u := range usage {
+		u.Cost = CalculateSLMCost(u.InputTokens, u.OutputTokens, u.Model)
+		breakdown[i] = u
+		ensembleModels[i] = u.Model
+		totalCost += u.Cost
+		inputTokens += u.InputTokens
+		outputTokens += u.OutputTokens
+		reported = reported && !u.Estimated
+	}
+
+	// Savings compare against one LLM call for the user's query and final answer
+	llmCost := CalculateLLMCost(metrics.InputTokens, metrics.OutputTokens, "gpt-3.5-turbo")
+
+	metrics.ModelBreakdown = breakdown
+	metrics.EnsembleModels = ensembleModels
+	metrics.InputTokens = inputTokens
+	metrics.OutputTokens = outputTokens
+	metrics.TotalTokens = inputTokens + outputTokens
+	metrics.Cost = totalCost
+	metrics.UsageReported = reported
+	metrics.EstimatedSavings = llmCost - totalCost
+	metrics.TotalCost = metrics.Cost + metrics.CacheCost
+}
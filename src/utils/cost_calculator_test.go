@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+)
+
+func TestCalculateSLMCost_PerModelRates(t *testing.T) {
+	small := CalculateSLMCost(1000000, 1000000, "llama-3.1-8b-instant")
+	large := CalculateSLMCost(1000000, 1000000, "llama-3.3-70b-versatile")
+	unknown := CalculateSLMCost(1000000, 1000000, "some-new-model")
+
+	assert.InDelta(t, 0.13, small, 1e-9)
+	assert.InDelta(t, 1.38, large, 1e-9)
+	assert.InDelta(t, GroqInputPer1M+GroqOutputPer1M, unknown, 1e-9)
+}
+
+func TestApplyEnsembleBreakdown(t *testing.T) {
+	metrics := CalculateCostMetrics("query", "answer", "edge-slm", "llama-3.1-8b-instant", false, false)
+
+	usage := []models.ModelUsage{
+		{Model: "llama-3.1-8b-instant", Calls: 1, InputTokens: 100, OutputTokens: 200},
+		{Model: "llama-3.3-70b-versatile", Calls: 1, InputTokens: 400, OutputTokens: 300},
+	}
+	ApplyEnsembleBreakdown(metrics, usage)
+
+	assert.Len(t, metrics.ModelBreakdown, 2)
+	assert.Equal(t, []string{"llama-3.1-8b-instant", "llama-3.3-70b-versatile"}, metrics.EnsembleModels)
+	assert.Equal(t, 500, metrics.InputTokens)
+	assert.Equal(t, 500, metrics.OutputTokens)
+	assert.InDelta(t, metrics.ModelBreakdown[0].Cost+metrics.ModelBreakdown[1].Cost, metrics.Cost, 1e-12)
+	assert.Equal(t, metrics.Cost, metrics.TotalCost)
+	assert.True(t, metrics.UsageReported)
+}
+
+func TestApplyReportedUsage(t *testing.T) {
+	metrics := CalculateCostMetrics("query", "answer", "cloud-llm", "gpt-4o", false, true)
+	assert.False(t, metrics.UsageReported)
+	cacheCost := metrics.CacheCost
+
+	ApplyReportedUsage(metrics, "cloud-llm", 1200, 300)
+	assert.True(t, metrics.UsageReported)
+	assert.Equal(t, 1500, metrics.TotalTokens)
+	assert.InDelta(t, CalculateLLMCost(1200, 300, "gpt-4o"), metrics.Cost, 1e-12)
+	assert.InDelta(t, metrics.Cost+cacheCost, metrics.TotalCost, 1e-12)
+
+	// Providers that report nothing leave the estimate
+	estimate := CalculateCostMetrics("query", "answer", "edge-slm", "llama-3.1-8b-instant", false, false)
+	ApplyReportedUsage(estimate, "edge-slm", 0, 0)
+	assert.False(t, estimate.UsageReported)
+}
+
+func TestPricingTable_ConfiguredPrices(t *testing.T) {
+	embedding := 0.02
+	table, err := NewPricingTable(config.PricingConfig{
+		Models: []config.ModelPriceConfig{
+			{Model: "gpt-4o*", PriceConfig: config.PriceConfig{InputPer1M: 2.50, OutputPer1M: 10}},
+			{Model: "GPT-4o-mini", PriceConfig: config.PriceConfig{InputPer1M: 0.15, OutputPer1M: 0.60}},
+		},
+		SLMDefault:     &config.PriceConfig{InputPer1M: 0.30, OutputPer1M: 0.30},
+		EmbeddingPer1M: &embedding,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, Rate{InputPer1M: 0.15, OutputPer1M: 0.60}, table.LLMRate("gpt-4o-mini"))
+	assert.Equal(t, Rate{InputPer1M: 2.50, OutputPer1M: 10}, table.LLMRate("gpt-4o-2024-08-06"))
+	// The longest prefix wins over the built-in gpt-4 price
+	assert.Equal(t, Rate{InputPer1M: GPT4InputPer1M, OutputPer1M: GPT4OutputPer1M}, table.LLMRate("gpt-4-turbo"))
+	assert.Equal(t, Rate{InputPer1M: GPT35InputPer1M, OutputPer1M: GPT35OutputPer1M}, table.LLMRate("unknown"))
+	assert.Equal(t, Rate{InputPer1M: 0.05, OutputPer1M: 0.08}, table.SLMRate("llama-3.1-8b-instant"))
+	assert.Equal(t, Rate{InputPer1M: 0.30, OutputPer1M: 0.30}, table.SLMRate("some-new-model"))
+
+	previous := Pricing()
+	SetPricing(table)
+	t.Cleanup(func() { SetPricing(previous) })
+	assert.InDelta(t, 12.50, CalculateLLMCost(1000000, 1000000, "gpt-4o"), 1e-9)
+	assert.InDelta(t, 0.02, CalculateEmbeddingCost(1000000), 1e-9)
+
+	_, err = NewPricingTable(config.PricingConfig{Models: []config.ModelPriceConfig{{Model: "gpt-4o", PriceConfig: config.PriceConfig{InputPer1M: -1}}}})
+	assert.Error(t, err)
+}
+
+func TestReloadPricing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("pricing:\n  models:\n    - model: llama-3.1-8b-instant\n      input_per_1m: 1\n      output_per_1m: 2\n"), 0o644))
+
+	previous := Pricing()
+	t.Cleanup(func() { SetPricing(previous) })
+	require.NoError(t, ReloadPricing(path))
+	assert.InDelta(t, 3, CalculateSLMCost(1000000, 1000000, "llama-3.1-8b-instant"), 1e-9)
+
+	// Invalid prices leave the previous table in place
+	require.NoError(t, os.WriteFile(path, []byte("pricing:\n  slm_default:\n    input_per_1m: -1\n"), 0o644))
+	assert.Error(t, ReloadPricing(path))
+	assert.InDelta(t, 3, CalculateSLMCost(1000000, 1000000, "llama-3.1-8b-instant"), 1e-9)
+}
@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const defaultPricingReloadInterval = 30 * time.Second
+
+// Rate is a model's price per 1M tokens
+type Rate struct {
+	InputPer1M  float64
+	OutputPer1M float64
+}
+
+// Cost prices a call's tokens
+func (r Rate) Cost(inputTokens, outputTokens int) float64 {
+	return float64(inputTokens)*r.InputPer1M/1000000 + float64(outputTokens)*r.OutputPer1M/1000000
+}
+
+// PricingTable holds the prices costs are calculated with
+type PricingTable struct {
+	models     map[string]Rate // Rates by lowercased model name
+	prefixes   map[string]Rate // Rates by lowercased model name prefix
+	llmDefault Rate
+	slmDefault Rate
+	embedding  float64 // $ per 1M embedding tokens
+}
+
+var pricing atomic.Pointer[PricingTable]
+
+func init() {
+	pricing.Store(DefaultPricing())
+}
+
+// DefaultPricing returns the built-in prices
+func DefaultPricing() *PricingTable {
+	table := &PricingTable{
+		models:     make(map[string]Rate, len(groqPricing)),
+		prefixes:   make(map[string]Rate),
+		llmDefault: Rate{InputPer1M: GPT35InputPer1M, OutputPer1M: GPT35OutputPer1M},
+		slmDefault: Rate{InputPer1M: GroqInputPer1M, OutputPer1M: GroqOutputPer1M},
+		embedding:  EmbeddingPer1M,
+	}
+	for model, rate := range groqPricing {
+		table.models[model] = rate
+	}
+	table.prefixes["gpt-4"] = Rate{InputPer1M: GPT4InputPer1M, OutputPer1M: GPT4OutputPer1M}
+	table.prefixes["gpt-3.5"] = Rate{InputPer1M: GPT35InputPer1M, OutputPer1M: GPT35OutputPer1M}
+	return table
+}
+
+// NewPricingTable overlays the configured prices on the built-in ones
+func NewPricingTable(cfg config.PricingConfig) (*PricingTable, error) {
+	table := DefaultPricing()
+
+	for _, entry := range cfg.Models {
+		rate, err := rateFrom(entry.Model, entry.PriceConfig)
+		if err != nil {
+			return nil, err
+		}
+		model := strings.ToLower(strings.TrimSpace(entry.Model))
+		if prefix, ok := strings.CutSuffix(model, "*"); ok {
+			table.prefixes[prefix] = rate
+		} else if model != "" {
+			table.models[model] = rate
+		} else {
+			return nil, fmt.Errorf("pricing entry without a model")
+		}
+	}
+	if cfg.LLMDefault != nil {
+		rate, err := rateFrom("llm_default", *cfg.LLMDefault)
+		if err != nil {
+			return nil, err
+		}
+		table.llmDefault = rate
+	}
+	if cfg.SLMDefault != nil {
+		rate, err := rateFrom("slm_default", *cfg.SLMDefault)
+		if err != nil {
+			return nil, err
+		}
+		table.slmDefault = rate
+	}
+	if cfg.EmbeddingPer1M != nil {
+		if *cfg.EmbeddingPer1M < 0 {
+			return nil, fmt.Errorf("pricing embedding_per_1m can't be negative")
+		}
+		table.embedding = *cfg.EmbeddingPer1M
+	}
+	return table, nil
+}
+
+func rateFrom(name string, price config.PriceConfig) (Rate, error) {
+	if price.InputPer1M < 0 || price.OutputPer1M < 0 {
+		return Rate{}, fmt.Errorf("pricing for %q can't be negative", name)
+	}
+	return Rate{InputPer1M: price.InputPer1M, OutputPer1M: price.OutputPer1M}, nil
+}
+
+// LLMRate returns the price of an LLM model
+func (t *PricingTable) LLMRate(model string) Rate {
+	if rate, ok := t.lookup(model); ok {
+		return rate
+	}
+	return t.llmDefault
+}
+
+// SLMRate returns the price of an SLM model
+func (t *PricingTable) SLMRate(model string) Rate {
+	if rate, ok := t.lookup(model); ok {
+		return rate
+	}
+	return t.slmDefault
+}
+
+// lookup finds the model's own rate, or that of the longest prefix it has
+func (t *PricingTable) lookup(model string) (Rate, bool) {
+	model = strings.ToLower(model)
+	if rate, ok := t.models[model]; ok {
+		return rate, true
+	}
+
+	var best string
+	var rate Rate
+	found := false
+	for prefix, r := range t.prefixes {
+		if strings.HasPrefix(model, prefix) && (!found || len(prefix) > len(best)) {
+			best, rate, found = prefix, r, true
+		}
+	}
+	return rate, found
+}
+
+// Pricing returns the prices costs are currently calculated with
+func Pricing() *PricingTable {
+	return pricing.Load()
+}
+
+// SetPricing replaces the prices costs are calculated with
+func SetPricing(table *PricingTable) {
+	pricing.Store(table)
+}
+
+// WatchPricing re-reads the pricing section of the config file at path
+// whenever the file changes until ctx is done. A section that fails to load
+// leaves the previous prices in place.
+func WatchPricing(ctx context.Context, path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultPricingReloadInterval
+	}
+
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+
+			if err := ReloadPricing(path); err != nil {
+				log.Printf("⚠️  Keeping previous pricing: %v", err)
+				continue
+			}
+			log.Printf("✓ Reloaded pricing from %s", path)
+		}
+	}
+}
+
+// ReloadPricing re-reads the pricing section of the config file at path
+func ReloadPricing(path string) error {
+	cfg, err := config.ReadPricing(path)
+	if err != nil {
+		return err
+	}
+	table, err := NewPricingTable(cfg)
+	if err != nil {
+		return err
+	}
+	SetPricing(table)
+	return nil
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+)
+
+// defaultEncoding is used for models tiktoken doesn't know. Llama, Mixtral and
+// Gemma use their own tokenizers, which cl100k_base approximates far better
+// than counting characters.
+const defaultEncoding = tiktoken.MODEL_CL100K_BASE
+
+// Failed loads are retried after loadRetryDelay, doubling up to loadRetryMaxDelay
+const (
+	loadRetryDelay    = 5 * time.Second
+	loadRetryMaxDelay = 5 * time.Minute
+)
+
+// tokenizer holds the BPE encodings loaded with LoadEncodings. They are
+// loaded in the background so a slow download of the ranks never holds up
+// startup or a request, and retried with backoff until they load. tiktoken
+// caches downloaded ranks in TIKTOKEN_CACHE_DIR; pre-populate it for hosts
+// without internet access.
+type tokenizer struct {
+	mu          sync.Mutex
+	encodings   map[string]*tiktoken.Tiktoken // Loaded encodings by name
+	loading     map[string]bool               // Encodings being loaded, or loaded
+	failures    map[string]error              // Latest error of encodings being retried
+	overrides   map[string]string             // Encoding names by model, from the model registry
+	listeners   []func(EncodingStatus)
+	getEncoding func(name string) (*tiktoken.Tiktoken, error)
+	retryDelay  time.Duration
+}
+
+var tokens = newTokenizer()
+
+func newTokenizer() *tokenizer {
+	return &tokenizer{
+		encodings:   make(map[string]*tiktoken.Tiktoken),
+		loading:     make(map[string]bool),
+		failures:    make(map[string]error),
+		overrides:   make(map[string]string),
+		getEncoding: tiktoken.GetEncoding,
+		retryDelay:  loadRetryDelay,
+	}
+}
+
+// EncodingStatus is the state of the encodings LoadEncodings loads
+type EncodingStatus struct {
+	Pending []string // Encodings not loaded yet, whose token counts are estimated
+	Err     error    // Latest errors of pending encodings that failed to load, nil if none has
+}
+
+// CountTokens counts the tokens of text in the encoding of model ("" for the
+// default encoding). Until the encoding is loaded, or if it can't be, tokens
+// are estimated at four characters each.
+func CountTokens(text string, model string) int {
+	tokens.mu.Lock()
+	encoding := tokens.encodings[encodingFor(model, tokens.overrides)]
+	tokens.mu.Unlock()
+	if encoding == nil {
+		return (len(strings.TrimSpace(text)) + 3) / 4
+	}
+	return len(encoding.EncodeOrdinary(text))
+}
+
+// EncodingFor returns the name of the encoding used to count model's tokens
+func EncodingFor(model string) string {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+	return encodingFor(model, tokens.overrides)
+}
+
+func encodingFor(model string, overrides map[string]string) string {
+	model = strings.ToLower(model)
+	if name, ok := overrides[model]; ok {
+		return name
+	}
+
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name
+	}
+	for prefix, name := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) {
+			return name
+		}
+	}
+	return defaultEncoding
+}
+
+// SetModelEncoding counts model's tokens with the named tiktoken encoding
+func SetModelEncoding(model string, encoding string) {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+	tokens.overrides[strings.ToLower(model)] = encoding
+}
+
+// LoadEncodings starts loading the encodings of the given models and the
+// default encoding. Failed encodings are retried with backoff until they load.
+func LoadEncodings(models ...string) {
+	tokens.loadEncodings(models...)
+}
+
+// EncodingsStatus returns which encodings are still loading, and why
+func EncodingsStatus() EncodingStatus {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+	return tokens.status()
+}
+
+// OnEncodingsChange registers a handler, called with the new status when
+// encodings start loading, fail to load, or load
+func OnEncodingsChange(fn func(EncodingStatus)) {
+	tokens.mu.Lock()
+	defer tokens.mu.Unlock()
+	tokens.listeners = append(tokens.listeners, fn)
+}
+
+func (t *tokenizer) loadEncodings(models ...string) {
+	t.mu.Lock()
+	var started []string
+	for _, model := range append(models, "") {
+		name := encodingFor(model, t.overrides)
+		if !t.loading[name] {
+			t.loading[name] = true
+			started = append(started, name)
+		}
+	}
+	t.mu.Unlock()
+
+	if len(started) == 0 {
+		return
+	}
+	// Reported loading before any load can report failing
+	t.changed()
+	for _, name := range started {
+		go t.load(name)
+	}
+}
+
+// load loads the named encoding, retrying with backoff until it loads
+func (t *tokenizer) load(name string) {
+	delay := t.retryDelay
+	for {
+		encoding, err := t.getEncoding(name)
+
+		t.mu.Lock()
+		if err == nil {
+			t.encodings[name] = encoding
+			delete(t.failures, name)
+		} else {
+			t.failures[name] = err
+		}
+		t.mu.Unlock()
+		t.changed()
+
+		if err == nil {
+			return
+		}
+		log.Printf("⚠️  Failed to load %s token encoding, estimating token counts and retrying in %s: %v", name, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, loadRetryMaxDelay)
+	}
+}
+
+// changed calls the listeners with the current status
+func (t *tokenizer) changed() {
+	t.mu.Lock()
+	status := t.status()
+	listeners := t.listeners
+	t.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(status)
+	}
+}
+
+func (t *tokenizer) status() EncodingStatus {
+	var status EncodingStatus
+	var errs []error
+	for name := range t.loading {
+		if t.encodings[name] != nil {
+			continue
+		}
+		status.Pending = append(status.Pending, name)
+	}
+	slices.Sort(status.Pending)
+	for _, name := range status.Pending {
+		if err := t.failures[name]; err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	status.Err = errors.Join(errs...)
+	return status
+}
@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkoukk/tiktoken-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodingFor(t *testing.T) {
+	assert.Equal(t, "o200k_base", EncodingFor("gpt-4o"))
+	assert.Equal(t, "o200k_base", EncodingFor("gpt-4o-mini-2024-07-18"))
+	assert.Equal(t, "cl100k_base", EncodingFor("gpt-4"))
+	assert.Equal(t, "cl100k_base", EncodingFor("llama-3.1-8b-instant"))
+	assert.Equal(t, "cl100k_base", EncodingFor(""))
+
+	SetModelEncoding("Custom-Model", "o200k_base")
+	assert.Equal(t, "o200k_base", EncodingFor("custom-model"))
+}
+
+func TestCountTokens_EstimatesUntilLoaded(t *testing.T) {
+	text := "How do I reverse a linked list in place?"
+	assert.Equal(t, 10, CountTokens(text, "model-without-encoding"))
+	assert.Equal(t, 1, CountTokens(" hi ", ""))
+	assert.Equal(t, 0, CountTokens("", ""))
+}
+
+func TestLoadEncodings_RetriesFailedLoads(t *testing.T) {
+	var attempts atomic.Int32
+	tok := newTokenizer()
+	tok.retryDelay = time.Millisecond
+	tok.getEncoding = func(name string) (*tiktoken.Tiktoken, error) {
+		if attempts.Add(1) < 3 {
+			return nil, errors.New("ranks unreachable")
+		}
+		return &tiktoken.Tiktoken{}, nil
+	}
+
+	var mu sync.Mutex
+	var statuses []EncodingStatus
+	tok.listeners = append(tok.listeners, func(status EncodingStatus) {
+		mu.Lock()
+		defer mu.Unlock()
+		statuses = append(statuses, status)
+	})
+
+	tok.loadEncodings()
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(statuses) == 4
+	}, time.Second, time.Millisecond)
+
+	// Loading, failed twice, then loaded
+	assert.Equal(t, []string{"cl100k_base"}, statuses[0].Pending)
+	assert.NoError(t, statuses[0].Err)
+	assert.ErrorContains(t, statuses[1].Err, "cl100k_base: ranks unreachable")
+	assert.ErrorContains(t, statuses[2].Err, "ranks unreachable")
+	assert.Empty(t, statuses[3].Pending)
+	assert.NoError(t, statuses[3].Err)
+	assert.Equal(t, int32(3), attempts.Load())
+}
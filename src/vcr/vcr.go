@@ -0,0 +1,288 @@
+// Package vcr records provider HTTP interactions to disk and replays them,
+// so expensive model calls can be reproduced offline and in tests for free.
+// Streamed responses keep their chunking and the delay between chunks.
+package vcr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Modes
+const (
+	ModeRecord = "record" // Call the provider and save every interaction
+	ModeReplay = "replay" // Serve saved interactions; unknown requests fail
+)
+
+// ErrNoInteraction is returned in replay mode for a request that was never recorded
+var ErrNoInteraction = errors.New("no recorded interaction")
+
+// Query parameters that carry credentials and are left out of cassettes
+var secretParams = []string{"key", "api_key", "api-key"}
+
+// Interaction is one recorded request and its response
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body"`
+}
+
+type RecordedResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	Chunks  []Chunk     `json:"chunks"`
+}
+
+// Chunk is a piece of the response body as it arrived, after Delay since the
+// previous one (or since the request was sent)
+type Chunk struct {
+	Data  string        `json:"data"`
+	Delay time.Duration `json:"delay"`
+}
+
+// Recorder is an http.RoundTripper that records or replays interactions. Each
+// interaction is stored as its own JSON file in dir, named after a hash of
+// the method, URL and body. Request headers, and with them API keys, are
+// never stored.
+type Recorder struct {
+	mode      string
+	dir       string
+	transport http.RoundTripper
+	realtime  bool
+	mu        sync.Mutex
+}
+
+// New returns a recorder for mode, storing cassettes in dir. In record mode
+// requests go through http.DefaultTransport.
+func New(mode string, dir string) (*Recorder, error) {
+	if mode != ModeRecord && mode != ModeReplay {
+		return nil, fmt.Errorf("unknown vcr mode %q (supported: %s, %s)", mode, ModeRecord, ModeReplay)
+	}
+	if mode == ModeRecord {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create cassette directory: %w", err)
+		}
+	}
+
+	return &Recorder{
+		mode:      mode,
+		dir:       dir,
+		transport: http.DefaultTransport,
+		realtime:  true,
+	}, nil
+}
+
+// SetTransport replaces the transport used to reach providers when recording
+func (r *Recorder) SetTransport(transport http.RoundTripper) {
+	r.transport = transport
+}
+
+// SetRealtime controls whether replays wait out the recorded delays between
+// chunks (the default) or return the body at once
+func (r *Recorder) SetRealtime(realtime bool) {
+	r.realtime = realtime
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	recorded, err := recordRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(r.dir, interactionName(recorded)+".json")
+
+	if r.mode == ModeReplay {
+		return r.replay(req, recorded, path)
+	}
+	return r.record(req, recorded, path)
+}
+
+func (r *Recorder) record(req *http.Request, recorded RecordedRequest, path string) (*http.Response, error) {
+	start := time.Now()
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Body = &recordingBody{
+		body: resp.Body,
+		last: start,
+		save: func(chunks []Chunk) {
+			r.save(path, &Interaction{
+				Request: recorded,
+				Response: RecordedResponse{
+					Status:  resp.StatusCode,
+					Headers: resp.Header.Clone(),
+					Chunks:  chunks,
+				},
+			})
+		},
+	}
+	return resp, nil
+}
+
+func (r *Recorder) save(path string, interaction *Interaction) {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Best effort: a cassette that can't be written only means the next replay misses
+	_ = os.WriteFile(path, data, 0o644)
+}
+
+func (r *Recorder) replay(req *http.Request, recorded RecordedRequest, path string) (*http.Response, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoInteraction, recorded.Method, recorded.URL)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+
+	var interaction Interaction
+	if err := json.Unmarshal(data, &interaction); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode: interaction.Response.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     interaction.Response.Headers,
+		Body: &replayBody{
+			ctx:      req.Context(),
+			chunks:   interaction.Response.Chunks,
+			realtime: r.realtime,
+		},
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// recordRequest captures the parts of a request that identify it, restoring
+// the body for the real call
+func recordRequest(req *http.Request) (RecordedRequest, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return RecordedRequest{}, fmt.Errorf("failed to read request body: %w", err)
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	u := *req.URL
+	query := u.Query()
+	for _, param := range secretParams {
+		query.Del(param)
+	}
+	u.RawQuery = query.Encode()
+
+	return RecordedRequest{
+		Method: req.Method,
+		URL:    u.String(),
+		Body:   string(body),
+	}, nil
+}
+
+func interactionName(req RecordedRequest) string {
+	h := sha256.New()
+	for _, part := range []string{req.Method, req.URL, req.Body} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	u, _ := url.Parse(req.URL)
+	prefix := "interaction"
+	if u != nil && u.Host != "" {
+		prefix = u.Host
+	}
+	return prefix + "-" + hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// recordingBody passes the response body through, noting each chunk and its
+// timing, and saves the interaction once the body has been read to the end
+type recordingBody struct {
+	body   io.ReadCloser
+	chunks []Chunk
+	last   time.Time
+	save   func(chunks []Chunk)
+	saved  bool
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.body.Read(p)
+	if n > 0 {
+		now := time.Now()
+		b.chunks = append(b.chunks, Chunk{Data: string(p[:n]), Delay: now.Sub(b.last)})
+		b.last = now
+	}
+	if err == io.EOF && !b.saved {
+		b.saved = true
+		b.save(b.chunks)
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	return b.body.Close()
+}
+
+// replayBody returns recorded chunks one Read at a time, waiting out their delays
+type replayBody struct {
+	ctx      context.Context
+	chunks   []Chunk
+	pending  string
+	realtime bool
+}
+
+func (b *replayBody) Read(p []byte) (int, error) {
+	if b.pending == "" {
+		if len(b.chunks) == 0 {
+			return 0, io.EOF
+		}
+		chunk := b.chunks[0]
+		b.chunks = b.chunks[1:]
+		if b.realtime && chunk.Delay > 0 {
+			timer := time.NewTimer(chunk.Delay)
+			select {
+			case <-b.ctx.Done():
+				timer.Stop()
+				return 0, b.ctx.Err()
+			case <-timer.C:
+			}
+		}
+		b.pending = chunk.Data
+	}
+
+	n := copy(p, b.pending)
+	b.pending = b.pending[n:]
+	return n, nil
+}
+
+func (b *replayBody) Close() error {
+	return nil
+}
@@ -0,0 +1,115 @@
+package vcr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/inference"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/providertest"
+)
+
+const chunkDelay = 30 * time.Millisecond
+
+// newStreamingServer sends three SSE chunks, chunkDelay apart
+func newStreamingServer(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, word := range []string{"one", "two", "three"} {
+			time.Sleep(chunkDelay)
+			io.WriteString(w, "data: "+word+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, client *http.Client, url string) (string, time.Duration, error) {
+	start := time.Now()
+	req, _ := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"stream":true}`))
+	req.Header.Set("Authorization", "Bearer sk-secret")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	return string(body), time.Since(start), err
+}
+
+func TestRecorder_RecordsAndReplaysStreams(t *testing.T) {
+	dir := t.TempDir()
+	server := newStreamingServer(t)
+	url := server.URL + "/v1/chat/completions?key=secret"
+
+	recorder, err := New(ModeRecord, dir)
+	require.NoError(t, err)
+	recorded, _, err := get(t, &http.Client{Transport: recorder}, url)
+	require.NoError(t, err)
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	require.Len(t, files, 1)
+	cassette, _ := os.ReadFile(files[0])
+	assert.NotContains(t, string(cassette), "secret", "credentials are never stored")
+
+	replayer, err := New(ModeReplay, dir)
+	require.NoError(t, err)
+	replayed, elapsed, err := get(t, &http.Client{Transport: replayer}, url)
+	require.NoError(t, err)
+	assert.Equal(t, recorded, replayed)
+	assert.GreaterOrEqual(t, elapsed, 3*chunkDelay, "chunk timing is kept")
+
+	replayer.SetRealtime(false)
+	_, elapsed, err = get(t, &http.Client{Transport: replayer}, url)
+	require.NoError(t, err)
+	assert.Less(t, elapsed, chunkDelay)
+}
+
+func TestRecorder_ReplayFailsForUnknownRequests(t *testing.T) {
+	replayer, err := New(ModeReplay, t.TempDir())
+	require.NoError(t, err)
+
+	_, _, err = get(t, &http.Client{Transport: replayer}, "http://example.invalid/v1/chat/completions")
+	assert.True(t, errors.Is(err, ErrNoInteraction))
+}
+
+func TestRecorder_ReplaysProviderCalls(t *testing.T) {
+	dir := t.TempDir()
+	server := providertest.NewOpenAIServer(t, providertest.Scenario{Answer: "Paris is the capital"})
+	cfg := &config.LLMConfig{Provider: "openai-compatible", Endpoint: server.URL, APIKey: "sk-test", Model: "gpt-4o-mini"}
+	req := &models.InferenceRequest{Query: "What is the capital of France?"}
+	t.Cleanup(func() { inference.SetHTTPTransport(nil) })
+
+	recorder, err := New(ModeRecord, dir)
+	require.NoError(t, err)
+	inference.SetHTTPTransport(recorder)
+	llm, err := inference.NewLLMClient(cfg)
+	require.NoError(t, err)
+	answer, err := llm.Infer(context.Background(), req)
+	require.NoError(t, err)
+	server.Close()
+
+	replayer, err := New(ModeReplay, dir)
+	require.NoError(t, err)
+	inference.SetHTTPTransport(replayer)
+	llm, err = inference.NewLLMClient(cfg)
+	require.NoError(t, err)
+	replayed, err := llm.Infer(context.Background(), req)
+	require.NoError(t, err)
+	assert.Equal(t, answer, replayed)
+}
@@ -0,0 +1,232 @@
+// Package warehouse exports anonymized request records to object storage as
+// CSV files partitioned by date, for training routing models offline. Records
+// come from the request events in the event outbox, so the export needs the
+// outbox and its events middleware enabled.
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+const (
+	defaultInterval  = time.Hour
+	defaultBatchSize = 10000
+
+	checkpointKey = "warehouse:checkpoint" // ID of the last outbox event exported
+	lockKey       = "warehouse:lock"       // Held by the instance running an export
+	lockTTL       = 10 * time.Minute
+	dateLayout    = "2006-01-02"
+)
+
+// columns are the CSV header. Users are only identified by a salted hash and
+// no query or answer text is exported.
+var columns = []string{
+	"event_id", "timestamp", "user_hash", "endpoint", "status", "latency_ms",
+	"tier", "model", "routing_reason", "cache_hit", "fallback",
+	"input_tokens", "output_tokens", "total_tokens", "cost",
+	"routed", "use_llm", "complexity_score", "confidence", "forced", "estimated_cost_usd",
+}
+
+// Exporter periodically writes the requests completed since its last run.
+// One instance exports at a time; the checkpoint only advances once every
+// file of a batch has been written, and files are named after the batch's
+// first event, so an export interrupted halfway is repeated, not duplicated.
+type Exporter struct {
+	client    *redis.Client
+	events    *outbox.Outbox
+	store     ObjectStore
+	salt      []byte
+	interval  time.Duration
+	batchSize int64
+	consent   func(ctx context.Context, userID string) bool // Optional, see SetConsent
+}
+
+func NewExporter(client *redis.Client, events *outbox.Outbox, store ObjectStore, cfg config.WarehouseConfig) *Exporter {
+	e := &Exporter{
+		client:    client,
+		events:    events,
+		store:     store,
+		salt:      []byte(cfg.Salt),
+		interval:  cfg.Interval,
+		batchSize: int64(cfg.BatchSize),
+	}
+	if e.interval <= 0 {
+		e.interval = defaultInterval
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = defaultBatchSize
+	}
+	return e
+}
+
+// SetConsent leaves the requests of users for whom allowed returns false out
+// of the export
+func (e *Exporter) SetConsent(allowed func(ctx context.Context, userID string) bool) {
+	e.consent = allowed
+}
+
+// Run exports every interval until ctx is done
+func (e *Exporter) Run(ctx context.Context) {
+	for {
+		if exported, err := e.Export(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Warehouse export failed after %d records: %v", exported, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(e.interval):
+		}
+	}
+}
+
+// Export writes the requests completed since the last export and returns how
+// many records were written. It does nothing while another instance exports.
+func (e *Exporter) Export(ctx context.Context) (int, error) {
+	locked, err := e.client.SetNX(ctx, lockKey, "1", lockTTL).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock export: %w", err)
+	}
+	if !locked {
+		return 0, nil
+	}
+	defer e.client.Del(context.WithoutCancel(ctx), lockKey)
+
+	checkpoint, err := e.client.Get(ctx, checkpointKey).Result()
+	if err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("failed to read export checkpoint: %w", err)
+	}
+
+	exported := 0
+	for {
+		events, err := e.events.Read(ctx, checkpoint, e.batchSize)
+		if err != nil {
+			return exported, err
+		}
+		if len(events) == 0 {
+			return exported, nil
+		}
+
+		n, err := e.write(ctx, events)
+		if err != nil {
+			return exported, err
+		}
+		exported += n
+
+		checkpoint = events[len(events)-1].ID
+		if err := e.client.Set(ctx, checkpointKey, checkpoint, 0).Err(); err != nil {
+			return exported, fmt.Errorf("failed to save export checkpoint: %w", err)
+		}
+		if int64(len(events)) < e.batchSize {
+			return exported, nil
+		}
+	}
+}
+
+// write exports a batch's completed requests, one file per date
+func (e *Exporter) write(ctx context.Context, events []outbox.Event) (int, error) {
+	partitions := make(map[string][][]string)
+	var dates []string
+	for _, event := range events {
+		if event.Type != outbox.TypeRequest || event.Action != "completed" {
+			continue
+		}
+		if e.consent != nil && !e.consent(ctx, event.UserID) {
+			continue
+		}
+		var request middleware.RequestEvent
+		if err := json.Unmarshal(event.Data, &request); err != nil {
+			log.Printf("⚠️  Warehouse export skipped event %s: %v", event.ID, err)
+			continue
+		}
+
+		date := event.Timestamp.UTC().Format(dateLayout)
+		if _, ok := partitions[date]; !ok {
+			dates = append(dates, date)
+		}
+		partitions[date] = append(partitions[date], e.record(event, &request))
+	}
+
+	written := 0
+	for _, date := range dates {
+		var buf bytes.Buffer
+		writer := csv.NewWriter(&buf)
+		writer.Write(columns)
+		writer.WriteAll(partitions[date])
+		if err := writer.Error(); err != nil {
+			return written, fmt.Errorf("failed to encode records: %w", err)
+		}
+
+		key := fmt.Sprintf("requests/dt=%s/part-%s.csv", date, events[0].ID)
+		if err := e.store.Put(ctx, key, buf.Bytes(), "text/csv"); err != nil {
+			return written, err
+		}
+		written += len(partitions[date])
+	}
+	return written, nil
+}
+
+func (e *Exporter) record(event outbox.Event, request *middleware.RequestEvent) []string {
+	record := []string{
+		event.ID,
+		event.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.anonymize(event.UserID),
+		request.Path,
+		strconv.Itoa(request.Status),
+		formatFloat(request.LatencyMs),
+		request.Tier,
+		request.Model,
+		request.RoutingReason,
+		strconv.FormatBool(request.CacheHit),
+		strconv.FormatBool(request.Fallback),
+		strconv.Itoa(request.InputTokens),
+		strconv.Itoa(request.OutputTokens),
+		strconv.Itoa(request.TotalTokens),
+		formatFloat(request.Cost),
+	}
+
+	decision := request.Decision
+	if decision == nil {
+		// Answered before routing, from a cache or a pinned answer
+		return append(record, "false", "", "", "", "", "")
+	}
+	return append(record,
+		"true",
+		strconv.FormatBool(decision.UseLLM),
+		formatFloat(decision.ComplexityScore),
+		formatFloat(decision.Confidence),
+		strconv.FormatBool(decision.Forced),
+		formatFloat(decision.EstimatedCostUSD),
+	)
+}
+
+// anonymize replaces a user ID with a salted hash, stable across exports so
+// one user's requests can still be grouped
+func (e *Exporter) anonymize(userID string) string {
+	if userID == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, e.salt)
+	mac.Write([]byte(userID))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
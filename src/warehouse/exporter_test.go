@@ -0,0 +1,118 @@
+package warehouse
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/clock"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/outbox"
+)
+
+func readCSV(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+	return records
+}
+
+func TestExporter_WritesCompletedRequestsByDate(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	events := outbox.NewOutbox(client, config.OutboxConfig{})
+	fake := clock.NewFake(time.Date(2026, 10, 1, 23, 59, 0, 0, time.UTC))
+	events.SetClock(fake)
+	ctx := context.Background()
+
+	routed := middleware.RequestEvent{
+		Path: "/api/v1/inference", Status: 200, Tier: "llm", Model: "gpt-4o", InputTokens: 12, Cost: 0.002,
+		Decision: &models.RoutingDecision{UseLLM: true, ComplexityScore: 0.8, Confidence: 0.6},
+	}
+	require.NoError(t, events.Publish(ctx, outbox.TypeRequest, "routed", "alice@example.com", routed))
+	require.NoError(t, events.Publish(ctx, outbox.TypeRequest, "completed", "alice@example.com", routed))
+	require.NoError(t, events.Publish(ctx, outbox.TypeUsage, "request", "alice@example.com", nil))
+	fake.Advance(2 * time.Minute)
+	cached := middleware.RequestEvent{Path: "/api/v1/chat", Status: 200, Tier: "cache", CacheHit: true}
+	require.NoError(t, events.Publish(ctx, outbox.TypeRequest, "completed", "bob@example.com", cached))
+
+	dir := t.TempDir()
+	exporter := NewExporter(client, events, &DirStore{dir: dir}, config.WarehouseConfig{Salt: "pepper", BatchSize: 2})
+	exported, err := exporter.Export(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, exported)
+
+	first, err := filepath.Glob(filepath.Join(dir, "requests", "dt=2026-10-01", "*.csv"))
+	require.NoError(t, err)
+	require.Len(t, first, 1)
+	records := readCSV(t, first[0])
+	require.Len(t, records, 2)
+	assert.Equal(t, columns, records[0])
+	row := records[1]
+	assert.Equal(t, "gpt-4o", row[7])
+	assert.Equal(t, "12", row[11])
+	assert.Equal(t, "0.8", row[17])
+	assert.Len(t, row[2], 16)
+	assert.NotContains(t, strings.Join(row, ","), "alice")
+
+	second, err := filepath.Glob(filepath.Join(dir, "requests", "dt=2026-10-02", "*.csv"))
+	require.NoError(t, err)
+	require.Len(t, second, 1)
+	records = readCSV(t, second[0])
+	assert.Equal(t, "true", records[1][9])
+	assert.Equal(t, "false", records[1][15], "cache hits were never routed")
+
+	exported, err = exporter.Export(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, exported, "the checkpoint skips exported events")
+}
+
+func TestExporter_SkipsWhileAnotherInstanceExports(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	events := outbox.NewOutbox(client, config.OutboxConfig{})
+	require.NoError(t, events.Publish(context.Background(), outbox.TypeRequest, "completed", "alice", middleware.RequestEvent{}))
+	require.NoError(t, mr.Set(lockKey, "1"))
+
+	exporter := NewExporter(client, events, &DirStore{dir: t.TempDir()}, config.WarehouseConfig{Salt: "pepper"})
+	exported, err := exporter.Export(context.Background())
+	require.NoError(t, err)
+	assert.Zero(t, exported)
+}
+
+func TestExporter_LeavesOutUsersWithoutConsent(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	events := outbox.NewOutbox(client, config.OutboxConfig{})
+	ctx := context.Background()
+	require.NoError(t, events.Publish(ctx, outbox.TypeRequest, "completed", "alice", middleware.RequestEvent{Model: "gpt-4o"}))
+	require.NoError(t, events.Publish(ctx, outbox.TypeRequest, "completed", "bob", middleware.RequestEvent{Model: "llama"}))
+
+	dir := t.TempDir()
+	exporter := NewExporter(client, events, &DirStore{dir: dir}, config.WarehouseConfig{Salt: "pepper"})
+	exporter.SetConsent(func(ctx context.Context, userID string) bool { return userID != "bob" })
+	exported, err := exporter.Export(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, exported)
+
+	files, err := filepath.Glob(filepath.Join(dir, "requests", "*", "*.csv"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	records := readCSV(t, files[0])
+	require.Len(t, records, 2)
+	assert.Equal(t, "gpt-4o", records[1][7])
+}
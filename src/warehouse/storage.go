@@ -0,0 +1,124 @@
+package warehouse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/awssig"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+const storageTimeout = time.Minute
+
+// ObjectStore is where export files are written. Writing a key again
+// replaces the object, which makes re-running an export safe.
+type ObjectStore interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+}
+
+// NewObjectStore returns the store for cfg.Destination: an s3:// URL for S3
+// or an S3-compatible service, otherwise a local directory
+func NewObjectStore(cfg config.WarehouseConfig) (ObjectStore, error) {
+	if !strings.HasPrefix(cfg.Destination, "s3://") {
+		if cfg.Destination == "" {
+			return nil, fmt.Errorf("warehouse export needs a destination")
+		}
+		return &DirStore{dir: cfg.Destination}, nil
+	}
+
+	destination, err := url.Parse(cfg.Destination)
+	if err != nil || destination.Host == "" {
+		return nil, fmt.Errorf("invalid warehouse destination %q, expected s3://bucket/prefix", cfg.Destination)
+	}
+	if cfg.AccessKeyID == "" || cfg.SecretAccessKey == "" {
+		return nil, fmt.Errorf("warehouse export to S3 needs an access key ID and secret access key")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := strings.TrimSuffix(cfg.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+
+	return &S3Store{
+		endpoint: endpoint,
+		bucket:   destination.Host,
+		prefix:   strings.Trim(destination.Path, "/"),
+		signer: awssig.Signer{
+			AccessKey: cfg.AccessKeyID,
+			SecretKey: cfg.SecretAccessKey,
+			Region:    region,
+			Service:   "s3",
+		},
+		client: &http.Client{Timeout: storageTimeout},
+		clock:  time.Now,
+	}, nil
+}
+
+// DirStore writes objects as files under a directory, like a mounted bucket
+type DirStore struct {
+	dir string
+}
+
+func (s *DirStore) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+
+	// Written under a temporary name first so readers never see part of a file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// S3Store uploads objects with path-style PutObject requests signed with AWS
+// Signature Version 4, which S3, GCS (interoperability mode), MinIO and R2
+// all accept
+type S3Store struct {
+	endpoint string
+	bucket   string
+	prefix   string
+	signer   awssig.Signer
+	client   *http.Client
+	clock    func() time.Time
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	path := "/" + awssig.URIEncode(s.bucket, false) + "/" + awssig.URIEncode(key, true)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.endpoint+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", awssig.SHA256Hex(body))
+	s.signer.Sign(req, body, s.clock())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", key, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to upload %s: %s returned %d", key, req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package warehouse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/awssig"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+)
+
+func TestS3Store_SignsPutObject(t *testing.T) {
+	var path, auth, contentHash, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		auth = r.Header.Get("Authorization")
+		contentHash = r.Header.Get("X-Amz-Content-Sha256")
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	store, err := NewObjectStore(config.WarehouseConfig{
+		Destination:     "s3://logs/hybridlm",
+		Endpoint:        server.URL,
+		Region:          "eu-west-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	require.NoError(t, err)
+	require.NoError(t, store.Put(context.Background(), "requests/dt=2026-10-01/part-1-0.csv", []byte("a,b\n"), "text/csv"))
+
+	assert.Equal(t, "/logs/hybridlm/requests/dt%3D2026-10-01/part-1-0.csv", path)
+	assert.Equal(t, "a,b\n", body)
+	assert.Equal(t, awssig.SHA256Hex([]byte("a,b\n")), contentHash)
+	assert.True(t, strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/"))
+	assert.Contains(t, auth, "/eu-west-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature=")
+}
+
+func TestNewObjectStore_Validates(t *testing.T) {
+	_, err := NewObjectStore(config.WarehouseConfig{Destination: "s3://logs"})
+	assert.ErrorContains(t, err, "access key")
+	_, err = NewObjectStore(config.WarehouseConfig{})
+	assert.ErrorContains(t, err, "destination")
+
+	store, err := NewObjectStore(config.WarehouseConfig{Destination: t.TempDir()})
+	require.NoError(t, err)
+	assert.IsType(t, &DirStore{}, store)
+}
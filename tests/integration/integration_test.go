@@ -0,0 +1,417 @@
+//go:build integration
+
+// Package integration runs the real router, handlers, auth and Redis-backed
+// stores end to end against a Redis container, with fake model providers.
+// Run with `make test-integration` (needs Docker).
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/auth"
+	"www.github.com/Wanderer0074348/HybridLM/src/cache"
+	"www.github.com/Wanderer0074348/HybridLM/src/chat"
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/fakes"
+	"www.github.com/Wanderer0074348/HybridLM/src/handlers"
+	"www.github.com/Wanderer0074348/HybridLM/src/jobs"
+	"www.github.com/Wanderer0074348/HybridLM/src/middleware"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/router"
+)
+
+const (
+	llmModel = "gpt-4o"
+	slmModel = "llama-3.1-8b-instant"
+)
+
+// harness is a running server wired like cmd/main, backed by a fresh Redis
+type harness struct {
+	server   *httptest.Server
+	redis    *cache.RedisCache
+	sessions *auth.SessionManager
+	store    *chat.SessionStore
+	llm      *fakes.LLM
+	slm      *fakes.SLM
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := tcredis.Run(ctx, "redis:7-alpine")
+	testcontainers.CleanupContainer(t, container)
+	require.NoError(t, err)
+
+	address, err := container.Endpoint(ctx, "")
+	require.NoError(t, err)
+
+	redisCache, err := cache.NewRedisCache(&config.RedisConfig{Address: address, CacheTTL: time.Hour})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = redisCache.Close() })
+
+	h := &harness{
+		redis:    redisCache,
+		sessions: auth.NewSessionManager(redisCache.GetClient(), time.Hour),
+		store:    chat.NewSessionStore(redisCache.GetClient()),
+		llm:      fakes.NewLLM("An answer from the cloud."),
+		slm:      fakes.NewSLM(slmModel, "An answer from the edge."),
+	}
+
+	queryRouter := router.NewQueryRouter(&config.RouterConfig{ComplexityThreshold: 0.65})
+
+	inferenceHandler := handlers.NewInferenceHandler(queryRouter, h.slm, h.llm, redisCache)
+	inferenceHandler.SetModelNames(llmModel, slmModel)
+	chatHandler := handlers.NewChatHandler(queryRouter, h.slm, h.llm, redisCache, h.store)
+	chatHandler.SetModelNames(llmModel, slmModel)
+	summarizer := chat.NewSummarizer(h.llm)
+	summarizer.SetModel(llmModel)
+	chatHandler.SetSummarizer(summarizer)
+	chatHandler.SetTitler(chat.NewTitler(h.slm))
+
+	jobQueue := jobs.NewQueue(redisCache.GetClient(), config.JobsConfig{})
+	jobsHandler := handlers.NewJobsHandler(jobQueue, inferenceHandler)
+	workerCtx, stopWorker := context.WithCancel(ctx)
+	t.Cleanup(stopWorker)
+	go jobQueue.Work(workerCtx, jobsHandler.Run)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	protected := r.Group("/api/v1", middleware.AuthMiddleware(h.sessions, auth.NewAPIKeyStore(redisCache.GetClient()), nil, nil))
+	protected.POST("/inference", inferenceHandler.HandleInference)
+	protected.POST("/inference/async", jobsHandler.Enqueue)
+	protected.GET("/jobs/:job_id", jobsHandler.GetJob)
+	protected.POST("/chat", chatHandler.HandleChat)
+	protected.GET("/chat/sessions", chatHandler.ListSessions)
+	protected.POST("/chat/sessions", chatHandler.CreateSession)
+	protected.PATCH("/chat/sessions/:session_id", chatHandler.RenameSession)
+	protected.PATCH("/chat/sessions/:session_id/pin", chatHandler.PinSession)
+	protected.POST("/chat/sessions/:session_id/messages/:index/regenerate", chatHandler.RegenerateMessage)
+	protected.PATCH("/chat/sessions/:session_id/messages/:index", chatHandler.EditMessage)
+	protected.GET("/chat/sessions/:session_id", chatHandler.GetSession)
+	protected.GET("/chat/sessions/:session_id/export", chatHandler.ExportSession)
+
+	h.server = httptest.NewServer(r)
+	t.Cleanup(h.server.Close)
+	return h
+}
+
+// login creates a login session for the user and returns its cookie
+func (h *harness) login(t *testing.T, userID string) *http.Cookie {
+	token, err := h.sessions.CreateSession(context.Background(), userID)
+	require.NoError(t, err)
+	return &http.Cookie{Name: middleware.SessionCookieName, Value: token}
+}
+
+func (h *harness) do(t *testing.T, method string, path string, cookie *http.Cookie, body any, out any) int {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		require.NoError(t, err)
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, h.server.URL+path, reader)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+
+	resp, err := h.server.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode < 300 {
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func TestAuth(t *testing.T) {
+	h := newHarness(t)
+	req := models.ChatRequest{Message: "Hello"}
+
+	assert.Equal(t, http.StatusUnauthorized, h.do(t, http.MethodPost, "/api/v1/chat", nil, req, nil))
+
+	expired := &http.Cookie{Name: middleware.SessionCookieName, Value: "not-a-session"}
+	assert.Equal(t, http.StatusUnauthorized, h.do(t, http.MethodPost, "/api/v1/chat", expired, req, nil))
+
+	assert.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", h.login(t, "alice"), req, nil))
+}
+
+func TestChat_SessionsArePersistedAndScoped(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+
+	var first models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice, models.ChatRequest{Message: "Hi there"}, &first))
+	require.NotEmpty(t, first.SessionID)
+	assert.Equal(t, "An answer from the edge.", first.Response)
+
+	var second models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice,
+		models.ChatRequest{SessionID: first.SessionID, Message: "Tell me more", ModelPreference: "llm"}, &second))
+	assert.Equal(t, first.SessionID, second.SessionID)
+	assert.Equal(t, "cloud-llm", second.Tier)
+	assert.Equal(t, 4, second.MessageCount)
+
+	// The second turn saw the first as role-tagged history
+	calls := h.llm.Calls()
+	require.NotEmpty(t, calls)
+	assert.Equal(t, []string{"user", "assistant"}, roles(calls[len(calls)-1].Messages))
+	assert.Equal(t, "Hi there", calls[len(calls)-1].Messages[0].Content)
+
+	var session models.ChatSession
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodGet, "/api/v1/chat/sessions/"+first.SessionID, alice, nil, &session))
+	assert.Equal(t, "alice", session.UserID)
+	assert.Len(t, session.Messages, 4)
+	assert.Equal(t, "llm", session.ModelPreference)
+
+	bob := h.login(t, "bob")
+	assert.Equal(t, http.StatusForbidden, h.do(t, http.MethodGet, "/api/v1/chat/sessions/"+first.SessionID, bob, nil, nil))
+}
+
+func TestChat_SessionSystemPrompt(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+
+	var session models.ChatSession
+	require.Equal(t, http.StatusCreated, h.do(t, http.MethodPost, "/api/v1/chat/sessions", alice,
+		models.CreateSessionRequest{SystemPrompt: "You are a terse pirate."}, &session))
+	assert.Equal(t, "You are a terse pirate.", session.SystemPrompt)
+
+	for _, message := range []string{"Hi there", "Tell me more"} {
+		require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice,
+			models.ChatRequest{SessionID: session.SessionID, Message: message, ModelPreference: "llm"}, nil))
+	}
+
+	// Every turn starts with the system prompt, which isn't stored as history
+	calls := h.llm.Calls()
+	require.Len(t, calls, 2)
+	assert.Equal(t, []string{"system"}, roles(calls[0].Messages))
+	assert.Equal(t, []string{"system", "user", "assistant"}, roles(calls[1].Messages))
+	assert.Equal(t, "You are a terse pirate.", calls[1].Messages[0].Content)
+
+	stored, err := h.store.GetSession(context.Background(), session.SessionID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user", "assistant", "user", "assistant"}, roles(stored.Messages))
+}
+
+func TestChat_SessionTitles(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+
+	var response models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice, models.ChatRequest{Message: "Hi there"}, &response))
+
+	// Titles are generated in the background
+	var list struct {
+		Sessions []models.SessionSummary `json:"sessions"`
+	}
+	require.Eventually(t, func() bool {
+		h.do(t, http.MethodGet, "/api/v1/chat/sessions", alice, nil, &list)
+		return len(list.Sessions) == 1 && list.Sessions[0].Title != ""
+	}, 5*time.Second, 50*time.Millisecond)
+	assert.Equal(t, "An answer from the edge", list.Sessions[0].Title)
+
+	var renamed models.ChatSession
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPatch, "/api/v1/chat/sessions/"+response.SessionID, alice,
+		models.RenameSessionRequest{Title: "Greetings"}, &renamed))
+	assert.Equal(t, "Greetings", renamed.Title)
+
+	bob := h.login(t, "bob")
+	assert.Equal(t, http.StatusForbidden, h.do(t, http.MethodPatch, "/api/v1/chat/sessions/"+response.SessionID, bob,
+		models.RenameSessionRequest{Title: "Mine now"}, nil))
+}
+
+func TestChat_ExportSession(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+
+	var response models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice, models.ChatRequest{Message: "Hi there"}, &response))
+
+	path := "/api/v1/chat/sessions/" + response.SessionID + "/export"
+	var export models.SessionExport
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodGet, path+"?format=json", alice, nil, &export))
+	assert.Equal(t, response.SessionID, export.SessionID)
+	assert.Equal(t, 2, export.MessageCount)
+	assert.Equal(t, []string{response.ModelUsed}, export.Models)
+	require.Len(t, export.Messages, 2)
+	assert.Equal(t, response.ModelUsed, export.Messages[1].Model)
+
+	assert.Equal(t, http.StatusOK, h.do(t, http.MethodGet, path, alice, nil, nil))
+	assert.Equal(t, http.StatusBadRequest, h.do(t, http.MethodGet, path+"?format=pdf", alice, nil, nil))
+	assert.Equal(t, http.StatusForbidden, h.do(t, http.MethodGet, path, h.login(t, "bob"), nil, nil))
+}
+
+func TestChat_RegenerateAndEditMessages(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+
+	var response models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice, models.ChatRequest{Message: "Hi there"}, &response))
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice,
+		models.ChatRequest{SessionID: response.SessionID, Message: "Tell me more"}, nil))
+	path := "/api/v1/chat/sessions/" + response.SessionID + "/messages/"
+
+	// Regenerating the first answer drops the second turn
+	var regenerated models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, path+"1/regenerate", alice,
+		models.RegenerateRequest{ForceLLM: true}, &regenerated))
+	assert.Equal(t, "cloud-llm", regenerated.Tier)
+	assert.False(t, regenerated.CacheHit)
+
+	session, err := h.store.GetSession(context.Background(), response.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, []string{"user", "assistant"}, roles(session.Messages))
+	assert.Equal(t, "Hi there", session.Messages[0].Content)
+	assert.Equal(t, "An answer from the cloud.", session.Messages[1].Content)
+	assert.Equal(t, 2, session.MessageCount)
+	assert.Equal(t, "auto", session.ModelPreference, "forcing the LLM isn't remembered")
+
+	var edited models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPatch, path+"0", alice,
+		models.EditMessageRequest{Message: "Hello again"}, &edited))
+	session, err = h.store.GetSession(context.Background(), response.SessionID)
+	require.NoError(t, err)
+	require.Len(t, session.Messages, 2)
+	assert.Equal(t, "Hello again", session.Messages[0].Content)
+	assert.NotEmpty(t, session.Messages[0].ID)
+
+	assert.Equal(t, http.StatusBadRequest, h.do(t, http.MethodPost, path+"0/regenerate", alice, nil, nil))
+	assert.Equal(t, http.StatusBadRequest, h.do(t, http.MethodPatch, path+"1", alice, models.EditMessageRequest{Message: "No"}, nil))
+	assert.Equal(t, http.StatusNotFound, h.do(t, http.MethodPost, path+"5/regenerate", alice, nil, nil))
+	assert.Equal(t, http.StatusForbidden, h.do(t, http.MethodPost, path+"1/regenerate", h.login(t, "bob"), nil, nil))
+}
+
+func roles(messages []models.ChatMessage) []string {
+	roles := make([]string, len(messages))
+	for i, message := range messages {
+		roles[i] = message.Role
+	}
+	return roles
+}
+
+func TestInference_RepeatedQueriesAreCached(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+	req := models.InferenceRequest{Query: "What is the capital of France?"}
+
+	var first models.InferenceResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/inference", alice, req, &first))
+	assert.False(t, first.CacheHit)
+
+	var second models.InferenceResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/inference", alice, req, &second))
+	assert.True(t, second.CacheHit)
+	assert.Equal(t, first.Response, second.Response)
+
+	assert.Len(t, h.slm.Calls(), 1, "the second answer came from Redis")
+}
+
+func TestInference_AsyncJobs(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+	bob := h.login(t, "bob")
+
+	var queued struct {
+		JobID     string `json:"job_id"`
+		StatusURL string `json:"status_url"`
+	}
+	require.Equal(t, http.StatusAccepted, h.do(t, http.MethodPost, "/api/v1/inference/async", alice,
+		models.InferenceRequest{Query: "What is the capital of France?"}, &queued))
+	require.NotEmpty(t, queued.JobID)
+
+	var job jobs.Job
+	require.Eventually(t, func() bool {
+		require.Equal(t, http.StatusOK, h.do(t, http.MethodGet, queued.StatusURL, alice, nil, &job))
+		return job.Done()
+	}, 10*time.Second, 50*time.Millisecond)
+
+	assert.Equal(t, jobs.StatusSucceeded, job.Status)
+	var result models.InferenceResponse
+	require.NoError(t, json.Unmarshal(job.Result, &result))
+	assert.Equal(t, "An answer from the edge.", result.Response)
+	assert.Equal(t, "alice", h.slm.Calls()[0].UserID)
+
+	assert.Equal(t, http.StatusForbidden, h.do(t, http.MethodGet, queued.StatusURL, bob, nil, nil))
+	assert.Equal(t, http.StatusBadRequest, h.do(t, http.MethodPost, "/api/v1/inference/async", alice,
+		models.InferenceRequest{Query: "Hi", Stream: true}, nil))
+}
+
+func TestSummarization_CompactsLongSessions(t *testing.T) {
+	h := newHarness(t)
+	ctx := context.Background()
+
+	session, err := h.store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+
+	long := strings.Repeat("a long message about routing ", 100)
+	for i := 0; i < 10; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		require.NoError(t, h.store.AddMessage(ctx, session.SessionID, role, long, len(long)/4))
+	}
+
+	session, err = h.store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+
+	summarizer := chat.NewSummarizer(h.llm)
+	require.True(t, summarizer.ShouldSummarize(session))
+
+	summarized, err := summarizer.SummarizeSession(ctx, session)
+	require.NoError(t, err)
+	require.NoError(t, h.store.SaveSession(ctx, summarized))
+
+	stored, err := h.store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+	require.Len(t, stored.Messages, 5, "summary plus the recent window")
+	assert.Equal(t, "system", stored.Messages[0].Role)
+	assert.Contains(t, stored.Messages[0].Content, "An answer from the cloud.")
+	assert.Less(t, stored.TotalTokens, session.TotalTokens)
+}
+
+func TestChat_SummarizesLongSessions(t *testing.T) {
+	h := newHarness(t)
+	alice := h.login(t, "alice")
+	ctx := context.Background()
+
+	session, err := h.store.CreateSession(ctx, "alice")
+	require.NoError(t, err)
+	long := strings.Repeat("a long message about routing ", 100)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, h.store.AddMessage(ctx, session.SessionID, "user", long, len(long)/4))
+	}
+
+	var response models.ChatResponse
+	require.Equal(t, http.StatusOK, h.do(t, http.MethodPost, "/api/v1/chat", alice,
+		models.ChatRequest{SessionID: session.SessionID, Message: "Hi there"}, &response))
+	require.NotNil(t, response.CostMetrics)
+	assert.Greater(t, response.CostMetrics.SummarizationCost, 0.0)
+
+	stored, err := h.store.GetSession(ctx, session.SessionID)
+	require.NoError(t, err)
+	require.Len(t, stored.Messages, 7, "summary, the recent window and the new turn")
+	assert.Equal(t, "system", stored.Messages[0].Role)
+}
@@ -0,0 +1,100 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+
+	"www.github.com/Wanderer0074348/HybridLM/src/config"
+	"www.github.com/Wanderer0074348/HybridLM/src/models"
+	"www.github.com/Wanderer0074348/HybridLM/src/storage"
+)
+
+// newPostgres starts a PostgreSQL container and connects the store to it
+func newPostgres(t *testing.T) *storage.Postgres {
+	t.Helper()
+	ctx := context.Background()
+
+	container, err := tcpostgres.Run(ctx, "postgres:16-alpine",
+		tcpostgres.WithDatabase("hybridlm"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	testcontainers.CleanupContainer(t, container)
+	require.NoError(t, err)
+
+	dsn, err := container.ConnectionString(ctx, "sslmode=disable")
+	require.NoError(t, err)
+
+	database, err := storage.NewPostgres(config.PostgresConfig{DSN: dsn, MaxOpenConns: 4})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = database.Close() })
+	return database
+}
+
+func TestPostgres_UsersAndSessions(t *testing.T) {
+	database := newPostgres(t)
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+
+	user, err := database.LoadUser(ctx, "alice")
+	require.NoError(t, err)
+	assert.Nil(t, user)
+
+	require.NoError(t, database.SaveUser(ctx, &models.User{ID: "alice", Email: "alice@example.com", CreatedAt: now}))
+	user, err = database.LoadUser(ctx, "alice")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, "alice@example.com", user.Email)
+
+	live := &models.ChatSession{SessionID: "s1", UserID: "alice", LastInteraction: now}
+	expired := &models.ChatSession{SessionID: "s2", UserID: "alice", LastInteraction: now.Add(-time.Hour)}
+	require.NoError(t, database.SaveSession(ctx, live, now.Add(time.Hour)))
+	require.NoError(t, database.SaveSession(ctx, expired, now.Add(-time.Minute)))
+
+	session, err := database.LoadSession(ctx, "s1")
+	require.NoError(t, err)
+	require.NotNil(t, session)
+	assert.Equal(t, "alice", session.UserID)
+
+	session, err = database.LoadSession(ctx, "s2")
+	require.NoError(t, err)
+	assert.Nil(t, session, "expired sessions aren't loaded")
+
+	sessions, err := database.ListUserSessions(ctx, "alice")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	assert.Equal(t, "s1", sessions[0].SessionID)
+
+	require.NoError(t, database.DeleteSession(ctx, "s1"))
+	session, err = database.LoadSession(ctx, "s1")
+	require.NoError(t, err)
+	assert.Nil(t, session)
+}
+
+func TestPostgres_Usage(t *testing.T) {
+	database := newPostgres(t)
+	ctx := context.Background()
+	periods := []string{"2026-05-01", "2026-05"}
+
+	delta := models.UsageSummary{Requests: 1, TotalTokens: 100, Cost: 0.01}
+	_, err := database.AddUsage(ctx, "alice", periods, delta)
+	require.NoError(t, err)
+	totals, err := database.AddUsage(ctx, "alice", periods, delta)
+	require.NoError(t, err)
+	assert.Equal(t, 2, totals[0].Requests)
+	assert.Equal(t, 200, totals[1].TotalTokens)
+
+	usage, err := database.LoadUsage(ctx, "alice", []string{"2026-05-01", "2026-04-30"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage[0].Requests)
+	assert.InDelta(t, 0.02, usage[0].Cost, 1e-9)
+	assert.Equal(t, "2026-04-30", usage[1].Period)
+	assert.Zero(t, usage[1].Requests)
+}